@@ -0,0 +1,145 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// EnvvarAuditLog names the file Bhojpur GoRPA appends an audit record to for every command it executes
+	EnvvarAuditLog = "GORPA_AUDIT_LOG"
+)
+
+// auditRecord is a single line in the audit log
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Host        string    `json:"host,omitempty"`
+	Command     string    `json:"command"`
+	Args        []string  `json:"args,omitempty"`
+	Application string    `json:"application"`
+	Duration    string    `json:"duration"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var audit struct {
+	mu     sync.Mutex
+	fn     string
+	record *auditRecord
+}
+
+// startAudit begins recording the command for the audit log, if GORPA_AUDIT_LOG is set.
+func startAudit(cmd *cobra.Command, args []string) {
+	fn := os.Getenv(EnvvarAuditLog)
+	if fn == "" {
+		return
+	}
+
+	var username string
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	} else {
+		username = os.Getenv("USER")
+	}
+	host, _ := os.Hostname()
+
+	audit.mu.Lock()
+	audit.fn = fn
+	audit.record = &auditRecord{
+		Time:        time.Now(),
+		User:        username,
+		Host:        host,
+		Command:     cmd.CommandPath(),
+		Args:        args,
+		Application: application,
+	}
+	audit.mu.Unlock()
+
+	// log.Fatal exits the process without returning through Execute, hence we finish the record
+	// from logrus' exit handler as well.
+	log.AddHook(auditFatalHook{})
+	log.RegisterExitHandler(func() { finishAudit(nil) })
+}
+
+// finishAudit appends the command's record to the audit log. Only the first call has an effect.
+func finishAudit(err error) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	rec := audit.record
+	if rec == nil {
+		return
+	}
+	audit.record = nil
+
+	rec.Duration = time.Since(rec.Time).String()
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	rec.Success = rec.Error == ""
+
+	fc, merr := json.Marshal(rec)
+	if merr != nil {
+		log.WithError(merr).Warn("cannot write audit log")
+		return
+	}
+	f, ferr := os.OpenFile(audit.fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if ferr != nil {
+		log.WithError(ferr).Warn("cannot write audit log")
+		return
+	}
+	defer f.Close()
+
+	_, ferr = f.Write(append(fc, '\n'))
+	if ferr != nil {
+		log.WithError(ferr).Warn("cannot write audit log")
+	}
+}
+
+// auditFatalHook records the message of a fatal log entry as the error of the audited command
+type auditFatalHook struct{}
+
+func (auditFatalHook) Levels() []log.Level {
+	return []log.Level{log.FatalLevel}
+}
+
+func (auditFatalHook) Fire(e *log.Entry) error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.record == nil {
+		return nil
+	}
+	audit.record.Error = e.Message
+	if err, ok := e.Data[log.ErrorKey].(error); ok {
+		audit.record.Error += ": " + err.Error()
+	}
+	return nil
+}
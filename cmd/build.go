@@ -22,6 +22,8 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,31 +32,84 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	gorpa "github.com/bhojpur/gorpa/pkg/engine"
 	"github.com/bhojpur/gorpa/pkg/version"
 	"github.com/gookit/color"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
 )
 
 // buildCmd represents the build command
 var buildCmd = &cobra.Command{
-	Use:   "build [targetPackage]",
-	Short: "Builds a package",
-	Args:  cobra.MaximumNArgs(1),
+	Use:   "build [targets...]",
+	Short: "Builds packages",
+	Long: `Builds packages and their dependencies. Without targets, the default target of the application is built.
+
+Targets are package names (e.g. some/component:package) or patterns: //some/... selects all packages of
+some and of the components below it, //... all packages of the application, and //some/...:app only the
+packages named app in those components. some:all selects all packages of some alone, and .:all those of the
+component in the working directory. A list of package types restricts any pattern, e.g. //...[go,yarn].
+Several targets are built in one build. The same patterns work for collect, exec --package and vet --packages.`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		_, pkg, _, _ := getTarget(args, false)
-		if pkg == nil {
-			log.Fatal("build needs a package")
-		}
-		opts, localCache := getBuildOpts(cmd)
-
 		var (
-			watch, _ = cmd.Flags().GetBool("watch")
-			save, _  = cmd.Flags().GetString("save")
-			serve, _ = cmd.Flags().GetString("serve")
+			watch, _  = cmd.Flags().GetBool("watch")
+			save, _   = cmd.Flags().GetString("save")
+			serve, _  = cmd.Flags().GetString("serve")
+			at, _     = cmd.Flags().GetString("at")
+			repro, _  = cmd.Flags().GetBool("reproducibility-check")
+			resume, _ = cmd.Flags().GetBool("resume")
 		)
+		humanOutput := getHumanOutput(cmd)
+		if repro && (watch || save != "" || serve != "") {
+			log.Fatal("--reproducibility-check cannot be combined with --watch, --save or --serve")
+		}
+		if resume && (watch || repro) {
+			log.Fatal("--resume cannot be combined with --watch or --reproducibility-check")
+		}
+		if at != "" {
+			if watch {
+				log.Fatal("--watch and --at are mutually exclusive")
+			}
+			cleanup, err := checkoutRevision(humanOutput, at)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer cleanup()
+		}
+
+		pkg, targets := getBuildTarget(args)
+		if len(targets) > 1 && (repro || save != "" || serve != "") {
+			log.Fatal("--reproducibility-check, --save and --serve require a single package")
+		}
+		opts, localCache := getBuildOpts(cmd, pkg.C.W)
+		if len(targets) > 1 {
+			names := make([]string, 0, len(targets))
+			for _, p := range targets {
+				names = append(names, p.FullName())
+			}
+			fmt.Fprintf(humanOutput, "🎯  building %d targets: %s\n", len(targets), color.Cyan.Render(strings.Join(names, ", ")))
+		}
+		recordGraphSnapshot(pkg.C.W)
+
+		if repro {
+			report, err := gorpa.CheckReproducibility(pkg, opts...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			printReproducibilityReport(humanOutput, report)
+			if !report.Reproducible() {
+				os.Exit(1)
+			}
+			return
+		}
+
 		if watch {
 			err := gorpa.Build(pkg, opts...)
 			if err != nil {
@@ -62,26 +117,26 @@ var buildCmd = &cobra.Command{
 			}
 			ctx, cancel := context.WithCancel(context.Background())
 			if save != "" {
-				saveBuildResult(ctx, save, localCache, pkg)
+				saveBuildResult(ctx, humanOutput, save, localCache, pkg)
 			}
 			if serve != "" {
-				go serveBuildResult(ctx, serve, localCache, pkg)
+				go serveBuildResult(ctx, humanOutput, serve, localCache, pkg)
 			}
 
 			evt, errs := gorpa.WatchSources(context.Background(), append(pkg.GetTransitiveDependencies(), pkg))
 			for {
 				select {
 				case <-evt:
-					_, pkg, _, _ := getTarget(args, false)
+					pkg, _ := getBuildTarget(args)
 					err := gorpa.Build(pkg, opts...)
 					if err == nil {
 						cancel()
 						ctx, cancel = context.WithCancel(context.Background())
 						if save != "" {
-							saveBuildResult(ctx, save, localCache, pkg)
+							saveBuildResult(ctx, humanOutput, save, localCache, pkg)
 						}
 						if serve != "" {
-							go serveBuildResult(ctx, serve, localCache, pkg)
+							go serveBuildResult(ctx, humanOutput, serve, localCache, pkg)
 						}
 					} else {
 						log.Error(err)
@@ -92,20 +147,123 @@ var buildCmd = &cobra.Command{
 			}
 		}
 
-		err := gorpa.Build(pkg, opts...)
+		session, err := gorpa.OpenBuildSession(getBuildSessionLocation(pkg), pkg, resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = gorpa.Build(pkg, append(opts, gorpa.WithBuildSession(session))...)
 		if err != nil {
 			log.Fatal(err)
 		}
 		if save != "" {
-			saveBuildResult(context.Background(), save, localCache, pkg)
+			saveBuildResult(context.Background(), humanOutput, save, localCache, pkg)
 		}
 		if serve != "" {
-			serveBuildResult(context.Background(), serve, localCache, pkg)
+			serveBuildResult(context.Background(), humanOutput, serve, localCache, pkg)
 		}
 	},
 }
 
-func serveBuildResult(ctx context.Context, addr string, localCache *gorpa.FilesystemCache, pkg *gorpa.Package) {
+// getBuildTarget returns the packages the targets select, and the package which builds them: the package itself
+// if they select only one, or a group of all packages if they select several
+func getBuildTarget(args []string) (pkg *gorpa.Package, targets []*gorpa.Package) {
+	application, err := getApplication()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) == 0 {
+		if application.DefaultTarget == "" {
+			log.Fatal("no target")
+		}
+		args = []string{application.DefaultTarget}
+	}
+
+	targets, err = selectTargets(application, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pkg, err = gorpa.GroupTargets(targets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pkg, targets
+}
+
+// checkoutRevision creates a temporary Git worktree of rev and points the application root to the same
+// location within that worktree. The returned function removes the worktree again.
+func checkoutRevision(humanOutput io.Writer, rev string) (cleanup func(), err error) {
+	root, commit, cleanup, err := checkoutWorktree(rev)
+	if err != nil {
+		return nil, err
+	}
+	application = root
+	fmt.Fprintf(humanOutput, "⏪  building at %s (%s)\n", color.Cyan.Render(rev), commit)
+	return cleanup, nil
+}
+
+// checkoutWorktree creates a temporary Git worktree of rev and returns the location of the application root
+// within that worktree. The returned function removes the worktree again.
+func checkoutWorktree(rev string) (root, commit string, cleanup func(), err error) {
+	root, err = filepath.Abs(application)
+	if err != nil {
+		return "", "", nil, err
+	}
+	out, err := exec.Command("git", "-C", root, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", "", nil, xerrors.Errorf("cannot check out %s: the application is not in a Git working copy: %w", rev, err)
+	}
+	toplevel := strings.TrimSpace(string(out))
+	rel, err := filepath.Rel(toplevel, root)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	out, err = exec.Command("git", "-C", toplevel, "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output()
+	if err != nil {
+		return "", "", nil, xerrors.Errorf("unknown revision %s", rev)
+	}
+	commit = strings.TrimSpace(string(out))
+
+	worktree, err := ioutil.TempDir("", "gorpa-at-")
+	if err != nil {
+		return "", "", nil, err
+	}
+	out, err = exec.Command("git", "-C", toplevel, "worktree", "add", "--detach", worktree, commit).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(worktree)
+		return "", "", nil, xerrors.Errorf("cannot check out %s: %w: %s", rev, err, string(out))
+	}
+
+	var once sync.Once
+	cleanup = func() {
+		once.Do(func() {
+			out, err := exec.Command("git", "-C", toplevel, "worktree", "remove", "--force", worktree).CombinedOutput()
+			if err != nil {
+				log.WithError(err).WithField("output", string(out)).WithField("worktree", worktree).Warn("cannot remove worktree")
+			}
+		})
+	}
+	// log.Fatal does not run deferred functions
+	log.RegisterExitHandler(cleanup)
+
+	return filepath.Join(worktree, rel), commit, cleanup, nil
+}
+
+func printReproducibilityReport(humanOutput io.Writer, report *gorpa.ReproducibilityReport) {
+	if report.Reproducible() {
+		fmt.Fprintf(humanOutput, "\n✅  %s is reproducible: %d files are identical in both builds %s\n", report.Package.FullName(), report.Files, color.Gray.Sprintf("(version %s)", report.Version))
+		return
+	}
+
+	fmt.Fprintf(humanOutput, "\n❌  %s is not reproducible: %d of %d files differ between both builds %s\n", report.Package.FullName(), len(report.Differences), report.Files, color.Gray.Sprintf("(version %s)", report.Version))
+	tw := tabwriter.NewWriter(humanOutput, 0, 4, 2, ' ', 0)
+	for _, d := range report.Differences {
+		fmt.Fprintf(tw, "    %s\t%s\n", d.Reason, d.Name)
+	}
+	tw.Flush()
+}
+
+func serveBuildResult(ctx context.Context, humanOutput io.Writer, addr string, localCache *gorpa.FilesystemCache, pkg *gorpa.Package) {
 	br, exists := localCache.Location(pkg)
 	if !exists {
 		log.Fatal("build result is not in local cache despite just being built. Something's wrong with the cache.")
@@ -127,7 +285,7 @@ func serveBuildResult(ctx context.Context, addr string, localCache *gorpa.Filesy
 		return
 	}
 
-	fmt.Printf("\n📢  serving build result on %s\n", color.Cyan.Render(addr))
+	fmt.Fprintf(humanOutput, "\n📢  serving build result on %s\n", color.Cyan.Render(addr))
 	server := &http.Server{Addr: addr, Handler: http.FileServer(http.Dir(tmp))}
 	go func() {
 		err = server.ListenAndServe()
@@ -142,7 +300,18 @@ func serveBuildResult(ctx context.Context, addr string, localCache *gorpa.Filesy
 	}
 }
 
-func saveBuildResult(ctx context.Context, loc string, localCache *gorpa.FilesystemCache, pkg *gorpa.Package) {
+func serveMetrics(addr string, metrics *gorpa.MetricsReporter) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	log.WithField("addr", addr).Info("serving build metrics")
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		// metrics are for monitoring only - the build goes on without them
+		log.WithError(err).Warn("cannot serve build metrics")
+	}
+}
+
+func saveBuildResult(ctx context.Context, humanOutput io.Writer, loc string, localCache *gorpa.FilesystemCache, pkg *gorpa.Package) {
 	br, exists := localCache.Location(pkg)
 	if !exists {
 		log.Fatal("build result is not in local cache despite just being built. Something's wrong with the cache.")
@@ -165,7 +334,7 @@ func saveBuildResult(ctx context.Context, loc string, localCache *gorpa.Filesyst
 		log.WithError(err).Fatal("cannot copy build result")
 	}
 
-	fmt.Printf("\n💾  saving build result to %s\n", color.Cyan.Render(loc))
+	fmt.Fprintf(humanOutput, "\n💾  saving build result to %s\n", color.Cyan.Render(loc))
 }
 
 func init() {
@@ -175,6 +344,10 @@ func init() {
 	buildCmd.Flags().String("serve", "", "After a successful build this starts a webserver on the given address serving the build result (e.g. --serve localhost:8080)")
 	buildCmd.Flags().String("save", "", "After a successful build this saves the build result as tar.gz file in the local filesystem (e.g. --save build-result.tar.gz)")
 	buildCmd.Flags().Bool("watch", false, "Watch source files and re-build on change")
+	buildCmd.Flags().String("at", "", "Builds the package as of a Git revision (e.g. a release tag) using a temporary worktree. Caches are shared with regular builds.")
+	buildCmd.Flags().Bool("resume", false, "Resumes an interrupted build of the package, reusing the versions of unchanged packages and skipping the remote cache lookups it made already")
+	buildCmd.Flags().Bool("reproducibility-check", false, "Builds the package twice in clean build directories and lists the files which differ between both artifacts. Fails if the package is not reproducible.")
+	buildCmd.Flags().String("release-tag", "", "Marks the cached artifacts of the package and all its dependencies with a retention marker for this release (e.g. v1.2.3), s.t. they are never pruned from the remote cache")
 }
 
 func addBuildFlags(cmd *cobra.Command) {
@@ -185,31 +358,101 @@ func addBuildFlags(cmd *cobra.Command) {
 
 	cmd.Flags().StringP("cache", "c", cacheDefault, "Configures the caching behaviour: none=no caching, local=local caching only, remote-pull=download from remote but never upload, remote-push=push to remote cache only but don't download, remote=use all configured caches")
 	cmd.Flags().StringSlice("add-remote-cache", []string{}, "Configures additional (pull-only) remote caches")
-	cmd.Flags().Bool("dry-run", false, "Don't actually build but stop after showing what would need to be built")
-	cmd.Flags().String("dump-plan", "", "Writes the build plan as JSON to a file. Use \"-\" to write the build plan to stderr.")
+	cmd.Flags().Uint("cache-transfer-jobs", uint(gorpa.DefaultTransferOptions.Jobs), "Number of concurrent remote cache transfers")
+	cmd.Flags().Int("cache-transfer-retries", gorpa.DefaultTransferOptions.Retries, "Number of times a failed remote cache transfer is retried")
+	cmd.Flags().Duration("cache-transfer-backoff", gorpa.DefaultTransferOptions.Backoff, "Delay before retrying a failed remote cache transfer. Doubles with every retry.")
+	cmd.Flags().Duration("cache-transfer-timeout", gorpa.DefaultTransferOptions.Timeout, "Timeout of a single remote cache transfer - set to 0 to disable the timeout")
+	cmd.Flags().Bool("dry-run", false, "Don't actually build but show which packages would be built, downloaded from a remote cache or are cached already")
+	cmd.Flags().String("dump-plan", "", "Writes the build plan, including the status of every package, to a file. Use \"-\" to write the build plan to stderr.")
+	cmd.Flags().String("dump-plan-format", "json", "Format of the build plan written by --dump-plan: json (the build steps), annotated (JSON including the status of every package), dot (Graphviz) or mermaid")
 	cmd.Flags().Bool("gorpa", false, "Produce GoRPA CI compatible output")
 	cmd.Flags().Bool("dont-test", false, "Disable all package-level tests (defaults to false)")
 	cmd.Flags().Bool("dont-retag", false, "Disable Docker image re-tagging (defaults to false)")
-	cmd.Flags().UintP("max-concurrent-tasks", "j", uint(runtime.NumCPU()), "Limit the number of max concurrent build tasks - set to 0 to disable the limit")
+	cmd.Flags().UintP("max-concurrent-tasks", "j", uint(runtime.NumCPU()), "Limit the number of max concurrent build tasks - set to 0 to disable the limit. Packages take one task per CPU in their resources.")
+	cmd.Flags().String("max-memory", "", "Limit the memory concurrent package builds declare in their resources altogether, e.g. 16G")
 	cmd.Flags().String("coverage-output-path", "", "Output path where test coverage file will be copied after running tests")
 	cmd.Flags().StringToString("docker-build-options", nil, "Options passed to all 'docker build' commands")
+	cmd.Flags().String("go-cache", string(gorpa.GoCacheShared), "Configures the GOCACHE of Go package builds: shared=one cache for all packages, isolated=one cache per package, off=use the GOCACHE of the environment")
+	cmd.Flags().String("image-namespace", "", "Replaces the registry and repository path of all Docker images, e.g. docker.io/alice pushes eu.gcr.io/some-project/app:v1 as docker.io/alice/app:v1")
+	cmd.Flags().String("image-suffix", "", "Appends a suffix to the tag of all Docker images, e.g. -dev pushes app:v1 as app:v1-dev")
+	cmd.Flags().String("docker-builder", string(gorpa.DockerBuilderClassic), "Configures how Docker packages are built: docker=docker build, buildx=docker buildx build, buildkit=buildctl against a buildkitd, kaniko=kaniko executor, buildah=buildah build")
+	cmd.Flags().String("buildkit-addr", "", "Address of the buildkitd used by the buildkit Docker builder (defaults to $BUILDKIT_HOST)")
+	cmd.Flags().String("buildkit-cache", string(gorpa.BuildKitCacheInline), "Configures the layer cache of the buildx and buildkit Docker builders: inline=embed in and import from pushed images, local=keep in the local cache directory, remote=keep in the local and the remote cache, off=no cache")
+	cmd.Flags().Bool("force-tests", false, "Run the tests of packages even if they passed for the package version before")
+	cmd.Flags().Int("test-retries", 0, "Number of times failing package tests are run again, unless a package configures its own testRetry")
+	cmd.Flags().Duration("test-retry-backoff", 5*time.Second, "Delay before retrying failing package tests. Doubles with every retry.")
+	cmd.Flags().StringSlice("test-quarantine", nil, "Packages whose tests are known to be flaky, e.g. comp:pkg. Their test failures are reported but don't fail the build.")
+	cmd.Flags().Duration("build-timeout", 0, "Kill the build commands of a package which run longer than this altogether, unless the package configures its own timeout, e.g. 30m")
+	cmd.Flags().Duration("test-timeout", 0, "Kill the tests of a package which run longer than this, unless the package configures its own timeout, e.g. 10m")
+	cmd.Flags().BoolP("keep-going", "k", false, "Keep building the packages whose dependencies were built once a package build failed, and report all failed packages at the end")
+	cmd.Flags().String("output", "console", "Configures what the build prints to stdout: console=the build progress, porcelain=one line per package once the build has finished (package, status, version and artifact, separated by tabs) while the build progress goes to stderr")
+	cmd.Flags().String("console-output", "full", "Configures which output of package builds is printed: full=all output, failures=the last lines of failed package builds. The full output is written to the package logs, see 'gorpa logs'.")
+	cmd.Flags().Bool("upload-logs", false, "Upload the logs of newly built packages to the remote cache, next to their artifacts")
+	cmd.Flags().Bool("sandbox", false, "Hide the application from build commands, so that builds which read files the packages don't declare fail (Linux only)")
+	cmd.Flags().String("yarn-mirror", "off", "Configures the offline mirror yarn packages are installed from: off=install from the registry, local=keep the mirror in the local cache directory, remote=keep the mirror in the local and the remote cache")
+	cmd.Flags().Bool("yarn-offline", false, "Install yarn packages exclusively from the offline mirror, i.e. without contacting the registry")
+	cmd.Flags().StringSlice("skip", nil, "Packages which are not built, e.g. comp:pkg. Packages which depend on them are skipped, too, unless they are cached.")
+	cmd.Flags().Uint("push-jobs", uint(gorpa.DefaultPushOptions.Jobs), "Number of Docker images pushed concurrently, independent of --max-concurrent-tasks")
+	cmd.Flags().Int("push-retries", gorpa.DefaultPushOptions.Retries, "Number of times a failed Docker image push is retried")
+	cmd.Flags().Duration("push-backoff", gorpa.DefaultPushOptions.Backoff, "Delay before retrying a failed Docker image push. Doubles with every retry.")
+	cmd.Flags().Bool("sign-images", false, "Sign pushed Docker images using cosign and attach their SLSA provenance as attestation. Signs keyless unless --cosign-key is set.")
+	cmd.Flags().String("cosign-key", "", "Key cosign signs pushed Docker images with, i.e. a key file or KMS URI (implies --sign-images)")
+	cmd.Flags().StringSlice("only-types", nil, "Build only packages of these types, e.g. go,yarn. Packages which depend on other types are skipped, too, unless they are cached.")
+	cmd.Flags().String("profile", "", "Writes a Chrome trace (trace.json) and a summary of the slowest packages (summary.txt) of the build to this directory")
+	cmd.Flags().String("metrics-addr", "", "Serves Prometheus metrics of the build on this address, e.g. :9102")
+	cmd.Flags().String("metrics-pushgateway", "", "Pushes Prometheus metrics to this pushgateway once the build has finished, e.g. http://pushgateway:9091")
+	cmd.Flags().String("fault-injection", "", "Injects faults to test retries and error handling, e.g. seed=42,download-failure=0.3,corrupt=0.1,delay=5s")
+	_ = cmd.Flags().MarkHidden("fault-injection")
+
+}
 
+// getHumanOutput returns where a command prints the messages meant for humans. In porcelain output mode stdout
+// is reserved for the porcelain records, hence everything else goes to stderr.
+func getHumanOutput(cmd *cobra.Command) io.Writer {
+	if output, _ := cmd.Flags().GetString("output"); output == "porcelain" {
+		return os.Stderr
+	}
+	return os.Stdout
 }
 
-func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCache) {
+func getBuildOpts(cmd *cobra.Command, application *gorpa.Application) ([]gorpa.BuildOption, *gorpa.FilesystemCache) {
 	cm, _ := cmd.Flags().GetString("cache")
 	log.WithField("cacheMode", cm).Debug("configuring caches")
 	cacheLevel := gorpa.CacheLevel(cm)
 
-	remoteCache := getRemoteCache()
+	transferJobs, _ := cmd.Flags().GetUint("cache-transfer-jobs")
+	if transferJobs == 0 {
+		log.Fatal("--cache-transfer-jobs must be greater than zero")
+	}
+	transfer := gorpa.TransferOptions{Jobs: int(transferJobs)}
+	transfer.Retries, _ = cmd.Flags().GetInt("cache-transfer-retries")
+	transfer.Backoff, _ = cmd.Flags().GetDuration("cache-transfer-backoff")
+	transfer.Timeout, _ = cmd.Flags().GetDuration("cache-transfer-timeout")
+	humanOutput := getHumanOutput(cmd)
+	transfer.Progress = humanOutput
+
+	var faults *gorpa.FaultInjection
+	if spec, _ := cmd.Flags().GetString("fault-injection"); spec != "" {
+		var err error
+		faults, err = gorpa.ParseFaultInjection(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.WithField("seed", faults.Seed).Warn("fault injection is enabled - builds will fail on purpose")
+		transfer.Faults = faults
+	}
+
+	// the remote cache is configured only if it's used, s.t. an incomplete configuration does not get in the way of local builds
+	var remoteCache gorpa.RemoteCache
 	switch cacheLevel {
 	case gorpa.CacheNone, gorpa.CacheLocal:
 		remoteCache = gorpa.NoRemoteCache{}
 	case gorpa.CacheRemotePull:
-		remoteCache = &pullOnlyRemoteCache{C: remoteCache}
+		remoteCache = &pullOnlyRemoteCache{C: getRemoteCache(application, transfer)}
 	case gorpa.CacheRemotePush:
-		remoteCache = &pushOnlyRemoteCache{C: remoteCache}
+		remoteCache = &pushOnlyRemoteCache{C: getRemoteCache(application, transfer)}
 	case gorpa.CacheRemote:
+		remoteCache = getRemoteCache(application, transfer)
 	default:
 		log.Fatalf("invalid cache level: %s", cacheLevel)
 	}
@@ -224,10 +467,7 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 			log.Fatal(err)
 		}
 	} else {
-		localCacheLoc = os.Getenv(gorpa.EnvvarCacheDir)
-		if localCacheLoc == "" {
-			localCacheLoc = filepath.Join(os.TempDir(), "cache")
-		}
+		localCacheLoc = getLocalCacheLocation()
 	}
 	log.WithField("location", localCacheLoc).Debug("set up local cache")
 	localCache, err := gorpa.NewFilesystemCache(localCacheLoc)
@@ -241,6 +481,7 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 		arcs = append(arcs, &pullOnlyRemoteCache{
 			C: gorpa.GSUtilRemoteCache{
 				BucketName: arc,
+				Transfer:   transfer,
 			},
 		})
 	}
@@ -252,6 +493,7 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 
 	log.Debugf("Bhojpur GoRPA version %s", version.Version)
 
+	planFormat, _ := cmd.Flags().GetString("dump-plan-format")
 	var planOutlet io.Writer
 	if plan, _ := cmd.Flags().GetString("dump-plan"); plan != "" {
 		if plan == "-" {
@@ -261,21 +503,63 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 			if err != nil {
 				log.Fatal(err)
 			}
-			defer f.Close()
-
+			// the plan is written by the build after we've returned, hence the file stays open until gorpa exits
 			planOutlet = f
 		}
 	}
 
+	var imageRewrite gorpa.DockerImageRewrite
+	imageRewrite.Namespace, _ = cmd.Flags().GetString("image-namespace")
+	imageRewrite.Suffix, _ = cmd.Flags().GetString("image-suffix")
+	if !imageRewrite.IsEmpty() {
+		log.WithField("namespace", imageRewrite.Namespace).WithField("suffix", imageRewrite.Suffix).Info("rewriting Docker image names")
+	}
+
 	gorpalog, err := cmd.Flags().GetBool("gorpa")
 	if err != nil {
 		log.Fatal(err)
 	}
 	var reporter gorpa.Reporter
 	if gorpalog {
-		reporter = gorpa.NewGorpaReporter()
+		rep := gorpa.NewGorpaReporter()
+		rep.ImageRewrite = imageRewrite
+		rep.Out = humanOutput
+		reporter = rep
 	} else {
-		reporter = gorpa.NewConsoleReporter()
+		rep := gorpa.NewConsoleReporter()
+		rep.Out = humanOutput
+		reporter = rep
+	}
+	switch consoleOutput, _ := cmd.Flags().GetString("console-output"); consoleOutput {
+	case "full":
+	case "failures":
+		reporter = gorpa.NewConciseReporter(reporter)
+	default:
+		log.Fatalf("--console-output must be one of full or failures")
+	}
+	switch output, _ := cmd.Flags().GetString("output"); output {
+	case "console":
+	case "porcelain":
+		reporter = gorpa.CompositeReporter{reporter, gorpa.NewPorcelainReporter(os.Stdout, localCache)}
+	default:
+		log.Fatalf("--output must be one of console or porcelain")
+	}
+	reporter = gorpa.CompositeReporter{reporter, gorpa.NewRecordingReporter(getLastBuildLocation())}
+	if ledger := getLedger(application, os.Getenv(EnvvarLedger), transfer); ledger != nil {
+		reporter = gorpa.CompositeReporter{reporter, gorpa.NewLedgerReporter(ledger, localCache)}
+	}
+	if profile, _ := cmd.Flags().GetString("profile"); profile != "" {
+		reporter = gorpa.CompositeReporter{reporter, gorpa.NewProfilingReporter(profile)}
+	}
+	metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+	pushGateway, _ := cmd.Flags().GetString("metrics-pushgateway")
+	if metricsAddr != "" || pushGateway != "" {
+		metrics := gorpa.NewMetricsReporter(localCache)
+		metrics.PushGateway = pushGateway
+		if metricsAddr != "" {
+			go serveMetrics(metricsAddr, metrics)
+		}
+		reporter = gorpa.CompositeReporter{reporter, metrics}
 	}
 
 	dontTest, err := cmd.Flags().GetBool("dont-test")
@@ -292,6 +576,7 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 	if err != nil {
 		log.Fatal(err)
 	}
+	maxMemory, _ := cmd.Flags().GetString("max-memory")
 
 	coverageOutputPath, _ := cmd.Flags().GetString("coverage-output-path")
 	if coverageOutputPath != "" {
@@ -304,25 +589,209 @@ func getBuildOpts(cmd *cobra.Command) ([]gorpa.BuildOption, *gorpa.FilesystemCac
 		log.Fatal(err)
 	}
 
+	goCacheMode, _ := cmd.Flags().GetString("go-cache")
+
+	dockerBuilder, _ := cmd.Flags().GetString("docker-builder")
+	var buildKitOpts gorpa.BuildKitOptions
+	buildKitOpts.Addr, _ = cmd.Flags().GetString("buildkit-addr")
+	buildKitCache, _ := cmd.Flags().GetString("buildkit-cache")
+	buildKitOpts.Cache = gorpa.BuildKitCacheMode(buildKitCache)
+	buildKitOpts.CacheDir = filepath.Join(localCacheLoc, "buildkit")
+	if buildKitOpts.Cache == gorpa.BuildKitCacheRemote {
+		buildKitOpts.Remote, buildKitOpts.RemoteLevel = getObjectCacheRemote(application, transfer, cacheLevel, "--buildkit-cache=remote", "layer cache")
+		if buildKitOpts.Remote == nil {
+			buildKitOpts.Cache = gorpa.BuildKitCacheLocal
+		}
+	}
+
+	forceTests, _ := cmd.Flags().GetBool("force-tests")
+	testRetries, _ := cmd.Flags().GetInt("test-retries")
+	testRetryBackoff, _ := cmd.Flags().GetDuration("test-retry-backoff")
+	testQuarantine, _ := cmd.Flags().GetStringSlice("test-quarantine")
+	keepGoing, _ := cmd.Flags().GetBool("keep-going")
+	var timeouts gorpa.Timeouts
+	timeouts.Build, _ = cmd.Flags().GetDuration("build-timeout")
+	timeouts.Test, _ = cmd.Flags().GetDuration("test-timeout")
+	sandbox, _ := cmd.Flags().GetBool("sandbox")
+
+	var yarnMirror gorpa.YarnMirrorOptions
+	yarnMirrorMode, _ := cmd.Flags().GetString("yarn-mirror")
+	switch yarnMirrorMode {
+	case "off":
+	case "local":
+		yarnMirror.Dir = filepath.Join(localCacheLoc, "yarn-mirror")
+	case "remote":
+		yarnMirror.Dir = filepath.Join(localCacheLoc, "yarn-mirror")
+		yarnMirror.Remote, yarnMirror.RemoteLevel = getObjectCacheRemote(application, transfer, cacheLevel, "--yarn-mirror=remote", "yarn offline mirror")
+	default:
+		log.Fatalf("--yarn-mirror must be one of off, local or remote")
+	}
+	yarnMirror.Offline, _ = cmd.Flags().GetBool("yarn-offline")
+	if yarnMirror.Offline && yarnMirror.Dir == "" {
+		log.Fatal("--yarn-offline requires --yarn-mirror=local or --yarn-mirror=remote")
+	}
+
+	var skip gorpa.SkipFilter
+	skip.Packages, _ = cmd.Flags().GetStringSlice("skip")
+	for _, name := range skip.Packages {
+		if _, exists := application.Packages[name]; !exists {
+			log.WithField("package", name).Warn("--skip: package does not exist")
+		}
+	}
+	onlyTypes, _ := cmd.Flags().GetStringSlice("only-types")
+	for _, tpe := range onlyTypes {
+		skip.OnlyTypes = append(skip.OnlyTypes, gorpa.PackageType(tpe))
+	}
+
+	var releaseStore gorpa.RemoteCache
+	releaseTag, _ := cmd.Flags().GetString("release-tag")
+	if releaseTag != "" {
+		releaseStore = getReleaseTagRemote(application, transfer, cacheLevel)
+	}
+
+	packageLogs := gorpa.PackageLogOptions{Enabled: true}
+	if uploadLogs, _ := cmd.Flags().GetBool("upload-logs"); uploadLogs {
+		packageLogs.Remote, _ = getObjectCacheRemote(application, transfer, cacheLevel, "--upload-logs", "package logs")
+	}
+
+	var push gorpa.PushOptions
+	pushJobs, _ := cmd.Flags().GetUint("push-jobs")
+	push.Jobs = int(pushJobs)
+	push.Retries, _ = cmd.Flags().GetInt("push-retries")
+	push.Backoff, _ = cmd.Flags().GetDuration("push-backoff")
+
+	var signing gorpa.ImageSigning
+	signing.Enabled, _ = cmd.Flags().GetBool("sign-images")
+	signing.Key, _ = cmd.Flags().GetString("cosign-key")
+	if signing.Key != "" {
+		signing.Enabled = true
+		if _, err := os.Stat(signing.Key); err == nil {
+			// cosign runs in the build directory, hence relative key files would not resolve
+			signing.Key, err = filepath.Abs(signing.Key)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
 	return []gorpa.BuildOption{
 		gorpa.WithLocalCache(localCache),
 		gorpa.WithRemoteCache(remoteCache),
 		gorpa.WithAdditionalRemoteCaches(arcs),
 		gorpa.WithDryRun(dryrun),
 		gorpa.WithBuildPlan(planOutlet),
+		gorpa.WithBuildPlanFormat(gorpa.BuildPlanFormat(planFormat)),
 		gorpa.WithReporter(reporter),
+		gorpa.WithHumanOutput(humanOutput),
 		gorpa.WithDontTest(dontTest),
 		gorpa.WithMaxConcurrentTasks(int64(maxConcurrentTasks)),
+		gorpa.WithMaxMemory(maxMemory),
 		gorpa.WithCoverageOutputPath(coverageOutputPath),
 		gorpa.WithDontRetag(dontRetag),
 		gorpa.WithDockerBuildOptions(&dockerBuildOptions),
+		gorpa.WithGoCache(gorpa.GoCacheMode(goCacheMode), filepath.Join(localCacheLoc, "go-build")),
+		gorpa.WithFetchCache(filepath.Join(localCacheLoc, "fetch")),
+		gorpa.WithGoToolchains(filepath.Join(localCacheLoc, "go-toolchains")),
+		gorpa.WithNodeToolchains(filepath.Join(localCacheLoc, "node-toolchains")),
+		gorpa.WithLintCache(filepath.Join(localCacheLoc, "lint")),
+		gorpa.WithTestCache(filepath.Join(localCacheLoc, "tests")),
+		gorpa.WithForceTests(forceTests),
+		gorpa.WithTestRetries(testRetries, testRetryBackoff),
+		gorpa.WithTestQuarantine(testQuarantine),
+		gorpa.WithTimeouts(timeouts),
+		gorpa.WithSandbox(sandbox),
+		gorpa.WithGoGenerateCache(filepath.Join(localCacheLoc, "go-generate")),
+		gorpa.WithDockerBuilder(gorpa.DockerBuilder(dockerBuilder), buildKitOpts),
+		gorpa.WithContainerCLI(getContainerCLI(application)),
+		gorpa.WithSkipFilter(skip),
+		gorpa.WithDockerImageRewrite(imageRewrite),
+		gorpa.WithImageSigning(signing),
+		gorpa.WithPushOptions(push),
+		gorpa.WithReleaseTag(releaseTag, releaseStore),
+		gorpa.WithKeepGoing(keepGoing),
+		gorpa.WithFaultInjection(faults),
+		gorpa.WithYarnMirror(yarnMirror),
+		gorpa.WithPackageLogs(packageLogs),
 	}, localCache
 }
 
+// getLastBuildLocation returns the directory where the report and log of the last build are kept
+func getLastBuildLocation() string {
+	return filepath.Join(getLocalCacheLocation(), "last-build")
+}
+
+// getBuildSessionLocation returns the file which keeps the state of a build of pkg, s.t. it can resume once interrupted
+func getBuildSessionLocation(pkg *gorpa.Package) string {
+	id := sha256.Sum256([]byte(pkg.C.W.Origin + "\x00" + pkg.FullName()))
+	return filepath.Join(getLocalCacheLocation(), "sessions", hex.EncodeToString(id[:8])+".json")
+}
+
+// getContainerCLI returns the container CLI configured in the environment or, failing that, in the APPLICATION.yaml
+func getContainerCLI(application *gorpa.Application) gorpa.ContainerCLI {
+	if cli := os.Getenv(gorpa.EnvvarContainerCLI); cli != "" {
+		return gorpa.ContainerCLI(cli)
+	}
+	return application.ContainerCLI
+}
+
+func getLocalCacheLocation() string {
+	res := os.Getenv(gorpa.EnvvarCacheDir)
+	if res == "" {
+		res = filepath.Join(os.TempDir(), "cache")
+	}
+	return res
+}
+
+// getObjectCacheRemote returns the remote cache storage a cache other than the artifacts (e.g. the BuildKit layer
+// cache) is kept in, or nil if it cannot be stored remotely. flag and what name the cache in log messages.
+func getObjectCacheRemote(application *gorpa.Application, transfer gorpa.TransferOptions, level gorpa.CacheLevel, flag, what string) (gorpa.RemoteCache, gorpa.CacheLevel) {
+	switch level {
+	case gorpa.CacheRemote, gorpa.CacheRemotePull, gorpa.CacheRemotePush:
+	default:
+		log.WithField("cache", level).Warnf("%s requires a remote cache level - keeping the %s locally", flag, what)
+		return nil, level
+	}
+
+	rc := getRemoteCacheStorage(application, transfer)
+	if rc == nil {
+		log.Warnf("%s requires a remote cache - keeping the %s locally", flag, what)
+		return nil, level
+	}
+	key, err := gorpa.LoadCacheEncryptionKey()
+	if err != nil {
+		log.WithError(err).Fatal("cannot load remote cache encryption key")
+	}
+	if key != nil {
+		// the cache is transferred as is, which would defeat the purpose of encrypting the remote cache
+		log.Warnf("%s is not supported with an encrypted remote cache - keeping the %s locally", flag, what)
+		return nil, level
+	}
+	return rc, level
+}
+
+// getReleaseTagRemote returns the remote cache storage the retention markers of a release build are uploaded to
+func getReleaseTagRemote(application *gorpa.Application, transfer gorpa.TransferOptions, level gorpa.CacheLevel) gorpa.RemoteCache {
+	switch level {
+	case gorpa.CacheRemote, gorpa.CacheRemotePush:
+	default:
+		log.WithField("cache", level).Fatal("--release-tag requires a cache level which uploads to the remote cache")
+	}
+
+	rc := getRemoteCacheStorage(application, transfer)
+	if rc == nil {
+		log.Fatal("--release-tag requires a remote cache")
+	}
+	return rc
+}
+
 type pushOnlyRemoteCache struct {
 	C gorpa.RemoteCache
 }
 
+func (c *pushOnlyRemoteCache) String() string {
+	return gorpa.RemoteCacheName(c.C)
+}
+
 func (c *pushOnlyRemoteCache) Download(dst gorpa.Cache, pkgs []*gorpa.Package) error {
 	return nil
 }
@@ -331,10 +800,18 @@ func (c *pushOnlyRemoteCache) Upload(src gorpa.Cache, pkgs []*gorpa.Package) err
 	return c.C.Upload(src, pkgs)
 }
 
+func (c *pushOnlyRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	return map[string]int64{}, map[string]error{}
+}
+
 type pullOnlyRemoteCache struct {
 	C gorpa.RemoteCache
 }
 
+func (c *pullOnlyRemoteCache) String() string {
+	return gorpa.RemoteCacheName(c.C)
+}
+
 func (c *pullOnlyRemoteCache) Download(dst gorpa.Cache, pkgs []*gorpa.Package) error {
 	return c.C.Download(dst, pkgs)
 }
@@ -342,3 +819,7 @@ func (c *pullOnlyRemoteCache) Download(dst gorpa.Cache, pkgs []*gorpa.Package) e
 func (c *pullOnlyRemoteCache) Upload(src gorpa.Cache, pkgs []*gorpa.Package) error {
 	return nil
 }
+
+func (c *pullOnlyRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	return gorpa.StatRemoteObjects(c.C, names)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// cacheRekeyCmd represents the cache rekey command
+var cacheRekeyCmd = &cobra.Command{
+	Use:   "rekey [target]",
+	Short: "Copies the artifacts in the remote cache to the versions computed using the current content hash configuration",
+	Long: `Copies the artifacts of a package or component and its dependencies which the remote cache holds under their versions
+computed using a previous content hash algorithm and key to the versions computed using the contentHash configured
+in the APPLICATION.yaml. Run this after changing the content hash, s.t. the next build does not rebuild everything.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		comp, pkg, _, _ := getTarget(args, false)
+
+		var (
+			pkgs        []*gorpa.Package
+			application *gorpa.Application
+		)
+		if pkg != nil {
+			pkgs = []*gorpa.Package{pkg}
+			application = pkg.C.W
+		} else if comp != nil {
+			pkgs = comp.Packages
+			application = comp.W
+		} else {
+			log.Fatal("cache rekey needs a package or component")
+		}
+
+		if cm, _ := cmd.Flags().GetString("cache"); cm != string(gorpa.CacheRemote) {
+			log.Fatalf("cache rekey needs to download from and upload to the remote cache - cannot use cache level %s", cm)
+		}
+		opts, _ := getBuildOpts(cmd, application)
+
+		var from gorpa.ContentHash
+		algo, _ := cmd.Flags().GetString("from-algorithm")
+		from.Algorithm = gorpa.ContentHashAlgorithm(algo)
+		from.Key, _ = cmd.Flags().GetString("from-key")
+
+		rekeyed, err := gorpa.Rekey(pkgs, from, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sort.Slice(rekeyed, func(i, j int) bool { return rekeyed[i].FullName() < rekeyed[j].FullName() })
+		for _, p := range rekeyed {
+			log.WithField("package", p.FullName()).Debug("rekeyed artifact")
+		}
+		fmt.Printf("\n🔑  rekeyed %s artifacts from %s to %s\n", color.Green.Render(len(rekeyed)), from, application.ContentHash)
+	},
+}
+
+func init() {
+	addBuildFlags(cacheRekeyCmd)
+	cacheRekeyCmd.Flags().String("from-algorithm", string(gorpa.ContentHashHighwayhash), "content hash algorithm the artifacts were cached with")
+	cacheRekeyCmd.Flags().String("from-key", "", "hex-encoded content hash key the artifacts were cached with (defaults to the built-in key)")
+	cacheRekeyCmd.Flags().String("release-tag", "", "carries the retention markers of this release over to the rekeyed artifacts")
+	cacheCmd.AddCommand(cacheRekeyCmd)
+}
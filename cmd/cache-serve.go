@@ -0,0 +1,82 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// cacheServeCmd represents the cache serve command
+var cacheServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves the local cache over HTTP so that other machines can use it as remote cache",
+	Long: `Serves the local cache over HTTP so that other machines, e.g. in a team room or a CI fleet, can share
+build artifacts without each of them hitting the cloud storage.
+
+Clients use the server by setting GORPA_REMOTE_CACHE_STORAGE=HTTP and GORPA_REMOTE_CACHE_BUCKET to the server's URL.
+With --read-through, artifacts which are not in the local cache are downloaded from the remote cache configured
+in the server's environment before they are served. Clients may upload artifacts only if --allow-upload is given.
+Uploaded artifacts remain on the server and are not passed on to the remote cache.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			addr, _        = cmd.Flags().GetString("listen")
+			readThrough, _ = cmd.Flags().GetBool("read-through")
+			allowUpload, _ = cmd.Flags().GetBool("allow-upload")
+		)
+
+		var upstream gorpa.RemoteCache
+		if readThrough {
+			application, err := getApplication()
+			if err != nil {
+				log.Fatal(err)
+			}
+			// the server passes objects through as they are, hence clients encrypt and compute deltas themselves
+			upstream = getRemoteCacheStorage(&application, gorpa.DefaultTransferOptions)
+			if upstream == nil {
+				log.Fatalf("--read-through requires a remote cache - set %s", EnvvarRemoteCacheBucket)
+			}
+		}
+
+		srv, err := gorpa.NewCacheServer(getLocalCacheLocation(), upstream, allowUpload)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("📦  serving %s on %s\n", srv.Location, addr)
+		err = http.ListenAndServe(addr, srv)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	cacheServeCmd.Flags().String("listen", ":8080", "Address to listen on")
+	cacheServeCmd.Flags().Bool("read-through", false, "Download artifacts which are not in the local cache from the configured remote cache")
+	cacheServeCmd.Flags().Bool("allow-upload", false, "Allow clients to upload build artifacts")
+	cacheCmd.AddCommand(cacheServeCmd)
+}
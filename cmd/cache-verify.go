@@ -0,0 +1,136 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+type cachedArtifactVerification struct {
+	Artifact string   `json:"artifact" yaml:"artifact"`
+	Package  string   `json:"package,omitempty" yaml:"package,omitempty"`
+	Problems []string `json:"problems,omitempty" yaml:"problems,omitempty"`
+	Removed  bool     `json:"removed,omitempty" yaml:"removed,omitempty"`
+}
+
+// cacheVerifyCmd represents the cache verify command
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies the integrity of the build artifacts in the local cache and removes corrupted ones",
+	Long: `Verifies the integrity of the build artifacts in the local cache.
+
+Each artifact is re-hashed and compared against the checksum recorded when it was built, and must be a readable
+tar.gz archive. Artifacts are matched against the package versions of the current application. With --provenance,
+the attestation bundles of those artifacts are cross-checked against their content as well.
+
+Corrupted artifacts are removed from the cache unless --dry-run is given, in which case the command fails if
+it found any corrupted artifacts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		application, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		versions := make(map[string]*gorpa.Package, len(application.Packages))
+		for _, pkg := range application.Packages {
+			version, err := pkg.Version()
+			if err != nil {
+				log.WithError(err).WithField("package", pkg.FullName()).Fatal("cannot compute package version")
+			}
+			versions[version] = pkg
+		}
+
+		var (
+			dryRun, _          = cmd.Flags().GetBool("dry-run")
+			checkProvenance, _ = cmd.Flags().GetBool("provenance")
+		)
+		cache, err := gorpa.NewFilesystemCache(getLocalCacheLocation())
+		if err != nil {
+			log.Fatal(err)
+		}
+		artifacts, err := cache.Artifacts()
+		if err != nil {
+			log.WithError(err).Fatal("cannot list cached artifacts")
+		}
+
+		var (
+			res     = make([]cachedArtifactVerification, 0, len(artifacts))
+			corrupt int
+		)
+		for _, fn := range artifacts {
+			pkg := versions[strings.TrimSuffix(filepath.Base(fn), ".tar.gz")]
+			problems, err := gorpa.VerifyCachedArtifact(fn, pkg, checkProvenance)
+			if err != nil {
+				log.WithError(err).WithField("artifact", fn).Fatal("cannot verify artifact")
+			}
+
+			v := cachedArtifactVerification{
+				Artifact: filepath.Base(fn),
+				Problems: problems,
+			}
+			if pkg != nil {
+				v.Package = pkg.FullName()
+			}
+			if len(problems) > 0 {
+				corrupt++
+				if !dryRun {
+					err = cache.Remove(fn)
+					if err != nil {
+						log.WithError(err).WithField("artifact", fn).Error("cannot remove corrupted artifact")
+					} else {
+						v.Removed = true
+					}
+				}
+			}
+			res = append(res, v)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `{{ range . -}}
+{{ if .Problems }}✗{{ else }}✔{{ end }}	{{ .Artifact }}	{{ if .Package }}{{ .Package }}{{ else }}(unknown package){{ end }}{{ if .Removed }}	removed{{ end }}
+{{ range .Problems }}    {{ . }}
+{{ end -}}
+{{ end }}`
+		}
+		err = w.Write(res)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write verification result")
+		}
+
+		if corrupt > 0 && dryRun {
+			log.Fatalf("found %d corrupted artifacts", corrupt)
+		}
+	},
+}
+
+func init() {
+	cacheVerifyCmd.Flags().Bool("dry-run", false, "Don't remove corrupted artifacts but fail if there are any")
+	cacheVerifyCmd.Flags().Bool("provenance", false, "Cross-check the attestation bundles of artifacts whose package is part of the application")
+	addFormatFlags(cacheVerifyCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
+}
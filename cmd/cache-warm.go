@@ -0,0 +1,79 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// cacheWarmCmd represents the cache warm command
+var cacheWarmCmd = &cobra.Command{
+	Use:   "warm [target]",
+	Short: "Downloads all available build artifacts of a package or component and its dependencies without building anything",
+	Long: `Downloads all available build artifacts of a package or component and its dependencies from the remote caches
+without building anything. Use this to prime the local cache of CI runners or new developer machines ahead of time.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		comp, pkg, _, _ := getTarget(args, false)
+
+		var (
+			pkgs        []*gorpa.Package
+			application *gorpa.Application
+		)
+		if pkg != nil {
+			pkgs = []*gorpa.Package{pkg}
+			application = pkg.C.W
+		} else if comp != nil {
+			pkgs = comp.Packages
+			application = comp.W
+		} else {
+			log.Fatal("cache warm needs a package or component")
+		}
+
+		if cm, _ := cmd.Flags().GetString("cache"); cm != string(gorpa.CacheRemote) && cm != string(gorpa.CacheRemotePull) {
+			log.Fatalf("cache warm needs to download from the remote cache - cannot use cache level %s", cm)
+		}
+		opts, _ := getBuildOpts(cmd, application)
+
+		available, missing, err := gorpa.Warm(pkgs, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sort.Slice(missing, func(i, j int) bool { return missing[i].FullName() < missing[j].FullName() })
+		for _, p := range missing {
+			log.WithField("package", p.FullName()).Debug("not available in remote cache")
+		}
+		fmt.Printf("\n🔥  %s of %d artifacts available in the local cache, %d would have to be built\n", color.Green.Render(len(available)), len(available)+len(missing), len(missing))
+	},
+}
+
+func init() {
+	addBuildFlags(cacheWarmCmd)
+	cacheCmd.AddCommand(cacheWarmCmd)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+type changedPackageDescription struct {
+	Name string `json:"name" yaml:"name"`
+	// Reason is "changed" if the package's sources or definition changed, or "dependent" if it depends on such a package
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// changedCmd represents the changed command
+var changedCmd = &cobra.Command{
+	Use:   "changed",
+	Short: "Lists the packages affected by the changes since a Git revision",
+	Long: `Lists the packages affected by the files which changed since a Git revision, and the packages which depend on them.
+A package is changed if one of its sources (including deleted ones which match its source globs) or the BUILD.yaml of its
+component changed. A changed APPLICATION.yaml affects all packages. Unless --since is a range (e.g. main..HEAD),
+uncommitted and untracked files count as changed, too.
+
+Example use:
+  # build everything affected by a branch
+  gorpa build $(gorpa changed --since origin/main -t '{{ range . }}{{ .Name }} {{ end }}')`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			since, _  = cmd.Flags().GetString("since")
+			direct, _ = cmd.Flags().GetBool("direct")
+		)
+
+		ba, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		changed, dependents, err := ba.AffectedSince(since)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if direct {
+			dependents = nil
+		}
+
+		decs := make([]changedPackageDescription, 0, len(changed)+len(dependents))
+		for _, p := range changed {
+			decs = append(decs, changedPackageDescription{Name: p.FullName(), Reason: "changed"})
+		}
+		for _, p := range dependents {
+			decs = append(decs, changedPackageDescription{Name: p.FullName(), Reason: "dependent"})
+		}
+		if len(decs) == 0 {
+			log.WithField("since", since).Info("no packages changed")
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `{{ range . }}{{ .Name }}{{"\t"}}{{ .Reason }}{{"\n"}}{{ end }}`
+		}
+		err = w.Write(decs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(changedCmd)
+	changedCmd.Flags().String("since", "HEAD", "Git revision or range to compare against")
+	changedCmd.Flags().Bool("direct", false, "List only the changed packages, not the packages which depend on them")
+
+	addFormatFlags(changedCmd)
+}
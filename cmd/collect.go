@@ -21,22 +21,54 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
 
 	gorpa "github.com/bhojpur/gorpa/pkg/engine"
 	"github.com/bhojpur/gorpa/pkg/prettyprint"
 )
 
 type fileDescription struct {
-	Name    string `json:"name" yaml:"name"`
-	Version string `json:"version" yaml:"version"`
-	Package string `json:"package" yaml:"package"`
+	Name      string `json:"name" yaml:"name"`
+	Version   string `json:"version" yaml:"version"`
+	Package   string `json:"package" yaml:"package"`
+	Size      int64  `json:"size,omitempty" yaml:"size,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+}
+
+// fileManifest is the canonical manifest written by collect files --output-manifest
+type fileManifest struct {
+	Version   int                 `json:"version"`
+	Algorithm string              `json:"algorithm"`
+	Files     []fileManifestEntry `json:"files"`
 }
 
+type fileManifestEntry struct {
+	Path     string   `json:"path"`
+	Digest   string   `json:"digest"`
+	Size     int64    `json:"size"`
+	Packages []string `json:"packages"`
+}
+
+const (
+	fileHashHighwayhash = "highwayhash"
+	fileHashSHA256      = "sha256"
+	fileHashSHA512      = "sha512"
+)
+
 type variantDescription struct {
 	Name    string `json:"name" yaml:"name"`
 	Sources struct {
@@ -49,9 +81,13 @@ type variantDescription struct {
 
 // collectCmd represents the collect command
 var collectCmd = &cobra.Command{
-	Use:   "collect [components|packages|scripts|files]",
+	Use:   "collect [components|packages|scripts|files] [targets...]",
 	Short: "Collects all packages in an application",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Collects all packages in an application.
+Target patterns (see "gorpa build --help") restrict the packages and files to the selected packages,
+and the components and scripts to the components of the selected packages, e.g.
+  gorpa collect files '//components/...[go]'`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		application, err := getApplication()
 		if err != nil {
@@ -85,6 +121,31 @@ var collectCmd = &cobra.Command{
 			log.Fatal("selector must either be a constant name or const=value")
 		}
 
+		pkgSelector := func(p *gorpa.Package) bool { return selector(p.C) }
+		if len(args) > 1 {
+			targets, err := selectTargets(application, args[1:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			var (
+				pkgIdx        = make(map[*gorpa.Package]struct{}, len(targets))
+				compIdx       = make(map[string]struct{}, len(targets))
+				constSelector = selector
+			)
+			for _, p := range targets {
+				pkgIdx[p] = struct{}{}
+				compIdx[p.C.Name] = struct{}{}
+			}
+			selector = func(c *gorpa.Component) bool {
+				_, ok := compIdx[c.Name]
+				return ok && constSelector(c)
+			}
+			pkgSelector = func(p *gorpa.Package) bool {
+				_, ok := pkgIdx[p]
+				return ok && constSelector(p.C)
+			}
+		}
+
 		w := getWriterFromFlags(cmd)
 		switch tpe {
 		case "components":
@@ -109,7 +170,7 @@ var collectCmd = &cobra.Command{
 			}
 			decs := make([]packageDescription, 0, len(application.Packages))
 			for _, pkg := range application.Packages {
-				if !selector(pkg.C) {
+				if !pkgSelector(pkg) {
 					continue
 				}
 
@@ -138,29 +199,39 @@ var collectCmd = &cobra.Command{
 				log.Fatal(err)
 			}
 		case "files":
-			if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
-				w.FormatString = `{{ range . }}{{ .Name }}{{"\t"}}{{ .Version }}{{"\n"}}{{ end }}`
+			var (
+				withSize, _    = cmd.Flags().GetBool("size")
+				withPackage, _ = cmd.Flags().GetBool("package")
+				algo, _        = cmd.Flags().GetString("hash")
+				manifestFn, _  = cmd.Flags().GetString("output-manifest")
+			)
+			if manifestFn != "" && !cmd.Flags().Changed("hash") {
+				// external tooling expects well-known digests
+				algo = fileHashSHA256
 			}
-			decs := make([]fileDescription, 0, len(application.Packages))
-			for _, pkg := range application.Packages {
-				if !selector(pkg.C) {
-					continue
-				}
 
-				pkgn := pkg.FullName()
-				mf, err := pkg.ContentManifest()
+			decs, err := collectFiles(&application, pkgSelector, algo)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if manifestFn != "" {
+				err = writeFileManifest(manifestFn, algo, decs)
 				if err != nil {
 					log.Fatal(err)
 				}
-				fs := make([]fileDescription, len(mf))
-				for i, f := range mf {
-					segs := strings.Split(f, ":")
-					fs[i] = fileDescription{Name: segs[0], Version: segs[1], Package: pkgn}
-				}
+				return
+			}
 
-				decs = append(decs, fs...)
+			if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+				w.FormatString = `{{ range . }}{{ .Name }}{{"\t"}}{{ .Version }}`
+				if withSize {
+					w.FormatString += `{{"\t"}}{{ .Size }}`
+				}
+				if withPackage {
+					w.FormatString += `{{"\t"}}{{ .Package }}`
+				}
+				w.FormatString += `{{"\n"}}{{ end }}`
 			}
-			sort.Slice(decs, func(i, j int) bool { return decs[i].Name < decs[j].Name })
 			err = w.Write(decs)
 			if err != nil {
 				log.Fatal(err)
@@ -178,7 +249,7 @@ var collectCmd = &cobra.Command{
 				}
 				decs[i].Sources.Exclude = v.Sources.Exclude
 				decs[i].Sources.Include = v.Sources.Include
-				for _, t := range []gorpa.PackageType{gorpa.DockerPackage, gorpa.GenericPackage, gorpa.GoPackage, gorpa.YarnPackage} {
+				for _, t := range []gorpa.PackageType{gorpa.DockerPackage, gorpa.GenericPackage, gorpa.GoPackage, gorpa.YarnPackage, gorpa.ProtoPackage, gorpa.PluginPackage, gorpa.MetaPackage} {
 					vntcfg, ok := v.Config(t)
 					if !ok {
 						continue
@@ -196,7 +267,118 @@ var collectCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(collectCmd)
+	collectCmd.Flags().Bool("size", false, "Prints the size of each file (files only)")
+	collectCmd.Flags().Bool("package", false, "Prints the package which owns each file (files only)")
+	collectCmd.Flags().String("hash", fileHashHighwayhash, "Hash algorithm used for the file digests: highwayhash (as used for package versions), sha256 or sha512 (files only)")
+	collectCmd.Flags().String("output-manifest", "", "Writes a canonical JSON manifest of all files, their digests, sizes and owning packages to this file, \"-\" for stdout. Uses sha256 unless --hash is set (files only)")
 	collectCmd.Flags().StringP("select", "l", "", "Filters packages by component constants (e.g. `-l foo` finds all packages whose components have a foo constant and `-l foo=bar` only prints packages whose components have a foo=bar constant)")
 
 	addFormatFlags(collectCmd)
 }
+
+// collectFiles lists all source files of the selected packages. Files which belong to multiple packages are listed once per package.
+func collectFiles(application *gorpa.Application, selector func(p *gorpa.Package) bool, algo string) ([]fileDescription, error) {
+	var newHash func() hash.Hash
+	switch algo {
+	case fileHashHighwayhash:
+		// the digests come from the content manifest, which uses the content hash of the application
+		if application.ContentHash.Algorithm != "" {
+			algo = string(application.ContentHash.Algorithm)
+		}
+	case fileHashSHA256:
+		newHash = sha256.New
+	case fileHashSHA512:
+		newHash = sha512.New
+	default:
+		return nil, xerrors.Errorf("unsupported hash algorithm: %s", algo)
+	}
+
+	var (
+		decs  = make([]fileDescription, 0, len(application.Packages))
+		known = make(map[string]fileDescription)
+	)
+	for _, pkg := range application.Packages {
+		if !selector(pkg) {
+			continue
+		}
+
+		pkgn := pkg.FullName()
+		mf, err := pkg.ContentManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range mf {
+			segs := strings.Split(f, ":")
+			name, digest := segs[0], segs[1]
+
+			desc, ok := known[name]
+			if !ok {
+				fn := filepath.Join(application.Origin, name)
+				stat, err := os.Stat(fn)
+				if err != nil {
+					return nil, err
+				}
+				if newHash != nil {
+					digest, err = hashFile(fn, newHash())
+					if err != nil {
+						return nil, err
+					}
+				}
+				desc = fileDescription{Name: name, Version: digest, Size: stat.Size(), Algorithm: algo}
+				known[name] = desc
+			}
+			desc.Package = pkgn
+			decs = append(decs, desc)
+		}
+	}
+	sort.Slice(decs, func(i, j int) bool {
+		if decs[i].Name == decs[j].Name {
+			return decs[i].Package < decs[j].Package
+		}
+		return decs[i].Name < decs[j].Name
+	})
+	return decs, nil
+}
+
+func hashFile(fn string, h hash.Hash) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFileManifest writes the files as canonical manifest, i.e. one entry per file, sorted by path, with sorted package lists
+func writeFileManifest(fn, algo string, files []fileDescription) error {
+	mf := fileManifest{Version: 1, Algorithm: algo, Files: []fileManifestEntry{}}
+	for _, f := range files {
+		if n := len(mf.Files); n > 0 && mf.Files[n-1].Path == f.Name {
+			mf.Files[n-1].Packages = append(mf.Files[n-1].Packages, f.Package)
+			continue
+		}
+		mf.Files = append(mf.Files, fileManifestEntry{
+			Path:     f.Name,
+			Digest:   f.Version,
+			Size:     f.Size,
+			Packages: []string{f.Package},
+		})
+	}
+
+	fc, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return err
+	}
+	fc = append(fc, '\n')
+
+	if fn == "-" {
+		_, err = os.Stdout.Write(fc)
+		return err
+	}
+	return ioutil.WriteFile(fn, fc, 0644)
+}
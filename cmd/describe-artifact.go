@@ -0,0 +1,73 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// describeArtifactCmd represents the describe artifact command
+var describeArtifactCmd = &cobra.Command{
+	Use:   "artifact <artifact|package>",
+	Short: "Summarizes the content of a build artifact",
+	Long: `Summarizes the content of a build artifact without extracting it: its compressed and uncompressed
+size, the number of files, the size of the top-level entries and whether it contains build info, provenance
+and an SBOM.
+
+The artifact can either be given as path to a build artifact (.tar.gz), or as package name in which
+case the artifact of the current package version is looked up in the local cache.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fn := getArtifactLocation(args, "artifact")
+
+		summary, err := gorpa.SummarizeArtifact(fn)
+		if err != nil {
+			log.WithField("artifact", fn).Fatal(err)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `artifact:	{{ .Artifact }}
+size:	{{ .CompressedSize }} compressed, {{ .UncompressedSize }} uncompressed ({{ printf "%.1f" .CompressionRatio }}x)
+files:	{{ .Files }}
+build info:	{{ if .BuildInfo }}yes{{ else }}no{{ end }}
+provenance:	{{ if .Provenance }}yes{{ else }}no{{ end }}
+sbom:	{{ if .SBOM }}yes{{ else }}no{{ end }}
+entries:
+{{- range .Entries }}
+  {{ .Name }}{{ if .Dir }}/{{ end }}	{{ .Size }}	{{ .Files }} files
+{{- end }}
+`
+		}
+		err = w.Write(summary)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write artifact summary")
+		}
+	},
+}
+
+func init() {
+	describeCmd.AddCommand(describeArtifactCmd)
+	addFormatFlags(describeArtifactCmd)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// describeBuildInfoCmd represents the describe buildinfo command
+var describeBuildInfoCmd = &cobra.Command{
+	Use:   "buildinfo <artifact|package>",
+	Short: "Prints the build info contained in a build artifact",
+	Long: `Prints the build info contained in a build artifact.
+
+The artifact can either be given as path to a build artifact (.tar.gz), or as package name in which
+case the artifact of the current package version is looked up in the local cache.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fn := getArtifactLocation(args, "buildinfo")
+		nfo, err := gorpa.ReadBuildInfoFromCachedArchive(fn)
+		if errors.Is(err, gorpa.ErrNoBuildInfo) {
+			log.WithField("artifact", fn).Fatal("artifact contains no build info - was it built with an older version of Bhojpur GoRPA?")
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `package:	{{ .Package }}
+type:	{{ .Type }}
+version:	{{ .Version }}
+git commit:	{{ .GitCommit }}{{ if .GitDirty }} (dirty){{ end }}
+{{- if .Variant }}
+variant:	{{ .Variant }}
+{{- end }}
+{{- if .BuildTime }}
+build time:	{{ .BuildTime }}
+{{- end }}
+gorpa version:	{{ .GorpaVersion }}
+`
+		}
+		err = w.Write(nfo)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write build info")
+		}
+	},
+}
+
+// getArtifactLocation returns the build artifact args[0] refers to, either as path to an artifact or as package name
+// in which case the artifact of the current package version is looked up in the local cache.
+func getArtifactLocation(args []string, cmdName string) string {
+	fn := args[0]
+	if _, err := os.Stat(fn); err == nil {
+		return fn
+	}
+
+	_, pkg, _, _ := getTarget(args, false)
+	if pkg == nil {
+		log.Fatalf("%s needs an artifact or package", cmdName)
+	}
+
+	cache, err := gorpa.NewFilesystemCache(getLocalCacheLocation())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fn, exists := cache.Location(pkg)
+	if !exists {
+		log.WithField("package", pkg.FullName()).Fatal("package is not built yet - build it first")
+	}
+	return fn
+}
+
+func init() {
+	describeCmd.AddCommand(describeBuildInfoCmd)
+	addFormatFlags(describeBuildInfoCmd)
+}
@@ -64,13 +64,33 @@ var describeDependenciesCmd = &cobra.Command{
 			}
 		}
 
+		var trust gorpa.Cache
+		if prov, _ := cmd.Flags().GetBool("provenance"); prov {
+			cache, err := gorpa.NewFilesystemCache(getLocalCacheLocation())
+			if err != nil {
+				log.Fatal(err)
+			}
+			trust = cache
+		}
+
+		baseline, _ := cmd.Flags().GetString("baseline")
+		if baseline != "" && trust != nil {
+			log.Fatal("--baseline and --provenance are mutually exclusive")
+		}
 		if dot, _ := cmd.Flags().GetBool("dot"); dot {
-			return printDepGraphAsDot(pkgs)
+			return printDepGraphAsDot(pkgs, trust)
+		} else if snapshot, _ := cmd.Flags().GetString("snapshot"); snapshot != "" {
+			return writeDepGraphSnapshot(snapshot, pkgs, trust)
 		} else if serve, _ := cmd.Flags().GetString("serve"); serve != "" {
-			serveDepGraph(serve, pkgs)
+			serveDepGraph(serve, baseline, pkgs, trust)
+		} else if baseline != "" {
+			log.Fatal("--baseline requires --serve")
 		} else {
 			for _, pkg := range pkgs {
-				printDepTree(pkg, 0)
+				err := printDepTree(pkg, 0, trust)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -78,7 +98,7 @@ var describeDependenciesCmd = &cobra.Command{
 	},
 }
 
-func printDepTree(pkg *gorpa.Package, indent int) {
+func printDepTree(pkg *gorpa.Package, indent int, trust gorpa.Cache) error {
 	var tpe string
 	switch pkg.Type {
 	case gorpa.DockerPackage:
@@ -89,15 +109,73 @@ func printDepTree(pkg *gorpa.Package, indent int) {
 		tpe = "go"
 	case gorpa.YarnPackage:
 		tpe = "yarn"
+	case gorpa.ProtoPackage:
+		tpe = "proto"
+	case gorpa.PluginPackage:
+		tpe = "plugin"
+	case gorpa.MetaPackage:
+		tpe = "meta"
 	}
 
-	fmt.Printf("%*s%s %s\n", indent, "", color.Gray.Sprintf("[%7s]", tpe), pkg.FullName())
+	var annotation string
+	if trust != nil {
+		t, err := graphview.ReadTrust(trust, pkg)
+		if err != nil {
+			return err
+		}
+		annotation = " " + color.Gray.Sprint(describeTrust(t))
+	}
+
+	fmt.Printf("%*s%s %s%s\n", indent, "", color.Gray.Sprintf("[%7s]", tpe), pkg.FullName(), annotation)
 	for _, p := range pkg.GetDependencies() {
-		printDepTree(p, indent+4)
+		err := printDepTree(p, indent+4, trust)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeTrust summarises the trust information of an artifact in a single line
+func describeTrust(t *graphview.Trust) string {
+	var res string
+	switch t.Origin {
+	case "":
+		return "not cached"
+	case gorpa.ArtifactDownloaded:
+		res = "from " + t.RemoteCache
+	case gorpa.ArtifactBuilt:
+		res = "built locally"
+	default:
+		res = "unknown origin"
+	}
+	if t.Builder == "" {
+		return res + ", no provenance"
+	}
+	res += ", built by " + t.Builder
+	if t.Signed {
+		res += " (signed)"
+	} else {
+		res += " (unsigned)"
 	}
+	return res
 }
 
-func printDepGraphAsDot(pkgs []*gorpa.Package) error {
+// trustColor is the Graphviz fill color of a node with this trust information
+func trustColor(t *graphview.Trust) string {
+	switch t.Origin {
+	case gorpa.ArtifactBuilt:
+		return "lightblue"
+	case gorpa.ArtifactDownloaded:
+		return "plum"
+	case gorpa.ArtifactUnknown:
+		return "lightgray"
+	default:
+		return "white"
+	}
+}
+
+func printDepGraphAsDot(pkgs []*gorpa.Package, trust gorpa.Cache) error {
 	var (
 		nodes = make(map[string]string)
 		edges []string
@@ -113,7 +191,15 @@ func printDepGraphAsDot(pkgs []*gorpa.Package) error {
 			if _, exists := nodes[ver]; exists {
 				continue
 			}
-			nodes[ver] = fmt.Sprintf("p%s [label=\"%s\"];", ver, p.FullName())
+			if trust == nil {
+				nodes[ver] = fmt.Sprintf("p%s [label=\"%s\"];", ver, p.FullName())
+				continue
+			}
+			t, err := graphview.ReadTrust(trust, p)
+			if err != nil {
+				return err
+			}
+			nodes[ver] = fmt.Sprintf("p%s [label=\"%s\\n%s\", style=filled, fillcolor=%s];", ver, p.FullName(), describeTrust(t), trustColor(t))
 		}
 		for _, p := range allpkg {
 			ver, err := p.Version()
@@ -142,7 +228,43 @@ func printDepGraphAsDot(pkgs []*gorpa.Package) error {
 	return nil
 }
 
-func serveDepGraph(addr string, pkgs []*gorpa.Package) {
+func writeDepGraphSnapshot(fn string, pkgs []*gorpa.Package, trust gorpa.Cache) error {
+	g, err := graphview.NewGraph(pkgs...)
+	if err != nil {
+		return err
+	}
+	if trust != nil {
+		err = g.AddTrust(trust, pkgs...)
+		if err != nil {
+			return err
+		}
+	}
+	if fn == "-" {
+		return g.WriteSnapshot(os.Stdout)
+	}
+
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.WriteSnapshot(f)
+}
+
+func serveDepGraph(addr, baselineFN string, pkgs []*gorpa.Package, trust gorpa.Cache) {
+	var baseline *graphview.Graph
+	if baselineFN != "" {
+		f, err := os.Open(baselineFN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		baseline, err = graphview.ReadSnapshot(f)
+		f.Close()
+		if err != nil {
+			log.WithError(err).Fatalf("cannot read dependency graph snapshot %s", baselineFN)
+		}
+	}
+
 	go func() {
 		browser := os.Getenv("BROWSER")
 		if browser == "" {
@@ -159,6 +281,14 @@ func serveDepGraph(addr string, pkgs []*gorpa.Package) {
 		exec.Command(browser, taddr).Start()
 	}()
 
+	if baseline != nil {
+		log.Infof("serving dependency graph diff against %s on %s", baselineFN, addr)
+		log.Fatal(graphview.ServeDiff(addr, baseline, pkgs...))
+	}
+	if trust != nil {
+		log.Infof("serving dependency graph with artifact provenance on %s", addr)
+		log.Fatal(graphview.ServeTrust(addr, trust, pkgs...))
+	}
 	log.Infof("serving dependency graph on %s", addr)
 	log.Fatal(graphview.Serve(addr, pkgs...))
 }
@@ -168,4 +298,7 @@ func init() {
 
 	describeDependenciesCmd.Flags().Bool("dot", false, "produce Graphviz dot output")
 	describeDependenciesCmd.Flags().String("serve", "", "serve the interactive dependency graph on this address")
+	describeDependenciesCmd.Flags().String("snapshot", "", "write the dependency graph as JSON snapshot to this file (\"-\" for stdout)")
+	describeDependenciesCmd.Flags().String("baseline", "", "highlight the differences to this dependency graph snapshot in the interactive dependency graph")
+	describeDependenciesCmd.Flags().Bool("provenance", false, "show which artifacts in the local cache were built locally or came from a remote cache, and who built them")
 }
@@ -0,0 +1,86 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+type pluginDescription struct {
+	Name       string          `json:"name" yaml:"name"`
+	Command    []string        `json:"command" yaml:"command"`
+	Executable string          `json:"executable,omitempty" yaml:"executable,omitempty"`
+	Address    string          `json:"address,omitempty" yaml:"address,omitempty"`
+	Schema     json.RawMessage `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// describePluginsCmd represents the describePlugins command
+var describePluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "Prints the package plugins registered in the Application and the config schema they report",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ba, err := getApplication()
+		if err != nil {
+			log.WithError(err).Fatal("cannot load Application")
+		}
+
+		res := make([]pluginDescription, 0, len(ba.Plugins))
+		for name, plugin := range ba.Plugins {
+			resp, err := plugin.Invoke(gorpa.PluginPhaseSchema, gorpa.PluginRequest{}, ba.Origin)
+			if err != nil {
+				log.WithError(err).Fatal("cannot get plugin schema")
+			}
+			res = append(res, pluginDescription{
+				Name:       name,
+				Command:    plugin.Command,
+				Executable: plugin.Executable(),
+				Address:    plugin.Address,
+				Schema:     resp.Schema,
+			})
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `{{- range . -}}
+{{ .Name }}:	{{ if .Address }}{{ .Address }}{{ else }}{{ .Executable }}{{ end }}
+{{ if .Schema }}{{ printf "%s" .Schema }}
+{{ end }}
+{{ end -}}`
+		}
+		err = w.Write(res)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write plugins")
+		}
+	},
+}
+
+func init() {
+	describeCmd.AddCommand(describePluginsCmd)
+	addFormatFlags(describePluginsCmd)
+}
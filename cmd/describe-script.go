@@ -48,6 +48,16 @@ Workdir Layout:{{"\t"}}{{ .WorkdirLayout }}
 Dependencies:
 {{- range $k, $v := .Dependencies }}
 {{"\t"}}{{ $v.FullName -}}{{"\t"}}{{ $v.Version -}}
+{{ end }}
+Layout:
+{{- range $k, $v := .Layout }}
+{{"\t"}}{{ $k -}}{{"\t"}}{{ $v -}}
+{{ end -}}
+{{ end -}}
+{{ if .Outputs -}}
+Outputs:
+{{- range .Outputs }}
+{{"\t"}}{{ . -}}
 {{ end -}}
 {{ end }}
 `
@@ -0,0 +1,144 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+// describeVersionCmd represents the describe version command
+var describeVersionCmd = &cobra.Command{
+	Use:   "version [package]",
+	Short: "Explains the version of a package by listing the inputs it is computed from",
+	Long: `Explains the version of a package by listing the inputs it is computed from: the build settings, the environment
+manifest, the hash of the package definition, the argument dependencies, the base images, the versions of the
+dependencies and the hashes of the sources.
+
+Save a report with --save and compare against it with --diff later to find out why a package was rebuilt:
+  gorpa describe version some/component:package --save version.json
+  # ... pull some changes ...
+  gorpa describe version some/component:package --diff version.json
+If a dependency changed, --diff lists the changes which led to its new version, too.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("version needs a package")
+		}
+		report, err := pkg.ExplainVersion()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fn, _ := cmd.Flags().GetString("save"); fn != "" {
+			err = saveVersionReport(fn, report)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		w := getWriterFromFlags(cmd)
+		if fn, _ := cmd.Flags().GetString("diff"); fn != "" {
+			prev, err := loadVersionReport(fn)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if prev.Package != report.Package {
+				log.WithField("report", prev.Package).Fatal("version report is of another package")
+			}
+			if prev.Version == report.Version {
+				log.WithField("version", report.Version).Info("version did not change")
+				return
+			}
+
+			if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+				w.FormatString = `{{ range . }}{{ .Package }}{{"\t"}}{{ if not .Old }}added{{ else if not .New }}removed{{ else }}changed{{ end }} {{ .Input }}{{"\t"}}{{ .Name }}{{"\t"}}{{ .Old }}{{"\t"}}{{ .New }}{{"\n"}}{{ end }}`
+			}
+			err = w.Write(report.Changes(prev))
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `Package:{{"\t"}}{{ .Package }}
+Version:{{"\t"}}{{ .Version }}
+Definition:{{"\t"}}{{ .Definition }}
+{{ range $k, $v := .Settings }}setting{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}{{ range $k, $v := .Environment }}environment{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}{{ range $k, $v := .Arguments }}argument{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}{{ range $k, $v := .BaseImages }}baseImage{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}{{ range $k, $v := .Dependencies }}dependency{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}{{ range $k, $v := .Sources }}source{{"\t"}}{{ $k }}{{"\t"}}{{ $v }}
+{{ end }}`
+		}
+		err = w.Write(report)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func saveVersionReport(fn string, report *gorpa.VersionReport) error {
+	out := os.Stdout
+	if fn != "-" {
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func loadVersionReport(fn string) (*gorpa.VersionReport, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res gorpa.VersionReport
+	err = json.NewDecoder(f).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func init() {
+	describeCmd.AddCommand(describeVersionCmd)
+	describeVersionCmd.Flags().String("save", "", "Write the version report as JSON to this file (\"-\" for stdout)")
+	describeVersionCmd.Flags().String("diff", "", "List the inputs which changed since this saved version report")
+	addFormatFlags(describeVersionCmd)
+}
@@ -152,6 +152,15 @@ func absPackageName(application gorpa.Application, name string) string {
 	return name
 }
 
+// selectTargets resolves target patterns (see gorpa.Application.SelectPackages) relative to the working directory
+func selectTargets(application gorpa.Application, patterns []string) ([]*gorpa.Package, error) {
+	abs := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		abs = append(abs, absPackageName(application, p))
+	}
+	return application.SelectPackages(abs)
+}
+
 type packageMetadataDescription struct {
 	Name      string `json:"name" yaml:"name"`
 	FullName  string `json:"fullName" yaml:"fullName"`
@@ -233,11 +242,31 @@ func newConfigDescription(tpe gorpa.PackageType, c gorpa.PackageConfig) configDe
 		cfg["dockerfile"] = c.Dockerfile
 		cfg["image"] = c.Image
 		cfg["squash"] = c.Squash
+		cfg["fetch"] = c.Fetch
+		cfg["platforms"] = c.Platforms
+		cfg["secrets"] = c.Secrets
+		cfg["ssh"] = c.SSH
 	case gorpa.GenericPackage:
 		c := c.(gorpa.GenericPkgConfig)
 		cfg["commands"] = c.Commands
 		cfg["test"] = c.Test
 		cfg["dontTest"] = c.DontTest
+		cfg["fetch"] = c.Fetch
+		cfg["outputs"] = c.Outputs
+	case gorpa.ProtoPackage:
+		c := c.(gorpa.ProtoPkgConfig)
+		cfg["generator"] = c.Generator
+		cfg["output"] = c.Output
+		cfg["plugins"] = c.Plugins
+		cfg["includePaths"] = c.IncludePaths
+		cfg["bufConfig"] = c.BufConfig
+		cfg["bufTemplate"] = c.BufTemplate
+	case gorpa.PluginPackage:
+		c := c.(gorpa.PluginPkgConfig)
+		for k, v := range c.Settings {
+			cfg[k] = v
+		}
+		cfg["plugin"] = c.Plugin
 	case gorpa.GoPackage:
 		c := c.(gorpa.GoPkgConfig)
 		cfg["buildFlags"] = c.BuildFlags
@@ -253,6 +282,10 @@ func newConfigDescription(tpe gorpa.PackageType, c gorpa.PackageConfig) configDe
 		cfg["packaging"] = c.Packaging
 		cfg["tsConfig"] = c.TSConfig
 		cfg["yarnLock"] = c.YarnLock
+		if c.IsNpm() {
+			cfg["packageManager"] = c.PackageManager
+			cfg["packageLock"] = c.PackageLock
+		}
 		cfg["commands"] = map[string][]string{
 			"build":   c.Commands.Build,
 			"install": c.Commands.Install,
@@ -358,13 +391,19 @@ type scriptDescription struct {
 	Env             []string                     `json:"env,omitempty" yaml:"env,omitempty"`
 	Dependencies    []packageMetadataDescription `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
 	WorkdirLayout   string                       `json:"workdirLayout" yaml:"workdirLayout"`
+	Layout          map[string]string            `json:"layout,omitempty" yaml:"layout,omitempty"`
+	Outputs         []string                     `json:"outputs,omitempty" yaml:"outputs,omitempty"`
 	Type            string                       `json:"type" yaml:"type"`
 }
 
 func newScriptDescription(s *gorpa.Script) scriptDescription {
-	deps := make([]packageMetadataDescription, len(s.Dependencies))
+	var (
+		deps   = make([]packageMetadataDescription, len(s.Dependencies))
+		layout = make(map[string]string, len(s.Dependencies))
+	)
 	for i, d := range s.GetDependencies() {
 		deps[i] = newMetadataDescription(d)
+		layout[d.FullName()] = s.LayoutLocation(d)
 	}
 
 	desc := strings.ReplaceAll(s.Description, "\n", " ")
@@ -380,6 +419,8 @@ func newScriptDescription(s *gorpa.Script) scriptDescription {
 		Dependencies:    deps,
 		Env:             s.Environment,
 		WorkdirLayout:   string(s.WorkdirLayout),
+		Layout:          layout,
+		Outputs:         s.Outputs,
 		Type:            string(s.Type),
 	}
 }
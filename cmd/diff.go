@@ -0,0 +1,106 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <revision> [revision]",
+	Short: "Lists the packages whose version differs between two Git revisions",
+	Long: `Lists the packages which were added, removed or changed their version between two Git revisions, and why.
+Both revisions are checked out in temporary Git worktrees. Without a second revision, the first one is compared
+with the working copy.
+
+A changed package lists the inputs of its version which differ (see "gorpa describe version"). Packages which only
+changed because of their dependencies are marked as such, which tells the packages which actually changed from
+those which merely need to be rebuilt.
+
+Example use:
+  # what changed since the last release?
+  gorpa diff v1.2.0 HEAD
+  # which packages does a release need to deploy?
+  gorpa diff v1.2.0 v1.3.0 -t '{{ range . }}{{ if ne .Status "removed" }}{{ .Package }}{{"\n"}}{{ end }}{{ end }}'`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		prev, cleanup, err := loadApplicationAt(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cleanup()
+		var cur gorpa.Application
+		if len(args) > 1 {
+			cur, cleanup, err = loadApplicationAt(args[1])
+			if err == nil {
+				defer cleanup()
+			}
+		} else {
+			cur, err = getApplication()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diff, err := gorpa.DiffApplications(&prev, &cur)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(diff) == 0 {
+			log.Info("no package changed its version")
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `{{ range . }}{{ .Package }}{{"\t"}}{{ .Status }}{{"\t"}}` +
+				`{{ if .DependenciesOnly }}dependencies only{{ else }}{{ range $i, $c := .Changes }}{{ if $i }}, {{ end }}{{ $c.Input }}{{ if $c.Name }} {{ $c.Name }}{{ end }}{{ end }}{{ end }}{{"\n"}}{{ end }}`
+		}
+		err = w.Write(diff)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// loadApplicationAt loads the application as of a Git revision from a temporary worktree. The returned function
+// removes the worktree, which the application needs until all versions are computed.
+func loadApplicationAt(rev string) (ba gorpa.Application, cleanup func(), err error) {
+	root, _, cleanup, err := checkoutWorktree(rev)
+	if err != nil {
+		return gorpa.Application{}, nil, err
+	}
+	ba, err = loadApplication(root)
+	if err != nil {
+		cleanup()
+		return gorpa.Application{}, nil, err
+	}
+	return ba, cleanup, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	addFormatFlags(diffCmd)
+}
@@ -0,0 +1,213 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+type dependencyDocs struct {
+	Package      dependencyDoc   `json:"package" yaml:"package"`
+	Direct       []dependencyDoc `json:"direct" yaml:"direct"`
+	Transitive   []dependencyDoc `json:"transitive" yaml:"transitive"`
+	Licenses     []licenseCount  `json:"licenses" yaml:"licenses"`
+	UnknownCount int             `json:"unknownLicenses" yaml:"unknownLicenses"`
+}
+
+type dependencyDoc struct {
+	Name          string         `json:"name" yaml:"name"`
+	Type          string         `json:"type" yaml:"type"`
+	Version       string         `json:"version" yaml:"version"`
+	Component     string         `json:"component" yaml:"component"`
+	ComponentLink string         `json:"componentLink" yaml:"componentLink"`
+	License       *gorpa.License `json:"license,omitempty" yaml:"license,omitempty"`
+}
+
+type licenseCount struct {
+	License  string   `json:"license" yaml:"license"`
+	Packages []string `json:"packages" yaml:"packages"`
+}
+
+// docsDepsCmd represents the docs deps command
+var docsDepsCmd = &cobra.Command{
+	Use:   "deps [package]",
+	Short: "Produces a markdown document listing the dependencies of a package with their versions and licenses",
+	Long: `Produces a markdown document listing the direct and transitive dependencies of a package, with their
+versions, licenses and links to their component directories.
+
+Yarn packages take their license from their package.json. All other packages use the nearest license
+file (LICENSE, COPYING, ...) in their component directory or one of its parents within the application,
+which is identified by its text. Dependencies whose license could not be determined are listed as unknown.
+
+Component links are relative to the application root, unless --link-prefix is given (e.g. the URL of the
+repository tree on a Git hosting service).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("docs deps needs a package")
+		}
+		linkPrefix, _ := cmd.Flags().GetString("link-prefix")
+
+		docs, err := newDependencyDocs(pkg, linkPrefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `# Dependencies of {{ .Package.Name }}
+
+| | |
+|---|---|
+| Package | [{{ .Package.Name }}]({{ .Package.ComponentLink }}) |
+| Type | {{ .Package.Type }} |
+| Version | ` + "`{{ .Package.Version }}`" + ` |
+| License | {{ with .Package.License }}{{ if .ID }}{{ .ID }}{{ else }}unknown{{ end }}{{ else }}unknown{{ end }} |
+
+{{ define "deps" -}}
+| Package | Type | Version | License | Component |
+|---|---|---|---|---|
+{{ range . -}}
+| {{ .Name }} | {{ .Type }} | ` + "`{{ .Version }}`" + ` | {{ with .License }}{{ if .ID }}{{ .ID }}{{ else }}unknown{{ end }}{{ else }}unknown{{ end }} | [{{ .Component }}]({{ .ComponentLink }}) |
+{{ end -}}
+{{ end -}}
+
+## Direct dependencies
+
+{{ if .Direct }}{{ template "deps" .Direct }}{{ else }}This package has no dependencies.
+{{ end }}
+## Transitive dependencies
+
+{{ if .Transitive }}{{ template "deps" .Transitive }}{{ else }}This package has no transitive dependencies besides its direct ones.
+{{ end }}
+## Licenses
+
+| License | Packages |
+|---|---|
+{{ range .Licenses -}}
+| {{ .License }} | {{ len .Packages }} |
+{{ end -}}
+{{ if .UnknownCount }}
+**{{ .UnknownCount }} dependencies have an unknown license and need to be reviewed manually.**
+{{ end -}}
+`
+		}
+		err = w.Write(docs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func newDependencyDocs(pkg *gorpa.Package, linkPrefix string) (*dependencyDocs, error) {
+	newDoc := func(p *gorpa.Package) (dependencyDoc, error) {
+		version, err := p.Version()
+		if err != nil {
+			return dependencyDoc{}, err
+		}
+		license, err := p.License()
+		if err != nil {
+			return dependencyDoc{}, err
+		}
+
+		compPath := strings.TrimPrefix(p.C.Name, "//")
+		if compPath == "" {
+			compPath = "."
+		}
+		link := compPath
+		if linkPrefix != "" {
+			link = strings.TrimSuffix(linkPrefix, "/") + "/" + strings.TrimPrefix(path.Clean(compPath), ".")
+			link = strings.TrimSuffix(link, "/")
+		}
+
+		return dependencyDoc{
+			Name:          p.FullName(),
+			Type:          string(p.Type),
+			Version:       version,
+			Component:     p.C.Name,
+			ComponentLink: link,
+			License:       license,
+		}, nil
+	}
+
+	var (
+		res    dependencyDocs
+		direct = make(map[string]struct{})
+		err    error
+	)
+	res.Package, err = newDoc(pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range pkg.GetDependencies() {
+		doc, err := newDoc(dep)
+		if err != nil {
+			return nil, err
+		}
+		res.Direct = append(res.Direct, doc)
+		direct[dep.FullName()] = struct{}{}
+	}
+	for _, dep := range pkg.GetTransitiveDependencies() {
+		if _, ok := direct[dep.FullName()]; ok {
+			continue
+		}
+		doc, err := newDoc(dep)
+		if err != nil {
+			return nil, err
+		}
+		res.Transitive = append(res.Transitive, doc)
+	}
+	sort.Slice(res.Direct, func(i, j int) bool { return res.Direct[i].Name < res.Direct[j].Name })
+	sort.Slice(res.Transitive, func(i, j int) bool { return res.Transitive[i].Name < res.Transitive[j].Name })
+
+	licenses := make(map[string][]string)
+	for _, deps := range [][]dependencyDoc{res.Direct, res.Transitive} {
+		for _, d := range deps {
+			id := "unknown"
+			if d.License != nil && d.License.ID != "" {
+				id = d.License.ID
+			} else {
+				res.UnknownCount++
+			}
+			licenses[id] = append(licenses[id], d.Name)
+		}
+	}
+	for id, pkgs := range licenses {
+		res.Licenses = append(res.Licenses, licenseCount{License: id, Packages: pkgs})
+	}
+	sort.Slice(res.Licenses, func(i, j int) bool { return res.Licenses[i].License < res.Licenses[j].License })
+
+	return &res, nil
+}
+
+func init() {
+	docsDepsCmd.Flags().String("link-prefix", "", "Prefix for the links to component directories, e.g. the URL of the repository tree")
+	addFormatFlags(docsDepsCmd)
+	docsCmd.AddCommand(docsDepsCmd)
+}
@@ -26,7 +26,9 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"text/template"
 
 	"github.com/creack/pty"
 	"github.com/gookit/color"
@@ -55,6 +57,18 @@ Example use:
   gorpa exec --package some/other:package --dependencies --filter-type go --parallel --watch -- go build
   # run tsc watch for all dependent yarn packages (once per component origin):
   gorpa exec --package some/other:package --transitive-dependencies --filter-type yarn --parallel -- tsc -a --preserveWatchOutput
+  # print the name and version of all Go packages:
+  gorpa exec --filter-type go --template -- echo "{{ .FullName }} {{ .Version }}"
+
+With --template the command arguments are Go templates which are resolved for each location, otherwise they
+are passed verbatim (e.g. docker inspect --format '{{ .Id }}'). The following fields are available:
+  .Name       name of the package (or component when using --components)
+  .FullName   full name of the package (or component when using --components)
+  .Version    version of the package (empty when using --components)
+  .Type       type of the package (empty when using --components)
+  .Component  name of the component
+  .Dir        directory the command is executed in
+  .Const      constants of the component, e.g. {{ .Const.someConstant }}
 `,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -66,6 +80,7 @@ Example use:
 			filterType, _       = cmd.Flags().GetStringArray("filter-type")
 			watch, _            = cmd.Flags().GetBool("watch")
 			parallel, _         = cmd.Flags().GetBool("parallel")
+			templated, _        = cmd.Flags().GetBool("template")
 		)
 
 		ba, err := getApplication()
@@ -80,13 +95,12 @@ Example use:
 				pkgs[p] = struct{}{}
 			}
 		} else {
-			pkgs = make(map[*gorpa.Package]struct{}, len(packages))
-			for _, pn := range packages {
-				pn := absPackageName(ba, pn)
-				p, ok := ba.Packages[pn]
-				if !ok {
-					log.WithField("package", pn).Fatal("package not found")
-				}
+			targets, err := selectTargets(ba, packages)
+			if err != nil {
+				log.Fatal(err)
+			}
+			pkgs = make(map[*gorpa.Package]struct{}, len(targets))
+			for _, p := range targets {
 				pkgs[p] = struct{}{}
 			}
 		}
@@ -159,6 +173,19 @@ Example use:
 			}
 		}
 
+		if templated {
+			tpls, err := parseExecTemplates(args)
+			if err != nil {
+				log.WithError(err).Fatal("cannot parse command")
+			}
+			for i, loc := range locs {
+				locs[i].Args, err = resolveExecTemplates(args, tpls, loc)
+				if err != nil {
+					log.WithError(err).WithField("location", loc.Name).Fatal("cannot resolve command")
+				}
+			}
+		}
+
 		if watch {
 			err := executeCommandInLocations(args, locs, parallel)
 			if err != nil {
@@ -190,6 +217,79 @@ type commandExecLocation struct {
 	Package   *gorpa.Package
 	Dir       string
 	Name      string
+
+	// Args is the command resolved for this location. If nil, the command is used as is.
+	Args []string
+}
+
+type execTemplateData struct {
+	Name      string
+	FullName  string
+	Version   string
+	Type      string
+	Component string
+	Dir       string
+	Const     map[string]string
+}
+
+// parseExecTemplates parses the command arguments as Go templates. Arguments without
+// template actions are passed verbatim, i.e. their entry in the result is nil.
+func parseExecTemplates(args []string) ([]*template.Template, error) {
+	res := make([]*template.Template, len(args))
+	for i, arg := range args {
+		if !strings.Contains(arg, "{{") {
+			continue
+		}
+
+		tpl, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = tpl
+	}
+	return res, nil
+}
+
+func resolveExecTemplates(args []string, tpls []*template.Template, loc commandExecLocation) ([]string, error) {
+	data := execTemplateData{
+		Name:      loc.Component.Name,
+		FullName:  loc.Component.Name,
+		Component: loc.Component.Name,
+		Dir:       loc.Dir,
+		Const:     loc.Component.Constants,
+	}
+	if data.Const == nil {
+		data.Const = make(map[string]string)
+	}
+	if loc.Package != nil {
+		version, err := loc.Package.Version()
+		if err != nil {
+			return nil, err
+		}
+		data.Name = loc.Package.Name
+		data.FullName = loc.Package.FullName()
+		data.Version = version
+		data.Type = string(loc.Package.Type)
+	}
+
+	var (
+		res = make([]string, len(args))
+		buf strings.Builder
+	)
+	for i, tpl := range tpls {
+		if tpl == nil {
+			res[i] = args[i]
+			continue
+		}
+
+		buf.Reset()
+		err := tpl.Execute(&buf, data)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = buf.String()
+	}
+	return res, nil
 }
 
 func executeCommandInLocations(execCmd []string, locs []commandExecLocation, parallel bool) error {
@@ -202,7 +302,12 @@ func executeCommandInLocations(execCmd []string, locs []commandExecLocation, par
 		}
 		prefix := color.Gray.Render(fmt.Sprintf("[%s] ", loc.Name))
 
-		cmd := exec.Command(execCmd[0], execCmd[1:]...)
+		args := execCmd
+		if loc.Args != nil {
+			args = loc.Args
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
 		cmd.Dir = loc.Dir
 		ptmx, err := pty.Start(cmd)
 		if err != nil {
@@ -217,14 +322,14 @@ func executeCommandInLocations(execCmd []string, locs []commandExecLocation, par
 		go io.Copy(ptmx, os.Stdin)
 		if parallel {
 			wg.Add(1)
-			go func() {
+			go func(loc commandExecLocation) {
 				defer wg.Done()
 
-				err = cmd.Wait()
+				err := cmd.Wait()
 				if err != nil {
 					log.Errorf("execution failed in %s (%s): %v", loc.Name, loc.Dir, err)
 				}
-			}()
+			}(loc)
 		} else {
 			err = cmd.Wait()
 			if err != nil {
@@ -242,12 +347,13 @@ func executeCommandInLocations(execCmd []string, locs []commandExecLocation, par
 func init() {
 	rootCmd.AddCommand(execCmd)
 
-	execCmd.Flags().StringArray("package", nil, "select a package by name")
+	execCmd.Flags().StringArray("package", nil, "select packages by name or target pattern (e.g. //components/...[go])")
 	execCmd.Flags().Bool("dependencies", false, "select package dependencies")
 	execCmd.Flags().Bool("transitive-dependencies", false, "select transitive package dependencies")
 	execCmd.Flags().Bool("components", false, "select the package's components (e.g. instead of selecting three packages from the same component, execute just once in the component origin)")
 	execCmd.Flags().StringArray("filter-type", nil, "only select packages of this type")
 	execCmd.Flags().Bool("watch", false, "Watch source files and re-execute on change")
 	execCmd.Flags().Bool("parallel", false, "Start all executions in parallel independent of their order")
+	execCmd.Flags().Bool("template", false, "Resolve the command arguments as Go templates for each package (see help for the available fields)")
 	execCmd.Flags().SetInterspersed(true)
 }
@@ -28,7 +28,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -75,7 +74,7 @@ var mountCmd = &cobra.Command{
 		}
 
 		// prepare delup
-		err = syscall.Mount("overlay", delmp, "overlay", 0, fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", ba.Origin, delup, wd))
+		err = gorpa.MountOverlay(delmp, ba.Origin, delup, wd)
 		if err != nil {
 			return fmt.Errorf("cannot mount delup overlay: %q", err)
 		}
@@ -86,7 +85,7 @@ var mountCmd = &cobra.Command{
 		}
 
 		// actually mount overlay
-		err = syscall.Mount("overlay", dest, "overlay", 0, fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", delmp, upper, wd))
+		err = gorpa.MountOverlay(dest, delmp, upper, wd)
 		if err != nil {
 			return fmt.Errorf("cannot mount overlay: %q", err)
 		}
@@ -42,6 +42,14 @@ var unmountCmd = &cobra.Command{
 	Short: "[experimental] Unmounts a previously mounted overlay",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		applyChanges, _ := cmd.Flags().GetBool("apply")
+		if applyChanges {
+			err := checkSourcesWritable("apply overlay changes")
+			if err != nil {
+				return err
+			}
+		}
+
 		mp := args[0]
 		origin, upper, delmp, err := findOverlayMount(mp)
 		if err != nil {
@@ -59,7 +67,6 @@ var unmountCmd = &cobra.Command{
 			}
 		}()
 
-		applyChanges, _ := cmd.Flags().GetBool("apply")
 		if !applyChanges {
 			return nil
 		}
@@ -26,8 +26,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 
 	gorpa "github.com/bhojpur/gorpa/pkg/engine"
 )
@@ -37,8 +41,35 @@ var fmtCmd = &cobra.Command{
 	Use:   "fmt [files...]",
 	Short: "Formats BUILD.yaml files",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if inPlace, _ := cmd.Flags().GetBool("in-place"); inPlace {
+			err := checkSourcesWritable("format BUILD.yaml files in place")
+			if err != nil {
+				return err
+			}
+		}
+
 		fns := args
-		if len(fns) == 0 {
+		if rev, _ := cmd.Flags().GetString("changed-since"); rev != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--changed-since cannot be combined with files")
+			}
+			ba, err := getApplication()
+			if err != nil {
+				return err
+			}
+			comps, _, err := ba.ChangedSince(rev)
+			if err != nil {
+				return err
+			}
+			if len(comps) == 0 {
+				log.WithField("rev", rev).Info("no BUILD.yaml changed")
+				return nil
+			}
+			for _, comp := range comps {
+				fns = append(fns, filepath.Join(comp.Origin, "BUILD.yaml"))
+			}
+			sort.Strings(fns)
+		} else if len(fns) == 0 {
 			ba, err := getApplication()
 			if err != nil {
 				return err
@@ -46,14 +77,30 @@ var fmtCmd = &cobra.Command{
 			for _, comp := range ba.Components {
 				fns = append(fns, filepath.Join(comp.Origin, "BUILD.yaml"))
 			}
+			sort.Strings(fns)
 		}
 
 		var (
 			inPlace, _ = cmd.Flags().GetBool("in-place")
 			fix, _     = cmd.Flags().GetBool("fix")
+			outs       = make([]bytes.Buffer, len(fns))
+			eg         errgroup.Group
+			sem        = make(chan struct{}, runtime.NumCPU())
 		)
-		for _, fn := range fns {
-			err := formatBuildYaml(fn, inPlace, fix)
+		for i, fn := range fns {
+			i, fn := i, fn
+			eg.Go(func() error {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				return formatBuildYaml(&outs[i], fn, inPlace, fix)
+			})
+		}
+		err := eg.Wait()
+		if err != nil {
+			return err
+		}
+		for i := range outs {
+			_, err = outs[i].WriteTo(os.Stdout)
 			if err != nil {
 				return err
 			}
@@ -63,14 +110,14 @@ var fmtCmd = &cobra.Command{
 	},
 }
 
-func formatBuildYaml(fn string, inPlace, fix bool) error {
+// formatBuildYaml formats a BUILD.yaml file either in place, or by writing the formatted file to out
+func formatBuildYaml(out io.Writer, fn string, inPlace, fix bool) error {
 	f, err := os.OpenFile(fn, os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	var out io.Writer = os.Stdout
 	if inPlace {
 		buf := bytes.NewBuffer(nil)
 		out = buf
@@ -82,7 +129,7 @@ func formatBuildYaml(fn string, inPlace, fix bool) error {
 			io.Copy(f, buf)
 		}()
 	} else {
-		fmt.Printf("---\n# %s\n", fn)
+		fmt.Fprintf(out, "---\n# %s\n", fn)
 	}
 
 	err = gorpa.FormatBUILDyaml(out, f, fix)
@@ -98,4 +145,5 @@ func init() {
 
 	fmtCmd.Flags().BoolP("in-place", "i", false, "format file in place rather than printing it to stdout")
 	fmtCmd.Flags().BoolP("fix", "f", false, "fix issues other than formatting (e.g. deprecated package types)")
+	fmtCmd.Flags().String("changed-since", "", "format only the BUILD.yaml files changed since this Git revision or range")
 }
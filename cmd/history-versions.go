@@ -0,0 +1,78 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// historyVersionsCmd represents the history versions command
+var historyVersionsCmd = &cobra.Command{
+	Use:   "versions <package>",
+	Short: "Lists the recorded version changes of a package and why they happened",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		application, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkg := absPackageName(application, args[0])
+
+		snapshots, err := getGraphHistory().Snapshots()
+		if err != nil {
+			log.WithError(err).Fatal("cannot load graph history")
+		}
+		if len(snapshots) == 0 {
+			log.Fatal("no graph snapshots recorded yet - run gorpa build or gorpa history record first")
+		}
+
+		changes := gorpa.PackageVersionHistory(snapshots, pkg)
+		if len(changes) == 0 {
+			log.Fatalf("package %s does not appear in any recorded snapshot", pkg)
+		}
+
+		// newest first reads more naturally, akin to git log
+		for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+			changes[i], changes[j] = changes[j], changes[i]
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `{{ range . -}}
+{{ .Commit }}	{{ .CommitTime.Format "2006-01-02 15:04:05" }}	{{ if .Version }}{{ .Version }}{{ else }}-{{ end }}
+{{ range .Reasons }}    {{ . }}
+{{ end -}}
+{{ end }}`
+		}
+		err = w.Write(changes)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write version history")
+		}
+	},
+}
+
+func init() {
+	historyCmd.AddCommand(historyVersionsCmd)
+	addFormatFlags(historyVersionsCmd)
+}
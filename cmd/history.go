@@ -0,0 +1,98 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Queries the recorded history of the application graph",
+	Long: `Every build of a clean Git working copy records a snapshot of the application graph (packages, versions and
+their dependencies) in the local cache. The history commands query those snapshots without having to check out
+old commits.`,
+}
+
+// historyRecordCmd represents the history record command
+var historyRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Records a snapshot of the application graph at the current commit",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		application, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		snapshot, err := gorpa.NewGraphSnapshot(&application)
+		if err != nil {
+			log.WithError(err).Fatal("cannot produce graph snapshot")
+		}
+		err = getGraphHistory().Store(snapshot)
+		if err != nil {
+			log.WithError(err).Fatal("cannot store graph snapshot")
+		}
+	},
+}
+
+func getGraphHistory() gorpa.GraphHistory {
+	return gorpa.GraphHistory{
+		Location: filepath.Join(getLocalCacheLocation(), "history"),
+	}
+}
+
+// recordGraphSnapshot stores a snapshot of the application graph unless there is one for the current commit already.
+// Failing to record a snapshot must never fail a build.
+func recordGraphSnapshot(application *gorpa.Application) {
+	if application.Git.Commit == "" || application.Git.Dirty {
+		log.Debug("application is not a clean Git working copy - not recording graph snapshot")
+		return
+	}
+
+	history := getGraphHistory()
+	if history.Has(application.Git.Commit) {
+		return
+	}
+
+	snapshot, err := gorpa.NewGraphSnapshot(application)
+	if err != nil {
+		log.WithError(err).Warn("cannot produce graph snapshot")
+		return
+	}
+	err = history.Store(snapshot)
+	if err != nil {
+		log.WithError(err).Warn("cannot store graph snapshot")
+		return
+	}
+	log.WithField("commit", snapshot.Commit).Debug("recorded graph snapshot")
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyRecordCmd)
+}
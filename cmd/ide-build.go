@@ -0,0 +1,134 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// ideBuildCmd represents the ide build command
+var ideBuildCmd = &cobra.Command{
+	Use:   "build <file>",
+	Short: "Builds the package which owns a file and prints the result and diagnostics as JSON",
+	Long: `Builds the package which owns a file and prints the result and diagnostics as JSON.
+
+The build log is not printed, but kept in the last-build directory of the local cache.
+If a file is owned by several packages (e.g. a BUILD.yaml), the first one by name is built
+unless --package chooses another. The command exits with a non-zero code if the build fails.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ba, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fn, err := filepath.Abs(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		owners, err := ba.PackagesForFile(fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(owners) == 0 {
+			log.WithField("file", fn).Fatal("file is not owned by any package")
+		}
+
+		pkg := owners[0]
+		if name, _ := cmd.Flags().GetString("package"); name != "" {
+			pkg = nil
+			for _, p := range owners {
+				if p.FullName() == name {
+					pkg = p
+					break
+				}
+			}
+			if pkg == nil {
+				log.WithField("file", fn).WithField("package", name).Fatal("package does not own the file")
+			}
+		}
+		version, err := pkg.Version()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diag := gorpa.NewDiagnosticsReporter()
+		opts, _ := getBuildOpts(cmd, &ba)
+		opts = append(opts, gorpa.WithReporter(gorpa.CompositeReporter{diag, gorpa.NewRecordingReporter(getLastBuildLocation())}))
+
+		start := time.Now()
+		err = gorpa.Build(pkg, opts...)
+
+		res := ideBuildResult{
+			File:        fn,
+			Package:     pkg.FullName(),
+			Version:     version,
+			Success:     err == nil,
+			Duration:    time.Since(start).String(),
+			Diagnostics: diag.Diagnostics(),
+		}
+		for _, p := range owners {
+			if p != pkg {
+				res.OtherOwners = append(res.OtherOwners, p.FullName())
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		if res.Diagnostics == nil {
+			res.Diagnostics = []gorpa.Diagnostic{}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if eerr := enc.Encode(res); eerr != nil {
+			log.Fatal(eerr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+type ideBuildResult struct {
+	File        string             `json:"file"`
+	Package     string             `json:"package"`
+	OtherOwners []string           `json:"otherOwners,omitempty"`
+	Version     string             `json:"version"`
+	Success     bool               `json:"success"`
+	Error       string             `json:"error,omitempty"`
+	Duration    string             `json:"duration"`
+	Diagnostics []gorpa.Diagnostic `json:"diagnostics"`
+}
+
+func init() {
+	ideCmd.AddCommand(ideBuildCmd)
+
+	addBuildFlags(ideBuildCmd)
+	ideBuildCmd.Flags().String("package", "", "Package to build if the file is owned by several packages")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+// ideOwnerCmd represents the ide owner command
+var ideOwnerCmd = &cobra.Command{
+	Use:   "owner <file>",
+	Short: "Lists the packages which own a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ba, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkgs, err := ba.PackagesForFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		desc := make([]packageMetadataDescription, len(pkgs))
+		for i, p := range pkgs {
+			desc[i] = newMetadataDescription(p)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `{{ range . }}{{ .FullName }}{{"\t"}}{{ .Version }}
+{{ end }}`
+		}
+		err = w.Write(desc)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	ideCmd.AddCommand(ideOwnerCmd)
+	addFormatFlags(ideOwnerCmd)
+}
@@ -40,12 +40,14 @@ var (
 		gorpa.DockerPackage: dockerfileCandidates,
 		gorpa.GoPackage:     {"go.mod", "go.sum"},
 		gorpa.YarnPackage:   {"package.json", "yarn.lock"},
+		gorpa.ProtoPackage:  {"buf.yaml"},
 	}
 	initPackageGenerator = map[gorpa.PackageType]func(name string) ([]byte, error){
 		gorpa.DockerPackage:  initDockerPackage,
 		gorpa.GoPackage:      initGoPackage,
 		gorpa.YarnPackage:    initYarnPackage,
 		gorpa.GenericPackage: initGenericPackage,
+		gorpa.ProtoPackage:   initProtoPackage,
 	}
 )
 
@@ -54,8 +56,13 @@ var initCmd = &cobra.Command{
 	Use:       "init <name>",
 	Short:     "Initializes a new Bhojpur GoRPA package (and component if need be) in the current directory",
 	Args:      cobra.ExactArgs(1),
-	ValidArgs: []string{"go", "yarn", "docker", "generic"},
+	ValidArgs: []string{"go", "yarn", "docker", "generic", "proto"},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkSourcesWritable("initialize a package")
+		if err != nil {
+			return err
+		}
+
 		var tpe gorpa.PackageType
 		if tper, _ := cmd.Flags().GetString("type"); tper != "" {
 			tpe = gorpa.PackageType(tper)
@@ -181,6 +188,16 @@ config:
 `, name)), nil
 }
 
+func initProtoPackage(name string) ([]byte, error) {
+	return []byte(fmt.Sprintf(`name: %s
+type: proto
+srcs:
+  - "**/*.proto"
+config:
+  generator: buf
+`, name)), nil
+}
+
 func initGenericPackage(name string) ([]byte, error) {
 	fs, err := ioutil.ReadDir(".")
 	if err != nil {
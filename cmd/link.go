@@ -32,13 +32,25 @@ var linkCmd = &cobra.Command{
 	Use:   "link",
 	Short: "Links all packages in-situ",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkSourcesWritable("link packages")
+		if err != nil {
+			return err
+		}
+
 		ba, err := getApplication()
 		if err != nil {
 			return err
 		}
 
 		if ok, _ := cmd.Flags().GetBool("go-link"); ok {
-			err = linker.LinkGoModules(&ba)
+			switch mode, _ := cmd.Flags().GetString("go-mode"); mode {
+			case "replace":
+				err = linker.LinkGoModules(&ba)
+			case "workspace":
+				err = linker.LinkGoWorkspace(&ba)
+			default:
+				log.Fatalf("unknown --go-mode %s: must be replace or workspace", mode)
+			}
 			if err != nil {
 				return err
 			}
@@ -46,7 +58,11 @@ var linkCmd = &cobra.Command{
 			log.Info("go module linking disabled")
 		}
 
+		workspaces, _ := cmd.Flags().GetString("js-workspaces")
 		if ok, _ := cmd.Flags().GetBool("yarn2-link"); ok {
+			if workspaces != "" {
+				log.Fatal("--yarn2-link and --js-workspaces are mutually exclusive")
+			}
 			err = linker.LinkYarnPackagesWithYarn2(&ba)
 			if err != nil {
 				return err
@@ -55,6 +71,13 @@ var linkCmd = &cobra.Command{
 			log.Info("yarn2 package linking disabled")
 		}
 
+		if workspaces != "" {
+			err = linker.LinkNodeWorkspaces(&ba, linker.NodeWorkspaceManager(workspaces))
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	},
 }
@@ -63,5 +86,7 @@ func init() {
 	rootCmd.AddCommand(linkCmd)
 
 	linkCmd.Flags().Bool("yarn2-link", false, "link yarn packages using yarn2 resolutions")
+	linkCmd.Flags().String("js-workspaces", "", "link yarn packages using npm or pnpm workspaces in the application root")
 	linkCmd.Flags().Bool("go-link", true, "link Go modules")
+	linkCmd.Flags().String("go-mode", "replace", "how to link Go modules: replace adds replace directives to every go.mod, workspace generates a go.work file in the application root")
 }
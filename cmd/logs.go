@@ -0,0 +1,71 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs [package]",
+	Short: "Prints the log of the latest build of a package",
+	Long: `Prints the full output of the latest build or test run of a package, which builds write to the logs
+directory of the build directory (see GORPA_BUILD_DIR). Packages which came from a cache were not built, hence
+their log is the one of the last build which built them on this machine.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("logs needs a package")
+		}
+
+		fn := gorpa.PackageLogLocation(pkg)
+		if path, _ := cmd.Flags().GetBool("path"); path {
+			fmt.Println(fn)
+			return
+		}
+		f, err := os.Open(fn)
+		if os.IsNotExist(err) {
+			log.WithField("package", pkg.FullName()).Fatal("package has no log - it was not built on this machine yet")
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		_, err = io.Copy(os.Stdout, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().Bool("path", false, "Print the location of the log instead of its content")
+}
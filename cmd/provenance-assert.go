@@ -137,7 +137,7 @@ func getProvenanceTarget(cmd *cobra.Command, args []string) (bundleFN, pkgFN str
 			log.Fatal("provenance export requires a package")
 		}
 
-		_, cache := getBuildOpts(cmd)
+		_, cache := getBuildOpts(cmd, pkg.C.W)
 
 		var ok bool
 		pkgFN, ok = cache.Location(pkg)
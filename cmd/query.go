@@ -0,0 +1,86 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query <expression>",
+	Short: "Queries the package graph of the application",
+	Long: `Queries the package graph of the application and prints the matching packages.
+An expression is a target pattern (see "gorpa build --help"), a function or a set operation:
+  deps(x)               the packages of x and their transitive dependencies
+  deps(x, n)            the packages of x and their dependencies up to a depth of n
+  rdeps(x), rdeps(x, n) the packages of x and the packages which depend on them
+  somepath(x, y)        a dependency path from a package of x to a package of y, if there is one
+  allpaths(x, y)        all packages on dependency paths from a package of x to a package of y
+  kind(type, x)         the packages of x which have this type
+  filter(regexp, x)     the packages of x whose full name matches the regular expression
+  x + y, x union y      the packages of x or y
+  x - y, x except y     the packages of x which are not part of y
+  x ^ y, x intersect y  the packages of both x and y
+Set operations are left-associative and have equal precedence, use parentheses to group them.
+
+Example use:
+  # all Go packages the server depends on
+  gorpa query 'kind(go, deps(components/server:app))'
+  # the packages which have to be rebuilt when the API changes, but are not part of the server
+  gorpa query 'rdeps(components/api:proto) - deps(components/server:app)'
+  # why does the server depend on the protocol package?
+  gorpa query 'somepath(components/server:app, components/api:proto)'`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ba, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkgs, err := ba.Query(strings.Join(args, " "))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `{{ range . }}{{ .Metadata.FullName }}{{"\n"}}{{ end }}`
+		}
+		decs := make([]packageDescription, 0, len(pkgs))
+		for _, p := range pkgs {
+			decs = append(decs, newPackageDesription(p))
+		}
+		err = w.Write(decs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	addFormatFlags(queryCmd)
+}
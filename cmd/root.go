@@ -44,6 +44,18 @@ const (
 
 	// EnvvarRemoteCacheStorage configures a Remote Storage Provider. Default is GCP
 	EnvvarRemoteCacheStorage = "GORPA_REMOTE_CACHE_STORAGE"
+
+	// EnvvarRemoteCacheSSHOptions configures additional options passed to ssh/sftp when using the RSYNC or SFTP remote storage
+	EnvvarRemoteCacheSSHOptions = "GORPA_REMOTE_CACHE_SSH_OPTIONS"
+
+	// EnvvarRemoteCacheDelta enables delta uploads and downloads if set to "true"
+	EnvvarRemoteCacheDelta = "GORPA_REMOTE_CACHE_DELTA"
+
+	// EnvvarReadOnlySources makes Bhojpur GoRPA refuse commands which would modify the working tree
+	EnvvarReadOnlySources = "GORPA_READ_ONLY_SOURCES"
+
+	// EnvvarLedger configures the ledger builds are recorded in: a file or "remote" for the remote cache
+	EnvvarLedger = "GORPA_LEDGER"
 )
 
 const (
@@ -80,6 +92,10 @@ var (
 	buildArgs   []string
 	verbose     bool
 	variant     string
+	goBuildTags []string
+	goRace      bool
+
+	readOnlySources bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -101,6 +117,15 @@ variables have an effect on the Bhojpur GoRPA:
   <light_blue>GORPA_REMOTE_CACHE_BUCKET</>  enables remote caching using GCP buckets. Set this variable to Google Cloud Storage bucket name used for caching.
                               When this variable is set, the Bhojpur GoRPA expects "gsutil" command in the path configured and authenticated so
                               that it can work with the Google Cloud Storage bucket.
+  <light_blue>GORPA_REMOTE_CACHE_ENCRYPTION_KEY</>  encrypts artifacts using AES-GCM before they are uploaded to the remote cache. Set this variable
+                              to a hex or base64 encoded 16, 24 or 32 byte key.
+  <light_blue>GORPA_REMOTE_CACHE_ENCRYPTION_KEY_URI</>  loads the remote cache encryption key from file:///path, env://VAR or
+                              gcpkms://<key-name>?ciphertext=<wrapped-key-file> (unwrapped using "gcloud kms decrypt").
+  <light_blue>GORPA_REMOTE_CACHE_STORAGE</>  selects the remote cache storage: GCP (default), MINIO, RSYNC or SFTP. MINIO works with any S3 compatible
+                              storage and is configured using GORPA_MINIO_ENDPOINT, GORPA_MINIO_REGION, GORPA_MINIO_ACCESS_KEY,
+                              GORPA_MINIO_SECRET_KEY, GORPA_MINIO_INSECURE and GORPA_MINIO_CA_CERT, or remoteCache.minio in APPLICATION.yaml.
+                              RSYNC and SFTP store artifacts on a host reachable via SSH. GORPA_REMOTE_CACHE_BUCKET then is the
+                              remote directory in [user@]host:/path form, GORPA_REMOTE_CACHE_SSH_OPTIONS passes options to ssh/sftp.
             <light_blue>GORPA_CACHE_DIR</>  location of the local build cache. The directory does not have to exist yet.
             <light_blue>GORPA_BUILD_DIR</>  working location of the Bhojpur GoRPA (i.e. where the actual builds happen). This location will see heavy I/O
                               which makes it advisable to place this on a fast SSD drive or in RAM drive.
@@ -108,11 +133,15 @@ variables have an effect on the Bhojpur GoRPA:
                               See https://yarnpkg.com/lang/en/docs/cli/#toc-concurrency-and-mutex for possible values.
   <light_blue>GORPA_DEFAULT_CACHE_LEVEL</>  sets the default cache level for builds. Defaults to "remote".
          <light_blue>GORPA_EXPERIMENTAL</>  enables experimental Bhojpur GoRPA features and commands.
+    <light_blue>GORPA_READ_ONLY_SOURCES</>  refuses all commands which would modify the working tree (same as --read-only-sources).
+            <light_blue>GORPA_AUDIT_LOG</>  appends a JSON line with user, command, arguments, duration and outcome to this file
+                              for every command executed.
 `),
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			log.SetLevel(log.DebugLevel)
 		}
+		startAudit(cmd, args)
 	},
 	BashCompletionFunction: bashCompletionFunc,
 }
@@ -138,7 +167,9 @@ func Execute() {
 		defer trace.StartRegion(context.Background(), "main").End()
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	finishAudit(err)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -153,21 +184,45 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&application, "application", "a", applicationRoot, "Bhojpur.NET Platform application root")
 	rootCmd.PersistentFlags().StringArrayVarP(&buildArgs, "build-arg", "D", []string{}, "pass arguments to BUILD files")
 	rootCmd.PersistentFlags().StringVar(&variant, "variant", "", "selects a package variant")
+	rootCmd.PersistentFlags().StringSliceVar(&goBuildTags, "go-build-tags", nil, "adds build tags to all Go packages (changes their version)")
+	rootCmd.PersistentFlags().BoolVar(&goRace, "race", false, "builds and tests all Go packages with the race detector (changes their version)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enables verbose logging")
+	rootCmd.PersistentFlags().BoolVar(&readOnlySources, "read-only-sources", os.Getenv(EnvvarReadOnlySources) == "true", "refuse all commands which would modify the working tree")
 	rootCmd.PersistentFlags().Bool("dut", false, "used for testing only - doesn't actually do anything")
 }
 
 func getApplication() (gorpa.Application, error) {
+	return loadApplication(application)
+}
+
+// loadApplication loads the application at root, honouring the global flags
+func loadApplication(root string) (gorpa.Application, error) {
 	args, err := getBuildArgs()
 	if err != nil {
 		return gorpa.Application{}, err
 	}
 
+	opts := []gorpa.ApplicationOption{
+		gorpa.WithGoBuildProfile(gorpa.GoBuildProfile{
+			BuildTags: goBuildTags,
+			Race:      goRace,
+		}),
+	}
+
 	if os.Getenv("GORPA_NESTED_APPLICATION") != "" {
-		return gorpa.FindNestedApplications(application, args, variant)
+		return gorpa.FindNestedApplications(root, args, variant, opts...)
 	}
 
-	return gorpa.FindApplication(application, args, variant, os.Getenv("GORPA_PROVENANCE_KEYPATH"))
+	return gorpa.FindApplication(root, args, variant, os.Getenv("GORPA_PROVENANCE_KEYPATH"), opts...)
+}
+
+// checkSourcesWritable returns an error if the working tree must not be modified, e.g. because
+// Bhojpur GoRPA runs on a shared build server.
+func checkSourcesWritable(action string) error {
+	if !readOnlySources {
+		return nil
+	}
+	return xerrors.Errorf("cannot %s: this would modify the working tree and sources are read-only (--read-only-sources or %s)", action, EnvvarReadOnlySources)
 }
 
 func getBuildArgs() (gorpa.Arguments, error) {
@@ -186,28 +241,93 @@ func getBuildArgs() (gorpa.Arguments, error) {
 	return res, nil
 }
 
-func getRemoteCache() gorpa.RemoteCache {
-	remoteCacheBucket := os.Getenv(EnvvarRemoteCacheBucket)
-	remoteStorage := os.Getenv(EnvvarRemoteCacheStorage)
-	if remoteCacheBucket != "" {
-		switch remoteStorage {
-		case "GCP":
-			return gorpa.GSUtilRemoteCache{
-				BucketName: remoteCacheBucket,
-			}
-		case "MINIO":
-			return gorpa.MinioRemoteCache{
-				BucketName: remoteCacheBucket,
-			}
-		default:
-			return gorpa.GSUtilRemoteCache{
-				BucketName: remoteCacheBucket,
+func getRemoteCache(application *gorpa.Application, transfer gorpa.TransferOptions) gorpa.RemoteCache {
+	rc := getRemoteCacheStorage(application, transfer)
+	if rc == nil {
+		return gorpa.NoRemoteCache{}
+	}
+
+	key, err := gorpa.LoadCacheEncryptionKey()
+	if err != nil {
+		log.WithError(err).Fatal("cannot load remote cache encryption key")
+	}
+	if os.Getenv(EnvvarRemoteCacheDelta) == "true" {
+		if key != nil {
+			// deltas are computed on the artifact's files, which encrypted artifacts do not reveal
+			log.Warn("delta transfers are not supported with an encrypted remote cache - transferring full artifacts")
+		} else {
+			drc, err := gorpa.NewDeltaRemoteCache(rc, gorpa.DefaultDeltaMaxChain)
+			if err != nil {
+				log.WithError(err).Fatal("cannot configure remote cache")
 			}
+			drc.Progress = transfer.Progress
+			rc = drc
+		}
+	}
+	if key != nil {
+		rc = gorpa.EncryptedRemoteCache{
+			C:   rc,
+			Key: key,
 		}
+	}
+
+	return rc
+}
 
+// getRemoteCacheStorage returns the remote cache storage configured in the environment, without encryption
+// or delta transfers. Returns nil if no remote cache is configured.
+func getRemoteCacheStorage(application *gorpa.Application, transfer gorpa.TransferOptions) gorpa.RemoteCache {
+	remoteCacheBucket := os.Getenv(EnvvarRemoteCacheBucket)
+	remoteStorage := os.Getenv(EnvvarRemoteCacheStorage)
+	if remoteCacheBucket == "" {
+		return nil
 	}
 
-	return gorpa.NoRemoteCache{}
+	var rc gorpa.RemoteCache
+	switch remoteStorage {
+	case "GCP":
+		rc = gorpa.GSUtilRemoteCache{
+			BucketName: remoteCacheBucket,
+			Transfer:   transfer,
+		}
+	case "MINIO":
+		cfg, err := application.RemoteCache.Minio.WithEnvironment()
+		if err != nil {
+			log.WithError(err).Fatal("cannot configure MinIO remote cache")
+		}
+		err = cfg.Validate()
+		if err != nil {
+			log.WithError(err).Fatal("cannot configure MinIO remote cache")
+		}
+		rc = gorpa.MinioRemoteCache{
+			BucketName: remoteCacheBucket,
+			Config:     cfg,
+			Transfer:   transfer,
+		}
+	case "RSYNC", "SFTP":
+		src := gorpa.SSHRemoteCache{
+			Location:   remoteCacheBucket,
+			Protocol:   gorpa.SSHProtocol(strings.ToLower(remoteStorage)),
+			SSHOptions: strings.Fields(os.Getenv(EnvvarRemoteCacheSSHOptions)),
+			Transfer:   transfer,
+		}
+		err := src.Validate()
+		if err != nil {
+			log.WithError(err).Fatal("cannot configure SSH remote cache")
+		}
+		rc = src
+	case "HTTP":
+		rc = gorpa.HTTPRemoteCache{
+			URL:      remoteCacheBucket,
+			Transfer: transfer,
+		}
+	default:
+		rc = gorpa.GSUtilRemoteCache{
+			BucketName: remoteCacheBucket,
+			Transfer:   transfer,
+		}
+	}
+	return rc
 }
 
 func addExperimentalCommand(parent, child *cobra.Command) {
@@ -36,7 +36,7 @@ var runCmd = &cobra.Command{
 			log.Fatal("tree needs a package")
 		}
 
-		opts, _ := getBuildOpts(cmd)
+		opts, _ := getBuildOpts(cmd, script.C.W)
 		err := script.Run(opts...)
 		if err != nil {
 			log.Fatal(err)
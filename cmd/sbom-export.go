@@ -0,0 +1,69 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"os"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// sbomExportCmd represents the sbom export command
+var sbomExportCmd = &cobra.Command{
+	Use:   "export <package>",
+	Short: "Exports the SPDX SBOM of a (previously built) package",
+	Long: `Exports the SPDX SBOM of a (previously built) package from its artifact in the local cache.
+
+SBOMs are generated for Go, yarn and Docker packages if the provenance of the application
+has "sbom: true".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("sbom export requires a package")
+		}
+
+		_, cache := getBuildOpts(cmd, pkg.C.W)
+		fn, ok := cache.Location(pkg)
+		if !ok {
+			log.Fatalf("%s is not built", pkg.FullName())
+		}
+
+		err := gorpa.AccessSBOMInCachedArchive(fn, func(sbom io.Reader) error {
+			_, err := io.Copy(os.Stdout, sbom)
+			return err
+		})
+		if err == gorpa.ErrNoSBOM {
+			log.Fatalf("%s has no SBOM - was it built with provenance and sbom enabled?", pkg.FullName())
+		}
+		if err != nil {
+			log.WithError(err).Fatal("cannot export SBOM")
+		}
+	},
+}
+
+func init() {
+	sbomCmd.AddCommand(sbomExportCmd)
+	addBuildFlags(sbomExportCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search <term>",
+	Short: "Searches packages and scripts by name, description, type and component constants",
+	Long: `Searches packages and scripts by name, description, type and component constants.
+
+Every word of the search term has to match at least one of those fields. Words match exactly, as part of a
+field, or fuzzily, i.e. when all of their characters appear in order (e.g. "cmpapi" matches "components/api").
+Results are ranked by how well and where the words matched, best matches first.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		application, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res := application.Search(strings.Join(args, " "))
+		if kind, _ := cmd.Flags().GetString("kind"); kind != "" {
+			filtered := make([]gorpa.SearchResult, 0, len(res))
+			for _, r := range res {
+				if string(r.Kind) == kind {
+					filtered = append(filtered, r)
+				}
+			}
+			res = filtered
+		}
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 && len(res) > limit {
+			res = res[:limit]
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `{{ range . }}{{ .Name }}{{"\t"}}{{ .Kind }}{{"\t"}}{{ .Type }}{{ if .Description }}{{"\t"}}{{ .Description }}{{ end }}
+{{ end }}`
+		}
+		err = w.Write(res)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	searchCmd.Flags().Int("limit", 20, "Maximum number of results (0 for all)")
+	searchCmd.Flags().String("kind", "", "Only list packages or scripts (package|script)")
+	addFormatFlags(searchCmd)
+	rootCmd.AddCommand(searchCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// shellBuildScript is the name of the script containing the build commands in the shell's working directory
+const shellBuildScript = "gorpa-build.sh"
+
+// shellCmd represents the shell command
+var shellCmd = &cobra.Command{
+	Use:   "shell [package]",
+	Short: "Starts an interactive shell in the prepared build directory of a package",
+	Long: `Builds the dependencies of the package and prepares a temporary build directory the way a build would:
+the sources are copied, the dependencies extracted into their layout and the preparation commands run.
+It then starts an interactive shell in that directory, with the environment of the package build.
+
+The build commands which would build the package are not run, but written to ` + shellBuildScript + `
+in the build directory, so that they can be run and debugged step by step. The directory is removed
+when the shell exits, unless --keep is set.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("shell needs a package")
+		}
+		opts, _ := getBuildOpts(cmd, pkg.C.W)
+
+		env, err := gorpa.PrepareShell(pkg, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keep, _ := cmd.Flags().GetBool("keep")
+		if !keep {
+			defer os.RemoveAll(env.Dir)
+		}
+
+		script, err := env.WriteScript(shellBuildScript)
+		if err != nil {
+			log.WithError(err).Warn("cannot write build commands")
+		}
+
+		shell, _ := cmd.Flags().GetString("shell")
+		if shell == "" {
+			shell = os.Getenv("SHELL")
+		}
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+
+		fmt.Printf("\n🐚  starting %s in the build directory of %s\n", shell, color.Cyan.Render(pkg.FullName()))
+		if script != "" {
+			fmt.Printf("    the build commands are in %s\n", color.Cyan.Render(script))
+		}
+		fmt.Println()
+
+		sh := exec.Command(shell)
+		sh.Dir = env.Dir
+		sh.Env = append(append(os.Environ(), env.Env...), "GORPA_SHELL_PACKAGE="+pkg.FullName())
+		sh.Stdin = os.Stdin
+		sh.Stdout = os.Stdout
+		sh.Stderr = os.Stderr
+		err = sh.Run()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			log.WithError(err).Error("cannot run shell")
+		}
+
+		if keep {
+			fmt.Printf("\n📁  kept build directory %s\n", color.Cyan.Render(env.Dir))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+
+	shellCmd.Flags().Bool("keep", false, "keep the build directory after the shell exits")
+	shellCmd.Flags().String("shell", "", "shell to start (defaults to $SHELL or /bin/sh)")
+	addBuildFlags(shellCmd)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// statsDuplicatesCmd represents the stats duplicates command
+var statsDuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "Reports files which are stored identically in several cached build artifacts",
+	Long: `Reports files which are stored identically in several cached build artifacts.
+
+All artifacts of the current application found in the local cache are read and their files hashed. The report
+states how many bytes a content-addressed store would save over the current artifacts, lists the largest
+duplicates and the packages which share content with one of their dependencies - usually because they embed it.
+Packages which have not been built are skipped. All sizes are uncompressed bytes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		application, err := getApplication()
+		if err != nil {
+			log.Fatal(err)
+		}
+		cache, err := gorpa.NewFilesystemCache(getLocalCacheLocation())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pkgs := make([]*gorpa.Package, 0, len(application.Packages))
+		for _, pkg := range application.Packages {
+			pkgs = append(pkgs, pkg)
+		}
+		report, err := gorpa.FindDuplicateFiles(cache, pkgs)
+		if err != nil {
+			log.WithError(err).Fatal("cannot find duplicate files")
+		}
+		if top, _ := cmd.Flags().GetInt("top"); top > 0 {
+			if len(report.Duplicates) > top {
+				report.Duplicates = report.Duplicates[:top]
+			}
+			if len(report.Embedded) > top {
+				report.Embedded = report.Embedded[:top]
+			}
+		}
+
+		w := getWriterFromFlags(cmd)
+		if w.FormatString == "" {
+			w.FormatString = `Artifacts:{{"\t"}}{{ .Artifacts }}
+Files:{{"\t"}}{{ .Files }}
+Total bytes:{{"\t"}}{{ .TotalBytes }}
+Unique bytes:{{"\t"}}{{ .UniqueBytes }}
+Savable bytes:{{"\t"}}{{ .SavableBytes }}
+{{ if .Duplicates }}
+Largest duplicates:
+{{- range .Duplicates }}
+{{"\t"}}{{ .WastedBytes }} wasted bytes ({{ .Size }} bytes, {{ len .Occurrences }} copies)
+{{- range .Occurrences }}
+{{"\t\t"}}{{ .Package }}{{"\t"}}{{ .Path }}
+{{- end }}
+{{- end }}
+{{ end -}}
+{{ if .Embedded }}
+Content shared with dependencies:
+{{- range .Embedded }}
+{{"\t"}}{{ .Package }}{{"\t"}}{{ .Dependency }}{{"\t"}}{{ .Files }} files, {{ .Bytes }} bytes
+{{- end }}
+{{ end -}}
+`
+		}
+		err = w.Write(report)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	statsDuplicatesCmd.Flags().Int("top", 20, "Limits the number of duplicates and embedded dependencies listed (0 lists all)")
+	addFormatFlags(statsDuplicatesCmd)
+	statsCmd.AddCommand(statsDuplicatesCmd)
+}
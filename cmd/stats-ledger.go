@@ -0,0 +1,145 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	"github.com/bhojpur/gorpa/pkg/prettyprint"
+)
+
+// statsLedgerCmd represents the stats ledger command
+var statsLedgerCmd = &cobra.Command{
+	Use:   "ledger",
+	Short: "Summarises the build invocations recorded in the ledger",
+	Long: `Summarises the build invocations recorded in the ledger.
+
+Builds append a record of their invocation to the ledger if GORPA_LEDGER is set: either to a local
+JSON lines file, or - if GORPA_LEDGER is "remote" - to one JSON lines object per day in the remote cache.
+Each record names the user, host, target, the versions built and their durations, and how many packages
+came from the local and remote cache.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		loc, _ := cmd.Flags().GetString("ledger")
+		if loc == "" {
+			log.Fatalf("no ledger configured - set %s or use --ledger", EnvvarLedger)
+		}
+		var application *gorpa.Application
+		if loc == "remote" {
+			ba, err := getApplication()
+			if err != nil {
+				log.Fatal(err)
+			}
+			application = &ba
+		}
+		ledger := getLedger(application, loc, gorpa.DefaultTransferOptions)
+
+		period, _ := cmd.Flags().GetDuration("since")
+		since := time.Now().Add(-period)
+		recs, err := ledger.Read(since)
+		if err != nil {
+			log.WithError(err).Fatal("cannot read ledger")
+		}
+
+		w := getWriterFromFlags(cmd)
+		if raw, _ := cmd.Flags().GetBool("records"); raw {
+			if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+				w.FormatString = `{{ range . }}{{ .Time.Format "2006-01-02 15:04:05" }}{{"\t"}}{{ .User }}@{{ .Host }}{{"\t"}}{{ .Target }}{{"\t"}}{{ if .Success }}ok{{ else }}failed{{ end }}{{"\t"}}{{ .Duration }}{{"\t"}}{{ .Cache.Built }} built, {{ .Cache.Local }} local, {{ .Cache.Remote }} remote
+{{ end }}`
+			}
+			err = w.Write(recs)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if w.Format == prettyprint.TemplateFormat && w.FormatString == "" {
+			w.FormatString = `Since:{{"\t"}}{{ .Since.Format "2006-01-02 15:04" }}
+Invocations:{{"\t"}}{{ .Invocations }} ({{ .Failures }} failed)
+Build time:{{"\t"}}{{ .TotalDuration }}
+Packages:{{"\t"}}{{ .Cache.Built }} built, {{ .Cache.Failed }} failed, {{ .Cache.Local }} from the local cache, {{ .Cache.Remote }} from the remote cache
+Cache hit rate:{{"\t"}}{{ printf "%.2f" .CacheHitRate }}
+{{ if .Users -}}
+Users:
+{{- range .Users }}
+{{"\t"}}{{ .Name }}{{"\t"}}{{ .Invocations }} invocations{{"\t"}}{{ .Duration }}
+{{- end }}
+{{ end -}}
+{{ if .Hosts -}}
+Hosts:
+{{- range .Hosts }}
+{{"\t"}}{{ .Name }}{{"\t"}}{{ .Invocations }} invocations{{"\t"}}{{ .Duration }}
+{{- end }}
+{{ end -}}
+{{ if .Targets -}}
+Targets:
+{{- range .Targets }}
+{{"\t"}}{{ .Name }}{{"\t"}}{{ .Invocations }} invocations{{"\t"}}{{ .Failures }} failed
+{{- end }}
+{{ end -}}
+{{ if .Versions -}}
+Versions:
+{{- range .Versions }}
+{{"\t"}}{{ .Name }}{{"\t"}}{{ .Invocations }} invocations
+{{- end }}
+{{ end -}}
+`
+		}
+		err = w.Write(gorpa.SummarizeLedger(since, recs))
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// getLedger returns the ledger at loc, i.e. a file or "remote" for the remote cache, or nil if loc is empty
+func getLedger(application *gorpa.Application, loc string, transfer gorpa.TransferOptions) gorpa.Ledger {
+	switch loc {
+	case "":
+		return nil
+	case "remote":
+		rc := getRemoteCacheStorage(application, transfer)
+		if rc == nil {
+			log.Fatalf("%s=remote requires a remote cache", EnvvarLedger)
+		}
+		ledger, err := gorpa.NewRemoteLedger(rc)
+		if err != nil {
+			log.WithError(err).Fatal("cannot configure ledger")
+		}
+		return ledger
+	default:
+		return gorpa.FileLedger{Path: loc}
+	}
+}
+
+func init() {
+	statsCmd.AddCommand(statsLedgerCmd)
+	addFormatFlags(statsLedgerCmd)
+	statsLedgerCmd.Flags().String("ledger", os.Getenv(EnvvarLedger), "Ledger to read: a file or \"remote\" for the remote cache (defaults to $"+EnvvarLedger+")")
+	statsLedgerCmd.Flags().Duration("since", 7*24*time.Hour, "Summarise the invocations of this period")
+	statsLedgerCmd.Flags().Bool("records", false, "List the records instead of summarising them")
+}
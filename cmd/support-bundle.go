@@ -0,0 +1,298 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	stamping "github.com/bhojpur/gorpa/pkg/version"
+)
+
+const (
+	redactedValue = "<redacted>"
+
+	// supportBundleAuditLines is the number of audit log lines included in a support bundle
+	supportBundleAuditLines = 200
+)
+
+// secretNamePattern matches names of configuration keys and environment variables which likely hold secrets
+var secretNamePattern = regexp.MustCompile(`(?i)(secret|passw(or)?d|token|credential|auth|key)`)
+
+// supportBundleCmd represents the support-bundle command
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collects information about this installation and application for attaching to issues",
+	Long: `Collects the Bhojpur GoRPA version, the APPLICATION.yaml, the environment manifest, the cache configuration,
+the report and log of the last build, and the recent audit log into a tar.gz file.
+
+Values of configuration keys and environment variables which look like secrets (e.g. *_SECRET_KEY, token, password)
+are redacted. Please review the bundle before sharing it nonetheless.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+
+		bundle := &supportBundle{Files: make(map[string][]byte)}
+		bundle.Add("version.txt", []byte(fmt.Sprintf("Bhojpur GoRPA %s\nGo %s %s/%s\n", stamping.FullVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)))
+
+		root := application
+		ba, err := getApplication()
+		if err != nil {
+			// a broken application is a prime reason for a support bundle
+			bundle.Errorf("cannot load application: %v", err)
+		} else {
+			root = ba.Origin
+
+			var buf bytes.Buffer
+			err = ba.EnvironmentManifest.Write(&buf)
+			if err != nil {
+				bundle.Errorf("cannot produce environment manifest: %v", err)
+			} else {
+				bundle.Add("environment-manifest.txt", buf.Bytes())
+			}
+		}
+
+		if fc, err := ioutil.ReadFile(filepath.Join(root, "APPLICATION.yaml")); err != nil {
+			bundle.Errorf("cannot read APPLICATION.yaml: %v", err)
+		} else if fc, err = redactYAML(fc); err != nil {
+			// we must not include an APPLICATION.yaml we could not redact
+			bundle.Errorf("cannot redact APPLICATION.yaml: %v", err)
+		} else {
+			bundle.Add("APPLICATION.yaml", fc)
+		}
+
+		cacheCfg, err := yaml.Marshal(map[string]interface{}{
+			"localCache":  getLocalCacheLocation(),
+			"environment": redactedEnvironment(),
+		})
+		if err != nil {
+			bundle.Errorf("cannot describe cache configuration: %v", err)
+		} else {
+			bundle.Add("configuration.yaml", cacheCfg)
+		}
+
+		for _, fn := range []string{gorpa.BuildReportFilename, gorpa.BuildLogFilename} {
+			fc, err := ioutil.ReadFile(filepath.Join(getLastBuildLocation(), fn))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				bundle.Errorf("cannot read %s of the last build: %v", fn, err)
+				continue
+			}
+			bundle.Add(filepath.Join("last-build", fn), fc)
+		}
+
+		if fn := os.Getenv(EnvvarAuditLog); fn != "" {
+			fc, err := tailFile(fn, supportBundleAuditLines)
+			if err != nil {
+				bundle.Errorf("cannot read audit log: %v", err)
+			} else {
+				bundle.Add("audit.log", fc)
+			}
+		}
+
+		err = bundle.Write(out)
+		if err != nil {
+			log.WithError(err).Fatal("cannot write support bundle")
+		}
+		fmt.Printf("📦  wrote support bundle to %s - please review its content before sharing it\n", out)
+	},
+}
+
+// supportBundle collects the files of a support bundle. Problems while collecting them end up in the bundle, too.
+type supportBundle struct {
+	Files  map[string][]byte
+	Errors []string
+}
+
+func (b *supportBundle) Add(name string, content []byte) {
+	b.Files[name] = content
+}
+
+func (b *supportBundle) Errorf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Warn(msg)
+	b.Errors = append(b.Errors, msg)
+}
+
+func (b *supportBundle) Write(fn string) error {
+	if len(b.Errors) > 0 {
+		b.Add("errors.txt", []byte(strings.Join(b.Errors, "\n")+"\n"))
+	}
+
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(b.Files))
+	for n := range b.Files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	now := time.Now()
+	for _, n := range names {
+		fc := b.Files[n]
+		err = tw.WriteHeader(&tar.Header{
+			Name:    n,
+			Mode:    0644,
+			Size:    int64(len(fc)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(fc)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// redactYAML replaces all scalar values whose key looks like it names a secret, including the
+// values of NAME=value environment entries
+func redactYAML(fc []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(fc, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return fc, nil
+	}
+	redactYAMLNode(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func redactYAMLNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if val.Kind == yaml.ScalarNode && secretNamePattern.MatchString(key.Value) {
+				val.Value = redactedValue
+				val.Tag = "!!str"
+				val.Style = 0
+				continue
+			}
+			redactYAMLNode(val)
+		}
+		return
+	}
+	if node.Kind == yaml.SequenceNode {
+		for _, c := range node.Content {
+			segs := strings.SplitN(c.Value, "=", 2)
+			if c.Kind == yaml.ScalarNode && len(segs) == 2 && secretNamePattern.MatchString(segs[0]) {
+				c.Value = segs[0] + "=" + redactedValue
+			}
+		}
+	}
+	for _, c := range node.Content {
+		redactYAMLNode(c)
+	}
+}
+
+// redactedEnvironment returns all GORPA_ environment variables with secrets redacted
+func redactedEnvironment() map[string]string {
+	res := make(map[string]string)
+	for _, e := range os.Environ() {
+		segs := strings.SplitN(e, "=", 2)
+		if len(segs) != 2 || !strings.HasPrefix(segs[0], "GORPA_") {
+			continue
+		}
+		if secretNamePattern.MatchString(segs[0]) {
+			res[segs[0]] = redactedValue
+		} else {
+			res[segs[0]] = segs[1]
+		}
+	}
+	return res
+}
+
+// tailFile returns the last n lines of a file
+func tailFile(fn string, n int) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+
+	supportBundleCmd.Flags().StringP("output", "o", "gorpa-support-bundle.tar.gz", "file to write the support bundle to")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedactYAML(t *testing.T) {
+	in := `defaultTarget: comp:app
+provenance:
+  enabled: true
+  key: /secrets/provenance.pem
+remoteCache:
+  token: abc123
+  nested:
+    - password: hunter2
+      user: alice
+    - AWS_SECRET_ACCESS_KEY: xyz
+env:
+  - GITHUB_TOKEN=ghp_abc
+`
+	out, err := redactYAML([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"/secrets/provenance.pem", "abc123", "hunter2", "xyz", "ghp_abc"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("secret %q was not redacted:\n%s", secret, out)
+		}
+	}
+	for _, kept := range []string{"comp:app", "enabled: true", "user: alice", "GITHUB_TOKEN=" + redactedValue} {
+		if !strings.Contains(string(out), kept) {
+			t.Errorf("expected %q to be kept:\n%s", kept, out)
+		}
+	}
+}
+
+func TestRedactedEnvironment(t *testing.T) {
+	t.Setenv("GORPA_REMOTE_CACHE_BUCKET", "some-bucket")
+	t.Setenv("GORPA_MINIO_SECRET_KEY", "minio-secret")
+	t.Setenv("GORPA_GITHUB_TOKEN", "ghp_abc")
+	t.Setenv("GITHUB_TOKEN", "ghp_def")
+
+	env := redactedEnvironment()
+	act := map[string]string{
+		"GORPA_REMOTE_CACHE_BUCKET": env["GORPA_REMOTE_CACHE_BUCKET"],
+		"GORPA_MINIO_SECRET_KEY":    env["GORPA_MINIO_SECRET_KEY"],
+		"GORPA_GITHUB_TOKEN":        env["GORPA_GITHUB_TOKEN"],
+	}
+	expectation := map[string]string{
+		"GORPA_REMOTE_CACHE_BUCKET": "some-bucket",
+		"GORPA_MINIO_SECRET_KEY":    redactedValue,
+		"GORPA_GITHUB_TOKEN":        redactedValue,
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("unexpected environment (-want +got):\n%s", diff)
+	}
+	if _, ok := env["GITHUB_TOKEN"]; ok {
+		t.Errorf("environment contains variables not used by Bhojpur GoRPA")
+	}
+}
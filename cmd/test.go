@@ -0,0 +1,80 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test [package]",
+	Short: "Runs the tests of a package without building it",
+	Long: `Runs the tests of a package, even if they passed for its version before. The dependencies of the package
+come from the caches, or are built if they aren't cached, but the package itself is not built: only the build
+commands its tests need run before the tests, and no build artifact is produced.
+
+With --dependents the packages which depend on the package are tested, too, once its own tests passed.
+--run selects the tests to run: Go packages pass it to "go test -run", all other packages find it in the
+GORPA_TEST_FILTER environment variable of their test commands.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, pkg, _, _ := getTarget(args, false)
+		if pkg == nil {
+			log.Fatal("test needs a package")
+		}
+		opts, _ := getBuildOpts(cmd, pkg.C.W)
+		filter, _ := cmd.Flags().GetString("run")
+		opts = append(opts, gorpa.WithTestFilter(filter))
+
+		pkgs := []*gorpa.Package{pkg}
+		if dependents, _ := cmd.Flags().GetBool("dependents"); dependents {
+			pkgs = append(pkgs, pkg.C.W.Dependents([]*gorpa.Package{pkg})...)
+			gorpa.TopologicalSort(pkgs)
+		}
+		if len(pkgs) > 1 {
+			names := make([]string, 0, len(pkgs))
+			for _, p := range pkgs {
+				names = append(names, p.FullName())
+			}
+			fmt.Fprintf(getHumanOutput(cmd), "🧪  testing %s\n", color.Cyan.Render(strings.Join(names, ", ")))
+		}
+
+		err := gorpa.Test(pkgs, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+	addBuildFlags(testCmd)
+	testCmd.Flags().Bool("dependents", false, "Test the packages which depend on the package, too")
+	testCmd.Flags().String("run", "", "Run only the tests whose names match this regular expression")
+}
@@ -21,6 +21,7 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"fmt"
 	"os"
 
 	log "github.com/sirupsen/logrus"
@@ -58,9 +59,13 @@ var vetCmd = &cobra.Command{
 			opts = append(opts, vet.WithChecks(checks))
 		}
 		if pkgs, _ := cmd.Flags().GetStringArray("packages"); len(pkgs) > 0 {
+			targets, err := selectTargets(ba, pkgs)
+			if err != nil {
+				return err
+			}
 			idx := make(vet.StringSet)
-			for _, p := range pkgs {
-				idx[p] = struct{}{}
+			for _, p := range targets {
+				idx[p.FullName()] = struct{}{}
 			}
 			opts = append(opts, vet.OnPackages(idx))
 		}
@@ -71,6 +76,29 @@ var vetCmd = &cobra.Command{
 			}
 			opts = append(opts, vet.OnComponents(idx))
 		}
+		if rev, _ := cmd.Flags().GetString("changed-since"); rev != "" {
+			if cmd.Flags().Changed("packages") || cmd.Flags().Changed("components") {
+				return fmt.Errorf("--changed-since cannot be combined with --packages or --components")
+			}
+			comps, pkgs, err := ba.ChangedSince(rev)
+			if err != nil {
+				return err
+			}
+			if len(comps) == 0 && len(pkgs) == 0 {
+				log.WithField("rev", rev).Info("no components or packages changed")
+				return nil
+			}
+
+			compIdx := make(vet.StringSet, len(comps))
+			for n := range comps {
+				compIdx[n] = struct{}{}
+			}
+			pkgIdx := make(vet.StringSet, len(pkgs))
+			for n := range pkgs {
+				pkgIdx[n] = struct{}{}
+			}
+			opts = append(opts, vet.OnComponents(compIdx), vet.OnPackages(pkgIdx))
+		}
 
 		findings, errs := vet.Run(ba, opts...)
 		if ignoreWarnings, _ := cmd.Flags().GetBool("ignore-warnings"); ignoreWarnings {
@@ -91,6 +119,29 @@ var vetCmd = &cobra.Command{
 			return nil
 		}
 
+		if fn, _ := cmd.Flags().GetString("baseline"); fn != "" {
+			if update, _ := cmd.Flags().GetBool("update-baseline"); update {
+				err = vet.NewBaseline(findings).Save(fn)
+				if err != nil {
+					return err
+				}
+				log.WithField("findings", len(findings)).WithField("baseline", fn).Info("updated baseline")
+				return nil
+			}
+
+			baseline, err := vet.LoadBaseline(fn)
+			if err != nil {
+				return err
+			}
+			var fixed []vet.BaselineEntry
+			findings, fixed = baseline.Filter(findings)
+			if len(fixed) > 0 {
+				log.WithField("baseline", fn).Infof("%d baseline findings no longer occur - consider running with --update-baseline", len(fixed))
+			}
+		} else if update, _ := cmd.Flags().GetBool("update-baseline"); update {
+			return fmt.Errorf("--update-baseline requires --baseline")
+		}
+
 		if w.FormatString == "" && w.Format == prettyprint.TemplateFormat {
 			w.FormatString = `{{ range . }}
 {{"\033"}}[90m{{ if .Package -}}📦{{"\t"}}{{ .Package.FullName }}{{ else if .Component }}🗃️{{"\t"}}{{ .Component.Name }}{{ end }}
@@ -117,8 +168,11 @@ func init() {
 	rootCmd.AddCommand(vetCmd)
 
 	vetCmd.Flags().StringArray("checks", nil, "run these checks only")
-	vetCmd.Flags().StringArray("packages", nil, "run checks on these packages only")
+	vetCmd.Flags().StringArray("packages", nil, "run checks on these packages or target patterns (e.g. //components/...) only")
 	vetCmd.Flags().StringArray("components", nil, "run checks on these components only")
+	vetCmd.Flags().String("changed-since", "", "run checks only on the components and packages changed since this Git revision or range")
 	vetCmd.Flags().Bool("ignore-warnings", false, "ignores all warnings")
+	vetCmd.Flags().String("baseline", "", "report only findings which are not contained in this baseline file")
+	vetCmd.Flags().Bool("update-baseline", false, "write all current findings to the baseline file instead of reporting them")
 	addFormatFlags(vetCmd)
 }
@@ -0,0 +1,115 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// PackageDiffStatus describes how a package differs between two states of an application
+type PackageDiffStatus string
+
+const (
+	// PackageAdded means the package exists in the newer application only
+	PackageAdded PackageDiffStatus = "added"
+	// PackageRemoved means the package exists in the older application only
+	PackageRemoved PackageDiffStatus = "removed"
+	// PackageChanged means the package has a different version in the newer application
+	PackageChanged PackageDiffStatus = "changed"
+)
+
+// PackageDiff is a package whose version differs between two states of an application
+type PackageDiff struct {
+	Package    string            `json:"package" yaml:"package"`
+	Status     PackageDiffStatus `json:"status" yaml:"status"`
+	OldVersion string            `json:"oldVersion,omitempty" yaml:"oldVersion,omitempty"`
+	NewVersion string            `json:"newVersion,omitempty" yaml:"newVersion,omitempty"`
+	// Changes are the inputs of a changed package which differ, see VersionReport
+	Changes []VersionChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// DependenciesOnly returns true if the package changed only because some of its dependencies did
+func (d PackageDiff) DependenciesOnly() bool {
+	if d.Status != PackageChanged || len(d.Changes) == 0 {
+		return false
+	}
+	for _, c := range d.Changes {
+		if c.Input != "dependency" {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffApplications lists the packages which were added, removed or changed their version between two states of an
+// application, e.g. two Git revisions, sorted by name. Packages with the same version in both are not listed.
+func DiffApplications(prev, cur *Application) ([]PackageDiff, error) {
+	var res []PackageDiff
+	for name, pkg := range cur.Packages {
+		version, err := pkg.Version()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+		prevPkg, exists := prev.Packages[name]
+		if !exists {
+			res = append(res, PackageDiff{Package: name, Status: PackageAdded, NewVersion: version})
+			continue
+		}
+		prevVersion, err := prevPkg.Version()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+		if version == prevVersion {
+			continue
+		}
+
+		report, err := pkg.explainVersion()
+		if err != nil {
+			return nil, err
+		}
+		prevReport, err := prevPkg.explainVersion()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, PackageDiff{
+			Package:    name,
+			Status:     PackageChanged,
+			OldVersion: prevVersion,
+			NewVersion: version,
+			Changes:    report.inputChanges(prevReport),
+		})
+	}
+	for name, pkg := range prev.Packages {
+		if _, exists := cur.Packages[name]; exists {
+			continue
+		}
+		version, err := pkg.Version()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+		res = append(res, PackageDiff{Package: name, Status: PackageRemoved, OldVersion: version})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Package < res[j].Package })
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffApplications(t *testing.T) {
+	load := func(libContent string, pkgs ...string) *Application {
+		dir := t.TempDir()
+		lib := filepath.Join(dir, "lib.txt")
+		err := ioutil.WriteFile(lib, []byte(libContent), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ba := &Application{Origin: dir, Packages: make(map[string]*Package)}
+		libPkg := testPackage(ba, "lib", GenericPackage)
+		libPkg.Sources = []string{lib}
+		ba.Packages[libPkg.FullName()] = libPkg
+		for _, name := range pkgs {
+			p := testPackage(ba, name, GenericPackage, libPkg)
+			ba.Packages[p.FullName()] = p
+		}
+		return ba
+	}
+
+	diff, err := DiffApplications(load("v1", "app", "gone"), load("v2", "app", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		Package          string
+		Status           PackageDiffStatus
+		DependenciesOnly bool
+		Changes          int
+	}
+	var act []summary
+	for _, d := range diff {
+		act = append(act, summary{d.Package, d.Status, d.DependenciesOnly(), len(d.Changes)})
+	}
+	exp := []summary{
+		{"comp:app", PackageChanged, true, 1},
+		{"comp:gone", PackageRemoved, false, 0},
+		{"comp:lib", PackageChanged, false, 1},
+		{"comp:new", PackageAdded, false, 0},
+	}
+	if d := cmp.Diff(exp, act); d != "" {
+		t.Errorf("DiffApplications() mismatch (-want +got):\n%s", d)
+	}
+
+	diff, err = DiffApplications(load("v1", "app"), load("v1", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("identical applications differ: %v", diff)
+	}
+}
@@ -41,7 +41,6 @@ import (
 
 	"github.com/imdario/mergo"
 	"github.com/in-toto/in-toto-golang/in_toto"
-	"github.com/minio/highwayhash"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
@@ -53,12 +52,29 @@ import (
 // Application is the root container of all compoments. All components are named relative
 // to the origin of this application.
 type Application struct {
-	DefaultTarget       string                `yaml:"defaultTarget,omitempty"`
-	ArgumentDefaults    map[string]string     `yaml:"defaultArgs,omitempty"`
-	DefaultVariant      *PackageVariant       `yaml:"defaultVariant,omitempty"`
-	Variants            []*PackageVariant     `yaml:"variants,omitempty"`
-	EnvironmentManifest EnvironmentManifest   `yaml:"environmentManifest,omitempty"`
-	Provenance          ApplicationProvenance `yaml:"provenance,omitempty"`
+	DefaultTarget       string                    `yaml:"defaultTarget,omitempty"`
+	ArgumentDefaults    map[string]string         `yaml:"defaultArgs,omitempty"`
+	DefaultVariant      *PackageVariant           `yaml:"defaultVariant,omitempty"`
+	Variants            []*PackageVariant         `yaml:"variants,omitempty"`
+	EnvironmentManifest EnvironmentManifest       `yaml:"environmentManifest,omitempty"`
+	Provenance          ApplicationProvenance     `yaml:"provenance,omitempty"`
+	RemoteCache         ApplicationRemoteCache    `yaml:"remoteCache,omitempty"`
+	PackageDefaults     PackageDefaults           `yaml:"packageDefaults,omitempty"`
+	Plugins             map[string]*PackagePlugin `yaml:"plugins,omitempty"`
+	ContainerCLI        ContainerCLI              `yaml:"containerCLI,omitempty"`
+	Registries          []RegistryAuth            `yaml:"registries,omitempty"`
+	Vet                 ApplicationVet            `yaml:"vet,omitempty"`
+	PinBaseImages       BaseImagePinning          `yaml:"pinBaseImages,omitempty"`
+	Hooks               BuildHooks                `yaml:"hooks,omitempty"`
+
+	// EnvironmentManifestExclusions drops environment manifest entries from the versions of packages of a given type
+	EnvironmentManifestExclusions map[PackageType][]string `yaml:"environmentManifestExclusions,omitempty"`
+
+	// ContentHash selects the algorithm and key used to hash sources, definitions and the environment manifest
+	ContentHash ContentHash `yaml:"contentHash,omitempty"`
+
+	// EnvInterpolations lists how the ${env:...} references in the APPLICATION.yaml were resolved
+	EnvInterpolations []EnvInterpolation `yaml:"-"`
 
 	Origin          string                `yaml:"-"`
 	Components      map[string]*Component `yaml:"-"`
@@ -79,11 +95,37 @@ type GitInfo struct {
 type ApplicationProvenance struct {
 	Enabled bool `yaml:"enabled"`
 	SLSA    bool `yaml:"slsa"`
+	// SBOM generates SPDX SBOMs for Go, yarn and Docker packages, stores them in the build artifacts and
+	// attaches them to the pushed images
+	SBOM bool `yaml:"sbom"`
+	// Stamp injects the package version, Git commit and build time into Go binaries, package.json files and image labels
+	Stamp bool `yaml:"stamp"`
 
 	KeyPath string `yaml:"key"`
 	key     *in_toto.Key
 }
 
+// ApplicationRemoteCache configures the remote cache backends. Environment variables take precedence over these values.
+type ApplicationRemoteCache struct {
+	Minio MinioConfig `yaml:"minio,omitempty"`
+}
+
+// ApplicationVet configures the vet checks of the application
+type ApplicationVet struct {
+	YarnLockDrift YarnLockDriftPolicy `yaml:"yarnLockDrift,omitempty"`
+}
+
+// YarnLockDriftPolicy configures which version differences of npm dependencies across the
+// yarn.lock files of an application the yarn:lockfile-drift check reports.
+type YarnLockDriftPolicy struct {
+	// Level is the smallest reported difference: major (default), minor or patch
+	Level string `yaml:"level,omitempty"`
+	// Dependencies limits the check to these dependencies. If empty, all shared dependencies are checked.
+	Dependencies []string `yaml:"dependencies,omitempty"`
+	// Ignore lists dependencies which may drift
+	Ignore []string `yaml:"ignore,omitempty"`
+}
+
 // EnvironmentManifest is a collection of environment manifest entries
 type EnvironmentManifest []EnvironmentManifestEntry
 
@@ -100,12 +142,11 @@ func (mf EnvironmentManifest) Write(out io.Writer) error {
 
 // Hash produces the hash of this manifest
 func (mf EnvironmentManifest) Hash() (string, error) {
-	key, err := hex.DecodeString(contentHashKey)
-	if err != nil {
-		return "", err
-	}
+	return mf.hash(ContentHash{})
+}
 
-	hash, err := highwayhash.New(key)
+func (mf EnvironmentManifest) hash(cfg ContentHash) (string, error) {
+	hash, err := cfg.newHash()
 	if err != nil {
 		return "", err
 	}
@@ -127,6 +168,29 @@ func (mf EnvironmentManifest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(res)
 }
 
+// Without returns the manifest without the named entries
+func (mf EnvironmentManifest) Without(names []string) EnvironmentManifest {
+	if len(names) == 0 {
+		return mf
+	}
+
+	res := make(EnvironmentManifest, 0, len(mf))
+	for _, e := range mf {
+		var excluded bool
+		for _, n := range names {
+			if e.Name == n {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
 // EnvironmentManifestEntry represents an entry in the environment manifest
 type EnvironmentManifestEntry struct {
 	Name    string   `yaml:"name"`
@@ -147,7 +211,12 @@ var defaultEnvManifestEntries = map[PackageType]EnvironmentManifest{
 		{Name: "arch", Command: []string{builtinEnvManifestGOARCH}, Builtin: true},
 	},
 	GenericPackage: []EnvironmentManifestEntry{},
-	DockerPackage:  []EnvironmentManifestEntry{
+	// proto packages use either protoc or buf, hence we cannot know which tool version to record
+	ProtoPackage: []EnvironmentManifestEntry{},
+	// plugins report the tools they depend on as version inputs
+	PluginPackage: []EnvironmentManifestEntry{},
+	MetaPackage:   []EnvironmentManifestEntry{},
+	DockerPackage: []EnvironmentManifestEntry{
 		// We do not pull the docker version here as that would make package versions dependent on a connection
 		// to a Docker daemon. As the environment manifest is resolved on application load one would always need
 		// a connection to a Docker daemon just to run e.g. Bhojpur GoRPA collect.
@@ -183,7 +252,7 @@ func (ba *Application) ShouldIgnoreSource(path string) bool {
 }
 
 // FindNestedApplications loads nested applications
-func FindNestedApplications(path string, args Arguments, variant string) (res Application, err error) {
+func FindNestedApplications(path string, args Arguments, variant string, opts ...ApplicationOption) (res Application, err error) {
 	rootBA, err := loadApplicationYAML(path)
 	if err != nil {
 		return Application{}, err
@@ -234,7 +303,7 @@ func FindNestedApplications(path string, args Arguments, variant string) (res Ap
 				}
 			},
 			ArgumentDefaults: rootBA.ArgumentDefaults,
-		})
+		}, opts...)
 		if err != nil {
 			return res, err
 		}
@@ -293,11 +362,26 @@ func loadApplicationYAML(path string) (Application, error) {
 	if err != nil {
 		return Application{}, err
 	}
-	var application Application
-	err = yaml.Unmarshal(fc, &application)
+	var doc yaml.Node
+	err = yaml.Unmarshal(fc, &doc)
 	if err != nil {
 		return Application{}, err
 	}
+	interpolations, err := interpolateEnv(&doc, os.LookupEnv)
+	if err != nil {
+		return Application{}, xerrors.Errorf("%s: %w", root, err)
+	}
+	var application Application
+	if len(doc.Content) > 0 {
+		err = doc.Decode(&application)
+		if err != nil {
+			return Application{}, err
+		}
+	}
+	for _, ip := range interpolations {
+		log.WithField("field", ip.Field).WithField("variable", ip.Variable).WithField("value", ip.Value).WithField("default", ip.Default).Debug("interpolated APPLICATION.yaml")
+	}
+	application.EnvInterpolations = interpolations
 	application.Origin, err = filepath.Abs(filepath.Dir(root))
 	if err != nil {
 		return Application{}, err
@@ -309,16 +393,89 @@ type loadApplicationOpts struct {
 	PrelinkModifier   func(map[string]*Package)
 	ArgumentDefaults  map[string]string
 	ProvenanceKeyPath string
+	GoBuildProfile    GoBuildProfile
+}
+
+// ApplicationOption configures how an application is loaded
+type ApplicationOption func(*loadApplicationOpts)
+
+// GoBuildProfile configures build tags and the race detector for all Go packages of an application
+type GoBuildProfile struct {
+	BuildTags []string
+	Race      bool
 }
 
-func loadApplication(ctx context.Context, path string, args Arguments, variant string, opts *loadApplicationOpts) (Application, error) {
+// WithGoBuildProfile applies the build tags and race detector setting to all Go packages in addition to their own configuration
+func WithGoBuildProfile(profile GoBuildProfile) ApplicationOption {
+	return func(opts *loadApplicationOpts) {
+		opts.GoBuildProfile = profile
+	}
+}
+
+// apply adds the profile to a Go package config. The result is independent of the order in which tags are given.
+func (profile GoBuildProfile) apply(cfg GoPkgConfig) GoPkgConfig {
+	cfg.Race = cfg.Race || profile.Race
+	if len(profile.BuildTags) == 0 {
+		return cfg
+	}
+
+	idx := make(map[string]struct{}, len(cfg.BuildTags)+len(profile.BuildTags))
+	tags := make([]string, 0, len(cfg.BuildTags)+len(profile.BuildTags))
+	for _, tag := range append(append([]string{}, cfg.BuildTags...), profile.BuildTags...) {
+		if _, exists := idx[tag]; exists {
+			continue
+		}
+		idx[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	cfg.BuildTags = tags
+	return cfg
+}
+
+func loadApplication(ctx context.Context, path string, args Arguments, variant string, opts *loadApplicationOpts, modifiers ...ApplicationOption) (Application, error) {
 	ctx, task := trace.NewTask(ctx, "loadApplication")
 	defer task.End()
 
+	for _, mod := range modifiers {
+		mod(opts)
+	}
+
 	application, err := loadApplicationYAML(path)
 	if err != nil {
 		return Application{}, err
 	}
+	err = application.ContainerCLI.Validate()
+	if err != nil {
+		return Application{}, err
+	}
+	err = validateRegistries(application.Registries)
+	if err != nil {
+		return Application{}, err
+	}
+	if pin := os.Getenv(EnvvarPinBaseImages); pin != "" {
+		application.PinBaseImages = BaseImagePinning(pin)
+	}
+	err = application.PinBaseImages.Validate()
+	if err != nil {
+		return Application{}, err
+	}
+	err = application.ContentHash.Validate()
+	if err != nil {
+		return Application{}, err
+	}
+	err = application.Hooks.Validate()
+	if err != nil {
+		return Application{}, err
+	}
+
+	for name, plugin := range application.Plugins {
+		plugin.Name = name
+		err = plugin.resolve(&application)
+		if err != nil {
+			return Application{}, err
+		}
+	}
 
 	if variant != "" {
 		for _, vnt := range application.Variants {
@@ -394,6 +551,17 @@ func loadApplication(ctx context.Context, path string, args Arguments, variant s
 		for _, pkg := range comp.Packages {
 			application.Packages[pkg.FullName()] = pkg
 			packageTypesUsed[pkg.Type] = struct{}{}
+
+			if cfg, ok := pkg.Config.(GoPkgConfig); ok {
+				pkg.Config = opts.GoBuildProfile.apply(cfg)
+			}
+			if cfg, ok := pkg.Config.(YarnPkgConfig); ok && cfg.Node == NodeVersionAuto {
+				cfg.Node, err = resolveNodeVersion(comp.Origin)
+				if err != nil {
+					return Application{}, xerrors.Errorf("%s: %w", pkg.FullName(), err)
+				}
+				pkg.Config = cfg
+			}
 		}
 		for _, script := range comp.Scripts {
 			application.Scripts[script.FullName()] = script
@@ -402,7 +570,13 @@ func loadApplication(ctx context.Context, path string, args Arguments, variant s
 
 	// with all packages loaded we can compute the env manifest, becuase now we know which package types are actually
 	// used, hence know the default env manifest entries.
-	application.EnvironmentManifest, err = buildEnvironmentManifest(application.EnvironmentManifest, packageTypesUsed)
+	envmf := append(goToolchainEnvManifestEntries(application.Packages), nodeToolchainEnvManifestEntries(application.Packages)...)
+	envmf = append(envmf, application.EnvironmentManifest...)
+	application.EnvironmentManifest, err = buildEnvironmentManifest(envmf, packageTypesUsed)
+	if err != nil {
+		return Application{}, err
+	}
+	err = validateEnvironmentManifestExclusions(application.EnvironmentManifestExclusions, application.EnvironmentManifest)
 	if err != nil {
 		return Application{}, err
 	}
@@ -448,6 +622,14 @@ func loadApplication(ctx context.Context, path string, args Arguments, variant s
 		return application, xerrors.Errorf("dependency cycle found: %s", strings.Join(c, " -> "))
 	}
 
+	// the digests of the base images are part of the version, hence we must resolve them before computing any version
+	if application.PinBaseImages.enabled() {
+		err = resolveBaseImages(&application)
+		if err != nil {
+			return application, err
+		}
+	}
+
 	// at this point all packages are fully loaded and we can compute the version, as well as resolve builtin variables
 	for _, pkg := range application.Packages {
 		err = pkg.resolveBuiltinVariables()
@@ -543,6 +725,11 @@ func buildEnvironmentManifest(entries EnvironmentManifest, pkgtpes map[PackageTy
 				e.Value = runtime.GOARCH
 			case builtinEnvManifestGOOS:
 				e.Value = runtime.GOOS
+			case builtinEnvManifestGoToolchain:
+				// pinned toolchains are downloaded on demand, hence we know their version without running them
+				e.Value = fmt.Sprintf("go version go%s %s/%s", e.Command[1], runtime.GOOS, runtime.GOARCH)
+			case builtinEnvManifestNodeToolchain:
+				e.Value = "v" + e.Command[1]
 			}
 			res = append(res, e)
 			continue
@@ -567,10 +754,28 @@ func buildEnvironmentManifest(entries EnvironmentManifest, pkgtpes map[PackageTy
 	return
 }
 
+// validateEnvironmentManifestExclusions ensures exclusions refer to known package types, and warns about
+// exclusions which do not match any entry of the manifest.
+func validateEnvironmentManifestExclusions(exclusions map[PackageType][]string, mf EnvironmentManifest) error {
+	for tpe, names := range exclusions {
+		if _, ok := defaultEnvManifestEntries[tpe]; !ok || tpe == "" {
+			return xerrors.Errorf("environmentManifestExclusions: unknown package type %q", tpe)
+		}
+		for _, n := range names {
+			if len(mf.Without([]string{n})) == len(mf) {
+				log.WithField("type", tpe).WithField("entry", n).Warn("environmentManifestExclusions: entry is not part of the environment manifest")
+				continue
+			}
+			log.WithField("type", tpe).WithField("entry", n).Debug("excluding environment manifest entry from package versions")
+		}
+	}
+	return nil
+}
+
 // FindApplication looks for a APPLICATION.yaml file within the path. If multiple such files are found,
 // an error is returned.
-func FindApplication(path string, args Arguments, variant, provenanceKey string) (Application, error) {
-	return loadApplication(context.Background(), path, args, variant, &loadApplicationOpts{ProvenanceKeyPath: provenanceKey})
+func FindApplication(path string, args Arguments, variant, provenanceKey string, opts ...ApplicationOption) (Application, error) {
+	return loadApplication(context.Background(), path, args, variant, &loadApplicationOpts{ProvenanceKeyPath: provenanceKey}, opts...)
 }
 
 // discoverComponents discovers components in a Application
@@ -697,6 +902,7 @@ func loadComponent(ctx context.Context, application *Application, path string, a
 		comp    Component
 		rawcomp struct {
 			Packages []yaml.Node
+			Scripts  []yaml.Node
 		}
 	)
 	err = yaml.Unmarshal(rfc, &comp)
@@ -731,10 +937,41 @@ func loadComponent(ctx context.Context, application *Application, path string, a
 			pkg.Type = YarnPackage
 		}
 
-		pkg.Definition, err = yaml.Marshal(&rawcomp.Packages[i])
+		pkg.Definition, err = yaml.Marshal(versionRelevantDefinition(&rawcomp.Packages[i]))
 		if err != nil {
 			return comp, xerrors.Errorf("%s: %w", comp.Name, err)
 		}
+		if !comp.Defaults.IsEmpty() {
+			// the defaults are part of the package definition and must influence its version
+			defs, err := yaml.Marshal(struct {
+				Defaults ComponentDefaults `yaml:"defaults"`
+			}{comp.Defaults})
+			if err != nil {
+				return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+			}
+			pkg.Definition = append(pkg.Definition, defs...)
+
+			err = comp.Defaults.apply(pkg)
+			if err != nil {
+				return comp, xerrors.Errorf("%s: %s: %w", comp.Name, pkg.Name, err)
+			}
+		}
+		typeDefaults := application.PackageDefaults[pkg.Type]
+		if typeDefaults != nil {
+			// like the component defaults, the application's defaults for this package type influence the package version
+			defs, err := yaml.Marshal(struct {
+				PackageDefaults *PackageTypeDefaults `yaml:"packageDefaults"`
+			}{typeDefaults})
+			if err != nil {
+				return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+			}
+			pkg.Definition = append(pkg.Definition, defs...)
+
+			err = mergeDefaultEnv(pkg, typeDefaults.Environment)
+			if err != nil {
+				return comp, xerrors.Errorf("%s: %s: %w", comp.Name, pkg.Name, err)
+			}
+		}
 
 		pkg.originalSources = pkg.Sources
 		pkg.Sources, err = resolveSources(pkg.C.W, pkg.C.Origin, pkg.Sources, false)
@@ -761,6 +998,18 @@ func loadComponent(ctx context.Context, application *Application, path string, a
 
 			completeSources[fn] = struct{}{}
 		}
+		if cfg, ok := pkg.Config.(optionalSourcesConfig); ok {
+			for _, src := range cfg.OptionalSources() {
+				fn, err := filepath.Abs(filepath.Join(comp.Origin, src))
+				if err != nil {
+					return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+				}
+				if _, err := os.Stat(fn); err != nil {
+					continue
+				}
+				completeSources[fn] = struct{}{}
+			}
+		}
 		if vnt := pkg.C.W.SelectedVariant; vnt != nil {
 			incl, excl, err := vnt.ResolveSources(pkg.C.W, pkg.C.Origin)
 			if err != nil {
@@ -825,9 +1074,26 @@ func loadComponent(ctx context.Context, application *Application, path string, a
 				return comp, xerrors.Errorf("%s: %w", comp.Name, err)
 			}
 		}
+
+		// apply the application's package defaults beneath the package and variant config
+		if typeDefaults != nil {
+			if defcfg, ok := typeDefaults.Config(); ok {
+				err = mergeConfig(pkg, defcfg)
+				if err != nil {
+					return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+				}
+			}
+		}
+
+		if pkg.Type == PluginPackage {
+			err = pkg.resolvePluginVersionInputs()
+			if err != nil {
+				return comp, xerrors.Errorf("%s: %w", pkg.FullName(), err)
+			}
+		}
 	}
 
-	for _, scr := range comp.Scripts {
+	for i, scr := range comp.Scripts {
 		scr.C = &comp
 
 		// fill in defaults
@@ -846,6 +1112,35 @@ func loadComponent(ctx context.Context, application *Application, path string, a
 
 			scr.Dependencies[idx] = comp.Name + dep
 		}
+		// make all layout entries full qualified
+		for dep, loc := range scr.Layout {
+			if !strings.HasPrefix(dep, ":") {
+				continue
+			}
+
+			delete(scr.Layout, dep)
+			scr.Layout[comp.Name+dep] = loc
+		}
+
+		if len(scr.Outputs) == 0 {
+			continue
+		}
+
+		// scripts with outputs can be depended upon, hence are built like any other package
+		def, err := yaml.Marshal(&rawcomp.Scripts[i])
+		if err != nil {
+			return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+		}
+		pkg, err := scr.newOutputPackage(def)
+		if err != nil {
+			return comp, xerrors.Errorf("%s: %w", comp.Name, err)
+		}
+		for _, p := range comp.Packages {
+			if p.Name == pkg.Name {
+				return comp, xerrors.Errorf("%s: script %s has outputs, but there's a package of the same name", comp.Name, scr.Name)
+			}
+		}
+		comp.Packages = append(comp.Packages, pkg)
 	}
 
 	return comp, nil
@@ -901,12 +1196,56 @@ func mergeConfig(pkg *Package, src PackageConfig) error {
 			return err
 		}
 		pkg.Config = dst
+	case ProtoPkgConfig:
+		dst := pkg.Config.(ProtoPkgConfig)
+		in, ok := src.(ProtoPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
+	case PluginPkgConfig:
+		dst := pkg.Config.(PluginPkgConfig)
+		in, ok := src.(PluginPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
+	case MetaPkgConfig:
+		dst := pkg.Config.(MetaPkgConfig)
+		in, ok := src.(MetaPkgConfig)
+		if !ok {
+			return xerrors.Errorf("cannot merge %s onto %s", reflect.TypeOf(src).String(), reflect.TypeOf(dst).String())
+		}
+		err := mergo.Merge(&dst, in)
+		if err != nil {
+			return err
+		}
+		pkg.Config = dst
 	default:
 		return xerrors.Errorf("unknown config type %s", reflect.ValueOf(pkg.Config).Elem().Type().String())
 	}
 	return nil
 }
 
+// mergeDefaultEnv merges environment variables beneath those of the package, i.e. the package's own values take precedence
+func mergeDefaultEnv(pkg *Package, defaults []string) error {
+	if len(defaults) == 0 {
+		return nil
+	}
+
+	env := pkg.Environment
+	pkg.Environment = append([]string{}, defaults...)
+	return mergeEnv(pkg, env)
+}
+
 func mergeEnv(pkg *Package, src []string) error {
 	env := make(map[string]string, len(pkg.Environment))
 	for _, set := range [][]string{pkg.Environment, src} {
@@ -927,3 +1266,62 @@ func mergeEnv(pkg *Package, src []string) error {
 	}
 	return nil
 }
+
+// versionIrrelevantFields are the fields of a package definition which change how a package is built, but not what
+// is built. They are no part of the package definition used for the version. Nested fields are separated by a dot.
+var versionIrrelevantFields = []string{
+	"resources.memory",
+	"resources.cpus",
+	"resources.pids",
+	"resources.exclusive",
+	"testRetry",
+	"hooks",
+	"timeout",
+}
+
+// versionRelevantDefinition returns a copy of the raw package definition without the versionIrrelevantFields.
+// Mappings which are empty once those fields are removed are removed as well.
+func versionRelevantDefinition(node *yaml.Node) *yaml.Node {
+	return withoutYAMLFields(node, "", versionIrrelevantFields)
+}
+
+func withoutYAMLFields(node *yaml.Node, prefix string, fields []string) *yaml.Node {
+	res := *node
+	if node.Kind != yaml.MappingNode && node.Kind != yaml.DocumentNode {
+		return &res
+	}
+
+	res.Content = make([]*yaml.Node, 0, len(node.Content))
+	if node.Kind == yaml.DocumentNode {
+		for _, c := range node.Content {
+			res.Content = append(res.Content, withoutYAMLFields(c, prefix, fields))
+		}
+		return &res
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var (
+			key, val = node.Content[i], node.Content[i+1]
+			path     = prefix + key.Value
+			removed  bool
+			nested   bool
+		)
+		for _, f := range fields {
+			if f == path {
+				removed = true
+			} else if strings.HasPrefix(f, path+".") {
+				nested = true
+			}
+		}
+		if removed {
+			continue
+		}
+		if nested && val.Kind == yaml.MappingNode {
+			val = withoutYAMLFields(val, path+".", fields)
+			if len(val.Content) == 0 {
+				continue
+			}
+		}
+		res.Content = append(res.Content, key, val)
+	}
+	return &res
+}
@@ -302,6 +302,101 @@ func TestPackageDefinition(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "package defaults change version",
+			Layouts: []map[string]string{
+				{
+					"APPLICATION.yaml": "",
+					"pkg1/BUILD.yaml":  "packages:\n- name: foo\n  type: generic\n  srcs:\n  - \"doesNotExist\"",
+				},
+				{
+					"APPLICATION.yaml": "packageDefaults:\n  generic:\n    env:\n    - FOO=bar\n    config:\n      commands:\n      - [\"echo\"]",
+				},
+			},
+			Tester: []func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest{
+				func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest {
+					return &CommandFixtureTest{
+						T:    t,
+						Args: []string{"describe", "-a", loc, "-o", "json", "pkg1:foo"},
+						Eval: func(t *testing.T, stdout, stderr string) {
+							var dest pkginfo
+							err := json.Unmarshal([]byte(stdout), &dest)
+							if err != nil {
+								fmt.Println(stdout)
+								t.Fatal(err)
+							}
+							state["v"] = dest.Metadata.Version
+						},
+					}
+				},
+				func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest {
+					return &CommandFixtureTest{
+						T:    t,
+						Args: []string{"describe", "-a", loc, "-o", "json", "pkg1:foo"},
+						Eval: func(t *testing.T, stdout, stderr string) {
+							var dest pkginfo
+							err := json.Unmarshal([]byte(stdout), &dest)
+							if err != nil {
+								fmt.Println(stdout)
+								t.Fatal(err)
+							}
+							if state["v"] == dest.Metadata.Version {
+								t.Errorf("package defaults change did not change version")
+							}
+						},
+					}
+				},
+			},
+		},
+		{
+			Name: "buf.lock changes version",
+			Layouts: []map[string]string{
+				{
+					"APPLICATION.yaml":  "",
+					"pkg1/BUILD.yaml":   "packages:\n- name: foo\n  type: proto\n  srcs:\n  - \"*.proto\"\n  config:\n    generator: buf",
+					"pkg1/buf.yaml":     "version: v1",
+					"pkg1/buf.gen.yaml": "version: v1",
+					"pkg1/api.proto":    "syntax = \"proto3\";",
+				},
+				{
+					"pkg1/buf.lock": "version: v1",
+				},
+			},
+			Tester: []func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest{
+				func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest {
+					return &CommandFixtureTest{
+						T:    t,
+						Args: []string{"describe", "-a", loc, "-o", "json", "pkg1:foo"},
+						Eval: func(t *testing.T, stdout, stderr string) {
+							var dest pkginfo
+							err := json.Unmarshal([]byte(stdout), &dest)
+							if err != nil {
+								fmt.Println(stdout)
+								t.Fatal(err)
+							}
+							state["v"] = dest.Metadata.Version
+						},
+					}
+				},
+				func(t *testing.T, loc string, state map[string]string) *CommandFixtureTest {
+					return &CommandFixtureTest{
+						T:    t,
+						Args: []string{"describe", "-a", loc, "-o", "json", "pkg1:foo"},
+						Eval: func(t *testing.T, stdout, stderr string) {
+							var dest pkginfo
+							err := json.Unmarshal([]byte(stdout), &dest)
+							if err != nil {
+								fmt.Println(stdout)
+								t.Fatal(err)
+							}
+							if state["v"] == dest.Metadata.Version {
+								t.Errorf("adding buf.lock did not change version")
+							}
+						},
+					}
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,139 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ByteSize is a number of bytes which prints in human readable form
+type ByteSize int64
+
+// String prints the size using binary prefixes, e.g. 1.5 MiB
+func (b ByteSize) String() string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", int64(b))
+	}
+	div, exp := int64(unit), 0
+	for n := int64(b) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// ArtifactSummary describes what a build artifact contains
+type ArtifactSummary struct {
+	Artifact         string   `json:"artifact" yaml:"artifact"`
+	CompressedSize   ByteSize `json:"compressedSize" yaml:"compressedSize"`
+	UncompressedSize ByteSize `json:"uncompressedSize" yaml:"uncompressedSize"`
+	Files            int      `json:"files" yaml:"files"`
+	// Entries are the top-level files and directories of the artifact, biggest first
+	Entries    []ArtifactEntry `json:"entries" yaml:"entries"`
+	BuildInfo  bool            `json:"buildInfo" yaml:"buildInfo"`
+	Provenance bool            `json:"provenance" yaml:"provenance"`
+	SBOM       bool            `json:"sbom" yaml:"sbom"`
+}
+
+// ArtifactEntry is a top-level file or directory of a build artifact
+type ArtifactEntry struct {
+	Name string `json:"name" yaml:"name"`
+	// Size is the uncompressed size of the file, or of all files below the directory
+	Size  ByteSize `json:"size" yaml:"size"`
+	Files int      `json:"files" yaml:"files"`
+	Dir   bool     `json:"dir,omitempty" yaml:"dir,omitempty"`
+}
+
+// CompressionRatio is the uncompressed size divided by the compressed size of the artifact
+func (s *ArtifactSummary) CompressionRatio() float64 {
+	if s.CompressedSize == 0 {
+		return 0
+	}
+	return float64(s.UncompressedSize) / float64(s.CompressedSize)
+}
+
+// SummarizeArtifact reads a build artifact and summarizes its content without extracting it
+func SummarizeArtifact(fn string) (*ArtifactSummary, error) {
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+	res := &ArtifactSummary{
+		Artifact:       fn,
+		CompressedSize: ByteSize(stat.Size()),
+	}
+
+	entries := make(map[string]*ArtifactEntry)
+	err = walkArtifact(fn, func(hdr *tar.Header, r io.Reader) error {
+		name := strings.TrimPrefix(strings.TrimPrefix(hdr.Name, "./"), "/")
+		name = strings.TrimSuffix(name, "/")
+		if name == "" || name == "." {
+			return nil
+		}
+		switch name {
+		case buildInfoFilename:
+			res.BuildInfo = true
+		case provenanceBundleFilename:
+			res.Provenance = true
+		case sbomFilename:
+			res.SBOM = true
+		}
+
+		segs := strings.SplitN(name, "/", 2)
+		e, ok := entries[segs[0]]
+		if !ok {
+			e = &ArtifactEntry{Name: segs[0]}
+			entries[segs[0]] = e
+		}
+		if len(segs) > 1 || hdr.Typeflag == tar.TypeDir {
+			e.Dir = true
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			return nil
+		}
+		e.Size += ByteSize(hdr.Size)
+		e.Files++
+		res.UncompressedSize += ByteSize(hdr.Size)
+		res.Files++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Entries = make([]ArtifactEntry, 0, len(entries))
+	for _, e := range entries {
+		res.Entries = append(res.Entries, *e)
+	}
+	sort.Slice(res.Entries, func(i, j int) bool {
+		if res.Entries[i].Size != res.Entries[j].Size {
+			return res.Entries[i].Size > res.Entries[j].Size
+		}
+		return res.Entries[i].Name < res.Entries[j].Name
+	})
+	return res, nil
+}
@@ -0,0 +1,102 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSummarizeArtifact(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "artifact.tar.gz")
+	err := writeArtifact(fn, func(out *tar.Writer) error {
+		files := []struct {
+			Name    string
+			Content string
+		}{
+			{"./", ""},
+			{"./" + buildInfoFilename, "{}"},
+			{"./" + provenanceBundleFilename, "{}\n{}\n"},
+			{"./node_modules/", ""},
+			{"./node_modules/a/index.js", "module.exports = 42\n"},
+			{"./node_modules/b/index.js", "module.exports = 1\n"},
+			{"./dist/", ""},
+			{"./dist/bundle.js", "console.log(42)\n"},
+		}
+		for _, f := range files {
+			hdr := &tar.Header{Name: f.Name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(f.Content))}
+			if f.Content == "" {
+				hdr = &tar.Header{Name: f.Name, Mode: 0755, Typeflag: tar.TypeDir}
+			}
+			err := out.WriteHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write([]byte(f.Content))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	act, err := SummarizeArtifact(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := &ArtifactSummary{
+		Artifact:         fn,
+		UncompressedSize: 63,
+		Files:            5,
+		Entries: []ArtifactEntry{
+			{Name: "node_modules", Size: 39, Files: 2, Dir: true},
+			{Name: "dist", Size: 16, Files: 1, Dir: true},
+			{Name: provenanceBundleFilename, Size: 6, Files: 1},
+			{Name: buildInfoFilename, Size: 2, Files: 1},
+		},
+		BuildInfo:  true,
+		Provenance: true,
+	}
+	if diff := cmp.Diff(expectation, act, cmpopts.IgnoreFields(ArtifactSummary{}, "CompressedSize")); diff != "" {
+		t.Errorf("SummarizeArtifact() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := map[ByteSize]string{
+		12:                     "12 B",
+		1024:                   "1.0 KiB",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024 * 1024: "5.0 GiB",
+	}
+	for in, expectation := range tests {
+		if act := in.String(); act != expectation {
+			t.Errorf("ByteSize(%d).String() = %s, expected %s", int64(in), act, expectation)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// EnvvarPinBaseImages overrides the pinBaseImages setting in the APPLICATION.yaml
+const EnvvarPinBaseImages = "GORPA_PIN_BASE_IMAGES"
+
+// BaseImagePinning determines whether the base images of Docker packages are pinned to digests
+type BaseImagePinning string
+
+const (
+	// BaseImagePinningOff uses the base images as referenced in the Dockerfile
+	BaseImagePinningOff BaseImagePinning = "off"
+	// BaseImagePinningResolve resolves the base images to their digests when the application is loaded and
+	// makes the digests part of the package version. The build still uses the Dockerfile as is.
+	BaseImagePinningResolve BaseImagePinning = "resolve"
+	// BaseImagePinningRewrite resolves the base images like BaseImagePinningResolve and builds from a Dockerfile
+	// which references the base images by the resolved digests, s.t. the build uses exactly the versioned images.
+	BaseImagePinningRewrite BaseImagePinning = "rewrite"
+)
+
+// Validate returns an error if the pinning mode is not supported
+func (m BaseImagePinning) Validate() error {
+	switch m {
+	case BaseImagePinningOff, BaseImagePinningResolve, BaseImagePinningRewrite, "":
+		return nil
+	default:
+		return xerrors.Errorf("unsupported base image pinning %s: must be one of %s, %s or %s", m, BaseImagePinningOff, BaseImagePinningResolve, BaseImagePinningRewrite)
+	}
+}
+
+func (m BaseImagePinning) enabled() bool {
+	return m == BaseImagePinningResolve || m == BaseImagePinningRewrite
+}
+
+var dockerfileVarRef = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+
+// dockerfileFrom is a FROM instruction of a Dockerfile
+type dockerfileFrom struct {
+	// Line is the index of the line the instruction is on
+	Line int
+	// Image is the image token as written in the Dockerfile
+	Image string
+	// Ref is the image reference with all build args substituted
+	Ref string
+}
+
+// parseBaseImages finds the FROM instructions of a Dockerfile which reference an image by tag, i.e. neither a previous
+// stage, scratch nor an image which is pinned already. Build args override the defaults of ARGs declared before the
+// first FROM. Images which reference undefined build args are skipped with a warning.
+func parseBaseImages(dockerfile []byte, buildArgs map[string]string) ([]dockerfileFrom, error) {
+	var (
+		args     = make(map[string]string)
+		stages   = make(map[string]struct{})
+		seenFrom bool
+		res      []dockerfileFrom
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for i := 0; scanner.Scan(); i++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if seenFrom {
+				continue
+			}
+			segs := strings.SplitN(fields[1], "=", 2)
+			if v, ok := buildArgs[segs[0]]; ok {
+				args[segs[0]] = v
+			} else if len(segs) == 2 {
+				args[segs[0]] = strings.Trim(segs[1], `"`)
+			}
+		case "FROM":
+			seenFrom = true
+			fields = fields[1:]
+			for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+				fields = fields[1:]
+			}
+			if len(fields) == 0 {
+				return nil, xerrors.Errorf("line %d: FROM without image", i+1)
+			}
+
+			img := fields[0]
+			var unresolved bool
+			ref := dockerfileVarRef.ReplaceAllStringFunc(img, func(v string) string {
+				val, ok := args[dockerfileVarRef.FindStringSubmatch(v)[1]]
+				if !ok {
+					unresolved = true
+				}
+				return val
+			})
+			_, isStage := stages[strings.ToLower(ref)]
+			if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+				stages[strings.ToLower(fields[2])] = struct{}{}
+			}
+
+			if unresolved {
+				log.WithField("image", img).Warn("base image references an undefined build arg - cannot pin it")
+				continue
+			}
+			if isStage || ref == "scratch" || strings.Contains(ref, "@") {
+				continue
+			}
+			res = append(res, dockerfileFrom{Line: i, Image: img, Ref: ref})
+		}
+	}
+	return res, scanner.Err()
+}
+
+// pinDockerfile replaces the base images of the FROM instructions with their digests
+func pinDockerfile(dockerfile []byte, froms []dockerfileFrom, digests map[string]string) []byte {
+	lines := strings.Split(string(dockerfile), "\n")
+	for _, from := range froms {
+		digest, ok := digests[from.Ref]
+		if !ok || from.Line >= len(lines) {
+			continue
+		}
+		lines[from.Line] = strings.Replace(lines[from.Line], from.Image, from.Ref+"@"+digest, 1)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// parseImagetoolsDigest extracts the digest from the output of "docker buildx imagetools inspect"
+func parseImagetoolsDigest(out []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "Digest:" {
+			return fields[1], nil
+		}
+	}
+	return "", xerrors.Errorf("no digest found")
+}
+
+// resolveImageDigest resolves an image reference to the digest of its manifest (list) in the registry
+func resolveImageDigest(ref string, env []string) (string, error) {
+	cmd := exec.Command("docker", "buildx", "imagetools", "inspect", ref)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", xerrors.Errorf("cannot inspect %s: %w", ref, err)
+	}
+	digest, err := parseImagetoolsDigest(out)
+	if err != nil {
+		return "", xerrors.Errorf("cannot inspect %s: %w", ref, err)
+	}
+	return digest, nil
+}
+
+// resolveBaseImages resolves the base images of all Docker packages of the application to their digests.
+// Packages sharing a base image share the resolution.
+func resolveBaseImages(application *Application) error {
+	var (
+		froms = make(map[*Package][]dockerfileFrom)
+		refs  = make(map[string]struct{})
+	)
+	for _, p := range application.Packages {
+		cfg, ok := p.Config.(DockerPkgConfig)
+		if !ok || cfg.Dockerfile == "" {
+			continue
+		}
+		fc, err := ioutil.ReadFile(filepath.Join(p.C.Origin, cfg.Dockerfile))
+		if os.IsNotExist(err) {
+			// the build reports the missing Dockerfile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f, err := parseBaseImages(fc, cfg.BuildArgs)
+		if err != nil {
+			return xerrors.Errorf("%s: cannot parse %s: %w", p.FullName(), cfg.Dockerfile, err)
+		}
+		froms[p] = f
+		for _, from := range f {
+			refs[from.Ref] = struct{}{}
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var env []string
+	if len(application.Registries) > 0 {
+		dir, err := ioutil.TempDir("", "gorpa-registries-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		env, err = writeRegistryConfig(dir, application.Registries)
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		digests = make(map[string]string, len(refs))
+		errs    []string
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		limit   = make(chan struct{}, 8)
+	)
+	for ref := range refs {
+		wg.Add(1)
+		go func(ref string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			digest, err := resolveImageDigest(ref, env)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err.Error())
+				return
+			}
+			digests[ref] = digest
+			log.WithField("image", ref).WithField("digest", digest).Debug("resolved base image")
+		}(ref)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return xerrors.Errorf("cannot resolve base images:\n%s", strings.Join(errs, "\n"))
+	}
+
+	for p, f := range froms {
+		p.baseImages = make(map[string]string, len(f))
+		p.baseImageFroms = f
+		for _, from := range f {
+			p.baseImages[from.Ref] = digests[from.Ref]
+		}
+	}
+	return nil
+}
+
+// baseImageManifest produces the version manifest entries of the pinned base images of a package
+func (p *Package) baseImageManifest() []string {
+	res := make([]string, 0, len(p.baseImages))
+	for ref, digest := range p.baseImages {
+		res = append(res, fmt.Sprintf("baseImage %s@%s\n", ref, digest))
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,85 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testPinnedDockerfile = `ARG GO_VERSION=1.16
+ARG DISTRO
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS builder
+RUN go build ./...
+
+FROM builder AS test
+FROM scratch AS empty
+FROM alpine:3.15@sha256:21a3deaa0d32a8057914f36584b5288d2e5ecc984380bc0118285c70fa8c9300
+FROM ${DISTRO}:latest
+FROM gcr.io/distroless/static
+COPY --from=builder /app /app
+`
+
+func TestParseBaseImages(t *testing.T) {
+	act, err := parseBaseImages([]byte(testPinnedDockerfile), map[string]string{"GO_VERSION": "1.17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := []dockerfileFrom{
+		{Line: 2, Image: "golang:${GO_VERSION}", Ref: "golang:1.17"},
+		{Line: 9, Image: "gcr.io/distroless/static", Ref: "gcr.io/distroless/static"},
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("parseBaseImages() mismatch (-want +got):\n%s", diff)
+	}
+
+	pinned := pinDockerfile([]byte(testPinnedDockerfile), act, map[string]string{
+		"golang:1.17":              "sha256:aaaa",
+		"gcr.io/distroless/static": "sha256:bbbb",
+	})
+	act, err = parseBaseImages(pinned, map[string]string{"GO_VERSION": "1.17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(act) != 0 {
+		t.Errorf("pinned Dockerfile still has unpinned base images: %v\n%s", act, pinned)
+	}
+}
+
+func TestParseImagetoolsDigest(t *testing.T) {
+	out := []byte(`Name:      docker.io/library/alpine:3.15
+MediaType: application/vnd.docker.distribution.manifest.list.v2+json
+Digest:    sha256:21a3deaa0d32a8057914f36584b5288d2e5ecc984380bc0118285c70fa8c9300
+
+Manifests:
+  Name:      docker.io/library/alpine:3.15@sha256:e7d88de73db3d3fd9b2d63aa7f447a10fd0220b7cbf39803c803f2af9ba256b3
+  MediaType: application/vnd.docker.distribution.manifest.v2+json
+  Platform:  linux/amd64
+`)
+	act, err := parseImagetoolsDigest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "sha256:21a3deaa0d32a8057914f36584b5288d2e5ecc984380bc0118285c70fa8c9300"; act != exp {
+		t.Errorf("parseImagetoolsDigest() = %s, expected %s", act, exp)
+	}
+}
@@ -22,7 +22,6 @@ package engine
 
 import (
 	"archive/tar"
-	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -35,10 +34,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhojpur/gorpa/pkg/doublestar"
 	"github.com/bhojpur/gorpa/pkg/gokart"
 	"github.com/in-toto/in-toto-golang/in_toto"
 	log "github.com/sirupsen/logrus"
@@ -66,6 +68,8 @@ const (
 	PackageBuilding PackageBuildStatus = "building"
 	// PackageBuilt means the package has been built already
 	PackageBuilt PackageBuildStatus = "built"
+	// PackageSkipped means the package is not built because it was filtered from the build
+	PackageSkipped PackageBuildStatus = "skipped"
 )
 
 type buildContext struct {
@@ -76,10 +80,35 @@ type buildContext struct {
 
 	mu                 sync.Mutex
 	newlyBuiltPackages map[string]*Package
+	// failures are the packages whose build failed, see recordFailure
+	failures map[*Package]error
 
 	pkgLockCond *sync.Cond
 	pkgLocks    map[string]struct{}
-	buildLimit  *semaphore.Weighted
+	buildLimit  *buildScheduler
+	pushLimit   *semaphore.Weighted
+	// goToolchainMu serialises the download of pinned Go toolchains
+	goToolchainMu sync.Mutex
+	// nodeToolchainMu serialises the download of pinned Node.js versions
+	nodeToolchainMu sync.Mutex
+	// lintSuffix is the suffix of the lint cache markers, see goLintCacheSuffix
+	lintSuffixOnce sync.Once
+	lintSuffix     string
+
+	// skipped lists the packages which are not built and why
+	skipped map[*Package]string
+	// untested lists the cached packages which were built without tests and are tested during this build
+	untested map[*Package]bool
+	// testTargets lists the packages whose tests run even if they passed before, see Test()
+	testTargets map[*Package]bool
+	// registryEnv points the container tools to the registry credentials configured in the application
+	registryEnv []string
+	// cgroups enforce the resource limits of package builds
+	cgroups cgroupManager
+	// sandbox hides undeclared inputs from build commands if the sandbox is enabled
+	sandbox buildSandbox
+	// deadlines are the times by which the build phases of packages with a timeout must have finished
+	deadlines phaseDeadlines
 }
 
 const (
@@ -98,6 +127,13 @@ const (
 	// which contains the names of the Docker images we just pushed
 	dockerImageNamesFiles = "imgnames.txt"
 
+	// dockerImageRewritesFile is the name of the file which records how the image names of a Docker package
+	// were rewritten for the build, i.e. which name in the BUILD.yaml became which name in imgnames.txt
+	dockerImageRewritesFile = "imgrewrites.yaml"
+
+	// genericOutputsFile lists the files which end up in the build artifact of generic packages with declared outputs
+	genericOutputsFile = ".gorpa-outputs"
+
 	// dockerMetadataFile is the name of the file we YAML seralize the DockerPkgConfig.Metadata field to
 	// when building Docker images. We use this mechanism to produce the version manifest as part of the Bhojpur.NET Platform build.
 	dockerMetadataFile = "metadata.yaml"
@@ -110,6 +146,9 @@ var buildProcessVersions = map[PackageType]int{
 	GoPackage:      2,
 	DockerPackage:  3,
 	GenericPackage: 1,
+	ProtoPackage:   1,
+	PluginPackage:  1,
+	MetaPackage:    1,
 }
 
 func newBuildContext(options buildOptions) (ctx *buildContext, err error) {
@@ -117,15 +156,7 @@ func newBuildContext(options buildOptions) (ctx *buildContext, err error) {
 		return options.context, nil
 	}
 
-	buildDir := os.Getenv(EnvvarBuildDir)
-	if buildDir == "" {
-		buildDir = filepath.Join(os.TempDir(), "build")
-	}
-
-	var buildLimit *semaphore.Weighted
-	if options.MaxConcurrentTasks > 0 {
-		buildLimit = semaphore.NewWeighted(options.MaxConcurrentTasks)
-	}
+	buildDir := buildDirLocation()
 
 	b := make([]byte, 4)
 	_, err = rand.Read(b)
@@ -156,9 +187,13 @@ func newBuildContext(options buildOptions) (ctx *buildContext, err error) {
 		newlyBuiltPackages: make(map[string]*Package),
 		pkgLockCond:        sync.NewCond(&sync.Mutex{}),
 		pkgLocks:           make(map[string]struct{}),
-		buildLimit:         buildLimit,
+		buildLimit:         newBuildScheduler(options.MaxConcurrentTasks, options.MaxMemory),
+		pushLimit:          semaphore.NewWeighted(int64(options.Push.Jobs)),
 		gorpaHash:          hex.EncodeToString(gorpaHash.Sum(nil)),
 	}
+	if options.PackageLogs.Enabled {
+		ctx.Reporter = CompositeReporter{options.Reporter, newPackageLogReporter()}
+	}
 
 	err = os.MkdirAll(buildDir, 0755)
 	if err != nil {
@@ -211,22 +246,24 @@ func (c *buildContext) ReleaseBuildLock(p *Package) {
 // dependencies from getting build. Hence, it's important to call this function
 // once all dependencies have been built.
 //
+// Builds take as many slots as the CPUs they declare, and exclusive builds take all of them.
+//
 // All callers must release the build limiter using ReleaseConcurrentBuild()
-func (c *buildContext) LimitConcurrentBuilds() {
+func (c *buildContext) LimitConcurrentBuilds(res ResourceLimits) {
 	if c.buildLimit == nil {
 		return
 	}
 
-	_ = c.buildLimit.Acquire(context.Background(), 1)
+	c.buildLimit.Acquire(res)
 }
 
 // ReleaseConcurrentBuild releases a previously acquired concurrent build limiting token
-func (c *buildContext) ReleaseConcurrentBuild() {
+func (c *buildContext) ReleaseConcurrentBuild(res ResourceLimits) {
 	if c.buildLimit == nil {
 		return
 	}
 
-	c.buildLimit.Release(1)
+	c.buildLimit.Release(res)
 }
 
 // RegisterNewlyBuilt adds a new package to the list of packages built in this context
@@ -239,6 +276,10 @@ func (c *buildContext) RegisterNewlyBuilt(p *Package) error {
 	c.mu.Lock()
 	c.newlyBuiltPackages[ver] = p
 	c.mu.Unlock()
+
+	if c.Session != nil {
+		return c.Session.recordBuilt(p)
+	}
 	return nil
 }
 
@@ -249,28 +290,85 @@ func (c *buildContext) GetNewPackagesForCache() []*Package {
 		if pkg.Ephemeral {
 			continue
 		}
+		if c.rewritesImagesOf(pkg) {
+			// the image rewrite is not part of the version, hence others must not get an artifact of our images
+			log.WithField("package", pkg.FullName()).Debug("not caching remotely: image names were rewritten")
+			continue
+		}
 		res = append(res, pkg)
 	}
 	c.mu.Unlock()
 	return res
 }
 
+// rewritesImagesOf returns true if the Docker image rewrite changes the images a package is built as
+func (c *buildContext) rewritesImagesOf(pkg *Package) bool {
+	if c.DockerImageRewrite.IsEmpty() {
+		return false
+	}
+	cfg, ok := pkg.Config.(DockerPkgConfig)
+	return ok && len(cfg.Image) > 0
+}
+
 type buildOptions struct {
 	LocalCache             Cache
 	RemoteCache            RemoteCache
 	AdditionalRemoteCaches []RemoteCache
 	Reporter               Reporter
+	HumanOutput            io.Writer
 	DryRun                 bool
 	BuildPlan              io.Writer
+	BuildPlanFormat        BuildPlanFormat
 	DontTest               bool
 	MaxConcurrentTasks     int64
+	MaxMemory              int64
 	CoverageOutputPath     string
 	DontRetag              bool
 	DockerBuildOptions     *DockerBuildOptions
-
-	context *buildContext
+	GoCacheMode            GoCacheMode
+	GoCacheDir             string
+	FetchCacheDir          string
+	GoToolchainDir         string
+	NodeToolchainDir       string
+	LintCacheDir           string
+	TestCacheDir           string
+	ForceTests             bool
+	TestRetry              TestRetryPolicy
+	TestQuarantine         []string
+	Timeout                Timeouts
+	Sandbox                bool
+	Session                *BuildSession
+	TestFilter             string
+	GoGenerateCacheDir     string
+	DockerImageRewrite     DockerImageRewrite
+	DockerBuilder          DockerBuilder
+	BuildKit               BuildKitOptions
+	ContainerCLI           ContainerCLI
+	Skip                   SkipFilter
+	ImageSigning           ImageSigning
+	Push                   PushOptions
+	ReleaseTag             string
+	KeepGoing              bool
+	Faults                 *FaultInjection
+	YarnMirror             YarnMirrorOptions
+	PackageLogs            PackageLogOptions
+
+	releaseStore objectStore
+	context      *buildContext
 }
 
+// GoCacheMode determines which GOCACHE Go package builds use
+type GoCacheMode string
+
+const (
+	// GoCacheShared makes all Go package builds share a single GOCACHE in the Go cache directory
+	GoCacheShared GoCacheMode = "shared"
+	// GoCacheIsolated gives each Go package its own persistent GOCACHE in the Go cache directory
+	GoCacheIsolated GoCacheMode = "isolated"
+	// GoCacheOff leaves GOCACHE alone, i.e. builds use whatever the environment configures
+	GoCacheOff GoCacheMode = "off"
+)
+
 // DockerBuildOptions are options passed to "docker build"
 type DockerBuildOptions map[string]string
 
@@ -309,6 +407,15 @@ func WithReporter(reporter Reporter) BuildOption {
 	}
 }
 
+// WithHumanOutput sets where the build prints the messages meant for humans, e.g. the skipped packages or the
+// build plan of a dry run. Defaults to stdout.
+func WithHumanOutput(out io.Writer) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.HumanOutput = out
+		return nil
+	}
+}
+
 // WithDryRun marks this build as dry run
 func WithDryRun(dryrun bool) BuildOption {
 	return func(opts *buildOptions) error {
@@ -325,6 +432,17 @@ func WithBuildPlan(out io.Writer) BuildOption {
 	}
 }
 
+// WithBuildPlanFormat writes the build plan in another format than JSON
+func WithBuildPlanFormat(format BuildPlanFormat) BuildOption {
+	return func(opts *buildOptions) error {
+		if !format.valid() {
+			return xerrors.Errorf("unknown build plan format %q", format)
+		}
+		opts.BuildPlanFormat = format
+		return nil
+	}
+}
+
 // WithDontTest disables package-level tests
 func WithDontTest(dontTest bool) BuildOption {
 	return func(opts *buildOptions) error {
@@ -333,6 +451,24 @@ func WithDontTest(dontTest bool) BuildOption {
 	}
 }
 
+// WithMaxMemory limits the memory package builds may declare in their resources altogether, e.g. 16G.
+// Builds which would exceed the limit wait for others to finish. An empty limit disables the limit.
+func WithMaxMemory(limit string) BuildOption {
+	return func(opts *buildOptions) error {
+		if limit == "" {
+			opts.MaxMemory = 0
+			return nil
+		}
+		mem, err := parseMemoryLimit(limit)
+		if err != nil {
+			return err
+		}
+		opts.MaxMemory = mem
+
+		return nil
+	}
+}
+
 // WithMaxConcurrentTasks limits the number of concurrent tasks during the build
 func WithMaxConcurrentTasks(n int64) BuildOption {
 	return func(opts *buildOptions) error {
@@ -369,6 +505,47 @@ func WithDockerBuildOptions(dockerBuildOpts *DockerBuildOptions) BuildOption {
 	}
 }
 
+// WithGoCache configures the GOCACHE used by Go package builds. dir is the directory
+// under which the shared or per-package caches are kept. It's ignored for GoCacheOff.
+func WithGoCache(mode GoCacheMode, dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		switch mode {
+		case GoCacheShared, GoCacheIsolated:
+			if dir == "" {
+				return xerrors.Errorf("Go cache mode %s requires a cache directory", mode)
+			}
+		case GoCacheOff, "":
+		default:
+			return xerrors.Errorf("invalid Go cache mode: %s", mode)
+		}
+
+		opts.GoCacheMode = mode
+		opts.GoCacheDir = dir
+		return nil
+	}
+}
+
+// WithDockerImageRewrite rewrites the image names of all Docker packages for this build
+func WithDockerImageRewrite(rewrite DockerImageRewrite) BuildOption {
+	return func(opts *buildOptions) error {
+		err := rewrite.Validate()
+		if err != nil {
+			return err
+		}
+		opts.DockerImageRewrite = rewrite
+		return nil
+	}
+}
+
+// WithFetchCache configures the directory downloads of fetch specs are cached in.
+// Defaults to a directory in the build dir.
+func WithFetchCache(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.FetchCacheDir = dir
+		return nil
+	}
+}
+
 func withBuildContext(ctx *buildContext) BuildOption {
 	return func(opts *buildOptions) error {
 		opts.context = ctx
@@ -379,9 +556,11 @@ func withBuildContext(ctx *buildContext) BuildOption {
 
 func applyBuildOpts(opts []BuildOption) (buildOptions, error) {
 	options := buildOptions{
-		Reporter:    NewConsoleReporter(),
-		RemoteCache: &NoRemoteCache{},
-		DryRun:      false,
+		HumanOutput:  os.Stdout,
+		RemoteCache:  &NoRemoteCache{},
+		DryRun:       false,
+		ContainerCLI: ContainerCLIDocker,
+		Push:         DefaultPushOptions,
 	}
 	for _, opt := range opts {
 		err := opt(&options)
@@ -392,10 +571,111 @@ func applyBuildOpts(opts []BuildOption) (buildOptions, error) {
 	if options.LocalCache == nil {
 		return options, xerrors.Errorf("cannot build without local cache. Use WithLocalCache() to configure one")
 	}
+	if options.Reporter == nil {
+		rep := NewConsoleReporter()
+		rep.Out = options.HumanOutput
+		options.Reporter = rep
+	}
 
 	return options, nil
 }
 
+// Warm downloads the build artifacts of the packages and all their transitive dependencies from the remote caches
+// without building anything. It returns the packages whose artifacts are available in the local cache afterwards,
+// and those which would have to be built.
+func Warm(pkgs []*Package, opts ...BuildOption) (available, missing []*Package, err error) {
+	options, err := applyBuildOpts(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		idx   = make(map[string]struct{})
+		clean []*Package
+	)
+	for _, pkg := range pkgs {
+		for _, p := range append(pkg.GetTransitiveDependencies(), pkg) {
+			if _, exists := idx[p.FullName()]; exists {
+				continue
+			}
+			idx[p.FullName()] = struct{}{}
+
+			// ephemeral packages are never cached
+			if p.Ephemeral {
+				continue
+			}
+			clean = append(clean, p)
+		}
+	}
+
+	err = options.RemoteCache.Download(options.LocalCache, clean)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, arc := range options.AdditionalRemoteCaches {
+		err = arc.Download(options.LocalCache, clean)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, p := range clean {
+		if _, exists := options.LocalCache.Location(p); exists {
+			available = append(available, p)
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	return available, missing, nil
+}
+
+// configureRegistries writes the credentials of the registries of the application, which the build commands find
+// in the registry environment, unless that happened before. The returned func removes them again.
+func (c *buildContext) configureRegistries(app *Application) (remove func(), err error) {
+	if len(app.Registries) == 0 || c.registryEnv != nil {
+		return func() {}, nil
+	}
+	dir := filepath.Join(c.buildDir, "registries-"+c.buildID)
+	c.registryEnv, err = writeRegistryConfig(dir, app.Registries)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot configure registry credentials: %w", err)
+	}
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// checkVersions computes the versions of the packages upfront, as version errors would otherwise surface half-way
+// through the build without being reported
+func checkVersions(pkgs []*Package) error {
+	for _, p := range pkgs {
+		_, err := p.Version()
+		if err != nil {
+			return xerrors.Errorf("%s: %w", p.FullName(), err)
+		}
+	}
+	return nil
+}
+
+// downloadRequirements downloads the packages from the remote caches into the local cache, and returns the
+// artifacts it downloaded. Each remote cache only downloads the packages the caches before it didn't have.
+func (c *buildContext) downloadRequirements(options buildOptions, target *Package, pkgs []*Package) (map[*Package]remoteArtifact, error) {
+	locallyCached := make(map[*Package]bool, len(pkgs))
+	for _, p := range pkgs {
+		_, locallyCached[p] = c.LocalCache.Location(p)
+	}
+
+	res := make(map[*Package]remoteArtifact)
+	defer startPhase(options.Reporter, target, BuildPhaseDownload)()
+	for _, rc := range append([]RemoteCache{options.RemoteCache}, options.AdditionalRemoteCaches...) {
+		err := rc.Download(c.LocalCache, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		collectDownloads(c.LocalCache, rc, pkgs, locallyCached, res)
+		recordDownloads(c.LocalCache, rc, pkgs, locallyCached)
+	}
+	return res, nil
+}
+
 // Build builds the packages in the order they're given. It's the callers responsibility to ensure the dependencies are built
 // in order.
 func Build(pkg *Package, opts ...BuildOption) (err error) {
@@ -408,30 +688,105 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 		return err
 	}
 
+	removeRegistries, err := ctx.configureRegistries(pkg.C.W)
+	if err != nil {
+		return err
+	}
+	defer removeRegistries()
+
 	requirements := pkg.GetTransitiveDependencies()
 	allpkg := append(requirements, pkg)
+	if pkg.targetGroup {
+		// the group is not part of the build, only its targets and their dependencies are
+		allpkg = requirements
+	}
+	if options.Session != nil {
+		restored, err := options.Session.restoreVersions(allpkg)
+		if err != nil {
+			return err
+		}
+		if restored > 0 {
+			fmt.Fprintf(options.HumanOutput, "⏯️  resuming build: reusing the versions of %d unchanged packages\n", restored)
+		}
+	}
+	err = checkVersions(allpkg)
+	if err != nil {
+		return err
+	}
 
 	// respect per-package cache level when downloading from remote cache
 	remotelyCachedReq := make([]*Package, 0, len(requirements))
 	remotelyCachedReq = append(remotelyCachedReq, requirements...)
-
-	err = options.RemoteCache.Download(ctx.LocalCache, remotelyCachedReq)
-	if err != nil {
-		return err
+	if options.Session != nil {
+		err = options.Session.recordVersions(allpkg)
+		if err != nil {
+			return xerrors.Errorf("cannot save build session: %w", err)
+		}
+		// packages an interrupted build built but did not upload yet
+		for _, p := range options.Session.builtPackages(allpkg, ctx.LocalCache) {
+			err = ctx.RegisterNewlyBuilt(p)
+			if err != nil {
+				return err
+			}
+		}
+		remotelyCachedReq = options.Session.pendingDownloads(remotelyCachedReq)
 	}
 
-	// Download only downloads packages that do not exist locally, yet
-	for _, arc := range options.AdditionalRemoteCaches {
-		err = arc.Download(ctx.LocalCache, remotelyCachedReq)
+	var (
+		remote        map[*Package]remoteArtifact
+		remoteUnknown map[*Package]struct{}
+	)
+	if options.DryRun {
+		// a dry run must not change the local cache, hence we only ask the remote caches what they hold
+		remote, remoteUnknown = ctx.queryRemoteCaches(remotelyCachedReq)
+	} else {
+		remote, err = ctx.downloadRequirements(options, pkg, remotelyCachedReq)
 		if err != nil {
 			return err
 		}
+		if options.Session != nil {
+			err = options.Session.recordDownloads(remotelyCachedReq)
+			if err != nil {
+				return xerrors.Errorf("cannot save build session: %w", err)
+			}
+		}
+	}
+	// during a dry run the artifacts the remote caches hold count as available already
+	available := func(p *Package) bool {
+		if _, ok := remote[p]; ok && options.DryRun {
+			return true
+		}
+		_, exists := ctx.LocalCache.Location(p)
+		return exists
+	}
+
+	ctx.skipped = options.Skip.skippedPackages(allpkg, func(p *Package) bool {
+		return available(p) && !p.Ephemeral
+	})
+	skipped := make([]string, 0, len(ctx.skipped))
+	for p, reason := range ctx.skipped {
+		skipped = append(skipped, fmt.Sprintf("⏩  skipping %s: %s\n", p.FullName(), reason))
+	}
+	sort.Strings(skipped)
+	fmt.Fprint(options.HumanOutput, strings.Join(skipped, ""))
+
+	ctx.untested = ctx.untestedPackages(allpkg)
+	untested := make([]string, 0, len(ctx.untested))
+	for p := range ctx.untested {
+		untested = append(untested, fmt.Sprintf("🧪  testing %s: built without tests\n", p.FullName()))
 	}
+	sort.Strings(untested)
+	fmt.Fprint(options.HumanOutput, strings.Join(untested, ""))
 
 	pkgstatus := make(map[*Package]PackageBuildStatus)
 	unresolvedArgs := make(map[string][]string)
 	for _, dep := range allpkg {
-		_, exists := ctx.LocalCache.Location(dep)
+		if _, ok := ctx.skipped[dep]; ok {
+			pkgstatus[dep] = PackageSkipped
+			continue
+		}
+
+		exists := available(dep)
 		if dep.Ephemeral {
 			// ephemeral packages are never built at the begining of a build
 			pkgstatus[dep] = PackageNotBuiltYet
@@ -458,23 +813,26 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 			unresolvedArgs[arg] = pkgs
 		}
 	}
+	plan, err := newBuildPlan(pkg, allpkg, pkgstatus, remote, remoteUnknown)
+	if err != nil {
+		return err
+	}
+
 	options.Reporter.BuildStarted(pkg, pkgstatus)
 	defer func(err *error) {
 		options.Reporter.BuildFinished(pkg, *err)
 	}(&err)
 
 	if len(unresolvedArgs) != 0 {
-		var msg string
-		for arg, pkgs := range unresolvedArgs {
-			cleanArg := strings.TrimSuffix(strings.TrimPrefix(arg, "${"), "}")
-			msg += fmt.Sprintf("cannot build with unresolved argument \"%s\": use -D%s=value to set the argument\n\t%s appears in %s\n\n", arg, cleanArg, arg, strings.Join(pkgs, ", "))
-		}
-		return xerrors.Errorf(msg)
+		return unresolvedArgumentsErr(unresolvedArgs)
 	}
 
+	if options.DryRun {
+		plan.Print(options.HumanOutput)
+	}
 	if options.BuildPlan != nil {
 		log.Debug("writing build plan")
-		err = writeBuildPlan(options.BuildPlan, pkg, pkgstatus)
+		err = plan.WriteAs(options.BuildPlan, options.BuildPlanFormat)
 		if err != nil {
 			return err
 		}
@@ -486,9 +844,15 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 	}
 
 	buildErr := pkg.build(ctx)
+	uploaded := startPhase(options.Reporter, pkg, BuildPhaseUpload)
 	cacheErr := options.RemoteCache.Upload(ctx.LocalCache, ctx.GetNewPackagesForCache())
+	ctx.uploadPackageLogs(ctx.GetNewPackagesForCache())
+	uploaded()
 
 	if buildErr != nil {
+		if failures := ctx.failuresErr(); options.KeepGoing && failures != nil {
+			return xerrors.Errorf("build failed: %w", failures)
+		}
 		// We deliberately swallow the target pacakge build error as that will have already been reported using the reporter.
 		return xerrors.Errorf("build failed")
 	}
@@ -496,18 +860,44 @@ func Build(pkg *Package, opts ...BuildOption) (err error) {
 		return cacheErr
 	}
 
+	err = ctx.tagRelease(allpkg)
+	if err != nil {
+		return xerrors.Errorf("cannot tag release: %w", err)
+	}
+
+	if options.Session != nil {
+		err = options.Session.Done()
+		if err != nil {
+			log.WithError(err).Warn("cannot remove build session")
+		}
+	}
+
 	return nil
 }
 
-func writeBuildPlan(out io.Writer, pkg *Package, status map[*Package]PackageBuildStatus) error {
-	// BuildStep is a list of packages that can be built in parallel
-	type BuildStep []string
+func unresolvedArgumentsErr(unresolvedArgs map[string][]string) error {
+	var msg string
+	for arg, pkgs := range unresolvedArgs {
+		cleanArg := strings.TrimSuffix(strings.TrimPrefix(arg, "${"), "}")
+		msg += fmt.Sprintf("cannot build with unresolved argument \"%s\": use -D%s=value to set the argument\n\t%s appears in %s\n\n", arg, cleanArg, arg, strings.Join(pkgs, ", "))
+	}
+	return xerrors.Errorf(msg)
+}
 
+// buildSteps orders the packages which need building into steps, where the packages of a step can be built in parallel
+func buildSteps(pkg *Package, status map[*Package]PackageBuildStatus) ([][]string, error) {
 	var walk func(pkg *Package, idx map[*Package]int, depth int)
 	walk = func(pkg *Package, idx map[*Package]int, depth int) {
 		if status[pkg] == PackageBuilt {
 			return
 		}
+		if status[pkg] == PackageSkipped || pkg.targetGroup {
+			// skipped packages still build their dependencies
+			for _, dep := range pkg.GetDependencies() {
+				walk(dep, idx, depth)
+			}
+			return
+		}
 
 		td := depth
 		if idx[pkg] > td {
@@ -530,19 +920,14 @@ func writeBuildPlan(out io.Writer, pkg *Package, status map[*Package]PackageBuil
 		}
 	}
 	log.WithField("maxDepth", md).Debug("built plan")
-	steps := make([]BuildStep, md+1)
+	steps := make([][]string, md+1)
 	for pkg, depth := range idx {
 		steps[md-depth] = append(steps[md-depth], pkg.FullName())
 	}
-
-	enc := json.NewEncoder(out)
-	enc.SetIndent("", "  ")
-	err := enc.Encode(steps)
-	if err != nil {
-		return err
+	for _, step := range steps {
+		sort.Strings(step)
 	}
-
-	return nil
+	return steps, nil
 }
 
 func (p *Package) buildDependencies(buildctx *buildContext) (err error) {
@@ -551,7 +936,8 @@ func (p *Package) buildDependencies(buildctx *buildContext) (err error) {
 		return xerrors.Errorf("package \"%s\" is not linked", p.FullName())
 	}
 
-	failchan := make(chan error)
+	// the channel takes all errors, s.t. the builds of the other dependencies finish even if we stop waiting for them
+	failchan := make(chan error, len(deps))
 	donechan := make(chan struct{})
 	var wg sync.WaitGroup
 	wg.Add(len(p.GetDependencies()))
@@ -566,9 +952,20 @@ func (p *Package) buildDependencies(buildctx *buildContext) (err error) {
 	}
 	go func() {
 		wg.Wait()
-		donechan <- struct{}{}
+		close(donechan)
 	}()
 
+	if buildctx.KeepGoing {
+		// all other dependencies still get built, but the package cannot be built without the failed ones
+		<-donechan
+		select {
+		case err := <-failchan:
+			return err
+		default:
+			return nil
+		}
+	}
+
 	select {
 	case err := <-failchan:
 		return err
@@ -578,10 +975,26 @@ func (p *Package) buildDependencies(buildctx *buildContext) (err error) {
 }
 
 func (p *Package) build(buildctx *buildContext) (err error) {
+	if _, skipped := buildctx.skipped[p]; skipped || p.targetGroup {
+		// dependencies which are not skipped themselves are still part of the build
+		return p.buildDependencies(buildctx)
+	}
+	if err := buildctx.failure(p); err != nil {
+		// the package failed to build for another dependent already
+		return err
+	}
+
 	artifact, alreadyBuilt := buildctx.LocalCache.Location(p)
 	if p.Ephemeral {
 		// ephemeral packages always require a rebuild
 	} else if alreadyBuilt {
+		if buildctx.needsTesting(p) {
+			err = p.testCached(buildctx)
+			if err != nil {
+				return err
+			}
+		}
+
 		// some package types still need to do work even if we find their prior build artifact in the cache.
 		if p.Type == DockerPackage && !buildctx.DontRetag {
 			doBuild := buildctx.ObtainBuildLock(p)
@@ -604,7 +1017,7 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 
 	doBuild := buildctx.ObtainBuildLock(p)
 	if !doBuild {
-		return nil
+		return buildctx.failure(p)
 	}
 	defer buildctx.ReleaseBuildLock(p)
 
@@ -620,32 +1033,26 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 
 	buildctx.Reporter.PackageBuildStarted(p)
 	defer func(err *error) {
+		buildctx.recordFailure(p, *err)
 		buildctx.Reporter.PackageBuildFinished(p, *err)
 	}(&err)
+	buildctx.Faults.delayBuild(p)
 
-	pkgdir := p.FilesystemSafeName() + "." + version
-	builddir := filepath.Join(buildctx.BuildDir(), pkgdir)
-	if _, err := os.Stat(builddir); !os.IsNotExist(err) {
-		err := os.RemoveAll(builddir)
-		if err != nil {
-			return err
-		}
-	}
-	err = os.MkdirAll(builddir, 0755)
+	now := time.Now()
+	prepared := startPhase(buildctx.Reporter, p, BuildPhasePrepare)
+	builddir, err := p.prepareBuildDir(buildctx, version, now)
+	prepared()
 	if err != nil {
 		return err
 	}
-
-	if len(p.Sources) > 0 {
-		cpargs := []string{"--parents"}
-		for _, src := range p.Sources {
-			cpargs = append(cpargs, strings.TrimPrefix(src, p.C.Origin+"/"))
-		}
-		cpargs = append(cpargs, builddir)
-		err = run(buildctx.Reporter, p, nil, p.C.Origin, "cp", cpargs...)
+	defer func() {
 		if err != nil {
-			return err
+			p.runFailureHooks(buildctx, builddir, err)
 		}
+	}()
+	err = p.runHooks(buildctx, HookPreBuild, builddir, nil)
+	if err != nil {
+		return err
 	}
 
 	var (
@@ -654,26 +1061,25 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 		sources   fileset
 	)
 
-	buildctx.LimitConcurrentBuilds()
-	defer buildctx.ReleaseConcurrentBuild()
+	scheduled := startPhase(buildctx.Reporter, p, BuildPhaseWait)
+	buildctx.LimitConcurrentBuilds(p.Resources)
+	scheduled()
+	defer buildctx.ReleaseConcurrentBuild(p.Resources)
 
-	switch p.Type {
-	case YarnPackage:
-		bld, err = p.buildYarn(buildctx, builddir, result)
-	case GoPackage:
-		bld, err = p.buildGo(buildctx, builddir, result)
-	case DockerPackage:
-		bld, err = p.buildDocker(buildctx, builddir, result)
-	case GenericPackage:
-		bld, err = p.buildGeneric(buildctx, builddir, result)
-	default:
-		err = xerrors.Errorf("cannot build package type: %s", p.Type)
+	cgroup, err := buildctx.cgroups.Create(p, buildctx.buildID)
+	if err != nil {
+		return err
 	}
+	if cgroup != nil {
+		defer buildctx.cgroups.Release(p)
+	}
+
+	built := startPhase(buildctx.Reporter, p, BuildPhaseBuild)
+	bld, err = p.planBuild(buildctx, builddir, result)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now()
 	if p.C.W.Provenance.Enabled {
 		sources, err = computeFileset(builddir)
 		if err != nil {
@@ -681,11 +1087,33 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 		}
 	}
 
-	err = executeCommandsForPackage(buildctx, p, builddir, bld.BuildCommands)
+	stopTimeout := buildctx.startTimeout(p, BuildPhaseBuild)
+	err = executeCommandsForPackage(buildctx, p, builddir, bld.BuildCommands, bld.Environment)
+	stopTimeout()
+	built()
+	if err != nil {
+		return err
+	}
+	tested := startPhase(buildctx.Reporter, p, BuildPhaseTest)
+	err = buildctx.runTests(p, builddir, bld)
+	tested()
 	if err != nil {
 		return err
 	}
 
+	packaged := startPhase(buildctx.Reporter, p, BuildPhasePackage)
+	defer packaged()
+
+	if bld.BeforePackage != nil {
+		err = bld.BeforePackage()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Type == DockerPackage {
+		p.uploadLayerCache(buildctx)
+	}
+
 	if p.C.W.Provenance.Enabled {
 		var (
 			subjects  []in_toto.Subject
@@ -716,13 +1144,42 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 		if err != nil {
 			return err
 		}
+		if p.generatesSBOM() && p.Type != DockerPackage {
+			err = p.writeSBOM(builddir, resultDir, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = executePushCommands(buildctx, p, builddir, bld.PushCommands, bld.Environment)
+	if err != nil {
+		return err
+	}
+
+	err = executeCommandsForPackage(buildctx, p, builddir, bld.PackageCommands, bld.Environment)
+	if err != nil {
+		return err
 	}
 
-	err = executeCommandsForPackage(buildctx, p, builddir, bld.PackageCommands)
+	err = p.runHooks(buildctx, HookPostBuild, builddir, nil)
 	if err != nil {
+		// the next build must run the hooks again, hence the artifact must not remain in the cache
+		if rerr := os.Remove(result); rerr != nil && !os.IsNotExist(rerr) {
+			log.WithError(rerr).WithField("package", p.FullName()).Warn("cannot remove artifact")
+		}
 		return err
 	}
 
+	err = writeArtifactChecksum(result)
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot record artifact checksum")
+	}
+	err = writeArtifactOrigin(result, ArtifactOrigin{Source: ArtifactBuilt, Time: time.Now().UTC()})
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot record artifact origin")
+	}
+
 	err = buildctx.RegisterNewlyBuilt(p)
 	if err != nil {
 		return err
@@ -731,16 +1188,178 @@ func (p *Package) build(buildctx *buildContext) (err error) {
 	return err
 }
 
-type packageBuild struct {
-	BuildCommands   [][]string
-	PackageCommands [][]string
+// prepareBuildDir produces an empty build directory for the package version and copies the sources and build info into it
+func (p *Package) prepareBuildDir(buildctx *buildContext, version string, now time.Time) (string, error) {
+	pkgdir := p.FilesystemSafeName() + "." + version
+	builddir := filepath.Join(buildctx.BuildDir(), pkgdir)
+	if _, err := os.Stat(builddir); !os.IsNotExist(err) {
+		err := os.RemoveAll(builddir)
+		if err != nil {
+			return "", err
+		}
+	}
+	err := os.MkdirAll(builddir, 0755)
+	if err != nil {
+		return "", err
+	}
 
-	// If PostBuild is not nil but Subjects is, PostBuild is used
+	err = p.copySources(buildctx.Reporter, builddir)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeBuildInfo(p, builddir, now)
+	if err != nil {
+		return "", err
+	}
+	return builddir, nil
+}
+
+// testCached runs the tests of a cached package which was built without them, and those of its dependencies.
+// The package is not built again: only the build commands the tests need run before them.
+func (p *Package) testCached(buildctx *buildContext) (err error) {
+	doTest := buildctx.ObtainBuildLock(p)
+	if !doTest {
+		return buildctx.failure(p)
+	}
+	defer buildctx.ReleaseBuildLock(p)
+
+	err = p.buildDependencies(buildctx)
+	if err != nil {
+		return err
+	}
+	if !buildctx.untested[p] || (buildctx.testsPassed(p) && !buildctx.isTestTarget(p)) {
+		return nil
+	}
+
+	version, err := p.Version()
+	if err != nil {
+		return err
+	}
+
+	buildctx.Reporter.PackageBuildStarted(p)
+	defer func(err *error) {
+		buildctx.recordFailure(p, *err)
+		buildctx.Reporter.PackageBuildFinished(p, *err)
+	}(&err)
+
+	prepared := startPhase(buildctx.Reporter, p, BuildPhasePrepare)
+	builddir, err := p.prepareBuildDir(buildctx, version, time.Now())
+	prepared()
+	if err != nil {
+		return err
+	}
+
+	scheduled := startPhase(buildctx.Reporter, p, BuildPhaseWait)
+	buildctx.LimitConcurrentBuilds(p.Resources)
+	scheduled()
+	defer buildctx.ReleaseConcurrentBuild(p.Resources)
+
+	cgroup, err := buildctx.cgroups.Create(p, buildctx.buildID)
+	if err != nil {
+		return err
+	}
+	if cgroup != nil {
+		defer buildctx.cgroups.Release(p)
+	}
+
+	result, _ := buildctx.LocalCache.Location(p)
+	bld, err := p.planBuild(buildctx, builddir, result)
+	if err != nil {
+		return err
+	}
+
+	setup := bld.SetupSteps
+	if bld.TestSetupSteps > setup {
+		setup = bld.TestSetupSteps
+	}
+	built := startPhase(buildctx.Reporter, p, BuildPhaseBuild)
+	stopTimeout := buildctx.startTimeout(p, BuildPhaseBuild)
+	// packages without test commands, e.g. generic packages, test in their build commands
+	err = executeCommandsForPackage(buildctx, p, builddir, bld.BuildCommands[:setup], buildctx.testEnvironment(bld))
+	stopTimeout()
+	built()
+	if err != nil {
+		return err
+	}
+
+	tested := startPhase(buildctx.Reporter, p, BuildPhaseTest)
+	defer tested()
+	return buildctx.runTests(p, builddir, bld)
+}
+
+// copySources copies the package sources into dst, keeping their location relative to the component
+func (p *Package) copySources(rep Reporter, dst string) error {
+	if len(p.Sources) == 0 {
+		return nil
+	}
+
+	cpargs := []string{"--parents"}
+	for _, src := range p.Sources {
+		cpargs = append(cpargs, strings.TrimPrefix(src, p.C.Origin+"/"))
+	}
+	cpargs = append(cpargs, dst)
+	return run(rep, p, nil, nil, p.C.Origin, "cp", cpargs...)
+}
+
+// planBuild produces the commands which build the package in the build directory wd
+func (p *Package) planBuild(buildctx *buildContext, wd, result string) (*packageBuild, error) {
+	switch p.Type {
+	case YarnPackage:
+		bld, err := p.buildYarn(buildctx, wd, result)
+		if err != nil {
+			return nil, err
+		}
+		return bld, buildctx.pinNodeToolchain(p, bld)
+	case GoPackage:
+		return p.buildGo(buildctx, wd, result)
+	case DockerPackage:
+		return p.buildDocker(buildctx, wd, result)
+	case GenericPackage:
+		return p.buildGeneric(buildctx, wd, result)
+	case ProtoPackage:
+		return p.buildProto(buildctx, wd, result)
+	case PluginPackage:
+		return p.buildPlugin(buildctx, wd, result)
+	case MetaPackage:
+		return p.buildMeta(buildctx, wd, result)
+	default:
+		return nil, xerrors.Errorf("cannot build package type: %s", p.Type)
+	}
+}
+
+type packageBuild struct {
+	BuildCommands   [][]string
+	PackageCommands [][]string
+	// PushCommands push the built images after the provenance was written and before the package commands run.
+	// They run concurrently and are retried on failure.
+	PushCommands [][]string
+
+	// If PostBuild is not nil but Subjects is, PostBuild is used
 	// to compute the post build fileset for provenance subject computation.
 	PostBuild func(sources fileset) (subj []in_toto.Subject, absResultDir string, err error)
 	// If Subjects is not nil it's used to compute the provenance subjects of the
 	// package build. This field takes precedence over PostBuild
 	Subjects func() ([]in_toto.Subject, error)
+
+	// Environment is added to the package environment when running the build and package commands
+	Environment []string
+
+	// SetupSteps is the number of leading BuildCommands which prepare the build directory, e.g. extract
+	// dependencies and run the preparation commands. The remaining BuildCommands actually build the package.
+	SetupSteps int
+
+	// TestCommands run after the BuildCommands, unless tests are disabled or passed for the package version before.
+	TestCommands [][]string
+	// Test runs tests which are no plain commands, e.g. concurrent test shards, after the TestCommands.
+	Test func() error
+	// TestSetupSteps is the number of leading BuildCommands the tests need, e.g. to install dependencies, if that's
+	// more than SetupSteps. Cached packages which were built without tests run only those before testing.
+	TestSetupSteps int
+
+	// BeforePackage is called after the build commands ran and before the package commands run.
+	// If it returns an error, the build fails.
+	BeforePackage func() error
 }
 
 const (
@@ -775,6 +1394,12 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	if !ok {
 		return nil, xerrors.Errorf("package should have yarn config")
 	}
+	if cfg.IsNpm() {
+		return p.buildNpm(buildctx, wd, result)
+	}
+	if cfg.IsYarnBerry() {
+		return p.buildYarnBerry(buildctx, wd, result)
+	}
 
 	var (
 		fn           = filepath.Join(p.C.Origin, "package.json")
@@ -789,6 +1414,10 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	if !pkgjsonFound {
 		return nil, xerrors.Errorf("%s: yarn packages must have a package.json", p.FullName())
 	}
+	err = p.stampPackageJSON(wd)
+	if err != nil {
+		return nil, err
+	}
 
 	version, err := p.Version()
 	if err != nil {
@@ -813,6 +1442,20 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 			{"sh", "-c", "echo yarn-offline-mirror \"./_mirror\" > .yarnrc"},
 		}...)
 	}
+	var (
+		useMirror    = buildctx.usesYarnMirror(cfg)
+		mirrorBefore map[string]struct{}
+		offline      []string
+	)
+	if useMirror {
+		mirrorBefore, err = p.prepareYarnMirror(buildctx, wd, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if buildctx.YarnMirror.Offline {
+			offline = []string{"--offline"}
+		}
+	}
 
 	// We don't check if ephemeral packages in the transitive dependency tree have been built,
 	// as they may be too far down the tree to trigger a build (e.g. their parent may be built already).
@@ -845,7 +1488,7 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 		var isTSLibrary bool
 		if deppkg.Type == YarnPackage {
 			cfg, ok := deppkg.Config.(YarnPkgConfig)
-			if ok && cfg.Packaging == YarnLibrary {
+			if ok && cfg.Packaging == YarnLibrary && !cfg.IsNpm() && !cfg.IsYarnBerry() {
 				isTSLibrary = true
 			}
 		}
@@ -882,10 +1525,13 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 			}
 			packageJSONFiles = fs
 		}
-		packageJSONFiles = append(packageJSONFiles, pkgYarnLock)
+		packageJSONFiles = append(packageJSONFiles, pkgYarnLock, buildInfoFilename)
 		if p.C.W.Provenance.Enabled {
 			packageJSONFiles = append(packageJSONFiles, provenanceBundleFilename)
 		}
+		if p.generatesSBOM() {
+			packageJSONFiles = append(packageJSONFiles, sbomFilename)
+		}
 		packageJSON["files"] = packageJSONFiles
 
 		modifiedPackageJSON = true
@@ -920,6 +1566,7 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	// At this point we have all dependencies in place, a the correct package.json,
 	// and we're just short of running yarn install. Good point to do other prep work.
 	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
 
 	// The yarn cache cannot handly conccurency proplery and needs to be looked.
 	// Make sure that all our yarn install calls lock the yarn cache.
@@ -930,25 +1577,36 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 	}
 	yarnCache := filepath.Join(buildctx.BuildDir(), fmt.Sprintf("yarn-cache-%s", buildctx.buildID))
 	if len(cfg.Commands.Install) == 0 {
-		commands = append(commands, []string{"yarn", "install", "--mutex", yarnMutex, "--cache-folder", yarnCache})
+		commands = append(commands, append([]string{"yarn", "install", "--mutex", yarnMutex, "--cache-folder", yarnCache}, offline...))
 	} else {
 		commands = append(commands, cfg.Commands.Install)
 	}
+	testSetupSteps := len(commands)
 	if len(cfg.Commands.Build) == 0 {
 		commands = append(commands, []string{"yarn", "build"})
 	} else {
 		commands = append(commands, cfg.Commands.Build)
 	}
-	if !cfg.DontTest && !buildctx.DontTest {
-		if len(cfg.Commands.Test) == 0 {
-			commands = append(commands, []string{"yarn", "test"})
-		} else {
-			commands = append(commands, cfg.Commands.Test)
+	var testCommands [][]string
+	if !cfg.DontTest {
+		testCmd := []string{"yarn", "test"}
+		if len(cfg.Commands.Test) > 0 {
+			testCmd = cfg.Commands.Test
 		}
+		testCommands = [][]string{testCmd}
 	}
 
 	res := &packageBuild{
-		BuildCommands: commands,
+		BuildCommands:  commands,
+		SetupSteps:     setupSteps,
+		TestCommands:   testCommands,
+		TestSetupSteps: testSetupSteps,
+	}
+	if useMirror {
+		res.BeforePackage = func() error {
+			p.uploadYarnMirror(buildctx, mirrorBefore)
+			return nil
+		}
 	}
 
 	// let's prepare for packaging
@@ -974,6 +1632,7 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 			{"sh", "-c", fmt.Sprintf("yarn generate-lock-entry --resolved file://./%s > _mirror/content_yarn.lock", dst)},
 			{"sh", "-c", "cat yarn.lock >> _mirror/content_yarn.lock"},
 			{"yarn", "pack", "--filename", dst},
+			{"cp", buildInfoFilename, "_mirror"},
 			{"tar", "cfz", result, "-C", "_mirror", "."},
 		}...)
 		resultDir = "_mirror"
@@ -997,18 +1656,41 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 			{"sh", "-c", fmt.Sprintf("yarn generate-lock-entry --resolved file://%s > %s", pkg, pkgYarnLock)},
 			{"yarn", "pack", "--filename", pkg},
 			{"sh", "-c", fmt.Sprintf("cat yarn.lock %s > _pkg/yarn.lock", pkgYarnLock)},
-			{"yarn", "--cwd", "_pkg", "install", "--prod", "--frozen-lockfile"},
+			append([]string{"yarn", "--cwd", "_pkg", "install", "--prod", "--frozen-lockfile"}, offline...),
+		}...)
+		if cfg.Prune.Enabled {
+			pkgCommands = append(pkgCommands, yarnPruneCommand(filepath.Join("_pkg", "node_modules"), cfg.Prune))
+		}
+		pkgCommands = append(pkgCommands, [][]string{
+			{"cp", buildInfoFilename, "_pkg"},
 			{"tar", "cfz", result, "-C", "_pkg", "."},
 		}...)
 		resultDir = "_pkg"
 	} else if cfg.Packaging == YarnArchive {
+		if cfg.Prune.Enabled {
+			pkgCommands = append(pkgCommands, [][]string{
+				// yarn removes all devDependencies from node_modules when installing with --prod
+				append([]string{"yarn", "install", "--prod", "--frozen-lockfile", "--ignore-scripts", "--mutex", yarnMutex, "--cache-folder", yarnCache}, offline...),
+				yarnPruneCommand("node_modules", cfg.Prune),
+			}...)
+		}
 		pkgCommands = append(pkgCommands, []string{"tar", "cfz", result, "."})
 	} else {
 		return nil, xerrors.Errorf("unknown Typescript packaging: %s", cfg.Packaging)
 	}
 	res.PackageCommands = pkgCommands
-	res.PostBuild = func(sources fileset) (subjects []in_toto.Subject, absResultDir string, err error) {
-		ignoreNodeModules := func(fn string) bool { return strings.Contains(fn, "node_modules/") }
+	res.PostBuild = nodePostBuild(wd, resultDir)
+
+	return res, nil
+}
+
+// nodePostBuild computes the provenance subjects of yarn and npm packages, ignoring the content of node_modules
+// and the Yarn Berry cache
+func nodePostBuild(wd, resultDir string) func(sources fileset) ([]in_toto.Subject, string, error) {
+	return func(sources fileset) (subjects []in_toto.Subject, absResultDir string, err error) {
+		ignoreNodeModules := func(fn string) bool {
+			return strings.Contains(fn, "node_modules/") || strings.Contains(fn, ".yarn/cache/") || strings.Contains(fn, ".yarn/unplugged/")
+		}
 		fn := filepath.Join(wd, resultDir)
 		postBuild, err := computeFileset(fn, ignoreNodeModules)
 		if err != nil {
@@ -1018,8 +1700,173 @@ func (p *Package) buildYarn(buildctx *buildContext, wd, result string) (bld *pac
 		absResultDir = filepath.Join(wd, resultDir)
 		return
 	}
+}
 
-	return res, nil
+// buildNpm implements the build process for yarn packages which use npm as package manager.
+// Dependencies are extracted just like for yarn packages. Library dependencies are installed
+// from their packed tarballs after npm ci, without touching package.json or the lockfile.
+func (p *Package) buildNpm(buildctx *buildContext, wd, result string) (bld *packageBuild, err error) {
+	cfg, ok := p.Config.(YarnPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have yarn config")
+	}
+
+	var (
+		fn           = filepath.Join(p.C.Origin, "package.json")
+		pkgjsonFound bool
+	)
+	for _, src := range p.Sources {
+		if src == fn {
+			pkgjsonFound = true
+			break
+		}
+	}
+	if !pkgjsonFound {
+		return nil, xerrors.Errorf("%s: npm packages must have a package.json", p.FullName())
+	}
+	err = p.stampPackageJSON(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := [][]string{
+		{"cp", filepath.Join(p.C.Origin, cfg.packageLock()), "package-lock.json"},
+	}
+	if cfg.TSConfig != "" {
+		commands = append(commands, []string{"cp", filepath.Join(p.C.Origin, cfg.TSConfig), "."})
+	}
+
+	for _, deppkg := range p.GetDependencies() {
+		_, ok := buildctx.LocalCache.Location(deppkg)
+		if deppkg.Ephemeral && !ok {
+			return nil, PkgNotBuiltErr{deppkg}
+		}
+	}
+
+	var libraries []string
+	for _, deppkg := range p.GetTransitiveDependencies() {
+		if deppkg.Ephemeral {
+			continue
+		}
+
+		builtpkg, ok := buildctx.LocalCache.Location(deppkg)
+		if !ok {
+			return nil, PkgNotBuiltErr{deppkg}
+		}
+		if depcfg, ok := deppkg.Config.(YarnPkgConfig); ok && deppkg.Type == YarnPackage && depcfg.Packaging == YarnLibrary {
+			libraries = append(libraries, builtpkg)
+			continue
+		}
+
+		tgt := p.BuildLayoutLocation(deppkg)
+		commands = append(commands, [][]string{
+			{"mkdir", tgt},
+			{"tar", "xfz", builtpkg, "-C", tgt},
+		}...)
+	}
+
+	if cfg.Packaging == YarnLibrary {
+		pkgJSONFilename := filepath.Join(wd, "package.json")
+		var packageJSON map[string]interface{}
+		fc, err := ioutil.ReadFile(pkgJSONFilename)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot patch package.json of npm package: %w", err)
+		}
+		err = json.Unmarshal(fc, &packageJSON)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot patch package.json of npm package: %w", err)
+		}
+		if rfs, ok := packageJSON["files"]; ok {
+			fs, ok := rfs.([]interface{})
+			if !ok {
+				return nil, xerrors.Errorf("invalid package.json: files section is not a list of strings")
+			}
+			fs = append(fs, buildInfoFilename)
+			if p.C.W.Provenance.Enabled {
+				fs = append(fs, provenanceBundleFilename)
+			}
+			if p.generatesSBOM() {
+				fs = append(fs, sbomFilename)
+			}
+			packageJSON["files"] = fs
+
+			fc, err = json.Marshal(packageJSON)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot patch package.json of npm package: %w", err)
+			}
+			err = ioutil.WriteFile(pkgJSONFilename, fc, 0644)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot patch package.json of npm package: %w", err)
+			}
+		}
+	}
+
+	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
+
+	// npm's cache is safe for concurrent use, hence all builds can share it
+	npmCache := filepath.Join(buildctx.BuildDir(), "npm-cache")
+	if len(cfg.Commands.Install) == 0 {
+		commands = append(commands, []string{"npm", "ci", "--cache", npmCache, "--no-audit", "--no-fund"})
+	} else {
+		commands = append(commands, cfg.Commands.Install)
+	}
+	if len(libraries) > 0 {
+		commands = append(commands, append([]string{"npm", "install", "--cache", npmCache, "--no-save", "--no-audit", "--no-fund"}, libraries...))
+	}
+	testSetupSteps := len(commands)
+	if len(cfg.Commands.Build) == 0 {
+		commands = append(commands, []string{"npm", "run", "build"})
+	} else {
+		commands = append(commands, cfg.Commands.Build)
+	}
+	var testCommands [][]string
+	if !cfg.DontTest {
+		testCmd := []string{"npm", "test"}
+		if len(cfg.Commands.Test) > 0 {
+			testCmd = cfg.Commands.Test
+		}
+		testCommands = [][]string{testCmd}
+	}
+
+	var pkgCommands [][]string
+	switch cfg.Packaging {
+	case YarnLibrary:
+		pkgCommands = append(pkgCommands, []string{"sh", "-c", fmt.Sprintf("mv \"$(npm pack --silent | tail -n 1)\" %s", result)})
+	case YarnArchive:
+		// the archive contains node_modules, hence it can be used without network access
+		if cfg.Prune.Enabled {
+			pkgCommands = append(pkgCommands, [][]string{
+				{"npm", "prune", "--production", "--no-audit", "--no-fund"},
+				yarnPruneCommand("node_modules", cfg.Prune),
+			}...)
+		}
+		pkgCommands = append(pkgCommands, []string{"tar", "cfz", result, "."})
+	default:
+		return nil, xerrors.Errorf("unsupported npm packaging: %s", cfg.Packaging)
+	}
+
+	return &packageBuild{
+		BuildCommands:   commands,
+		SetupSteps:      setupSteps,
+		TestCommands:    testCommands,
+		TestSetupSteps:  testSetupSteps,
+		PackageCommands: pkgCommands,
+		PostBuild:       nodePostBuild(wd, ""),
+	}, nil
+}
+
+// yarnPruneCommand produces a command which removes all files matching the prune patterns from a node_modules directory
+func yarnPruneCommand(dir string, cfg YarnPruneConfig) []string {
+	// the directory and patterns are passed as arguments to the script rather than being part of it, s.t. they needn't be quoted
+	cmd := []string{"sh", "-c", `[ ! -d "$0" ] || exec find "$0" -depth "$@" ! -iname 'LICENSE*' ! -iname 'LICENCE*' -exec rm -rf {} +`, dir, "("}
+	for i, ptn := range cfg.PrunePatterns() {
+		if i > 0 {
+			cmd = append(cmd, "-o")
+		}
+		cmd = append(cmd, "-name", ptn)
+	}
+	return append(cmd, ")")
 }
 
 // buildGo implements the build process for Go packages.
@@ -1034,10 +1881,33 @@ func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packa
 		return nil, xerrors.Errorf("can only build Go modules (missing go.mod file)")
 	}
 
+	stamp, err := p.readBuildStamp(wd)
+	if err != nil {
+		return nil, err
+	}
+	if stamp != nil {
+		cfg.BuildFlags = cfg.Stamp.stampLdflags(cfg.BuildFlags, stamp)
+	}
+
 	var (
 		commands  [][]string
 		goCommand = "go"
+		env       []string
 	)
+	if cfg.Go != "" {
+		goroot, err := buildctx.goToolchain(p, cfg.Go)
+		if err != nil {
+			return nil, err
+		}
+		// commands run through sh find the pinned toolchain on the PATH. GOTOOLCHAIN=local keeps newer
+		// toolchains from switching to the toolchain the go.mod asks for.
+		goCommand = filepath.Join(goroot, "bin", "go")
+		env = append(env,
+			"GOROOT="+goroot,
+			p.Hermetic.prependPath(filepath.Join(goroot, "bin")),
+			"GOTOOLCHAIN=local",
+		)
+	}
 	if cfg.GoVersion != "" {
 		goCommand = cfg.GoVersion
 		commands = append(commands, [][]string{
@@ -1061,7 +1931,7 @@ func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packa
 				{"tar", "xfz", builtpkg, "-C", tgt},
 			}...)
 
-			if dep.Type != GoPackage {
+			if dep.Type != GoPackage || cfg.Vendor {
 				continue
 			}
 
@@ -1069,20 +1939,36 @@ func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packa
 		}
 	}
 	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
 	if cfg.Generate {
-		commands = append(commands, []string{goCommand, "generate", "-v", "./..."})
+		generateCmds, err := buildctx.goGenerateCommands(p, cfg, goCommand)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, generateCmds...)
+	}
+	if cfg.Vendor {
+		// fail with a list of all inconsistencies rather than the first one the go command finds
+		err = CheckGoVendor(wd)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, "GOFLAGS=-mod=vendor")
+	} else {
+		commands = append(commands, []string{goCommand, "mod", "download", "-x"})
 	}
-	commands = append(commands, []string{goCommand, "mod", "download", "-x"})
+	testSetupSteps := len(commands)
 
 	if !cfg.DontCheckGoFmt {
 		commands = append(commands, []string{"sh", "-c", `if [ ! $(go fmt ./... | wc -l) -eq 0 ]; then echo; echo; echo please gofmt your code; echo; echo; exit 1; fi`})
 	}
+	goFlags := cfg.goFlags()
 	if !cfg.DontLint {
-		if len(cfg.LintCommand) == 0 {
-			commands = append(commands, []string{"golangci-lint", "run"})
-		} else {
-			commands = append(commands, cfg.LintCommand)
+		lintCmds, err := buildctx.goLintCommands(p, cfg)
+		if err != nil {
+			return nil, err
 		}
+		commands = append(commands, lintCmds...)
 	}
 	if cfg.GoKart.Enabled {
 		var apiDepPtn *regexp.Regexp
@@ -1101,34 +1987,58 @@ func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packa
 		}
 		commands = append(commands, []string{"gokart", "scan", "-i", gokart.AnalyzerFilename, "-x"})
 	}
-	if !cfg.DontTest && !buildctx.DontTest {
-		testArgs := []string{goCommand, "test", "-v"}
+	var (
+		testCommands [][]string
+		testShards   [][]string
+		coverprofile string
+	)
+	if !cfg.DontTest {
 		if buildctx.buildOptions.CoverageOutputPath != "" {
-			testArgs = append(testArgs, fmt.Sprintf("-coverprofile=%v", codecovComponentName(p.FullName())))
+			coverprofile = codecovComponentName(p.FullName())
+		}
+		testArgs := []string{goCommand, "test", "-v"}
+		testArgs = append(testArgs, goFlags...)
+		if coverprofile != "" {
+			testArgs = append(testArgs, fmt.Sprintf("-coverprofile=%v", coverprofile))
 		}
+		var testFlags []string
+		if buildctx.TestFilter != "" {
+			testFlags = []string{"-run", buildctx.TestFilter}
+		}
+		testArgs = append(testArgs, testFlags...)
 
 		testArgs = append(testArgs, "./...")
 
-		commands = append(commands, [][]string{
+		if !buildctx.DontTest {
 			// we build the test binaries in addition to running the tests regularly, so that downstream packages can run the tests in different environments
-			{"sh", "-c", "mkdir _tests; for i in $(" + goCommand + " list ./...); do " + goCommand + " test -c $i; [ -e $(basename $i).test ] && mv $(basename $i).test _tests; true; done"},
-			testArgs,
-		}...)
+			commands = append(commands, []string{"sh", "-c", "mkdir _tests; for i in $(" + goCommand + " list " + strings.Join(goFlags, " ") + " ./...); do " + goCommand + " test -c " + strings.Join(goFlags, " ") + " $i; [ -e $(basename $i).test ] && mv $(basename $i).test _tests; true; done"})
+		}
+		if shards := buildctx.testShards(cfg); shards > 1 {
+			// the shards run concurrently once all build commands are done
+			testShards = goTestShardCommands(goCommand, goFlags, coverprofile, testFlags, shards)
+		} else {
+			testCommands = [][]string{testArgs}
+		}
 	}
 
 	var buildCmd []string
-	if len(cfg.BuildCommand) > 0 {
+	if len(cfg.Platforms) > 0 {
+		platformCmds, err := goPlatformBuildCommands(cfg, goCommand)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, platformCmds...)
+	} else if len(cfg.BuildCommand) > 0 {
 		buildCmd = cfg.BuildCommand
 	} else if cfg.Packaging == GoApp {
 		buildCmd = []string{goCommand, "build"}
+		buildCmd = append(buildCmd, goFlags...)
 		buildCmd = append(buildCmd, cfg.BuildFlags...)
 		buildCmd = append(buildCmd, ".")
 	}
 	if len(buildCmd) > 0 && cfg.Packaging != GoLibrary {
 		commands = append(commands, buildCmd)
 	}
-	commands = append(commands, []string{"rm", "-rf", "_deps"})
-
 	pkgCommands := [][]string{
 		{"tar", "cfz", result, "."},
 	}
@@ -1138,10 +2048,64 @@ func (p *Package) buildGo(buildctx *buildContext, wd, result string) (res *packa
 		}...)
 	}
 
-	return &packageBuild{
+	goCache, err := buildctx.goCacheFor(p, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if goCache != "" {
+		env = append(env, "GOCACHE="+goCache)
+	}
+	if cfg.Race {
+		// the race detector requires cgo, which environments for static builds often disable
+		env = append(env, "CGO_ENABLED=1")
+	}
+
+	res = &packageBuild{
 		BuildCommands:   commands,
+		SetupSteps:      setupSteps,
+		TestCommands:    testCommands,
+		TestSetupSteps:  testSetupSteps,
 		PackageCommands: pkgCommands,
-	}, nil
+		Environment:     env,
+		// the tests need the dependencies, hence they're removed only once the tests ran
+		BeforePackage: func() error {
+			return os.RemoveAll(filepath.Join(wd, "_deps"))
+		},
+	}
+	if len(testShards) > 0 {
+		res.Test = func() error {
+			return p.runGoTestShards(buildctx, wd, testShards, env, coverprofile)
+		}
+	}
+	return res, nil
+}
+
+// goCacheFor returns the GOCACHE location a Go package is built with, or an empty string if
+// the build should use the GOCACHE of the environment or the one set in the package's env.
+// The Go build cache is content-addressed and safe for concurrent use, hence sharing it only
+// saves the recompilation of unchanged packages.
+func (c *buildContext) goCacheFor(p *Package, cfg GoPkgConfig) (string, error) {
+	for _, e := range p.Environment {
+		if strings.HasPrefix(e, "GOCACHE=") {
+			return "", nil
+		}
+	}
+
+	var dir string
+	switch {
+	case c.GoCacheMode == "" || c.GoCacheMode == GoCacheOff:
+		return "", nil
+	case c.GoCacheMode == GoCacheIsolated || cfg.IsolateGoCache:
+		dir = filepath.Join(c.GoCacheDir, "isolated", p.FilesystemSafeName())
+	default:
+		dir = filepath.Join(c.GoCacheDir, "shared")
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create GOCACHE %s: %w", dir, err)
+	}
+	return dir, nil
 }
 
 // buildDocker implements the build process for Docker packages.
@@ -1155,13 +2119,34 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 	if cfg.Dockerfile == "" {
 		return nil, xerrors.Errorf("dockerfile is required")
 	}
+
+	stamp, err := p.readBuildStamp(wd)
+	if err != nil {
+		return nil, err
+	}
+	if stamp != nil {
+		cfg.Labels = stamp.stampLabels(cfg.Labels)
+	}
+	images := buildctx.DockerImageRewrite.ApplyAll(cfg.Image)
 	dockerfile := filepath.Join(p.C.Origin, cfg.Dockerfile)
 	if _, err := os.Stat(dockerfile); os.IsNotExist(err) {
 		return nil, err
 	}
 
 	var buildCommands [][]string
-	buildCommands = append(buildCommands, []string{"cp", dockerfile, "Dockerfile"})
+	if p.C.W.PinBaseImages == BaseImagePinningRewrite && len(p.baseImages) > 0 {
+		// build from the base images the version was computed from
+		fc, err := ioutil.ReadFile(dockerfile)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(filepath.Join(wd, "Dockerfile"), pinDockerfile(fc, p.baseImageFroms, p.baseImages), 0644)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		buildCommands = append(buildCommands, []string{"cp", dockerfile, "Dockerfile"})
+	}
 	for _, dep := range p.GetDependencies() {
 		fn, exists := buildctx.LocalCache.Location(dep)
 		if !exists {
@@ -1175,64 +2160,160 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		}...)
 	}
 
+	fetchCommands, err := p.fetchCommands(buildctx, cfg.Fetch)
+	if err != nil {
+		return nil, err
+	}
+	buildCommands = append(buildCommands, fetchCommands...)
 	buildCommands = append(buildCommands, p.PreparationCommands...)
+	setupSteps := len(buildCommands)
 
 	version, err := p.Version()
 	if err != nil {
 		return nil, err
 	}
 
-	buildcmd := []string{"docker", "build", "--pull", "-t", version}
-	for arg, val := range cfg.BuildArgs {
-		buildcmd = append(buildcmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
+	cli := buildctx.ContainerCLI
+	builder := buildctx.DockerBuilder
+	if len(cfg.Platforms) > 0 && (builder == DockerBuilderClassic || builder == "") {
+		// docker build cannot produce multi-arch images
+		builder = DockerBuilderBuildx
 	}
-	buildcmd = append(buildcmd, "--build-arg", fmt.Sprintf("__GIT_COMMIT=%s", p.C.Git().Commit))
-	if cfg.Squash {
-		buildcmd = append(buildcmd, "--squash")
+	if builder == DockerBuilderBuildx && cli != ContainerCLIDocker {
+		return nil, xerrors.Errorf("the %s Docker builder requires the %s container CLI, not %s", builder, ContainerCLIDocker, cli)
 	}
-	if buildctx.DockerBuildOptions != nil {
-		for opt, v := range *buildctx.DockerBuildOptions {
-			buildcmd = append(buildcmd, fmt.Sprintf("--%s=%s", opt, v))
+	if len(cfg.Platforms) > 0 && len(images) > 0 && cli != ContainerCLIDocker && !builder.daemonless() {
+		// we read the platform digests of pushed images using docker buildx imagetools
+		return nil, xerrors.Errorf("pushing multi-arch images requires the %s container CLI, not %s", ContainerCLIDocker, cli)
+	}
+
+	if builder == DockerBuilderBuildx || builder == DockerBuilderBuildKit {
+		p.downloadLayerCache(buildctx)
+	}
+
+	var buildcmd []string
+	switch builder {
+	case DockerBuilderBuildx:
+		buildcmd, err = p.buildxCommand(buildctx, cfg, version, images, strings.TrimSuffix(result, ".gz"))
+	case DockerBuilderBuildKit:
+		buildcmd, err = p.buildctlCommand(buildctx, cfg, version, images, strings.TrimSuffix(result, ".gz"))
+	case DockerBuilderKaniko:
+		buildcmd, err = p.kanikoCommand(buildctx, cfg, wd, version, images, strings.TrimSuffix(result, ".gz"))
+	case DockerBuilderBuildah:
+		buildcmd, err = p.buildahCommand(buildctx, cfg, version)
+	default:
+		buildcmd = cli.command("build", "--pull", "-t", version)
+		for arg, val := range cfg.BuildArgs {
+			buildcmd = append(buildcmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
+		}
+		buildcmd = append(buildcmd, "--build-arg", fmt.Sprintf("__GIT_COMMIT=%s", p.C.Git().Commit))
+		for _, label := range dockerLabels(cfg) {
+			buildcmd = append(buildcmd, "--label", label)
+		}
+		var secrets []string
+		secrets, err = p.dockerSecretArgs(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(secrets) > 0 && cli == ContainerCLIDocker {
+			// secrets require BuildKit, which older Docker versions do not use by default
+			buildcmd = append([]string{"env", "DOCKER_BUILDKIT=1"}, buildcmd...)
+		}
+		buildcmd = append(buildcmd, secrets...)
+		if cfg.Squash {
+			if cli == ContainerCLINerdctl {
+				return nil, xerrors.Errorf("squash is not supported by %s", cli)
+			}
+			buildcmd = append(buildcmd, "--squash")
 		}
+		if buildctx.DockerBuildOptions != nil {
+			for opt, v := range *buildctx.DockerBuildOptions {
+				buildcmd = append(buildcmd, fmt.Sprintf("--%s=%s", opt, v))
+			}
+		}
+		buildcmd = append(buildcmd, ".")
+	}
+	if err != nil {
+		return nil, err
 	}
-	buildcmd = append(buildcmd, ".")
 	buildCommands = append(buildCommands, buildcmd)
 
-	if len(cfg.Image) == 0 {
+	// buildctl exports the image itself and pushes the images without a Docker daemon. So does buildx for multi-arch images.
+	multiArch := len(cfg.Platforms) > 0
+	pushedByBuilder := builder == DockerBuilderBuildKit || builder == DockerBuilderKaniko || multiArch
+
+	if len(images) == 0 && !pushedByBuilder {
 		// we don't push the image, let's export it
 		ef := strings.TrimSuffix(result, ".gz")
-		buildCommands = append(buildCommands, [][]string{
-			{"docker", "save", "-o", ef, version},
-		}...)
+		if builder == DockerBuilderBuildah {
+			buildCommands = append(buildCommands, []string{"buildah", "push", version, fmt.Sprintf("docker-archive:%s:%s", ef, version)})
+		} else {
+			buildCommands = append(buildCommands, cli.command("save", "-o", ef, version))
+		}
 	}
 
 	res = &packageBuild{
 		BuildCommands: buildCommands,
+		SetupSteps:    setupSteps,
+		Environment:   buildctx.registryEnv,
 	}
 
 	var pkgCommands [][]string
-	if len(cfg.Image) == 0 {
-		// We've already built the build artifact by exporting the archive using "docker save"
-		// At the very least we need to add the provenance bundle to that archive.
+	if len(images) == 0 {
+		// We've already built the build artifact by exporting the image archive, either using "docker save" or the builder's export.
+		// At the very least we need to add the build info and provenance bundle to that archive.
 		ef := strings.TrimSuffix(result, ".gz")
 		res.PostBuild = dockerExportPostBuild(wd, ef)
 
-		res.PackageCommands = [][]string{
-			{"tar", "fr", ef, "./" + provenanceBundleFilename},
+		appendCmd := []string{"tar", "fr", ef, "./" + buildInfoFilename, "./" + provenanceBundleFilename}
+		var sbomCmds [][]string
+		if p.generatesSBOM() {
+			src := "docker-archive:" + ef
+			if multiArch {
+				src = "oci-archive:" + ef
+			}
+			sbomCmds = sbomCommands(src, nil, buildctx.ImageSigning)
+			appendCmd = append(appendCmd, "./"+sbomFilename)
+		}
+		if multiArch {
+			res.BeforePackage = func() error {
+				digests, err := ociArchivePlatformDigests(ef)
+				if err != nil {
+					return err
+				}
+				return writeDockerPlatforms(wd, digests)
+			}
+			appendCmd = append(appendCmd, "./"+dockerPlatformsFile)
+		}
+		res.PackageCommands = append(sbomCmds, [][]string{
+			appendCmd,
 			{"gzip", ef},
+		}...)
+	} else if len(images) > 0 {
+		if builder == DockerBuilderBuildah {
+			for _, img := range images {
+				res.PushCommands = append(res.PushCommands, []string{"buildah", "push", version, "docker://" + img})
+			}
+		} else if !pushedByBuilder {
+			for _, img := range images {
+				res.BuildCommands = append(res.BuildCommands, cli.command("tag", version, img))
+				res.PushCommands = append(res.PushCommands, cli.command("push", img))
+			}
 		}
-	} else if len(cfg.Image) > 0 {
-		for _, img := range cfg.Image {
-			pkgCommands = append(pkgCommands, [][]string{
-				{"docker", "tag", version, img},
-				{"docker", "push", img},
-			}...)
+
+		var predicate string
+		if p.C.W.Provenance.Enabled && p.C.W.Provenance.SLSA {
+			predicate = provenancePredicateFilename
+		}
+		pkgCommands = append(pkgCommands, buildctx.ImageSigning.signCommands(images, predicate)...)
+		if p.generatesSBOM() {
+			pkgCommands = append(pkgCommands, sbomCommands("registry:"+images[0], images, buildctx.ImageSigning)...)
 		}
 
 		// We pushed the image which means we won't export it. We still need to place a marker the build cache.
 		// The proper thing would be to export the image, but that's rather expensive. We'll place a tar file which
 		// contains the names of the image we just pushed instead.
-		for _, img := range cfg.Image {
+		for _, img := range images {
 			pkgCommands = append(pkgCommands,
 				[]string{"sh", "-c", fmt.Sprintf("echo %s >> %s", img, dockerImageNamesFiles)},
 				[]string{"sh", "-c", fmt.Sprintf("echo built image: %s", img)},
@@ -1246,20 +2327,61 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 		}
 		pkgCommands = append(pkgCommands, []string{"sh", "-c", fmt.Sprintf("echo %s | base64 -d > %s", base64.StdEncoding.EncodeToString(consts), dockerMetadataFile)})
 
-		archiveCmd := []string{"tar", "cfz", result, "./" + dockerImageNamesFiles, "./" + dockerMetadataFile}
+		archiveCmd := []string{"tar", "cfz", result, "./" + dockerImageNamesFiles, "./" + dockerMetadataFile, "./" + buildInfoFilename}
+		if !buildctx.DockerImageRewrite.IsEmpty() {
+			rewrites, err := yaml.Marshal(dockerImageRewrites(cfg.Image, images))
+			if err != nil {
+				return nil, err
+			}
+			pkgCommands = append(pkgCommands, []string{"sh", "-c", fmt.Sprintf("echo %s | base64 -d > %s", base64.StdEncoding.EncodeToString(rewrites), dockerImageRewritesFile)})
+			archiveCmd = append(archiveCmd, "./"+dockerImageRewritesFile)
+		}
+		if multiArch {
+			archiveCmd = append(archiveCmd, "./"+dockerPlatformsFile)
+		}
 		if p.C.W.Provenance.Enabled {
 			archiveCmd = append(archiveCmd, "./"+provenanceBundleFilename)
 		}
+		if p.generatesSBOM() {
+			archiveCmd = append(archiveCmd, "./"+sbomFilename)
+		}
 		pkgCommands = append(pkgCommands, archiveCmd)
 
 		res.PackageCommands = pkgCommands
+		if multiArch {
+			var digests *DockerPlatformDigests
+			res.BeforePackage = func() (err error) {
+				digests, err = registryPlatformDigests(images[0], buildctx.registryEnv)
+				if err != nil {
+					return err
+				}
+				return writeDockerPlatforms(wd, digests)
+			}
+			res.Subjects = func() ([]in_toto.Subject, error) {
+				return digests.Subjects(images)
+			}
+			return res, nil
+		}
+		if builder.daemonless() {
+			res.Subjects = func() ([]in_toto.Subject, error) {
+				return daemonlessSubjects(wd, images)
+			}
+			return res, nil
+		}
+		if pushedByBuilder {
+			res.Subjects = func() ([]in_toto.Subject, error) {
+				return buildKitSubjects(wd, images)
+			}
+			return res, nil
+		}
 		res.Subjects = func() (res []in_toto.Subject, err error) {
 			defer func() {
 				if err != nil {
 					err = xerrors.Errorf("provenance get subjects: %w", err)
 				}
 			}()
-			out, err := exec.Command("docker", "inspect", version).CombinedOutput()
+			insp := cli.command("image", "inspect", version)
+			out, err := exec.Command(insp[0], insp[1:]...).CombinedOutput()
 			if err != nil {
 				return nil, xerrors.Errorf("cannot determine ID of the image we just built")
 			}
@@ -1273,16 +2395,21 @@ func (p *Package) buildDocker(buildctx *buildContext, wd, result string) (res *p
 			if len(inspectRes) == 0 {
 				return nil, xerrors.Errorf("did not receive a proper Docker inspect response")
 			}
-			segs := strings.Split(inspectRes[0].ID, ":")
+			id := inspectRes[0].ID
+			if cli == ContainerCLIPodman && !strings.Contains(id, ":") {
+				// podman reports image IDs without the algorithm
+				id = "sha256:" + id
+			}
+			segs := strings.Split(id, ":")
 			if len(segs) != 2 {
-				return nil, xerrors.Errorf("docker inspect returned invalid digest: %s", inspectRes[0].ID)
+				return nil, xerrors.Errorf("%s inspect returned invalid digest: %s", cli, inspectRes[0].ID)
 			}
 			digest := in_toto.DigestSet{
 				segs[0]: segs[1],
 			}
 
-			res = make([]in_toto.Subject, 0, len(cfg.Image))
-			for _, tag := range cfg.Image {
+			res = make([]in_toto.Subject, 0, len(images))
+			for _, tag := range images {
 				res = append(res, in_toto.Subject{
 					Name:   tag,
 					Digest: digest,
@@ -1337,24 +2464,27 @@ func dockerExportPostBuild(builddir, result string) func(sources fileset) (subj
 // buildGeneric implements the build process for generic packages.
 // If you change anything in this process that's not backwards compatible, make sure you increment BuildGenericProccessVersion.
 func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	if p.script != nil {
+		return p.buildScript(buildctx, wd, result)
+	}
+
 	cfg, ok := p.Config.(GenericPkgConfig)
 	if !ok {
 		return nil, xerrors.Errorf("package should have generic config")
 	}
 
 	// shortcut: no command == empty package
-	if len(cfg.Commands) == 0 && len(cfg.Test) == 0 {
-		log.WithField("package", p.FullName()).Debug("package has no commands nor test - creating empty tar")
+	if len(cfg.Commands) == 0 && len(cfg.Test) == 0 && len(cfg.Fetch) == 0 {
+		log.WithField("package", p.FullName()).Debug("package has no commands nor test - creating tar with build info only")
 
+		archiveCmd := []string{"tar", "cfz", result, "./" + buildInfoFilename}
 		// if provenance is enabled, we have to make sure we capture the bundle
 		if p.C.W.Provenance.Enabled {
-			return &packageBuild{
-				PackageCommands: [][]string{{"tar", "cfz", result, "./" + provenanceBundleFilename}},
-			}, nil
+			archiveCmd = append(archiveCmd, "./"+provenanceBundleFilename)
 		}
 
 		return &packageBuild{
-			PackageCommands: [][]string{{"tar", "cfz", result, "--files-from", "/dev/null"}},
+			PackageCommands: [][]string{archiveCmd},
 		}, nil
 	}
 
@@ -1372,30 +2502,298 @@ func (p *Package) buildGeneric(buildctx *buildContext, wd, result string) (res *
 		}...)
 	}
 
+	fetchCommands, err := p.fetchCommands(buildctx, cfg.Fetch)
+	if err != nil {
+		return nil, err
+	}
+	commands = append(commands, fetchCommands...)
 	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
 	commands = append(commands, cfg.Commands...)
-	if !cfg.DontTest && !buildctx.DontTest {
-		commands = append(commands, cfg.Test...)
+	var testCommands [][]string
+	if !cfg.DontTest {
+		testCommands = cfg.Test
+	}
+	// the tests of generic packages may well check what the commands produced, hence they need all of them
+	testSetupSteps := len(commands)
+
+	if len(cfg.Outputs) == 0 {
+		return &packageBuild{
+			BuildCommands:   commands,
+			SetupSteps:      setupSteps,
+			TestCommands:    testCommands,
+			TestSetupSteps:  testSetupSteps,
+			PackageCommands: [][]string{{"tar", "cfz", result, "."}},
+		}, nil
+	}
+
+	var outputs []string
+	return &packageBuild{
+		BuildCommands:   commands,
+		SetupSteps:      setupSteps,
+		TestCommands:    testCommands,
+		TestSetupSteps:  testSetupSteps,
+		PackageCommands: [][]string{{"tar", "cfz", result, "--files-from", genericOutputsFile}},
+		BeforePackage: func() error {
+			var err error
+			outputs, err = resolveOutputs(wd, cfg.Outputs)
+			if err != nil {
+				return err
+			}
+
+			files := append([]string{"./" + buildInfoFilename}, outputs...)
+			if p.C.W.Provenance.Enabled {
+				files = append(files, "./"+provenanceBundleFilename)
+			}
+			return ioutil.WriteFile(filepath.Join(wd, genericOutputsFile), []byte(strings.Join(files, "\n")+"\n"), 0644)
+		},
+		PostBuild: func(sources fileset) ([]in_toto.Subject, string, error) {
+			fset := make(fileset, len(outputs))
+			for _, out := range outputs {
+				fset[strings.TrimPrefix(out, ".")] = struct{}{}
+			}
+			subj, err := fset.Subjects(wd)
+			return subj, wd, err
+		},
+	}, nil
+}
+
+// resolveOutputs finds all files in wd matching the output globs. Every glob must match at least one file.
+// The resulting paths are relative to wd and start with ./
+func resolveOutputs(wd string, globs []string) ([]string, error) {
+	idx := make(map[string]struct{})
+	for _, glb := range globs {
+		matches, err := doublestar.Glob(wd, glb, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var found bool
+		for _, m := range matches {
+			if stat, err := os.Stat(m); err != nil || stat.IsDir() {
+				continue
+			}
+			found = true
+			idx["./"+strings.TrimPrefix(m, wd+"/")] = struct{}{}
+		}
+		if !found {
+			return nil, xerrors.Errorf("declared output %q was not produced by the build", glb)
+		}
+	}
+
+	res := make([]string, 0, len(idx))
+	for fn := range idx {
+		res = append(res, fn)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// buildMeta implements the build process for meta packages. The build artifact contains the build artifacts
+// of all dependencies at their layout location, next to the package's own sources.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildMeta(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	var commands [][]string
+	for _, dep := range p.GetDependencies() {
+		fn, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return nil, PkgNotBuiltErr{dep}
+		}
+
+		tgt := p.BuildLayoutLocation(dep)
+		commands = append(commands, [][]string{
+			{"mkdir", "-p", tgt},
+			{"tar", "xfz", fn, "-C", tgt},
+		}...)
 	}
+	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
 
 	return &packageBuild{
 		BuildCommands:   commands,
+		SetupSteps:      setupSteps,
 		PackageCommands: [][]string{{"tar", "cfz", result, "."}},
 	}, nil
 }
 
+// buildPlugin implements the build process for plugin packages. Bhojpur GoRPA prepares the build directory
+// like it does for generic packages, and runs the commands the plugin plans for the build.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildPlugin(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	cfg, ok := p.Config.(PluginPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have plugin config")
+	}
+	plugin, ok := p.C.W.Plugins[cfg.Plugin]
+	if !ok {
+		return nil, xerrors.Errorf("unknown plugin %q", cfg.Plugin)
+	}
+
+	var (
+		commands [][]string
+		deps     []PluginBuildDependency
+	)
+	for _, dep := range p.GetDependencies() {
+		fn, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return nil, PkgNotBuiltErr{dep}
+		}
+		version, err := dep.Version()
+		if err != nil {
+			return nil, err
+		}
+
+		tgt := p.BuildLayoutLocation(dep)
+		commands = append(commands, [][]string{
+			{"mkdir", tgt},
+			{"tar", "xfz", fn, "-C", tgt},
+		}...)
+		deps = append(deps, PluginBuildDependency{
+			FullName: dep.FullName(),
+			Type:     dep.Type,
+			Version:  version,
+			Location: tgt,
+		})
+	}
+	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
+
+	resp, err := plugin.Invoke(PluginPhaseBuild, PluginRequest{
+		Package: p.pluginPackageInfo(),
+		Build: &PluginBuildInfo{
+			Dir:          wd,
+			Result:       result,
+			DontTest:     buildctx.DontTest,
+			Dependencies: deps,
+		},
+	}, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	commands = append(commands, resp.Build...)
+
+	pkgCommands := resp.Package
+	if len(pkgCommands) == 0 {
+		pkgCommands = [][]string{{"tar", "cfz", result, "."}}
+	}
+
+	return &packageBuild{
+		BuildCommands:   commands,
+		SetupSteps:      setupSteps,
+		TestCommands:    resp.Test,
+		PackageCommands: pkgCommands,
+		Environment:     resp.Env,
+	}, nil
+}
+
+// buildProto implements the build process for proto packages. Only the generated code ends up in the
+// build artifact, s.t. dependent packages can place it wherever they need it using their layout.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildProto(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	cfg, ok := p.Config.(ProtoPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have proto config")
+	}
+
+	var (
+		commands [][]string
+		includes []string
+	)
+	for _, dep := range p.GetDependencies() {
+		fn, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return nil, PkgNotBuiltErr{dep}
+		}
+
+		tgt := p.BuildLayoutLocation(dep)
+		commands = append(commands, [][]string{
+			{"mkdir", "-p", tgt},
+			{"tar", "xfz", fn, "-C", tgt},
+		}...)
+		includes = append(includes, tgt)
+	}
+	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
+	commands = append(commands, []string{"mkdir", "-p", cfg.Output})
+
+	switch cfg.Generator {
+	case ProtoGeneratorProtoc:
+		var files []string
+		for _, src := range p.Sources {
+			if !strings.HasSuffix(src, ".proto") {
+				continue
+			}
+			files = append(files, strings.TrimPrefix(src, p.C.Origin+"/"))
+		}
+		if len(files) == 0 {
+			return nil, xerrors.Errorf("%s: proto packages must have .proto files among their sources", p.FullName())
+		}
+		commands = append(commands, protocCommands(cfg, append(includes, cfg.IncludePaths...), files)...)
+	case ProtoGeneratorBuf:
+		commands = append(commands, []string{"buf", "generate", "--template", cfg.bufTemplate(), "-o", cfg.Output, filepath.Dir(cfg.bufConfig())})
+	default:
+		return nil, xerrors.Errorf("unknown proto generator: %s", cfg.Generator)
+	}
+
+	outdir := filepath.Join(wd, cfg.Output)
+	return &packageBuild{
+		BuildCommands: commands,
+		SetupSteps:    setupSteps,
+		PackageCommands: [][]string{
+			// the build info goes into the artifact, but not into the generated code
+			{"tar", "cfz", result, "-C", cfg.Output, ".", "-C", wd, "./" + buildInfoFilename},
+		},
+		PostBuild: func(sources fileset) (subj []in_toto.Subject, absResultDir string, err error) {
+			generated, err := computeFileset(outdir)
+			if err != nil {
+				return nil, outdir, err
+			}
+			subj, err = generated.Subjects(outdir)
+			return subj, outdir, err
+		},
+	}, nil
+}
+
+// protocCommands produces the commands which run protoc with all configured plugins
+func protocCommands(cfg ProtoPkgConfig, includes, files []string) [][]string {
+	var (
+		res  [][]string
+		args = []string{"protoc", "-I."}
+	)
+	for _, inc := range includes {
+		args = append(args, "-I"+inc)
+	}
+	for _, plugin := range cfg.Plugins {
+		out := filepath.Join(cfg.Output, plugin.Out)
+		res = append(res, []string{"mkdir", "-p", out})
+
+		args = append(args, fmt.Sprintf("--%s_out=%s", plugin.Name, out))
+		for _, opt := range plugin.Opt {
+			args = append(args, fmt.Sprintf("--%s_opt=%s", plugin.Name, opt))
+		}
+		if plugin.Path != "" {
+			args = append(args, fmt.Sprintf("--plugin=protoc-gen-%s=%s", plugin.Name, plugin.Path))
+		}
+	}
+	args = append(args, files...)
+	return append(res, args)
+}
+
 // retagDocker is called when we already have the build artifact for this package (and version)
 // in the build cache. This function makes sure that if the build arguments changed the name of the
 // Docker image this build time, we just re-tag the image.
 func (p *Package) retagDocker(buildctx *buildContext, wd, prev string) (err error) {
-	buildctx.LimitConcurrentBuilds()
-	defer buildctx.ReleaseConcurrentBuild()
+	// re-tagging is cheap, no matter the resources the package build needs
+	buildctx.LimitConcurrentBuilds(ResourceLimits{})
+	defer buildctx.ReleaseConcurrentBuild(ResourceLimits{})
 
 	cfg, ok := p.Config.(DockerPkgConfig)
 	if !ok {
 		return xerrors.Errorf("package should have Docker config")
 	}
-	if len(cfg.Image) == 0 {
+	images := buildctx.DockerImageRewrite.ApplyAll(cfg.Image)
+	if len(images) == 0 {
 		// this is not a pushed Docker image and as such needs no re-use
 		log.WithField("package", p.FullName()).Debug("already built")
 		return
@@ -1415,11 +2813,20 @@ func (p *Package) retagDocker(buildctx *buildContext, wd, prev string) (err erro
 		return xerrors.Errorf("build artifact is invalid")
 	}
 
-	commands := [][]string{
-		{"docker", "pull", names[0]},
+	var (
+		cli        = buildctx.ContainerCLI
+		daemonless = buildctx.DockerBuilder.daemonless()
+	)
+	if len(cfg.Platforms) > 0 && cli != ContainerCLIDocker && !daemonless {
+		return xerrors.Errorf("retagging multi-arch images requires the %s container CLI, not %s", ContainerCLIDocker, cli)
+	}
+
+	var commands, pushes [][]string
+	if len(cfg.Platforms) == 0 && !daemonless {
+		commands = append(commands, cli.command("pull", names[0]))
 	}
-	var needsRetagging bool
-	for _, img := range cfg.Image {
+	var retagged []string
+	for _, img := range images {
 		var found bool
 		for _, nme := range names {
 			if nme == img {
@@ -1431,13 +2838,21 @@ func (p *Package) retagDocker(buildctx *buildContext, wd, prev string) (err erro
 			continue
 		}
 
-		needsRetagging = true
-		commands = append(commands, [][]string{
-			{"docker", "tag", names[0], img},
-			{"docker", "push", img},
-		}...)
+		retagged = append(retagged, img)
+		if daemonless {
+			// without a daemon there is nothing to tag locally, hence we copy the image within the registry
+			pushes = append(pushes, []string{"skopeo", "copy", "--all", "docker://" + names[0], "docker://" + img})
+			continue
+		}
+		if len(cfg.Platforms) > 0 {
+			// pulling a multi-arch image yields a single platform only, hence we copy the manifest list in the registry
+			pushes = append(pushes, []string{"docker", "buildx", "imagetools", "create", "-t", img, names[0]})
+			continue
+		}
+		commands = append(commands, cli.command("tag", names[0], img))
+		pushes = append(pushes, cli.command("push", img))
 	}
-	if !needsRetagging {
+	if len(retagged) == 0 {
 		log.WithField("package", p.FullName()).Debug("already built")
 		return
 	}
@@ -1447,39 +2862,117 @@ func (p *Package) retagDocker(buildctx *buildContext, wd, prev string) (err erro
 		buildctx.Reporter.PackageBuildFinished(p, *err)
 	}(&err)
 
-	err = executeCommandsForPackage(buildctx, p, wd, commands)
+	err = executeCommandsForPackage(buildctx, p, wd, commands, buildctx.registryEnv)
+	if err != nil {
+		return err
+	}
+	err = executePushCommands(buildctx, p, wd, pushes, buildctx.registryEnv)
+	if err != nil {
+		return err
+	}
+	// the provenance of the original build is in the cached artifact only, hence we sign but don't attest
+	err = executeCommandsForPackage(buildctx, p, wd, buildctx.ImageSigning.signCommands(retagged, ""), buildctx.registryEnv)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func executeCommandsForPackage(buildctx *buildContext, p *Package, wd string, commands [][]string) error {
-	env := append(os.Environ(), p.Environment...)
+func executeCommandsForPackage(buildctx *buildContext, p *Package, wd string, commands [][]string, extraEnv []string) error {
+	return executeCommandsWithReporter(buildctx, buildctx.Reporter, p, wd, commands, extraEnv)
+}
+
+// executeCommandsWithReporter runs the commands like executeCommandsForPackage, but sends their output to rep
+func executeCommandsWithReporter(buildctx *buildContext, rep Reporter, p *Package, wd string, commands [][]string, extraEnv []string) error {
+	env := append(p.environ(), extraEnv...)
+	cgroup := buildctx.cgroups.Get(p)
+	deadline := buildctx.deadlines.Get(p)
 	for _, cmd := range commands {
-		err := run(buildctx.Reporter, p, env, wd, cmd[0], cmd[1:]...)
+		var (
+			name, args = cmd[0], cmd[1:]
+			output     *sandboxOutput
+			sandboxed  func()
+		)
+		name, err := p.Hermetic.lookPath(name)
+		if err != nil {
+			return err
+		}
+		if buildctx.Sandbox {
+			name, args, sandboxed, err = buildctx.sandbox.Command(p, buildctx.BuildDir(), wd, name, args...)
+			if err != nil {
+				return err
+			}
+			output = &sandboxOutput{Reporter: rep}
+		}
+		if cgroup != nil {
+			name, args = cgroup.Command(name, args...)
+		}
+		if output != nil {
+			err = run(output, p, deadline, env, wd, name, args...)
+		} else {
+			err = run(rep, p, deadline, env, wd, name, args...)
+		}
+		if sandboxed != nil {
+			sandboxed()
+		}
 		if err != nil {
+			if cgroup != nil {
+				err = cgroup.Violation(p, err)
+			}
+			if output != nil {
+				err = buildctx.sandbox.Violation(p, buildctx.BuildDir(), wd, output.buf, err)
+			}
 			return err
 		}
 	}
 	return nil
 }
 
-func run(rep Reporter, p *Package, env []string, cwd, name string, args ...string) error {
-	log.WithField("command", strings.Join(append([]string{name}, args...), " ")).Debug("running")
+// run runs a command and reports its output. If there is a deadline, the command and all processes it started are
+// killed if it has not finished by then. To this end the command runs in its own process group, which no longer
+// receives the signals of the terminal, hence we forward interrupts to it.
+func run(rep Reporter, p *Package, deadline *phaseDeadline, env []string, cwd, name string, args ...string) error {
+	var remaining time.Duration
+	if deadline != nil {
+		remaining = time.Until(deadline.At)
+		if remaining <= 0 {
+			return TimeoutErr{Package: p, Phase: deadline.Phase, Timeout: deadline.Timeout}
+		}
+	}
+	log.WithField("command", strings.Join(append([]string{name}, args...), " ")).WithField("timeout", remaining).Debug("running")
 
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = &reporterStream{R: rep, P: p, IsErr: false}
 	cmd.Stderr = &reporterStream{R: rep, P: p, IsErr: true}
 	cmd.Dir = cwd
 	cmd.Env = env
-	err := cmd.Run()
+	if deadline == nil {
+		return cmd.Run()
+	}
 
+	setProcessGroup(cmd)
+	err := cmd.Start()
 	if err != nil {
 		return err
 	}
+	untrack := trackProcessGroup(cmd)
+	defer untrack()
 
-	return nil
+	var expired int32
+	timer := time.AfterFunc(remaining, func() {
+		atomic.StoreInt32(&expired, 1)
+		rep.PackageBuildLog(p, true, []byte(fmt.Sprintf("\n%s timed out after %s - killing %s\n", deadline.Phase, deadline.Timeout, name)))
+		err := killProcessGroup(cmd)
+		if err != nil {
+			log.WithError(err).WithField("package", p.FullName()).Warn("cannot kill timed out command")
+		}
+	})
+	err = cmd.Wait()
+	timer.Stop()
+	if atomic.LoadInt32(&expired) == 1 {
+		return TimeoutErr{Package: p, Phase: deadline.Phase, Timeout: deadline.Timeout, Err: err}
+	}
+	return err
 }
 
 type reporterStream struct {
@@ -21,7 +21,14 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestCodecovComponentName(t *testing.T) {
@@ -43,3 +50,186 @@ func TestCodecovComponentName(t *testing.T) {
 		}
 	}
 }
+
+func TestProtocCommands(t *testing.T) {
+	cfg := ProtoPkgConfig{
+		Generator: ProtoGeneratorProtoc,
+		Output:    "gen",
+		Plugins: []ProtoPlugin{
+			{Name: "go", Out: "go", Opt: []string{"paths=source_relative"}},
+			{Name: "ts", Out: "ts", Path: "node_modules/.bin/protoc-gen-ts"},
+		},
+	}
+	expectation := [][]string{
+		{"mkdir", "-p", "gen/go"},
+		{"mkdir", "-p", "gen/ts"},
+		{"protoc", "-I.", "-Icomp--common", "--go_out=gen/go", "--go_opt=paths=source_relative", "--ts_out=gen/ts", "--plugin=protoc-gen-ts=node_modules/.bin/protoc-gen-ts", "api/v1/api.proto"},
+	}
+
+	act := protocCommands(cfg, []string{"comp--common"}, []string{"api/v1/api.proto"})
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("protocCommands() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveOutputs(t *testing.T) {
+	wd := t.TempDir()
+	for _, fn := range []string{"dist/a.js", "dist/sub/b.js", "dist/sub/b.map", "junk.o"} {
+		fn = filepath.Join(wd, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(fn), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	act, err := resolveOutputs(wd, []string{"dist/**/*.js", "dist/a.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"./dist/a.js", "./dist/sub/b.js"}, act); diff != "" {
+		t.Errorf("resolveOutputs() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = resolveOutputs(wd, []string{"dist/**/*.js", "build/**"})
+	if err == nil {
+		t.Errorf("expected an error for an output which was not produced")
+	}
+}
+
+func TestYarnPruneCommand(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		modules  = filepath.Join(dir, "node_modules")
+		injected = filepath.Join(dir, "injected")
+		files    = map[string]bool{
+			"lib/index.js":        true,
+			"lib/README.md":       false,
+			"lib/LICENSE.md":      true,
+			"lib/test/index.js":   false,
+			"lib/it's-pruned.txt": false,
+			"lib/keep.map":        true,
+		}
+	)
+	for fn := range files {
+		fn = filepath.Join(modules, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := yarnPruneCommand("node_modules", YarnPruneConfig{
+		Enabled:  true,
+		Patterns: []string{"it's-*", "'; touch " + injected + "; '", "$(touch " + injected + ")"},
+		Keep:     []string{"*.map"},
+	})
+	for _, d := range []string{dir, t.TempDir()} {
+		// the second run makes sure a missing node_modules directory is not an error
+		c := exec.Command(cmd[0], cmd[1:]...)
+		c.Dir = d
+		out, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("prune command failed: %v: %s", err, out)
+		}
+	}
+
+	for fn, exists := range files {
+		if _, err := os.Stat(filepath.Join(modules, fn)); (err == nil) != exists {
+			t.Errorf("expected %s to exist: %v", fn, exists)
+		}
+	}
+	if _, err := os.Stat(injected); err == nil {
+		t.Errorf("prune patterns were executed by the shell")
+	}
+}
+
+func TestGoCacheFor(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		Name        string
+		Mode        GoCacheMode
+		Config      GoPkgConfig
+		Env         []string
+		Expectation string
+	}{
+		{Name: "default", Expectation: ""},
+		{Name: "off", Mode: GoCacheOff, Expectation: ""},
+		{Name: "shared", Mode: GoCacheShared, Expectation: filepath.Join(dir, "shared")},
+		{Name: "isolated", Mode: GoCacheIsolated, Expectation: filepath.Join(dir, "isolated", "comp--pkg")},
+		{Name: "isolated package", Mode: GoCacheShared, Config: GoPkgConfig{IsolateGoCache: true}, Expectation: filepath.Join(dir, "isolated", "comp--pkg")},
+		{Name: "package env", Mode: GoCacheShared, Env: []string{"FOO=bar", "GOCACHE=/own/cache"}, Expectation: ""},
+		{Name: "package env isolated", Mode: GoCacheIsolated, Config: GoPkgConfig{IsolateGoCache: true}, Env: []string{"GOCACHE=/own/cache"}, Expectation: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			pkg := testPackage(&Application{}, "pkg", GoPackage)
+			pkg.Environment = test.Env
+			buildctx := &buildContext{buildOptions: buildOptions{GoCacheMode: test.Mode, GoCacheDir: dir}}
+
+			act, err := buildctx.goCacheFor(pkg, test.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act != test.Expectation {
+				t.Errorf("expected GOCACHE %q, got %q", test.Expectation, act)
+			}
+			if act == "" {
+				return
+			}
+			if _, err := os.Stat(act); err != nil {
+				t.Errorf("expected GOCACHE to exist: %v", err)
+			}
+		})
+	}
+}
+
+func TestWarm(t *testing.T) {
+	var (
+		ba        = &Application{}
+		primary   = testPackage(ba, "primary", GenericPackage)
+		secondary = testPackage(ba, "secondary", GenericPackage)
+		ephemeral = testPackage(ba, "ephemeral", GenericPackage)
+		uncached  = testPackage(ba, "uncached", GenericPackage)
+		app       = testPackage(ba, "app", GenericPackage, primary, secondary, ephemeral, uncached)
+		local     = &FilesystemCache{Origin: t.TempDir()}
+		remotes   = []dirRemoteCache{{Dir: t.TempDir()}, {Dir: t.TempDir()}}
+	)
+	ephemeral.Ephemeral = true
+	for i, p := range []*Package{primary, secondary, ephemeral} {
+		fn, _ := local.Location(p)
+		err := ioutil.WriteFile(filepath.Join(remotes[i%2].Dir, filepath.Base(fn)), []byte(p.Name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	available, missing, err := Warm([]*Package{app, primary}, WithLocalCache(local), WithRemoteCache(remotes[0]), WithAdditionalRemoteCaches([]RemoteCache{remotes[1]}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(pkgs []*Package) []string {
+		res := make([]string, 0, len(pkgs))
+		for _, p := range pkgs {
+			res = append(res, p.Name)
+		}
+		sort.Strings(res)
+		return res
+	}
+	if diff := cmp.Diff([]string{"primary", "secondary"}, names(available)); diff != "" {
+		t.Errorf("unexpected available packages (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"app", "uncached"}, names(missing)); diff != "" {
+		t.Errorf("unexpected missing packages (-want +got):\n%s", diff)
+	}
+	if _, exists := local.Location(ephemeral); exists {
+		t.Errorf("ephemeral package was downloaded")
+	}
+}
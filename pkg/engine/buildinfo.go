@@ -0,0 +1,160 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bhojpur/gorpa/pkg/version"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// buildInfoFilename is the name of the build-info file we place in the build directory
+	// of every package prior to building it, and subsequently in every build artifact.
+	buildInfoFilename = ".gorpa-buildinfo.json"
+
+	// EnvvarSourceDateEpoch is the build time recorded in the build info as Unix timestamp, see https://reproducible-builds.org/specs/source-date-epoch/
+	EnvvarSourceDateEpoch = "SOURCE_DATE_EPOCH"
+)
+
+// ErrNoBuildInfo is returned when a build artifact does not contain a build-info file,
+// e.g. because it was built by an older version of Bhojpur GoRPA.
+var ErrNoBuildInfo = fmt.Errorf("no build info found")
+
+// BuildInfo describes how and from what a build artifact was produced
+type BuildInfo struct {
+	Package      string     `json:"package" yaml:"package"`
+	Type         string     `json:"type" yaml:"type"`
+	Version      string     `json:"version" yaml:"version"`
+	GitCommit    string     `json:"gitCommit,omitempty" yaml:"gitCommit,omitempty"`
+	GitDirty     bool       `json:"gitDirty,omitempty" yaml:"gitDirty,omitempty"`
+	Variant      string     `json:"variant,omitempty" yaml:"variant,omitempty"`
+	BuildTime    *time.Time `json:"buildTime,omitempty" yaml:"buildTime,omitempty"`
+	GorpaVersion string     `json:"gorpaVersion" yaml:"gorpaVersion"`
+}
+
+// newBuildInfo produces the build info for a package build that started at buildStarted, unless SOURCE_DATE_EPOCH
+// sets the build time. Like the provenance, the build info records the build which produced the artifact: the version
+// of a package doesn't depend on the build time nor the Git commit, hence all builds of the version share the artifact
+// of the first one. Reproducibility checks ignore the build info for this reason.
+func (p *Package) newBuildInfo(buildStarted time.Time) (*BuildInfo, error) {
+	pkgVersion, err := p.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BuildInfo{
+		Package:      p.FullName(),
+		Type:         string(p.Type),
+		Version:      pkgVersion,
+		GorpaVersion: version.Version,
+	}
+	if epoch := os.Getenv(EnvvarSourceDateEpoch); epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid %s: %w", EnvvarSourceDateEpoch, err)
+		}
+		t := time.Unix(secs, 0).UTC()
+		res.BuildTime = &t
+	} else {
+		t := buildStarted.UTC()
+		res.BuildTime = &t
+	}
+	if git := p.C.Git(); git != nil {
+		res.GitCommit = git.Commit
+		res.GitDirty = git.Dirty
+	}
+	if vnt := p.C.W.SelectedVariant; vnt != nil {
+		res.Variant = vnt.Name
+	}
+	return res, nil
+}
+
+// writeBuildInfo writes the build-info file of a package to its build directory
+func writeBuildInfo(p *Package, builddir string, buildStarted time.Time) error {
+	nfo, err := p.newBuildInfo(buildStarted)
+	if err != nil {
+		return xerrors.Errorf("cannot write build info for %s: %w", p.FullName(), err)
+	}
+
+	fc, err := json.MarshalIndent(nfo, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("cannot write build info for %s: %w", p.FullName(), err)
+	}
+	err = ioutil.WriteFile(filepath.Join(builddir, buildInfoFilename), fc, 0644)
+	if err != nil {
+		return xerrors.Errorf("cannot write build info for %s: %w", p.FullName(), err)
+	}
+	return nil
+}
+
+// ReadBuildInfoFromCachedArchive reads the build-info file from a cached build artifact.
+// If the artifact does not contain such a file, ErrNoBuildInfo is returned.
+func ReadBuildInfoFromCachedArchive(fn string) (res *BuildInfo, err error) {
+	defer func() {
+		if err != nil && err != ErrNoBuildInfo {
+			err = xerrors.Errorf("error reading build info from %s: %w", fn, err)
+		}
+	}()
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+
+	a := tar.NewReader(g)
+	for {
+		hdr, err := a.Next()
+		if err == io.EOF {
+			return nil, ErrNoBuildInfo
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name != "./"+buildInfoFilename && hdr.Name != "package/"+buildInfoFilename {
+			continue
+		}
+
+		var nfo BuildInfo
+		err = json.NewDecoder(io.LimitReader(a, hdr.Size)).Decode(&nfo)
+		if err != nil {
+			return nil, err
+		}
+		return &nfo, nil
+	}
+}
@@ -0,0 +1,90 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteBuildInfo(t *testing.T) {
+	started := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Name        string
+		Stamp       bool
+		Epoch       string
+		Expectation *time.Time
+	}{
+		{Name: "build time", Expectation: &started},
+		{Name: "stamped", Stamp: true, Expectation: &started},
+		{Name: "source date epoch", Stamp: true, Epoch: "1609459200", Expectation: timePtr(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			t.Setenv(EnvvarSourceDateEpoch, test.Epoch)
+			pkg := testPackage(&Application{Provenance: ApplicationProvenance{Stamp: test.Stamp}}, "pkg", GenericPackage)
+
+			dir := t.TempDir()
+			err := writeBuildInfo(pkg, dir, started)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fc, err := ioutil.ReadFile(filepath.Join(dir, buildInfoFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var nfo BuildInfo
+			err = json.Unmarshal(fc, &nfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nfo.Package != "comp:pkg" {
+				t.Errorf("unexpected package %q", nfo.Package)
+			}
+			if (nfo.BuildTime == nil) != (test.Expectation == nil) || (nfo.BuildTime != nil && !nfo.BuildTime.Equal(*test.Expectation)) {
+				t.Errorf("expected build time %v, got %v", test.Expectation, nfo.BuildTime)
+			}
+		})
+	}
+
+	t.Run("package with its own buildinfo.json", func(t *testing.T) {
+		dir := t.TempDir()
+		err := ioutil.WriteFile(filepath.Join(dir, "buildinfo.json"), []byte("{}"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeBuildInfo(testPackage(&Application{}, "pkg", GenericPackage), dir, started)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fc, _ := ioutil.ReadFile(filepath.Join(dir, "buildinfo.json"))
+		if string(fc) != "{}" {
+			t.Errorf("the package's buildinfo.json was overwritten: %s", fc)
+		}
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
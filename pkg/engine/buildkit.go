@@ -0,0 +1,318 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// DockerBuilder determines the tool Docker packages are built with
+type DockerBuilder string
+
+const (
+	// DockerBuilderClassic builds images using "docker build"
+	DockerBuilderClassic DockerBuilder = "docker"
+	// DockerBuilderBuildx builds images using "docker buildx build" and loads them into the Docker daemon
+	DockerBuilderBuildx DockerBuilder = "buildx"
+	// DockerBuilderBuildKit builds images using buildctl against a buildkitd. Images are pushed by BuildKit
+	// directly, i.e. no Docker daemon is required for building.
+	DockerBuilderBuildKit DockerBuilder = "buildkit"
+	// DockerBuilderKaniko builds images using the kaniko executor, which pushes the images itself.
+	// Neither a Docker daemon nor a privileged container is required.
+	DockerBuilderKaniko DockerBuilder = "kaniko"
+	// DockerBuilderBuildah builds and pushes images using buildah, without a Docker daemon
+	DockerBuilderBuildah DockerBuilder = "buildah"
+)
+
+// daemonless returns true if the builder does not need a Docker daemon for building, pushing or retagging images
+func (b DockerBuilder) daemonless() bool {
+	return b == DockerBuilderKaniko || b == DockerBuilderBuildah
+}
+
+// BuildKitCacheMode determines how BuildKit based builds import and export their layer cache
+type BuildKitCacheMode string
+
+const (
+	// BuildKitCacheInline embeds the cache metadata in pushed images and imports the cache from the
+	// images a package pushes. Packages which do not push images are built without cache import/export.
+	BuildKitCacheInline BuildKitCacheMode = "inline"
+	// BuildKitCacheLocal exports the full layer cache of each package to a directory in the local cache.
+	// Buildx requires a builder using the docker-container driver for this mode.
+	BuildKitCacheLocal BuildKitCacheMode = "local"
+	// BuildKitCacheRemote works like BuildKitCacheLocal, but additionally stores the layer cache of each package in the
+	// remote cache. Builds on machines which do not have the layer cache of a package download it before building.
+	BuildKitCacheRemote BuildKitCacheMode = "remote"
+	// BuildKitCacheOff neither imports nor exports any cache
+	BuildKitCacheOff BuildKitCacheMode = "off"
+)
+
+// buildKitMetadataFile is the file buildctl writes the result metadata to
+const buildKitMetadataFile = ".gorpa-buildkit-metadata.json"
+
+// BuildKitOptions configure builds using BuildKit
+type BuildKitOptions struct {
+	// Addr is the address of the buildkitd. Defaults to $BUILDKIT_HOST or buildctl's default.
+	Addr string
+	// Cache determines how the layer cache is imported and exported
+	Cache BuildKitCacheMode
+	// CacheDir is the directory the layer cache is stored in when using BuildKitCacheLocal or BuildKitCacheRemote
+	CacheDir string
+	// Remote is the remote cache the layer cache is stored in when using BuildKitCacheRemote
+	Remote RemoteCache
+	// RemoteLevel determines whether the layer cache is downloaded from and/or uploaded to Remote
+	RemoteLevel CacheLevel
+}
+
+// WithDockerBuilder configures the tool Docker packages are built with
+func WithDockerBuilder(builder DockerBuilder, bkopts BuildKitOptions) BuildOption {
+	return func(opts *buildOptions) error {
+		switch builder {
+		case DockerBuilderClassic, DockerBuilderKaniko, DockerBuilderBuildah, "":
+		case DockerBuilderBuildx, DockerBuilderBuildKit:
+			switch bkopts.Cache {
+			case BuildKitCacheInline, BuildKitCacheOff, "":
+			case BuildKitCacheLocal:
+				if bkopts.CacheDir == "" {
+					return xerrors.Errorf("BuildKit cache mode %s requires a cache directory", bkopts.Cache)
+				}
+			case BuildKitCacheRemote:
+				if bkopts.CacheDir == "" {
+					return xerrors.Errorf("BuildKit cache mode %s requires a cache directory", bkopts.Cache)
+				}
+				if _, ok := bkopts.Remote.(objectStore); !ok {
+					return xerrors.Errorf("BuildKit cache mode %s requires a remote cache which can store the layer cache, not %T", bkopts.Cache, bkopts.Remote)
+				}
+				switch bkopts.RemoteLevel {
+				case CacheRemote, CacheRemotePull, CacheRemotePush:
+				default:
+					return xerrors.Errorf("BuildKit cache mode %s requires a remote cache level, not %q", bkopts.Cache, bkopts.RemoteLevel)
+				}
+			default:
+				return xerrors.Errorf("invalid BuildKit cache mode: %s", bkopts.Cache)
+			}
+		default:
+			return xerrors.Errorf("invalid Docker builder: %s", builder)
+		}
+
+		opts.DockerBuilder = builder
+		opts.BuildKit = bkopts
+		return nil
+	}
+}
+
+// buildKitCacheArgs produces the cache import and export flags for a BuildKit build of the package.
+// importFlag and exportFlag are the flag names of the builder, e.g. --cache-from and --cache-to for buildx.
+func (p *Package) buildKitCacheArgs(buildctx *buildContext, images []string, importFlag, exportFlag string) []string {
+	var res []string
+	switch buildctx.BuildKit.Cache {
+	case BuildKitCacheLocal:
+		dir := filepath.Join(buildctx.BuildKit.CacheDir, p.FilesystemSafeName())
+		// importing a cache which was never exported fails the build
+		if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+			res = append(res, importFlag, "type=local,src="+dir)
+		}
+		res = append(res, exportFlag, "type=local,mode=max,dest="+dir)
+	case BuildKitCacheRemote:
+		dir := p.layerCacheDir(buildctx)
+		if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+			res = append(res, importFlag, "type=local,src="+dir)
+		}
+		res = append(res, exportFlag, "type=local,mode=max,dest="+dir+layerCacheExportSuffix)
+	case BuildKitCacheInline, "":
+		if len(images) == 0 {
+			break
+		}
+		for _, img := range images {
+			res = append(res, importFlag, "type=registry,ref="+img)
+		}
+		res = append(res, exportFlag, "type=inline")
+	}
+	return res
+}
+
+// buildxCommand produces the "docker buildx build" command for a Docker package. Single-platform images are loaded
+// into the Docker daemon s.t. all subsequent steps work the same as with the classic builder. The Docker daemon cannot
+// hold multi-arch images, hence buildx pushes those itself or exports them as OCI archive to exportFile.
+func (p *Package) buildxCommand(buildctx *buildContext, cfg DockerPkgConfig, version string, images []string, exportFile string) ([]string, error) {
+	if cfg.Squash {
+		return nil, xerrors.Errorf("squash is not supported by the %s Docker builder", DockerBuilderBuildx)
+	}
+
+	cmd := []string{"docker", "buildx", "build", "--pull", "--progress=plain"}
+	switch {
+	case len(cfg.Platforms) == 0:
+		cmd = append(cmd, "--load", "-t", version)
+	case len(images) == 0:
+		cmd = append(cmd, "--platform", strings.Join(cfg.Platforms, ","), "--output", "type=oci,dest="+exportFile)
+	default:
+		cmd = append(cmd, "--platform", strings.Join(cfg.Platforms, ","), "--push", "--metadata-file", buildKitMetadataFile)
+		for _, img := range images {
+			cmd = append(cmd, "-t", img)
+		}
+	}
+	for arg, val := range cfg.BuildArgs {
+		cmd = append(cmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
+	}
+	cmd = append(cmd, "--build-arg", fmt.Sprintf("__GIT_COMMIT=%s", p.C.Git().Commit))
+	for _, label := range dockerLabels(cfg) {
+		cmd = append(cmd, "--label", label)
+	}
+	secrets, err := p.dockerSecretArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cmd = append(cmd, secrets...)
+	cmd = append(cmd, p.buildKitCacheArgs(buildctx, images, "--cache-from", "--cache-to")...)
+	if buildctx.DockerBuildOptions != nil {
+		for opt, v := range *buildctx.DockerBuildOptions {
+			cmd = append(cmd, fmt.Sprintf("--%s=%s", opt, v))
+		}
+	}
+	cmd = append(cmd, ".")
+	return cmd, nil
+}
+
+// buildctlCommand produces the buildctl command for a Docker package. If the package has images, BuildKit
+// pushes them. Otherwise the image is exported to exportFile, as Docker archive or as OCI archive for multi-arch images.
+func (p *Package) buildctlCommand(buildctx *buildContext, cfg DockerPkgConfig, version string, images []string, exportFile string) ([]string, error) {
+	if cfg.Squash {
+		return nil, xerrors.Errorf("squash is not supported by the %s Docker builder", DockerBuilderBuildKit)
+	}
+	if buildctx.DockerBuildOptions != nil && len(*buildctx.DockerBuildOptions) > 0 {
+		log.WithField("package", p.FullName()).Warn("Docker build options are not supported by the buildkit Docker builder and will be ignored")
+	}
+
+	cmd := []string{"buildctl"}
+	if buildctx.BuildKit.Addr != "" {
+		cmd = append(cmd, "--addr", buildctx.BuildKit.Addr)
+	}
+	cmd = append(cmd, "build",
+		"--progress=plain",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=.",
+		"--local", "dockerfile=.",
+		"--opt", "image-resolve-mode=pull",
+	)
+	if len(cfg.Platforms) > 0 {
+		cmd = append(cmd, "--opt", "platform="+strings.Join(cfg.Platforms, ","))
+	}
+	for arg, val := range cfg.BuildArgs {
+		cmd = append(cmd, "--opt", fmt.Sprintf("build-arg:%s=%s", arg, val))
+	}
+	cmd = append(cmd, "--opt", fmt.Sprintf("build-arg:__GIT_COMMIT=%s", p.C.Git().Commit))
+	for _, label := range dockerLabels(cfg) {
+		cmd = append(cmd, "--opt", "label:"+label)
+	}
+	secrets, err := p.dockerSecretArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cmd = append(cmd, secrets...)
+	cmd = append(cmd, p.buildKitCacheArgs(buildctx, images, "--import-cache", "--export-cache")...)
+	if len(images) == 0 && len(cfg.Platforms) > 0 {
+		// Docker archives cannot hold multi-arch images
+		cmd = append(cmd, "--output", fmt.Sprintf("type=oci,name=%s,dest=%s", version, exportFile))
+	} else if len(images) == 0 {
+		cmd = append(cmd, "--output", fmt.Sprintf("type=docker,name=%s,dest=%s", version, exportFile))
+	} else {
+		cmd = append(cmd,
+			"--output", fmt.Sprintf("type=image,\"name=%s\",push=true", strings.Join(images, ",")),
+			"--metadata-file", buildKitMetadataFile,
+		)
+	}
+	return cmd, nil
+}
+
+// buildKitSubjects produces the provenance subjects of images pushed by buildctl
+func buildKitSubjects(wd string, images []string) ([]in_toto.Subject, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(wd, buildKitMetadataFile))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read BuildKit metadata: %w", err)
+	}
+	var md struct {
+		ConfigDigest string `json:"containerimage.config.digest"`
+	}
+	err = json.Unmarshal(fc, &md)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal BuildKit metadata: %w", err)
+	}
+	segs := strings.Split(md.ConfigDigest, ":")
+	if len(segs) != 2 {
+		return nil, xerrors.Errorf("BuildKit metadata contains invalid digest: %s", md.ConfigDigest)
+	}
+
+	res := make([]in_toto.Subject, 0, len(images))
+	for _, img := range images {
+		res = append(res, in_toto.Subject{
+			Name:   img,
+			Digest: in_toto.DigestSet{segs[0]: segs[1]},
+		})
+	}
+	return res, nil
+}
+
+// dockerLabels produces the labels of a Docker package as sorted key=value pairs
+func dockerLabels(cfg DockerPkgConfig) []string {
+	res := make([]string, 0, len(cfg.Labels))
+	for k, v := range cfg.Labels {
+		res = append(res, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// dockerSecretArgs produces the --secret and --ssh flags of a Docker package. All builders which support
+// secrets share the same flags.
+func (p *Package) dockerSecretArgs(cfg DockerPkgConfig) ([]string, error) {
+	var res []string
+	for _, secret := range cfg.Secrets {
+		if secret.Env != "" {
+			res = append(res, "--secret", fmt.Sprintf("id=%s,env=%s", secret.ID, secret.Env))
+			continue
+		}
+
+		src := secret.Src
+		if strings.HasPrefix(src, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, xerrors.Errorf("cannot resolve secret %s: %w", secret.ID, err)
+			}
+			src = filepath.Join(home, strings.TrimPrefix(src, "~/"))
+		} else if !filepath.IsAbs(src) {
+			src = filepath.Join(p.C.Origin, src)
+		}
+		res = append(res, "--secret", fmt.Sprintf("id=%s,src=%s", secret.ID, src))
+	}
+	for _, ssh := range cfg.SSH {
+		res = append(res, "--ssh", ssh)
+	}
+	return res, nil
+}
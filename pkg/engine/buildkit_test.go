@@ -0,0 +1,138 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildKitCacheArgs(t *testing.T) {
+	cacheDir := t.TempDir()
+	pkg := &Package{
+		C:               &Component{Name: "comp"},
+		packageInternal: packageInternal{Name: "img"},
+	}
+	pkgCacheDir := filepath.Join(cacheDir, "comp--img")
+
+	tests := []struct {
+		Name        string
+		Options     BuildKitOptions
+		Images      []string
+		Prepare     func() error
+		Expectation []string
+	}{
+		{
+			Name:        "inline without images",
+			Options:     BuildKitOptions{Cache: BuildKitCacheInline},
+			Expectation: nil,
+		},
+		{
+			Name:        "inline",
+			Options:     BuildKitOptions{Cache: BuildKitCacheInline},
+			Images:      []string{"registry/app:v1", "registry/app:latest"},
+			Expectation: []string{"--import", "type=registry,ref=registry/app:v1", "--import", "type=registry,ref=registry/app:latest", "--export", "type=inline"},
+		},
+		{
+			Name:        "local without previous cache",
+			Options:     BuildKitOptions{Cache: BuildKitCacheLocal, CacheDir: cacheDir},
+			Expectation: []string{"--export", "type=local,mode=max,dest=" + pkgCacheDir},
+		},
+		{
+			Name:    "local with previous cache",
+			Options: BuildKitOptions{Cache: BuildKitCacheLocal, CacheDir: cacheDir},
+			Prepare: func() error {
+				err := os.MkdirAll(pkgCacheDir, 0755)
+				if err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(pkgCacheDir, "index.json"), []byte("{}"), 0644)
+			},
+			Expectation: []string{"--import", "type=local,src=" + pkgCacheDir, "--export", "type=local,mode=max,dest=" + pkgCacheDir},
+		},
+		{
+			Name:        "remote",
+			Options:     BuildKitOptions{Cache: BuildKitCacheRemote, CacheDir: cacheDir},
+			Expectation: []string{"--import", "type=local,src=" + pkgCacheDir, "--export", "type=local,mode=max,dest=" + pkgCacheDir + ".export"},
+		},
+		{
+			Name:    "off",
+			Options: BuildKitOptions{Cache: BuildKitCacheOff},
+			Images:  []string{"registry/app:v1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			if test.Prepare != nil {
+				err := test.Prepare()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			buildctx := &buildContext{buildOptions: buildOptions{BuildKit: test.Options}}
+			act := pkg.buildKitCacheArgs(buildctx, test.Images, "--import", "--export")
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("buildKitCacheArgs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDockerSecretArgs(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{
+		C:               &Component{Name: "comp", Origin: "/app/comp"},
+		packageInternal: packageInternal{Name: "img"},
+	}
+
+	cfg := DockerPkgConfig{
+		Secrets: []DockerSecret{
+			{ID: "npmrc", Src: "~/.npmrc"},
+			{ID: "cert", Src: "certs/ca.pem"},
+			{ID: "abs", Src: "/etc/token"},
+			{ID: "token", Env: "NPM_TOKEN"},
+		},
+		SSH: []string{"default"},
+	}
+	expectation := []string{
+		"--secret", "id=npmrc,src=" + filepath.Join(home, ".npmrc"),
+		"--secret", "id=cert,src=/app/comp/certs/ca.pem",
+		"--secret", "id=abs,src=/etc/token",
+		"--secret", "id=token,env=NPM_TOKEN",
+		"--ssh", "default",
+	}
+	act, err := pkg.dockerSecretArgs(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("dockerSecretArgs() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,341 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BuildReportFilename is the name of the file the RecordingReporter writes the build report to
+	BuildReportFilename = "build-report.json"
+
+	// BuildLogFilename is the name of the file the RecordingReporter writes the build log to
+	BuildLogFilename = "build.log"
+
+	// DefaultBuildLogLimit is the number of bytes of build output the RecordingReporter keeps
+	DefaultBuildLogLimit = 1 << 20
+)
+
+// BuildReport summarises a single build
+type BuildReport struct {
+	Target   string               `json:"target"`
+	Version  string               `json:"version,omitempty"`
+	Started  time.Time            `json:"started"`
+	Finished time.Time            `json:"finished"`
+	Error    string               `json:"error,omitempty"`
+	Packages []PackageBuildReport `json:"packages"`
+}
+
+// PackageBuildReport summarises the build of a single package
+type PackageBuildReport struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version,omitempty"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// ErrorClass distinguishes failures of the build environment from regular build failures, see ErrorClass()
+	ErrorClass string `json:"errorClass,omitempty"`
+	// TestAttempts is the number of times flaky tests ran, see FlakyTestReporter
+	TestAttempts int `json:"testAttempts,omitempty"`
+	// TestsQuarantined is true if the tests failed, but the package is quarantined
+	TestsQuarantined bool `json:"testsQuarantined,omitempty"`
+	// TestFailure is the error of the last failed test attempt of flaky tests
+	TestFailure string `json:"testFailure,omitempty"`
+}
+
+// CompositeReporter forwards all calls to each of its reporters
+type CompositeReporter []Reporter
+
+// BuildStarted is called when the build of a package is started by the user.
+func (cr CompositeReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	for _, r := range cr {
+		r.BuildStarted(pkg, status)
+	}
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (cr CompositeReporter) BuildFinished(pkg *Package, err error) {
+	for _, r := range cr {
+		r.BuildFinished(pkg, err)
+	}
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (cr CompositeReporter) PackageBuildStarted(pkg *Package) {
+	for _, r := range cr {
+		r.PackageBuildStarted(pkg)
+	}
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (cr CompositeReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	for _, r := range cr {
+		r.PackageBuildLog(pkg, isErr, buf)
+	}
+}
+
+// PackageBuildFinished is called when the package build has finished.
+func (cr CompositeReporter) PackageBuildFinished(pkg *Package, err error) {
+	for _, r := range cr {
+		r.PackageBuildFinished(pkg, err)
+	}
+}
+
+// PackageTestsFlaky is called when the tests of a package turned out to be flaky.
+func (cr CompositeReporter) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	for _, r := range cr {
+		reportFlakyTests(r, pkg, attempts, quarantined, err)
+	}
+}
+
+// BuildPhaseStarted is called when a phase of a package build starts.
+func (cr CompositeReporter) BuildPhaseStarted(pkg *Package, phase BuildPhase) {
+	for _, r := range cr {
+		if pr, ok := r.(BuildPhaseReporter); ok {
+			pr.BuildPhaseStarted(pkg, phase)
+		}
+	}
+}
+
+// BuildPhaseFinished is called when a phase of a package build has finished.
+func (cr CompositeReporter) BuildPhaseFinished(pkg *Package, phase BuildPhase) {
+	for _, r := range cr {
+		if pr, ok := r.(BuildPhaseReporter); ok {
+			pr.BuildPhaseFinished(pkg, phase)
+		}
+	}
+}
+
+// NewRecordingReporter produces a reporter which writes a build report and the tail of the build log
+// to the location once a build has finished.
+func NewRecordingReporter(location string) *RecordingReporter {
+	return &RecordingReporter{
+		Location: location,
+		LogLimit: DefaultBuildLogLimit,
+		packages: make(map[string]*PackageBuildReport),
+		started:  make(map[string]time.Time),
+	}
+}
+
+// RecordingReporter keeps a report of the last build, e.g. for inclusion in support bundles.
+// Use NewRecordingReporter to create an instance.
+type RecordingReporter struct {
+	Location string
+	LogLimit int
+
+	mu       sync.Mutex
+	report   BuildReport
+	packages map[string]*PackageBuildReport
+	started  map[string]time.Time
+	log      *tailBuffer
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *RecordingReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.report = BuildReport{
+		Target:  pkg.FullName(),
+		Started: time.Now(),
+	}
+	r.report.Version, _ = pkg.Version()
+	r.packages = make(map[string]*PackageBuildReport, len(status))
+	r.started = make(map[string]time.Time)
+	r.log = newTailBuffer(r.LogLimit)
+	for p, s := range status {
+		version, _ := p.Version()
+		r.packages[p.FullName()] = &PackageBuildReport{
+			Name:    p.FullName(),
+			Version: version,
+			Status:  string(s),
+		}
+	}
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *RecordingReporter) BuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.report.Finished = time.Now()
+	if err != nil {
+		r.report.Error = err.Error()
+	}
+	r.report.Packages = make([]PackageBuildReport, 0, len(r.packages))
+	for _, p := range r.packages {
+		r.report.Packages = append(r.report.Packages, *p)
+	}
+	sort.Slice(r.report.Packages, func(i, j int) bool { return r.report.Packages[i].Name < r.report.Packages[j].Name })
+
+	// the report is a debugging aid - failing to write it must not fail the build
+	err = r.write()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write build report: %v\n", err)
+	}
+}
+
+func (r *RecordingReporter) write() error {
+	err := os.MkdirAll(r.Location, 0755)
+	if err != nil {
+		return err
+	}
+
+	fc, err := json.MarshalIndent(r.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(r.Location, BuildReportFilename), fc, 0644)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.Location, BuildLogFilename), r.log.Bytes(), 0644)
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *RecordingReporter) PackageBuildStarted(pkg *Package) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started[pkg.FullName()] = time.Now()
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *RecordingReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		r.log = newTailBuffer(r.LogLimit)
+	}
+	r.log.Write([]byte(fmt.Sprintf("[%s] ", pkg.FullName())))
+	r.log.Write(buf)
+	if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+		r.log.Write([]byte{'\n'})
+	}
+}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *RecordingReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := pkg.FullName()
+	p, ok := r.packages[name]
+	if !ok {
+		p = &PackageBuildReport{Name: name}
+		p.Version, _ = pkg.Version()
+		r.packages[name] = p
+	}
+	if t, ok := r.started[name]; ok {
+		p.Duration = time.Since(t)
+	}
+	if err != nil {
+		p.Status = "failed"
+		p.Error = err.Error()
+		p.ErrorClass = ErrorClass(err)
+	} else {
+		p.Status = string(PackageBuilt)
+	}
+}
+
+// PackageTestsFlaky is called when the tests of a package turned out to be flaky.
+func (r *RecordingReporter) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := pkg.FullName()
+	p, ok := r.packages[name]
+	if !ok {
+		p = &PackageBuildReport{Name: name}
+		p.Version, _ = pkg.Version()
+		r.packages[name] = p
+	}
+	p.TestAttempts = attempts
+	p.TestsQuarantined = quarantined
+	if err != nil {
+		p.TestFailure = err.Error()
+	}
+}
+
+// tailBuffer keeps the last bytes written to it in a ring buffer of fixed size.
+// A tailBuffer with a limit of zero or less keeps everything.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+	start int
+	full  bool
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+// Write appends p, overwriting the oldest bytes once the buffer is full. It never fails.
+func (b *tailBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if b.limit <= 0 {
+		b.buf = append(b.buf, p...)
+		return n, nil
+	}
+
+	if len(p) >= b.limit {
+		// only the tail of p survives anyways
+		b.buf = append(b.buf[:0], p[len(p)-b.limit:]...)
+		b.start, b.full = 0, true
+		return n, nil
+	}
+	if !b.full {
+		free := b.limit - len(b.buf)
+		if len(p) <= free {
+			b.buf = append(b.buf, p...)
+			b.full = len(b.buf) == b.limit
+			return n, nil
+		}
+		b.buf = append(b.buf, p[:free]...)
+		p = p[free:]
+		b.full = true
+	}
+	for len(p) > 0 {
+		c := copy(b.buf[b.start:], p)
+		p = p[c:]
+		b.start = (b.start + c) % b.limit
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the buffer content in the order it was written
+func (b *tailBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	res := make([]byte, 0, len(b.buf))
+	res = append(res, b.buf[b.start:]...)
+	return append(res, b.buf[:b.start]...)
+}
@@ -0,0 +1,87 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Limit       int
+		Writes      []string
+		Expectation string
+	}{
+		{Name: "unlimited", Limit: 0, Writes: []string{"abc", "def"}, Expectation: "abcdef"},
+		{Name: "below limit", Limit: 10, Writes: []string{"abc", "def"}, Expectation: "abcdef"},
+		{Name: "exactly full", Limit: 6, Writes: []string{"abc", "def"}, Expectation: "abcdef"},
+		{Name: "overflow", Limit: 4, Writes: []string{"abc", "def"}, Expectation: "cdef"},
+		{Name: "wrap around", Limit: 4, Writes: []string{"abc", "de", "f", "gh", "i"}, Expectation: "fghi"},
+		{Name: "large write", Limit: 4, Writes: []string{"ab", "cdefgh"}, Expectation: "efgh"},
+		{Name: "after large write", Limit: 4, Writes: []string{"abcdefgh", "ij"}, Expectation: "ghij"},
+		{Name: "many small writes", Limit: 3, Writes: strings.Split("abcdefghij", ""), Expectation: "hij"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			b := newTailBuffer(test.Limit)
+			for _, w := range test.Writes {
+				n, _ := b.Write([]byte(w))
+				if n != len(w) {
+					t.Fatalf("short write: %d of %d bytes", n, len(w))
+				}
+			}
+			if diff := cmp.Diff(test.Expectation, string(b.Bytes())); diff != "" {
+				t.Errorf("unexpected content (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecordingReporterLog(t *testing.T) {
+	var (
+		loc = t.TempDir()
+		pkg = testPackage(&Application{}, "pkg", GenericPackage)
+		rep = NewRecordingReporter(loc)
+	)
+	rep.LogLimit = 32
+
+	rep.BuildStarted(pkg, map[*Package]PackageBuildStatus{pkg: PackageNotBuiltYet})
+	rep.PackageBuildStarted(pkg)
+	for _, l := range []string{"first line\n", "second line", "third line\n"} {
+		rep.PackageBuildLog(pkg, false, []byte(l))
+	}
+	rep.PackageBuildFinished(pkg, nil)
+	rep.BuildFinished(pkg, nil)
+
+	fc, err := ioutil.ReadFile(filepath.Join(loc, BuildLogFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("cond line\n[comp:pkg] third line\n", string(fc)); diff != "" {
+		t.Errorf("unexpected build log (-want +got):\n%s", diff)
+	}
+}
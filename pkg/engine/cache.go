@@ -21,14 +21,35 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"syscall"
-
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/xerrors"
+	"sigs.k8s.io/bom/pkg/provenance"
 )
 
 // Cache provides filesystem locations for package build artifacts.
@@ -93,163 +114,838 @@ func (NoRemoteCache) Upload(src Cache, pkgs []*Package) error {
 	return nil
 }
 
+// TransferOptions configures how remote caches transfer artifacts
+type TransferOptions struct {
+	// Jobs is the number of concurrent transfers
+	Jobs int
+	// Retries is the number of times a failed transfer is retried
+	Retries int
+	// Backoff is the delay before the first retry. The delay doubles with every subsequent retry.
+	Backoff time.Duration
+	// Timeout limits the duration of a single transfer attempt. Zero means no timeout.
+	Timeout time.Duration
+	// Faults are injected into downloads, if set
+	Faults *FaultInjection
+	// Progress receives the progress messages of the remote cache. Defaults to stdout.
+	Progress io.Writer
+}
+
+// progress returns where the remote cache prints its progress messages
+func (opts TransferOptions) progress() io.Writer {
+	if opts.Progress == nil {
+		return os.Stdout
+	}
+	return opts.Progress
+}
+
+// DefaultTransferOptions are used by remote caches which do not have any transfer options configured
+var DefaultTransferOptions = TransferOptions{
+	Jobs:    8,
+	Retries: 3,
+	Backoff: 1 * time.Second,
+	Timeout: 10 * time.Minute,
+}
+
+// ErrTransferNotFound is returned by a transfer function if the source does not exist.
+// Such transfers are not retried, as a missing artifact is a regular cache miss.
+var ErrTransferNotFound = xerrors.Errorf("not found")
+
+type fileTransfer struct {
+	Src string
+	Dst string
+	// Download is true if Dst is a local file. Downloads go to a temporary file first,
+	// so that failed transfers never leave a partial artifact in the local cache.
+	Download bool
+}
+
+// transferFiles runs all transfers using a bounded pool of workers, retrying failed transfers with exponential backoff.
+// Remote caching is best effort, hence failed transfers are logged but do not constitute an error.
+func transferFiles(opts TransferOptions, transfers []fileTransfer, transfer func(ctx context.Context, src, dst string) error) {
+	if opts.Jobs <= 0 {
+		opts = DefaultTransferOptions
+	}
+
+	var (
+		wg   sync.WaitGroup
+		jobs = make(chan fileTransfer)
+	)
+	for i := 0; i < opts.Jobs && i < len(transfers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				err := transferFileWithRetry(opts, t, transfer)
+				if err == ErrTransferNotFound {
+					log.WithField("src", t.Src).Debug("not found in remote cache")
+				} else if err != nil {
+					log.WithError(err).WithField("src", t.Src).WithField("dst", t.Dst).Warn("remote cache transfer failed")
+				}
+			}
+		}()
+	}
+	for _, t := range transfers {
+		jobs <- t
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func transferFileWithRetry(opts TransferOptions, t fileTransfer, transfer func(ctx context.Context, src, dst string) error) (err error) {
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err = opts.Faults.failTransfer(t, attempt)
+		if err == nil {
+			err = transferFile(opts, t, transfer)
+		}
+		if err == nil || err == ErrTransferNotFound || attempt >= opts.Retries {
+			return err
+		}
+
+		log.WithError(err).WithField("src", t.Src).WithField("attempt", attempt+1).Debugf("remote cache transfer failed - retrying in %s", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func transferFile(opts TransferOptions, t fileTransfer, transfer func(ctx context.Context, src, dst string) error) error {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if !t.Download {
+		return transfer(ctx, t.Src, t.Dst)
+	}
+
+	tmp := t.Dst + ".download"
+	err := transfer(ctx, t.Src, tmp)
+	if err == nil {
+		err = opts.Faults.corruptDownload(t.Src, tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, t.Dst)
+}
+
+// runTransferCommand runs a command which transfers a file. If the command fails and its output matches
+// one of the notFound markers, ErrTransferNotFound is returned.
+func runTransferCommand(ctx context.Context, notFound []string, name string, args ...string) error {
+	return runTransferCommandWithInput(ctx, notFound, nil, name, args...)
+}
+
+// runTransferCommandWithInput works like runTransferCommand but passes stdin to the command
+func runTransferCommandWithInput(ctx context.Context, notFound []string, stdin io.Reader, name string, args ...string) error {
+	log.WithField("command", strings.Join(append([]string{name}, args...), " ")).Debug("transferring file")
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, marker := range notFound {
+		if strings.Contains(string(out), marker) {
+			return ErrTransferNotFound
+		}
+	}
+	return xerrors.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+}
+
 // GSUtilRemoteCache uses the gsutil command to implement a remote cache
 type GSUtilRemoteCache struct {
 	BucketName string
+	Transfer   TransferOptions
+}
+
+var gsutilNotFound = []string{"No URLs matched", "NotFoundException"}
+
+func (rs GSUtilRemoteCache) String() string {
+	return "gs://" + rs.BucketName
 }
 
 // Download makes a best-effort attempt at downloading previously cached build artifacts
 func (rs GSUtilRemoteCache) Download(dst Cache, pkgs []*Package) error {
-	fmt.Printf("☁️  checking remote cache for past build artifacts\n")
-	var (
-		files []string
-		dest  string
-	)
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  checking remote cache for past build artifacts\n")
+	var transfers []fileTransfer
 	for _, pkg := range pkgs {
 		fn, exists := dst.Location(pkg)
 		if exists {
 			continue
 		}
 
-		if dest == "" {
-			dest = filepath.Dir(fn)
-		} else if dest != filepath.Dir(fn) {
-			return xerrors.Errorf("gsutil only supports one target folder, not %s and %s", dest, filepath.Dir(fn))
+		transfers = append(transfers, fileTransfer{
+			Src:      fmt.Sprintf("gs://%s/%s", rs.BucketName, filepath.Base(fn)),
+			Dst:      fn,
+			Download: true,
+		})
+	}
+	transferFiles(rs.Transfer, transfers, gsutilCopy)
+	return nil
+}
+
+// Upload makes a best effort to upload the build arfitacts to a remote cache
+func (rs GSUtilRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  uploading build artifacts to remote cache\n")
+	var transfers []fileTransfer
+	for _, pkg := range pkgs {
+		file, exists := src.Location(pkg)
+		if !exists {
+			continue
 		}
+		transfers = append(transfers, fileTransfer{
+			Src: file,
+			Dst: fmt.Sprintf("gs://%s/%s", rs.BucketName, filepath.Base(file)),
+		})
+	}
+	transferFiles(rs.Transfer, transfers, gsutilCopy)
+	return nil
+}
+
+func (rs GSUtilRemoteCache) getObjects(objs map[string]string) {
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: fmt.Sprintf("gs://%s/%s", rs.BucketName, name), Dst: fn, Download: true})
+	}
+	transferFiles(rs.Transfer, transfers, gsutilCopy)
+}
 
-		files = append(files, fmt.Sprintf("gs://%s/%s", rs.BucketName, filepath.Base(fn)))
+func (rs GSUtilRemoteCache) putObjects(objs map[string]string) {
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: fn, Dst: fmt.Sprintf("gs://%s/%s", rs.BucketName, name)})
 	}
-	return gsutilTransfer(dest, files)
+	transferFiles(rs.Transfer, transfers, gsutilCopy)
+}
+
+func gsutilCopy(ctx context.Context, src, dst string) error {
+	return runTransferCommand(ctx, gsutilNotFound, "gsutil", "cp", src, dst)
+}
+
+// SSHProtocol determines how the SSHRemoteCache transfers files
+type SSHProtocol string
+
+const (
+	// SSHProtocolRsync transfers files using rsync over SSH
+	SSHProtocolRsync SSHProtocol = "rsync"
+	// SSHProtocolSFTP transfers files using sftp, for hosts which do not have rsync installed
+	SSHProtocolSFTP SSHProtocol = "sftp"
+)
+
+// SSHRemoteCache stores build artifacts in a directory on a host reachable via SSH. This is useful for
+// air-gapped or on-prem environments where no object storage is available.
+type SSHRemoteCache struct {
+	// Location is the remote directory in [user@]host:/path form. The directory must exist.
+	Location string
+	Protocol SSHProtocol
+	// SSHOptions are passed to ssh/sftp, e.g. []string{"-o", "Port=2222", "-o", "IdentityFile=/path/to/key"}
+	SSHOptions []string
+	Transfer   TransferOptions
+}
+
+var (
+	rsyncNotFound = []string{"failed: No such file or directory"}
+	sftpNotFound  = []string{"not found.", "No such file or directory"}
+)
+
+// Validate checks if the cache location is usable
+func (rs SSHRemoteCache) Validate() error {
+	host, dir := rs.splitLocation()
+	if host == "" || dir == "" {
+		return xerrors.Errorf("remote cache location must have the form [user@]host:/path, not %s", rs.Location)
+	}
+	switch rs.Protocol {
+	case SSHProtocolRsync, SSHProtocolSFTP:
+	default:
+		return xerrors.Errorf("unknown SSH remote cache protocol: %s", rs.Protocol)
+	}
+	return nil
+}
+
+func (rs SSHRemoteCache) splitLocation() (host, dir string) {
+	segs := strings.SplitN(rs.Location, ":", 2)
+	if len(segs) != 2 {
+		return "", ""
+	}
+	return segs[0], strings.TrimSuffix(segs[1], "/")
+}
+
+func (rs SSHRemoteCache) String() string {
+	return fmt.Sprintf("%s://%s", rs.Protocol, rs.Location)
+}
+
+// Download makes a best-effort attempt at downloading previously cached build artifacts
+func (rs SSHRemoteCache) Download(dst Cache, pkgs []*Package) error {
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  %s checking remote cache for past build artifacts\n", rs.Protocol)
+	_, dir := rs.splitLocation()
+
+	var transfers []fileTransfer
+	for _, pkg := range pkgs {
+		fn, exists := dst.Location(pkg)
+		if exists {
+			continue
+		}
+
+		transfers = append(transfers, fileTransfer{
+			Src:      path.Join(dir, filepath.Base(fn)),
+			Dst:      fn,
+			Download: true,
+		})
+	}
+	transferFiles(rs.Transfer, transfers, rs.copy(true))
+	return nil
 }
 
 // Upload makes a best effort to upload the build arfitacts to a remote cache
-func (rs GSUtilRemoteCache) Upload(src Cache, pkgs []*Package) error {
-	fmt.Printf("☁️  uploading build artifacts to remote cache\n")
-	var files []string
+func (rs SSHRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  %s uploading build artifacts to remote cache\n", rs.Protocol)
+	_, dir := rs.splitLocation()
+
+	var transfers []fileTransfer
 	for _, pkg := range pkgs {
 		file, exists := src.Location(pkg)
 		if !exists {
 			continue
 		}
-		files = append(files, file)
+		transfers = append(transfers, fileTransfer{
+			Src: file,
+			Dst: path.Join(dir, filepath.Base(file)),
+		})
+	}
+	transferFiles(rs.Transfer, transfers, rs.copy(false))
+	return nil
+}
+
+func (rs SSHRemoteCache) getObjects(objs map[string]string) {
+	_, dir := rs.splitLocation()
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: path.Join(dir, name), Dst: fn, Download: true})
 	}
-	return gsutilTransfer(fmt.Sprintf("gs://%s", rs.BucketName), files)
+	transferFiles(rs.Transfer, transfers, rs.copy(true))
 }
 
-func gsutilTransfer(target string, files []string) error {
-	log.WithField("target", target).WithField("files", files).Debug("transfering files using gsutil")
+func (rs SSHRemoteCache) putObjects(objs map[string]string) {
+	_, dir := rs.splitLocation()
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: fn, Dst: path.Join(dir, name)})
+	}
+	transferFiles(rs.Transfer, transfers, rs.copy(false))
+}
 
-	cmd := exec.Command("gsutil", "-m", "cp", "-I", target)
-	cmd.Stdout = os.Stdout
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return err
+func (rs SSHRemoteCache) copy(download bool) func(ctx context.Context, src, dst string) error {
+	host, _ := rs.splitLocation()
+	if rs.Protocol == SSHProtocolSFTP {
+		return func(ctx context.Context, src, dst string) error {
+			// sftp has no atomic upload, hence we upload to a temporary file first and rename it, which replaces dst atomically
+			// if the server supports POSIX renames. Other servers cannot replace dst, but as artifacts never change
+			// once built, an existing dst is as good as ours.
+			var batch string
+			if download {
+				batch = fmt.Sprintf("get %q %q\n", src, dst)
+			} else {
+				tmp := fmt.Sprintf("%s.%d-%d.upload", dst, os.Getpid(), time.Now().UnixNano())
+				batch = fmt.Sprintf("put %q %q\n-rename %q %q\n-rm %q\n", src, tmp, tmp, dst, tmp)
+			}
+			args := append(append([]string{"-q", "-b", "-"}, rs.SSHOptions...), host)
+			return runTransferCommandWithInput(ctx, sftpNotFound, strings.NewReader(batch), "sftp", args...)
+		}
 	}
-	err = cmd.Start()
-	if err != nil {
-		return err
+
+	return func(ctx context.Context, src, dst string) error {
+		if download {
+			src = host + ":" + src
+		} else {
+			dst = host + ":" + dst
+		}
+		// rsync writes to a temporary file and renames it once the transfer is complete
+		ssh := strings.Join(append([]string{"ssh"}, rs.SSHOptions...), " ")
+		return runTransferCommand(ctx, rsyncNotFound, "rsync", "--times", "-e", ssh, src, dst)
 	}
+}
+
+const (
+	// EnvvarMinioEndpoint configures the host[:port] of the MinIO/S3 server used as remote cache
+	EnvvarMinioEndpoint = "GORPA_MINIO_ENDPOINT"
+	// EnvvarMinioRegion configures the region of the MinIO/S3 bucket
+	EnvvarMinioRegion = "GORPA_MINIO_REGION"
+	// EnvvarMinioAccessKey configures the access key used to authenticate against MinIO/S3
+	EnvvarMinioAccessKey = "GORPA_MINIO_ACCESS_KEY"
+	// EnvvarMinioSecretKey configures the secret key used to authenticate against MinIO/S3
+	EnvvarMinioSecretKey = "GORPA_MINIO_SECRET_KEY"
+	// EnvvarMinioInsecure disables TLS when talking to MinIO/S3 if set to "true"
+	EnvvarMinioInsecure = "GORPA_MINIO_INSECURE"
+	// EnvvarMinioCACert configures a PEM file with additional CA certificates to trust when talking to MinIO/S3
+	EnvvarMinioCACert = "GORPA_MINIO_CA_CERT"
+
+	// envvarMinioMCHost is the mc alias configuration we used to rely on. We still honour it if nothing else is configured.
+	envvarMinioMCHost = "MC_HOST_minio"
+	// envvarMCConfigDir is the directory of the mc config file
+	envvarMCConfigDir = "MC_CONFIG_DIR"
+	// mcAlias is the alias in the mc config we used to rely on. We still honour it if nothing else is configured.
+	mcAlias = "minio"
+)
+
+// MinioConfig configures the connection to a MinIO (or any other S3 compatible) server.
+// The secret key is never read from the application config, only from the environment.
+type MinioConfig struct {
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	AccessKey string `yaml:"accessKey,omitempty"`
+	SecretKey string `yaml:"-"`
+	Insecure  bool   `yaml:"insecure,omitempty"`
+	CACert    string `yaml:"caCert,omitempty"`
+
+	// PartSize is the size of the parts in MiB big artifacts are uploaded in. Defaults to 16 MiB.
+	PartSize uint64 `yaml:"partSize,omitempty"`
+	// UploadThreads is the number of parts uploaded in parallel per artifact. Defaults to 4.
+	UploadThreads uint `yaml:"uploadThreads,omitempty"`
+}
 
-	for _, fn := range files {
-		_, err = fmt.Fprintln(stdin, fn)
+// WithEnvironment returns a copy of this config where all values set in the environment take precedence.
+// If no endpoint is configured at all, the minio alias of the mc client is used.
+func (cfg MinioConfig) WithEnvironment() (MinioConfig, error) {
+	if mchost := os.Getenv(envvarMinioMCHost); mchost != "" && cfg.Endpoint == "" {
+		u, err := url.Parse(mchost)
 		if err != nil {
-			return err
+			return cfg, xerrors.Errorf("invalid %s: %w", envvarMinioMCHost, err)
+		}
+		cfg.Endpoint = u.Host
+		cfg.Insecure = u.Scheme == "http"
+		if u.User != nil {
+			cfg.AccessKey = u.User.Username()
+			cfg.SecretKey, _ = u.User.Password()
 		}
 	}
-	err = stdin.Close()
-	if err != nil {
-		return err
+
+	for env, dst := range map[string]*string{
+		EnvvarMinioEndpoint:  &cfg.Endpoint,
+		EnvvarMinioRegion:    &cfg.Region,
+		EnvvarMinioAccessKey: &cfg.AccessKey,
+		EnvvarMinioSecretKey: &cfg.SecretKey,
+		EnvvarMinioCACert:    &cfg.CACert,
+	} {
+		if val := os.Getenv(env); val != "" {
+			*dst = val
+		}
+	}
+	if val := os.Getenv(EnvvarMinioInsecure); val != "" {
+		insecure, err := strconv.ParseBool(val)
+		if err != nil {
+			return cfg, xerrors.Errorf("invalid %s: %w", EnvvarMinioInsecure, err)
+		}
+		cfg.Insecure = insecure
 	}
 
-	err = cmd.Wait()
-	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if _, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				// we just swallow non-zero exit codes here as remote caching is best effort
-				return nil
+	if cfg.Endpoint == "" {
+		alias, err := readMCAlias(mcAlias)
+		if err != nil {
+			return cfg, err
+		}
+		if alias != nil {
+			u, err := url.Parse(alias.URL)
+			if err != nil {
+				return cfg, xerrors.Errorf("invalid URL of the mc alias %s: %w", mcAlias, err)
+			}
+			cfg.Endpoint = u.Host
+			cfg.Insecure = u.Scheme == "http"
+			if cfg.AccessKey == "" {
+				cfg.AccessKey, cfg.SecretKey = alias.AccessKey, alias.SecretKey
 			}
 		}
+	}
 
-		return err
+	return cfg, nil
+}
+
+type mcConfigAlias struct {
+	URL       string `json:"url"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// readMCAlias reads an alias from the config file of the mc client. Returns nil if there's no such alias.
+func readMCAlias(name string) (*mcConfigAlias, error) {
+	dir := os.Getenv(envvarMCConfigDir)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		dir = filepath.Join(home, ".mc")
+	}
+	fn := filepath.Join(dir, "config.json")
+	fc, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// older versions of mc call the aliases hosts
+	var mcConfig struct {
+		Aliases map[string]mcConfigAlias `json:"aliases"`
+		Hosts   map[string]mcConfigAlias `json:"hosts"`
+	}
+	err = json.Unmarshal(fc, &mcConfig)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read mc config %s: %w", fn, err)
+	}
+	if alias, ok := mcConfig.Aliases[name]; ok {
+		return &alias, nil
+	}
+	if alias, ok := mcConfig.Hosts[name]; ok {
+		return &alias, nil
+	}
+	return nil, nil
+}
+
+// Validate checks if the config is complete enough to connect to a server
+func (cfg MinioConfig) Validate() error {
+	if cfg.Endpoint == "" {
+		return xerrors.Errorf("no MinIO endpoint configured - set %s, remoteCache.minio.endpoint in the application config or the mc alias %s", EnvvarMinioEndpoint, mcAlias)
+	}
+	if strings.Contains(cfg.Endpoint, "://") {
+		return xerrors.Errorf("MinIO endpoint must be host[:port], not a URL: %s", cfg.Endpoint)
+	}
+	if (cfg.AccessKey == "") != (cfg.SecretKey == "") {
+		return xerrors.Errorf("MinIO access key and secret key must be set together (%s, %s)", EnvvarMinioAccessKey, EnvvarMinioSecretKey)
 	}
 	return nil
 }
 
-// MinioRemoteCache uses the mc command to implement a remote cache
+func (cfg MinioConfig) newClient() (*minio.Client, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := minio.DefaultTransport(!cfg.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read MinIO CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, xerrors.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	var creds *credentials.Credentials
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	} else {
+		// fall back to the usual AWS/MinIO environment variables and credential files
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.FileMinioClient{Alias: "minio"},
+		})
+	}
+
+	return minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     creds,
+		Secure:    !cfg.Insecure,
+		Region:    cfg.Region,
+		Transport: transport,
+	})
+}
+
+// MinioRemoteCache uses the MinIO SDK to implement a remote cache on MinIO or any other S3 compatible storage
 type MinioRemoteCache struct {
 	BucketName string
+	Config     MinioConfig
+	Transfer   TransferOptions
+}
+
+func (rs MinioRemoteCache) String() string {
+	return fmt.Sprintf("minio://%s/%s", rs.Config.Endpoint, rs.BucketName)
 }
 
 // Download makes a best-effort attempt at downloading previously cached build artifacts
 func (rs MinioRemoteCache) Download(dst Cache, pkgs []*Package) error {
-	fmt.Printf("☁️  minio checking remote cache for past build artifacts\n")
-	var (
-		files []string
-		dest  string
-	)
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  minio checking remote cache for past build artifacts\n")
+	client, err := rs.Config.newClient()
+	if err != nil {
+		log.WithError(err).Warn("cannot connect to MinIO remote cache")
+		return nil
+	}
+
+	var transfers []fileTransfer
 	for _, pkg := range pkgs {
 		fn, exists := dst.Location(pkg)
 		if exists {
 			continue
 		}
-		if dest == "" {
-			dest = filepath.Dir(fn)
-		} else if dest != filepath.Dir(fn) {
-			return xerrors.Errorf("gsutil only supports one target folder, not %s and %s", dest, filepath.Dir(fn))
-		}
 
-		files = append(files, fmt.Sprintf("minio/%s/%s", rs.BucketName, filepath.Base(fn)))
+		transfers = append(transfers, fileTransfer{
+			Src:      filepath.Base(fn),
+			Dst:      fn,
+			Download: true,
+		})
+	}
+	transferFiles(rs.Transfer, transfers, rs.get(client))
+	return nil
+}
+
+func (rs MinioRemoteCache) get(client *minio.Client) func(ctx context.Context, src, dst string) error {
+	return func(ctx context.Context, src, dst string) error {
+		err := client.FGetObject(ctx, rs.BucketName, src, dst, minio.GetObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrTransferNotFound
+		}
+		return err
 	}
-	return minioTransfer(dest, files)
 }
 
 // Upload makes a best effort to upload the build arfitacts to a remote cache
 func (rs MinioRemoteCache) Upload(src Cache, pkgs []*Package) error {
-	fmt.Printf("☁️  minio uploading build artifacts to remote cache\n")
-	var files []string
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  minio uploading build artifacts to remote cache\n")
+	client, err := rs.Config.newClient()
+	if err != nil {
+		log.WithError(err).Warn("cannot connect to MinIO remote cache")
+		return nil
+	}
+
+	var transfers []fileTransfer
 	for _, pkg := range pkgs {
 		file, exists := src.Location(pkg)
 		if !exists {
 			continue
 		}
-		files = append(files, file)
+		transfers = append(transfers, fileTransfer{
+			Src: file,
+			Dst: filepath.Base(file),
+		})
 	}
-	return minioTransfer(fmt.Sprintf("minio/%s", rs.BucketName), files)
+	transferFiles(rs.Transfer, transfers, rs.put(client))
+	return nil
 }
 
-func minioTransfer(target string, files []string) error {
-	if len(files) == 0 {
-		return nil
+func (rs MinioRemoteCache) put(client *minio.Client) func(ctx context.Context, src, dst string) error {
+	opts := minio.PutObjectOptions{
+		ContentType: "application/gzip",
+		PartSize:    16 * 1024 * 1024,
+		NumThreads:  4,
 	}
-	log.WithField("target", target).WithField("files", files).Debug("transfering files using gsutil")
-	runCopyCommand := func(source, target string) error {
-		args := make([]string, 0, 3)
-		args = append(args, "cp")
-		args = append(args, source)
-		args = append(args, target)
-		cmd := exec.Command("mc", args...)
-		cmd.Stdout = os.Stdout
-		err := cmd.Start()
-		if err != nil {
+	if rs.Config.PartSize > 0 {
+		opts.PartSize = rs.Config.PartSize * 1024 * 1024
+	}
+	if rs.Config.UploadThreads > 0 {
+		opts.NumThreads = rs.Config.UploadThreads
+	}
+
+	return func(ctx context.Context, src, dst string) error {
+		// big artifacts are uploaded in parts, opts.NumThreads of them in parallel
+		_, err := client.FPutObject(ctx, rs.BucketName, dst, src, opts)
+		return err
+	}
+}
+
+func (rs MinioRemoteCache) getObjects(objs map[string]string) {
+	client, err := rs.Config.newClient()
+	if err != nil {
+		log.WithError(err).Warn("cannot connect to MinIO remote cache")
+		return
+	}
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: name, Dst: fn, Download: true})
+	}
+	transferFiles(rs.Transfer, transfers, rs.get(client))
+}
+
+func (rs MinioRemoteCache) putObjects(objs map[string]string) {
+	client, err := rs.Config.newClient()
+	if err != nil {
+		log.WithError(err).Warn("cannot connect to MinIO remote cache")
+		return
+	}
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: fn, Dst: name})
+	}
+	transferFiles(rs.Transfer, transfers, rs.put(client))
+}
+
+// artifactChecksumSuffix is appended to the filename of a locally built artifact to record its SHA256 checksum
+const artifactChecksumSuffix = ".sha256"
+
+// writeArtifactChecksum records the checksum of a freshly built artifact so that we can detect corruption later on
+func writeArtifactChecksum(fn string) error {
+	hash, err := sha256Hash(fn)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn+artifactChecksumSuffix, []byte(hash+"\n"), 0644)
+}
+
+// Artifacts lists all build artifacts in the cache
+func (fsc *FilesystemCache) Artifacts() ([]string, error) {
+	return filepath.Glob(filepath.Join(fsc.Origin, "*.tar.gz"))
+}
+
+// Remove deletes a build artifact, its recorded checksum and origin from the cache
+func (fsc *FilesystemCache) Remove(fn string) error {
+	for _, suffix := range []string{artifactChecksumSuffix, artifactOriginSuffix} {
+		err := os.Remove(fn + suffix)
+		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
-		err = cmd.Wait()
+	}
+	return os.Remove(fn)
+}
+
+// VerifyCachedArtifact checks the integrity of a cached build artifact and returns a list of problems found.
+// Every artifact is checked against its recorded checksum (if there is one) and must be a readable tar.gz archive.
+// If pkg is not nil and checkProvenance is true, the artifact's attestation bundle must exist (if provenance is enabled),
+// must describe pkg, and all subjects contained in the archive must match their attested digest.
+func VerifyCachedArtifact(fn string, pkg *Package, checkProvenance bool) (problems []string, err error) {
+	if fc, err := ioutil.ReadFile(fn + artifactChecksumSuffix); err == nil {
+		hash, err := sha256Hash(fn)
 		if err != nil {
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				if _, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-					// we just swallow non-zero exit codes here as remote caching is best effort
-					return nil
+			return nil, err
+		}
+		if expected := strings.TrimSpace(string(fc)); hash != expected {
+			problems = append(problems, fmt.Sprintf("checksum mismatch: expected %s, found %s", expected, hash))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var (
+		hashes = make(map[string]string)
+		bundle []byte
+	)
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = func() error {
+		g, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer g.Close()
+
+		a := tar.NewReader(g)
+		for {
+			hdr, err := a.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			name := normaliseArtifactPath(hdr.Name)
+			if name == provenanceBundleFilename {
+				bundle, err = ioutil.ReadAll(a)
+				if err != nil {
+					return err
 				}
+				continue
 			}
-			return err
+
+			hash := sha256.New()
+			_, err = io.Copy(hash, a)
+			if err != nil {
+				return err
+			}
+			hashes[name] = hex.EncodeToString(hash.Sum(nil))
 		}
-		return nil
+
+		// reading the gzip stream to the end makes sure its checksum is verified
+		_, err = io.Copy(ioutil.Discard, g)
+		return err
+	}()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("archive is corrupt: %v", err))
+		return problems, nil
+	}
+
+	if pkg == nil || !checkProvenance || !pkg.C.W.Provenance.Enabled {
+		return problems, nil
 	}
-	for _, source := range files {
-		err := runCopyCommand(source, target)
+	if bundle == nil {
+		problems = append(problems, "attestation bundle is missing")
+		return problems, nil
+	}
+
+	var foundEntry bool
+	dec := json.NewDecoder(bytes.NewReader(bundle))
+	for dec.More() {
+		var env provenance.Envelope
+		err := dec.Decode(&env)
 		if err != nil {
-			return err
+			problems = append(problems, fmt.Sprintf("attestation bundle is corrupt: %v", err))
+			return problems, nil
+		}
+		if env.PayloadType != in_toto.PayloadType {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(env.Payload)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("attestation bundle is corrupt: %v", err))
+			return problems, nil
+		}
+		stmt := provenance.NewSLSAStatement()
+		err = json.Unmarshal(raw, &stmt)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("attestation bundle is corrupt: %v", err))
+			return problems, nil
+		}
+
+		// the bundle contains the attestations of all dependencies too - we only care for the package's own
+		if stmt.Predicate.Recipe.EntryPoint != pkg.FullName() {
+			continue
+		}
+		foundEntry = true
+
+		for _, subject := range stmt.Subject {
+			actual, ok := hashes[normaliseArtifactPath(subject.Name)]
+			if !ok {
+				// not all subjects end up in the archive, e.g. Docker images
+				continue
+			}
+			if expected := subject.Digest["sha256"]; actual != expected {
+				problems = append(problems, fmt.Sprintf("%s does not match its attested digest: expected %s, found %s", subject.Name, expected, actual))
+			}
 		}
 	}
-	return nil
+	if !foundEntry {
+		problems = append(problems, fmt.Sprintf("attestation bundle contains no entry for %s", pkg.FullName()))
+	}
+
+	return problems, nil
+}
+
+func normaliseArtifactPath(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	name = strings.TrimPrefix(name, "package/")
+	return strings.TrimPrefix(name, "/")
 }
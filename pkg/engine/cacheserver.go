@@ -0,0 +1,403 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// cacheObjectName matches the names of the objects a CacheServer serves. Objects never contain a path.
+var cacheObjectName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// cacheServerObjectsDir is the directory within the cache where a CacheServer keeps objects other than artifacts
+const cacheServerObjectsDir = "objects"
+
+// HTTPRemoteCache uses a CacheServer, i.e. "gorpa cache serve", as remote cache
+type HTTPRemoteCache struct {
+	URL      string
+	Transfer TransferOptions
+}
+
+func (rs HTTPRemoteCache) String() string {
+	return rs.URL
+}
+
+// Download makes a best-effort attempt at downloading previously cached build artifacts
+func (rs HTTPRemoteCache) Download(dst Cache, pkgs []*Package) error {
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  checking cache server for past build artifacts\n")
+	objs := make(map[string]string)
+	for _, pkg := range pkgs {
+		fn, exists := dst.Location(pkg)
+		if exists || fn == "" {
+			continue
+		}
+		objs[filepath.Base(fn)] = fn
+	}
+	rs.getObjects(objs)
+	return nil
+}
+
+// Upload makes a best effort to upload the build arfitacts to a remote cache
+func (rs HTTPRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	fmt.Fprintf(rs.Transfer.progress(), "☁️  uploading build artifacts to cache server\n")
+	objs := make(map[string]string)
+	for _, pkg := range pkgs {
+		fn, exists := src.Location(pkg)
+		if !exists {
+			continue
+		}
+		objs[filepath.Base(fn)] = fn
+	}
+	rs.putObjects(objs)
+	return nil
+}
+
+func (rs HTTPRemoteCache) getObjects(objs map[string]string) {
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: rs.objectURL(name), Dst: fn, Download: true})
+	}
+	transferFiles(rs.Transfer, transfers, httpGet)
+}
+
+func (rs HTTPRemoteCache) putObjects(objs map[string]string) {
+	var transfers []fileTransfer
+	for name, fn := range objs {
+		transfers = append(transfers, fileTransfer{Src: fn, Dst: rs.objectURL(name)})
+	}
+	transferFiles(rs.Transfer, transfers, httpPut)
+}
+
+func (rs HTTPRemoteCache) listObjects(prefix string) ([]string, error) {
+	return listObjectsWith(rs.Transfer, prefix, func(ctx context.Context, prefix string) ([]string, error) {
+		u := strings.TrimSuffix(rs.URL, "/") + "/?prefix=" + url.QueryEscape(prefix)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, xerrors.Errorf("GET %s: %s", u, resp.Status)
+		}
+		out, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return parseObjectList(string(out), prefix), nil
+	})
+}
+
+func (rs HTTPRemoteCache) objectURL(name string) string {
+	return strings.TrimSuffix(rs.URL, "/") + "/" + name
+}
+
+func httpGet(ctx context.Context, src, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrTransferNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("GET %s: %s", src, resp.Status)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func httpPut(ctx context.Context, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dst, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return xerrors.Errorf("PUT %s: %s", dst, resp.Status)
+	}
+	return nil
+}
+
+// NewCacheServer creates a server for the cache at location. If upstream is not nil, artifacts which are not
+// in the cache are downloaded from upstream before they are served.
+func NewCacheServer(location string, upstream RemoteCache, allowUpload bool) (*CacheServer, error) {
+	err := os.MkdirAll(filepath.Join(location, cacheServerObjectsDir), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CacheServer{
+		Location:    location,
+		AllowUpload: allowUpload,
+		fetching:    make(map[string]*sync.Mutex),
+	}
+	if upstream != nil {
+		store, ok := upstream.(objectStore)
+		if !ok {
+			return nil, xerrors.Errorf("remote cache %T cannot be used as upstream of a cache server", upstream)
+		}
+		res.upstream = store
+		res.lister, _ = upstream.(objectLister)
+	}
+	return res, nil
+}
+
+// CacheServer serves a local cache over HTTP, s.t. it can be used as HTTPRemoteCache by other machines.
+// GET downloads an object, PUT uploads one if AllowUpload is true. GET /?prefix=<prefix> lists the names
+// of the objects which start with the prefix, one per line.
+type CacheServer struct {
+	Location    string
+	AllowUpload bool
+
+	upstream objectStore
+	lister   objectLister
+	mu       sync.Mutex
+	fetching map[string]*sync.Mutex
+}
+
+// ServeHTTP implements http.Handler
+func (srv *CacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" && r.Method == http.MethodGet {
+		srv.listObjects(w, r)
+		return
+	}
+	if !cacheObjectName.MatchString(name) {
+		http.Error(w, "invalid object name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		srv.serveObject(w, r, name)
+	case http.MethodPut:
+		if !srv.AllowUpload {
+			http.Error(w, "uploads are disabled", http.StatusForbidden)
+			return
+		}
+		err := srv.storeObject(name, r.Body)
+		if err != nil {
+			log.WithError(err).WithField("object", name).Warn("cannot store uploaded object")
+			http.Error(w, "cannot store object", http.StatusInternalServerError)
+			return
+		}
+		log.WithField("object", name).WithField("remote", r.RemoteAddr).Debug("stored object")
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (srv *CacheServer) listObjects(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if !cacheObjectName.MatchString(prefix) {
+		http.Error(w, "invalid object prefix", http.StatusBadRequest)
+		return
+	}
+
+	names := make(map[string]struct{})
+	for _, dir := range []string{srv.Location, filepath.Join(srv.Location, cacheServerObjectsDir)} {
+		fns, err := filepath.Glob(filepath.Join(dir, prefix+"*"))
+		if err != nil {
+			http.Error(w, "cannot list objects", http.StatusInternalServerError)
+			return
+		}
+		for _, fn := range fns {
+			// objects which are being stored or fetched are hidden until they're complete
+			if name := filepath.Base(fn); srv.objectLocation(name) == fn && isStoredObject(fn) {
+				names[name] = struct{}{}
+			}
+		}
+	}
+	if srv.lister != nil {
+		upstream, err := srv.lister.listObjects(prefix)
+		if err != nil {
+			log.WithError(err).WithField("prefix", prefix).Warn("cannot list upstream objects")
+		}
+		for _, name := range upstream {
+			names[name] = struct{}{}
+		}
+	}
+
+	res := make([]string, 0, len(names))
+	for name := range names {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	w.Header().Set("Content-Type", "text/plain")
+	for _, name := range res {
+		fmt.Fprintln(w, name)
+	}
+}
+
+// isStoredObject returns true if fn is a regular file
+func isStoredObject(fn string) bool {
+	stat, err := os.Stat(fn)
+	return err == nil && stat.Mode().IsRegular()
+}
+
+func (srv *CacheServer) serveObject(w http.ResponseWriter, r *http.Request, name string) {
+	fn := srv.objectLocation(name)
+	if srv.upstream != nil {
+		srv.fetch(name, fn)
+	}
+
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "cannot read object", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "cannot read object", http.StatusInternalServerError)
+		return
+	}
+	log.WithField("object", name).WithField("remote", r.RemoteAddr).Debug("serving object")
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
+
+// fetch downloads an object from upstream. Immutable objects, e.g. artifacts, are downloaded only if they're
+// not in the cache yet. All other objects (e.g. delta manifests) may change and are always downloaded.
+func (srv *CacheServer) fetch(name, fn string) {
+	_, err := os.Stat(fn)
+	if err == nil && isImmutableObject(name) {
+		return
+	}
+
+	// concurrent requests for the same object should download it only once
+	srv.mu.Lock()
+	mu, ok := srv.fetching[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		srv.fetching[name] = mu
+	}
+	srv.mu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(fn); err == nil && isImmutableObject(name) {
+		return
+	}
+	// An existing (but possibly outdated) object remains in place if the download fails
+	tmp := filepath.Join(filepath.Dir(fn), "."+name+".upstream")
+	srv.upstream.getObjects(map[string]string{name: tmp})
+	if _, err := os.Stat(tmp); err != nil {
+		return
+	}
+	err = os.Rename(tmp, fn)
+	if err != nil {
+		log.WithError(err).WithField("object", name).Warn("cannot store object downloaded from upstream")
+	}
+}
+
+func (srv *CacheServer) storeObject(name string, body io.Reader) error {
+	fn := srv.objectLocation(name)
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fn)
+}
+
+// objectLocation returns the path of an object in the cache. Artifacts are stored where a FilesystemCache
+// expects them, all other objects in a subdirectory so that they're not mistaken for artifacts.
+func (srv *CacheServer) objectLocation(name string) string {
+	if isArtifactObject(name) {
+		return filepath.Join(srv.Location, name)
+	}
+	return filepath.Join(srv.Location, cacheServerObjectsDir, name)
+}
+
+// isArtifactObject returns true if the object name is that of a build artifact, i.e. <version>.tar.gz
+func isArtifactObject(name string) bool {
+	version := strings.TrimSuffix(name, ".tar.gz")
+	return version != name && !strings.Contains(version, ".")
+}
+
+// isImmutableObject returns true if the object never changes once uploaded. Besides artifacts, these are
+// the tarballs of the yarn offline mirror, which are named by package and version.
+func isImmutableObject(name string) bool {
+	return isArtifactObject(name) || strings.HasPrefix(name, yarnMirrorObjectPrefix)
+}
@@ -0,0 +1,98 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheServer(t *testing.T) {
+	newServer := func(upstream RemoteCache, allowUpload bool) (*CacheServer, *httptest.Server) {
+		srv, err := NewCacheServer(t.TempDir(), upstream, allowUpload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hs := httptest.NewServer(srv)
+		t.Cleanup(hs.Close)
+		return srv, hs
+	}
+	request := func(method, url, body string) (int, string) {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		res, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(res)
+	}
+
+	upstream, upstreamHTTP := newServer(nil, true)
+	proxy, proxyHTTP := newServer(HTTPRemoteCache{URL: upstreamHTTP.URL, Transfer: TransferOptions{Jobs: 1}}, false)
+
+	tests := []struct {
+		Name           string
+		Method         string
+		URL            string
+		Body           string
+		ExpectedStatus int
+		ExpectedBody   string
+		ExpectedFile   string
+	}{
+		{Name: "upload", Method: http.MethodPut, URL: upstreamHTTP.URL + "/abc.tar.gz", Body: "artifact", ExpectedStatus: http.StatusCreated, ExpectedFile: filepath.Join(upstream.Location, "abc.tar.gz")},
+		{Name: "upload object", Method: http.MethodPut, URL: upstreamHTTP.URL + "/abc.manifest.json", Body: "{}", ExpectedStatus: http.StatusCreated, ExpectedFile: filepath.Join(upstream.Location, cacheServerObjectsDir, "abc.manifest.json")},
+		{Name: "upload disabled", Method: http.MethodPut, URL: proxyHTTP.URL + "/abc.tar.gz", Body: "artifact", ExpectedStatus: http.StatusForbidden},
+		{Name: "download", Method: http.MethodGet, URL: upstreamHTTP.URL + "/abc.tar.gz", ExpectedStatus: http.StatusOK, ExpectedBody: "artifact"},
+		{Name: "read-through", Method: http.MethodGet, URL: proxyHTTP.URL + "/abc.tar.gz", ExpectedStatus: http.StatusOK, ExpectedBody: "artifact", ExpectedFile: filepath.Join(proxy.Location, "abc.tar.gz")},
+		{Name: "read-through object", Method: http.MethodGet, URL: proxyHTTP.URL + "/abc.manifest.json", ExpectedStatus: http.StatusOK, ExpectedBody: "{}"},
+		{Name: "not found", Method: http.MethodGet, URL: proxyHTTP.URL + "/def.tar.gz", ExpectedStatus: http.StatusNotFound},
+		{Name: "invalid name", Method: http.MethodGet, URL: proxyHTTP.URL + "/..%2fabc.tar.gz", ExpectedStatus: http.StatusBadRequest},
+		{Name: "list", Method: http.MethodGet, URL: upstreamHTTP.URL + "/?prefix=abc", ExpectedStatus: http.StatusOK, ExpectedBody: "abc.manifest.json\nabc.tar.gz\n"},
+		{Name: "upload another object", Method: http.MethodPut, URL: upstreamHTTP.URL + "/abd.json", Body: "{}", ExpectedStatus: http.StatusCreated},
+		{Name: "list read-through", Method: http.MethodGet, URL: proxyHTTP.URL + "/?prefix=ab", ExpectedStatus: http.StatusOK, ExpectedBody: "abc.manifest.json\nabc.tar.gz\nabd.json\n"},
+		{Name: "list invalid prefix", Method: http.MethodGet, URL: proxyHTTP.URL + "/?prefix=..%2fabc", ExpectedStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			status, body := request(test.Method, test.URL, test.Body)
+			if status != test.ExpectedStatus {
+				t.Fatalf("unexpected status: expected %d, got %d", test.ExpectedStatus, status)
+			}
+			if test.ExpectedBody != "" && body != test.ExpectedBody {
+				t.Errorf("unexpected body: expected %q, got %q", test.ExpectedBody, body)
+			}
+			if test.ExpectedFile != "" {
+				if _, err := os.Stat(test.ExpectedFile); err != nil {
+					t.Errorf("expected %s to exist: %v", test.ExpectedFile, err)
+				}
+			}
+		})
+	}
+}
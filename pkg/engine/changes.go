@@ -0,0 +1,166 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/bhojpur/gorpa/pkg/doublestar"
+)
+
+// ChangedSince returns the components and packages affected by the files which changed since a Git revision.
+// A component is affected if its BUILD.yaml changed, a package if its BUILD.yaml or one of its sources did.
+// Deleted files affect the packages whose source globs match them. A changed APPLICATION.yaml affects everything. Rev can also be a range, e.g. main..HEAD, in which case
+// uncommitted and untracked files are not considered.
+func (a *Application) ChangedSince(rev string) (comps map[string]*Component, pkgs map[string]*Package, err error) {
+	files, err := gitChangedFiles(a.Origin, rev)
+	if err != nil {
+		return nil, nil, err
+	}
+	comps, pkgs = a.affectedBy(files)
+	return comps, pkgs, nil
+}
+
+// AffectedSince returns the packages affected by the files which changed since a Git revision (see ChangedSince),
+// and the packages which depend on those, i.e. the packages an incremental build has to build and test.
+// Both lists are sorted by name.
+func (a *Application) AffectedSince(rev string) (changed []*Package, dependents []*Package, err error) {
+	_, pkgs, err := a.ChangedSince(rev)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed = make([]*Package, 0, len(pkgs))
+	for _, p := range pkgs {
+		changed = append(changed, p)
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].FullName() < changed[j].FullName() })
+	return changed, a.Dependents(changed), nil
+}
+
+// Dependents returns the packages which depend on any of pkgs, directly or transitively, sorted by name.
+// The packages themselves are not part of the result.
+func (a *Application) Dependents(pkgs []*Package) []*Package {
+	rdeps := a.reverseDependencies()
+	return exceptPackages(walkPackages(pkgs, -1, func(p *Package) []*Package { return rdeps[p] }), pkgs)
+}
+
+// affectedBy returns the components and packages affected by changes to these files, see ChangedSince
+func (a *Application) affectedBy(files []string) (comps map[string]*Component, pkgs map[string]*Package) {
+	comps = make(map[string]*Component)
+	pkgs = make(map[string]*Package)
+
+	changed := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		changed[f] = struct{}{}
+	}
+	if _, ok := changed[filepath.Join(a.Origin, "APPLICATION.yaml")]; ok {
+		for n, c := range a.Components {
+			comps[n] = c
+		}
+		for n, p := range a.Packages {
+			pkgs[n] = p
+		}
+		return
+	}
+
+	for n, c := range a.Components {
+		if _, ok := changed[filepath.Join(c.Origin, "BUILD.yaml")]; !ok {
+			continue
+		}
+		comps[n] = c
+		for _, p := range c.Packages {
+			pkgs[p.FullName()] = p
+		}
+	}
+	for n, p := range a.Packages {
+		for _, src := range p.Sources {
+			if _, ok := changed[src]; ok {
+				pkgs[n] = p
+				break
+			}
+		}
+		if _, ok := pkgs[n]; ok {
+			continue
+		}
+		if matchesSourceGlob(p, files) {
+			pkgs[n] = p
+		}
+	}
+	return
+}
+
+// matchesSourceGlob returns true if one of the files is below the package's component and matches one of the
+// source globs of the package. Deleted files are no longer part of the package sources, but still match.
+func matchesSourceGlob(p *Package, files []string) bool {
+	for _, fn := range files {
+		rel, err := filepath.Rel(p.C.Origin, fn)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		for _, glob := range p.originalSources {
+			if ok, _ := doublestar.Match(glob, filepath.ToSlash(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gitChangedFiles lists the absolute paths of all files below dir which changed since rev, including
+// uncommitted and untracked ones unless rev is a range.
+func gitChangedFiles(dir, rev string) ([]string, error) {
+	var res []string
+	list := func(args ...string) error {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return xerrors.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		for _, f := range strings.Split(string(out), "\x00") {
+			if f == "" {
+				continue
+			}
+			res = append(res, filepath.Join(dir, f))
+		}
+		return nil
+	}
+
+	err := list("diff", "--name-only", "--relative", "-z", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(rev, "..") {
+		return res, nil
+	}
+	err = list("ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
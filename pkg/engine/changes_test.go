@@ -0,0 +1,154 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAffectedBy(t *testing.T) {
+	ba := &Application{Origin: "/app", Components: make(map[string]*Component), Packages: make(map[string]*Package)}
+	addPkg := func(comp, name string, srcs ...string) {
+		c, ok := ba.Components[comp]
+		if !ok {
+			c = &Component{W: ba, Name: comp, Origin: filepath.Join(ba.Origin, comp)}
+			ba.Components[comp] = c
+		}
+		p := &Package{C: c, packageInternal: packageInternal{Name: name, Type: GenericPackage, Sources: srcs}, originalSources: []string{name + "*.txt"}}
+		c.Packages = append(c.Packages, p)
+		ba.Packages[p.FullName()] = p
+	}
+	addPkg("a", "one", "/app/a/one.txt")
+	addPkg("a", "two", "/app/a/two.txt")
+	addPkg("b", "three", "/app/b/three.txt")
+
+	tests := []struct {
+		Name  string
+		Files []string
+		Comps []string
+		Pkgs  []string
+	}{
+		{Name: "nothing", Files: []string{"/app/README.md"}},
+		{Name: "source", Files: []string{"/app/a/two.txt"}, Pkgs: []string{"a:two"}},
+		{Name: "deleted source", Files: []string{"/app/b/three-old.txt"}, Pkgs: []string{"b:three"}},
+		{Name: "other component", Files: []string{"/app/three.txt"}},
+		{Name: "BUILD.yaml", Files: []string{"/app/a/BUILD.yaml"}, Comps: []string{"a"}, Pkgs: []string{"a:one", "a:two"}},
+		{Name: "APPLICATION.yaml", Files: []string{"/app/APPLICATION.yaml"}, Comps: []string{"a", "b"}, Pkgs: []string{"a:one", "a:two", "b:three"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			comps, pkgs := ba.affectedBy(test.Files)
+			var act struct{ Comps, Pkgs []string }
+			for n := range comps {
+				act.Comps = append(act.Comps, n)
+			}
+			for n := range pkgs {
+				act.Pkgs = append(act.Pkgs, n)
+			}
+			sort.Strings(act.Comps)
+			sort.Strings(act.Pkgs)
+			if diff := cmp.Diff(struct{ Comps, Pkgs []string }{test.Comps, test.Pkgs}, act); diff != "" {
+				t.Errorf("affectedBy() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGitChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(fn, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("committed", "a")
+	write("modified", "a")
+	git("add", "-A")
+	git("commit", "-qm", "initial")
+	git("tag", "base")
+	write("later", "a")
+	git("add", "-A")
+	git("commit", "-qm", "later")
+	write("modified", "b")
+	write("untracked", "a")
+
+	files, err := gitChangedFiles(dir, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	exp := []string{filepath.Join(dir, "later"), filepath.Join(dir, "modified"), filepath.Join(dir, "untracked")}
+	if diff := cmp.Diff(exp, files); diff != "" {
+		t.Errorf("gitChangedFiles(base) mismatch (-want +got):\n%s", diff)
+	}
+
+	files, err = gitChangedFiles(dir, "base..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(dir, "later")}, files); diff != "" {
+		t.Errorf("gitChangedFiles(base..HEAD) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	ba := &Application{Packages: make(map[string]*Package)}
+	addPkg := func(name string, deps ...string) {
+		p := &Package{C: &Component{W: ba, Name: "c"}, packageInternal: packageInternal{Name: name, Type: GenericPackage}}
+		for _, dep := range deps {
+			p.dependencies = append(p.dependencies, ba.Packages["c:"+dep])
+		}
+		ba.Packages[p.FullName()] = p
+	}
+	addPkg("lib")
+	addPkg("other")
+	addPkg("api", "lib")
+	addPkg("app", "api", "other")
+	addPkg("tool", "other")
+
+	var act []string
+	for _, p := range ba.Dependents([]*Package{ba.Packages["c:lib"], ba.Packages["c:api"]}) {
+		act = append(act, p.FullName())
+	}
+	if diff := cmp.Diff([]string{"c:app"}, act); diff != "" {
+		t.Errorf("Dependents() mismatch (-want +got):\n%s", diff)
+	}
+}
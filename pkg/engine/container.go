@@ -0,0 +1,99 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// EnvvarContainerCLI selects the container CLI and takes precedence over the containerCLI setting in the APPLICATION.yaml
+const EnvvarContainerCLI = "GORPA_CONTAINER_CLI"
+
+// ContainerCLI is the command line tool Docker packages are built, tagged and pushed with
+type ContainerCLI string
+
+const (
+	// ContainerCLIDocker uses the Docker CLI and daemon
+	ContainerCLIDocker ContainerCLI = "docker"
+	// ContainerCLIPodman uses Podman, which builds images without a daemon and supports rootless builds
+	ContainerCLIPodman ContainerCLI = "podman"
+	// ContainerCLINerdctl uses nerdctl against containerd. Builds need a buildkitd.
+	ContainerCLINerdctl ContainerCLI = "nerdctl"
+)
+
+// Validate returns an error if the container CLI is not supported
+func (cli ContainerCLI) Validate() error {
+	switch cli {
+	case ContainerCLIDocker, ContainerCLIPodman, ContainerCLINerdctl, "":
+		return nil
+	default:
+		return xerrors.Errorf("unsupported container CLI %s: must be one of %s, %s or %s", cli, ContainerCLIDocker, ContainerCLIPodman, ContainerCLINerdctl)
+	}
+}
+
+// command returns the command line of a container CLI invocation
+func (cli ContainerCLI) command(args ...string) []string {
+	return append([]string{string(cli)}, args...)
+}
+
+// containerRunCommand produces the command which runs bash in a container of image. The arguments to bash
+// are appended by the caller. Directories in mounts are mounted at their host paths. Interactive containers
+// read from stdin.
+func containerRunCommand(cli ContainerCLI, image, wd string, mounts, env []string, interactive bool) []string {
+	cmd := cli.command("run", "--rm")
+	if interactive {
+		cmd = append(cmd, "-i")
+	}
+	if cli != ContainerCLIPodman {
+		// rootless podman maps the container's root to the calling user anyways
+		cmd = append(cmd, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	seen := make(map[string]struct{}, len(mounts))
+	for _, m := range mounts {
+		if _, ok := seen[m]; ok || m == "" {
+			continue
+		}
+		seen[m] = struct{}{}
+		cmd = append(cmd, "-v", m+":"+m)
+	}
+	cmd = append(cmd, "-w", wd)
+	for _, e := range env {
+		cmd = append(cmd, "-e", e)
+	}
+	return append(cmd, "--entrypoint", "bash", image)
+}
+
+// WithContainerCLI configures the command line tool Docker packages are built with
+func WithContainerCLI(cli ContainerCLI) BuildOption {
+	return func(opts *buildOptions) error {
+		err := cli.Validate()
+		if err != nil {
+			return err
+		}
+		if cli != "" {
+			opts.ContainerCLI = cli
+		}
+		return nil
+	}
+}
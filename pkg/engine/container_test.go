@@ -0,0 +1,59 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestContainerRunCommand(t *testing.T) {
+	user := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	tests := []struct {
+		Name        string
+		CLI         ContainerCLI
+		Interactive bool
+		Expectation []string
+	}{
+		{
+			Name:        "docker",
+			CLI:         ContainerCLIDocker,
+			Expectation: []string{"docker", "run", "--rm", "--user", user, "-v", "/app:/app", "-v", "/tmp/deps:/tmp/deps", "-w", "/app/comp", "-e", "FOO=bar", "--entrypoint", "bash", "alpine:3"},
+		},
+		{
+			Name:        "podman interactive",
+			CLI:         ContainerCLIPodman,
+			Interactive: true,
+			Expectation: []string{"podman", "run", "--rm", "-i", "-v", "/app:/app", "-v", "/tmp/deps:/tmp/deps", "-w", "/app/comp", "-e", "FOO=bar", "--entrypoint", "bash", "alpine:3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := containerRunCommand(test.CLI, "alpine:3", "/app/comp", []string{"/app", "/tmp/deps", "/app"}, []string{"FOO=bar"}, test.Interactive)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("containerRunCommand() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
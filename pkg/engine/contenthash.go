@@ -0,0 +1,125 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/minio/highwayhash"
+	"golang.org/x/xerrors"
+	"lukechampine.com/blake3"
+)
+
+// ContentHashAlgorithm is the algorithm used to hash the sources, definition and environment manifest of packages
+type ContentHashAlgorithm string
+
+const (
+	// ContentHashHighwayhash is the algorithm Bhojpur GoRPA has always used
+	ContentHashHighwayhash ContentHashAlgorithm = "highwayhash"
+	// ContentHashSHA256 uses HMAC-SHA256
+	ContentHashSHA256 ContentHashAlgorithm = "sha256"
+	// ContentHashBLAKE3 uses keyed BLAKE3
+	ContentHashBLAKE3 ContentHashAlgorithm = "blake3"
+)
+
+// ContentHash configures how content manifests are hashed. Changing the algorithm or key changes the
+// version of every package, see Rekey for carrying a remote cache over.
+type ContentHash struct {
+	Algorithm ContentHashAlgorithm `yaml:"algorithm,omitempty"`
+	// Key is the hex-encoded 32 byte key. Use ${env:...} to keep it out of the APPLICATION.yaml.
+	Key string `yaml:"key,omitempty"`
+}
+
+func (c ContentHash) algorithm() ContentHashAlgorithm {
+	if c.Algorithm == "" {
+		return ContentHashHighwayhash
+	}
+	return c.Algorithm
+}
+
+func (c ContentHash) key() ([]byte, error) {
+	k := c.Key
+	if k == "" {
+		k = contentHashKey
+	}
+	key, err := hex.DecodeString(k)
+	if err != nil {
+		return nil, xerrors.Errorf("content hash key must be hex-encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, xerrors.Errorf("content hash key must be 32 bytes long, not %d", len(key))
+	}
+	return key, nil
+}
+
+// isDefault is true if hashes are computed the way they were before the content hash was configurable
+func (c ContentHash) isDefault() bool {
+	return c.algorithm() == ContentHashHighwayhash && (c.Key == "" || strings.EqualFold(c.Key, contentHashKey))
+}
+
+// Validate returns an error if the algorithm is not supported or the key is invalid
+func (c ContentHash) Validate() error {
+	switch c.algorithm() {
+	case ContentHashHighwayhash, ContentHashSHA256, ContentHashBLAKE3:
+	default:
+		return xerrors.Errorf("unsupported content hash algorithm %s: must be one of %s, %s or %s", c.Algorithm, ContentHashHighwayhash, ContentHashSHA256, ContentHashBLAKE3)
+	}
+	_, err := c.key()
+	return err
+}
+
+// KeyID identifies the key without revealing it
+func (c ContentHash) KeyID() string {
+	key, err := c.key()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// String describes the configuration as it's recorded in the version manifest
+func (c ContentHash) String() string {
+	return fmt.Sprintf("%s key:%s", c.algorithm(), c.KeyID())
+}
+
+func (c ContentHash) newHash() (hash.Hash, error) {
+	key, err := c.key()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.algorithm() {
+	case ContentHashHighwayhash:
+		return highwayhash.New(key)
+	case ContentHashSHA256:
+		return hmac.New(sha256.New, key), nil
+	case ContentHashBLAKE3:
+		return blake3.New(32, key), nil
+	default:
+		return nil, xerrors.Errorf("unsupported content hash algorithm %s", c.Algorithm)
+	}
+}
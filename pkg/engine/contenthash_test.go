@@ -0,0 +1,164 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// dirRemoteCache is a remote cache which keeps the artifacts in a directory
+type dirRemoteCache struct {
+	Dir string
+}
+
+func (rc dirRemoteCache) Download(dst Cache, pkgs []*Package) error {
+	for _, p := range pkgs {
+		fn, _ := dst.Location(p)
+		fc, err := ioutil.ReadFile(filepath.Join(rc.Dir, filepath.Base(fn)))
+		if err != nil {
+			continue
+		}
+		err = ioutil.WriteFile(fn, fc, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rc dirRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	for _, p := range pkgs {
+		fn, exists := src.Location(p)
+		if !exists {
+			continue
+		}
+		fc, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(rc.Dir, filepath.Base(fn)), fc, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestContentHashVersion(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src.txt")
+	err := ioutil.WriteFile(src, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := func(cfg ContentHash) string {
+		ba := &Application{ContentHash: cfg}
+		p := testPackage(ba, "pkg", GenericPackage)
+		p.Sources = []string{src}
+		v, err := p.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	const otherKey = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	var (
+		def      = version(ContentHash{})
+		versions = make(map[string]string)
+		configs  = map[string]ContentHash{
+			"explicit default": {Algorithm: ContentHashHighwayhash, Key: contentHashKey},
+			"highwayhash key":  {Key: otherKey},
+			"sha256":           {Algorithm: ContentHashSHA256},
+			"sha256 key":       {Algorithm: ContentHashSHA256, Key: otherKey},
+			"blake3":           {Algorithm: ContentHashBLAKE3},
+		}
+	)
+	for name, cfg := range configs {
+		err := cfg.Validate()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		v := version(cfg)
+		if name == "explicit default" {
+			if v != def {
+				t.Errorf("explicitly configuring the default content hash changed the version")
+			}
+			continue
+		}
+		if v == def {
+			t.Errorf("%s: version did not change", name)
+		}
+		if other, exists := versions[v]; exists {
+			t.Errorf("%s and %s produce the same version", name, other)
+		}
+		versions[v] = name
+	}
+
+	for _, cfg := range []ContentHash{{Algorithm: "md5"}, {Key: "not-hex"}, {Key: "0011"}} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	var (
+		ba     = &Application{}
+		p      = testPackage(ba, "pkg", GenericPackage)
+		remote = dirRemoteCache{Dir: t.TempDir()}
+		local  = &FilesystemCache{Origin: t.TempDir()}
+	)
+	fn, _ := local.Location(p)
+	err := ioutil.WriteFile(fn, []byte("artifact"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.Upload(local, []*Package{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, _ := p.Version()
+
+	ba.ContentHash = ContentHash{Algorithm: ContentHashBLAKE3}
+	p.versionCache = ""
+	rekeyed, err := Rekey([]*Package{p}, ContentHash{}, WithLocalCache(local), WithRemoteCache(remote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rekeyed) != 1 {
+		t.Fatalf("expected one rekeyed package, got %d", len(rekeyed))
+	}
+
+	current, _ := p.Version()
+	if current == previous {
+		t.Fatal("version did not change")
+	}
+	fn, _ = local.Location(p)
+	fc, err := ioutil.ReadFile(filepath.Join(remote.Dir, filepath.Base(fn)))
+	if err != nil {
+		t.Fatalf("artifact was not copied to the current version: %v", err)
+	}
+	if string(fc) != "artifact" {
+		t.Errorf("unexpected artifact content %q", fc)
+	}
+}
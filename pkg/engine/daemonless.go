@@ -0,0 +1,133 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"golang.org/x/xerrors"
+)
+
+// daemonlessDigestFile is the file daemonless builders write the digest of the image they built to
+const daemonlessDigestFile = ".gorpa-image-digest"
+
+// kanikoCommand produces the kaniko executor command for a Docker package. kaniko pushes the images itself
+// or, for packages without images, exports the image as Docker archive to exportFile.
+func (p *Package) kanikoCommand(buildctx *buildContext, cfg DockerPkgConfig, wd, version string, images []string, exportFile string) ([]string, error) {
+	if len(cfg.Platforms) > 0 {
+		return nil, xerrors.Errorf("multi-arch images are not supported by the %s Docker builder", DockerBuilderKaniko)
+	}
+	if len(cfg.Secrets) > 0 || len(cfg.SSH) > 0 {
+		return nil, xerrors.Errorf("secrets and SSH forwarding are not supported by the %s Docker builder", DockerBuilderKaniko)
+	}
+
+	cmd := []string{"executor",
+		"--context", "dir://" + wd,
+		"--dockerfile", filepath.Join(wd, "Dockerfile"),
+	}
+	if len(images) == 0 {
+		cmd = append(cmd, "--no-push", "--destination", version, "--tar-path", exportFile)
+	} else {
+		for _, img := range images {
+			cmd = append(cmd, "--destination", img)
+		}
+		cmd = append(cmd, "--digest-file", filepath.Join(wd, daemonlessDigestFile))
+		if buildctx.Push.Retries > 0 {
+			// kaniko pushes the images itself, hence it has to retry failed pushes, too
+			cmd = append(cmd, fmt.Sprintf("--push-retry=%d", buildctx.Push.Retries))
+		}
+	}
+	for arg, val := range cfg.BuildArgs {
+		cmd = append(cmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
+	}
+	cmd = append(cmd, "--build-arg", fmt.Sprintf("__GIT_COMMIT=%s", p.C.Git().Commit))
+	for _, label := range dockerLabels(cfg) {
+		cmd = append(cmd, "--label", label)
+	}
+	if cfg.Squash {
+		cmd = append(cmd, "--single-snapshot")
+	}
+	if buildctx.DockerBuildOptions != nil {
+		for opt, v := range *buildctx.DockerBuildOptions {
+			cmd = append(cmd, fmt.Sprintf("--%s=%s", opt, v))
+		}
+	}
+	return cmd, nil
+}
+
+// buildahCommand produces the buildah command for a Docker package. buildah keeps the image in its local storage,
+// from where it is pushed or exported like images built by the Docker daemon.
+func (p *Package) buildahCommand(buildctx *buildContext, cfg DockerPkgConfig, version string) ([]string, error) {
+	if len(cfg.Platforms) > 0 {
+		return nil, xerrors.Errorf("multi-arch images are not supported by the %s Docker builder", DockerBuilderBuildah)
+	}
+
+	cmd := []string{"buildah", "build", "--pull", "--layers", "--iidfile", daemonlessDigestFile, "-t", version}
+	for arg, val := range cfg.BuildArgs {
+		cmd = append(cmd, "--build-arg", fmt.Sprintf("%s=%s", arg, val))
+	}
+	cmd = append(cmd, "--build-arg", fmt.Sprintf("__GIT_COMMIT=%s", p.C.Git().Commit))
+	for _, label := range dockerLabels(cfg) {
+		cmd = append(cmd, "--label", label)
+	}
+	secrets, err := p.dockerSecretArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cmd = append(cmd, secrets...)
+	if cfg.Squash {
+		cmd = append(cmd, "--squash")
+	}
+	if buildctx.DockerBuildOptions != nil {
+		for opt, v := range *buildctx.DockerBuildOptions {
+			cmd = append(cmd, fmt.Sprintf("--%s=%s", opt, v))
+		}
+	}
+	cmd = append(cmd, ".")
+	return cmd, nil
+}
+
+// daemonlessSubjects produces the provenance subjects of images built by a daemonless builder. kaniko reports the
+// digest of the image manifest, buildah the image ID.
+func daemonlessSubjects(wd string, images []string) ([]in_toto.Subject, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(wd, daemonlessDigestFile))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read image digest: %w", err)
+	}
+	digest := strings.TrimSpace(string(fc))
+	segs := strings.Split(digest, ":")
+	if len(segs) != 2 {
+		return nil, xerrors.Errorf("image digest is invalid: %s", digest)
+	}
+
+	res := make([]in_toto.Subject, 0, len(images))
+	for _, img := range images {
+		res = append(res, in_toto.Subject{
+			Name:   img,
+			Digest: in_toto.DigestSet{segs[0]: segs[1]},
+		})
+	}
+	return res, nil
+}
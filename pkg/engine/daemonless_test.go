@@ -0,0 +1,75 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKanikoCommand(t *testing.T) {
+	pkg := &Package{
+		C:               &Component{Name: "comp", W: &Application{}},
+		packageInternal: packageInternal{Name: "img"},
+	}
+
+	tests := []struct {
+		Name        string
+		Config      DockerPkgConfig
+		Images      []string
+		Expectation []string
+		ExpectError bool
+	}{
+		{
+			Name:        "export",
+			Expectation: []string{"executor", "--context", "dir:///build", "--dockerfile", "/build/Dockerfile", "--no-push", "--destination", "v1", "--tar-path", "/build/v1.tar", "--build-arg", "__GIT_COMMIT="},
+		},
+		{
+			Name:        "push",
+			Config:      DockerPkgConfig{Squash: true},
+			Images:      []string{"registry/app:v1", "registry/app:latest"},
+			Expectation: []string{"executor", "--context", "dir:///build", "--dockerfile", "/build/Dockerfile", "--destination", "registry/app:v1", "--destination", "registry/app:latest", "--digest-file", "/build/" + daemonlessDigestFile, "--build-arg", "__GIT_COMMIT=", "--single-snapshot"},
+		},
+		{
+			Name:        "multi-arch",
+			Config:      DockerPkgConfig{Platforms: []string{"linux/amd64", "linux/arm64"}},
+			ExpectError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := pkg.kanikoCommand(&buildContext{}, test.Config, "/build", "v1", test.Images, "/build/v1.tar")
+			if test.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("kanikoCommand() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultDeltaMaxChain is the default number of deltas which may be stacked on top of a full artifact
+	DefaultDeltaMaxChain = 5
+
+	// deltaMaxRatio is the size of a delta relative to its full artifact above which we upload the full artifact instead
+	deltaMaxRatio = 0.8
+
+	deltaManifestSuffix = ".manifest.json"
+	deltaArtifactSuffix = ".delta.tar.gz"
+	deltaLatestSuffix   = ".latest"
+)
+
+// objectStore is implemented by remote caches which can store objects other than build artifacts,
+// e.g. the manifests and deltas of a DeltaRemoteCache. Like all remote cache transfers this is best effort:
+// objects which cannot be transferred are skipped.
+type objectStore interface {
+	// getObjects downloads objects (map keys) to local files (map values)
+	getObjects(objs map[string]string)
+	// putObjects uploads local files (map values) as objects (map keys)
+	putObjects(objs map[string]string)
+}
+
+// NewDeltaRemoteCache enables delta transfers for a remote cache
+func NewDeltaRemoteCache(rc RemoteCache, maxChain int) (*DeltaRemoteCache, error) {
+	store, ok := rc.(objectStore)
+	if !ok {
+		return nil, xerrors.Errorf("remote cache %T does not support delta transfers", rc)
+	}
+	if maxChain <= 0 {
+		maxChain = DefaultDeltaMaxChain
+	}
+	return &DeltaRemoteCache{C: rc, MaxChain: maxChain, store: store}, nil
+}
+
+// DeltaRemoteCache uploads only the files which changed compared to the previous version of a package.
+// Next to each artifact it stores a manifest of the artifact's files, which tells clients which version the
+// delta is based on and lets them verify the reconstructed artifact.
+//
+// Deltas are computed per file, not per byte: an artifact where a few files out of many changed benefits,
+// one big file which changed slightly does not.
+type DeltaRemoteCache struct {
+	C        RemoteCache
+	MaxChain int
+	// Progress receives the progress messages of delta uploads. Defaults to stdout.
+	Progress io.Writer
+
+	store objectStore
+}
+
+// deltaManifest describes the files of an artifact and how it is stored in the remote cache
+type deltaManifest struct {
+	Version string `json:"version"`
+	// Base is the version this artifact's delta is based on. Base is empty if the full artifact was uploaded.
+	Base string `json:"base,omitempty"`
+	// Depth is the number of deltas which need to be applied to a full artifact to obtain this artifact
+	Depth int          `json:"depth"`
+	Files []deltaEntry `json:"files"`
+}
+
+type deltaEntry struct {
+	Name     string `json:"name"`
+	Type     byte   `json:"type"`
+	Mode     int64  `json:"mode"`
+	Size     int64  `json:"size,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Linkname string `json:"linkname,omitempty"`
+}
+
+func (rs *DeltaRemoteCache) String() string {
+	return RemoteCacheName(rs.C)
+}
+
+// Download makes a best-effort attempt at downloading previously cached build artifacts. Artifacts which are
+// not available in full are reconstructed from their delta and the artifact of the version the delta is based on.
+func (rs *DeltaRemoteCache) Download(dst Cache, pkgs []*Package) error {
+	err := rs.C.Download(dst, pkgs)
+	if err != nil {
+		return err
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-delta-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, pkg := range pkgs {
+		fn, exists := dst.Location(pkg)
+		if exists || fn == "" {
+			continue
+		}
+		version := strings.TrimSuffix(filepath.Base(fn), ".tar.gz")
+
+		err := rs.reconstruct(tmpdir, filepath.Dir(fn), version, rs.MaxChain)
+		if err != nil {
+			log.WithError(err).WithField("package", pkg.FullName()).Warn("cannot reconstruct artifact from remote cache delta")
+			continue
+		}
+		if _, err := os.Stat(fn); err == nil {
+			log.WithField("package", pkg.FullName()).Debug("reconstructed artifact from remote cache delta")
+		}
+	}
+	return nil
+}
+
+// reconstruct downloads or reconstructs the artifact of a version into the cache directory. A version for which
+// the remote cache has no manifest is a cache miss and not an error.
+func (rs *DeltaRemoteCache) reconstruct(tmpdir, cachedir, version string, budget int) error {
+	fn := filepath.Join(cachedir, version+".tar.gz")
+	if _, err := os.Stat(fn); err == nil {
+		return nil
+	}
+
+	mf, err := rs.getManifest(tmpdir, version)
+	if err != nil || mf == nil {
+		return err
+	}
+	if mf.Base == "" {
+		// the full artifact was uploaded - the only way to get here is as base of another delta
+		rs.store.getObjects(map[string]string{version + ".tar.gz": fn + ".download"})
+		if _, err := os.Stat(fn + ".download"); err != nil {
+			return nil
+		}
+		return os.Rename(fn+".download", fn)
+	}
+	if budget <= 0 {
+		return xerrors.Errorf("delta chain of %s is longer than %d", version, rs.MaxChain)
+	}
+
+	err = rs.reconstruct(tmpdir, cachedir, mf.Base, budget-1)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(cachedir, mf.Base+".tar.gz")
+	if _, err := os.Stat(base); err != nil {
+		return nil
+	}
+
+	delta := filepath.Join(tmpdir, version+deltaArtifactSuffix)
+	rs.store.getObjects(map[string]string{version + deltaArtifactSuffix: delta})
+	if _, err := os.Stat(delta); err != nil {
+		return nil
+	}
+
+	tmp := fn + ".download"
+	err = applyArtifactDelta(tmp, base, delta, mf.Files)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func (rs *DeltaRemoteCache) getManifest(tmpdir, version string) (*deltaManifest, error) {
+	fn := filepath.Join(tmpdir, version+deltaManifestSuffix)
+	rs.store.getObjects(map[string]string{version + deltaManifestSuffix: fn})
+	fc, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var mf deltaManifest
+	err = json.Unmarshal(fc, &mf)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot parse manifest of %s: %w", version, err)
+	}
+	return &mf, nil
+}
+
+// Upload makes a best effort to upload the build artifacts to a remote cache. If the previous version of a package
+// is in the remote cache, only the files which changed since are uploaded.
+func (rs *DeltaRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	out := rs.Progress
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "☁️  uploading build artifact deltas to remote cache\n")
+	tmpdir, err := ioutil.TempDir("", "gorpa-delta-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	type upload struct {
+		Pkg      *Package
+		Artifact string
+		Version  string
+		Latest   string
+	}
+	var (
+		uploads []upload
+		latest  = make(map[string]string)
+	)
+	for _, pkg := range pkgs {
+		fn, exists := src.Location(pkg)
+		if !exists {
+			continue
+		}
+		u := upload{
+			Pkg:      pkg,
+			Artifact: fn,
+			Version:  strings.TrimSuffix(filepath.Base(fn), ".tar.gz"),
+			Latest:   pkg.FilesystemSafeName() + deltaLatestSuffix,
+		}
+		uploads = append(uploads, u)
+		latest[u.Latest] = filepath.Join(tmpdir, u.Latest)
+	}
+	rs.store.getObjects(latest)
+
+	var (
+		artifacts []*Package
+		deltas    = make(map[string]string)
+		manifests = make(map[string]string)
+		pointers  = make(map[string]string)
+	)
+	for _, u := range uploads {
+		mf, delta, err := rs.prepareUpload(tmpdir, u.Artifact, u.Version, latest[u.Latest])
+		if err != nil {
+			log.WithError(err).WithField("package", u.Pkg.FullName()).Warn("cannot prepare remote cache upload")
+			continue
+		}
+		if delta == "" {
+			artifacts = append(artifacts, u.Pkg)
+		} else {
+			deltas[u.Version+deltaArtifactSuffix] = delta
+		}
+
+		mffn := filepath.Join(tmpdir, u.Version+deltaManifestSuffix)
+		fc, err := json.Marshal(mf)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(mffn, fc, 0644)
+		if err != nil {
+			return err
+		}
+		manifests[u.Version+deltaManifestSuffix] = mffn
+
+		ptrfn := filepath.Join(tmpdir, u.Latest)
+		err = ioutil.WriteFile(ptrfn, []byte(u.Version), 0644)
+		if err != nil {
+			return err
+		}
+		pointers[u.Latest] = ptrfn
+	}
+
+	// Clients follow the latest pointer to the manifest, and the manifest to the artifact or delta.
+	// Uploading in that order means they never find a manifest without its content.
+	err = rs.C.Upload(src, artifacts)
+	if err != nil {
+		return err
+	}
+	rs.store.putObjects(deltas)
+	rs.store.putObjects(manifests)
+	rs.store.putObjects(pointers)
+	return nil
+}
+
+// prepareUpload computes the manifest of an artifact and, if worthwhile, the delta against the version the
+// latest pointer file points to. Returns an empty delta if the full artifact should be uploaded.
+func (rs *DeltaRemoteCache) prepareUpload(tmpdir, artifact, version, latestfn string) (mf *deltaManifest, delta string, err error) {
+	files, err := readArtifactManifest(artifact)
+	if err != nil {
+		return nil, "", err
+	}
+	mf = &deltaManifest{Version: version, Files: files}
+
+	latest, err := ioutil.ReadFile(latestfn)
+	if err != nil {
+		// no previous version in the remote cache
+		return mf, "", nil
+	}
+	baseVersion := strings.TrimSpace(string(latest))
+	if baseVersion == "" || baseVersion == version {
+		return mf, "", nil
+	}
+	base, err := rs.getManifest(tmpdir, baseVersion)
+	if err != nil || base == nil || base.Depth+1 > rs.MaxChain {
+		return mf, "", nil
+	}
+
+	delta = filepath.Join(tmpdir, version+deltaArtifactSuffix)
+	err = writeArtifactDelta(delta, artifact, base.Files, files)
+	if err != nil {
+		return nil, "", err
+	}
+	dstat, err := os.Stat(delta)
+	if err != nil {
+		return nil, "", err
+	}
+	astat, err := os.Stat(artifact)
+	if err != nil {
+		return nil, "", err
+	}
+	if float64(dstat.Size()) > deltaMaxRatio*float64(astat.Size()) {
+		log.WithField("artifact", artifact).WithField("base", baseVersion).Debug("delta is not worth it - uploading full artifact")
+		return mf, "", nil
+	}
+
+	mf.Base = baseVersion
+	mf.Depth = base.Depth + 1
+	return mf, delta, nil
+}
+
+// readArtifactManifest lists all entries of a build artifact
+func readArtifactManifest(fn string) ([]deltaEntry, error) {
+	var res []deltaEntry
+	err := walkArtifact(fn, func(hdr *tar.Header, r io.Reader) error {
+		entry, err := newDeltaEntry(hdr, r)
+		if err != nil {
+			return err
+		}
+		res = append(res, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func newDeltaEntry(hdr *tar.Header, r io.Reader) (deltaEntry, error) {
+	res := deltaEntry{
+		Name:     hdr.Name,
+		Type:     hdr.Typeflag,
+		Mode:     hdr.Mode,
+		Linkname: hdr.Linkname,
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		hash := sha256.New()
+		n, err := io.Copy(hash, r)
+		if err != nil {
+			return res, err
+		}
+		res.Size = n
+		res.Hash = hex.EncodeToString(hash.Sum(nil))
+	}
+	return res, nil
+}
+
+func walkArtifact(fn string, visit func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	g, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	a := tar.NewReader(g)
+	for {
+		hdr, err := a.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = visit(hdr, a)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// changedEntries returns the names of all entries of target which are not part of base. Hard links
+// to a changed file count as changed themselves, as the delta is appended after the unchanged entries.
+func changedEntries(base, target []deltaEntry) map[string]struct{} {
+	idx := make(map[string]deltaEntry, len(base))
+	for _, e := range base {
+		idx[e.Name] = e
+	}
+
+	res := make(map[string]struct{})
+	for _, e := range target {
+		if b, ok := idx[e.Name]; ok && b == e {
+			continue
+		}
+		res[e.Name] = struct{}{}
+	}
+	for _, e := range target {
+		if e.Type != tar.TypeLink {
+			continue
+		}
+		if _, changed := res[e.Linkname]; changed {
+			res[e.Name] = struct{}{}
+		}
+	}
+	return res
+}
+
+// writeArtifactDelta writes all entries of artifact which are not part of base to dst
+func writeArtifactDelta(dst, artifact string, base, target []deltaEntry) error {
+	changed := changedEntries(base, target)
+	return writeArtifact(dst, func(out *tar.Writer) error {
+		return walkArtifact(artifact, func(hdr *tar.Header, r io.Reader) error {
+			if _, ok := changed[hdr.Name]; !ok {
+				return nil
+			}
+			return copyArtifactEntry(out, hdr, r)
+		})
+	})
+}
+
+// applyArtifactDelta reconstructs an artifact from the unchanged entries of base followed by the entries of delta,
+// and verifies the result against the target manifest.
+func applyArtifactDelta(dst, base, delta string, target []deltaEntry) error {
+	idx := make(map[string]deltaEntry, len(target))
+	for _, e := range target {
+		idx[e.Name] = e
+	}
+	var replaced = make(map[string]struct{})
+	err := walkArtifact(delta, func(hdr *tar.Header, r io.Reader) error {
+		replaced[hdr.Name] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("cannot read delta: %w", err)
+	}
+
+	err = writeArtifact(dst, func(out *tar.Writer) error {
+		err := walkArtifact(base, func(hdr *tar.Header, r io.Reader) error {
+			if _, ok := idx[hdr.Name]; !ok {
+				// deleted since base
+				return nil
+			}
+			if _, ok := replaced[hdr.Name]; ok {
+				return nil
+			}
+			return copyArtifactEntry(out, hdr, r)
+		})
+		if err != nil {
+			return xerrors.Errorf("cannot read base artifact: %w", err)
+		}
+		return walkArtifact(delta, func(hdr *tar.Header, r io.Reader) error {
+			return copyArtifactEntry(out, hdr, r)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	actual, err := readArtifactManifest(dst)
+	if err != nil {
+		return err
+	}
+	if !sameDeltaEntries(actual, target) {
+		return xerrors.Errorf("reconstructed artifact does not match its manifest")
+	}
+	return nil
+}
+
+func sameDeltaEntries(a, b []deltaEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(s []deltaEntry) []deltaEntry {
+		res := append([]deltaEntry(nil), s...)
+		sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+		return res
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeArtifact(dst string, write func(out *tar.Writer) error) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	g := gzip.NewWriter(f)
+	a := tar.NewWriter(g)
+	err = write(a)
+	if err != nil {
+		return err
+	}
+	err = a.Close()
+	if err != nil {
+		return err
+	}
+	err = g.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func copyArtifactEntry(out *tar.Writer, hdr *tar.Header, r io.Reader) error {
+	err := out.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
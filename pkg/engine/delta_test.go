@@ -0,0 +1,161 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactDelta(t *testing.T) {
+	type entry struct {
+		Name     string
+		Content  string
+		Linkname string
+	}
+	write := func(fn string, entries []entry) {
+		err := writeArtifact(fn, func(out *tar.Writer) error {
+			for _, e := range entries {
+				hdr := &tar.Header{Name: e.Name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.Content))}
+				if strings.HasSuffix(e.Name, "/") {
+					hdr = &tar.Header{Name: e.Name, Mode: 0755, Typeflag: tar.TypeDir}
+				} else if e.Linkname != "" {
+					hdr = &tar.Header{Name: e.Name, Mode: 0644, Typeflag: tar.TypeLink, Linkname: e.Linkname}
+				}
+				err := copyArtifactEntry(out, hdr, strings.NewReader(e.Content))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := []entry{
+		{Name: "./"},
+		{Name: "./unchanged", Content: strings.Repeat("u", 4096)},
+		{Name: "./changed", Content: "old"},
+		{Name: "./deleted", Content: "gone"},
+		{Name: "./link", Linkname: "./changed"},
+	}
+	tests := []struct {
+		Name        string
+		Target      []entry
+		Changed     []string
+		CorruptBase bool
+		ExpectError bool
+	}{
+		{Name: "identical", Target: base},
+		{
+			Name: "changes",
+			Target: []entry{
+				{Name: "./"},
+				{Name: "./unchanged", Content: strings.Repeat("u", 4096)},
+				{Name: "./changed", Content: "new"},
+				{Name: "./link", Linkname: "./changed"},
+				{Name: "./added/"},
+				{Name: "./added/file", Content: "added"},
+			},
+			Changed: []string{"./changed", "./link", "./added/", "./added/file"},
+		},
+		{
+			Name: "base mismatch",
+			Target: []entry{
+				{Name: "./unchanged", Content: strings.Repeat("u", 4096)},
+				{Name: "./changed", Content: "new"},
+			},
+			Changed:     []string{"./changed"},
+			CorruptBase: true,
+			ExpectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gorpa-delta-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			var (
+				basefn   = filepath.Join(dir, "base.tar.gz")
+				targetfn = filepath.Join(dir, "target.tar.gz")
+				deltafn  = filepath.Join(dir, "target.delta.tar.gz")
+				resultfn = filepath.Join(dir, "result.tar.gz")
+			)
+			write(basefn, base)
+			write(targetfn, test.Target)
+
+			basemf, err := readArtifactManifest(basefn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			targetmf, err := readArtifactManifest(targetfn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writeArtifactDelta(deltafn, targetfn, basemf, targetmf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deltamf, err := readArtifactManifest(deltafn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var changed []string
+			for _, e := range deltamf {
+				changed = append(changed, e.Name)
+			}
+			if strings.Join(changed, ",") != strings.Join(test.Changed, ",") {
+				t.Errorf("unexpected delta: expected %v, got %v", test.Changed, changed)
+			}
+
+			if test.CorruptBase {
+				write(basefn, []entry{{Name: "./unchanged", Content: "different"}})
+			}
+			err = applyArtifactDelta(resultfn, basefn, deltafn, targetmf)
+			if test.ExpectError {
+				if err == nil {
+					t.Fatal("expected applying the delta to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot apply delta: %v", err)
+			}
+			resultmf, err := readArtifactManifest(resultfn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameDeltaEntries(resultmf, targetmf) {
+				t.Errorf("reconstructed artifact differs: expected %v, got %v", targetmf, resultmf)
+			}
+		})
+	}
+}
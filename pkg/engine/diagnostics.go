@@ -0,0 +1,169 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Diagnostic is a problem with a source file reported by a package build, e.g. a compiler error or lint finding
+type Diagnostic struct {
+	Package string `json:"package"`
+	// File is the absolute path of the source file in the application, not the build directory
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// diagnosticPattern matches the file:line[:column]: message lines compilers, linters and go test print
+var diagnosticPattern = regexp.MustCompile(`^\s*([^\s:]+\.[A-Za-z0-9]+):(\d+)(?::(\d+))?:\s+(.+)$`)
+
+// NewDiagnosticsReporter produces a reporter which collects the diagnostics of failed package builds
+func NewDiagnosticsReporter() *DiagnosticsReporter {
+	return &DiagnosticsReporter{
+		logs: make(map[string]*bytes.Buffer),
+	}
+}
+
+// DiagnosticsReporter keeps the build output of each package and extracts diagnostics from the output of
+// the packages whose build failed. Use NewDiagnosticsReporter to create an instance.
+type DiagnosticsReporter struct {
+	mu          sync.Mutex
+	logs        map[string]*bytes.Buffer
+	diagnostics []Diagnostic
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *DiagnosticsReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *DiagnosticsReporter) BuildFinished(pkg *Package, err error) {}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *DiagnosticsReporter) PackageBuildStarted(pkg *Package) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logs[pkg.FullName()] = bytes.NewBuffer(nil)
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *DiagnosticsReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log, ok := r.logs[pkg.FullName()]
+	if !ok {
+		log = bytes.NewBuffer(nil)
+		r.logs[pkg.FullName()] = log
+	}
+	log.Write(buf)
+}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *DiagnosticsReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log, ok := r.logs[pkg.FullName()]
+	delete(r.logs, pkg.FullName())
+	if err == nil || !ok {
+		return
+	}
+	r.diagnostics = append(r.diagnostics, parseDiagnostics(pkg, log.Bytes())...)
+}
+
+// Diagnostics returns the diagnostics of all failed package builds, sorted by file and line
+func (r *DiagnosticsReporter) Diagnostics() []Diagnostic {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := append([]Diagnostic(nil), r.diagnostics...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].File != res[j].File {
+			return res[i].File < res[j].File
+		}
+		return res[i].Line < res[j].Line
+	})
+	return res
+}
+
+// parseDiagnostics extracts the diagnostics which refer to sources of the package from its build output
+func parseDiagnostics(pkg *Package, log []byte) []Diagnostic {
+	var (
+		res  []Diagnostic
+		seen = make(map[Diagnostic]struct{})
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		m := diagnosticPattern.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		fn := resolveDiagnosticFile(pkg, m[1])
+		if fn == "" {
+			continue
+		}
+		d := Diagnostic{Package: pkg.FullName(), File: fn, Message: strings.TrimSpace(m[4])}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		if _, exists := seen[d]; exists {
+			continue
+		}
+		seen[d] = struct{}{}
+		res = append(res, d)
+	}
+	return res
+}
+
+// resolveDiagnosticFile maps a path printed during the build to a source of the package. Builds print paths
+// relative to the build directory or to the directory of a Go package, or absolute paths into the build directory,
+// hence we look for the single source whose path ends in what was printed.
+func resolveDiagnosticFile(pkg *Package, printed string) string {
+	printed = filepath.ToSlash(filepath.Clean(printed))
+	var candidates []string
+	for _, src := range pkg.Sources {
+		rel, err := filepath.Rel(pkg.C.Origin, src)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == printed {
+			return src
+		}
+		if strings.HasSuffix(printed, "/"+rel) || strings.HasSuffix(rel, "/"+printed) {
+			candidates = append(candidates, src)
+		}
+	}
+	if len(candidates) != 1 {
+		return ""
+	}
+	return candidates[0]
+}
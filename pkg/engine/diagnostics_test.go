@@ -0,0 +1,61 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	pkg := &Package{
+		C: &Component{Name: "server", Origin: "/app/server"},
+		packageInternal: packageInternal{
+			Name: "lib",
+			Sources: []string{
+				"/app/server/main.go",
+				"/app/server/api/handler.go",
+				"/app/server/web/handler.go",
+			},
+		},
+	}
+
+	log := `[server:lib] # github.com/example/server/api
+api/handler.go:12:5: undefined: foo
+/tmp/build/server-lib.1234/api/handler.go:20:2: missing return
+./main.go:3:1: syntax error: non-declaration statement outside function body
+main.go:3:1: syntax error: non-declaration statement outside function body
+handler.go:7: ambiguous
+/usr/local/go/src/fmt/print.go:10:1: not ours
+--- FAIL: TestFoo (0.00s)
+`
+	expectation := []Diagnostic{
+		{Package: "server:lib", File: "/app/server/api/handler.go", Line: 12, Column: 5, Message: "undefined: foo"},
+		{Package: "server:lib", File: "/app/server/api/handler.go", Line: 20, Column: 2, Message: "missing return"},
+		{Package: "server:lib", File: "/app/server/main.go", Line: 3, Column: 1, Message: "syntax error: non-declaration statement outside function body"},
+	}
+
+	act := parseDiagnostics(pkg, []byte(log))
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("parseDiagnostics() mismatch (-want +got):\n%s", diff)
+	}
+}
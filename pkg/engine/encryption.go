@@ -0,0 +1,391 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvvarRemoteCacheEncryptionKey configures the AES key used to encrypt artifacts before they are uploaded to a remote cache.
+	// The key must be 16, 24 or 32 bytes long and either hex or base64 encoded.
+	EnvvarRemoteCacheEncryptionKey = "GORPA_REMOTE_CACHE_ENCRYPTION_KEY"
+
+	// EnvvarRemoteCacheEncryptionKeyURI configures where to obtain the remote cache encryption key from.
+	// Supported schemes are file://, env:// and gcpkms://. See LoadCacheEncryptionKey for details.
+	EnvvarRemoteCacheEncryptionKeyURI = "GORPA_REMOTE_CACHE_ENCRYPTION_KEY_URI"
+
+	// encryptedArtifactMagic prefixes every encrypted artifact. Bump the trailing version if you change the format.
+	encryptedArtifactMagic = "GORPAEC1"
+
+	// encryptedArtifactChunkSize is the plaintext size of a single sealed chunk
+	encryptedArtifactChunkSize = 64 * 1024
+)
+
+// LoadCacheEncryptionKey loads the remote cache encryption key from the environment.
+// If neither GORPA_REMOTE_CACHE_ENCRYPTION_KEY nor GORPA_REMOTE_CACHE_ENCRYPTION_KEY_URI are set, nil is returned.
+//
+// Key URIs can take the following forms:
+//
+//	file:///path/to/key                  reads the (hex or base64 encoded) key from a file
+//	env://SOME_VAR                       reads the (hex or base64 encoded) key from an environment variable
+//	gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k?ciphertext=/path/to/wrapped.key
+//	                                     unwraps the key using "gcloud kms decrypt"
+func LoadCacheEncryptionKey() ([]byte, error) {
+	if key := os.Getenv(EnvvarRemoteCacheEncryptionKey); key != "" {
+		return decodeCacheEncryptionKey([]byte(key))
+	}
+
+	uri := os.Getenv(EnvvarRemoteCacheEncryptionKeyURI)
+	if uri == "" {
+		return nil, nil
+	}
+	return loadCacheEncryptionKeyFromURI(uri)
+}
+
+func loadCacheEncryptionKeyFromURI(uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid cache encryption key URI: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		fc, err := ioutil.ReadFile(u.Path)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read cache encryption key: %w", err)
+		}
+		return decodeCacheEncryptionKey(fc)
+	case "env":
+		return decodeCacheEncryptionKey([]byte(os.Getenv(u.Host)))
+	case "gcpkms":
+		ciphertext := u.Query().Get("ciphertext")
+		if ciphertext == "" {
+			return nil, xerrors.Errorf("gcpkms key URI requires a ciphertext parameter pointing to the wrapped key")
+		}
+		keyName := strings.TrimPrefix(u.Host+u.Path, "/")
+		out := bytes.NewBuffer(nil)
+		cmd := exec.Command("gcloud", "kms", "decrypt", "--key", keyName, "--ciphertext-file", ciphertext, "--plaintext-file", "-")
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return nil, xerrors.Errorf("cannot unwrap cache encryption key using %s: %w", keyName, err)
+		}
+		return decodeCacheEncryptionKey(out.Bytes())
+	default:
+		return nil, xerrors.Errorf("unsupported cache encryption key URI scheme: %s", u.Scheme)
+	}
+}
+
+func decodeCacheEncryptionKey(raw []byte) ([]byte, error) {
+	enc := strings.TrimSpace(string(raw))
+	if enc == "" {
+		return nil, xerrors.Errorf("cache encryption key is empty")
+	}
+
+	key, err := hex.DecodeString(enc)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(enc)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("cache encryption key must be hex or base64 encoded")
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, xerrors.Errorf("cache encryption key must be 16, 24 or 32 bytes long, not %d", len(key))
+	}
+	return key, nil
+}
+
+// EncryptedRemoteCache encrypts artifacts using AES-GCM before handing them to the remote cache it wraps,
+// and decrypts them after download. The local cache always holds plaintext artifacts.
+type EncryptedRemoteCache struct {
+	C   RemoteCache
+	Key []byte
+}
+
+func (rs EncryptedRemoteCache) String() string {
+	return RemoteCacheName(rs.C) + " (encrypted)"
+}
+
+// Download makes a best-effort attempt at downloading previously cached build artifacts
+func (rs EncryptedRemoteCache) Download(dst Cache, pkgs []*Package) error {
+	var missing []*Package
+	for _, pkg := range pkgs {
+		if _, exists := dst.Location(pkg); exists {
+			continue
+		}
+		missing = append(missing, pkg)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	staging, cleanup, err := newStagingCache()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	err = rs.C.Download(staging, missing)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range missing {
+		src, exists := staging.Location(pkg)
+		if !exists {
+			continue
+		}
+		fn, _ := dst.Location(pkg)
+		err = transformFile(src, fn, func(out io.Writer, in io.Reader) error { return decryptArtifact(rs.Key, out, in) })
+		if err != nil {
+			// an artifact we cannot decrypt is as good as a cache miss
+			log.WithError(err).WithField("package", pkg.FullName()).Warn("cannot decrypt artifact from remote cache")
+			continue
+		}
+	}
+	return nil
+}
+
+// Upload makes a best effort to upload the build arfitacts to a remote cache
+func (rs EncryptedRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	staging, cleanup, err := newStagingCache()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var encrypted []*Package
+	for _, pkg := range pkgs {
+		fn, exists := src.Location(pkg)
+		if !exists {
+			continue
+		}
+		dst, _ := staging.Location(pkg)
+		err = transformFile(fn, dst, func(out io.Writer, in io.Reader) error { return encryptArtifact(rs.Key, out, in) })
+		if err != nil {
+			return xerrors.Errorf("cannot encrypt artifact of %s: %w", pkg.FullName(), err)
+		}
+		encrypted = append(encrypted, pkg)
+	}
+
+	return rs.C.Upload(staging, encrypted)
+}
+
+func newStagingCache() (cache *FilesystemCache, cleanup func(), err error) {
+	loc, err := ioutil.TempDir("", "gorpa-cache-staging-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cache, err = NewFilesystemCache(loc)
+	if err != nil {
+		os.RemoveAll(loc)
+		return nil, nil, err
+	}
+	return cache, func() { os.RemoveAll(loc) }, nil
+}
+
+// transformFile writes the transformed content of src to dst. dst is only created if the transformation succeeds.
+func transformFile(src, dst string, transform func(out io.Writer, in io.Reader) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = transform(tmp, in)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+// encryptArtifact seals the content of in in chunks of encryptedArtifactChunkSize. Each chunk carries its own
+// nonce derived from a random base nonce and the chunk index, and the final chunk is marked in the additional data
+// so that truncated artifacts fail to decrypt.
+func encryptArtifact(key []byte, out io.Writer, in io.Reader) error {
+	aead, err := newArtifactAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	baseNonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(baseNonce)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, encryptedArtifactMagic)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(baseNonce)
+	if err != nil {
+		return err
+	}
+
+	var (
+		buf  = make([]byte, encryptedArtifactChunkSize)
+		next = make([]byte, encryptedArtifactChunkSize)
+		lenb = make([]byte, 4)
+	)
+	n, err := io.ReadFull(in, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	for idx := uint64(0); ; idx++ {
+		m, err := io.ReadFull(in, next)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final := m == 0
+
+		sealed := aead.Seal(nil, chunkNonce(baseNonce, idx), buf[:n], chunkAdditionalData(final))
+		binary.BigEndian.PutUint32(lenb, uint32(len(sealed)))
+		_, err = out.Write(lenb)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(sealed)
+		if err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+
+		buf, next = next, buf
+		n = m
+	}
+}
+
+// decryptArtifact reverses encryptArtifact
+func decryptArtifact(key []byte, out io.Writer, src io.Reader) error {
+	aead, err := newArtifactAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(src)
+	magic := make([]byte, len(encryptedArtifactMagic))
+	_, err = io.ReadFull(in, magic)
+	if err != nil || string(magic) != encryptedArtifactMagic {
+		return xerrors.Errorf("not an encrypted artifact")
+	}
+	baseNonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(in, baseNonce)
+	if err != nil {
+		return xerrors.Errorf("encrypted artifact is truncated: %w", err)
+	}
+
+	var (
+		lenb   = make([]byte, 4)
+		maxLen = uint32(encryptedArtifactChunkSize + aead.Overhead())
+	)
+	for idx := uint64(0); ; idx++ {
+		_, err = io.ReadFull(in, lenb)
+		if err != nil {
+			return xerrors.Errorf("encrypted artifact is truncated: %w", err)
+		}
+		l := binary.BigEndian.Uint32(lenb)
+		if l > maxLen {
+			return xerrors.Errorf("encrypted artifact chunk %d is too large", idx)
+		}
+		sealed := make([]byte, l)
+		_, err = io.ReadFull(in, sealed)
+		if err != nil {
+			return xerrors.Errorf("encrypted artifact is truncated: %w", err)
+		}
+
+		// we need to know if this is the last chunk before we can open it
+		_, err = in.Peek(1)
+		final := err == io.EOF
+		plain, err := aead.Open(nil, chunkNonce(baseNonce, idx), sealed, chunkAdditionalData(final))
+		if err != nil {
+			return xerrors.Errorf("cannot decrypt artifact: %w", err)
+		}
+		_, err = out.Write(plain)
+		if err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func newArtifactAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(base []byte, idx uint64) []byte {
+	res := make([]byte, len(base))
+	copy(res, base)
+	ctr := make([]byte, 8)
+	binary.BigEndian.PutUint64(ctr, idx)
+	for i := range ctr {
+		res[len(res)-8+i] ^= ctr[i]
+	}
+	return res
+}
+
+func chunkAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
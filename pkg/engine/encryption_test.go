@@ -0,0 +1,131 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestArtifactEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	otherKey := make([]byte, 32)
+	_, _ = rand.Read(otherKey)
+
+	tests := []struct {
+		Name        string
+		Size        int
+		DecryptKey  []byte
+		Modify      func([]byte) []byte
+		ExpectError bool
+	}{
+		{Name: "empty", Size: 0, DecryptKey: key},
+		{Name: "single chunk", Size: 1024, DecryptKey: key},
+		{Name: "exact chunk size", Size: encryptedArtifactChunkSize, DecryptKey: key},
+		{Name: "multiple chunks", Size: 3*encryptedArtifactChunkSize + 17, DecryptKey: key},
+		{Name: "wrong key", Size: 1024, DecryptKey: otherKey, ExpectError: true},
+		{
+			Name:       "truncated",
+			Size:       3 * encryptedArtifactChunkSize,
+			DecryptKey: key,
+			Modify: func(b []byte) []byte {
+				// drop the last chunk
+				return b[:len(b)-(encryptedArtifactChunkSize+16+4)]
+			},
+			ExpectError: true,
+		},
+		{
+			Name:       "tampered",
+			Size:       1024,
+			DecryptKey: key,
+			Modify: func(b []byte) []byte {
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+			ExpectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			plain := make([]byte, test.Size)
+			_, _ = rand.Read(plain)
+
+			var enc bytes.Buffer
+			err := encryptArtifact(key, &enc, bytes.NewReader(plain))
+			if err != nil {
+				t.Fatalf("cannot encrypt: %v", err)
+			}
+			ciphertext := enc.Bytes()
+			if test.Modify != nil {
+				ciphertext = test.Modify(ciphertext)
+			}
+
+			var dec bytes.Buffer
+			err = decryptArtifact(test.DecryptKey, &dec, bytes.NewReader(ciphertext))
+			if test.ExpectError {
+				if err == nil {
+					t.Fatal("expected decryption to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot decrypt: %v", err)
+			}
+			if !bytes.Equal(plain, dec.Bytes()) {
+				t.Fatal("decrypted content does not match the original")
+			}
+		})
+	}
+}
+
+func TestDecodeCacheEncryptionKey(t *testing.T) {
+	tests := []struct {
+		Input       string
+		ExpectedLen int
+		ExpectError bool
+	}{
+		{Input: "000102030405060708090a0b0c0d0e0f", ExpectedLen: 16},
+		{Input: "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=\n", ExpectedLen: 32},
+		{Input: "", ExpectError: true},
+		{Input: "0001", ExpectError: true},
+		{Input: "not a key", ExpectError: true},
+	}
+
+	for _, test := range tests {
+		key, err := decodeCacheEncryptionKey([]byte(test.Input))
+		if test.ExpectError {
+			if err == nil {
+				t.Errorf("%q: expected error", test.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if len(key) != test.ExpectedLen {
+			t.Errorf("%q: expected key of length %d, got %d", test.Input, test.ExpectedLen, len(key))
+		}
+	}
+}
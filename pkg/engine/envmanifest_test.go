@@ -0,0 +1,84 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvironmentManifestExclusions(t *testing.T) {
+	ba := &Application{
+		EnvironmentManifest: EnvironmentManifest{
+			{Name: "arch", Value: "amd64"},
+			{Name: "go", Value: "go version go1.17 linux/amd64"},
+			{Name: "node", Value: "v16.13.0"},
+			{Name: "os", Value: "linux"},
+			{Name: "yarn", Value: "1.22.17"},
+		},
+		EnvironmentManifestExclusions: map[PackageType][]string{
+			YarnPackage: {"yarn", "node", "unknown"},
+		},
+	}
+	newPkg := func(tpe PackageType) *Package {
+		return &Package{
+			C:               &Component{W: ba},
+			packageInternal: packageInternal{Name: "pkg", Type: tpe},
+			dependencies:    []*Package{},
+		}
+	}
+	versionManifest := func(p *Package) string {
+		var buf bytes.Buffer
+		err := p.WriteVersionManifest(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	yarn, gopkg := newPkg(YarnPackage), newPkg(GoPackage)
+	if diff := cmp.Diff([]string{"node", "yarn"}, yarn.environmentManifestExclusions()); diff != "" {
+		t.Errorf("environmentManifestExclusions() mismatch (-want +got):\n%s", diff)
+	}
+	if excl := gopkg.environmentManifestExclusions(); len(excl) != 0 {
+		t.Errorf("unexpected exclusions for Go package: %v", excl)
+	}
+
+	yarnmf, gomf := versionManifest(yarn), versionManifest(gopkg)
+	if !strings.Contains(yarnmf, "environmentExclusions: node,yarn\n") {
+		t.Errorf("exclusions are not recorded in the version manifest:\n%s", yarnmf)
+	}
+	if strings.Contains(gomf, "environmentExclusions") {
+		t.Errorf("unexpected exclusions in the version manifest:\n%s", gomf)
+	}
+
+	// the version of the yarn package must not depend on the node version any longer, but the Go package's must
+	ba.EnvironmentManifest[2].Value = "v17.2.0"
+	if act := versionManifest(yarn); act != yarnmf {
+		t.Errorf("excluded entry changed the version manifest:\n%s", act)
+	}
+	if act := versionManifest(gopkg); act == gomf {
+		t.Errorf("environment change did not change the version manifest of the Go package")
+	}
+}
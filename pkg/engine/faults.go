@@ -0,0 +1,155 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// FaultInjection makes builds fail in ways which are hard to provoke otherwise, e.g. to test retry logic in CI.
+// All decisions derive from the seed and the artifact or package concerned, hence the same seed produces the same
+// faults regardless of the order in which things happen.
+type FaultInjection struct {
+	// Seed makes the injected faults reproducible
+	Seed int64
+	// DownloadFailure is the probability of a remote cache download attempt failing
+	DownloadFailure float64
+	// Corruption is the probability of a downloaded build artifact being corrupted
+	Corruption float64
+	// Delay is the maximum artificial delay of a package build
+	Delay time.Duration
+}
+
+// ParseFaultInjection parses a comma separated list of faults, e.g. seed=42,download-failure=0.3,corrupt=0.1,delay=5s.
+// Without a seed, a random one is chosen.
+func ParseFaultInjection(spec string) (*FaultInjection, error) {
+	res := &FaultInjection{Seed: time.Now().UnixNano()}
+	for _, seg := range strings.Split(spec, ",") {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		segs := strings.SplitN(seg, "=", 2)
+		if len(segs) != 2 {
+			return nil, xerrors.Errorf("invalid fault %q: must be name=value", seg)
+		}
+		var (
+			name, value = segs[0], segs[1]
+			err         error
+		)
+		switch name {
+		case "seed":
+			res.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "download-failure":
+			res.DownloadFailure, err = parseProbability(value)
+		case "corrupt":
+			res.Corruption, err = parseProbability(value)
+		case "delay":
+			res.Delay, err = time.ParseDuration(value)
+		default:
+			return nil, xerrors.Errorf("unknown fault %q: must be one of seed, download-failure, corrupt, delay", name)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("invalid fault %q: %w", seg, err)
+		}
+	}
+	return res, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 1 {
+		return 0, xerrors.Errorf("probability must be between 0 and 1")
+	}
+	return p, nil
+}
+
+// WithFaultInjection injects faults into package builds. Faults of remote cache transfers are configured
+// using the TransferOptions of the remote caches.
+func WithFaultInjection(faults *FaultInjection) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.Faults = faults
+		return nil
+	}
+}
+
+// roll returns a number in [0, 1) which depends on the seed, the kind of fault and the key only
+func (f *FaultInjection) roll(kind, key string) float64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, f.Seed)
+	_, _ = h.Write([]byte(kind))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// failTransfer returns an error if the given attempt of a download is to fail
+func (f *FaultInjection) failTransfer(t fileTransfer, attempt int) error {
+	if f == nil || f.DownloadFailure == 0 || !t.Download {
+		return nil
+	}
+	if f.roll("download-failure", t.Src+"#"+strconv.Itoa(attempt)) >= f.DownloadFailure {
+		return nil
+	}
+	return xerrors.Errorf("injected fault: download of %s failed", t.Src)
+}
+
+// corruptDownload truncates the downloaded artifact fn if the download of src is to be corrupted
+func (f *FaultInjection) corruptDownload(src, fn string) error {
+	if f == nil || f.Corruption == 0 {
+		return nil
+	}
+	if f.roll("corrupt", src) >= f.Corruption {
+		return nil
+	}
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return err
+	}
+	log.WithField("src", src).Warn("injected fault: corrupting downloaded artifact")
+	return os.Truncate(fn, stat.Size()/2)
+}
+
+// delayBuild sleeps for an artificial delay before the package is built
+func (f *FaultInjection) delayBuild(p *Package) {
+	if f == nil || f.Delay == 0 {
+		return
+	}
+	version, err := p.Version()
+	if err != nil {
+		return
+	}
+	delay := time.Duration(math.Floor(f.roll("delay", p.FullName()+"."+version) * float64(f.Delay)))
+	log.WithField("package", p.FullName()).WithField("delay", delay).Debug("injected fault: delaying build")
+	time.Sleep(delay)
+}
@@ -0,0 +1,110 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFaultInjection(t *testing.T) {
+	tests := []struct {
+		Spec        string
+		Expectation *FaultInjection
+		Error       bool
+	}{
+		{Spec: "seed=42,download-failure=0.3,corrupt=1,delay=5s", Expectation: &FaultInjection{Seed: 42, DownloadFailure: 0.3, Corruption: 1, Delay: 5 * time.Second}},
+		{Spec: "seed=1, delay=1m", Expectation: &FaultInjection{Seed: 1, Delay: time.Minute}},
+		{Spec: "download-failure=1.5", Error: true},
+		{Spec: "seed", Error: true},
+		{Spec: "explode=1", Error: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Spec, func(t *testing.T) {
+			act, err := ParseFaultInjection(test.Spec)
+			if (err != nil) != test.Error {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); test.Expectation != nil && diff != "" {
+				t.Errorf("ParseFaultInjection() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFaultInjectionIsDeterministic(t *testing.T) {
+	failures := func(seed int64) (res []bool) {
+		f := &FaultInjection{Seed: seed, DownloadFailure: 0.5}
+		for i := 0; i < 64; i++ {
+			res = append(res, f.failTransfer(fileTransfer{Src: "remote", Download: true}, i) != nil)
+		}
+		return res
+	}
+
+	if diff := cmp.Diff(failures(42), failures(42)); diff != "" {
+		t.Errorf("same seed produced different faults (-first +second):\n%s", diff)
+	}
+	if cmp.Equal(failures(42), failures(43)) {
+		t.Errorf("different seeds produced the same faults")
+	}
+	if (&FaultInjection{Seed: 42, DownloadFailure: 1}).failTransfer(fileTransfer{Src: "remote"}, 0) != nil {
+		t.Errorf("uploads must not fail")
+	}
+}
+
+func TestFaultInjectionTransfers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorpa-faults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var attempts int
+	transfer := func(ctx context.Context, src, dst string) error {
+		attempts++
+		return ioutil.WriteFile(dst, []byte("0123456789"), 0644)
+	}
+
+	dst := filepath.Join(dir, "failed.tar.gz")
+	transferFiles(TransferOptions{Jobs: 1, Retries: 2, Faults: &FaultInjection{DownloadFailure: 1}}, []fileTransfer{{Src: "remote", Dst: dst, Download: true}}, transfer)
+	if attempts != 0 {
+		t.Errorf("expected failed downloads not to reach the remote cache, got %d attempts", attempts)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		t.Errorf("failed download produced an artifact")
+	}
+
+	dst = filepath.Join(dir, "corrupt.tar.gz")
+	transferFiles(TransferOptions{Jobs: 1, Faults: &FaultInjection{Corruption: 1}}, []fileTransfer{{Src: "remote", Dst: dst, Download: true}}, transfer)
+	fc, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fc) != "01234" {
+		t.Errorf("expected artifact to be truncated, got %q", string(fc))
+	}
+}
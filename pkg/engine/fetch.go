@@ -0,0 +1,207 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// downloadClient fetches external files, toolchains and their checksums. Toolchain archives are large, hence
+// the overall timeout is generous, while servers which don't answer at all fail fast.
+var downloadClient = &http.Client{
+	Timeout: 15 * time.Minute,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// FetchSpec describes an external file a package downloads before its commands run.
+// Downloads are verified against their checksum and cached by it, hence the same
+// file is downloaded only once no matter how many packages use it.
+type FetchSpec struct {
+	// URL is the http(s) location of the file
+	URL string `yaml:"url"`
+	// SHA256 is the hex encoded sha256 checksum the downloaded file must match
+	SHA256 string `yaml:"sha256"`
+	// Dest is the location of the file relative to the build directory. Defaults to the
+	// last element of the URL path.
+	Dest string `yaml:"dest,omitempty"`
+}
+
+// Validate ensures the fetch spec is sound
+func (f FetchSpec) Validate() error {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return xerrors.Errorf("fetch: invalid URL %q: %w", f.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return xerrors.Errorf("fetch: unsupported URL %q: only http and https are supported", f.URL)
+	}
+	if !sha256Pattern.MatchString(f.SHA256) {
+		return xerrors.Errorf("fetch: %s: sha256 must be a hex encoded, lower-case sha256 checksum", f.URL)
+	}
+
+	dest := f.destination()
+	if dest == "" || dest == "." || dest == "/" {
+		return xerrors.Errorf("fetch: %s: cannot derive a destination from the URL - please set dest", f.URL)
+	}
+	if filepath.IsAbs(dest) || dest == ".." || strings.HasPrefix(dest, "../") {
+		return xerrors.Errorf("fetch: %s: dest must be relative to the build directory", f.URL)
+	}
+	return nil
+}
+
+func (f FetchSpec) destination() string {
+	if f.Dest != "" {
+		return filepath.Clean(f.Dest)
+	}
+
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+func validateFetchSpecs(specs []FetchSpec) error {
+	dests := make(map[string]string, len(specs))
+	for _, f := range specs {
+		err := f.Validate()
+		if err != nil {
+			return err
+		}
+		if other, exists := dests[f.destination()]; exists {
+			return xerrors.Errorf("fetch: %s and %s both download to %s", other, f.URL, f.destination())
+		}
+		dests[f.destination()] = f.URL
+	}
+	return nil
+}
+
+// fetchCommands downloads all files the package fetches into the fetch cache and returns the commands
+// which place them in the build directory.
+func (p *Package) fetchCommands(buildctx *buildContext, specs []FetchSpec) ([][]string, error) {
+	var commands [][]string
+	for _, f := range specs {
+		fn, err := buildctx.fetch(p, f)
+		if err != nil {
+			return nil, err
+		}
+
+		dest := f.destination()
+		if dir := filepath.Dir(dest); dir != "." {
+			commands = append(commands, []string{"mkdir", "-p", dir})
+		}
+		commands = append(commands, []string{"cp", fn, dest})
+	}
+	return commands, nil
+}
+
+// fetch makes sure the file described by f is in the fetch cache and returns its location
+func (c *buildContext) fetch(p *Package, f FetchSpec) (fn string, err error) {
+	dir := c.FetchCacheDir
+	if dir == "" {
+		dir = filepath.Join(c.buildDir, "fetch")
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create fetch cache %s: %w", dir, err)
+	}
+
+	fn = filepath.Join(dir, f.SHA256)
+	if sum, err := sha256Hash(fn); err == nil {
+		if sum == f.SHA256 {
+			return fn, nil
+		}
+		// someone tampered with the cache - don't trust it
+		err = os.Remove(fn)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	c.Reporter.PackageBuildLog(p, false, []byte(fmt.Sprintf("fetching %s\n", f.URL)))
+	err = downloadVerified(f.URL, f.SHA256, fn)
+	if err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+// downloadVerified downloads the file at url to dst. dst is only written if the
+// download matches the expected sha256 checksum.
+func downloadVerified(url, expectedSHA256, dst string) (err error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("cannot fetch %s: %s", url, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if err != nil {
+		return xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expectedSHA256 {
+		return xerrors.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", url, expectedSHA256, actual)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
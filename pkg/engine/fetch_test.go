@@ -0,0 +1,107 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchSpecValidate(t *testing.T) {
+	const sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	tests := []struct {
+		Name  string
+		Spec  FetchSpec
+		Valid bool
+	}{
+		{"valid", FetchSpec{URL: "https://example.com/dl/tool.tar.gz", SHA256: sum}, true},
+		{"valid with dest", FetchSpec{URL: "https://example.com/dl", SHA256: sum, Dest: "third_party/tool.tar.gz"}, true},
+		{"unsupported scheme", FetchSpec{URL: "ftp://example.com/tool.tar.gz", SHA256: sum}, false},
+		{"missing checksum", FetchSpec{URL: "https://example.com/tool.tar.gz"}, false},
+		{"upper case checksum", FetchSpec{URL: "https://example.com/tool.tar.gz", SHA256: "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"}, false},
+		{"no derivable dest", FetchSpec{URL: "https://example.com", SHA256: sum}, false},
+		{"absolute dest", FetchSpec{URL: "https://example.com/tool", SHA256: sum, Dest: "/usr/bin/tool"}, false},
+		{"escaping dest", FetchSpec{URL: "https://example.com/tool", SHA256: sum, Dest: "../tool"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Spec.Validate()
+			if test.Valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.Valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestDownloadVerified(t *testing.T) {
+	content := []byte("hello world")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	hash := sha256.Sum256(content)
+	sum := hex.EncodeToString(hash[:])
+
+	dir := t.TempDir()
+	dst := filepath.Join(dir, sum)
+
+	err := downloadVerified(srv.URL+"/file", "0000000000000000000000000000000000000000000000000000000000000000", dst)
+	if err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("download with checksum mismatch was written")
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 0 {
+		t.Fatalf("download with checksum mismatch left %d files behind", len(fs))
+	}
+
+	err = downloadVerified(srv.URL+"/missing", sum, dst)
+	if err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	err = downloadVerified(srv.URL+"/file", sum, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fc) != string(content) {
+		t.Errorf("unexpected content: %q", fc)
+	}
+}
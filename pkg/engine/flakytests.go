@@ -0,0 +1,155 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"time"
+
+	"github.com/gookit/color"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// TestRetryPolicy configures how failing tests of a package are retried
+type TestRetryPolicy struct {
+	// Retries is the number of times failing tests are run again
+	Retries int `yaml:"retries,omitempty"`
+	// Backoff is the delay before the first retry, e.g. 10s. It doubles with every retry.
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// Quarantine marks the tests of the package as known to be flaky. If they still fail after all retries,
+	// the failure is reported but does not fail the build.
+	Quarantine bool `yaml:"quarantine,omitempty"`
+}
+
+// Validate returns an error if the policy is invalid
+func (r TestRetryPolicy) Validate() error {
+	if r.Retries < 0 {
+		return xerrors.Errorf("invalid test retries: %d", r.Retries)
+	}
+	if r.Backoff < 0 {
+		return xerrors.Errorf("invalid test retry backoff: %s", r.Backoff)
+	}
+	return nil
+}
+
+// FlakyTestReporter is implemented by reporters which surface flaky tests. Reporters need not implement it.
+type FlakyTestReporter interface {
+	// PackageTestsFlaky is called when the tests of a package failed before they passed on a retry, or when the
+	// tests of a quarantined package failed in all attempts. err is the error of the last failed attempt.
+	PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error)
+}
+
+func reportFlakyTests(rep Reporter, pkg *Package, attempts int, quarantined bool, err error) {
+	if r, ok := rep.(FlakyTestReporter); ok {
+		r.PackageTestsFlaky(pkg, attempts, quarantined, err)
+	}
+}
+
+// testRetryPolicy returns the retry policy of a package's tests. The package's own retries and backoff take
+// precedence over those of the build.
+func (c *buildContext) testRetryPolicy(p *Package) TestRetryPolicy {
+	res := c.TestRetry
+	if p.TestRetry.Retries > 0 {
+		res.Retries = p.TestRetry.Retries
+	}
+	if p.TestRetry.Backoff > 0 {
+		res.Backoff = p.TestRetry.Backoff
+	}
+	res.Quarantine = p.TestRetry.Quarantine
+	for _, q := range c.TestQuarantine {
+		if q == p.FullName() {
+			res.Quarantine = true
+		}
+	}
+	return res
+}
+
+// runTestsWithRetries runs the tests of a package build as often as its retry policy allows. It returns true
+// if the tests passed, and an error only if they failed and the package is not quarantined.
+func (c *buildContext) runTestsWithRetries(p *Package, wd string, bld *packageBuild) (passed bool, err error) {
+	var (
+		policy  = c.testRetryPolicy(p)
+		backoff = policy.Backoff
+		env     = c.testEnvironment(bld)
+	)
+	for attempt := 1; attempt <= policy.Retries+1; attempt++ {
+		if attempt > 1 {
+			log.WithError(err).WithField("package", p.FullName()).WithField("attempt", attempt).Warn("tests failed - retrying")
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		stopTimeout := c.startTimeout(p, BuildPhaseTest)
+		terr := executeCommandsForPackage(c, p, wd, bld.TestCommands, env)
+		if terr == nil && bld.Test != nil {
+			terr = bld.Test()
+		}
+		stopTimeout()
+		if terr == nil {
+			if attempt > 1 {
+				reportFlakyTests(c.Reporter, p, attempt, false, err)
+			}
+			return true, nil
+		}
+		err = terr
+	}
+
+	if policy.Quarantine {
+		reportFlakyTests(c.Reporter, p, policy.Retries+1, true, err)
+		return false, nil
+	}
+	return false, err
+}
+
+// PackageTestsFlaky is called when the tests of a package failed before they passed on a retry, or when the
+// tests of a quarantined package failed in all attempts.
+func (r *ConsoleReporter) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	out := r.getWriter(pkg)
+
+	msg := color.Sprintf("<fg=yellow>flaky tests passed in attempt %d</>\n<white>Previous failure:</> %s\n", attempts, err)
+	if quarantined {
+		msg = color.Sprintf("<fg=yellow>quarantined tests failed in all %d attempts - ignoring the failure</>\n<white>Reason:</> %s\n", attempts, err)
+	}
+	_, _ = io.WriteString(out, msg)
+}
+
+// WithTestRetries retries failing tests of all packages, unless a package configures its own retries.
+// The delay before a retry doubles with every retry.
+func WithTestRetries(retries int, backoff time.Duration) BuildOption {
+	return func(opts *buildOptions) error {
+		policy := TestRetryPolicy{Retries: retries, Backoff: backoff}
+		err := policy.Validate()
+		if err != nil {
+			return err
+		}
+		opts.TestRetry = policy
+		return nil
+	}
+}
+
+// WithTestQuarantine quarantines the tests of these packages, i.e. their failures don't fail the build
+func WithTestQuarantine(pkgs []string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.TestQuarantine = pkgs
+		return nil
+	}
+}
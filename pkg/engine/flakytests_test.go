@@ -0,0 +1,83 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+type flakyTestRecorder struct {
+	*shardReporter
+
+	attempts    int
+	quarantined bool
+}
+
+func (r *flakyTestRecorder) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	r.attempts = attempts
+	r.quarantined = quarantined
+}
+
+func TestRunTestsWithRetries(t *testing.T) {
+	var (
+		flaky   = [][]string{{"sh", "-c", "test -f attempted || { touch attempted; exit 1; }"}}
+		failing = [][]string{{"false"}}
+	)
+	tests := []struct {
+		Name        string
+		Commands    [][]string
+		Policy      TestRetryPolicy
+		Quarantine  []string
+		Passed      bool
+		Error       bool
+		Attempts    int
+		Quarantined bool
+	}{
+		{Name: "flaky without retries", Commands: flaky, Error: true},
+		{Name: "flaky with retries", Commands: flaky, Policy: TestRetryPolicy{Retries: 2}, Passed: true, Attempts: 2},
+		{Name: "failing with retries", Commands: failing, Policy: TestRetryPolicy{Retries: 2}, Error: true},
+		{Name: "quarantined package", Commands: failing, Policy: TestRetryPolicy{Retries: 1, Quarantine: true}, Attempts: 2, Quarantined: true},
+		{Name: "quarantined by the build", Commands: failing, Quarantine: []string{"comp:pkg"}, Attempts: 1, Quarantined: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var (
+				rep = &flakyTestRecorder{shardReporter: &shardReporter{}}
+				pkg = &Package{
+					C:               &Component{Name: "comp", W: &Application{}},
+					packageInternal: packageInternal{Name: "pkg", Type: GenericPackage, TestRetry: test.Policy},
+				}
+				ctx = &buildContext{buildOptions: buildOptions{Reporter: rep, TestQuarantine: test.Quarantine}}
+			)
+
+			passed, err := ctx.runTestsWithRetries(pkg, t.TempDir(), &packageBuild{TestCommands: test.Commands})
+			if passed != test.Passed {
+				t.Errorf("expected passed=%v, got %v", test.Passed, passed)
+			}
+			if (err != nil) != test.Error {
+				t.Errorf("expected error=%v, got %v", test.Error, err)
+			}
+			if rep.attempts != test.Attempts || rep.quarantined != test.Quarantined {
+				t.Errorf("expected flaky tests to be reported after %d attempts (quarantined=%v), got %d attempts (quarantined=%v)", test.Attempts, test.Quarantined, rep.attempts, rep.quarantined)
+			}
+		})
+	}
+}
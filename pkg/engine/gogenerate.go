@@ -0,0 +1,194 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+
+	"github.com/bhojpur/gorpa/pkg/doublestar"
+)
+
+// goGenerateProcessVersion changes the key of all cached go generate outputs when incremented
+const goGenerateProcessVersion = 1
+
+// goGenerateCommands produces the commands which run go generate for a package. If the outputs of go generate
+// for the same inputs are cached, they are extracted instead. Otherwise the files go generate created or modified
+// are added to the cache once it ran.
+func (c *buildContext) goGenerateCommands(p *Package, cfg GoPkgConfig, goCommand string) ([][]string, error) {
+	generate := []string{goCommand, "generate", "-v", "./..."}
+	if c.GoGenerateCacheDir == "" {
+		return [][]string{generate}, nil
+	}
+
+	key, err := p.goGenerateKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cached := filepath.Join(c.GoGenerateCacheDir, key+".tar.gz")
+	if _, err := os.Stat(cached); err == nil {
+		log.WithField("package", p.FullName()).WithField("key", key).Debug("using cached go generate outputs")
+		return [][]string{{"tar", "xzf", cached}}, nil
+	}
+	err = os.MkdirAll(c.GoGenerateCacheDir, 0755)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create go generate cache %s: %w", c.GoGenerateCacheDir, err)
+	}
+
+	const (
+		marker  = ".gorpa-generate-start"
+		outputs = ".gorpa-generate-outputs"
+	)
+	script := strings.Join([]string{
+		"set -e",
+		shellJoin("touch", marker),
+		shellJoin(generate...),
+		shellJoin("find", ".", "-type", "f", "-newer", marker, "!", "-path", "./_deps/*", "!", "-name", outputs) + " > " + shellQuote(outputs),
+		shellJoin("tar", "czf", cached+".tmp", "-T", outputs),
+		shellJoin("mv", cached+".tmp", cached),
+		shellJoin("rm", marker, outputs),
+	}, "\n")
+	return [][]string{{"sh", "-c", script}}, nil
+}
+
+// goGenerateKey identifies the inputs of go generate: the environment, dependencies and those sources which
+// match the generateInputs of the package. Without generateInputs, the sources in all directories which
+// contain a go:generate directive, plus go.mod and go.sum, are the inputs.
+func (p *Package) goGenerateKey(cfg GoPkgConfig) (string, error) {
+	inputs, err := p.goGenerateInputs(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "goGenerateProcessVersion: %d\n", goGenerateProcessVersion)
+	envhash, err := p.environmentManifest().hash(p.C.W.ContentHash)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "environment: %s\n", envhash)
+	for _, dep := range p.GetDependencies() {
+		ver, err := dep.Version()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s.%s\n", dep.FullName(), ver)
+	}
+	for _, src := range inputs {
+		rel, err := filepath.Rel(p.C.Origin, src)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s:", filepath.ToSlash(rel))
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goGenerateInputs returns the sorted sources go generate depends on, see goGenerateKey
+func (p *Package) goGenerateInputs(cfg GoPkgConfig) ([]string, error) {
+	var res []string
+	if len(cfg.GenerateInputs) > 0 {
+		for _, src := range p.Sources {
+			rel, err := filepath.Rel(p.C.Origin, src)
+			if err != nil {
+				return nil, err
+			}
+			for _, glob := range cfg.GenerateInputs {
+				if ok, _ := doublestar.Match(glob, filepath.ToSlash(rel)); ok {
+					res = append(res, src)
+					break
+				}
+			}
+		}
+		sort.Strings(res)
+		return res, nil
+	}
+
+	dirs := make(map[string]struct{})
+	for _, src := range p.Sources {
+		if !strings.HasSuffix(src, ".go") {
+			continue
+		}
+		ok, err := hasGoGenerateDirective(src)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			dirs[filepath.Dir(src)] = struct{}{}
+		}
+	}
+	for _, src := range p.Sources {
+		if _, ok := dirs[filepath.Dir(src)]; ok {
+			res = append(res, src)
+			continue
+		}
+		if rel, _ := filepath.Rel(p.C.Origin, src); rel == "go.mod" || rel == "go.sum" {
+			res = append(res, src)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func hasGoGenerateDirective(fn string) (bool, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "//go:generate ") {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// WithGoGenerateCache caches the outputs of go generate in this directory
+func WithGoGenerateCache(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.GoGenerateCacheDir = dir
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoGenerateInputs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":            "module example.com/g\n",
+		"main.go":           "package main\n",
+		"api/api.go":        "package api\n\n//go:generate stringer -type=Kind\n",
+		"api/kind.go":       "package api\n\ntype Kind int\n",
+		"api/proto/a.proto": "syntax = \"proto3\";\n",
+		"other/other.go":    "package other\n",
+	}
+	var srcs []string
+	for fn, content := range files {
+		fn = filepath.Join(dir, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, fn)
+	}
+	pkg := &Package{
+		C:               &Component{Name: "comp", Origin: dir, W: &Application{}},
+		packageInternal: packageInternal{Name: "pkg", Type: GoPackage, Sources: srcs},
+		dependencies:    []*Package{},
+	}
+
+	tests := []struct {
+		Name        string
+		Inputs      []string
+		Expectation []string
+	}{
+		{Name: "directories with directives", Expectation: []string{"api/api.go", "api/kind.go", "go.mod"}},
+		{Name: "globs", Inputs: []string{"**/*.proto", "go.mod"}, Expectation: []string{"api/proto/a.proto", "go.mod"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			inputs, err := pkg.goGenerateInputs(GoPkgConfig{Generate: true, GenerateInputs: test.Inputs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var act []string
+			for _, fn := range inputs {
+				rel, _ := filepath.Rel(dir, fn)
+				act = append(act, filepath.ToSlash(rel))
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("goGenerateInputs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	key := func() string {
+		k, err := pkg.goGenerateKey(GoPkgConfig{Generate: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	before := key()
+	err := ioutil.WriteFile(filepath.Join(dir, "other/other.go"), []byte("package other\n\nvar X = 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key() != before {
+		t.Error("changing a file which is no input of go generate changed the key")
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "api/kind.go"), []byte("package api\n\ntype Kind uint\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key() == before {
+		t.Error("changing an input of go generate did not change the key")
+	}
+}
+
+func TestGoGenerateCommandsQuoting(t *testing.T) {
+	var (
+		root = t.TempDir()
+		wd   = filepath.Join(root, "src")
+		bin  = filepath.Join(root, "go tool's bin")
+		ctx  = &buildContext{buildOptions: buildOptions{GoGenerateCacheDir: filepath.Join(root, "generate cache's dir")}}
+		pkg  = testPackage(&Application{}, "pkg", GoPackage)
+	)
+	pkg.C.Origin = wd
+	for _, dir := range []string{wd, bin} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	goCommand := filepath.Join(bin, "go")
+	err := ioutil.WriteFile(goCommand, []byte("#!/bin/sh\necho generated > gen.go\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCommands := func() {
+		cmds, err := ctx.goGenerateCommands(pkg, GoPkgConfig{Generate: true}, goCommand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cmds {
+			cmd := exec.Command(c[0], c[1:]...)
+			cmd.Dir = wd
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v failed: %v: %s", c, err, out)
+			}
+		}
+	}
+
+	runCommands()
+	cached, err := filepath.Glob(filepath.Join(ctx.GoGenerateCacheDir, "*.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 {
+		t.Fatalf("expected the go generate outputs to be cached, got %v", cached)
+	}
+
+	err = os.Remove(filepath.Join(wd, "gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCommands()
+	fc, err := ioutil.ReadFile(filepath.Join(wd, "gen.go"))
+	if err != nil {
+		t.Fatalf("cached go generate outputs were not extracted: %v", err)
+	}
+	if string(fc) != "generated\n" {
+		t.Errorf("unexpected generated file %q", fc)
+	}
+}
@@ -0,0 +1,159 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// GoLintConfig configures the golangci-lint run of a Go package
+type GoLintConfig struct {
+	// Enable and Disable turn linters on and off in addition to what the config file selects
+	Enable  []string `yaml:"enable,omitempty"`
+	Disable []string `yaml:"disable,omitempty"`
+	// Config is the path of the golangci-lint configuration file, relative to the component. It's added to the sources of the package.
+	Config string `yaml:"config,omitempty"`
+	// Timeout limits the lint run, e.g. 5m
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+func (cfg GoLintConfig) isEmpty() bool {
+	return len(cfg.Enable) == 0 && len(cfg.Disable) == 0 && cfg.Config == "" && cfg.Timeout == ""
+}
+
+// Validate ensures the lint config can be turned into a golangci-lint invocation
+func (cfg GoLintConfig) Validate() error {
+	enabled := make(map[string]struct{}, len(cfg.Enable))
+	for _, l := range cfg.Enable {
+		enabled[l] = struct{}{}
+	}
+	for _, l := range cfg.Disable {
+		if _, ok := enabled[l]; ok {
+			return xerrors.Errorf("linter %s is both enabled and disabled", l)
+		}
+	}
+	if cfg.Config != "" {
+		if filepath.IsAbs(cfg.Config) || strings.HasPrefix(filepath.Clean(cfg.Config), "..") {
+			return xerrors.Errorf("lint config %s must be relative to the component", cfg.Config)
+		}
+	}
+	if cfg.Timeout != "" {
+		if _, err := time.ParseDuration(cfg.Timeout); err != nil {
+			return xerrors.Errorf("invalid lint timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+// goLintCommand produces the golangci-lint invocation for a Go package
+func goLintCommand(cfg GoPkgConfig) []string {
+	if len(cfg.LintCommand) > 0 {
+		return cfg.LintCommand
+	}
+
+	res := []string{"golangci-lint", "run"}
+	if len(cfg.BuildTags) > 0 {
+		res = append(res, "--build-tags", strings.Join(cfg.BuildTags, ","))
+	}
+	if cfg.Lint.Config != "" {
+		res = append(res, "--config", cfg.Lint.Config)
+	}
+	if len(cfg.Lint.Enable) > 0 {
+		res = append(res, "--enable", strings.Join(cfg.Lint.Enable, ","))
+	}
+	if len(cfg.Lint.Disable) > 0 {
+		res = append(res, "--disable", strings.Join(cfg.Lint.Disable, ","))
+	}
+	if cfg.Lint.Timeout != "" {
+		res = append(res, "--timeout", cfg.Lint.Timeout)
+	}
+	return res
+}
+
+// golangciLintVersion returns the version information of the golangci-lint on the PATH
+var golangciLintVersion = func() (string, error) {
+	out, err := exec.Command("golangci-lint", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// goLintCacheSuffix produces the suffix of the lint markers. The golangci-lint version is part of it, s.t. a
+// new linter release lints all packages again. Custom lint commands are part of the package version already.
+func (c *buildContext) goLintCacheSuffix(cfg GoPkgConfig) (suffix string, ok bool) {
+	if len(cfg.LintCommand) > 0 {
+		return ".lint", true
+	}
+	c.lintSuffixOnce.Do(func() {
+		version, err := golangciLintVersion()
+		if err != nil {
+			log.WithError(err).Debug("cannot determine the golangci-lint version - not caching the lint")
+			return
+		}
+		sum := sha256.Sum256([]byte(version))
+		c.lintSuffix = "." + hex.EncodeToString(sum[:])[:12] + ".lint"
+	})
+	return c.lintSuffix, c.lintSuffix != ""
+}
+
+// goLintCommands produces the commands which lint a Go package. Once the lint passed for a package version,
+// it's not linted again until its version or the golangci-lint version changes, e.g. when the tests of an
+// earlier build failed.
+func (c *buildContext) goLintCommands(p *Package, cfg GoPkgConfig) ([][]string, error) {
+	var (
+		lintCmd = goLintCommand(cfg)
+		cache   = markerCache{Dir: c.LintCacheDir, Name: "lint cache"}
+	)
+	if !cache.enabled() {
+		return [][]string{lintCmd}, nil
+	}
+	suffix, ok := c.goLintCacheSuffix(cfg)
+	if !ok {
+		return [][]string{lintCmd}, nil
+	}
+
+	if cache.has(p, suffix) {
+		log.WithField("package", p.FullName()).Debug("lint passed for this version before - not linting again")
+		return nil, nil
+	}
+	marker, err := cache.prepare(p, suffix)
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{lintCmd, {"touch", marker}}, nil
+}
+
+// WithLintCache remembers the package versions whose lint passed in this directory
+func WithLintCache(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.LintCacheDir = dir
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoLintCommand(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Config      GoPkgConfig
+		Expectation []string
+		Invalid     bool
+	}{
+		{Name: "default", Expectation: []string{"golangci-lint", "run"}},
+		{Name: "lint command", Config: GoPkgConfig{LintCommand: []string{"make", "lint"}}, Expectation: []string{"make", "lint"}},
+		{
+			Name: "structured",
+			Config: GoPkgConfig{
+				BuildTags: []string{"integration"},
+				Lint: GoLintConfig{
+					Enable:  []string{"gosec", "revive"},
+					Disable: []string{"errcheck"},
+					Config:  ".golangci.yml",
+					Timeout: "5m",
+				},
+			},
+			Expectation: []string{"golangci-lint", "run", "--build-tags", "integration", "--config", ".golangci.yml", "--enable", "gosec,revive", "--disable", "errcheck", "--timeout", "5m"},
+		},
+		{Name: "exclusive with lint command", Config: GoPkgConfig{LintCommand: []string{"make", "lint"}, Lint: GoLintConfig{Timeout: "5m"}}, Invalid: true},
+		{Name: "enabled and disabled", Config: GoPkgConfig{Lint: GoLintConfig{Enable: []string{"gosec"}, Disable: []string{"gosec"}}}, Invalid: true},
+		{Name: "config outside component", Config: GoPkgConfig{Lint: GoLintConfig{Config: "../.golangci.yml"}}, Invalid: true},
+		{Name: "invalid timeout", Config: GoPkgConfig{Lint: GoLintConfig{Timeout: "five minutes"}}, Invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			test.Config.Packaging = GoLibrary
+			err := test.Config.Validate()
+			if test.Invalid {
+				if err == nil {
+					t.Fatal("expected config to be invalid")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, goLintCommand(test.Config)); diff != "" {
+				t.Errorf("goLintCommand() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGoLintCommandsCached(t *testing.T) {
+	linterVersion := "golangci-lint has version 1.50.0"
+	defer func(f func() (string, error)) { golangciLintVersion = f }(golangciLintVersion)
+	golangciLintVersion = func() (string, error) { return linterVersion, nil }
+
+	var (
+		pkg      = testPackage(&Application{}, "pkg", GoPackage)
+		cacheDir = filepath.Join(t.TempDir(), "lint")
+		newCtx   = func() *buildContext { return &buildContext{buildOptions: buildOptions{LintCacheDir: cacheDir}} }
+		lint     = func(ctx *buildContext, cfg GoPkgConfig) [][]string {
+			cmds, err := ctx.goLintCommands(pkg, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range cmds {
+				if c[0] == "touch" {
+					err = ioutil.WriteFile(c[1], nil, 0644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			return cmds
+		}
+	)
+
+	if cmds := lint(newCtx(), GoPkgConfig{}); len(cmds) != 2 || cmds[1][0] != "touch" {
+		t.Fatalf("expected lint and marker command, got %v", cmds)
+	}
+	if cmds := lint(newCtx(), GoPkgConfig{}); len(cmds) != 0 {
+		t.Errorf("expected no lint commands once the lint passed, got %v", cmds)
+	}
+
+	linterVersion = "golangci-lint has version 1.51.0"
+	if cmds := lint(newCtx(), GoPkgConfig{}); len(cmds) != 2 {
+		t.Errorf("expected a new golangci-lint version to lint again, got %v", cmds)
+	}
+
+	custom := GoPkgConfig{LintCommand: []string{"staticcheck", "./..."}}
+	if cmds := lint(newCtx(), custom); len(cmds) != 2 || cmds[0][0] != "staticcheck" {
+		t.Fatalf("expected custom lint and marker command, got %v", cmds)
+	}
+	if cmds := lint(newCtx(), custom); len(cmds) != 0 {
+		t.Errorf("expected no lint commands once the custom lint passed, got %v", cmds)
+	}
+
+	golangciLintVersion = func() (string, error) { return "", exec.ErrNotFound }
+	if cmds := lint(newCtx(), GoPkgConfig{}); len(cmds) != 1 {
+		t.Errorf("expected the lint not to be cached without golangci-lint version, got %v", cmds)
+	}
+}
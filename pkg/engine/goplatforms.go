@@ -0,0 +1,111 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// BuiltinArgPlatform is a builtin argument/variable of Go packages with platforms. During the build for
+// each platform it resolves to the platform's directory name in the artifact, e.g. linux_arm64.
+const BuiltinArgPlatform = "__platform"
+
+// goPlatform is a GOOS/GOARCH target of a Go package, e.g. linux/arm/v7
+type goPlatform struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+func parseGoPlatform(platform string) (goPlatform, error) {
+	segs := strings.Split(platform, "/")
+	if len(segs) < 2 || len(segs) > 3 || segs[0] == "" || segs[1] == "" {
+		return goPlatform{}, xerrors.Errorf("invalid platform %q: must be os/arch or os/arch/variant", platform)
+	}
+	res := goPlatform{OS: segs[0], Arch: segs[1]}
+	if len(segs) == 3 {
+		res.Variant = segs[2]
+		switch {
+		case res.Arch == "arm" && (res.Variant == "v5" || res.Variant == "v6" || res.Variant == "v7"):
+		case res.Arch == "amd64" && (res.Variant == "v1" || res.Variant == "v2" || res.Variant == "v3" || res.Variant == "v4"):
+		default:
+			return goPlatform{}, xerrors.Errorf("invalid platform %q: unsupported variant %s of %s", platform, res.Variant, res.Arch)
+		}
+	}
+	return res, nil
+}
+
+// Dir returns the directory the platform's build output is placed in
+func (p goPlatform) Dir() string {
+	res := p.OS + "_" + p.Arch
+	if p.Variant != "" {
+		res += "_" + p.Variant
+	}
+	return res
+}
+
+// Env returns the environment variables which make the Go toolchain build for the platform
+func (p goPlatform) Env() []string {
+	res := []string{"GOOS=" + p.OS, "GOARCH=" + p.Arch}
+	switch p.Arch {
+	case "arm":
+		if p.Variant != "" {
+			res = append(res, "GOARM="+strings.TrimPrefix(p.Variant, "v"))
+		}
+	case "amd64":
+		if p.Variant != "" {
+			res = append(res, "GOAMD64="+p.Variant)
+		}
+	}
+	return res
+}
+
+// goPlatformBuildCommands produces one build command per platform of a Go package. Each command runs with
+// the platform's GOOS/GOARCH and has ${__platform} replaced by the platform's directory name. The default
+// build command writes the binary into that directory.
+func goPlatformBuildCommands(cfg GoPkgConfig, goCommand string) ([][]string, error) {
+	var res [][]string
+	for _, platform := range cfg.Platforms {
+		p, err := parseGoPlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		args := Arguments{BuiltinArgPlatform: p.Dir()}
+
+		cmd := append([]string{"env"}, p.Env()...)
+		if len(cfg.BuildCommand) > 0 {
+			for _, arg := range cfg.BuildCommand {
+				cmd = append(cmd, string(replaceBuildArguments([]byte(arg), args)))
+			}
+		} else {
+			cmd = append(cmd, goCommand, "build")
+			cmd = append(cmd, cfg.goFlags()...)
+			for _, flag := range cfg.BuildFlags {
+				cmd = append(cmd, string(replaceBuildArguments([]byte(flag), args)))
+			}
+			cmd = append(cmd, "-o", p.Dir()+"/", ".")
+		}
+		res = append(res, cmd)
+	}
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoPlatformBuildCommands(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Config      GoPkgConfig
+		Expectation [][]string
+		Error       bool
+	}{
+		{
+			Name: "default build command",
+			Config: GoPkgConfig{
+				Packaging:  GoApp,
+				BuildFlags: []string{"-ldflags=-X main.platform=${__platform}"},
+				Platforms:  []string{"linux/amd64", "linux/arm/v7"},
+			},
+			Expectation: [][]string{
+				{"env", "GOOS=linux", "GOARCH=amd64", "go", "build", "-ldflags=-X main.platform=linux_amd64", "-o", "linux_amd64/", "."},
+				{"env", "GOOS=linux", "GOARCH=arm", "GOARM=7", "go", "build", "-ldflags=-X main.platform=linux_arm_v7", "-o", "linux_arm_v7/", "."},
+			},
+		},
+		{
+			Name: "custom build command",
+			Config: GoPkgConfig{
+				Packaging:    GoApp,
+				BuildCommand: []string{"make", "OUT=${__platform}/app"},
+				Platforms:    []string{"darwin/arm64"},
+			},
+			Expectation: [][]string{
+				{"env", "GOOS=darwin", "GOARCH=arm64", "make", "OUT=darwin_arm64/app"},
+			},
+		},
+		{
+			Name:   "invalid variant",
+			Config: GoPkgConfig{Packaging: GoApp, Platforms: []string{"linux/arm64/v9"}},
+			Error:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := goPlatformBuildCommands(test.Config, "go")
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("goPlatformBuildCommands() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
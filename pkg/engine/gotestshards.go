@@ -0,0 +1,184 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// goTestShardCommands splits the Go packages of a module into shards by their position in `go list`,
+// and produces a command per shard which tests the packages of that shard. If coverprofile is not empty,
+// each shard writes its coverage to coverprofile.<shard>. testFlags are passed to go test only.
+func goTestShardCommands(goCommand string, goFlags []string, coverprofile string, testFlags []string, shards int) [][]string {
+	flags := strings.Join(goFlags, " ")
+	res := make([][]string, 0, shards)
+	for i := 0; i < shards; i++ {
+		testArgs := []string{goCommand, "test", "-v"}
+		testArgs = append(testArgs, goFlags...)
+		if coverprofile != "" {
+			testArgs = append(testArgs, fmt.Sprintf("-coverprofile=%s.%d", coverprofile, i))
+		}
+		for _, f := range testFlags {
+			testArgs = append(testArgs, shellQuote(f))
+		}
+		script := fmt.Sprintf(`pkgs=$(%s list %s ./... | awk '(NR-1) %% %d == %d'); if [ -n "$pkgs" ]; then %s $pkgs; fi`, goCommand, flags, shards, i, strings.Join(testArgs, " "))
+		res = append(res, []string{"sh", "-c", script})
+	}
+	return res
+}
+
+// testShards returns the number of shards the tests of a Go package run in. The shards run concurrently,
+// hence there are never more shards than the build may run concurrent tasks.
+func (c *buildContext) testShards(cfg GoPkgConfig) int {
+	shards := cfg.TestShards
+	if c.MaxConcurrentTasks > 0 && int64(shards) > c.MaxConcurrentTasks {
+		shards = int(c.MaxConcurrentTasks)
+	}
+	return shards
+}
+
+// runGoTestShards runs the test shards concurrently. The output of each shard is held back until the shard
+// has finished, s.t. the test results of different shards do not interleave. Once all shards succeeded their
+// coverage profiles are merged into coverprofile.
+func (p *Package) runGoTestShards(buildctx *buildContext, wd string, shards [][]string, env []string, coverprofile string) error {
+	var eg errgroup.Group
+	for i, cmd := range shards {
+		i, cmd := i, cmd
+		eg.Go(func() error {
+			rep := &shardReporter{Reporter: buildctx.Reporter}
+			err := executeCommandsWithReporter(buildctx, rep, p, wd, [][]string{cmd}, env)
+			rep.Flush(p, fmt.Sprintf("test shard %d/%d", i+1, len(shards)))
+			if err != nil {
+				return xerrors.Errorf("test shard %d/%d failed: %w", i+1, len(shards), err)
+			}
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return err
+	}
+
+	if coverprofile == "" {
+		return nil
+	}
+	srcs := make([]string, 0, len(shards))
+	for i := range shards {
+		srcs = append(srcs, filepath.Join(wd, fmt.Sprintf("%s.%d", coverprofile, i)))
+	}
+	return mergeCoverProfiles(filepath.Join(wd, coverprofile), srcs)
+}
+
+// shardReporter buffers the build log of a test shard
+type shardReporter struct {
+	Reporter
+
+	mu  sync.Mutex
+	log []shardLogEntry
+}
+
+type shardLogEntry struct {
+	IsErr bool
+	Buf   []byte
+}
+
+func (r *shardReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log = append(r.log, shardLogEntry{IsErr: isErr, Buf: append([]byte(nil), buf...)})
+}
+
+// Flush passes the buffered log on to the underlying reporter
+func (r *shardReporter) Flush(pkg *Package, title string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Reporter.PackageBuildLog(pkg, false, []byte(fmt.Sprintf("--- %s\n", title)))
+	for _, e := range r.log {
+		r.Reporter.PackageBuildLog(pkg, e.IsErr, e.Buf)
+	}
+	r.log = nil
+}
+
+// mergeCoverProfiles concatenates Go coverage profiles into dst and removes the source profiles.
+// Shards which tested no package produce no profile and are skipped.
+func mergeCoverProfiles(dst string, srcs []string) error {
+	var (
+		lines   []string
+		mode    string
+		profile bool
+	)
+	for _, src := range srcs {
+		f, err := os.Open(src)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		profile = true
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "mode:") {
+				if mode == "" {
+					mode = line
+				} else if mode != line {
+					f.Close()
+					return xerrors.Errorf("cannot merge coverage profiles: %s has %s, expected %s", src, line, mode)
+				}
+				continue
+			}
+			if line == "" {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		err = os.Remove(src)
+		if err != nil {
+			return err
+		}
+	}
+	if !profile {
+		return nil
+	}
+
+	res := mode + "\n"
+	if len(lines) > 0 {
+		res += strings.Join(lines, "\n") + "\n"
+	}
+	return ioutil.WriteFile(dst, []byte(res), 0644)
+}
@@ -0,0 +1,129 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoTestShardCommands(t *testing.T) {
+	// fakego lists five packages and prints the packages it would test
+	dir := t.TempDir()
+	fakego := filepath.Join(dir, "go")
+	err := ioutil.WriteFile(fakego, []byte(`#!/bin/sh
+if [ "$1" = "list" ]; then printf "a\nb\nc\nd\ne\n"; exit 0; fi
+shift
+echo "$@"
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := goTestShardCommands(fakego, []string{"-race"}, "cov.out", []string{"-run", "TestA|TestB"}, 3)
+	var act []string
+	for _, cmd := range cmds {
+		out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		act = append(act, strings.TrimSpace(string(out)))
+	}
+	expectation := []string{
+		"-v -race -coverprofile=cov.out.0 -run TestA|TestB a d",
+		"-v -race -coverprofile=cov.out.1 -run TestA|TestB b e",
+		"-v -race -coverprofile=cov.out.2 -run TestA|TestB c",
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("goTestShardCommands() mismatch (-want +got):\n%s", diff)
+	}
+
+	// shards without packages must not test the module root
+	cmds = goTestShardCommands(fakego, nil, "", nil, 6)
+	out, err := exec.Command(cmds[5][0], cmds[5][1:]...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if len(out) != 0 {
+		t.Errorf("empty shard ran tests: %s", out)
+	}
+}
+
+func TestTestShards(t *testing.T) {
+	tests := []struct {
+		Shards      int
+		MaxTasks    int64
+		Expectation int
+	}{
+		{Shards: 0, MaxTasks: 8, Expectation: 0},
+		{Shards: 4, MaxTasks: 8, Expectation: 4},
+		{Shards: 16, MaxTasks: 8, Expectation: 8},
+		{Shards: 16, MaxTasks: 0, Expectation: 16},
+		{Shards: 4, MaxTasks: 1, Expectation: 1},
+	}
+	for _, test := range tests {
+		buildctx := &buildContext{buildOptions: buildOptions{MaxConcurrentTasks: test.MaxTasks}}
+		if act := buildctx.testShards(GoPkgConfig{TestShards: test.Shards}); act != test.Expectation {
+			t.Errorf("%d shards with %d tasks: expected %d shards, got %d", test.Shards, test.MaxTasks, test.Expectation, act)
+		}
+	}
+}
+
+func TestMergeCoverProfiles(t *testing.T) {
+	dir := t.TempDir()
+	srcs := []string{filepath.Join(dir, "cov.out.0"), filepath.Join(dir, "cov.out.1"), filepath.Join(dir, "cov.out.2")}
+	for fn, content := range map[string]string{
+		srcs[0]: "mode: atomic\na.go:1.1,2.2 1 1\n",
+		srcs[2]: "mode: atomic\nc.go:1.1,2.2 1 0\nc.go:3.1,4.2 1 1\n",
+	} {
+		err := ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(dir, "cov.out")
+	err := mergeCoverProfiles(dst, srcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := "mode: atomic\na.go:1.1,2.2 1 1\nc.go:1.1,2.2 1 0\nc.go:3.1,4.2 1 1\n"
+	if diff := cmp.Diff(expectation, string(act)); diff != "" {
+		t.Errorf("mergeCoverProfiles() mismatch (-want +got):\n%s", diff)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "cov.out.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("shard profiles were not removed: %v", files)
+	}
+}
@@ -0,0 +1,160 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// goToolchainURL is where pinned Go toolchains are downloaded from
+var goToolchainURL = "https://dl.google.com/go"
+
+// goToolchainEnvManifestPrefix prefixes the environment manifest entries of pinned Go toolchains, e.g. go@1.21.5
+const goToolchainEnvManifestPrefix = "go@"
+
+const builtinEnvManifestGoToolchain = "gotoolchain"
+
+var goToolchainVersionPattern = regexp.MustCompile(`^1\.\d+(\.\d+|rc\d+|beta\d+)?$`)
+
+// normaliseGoToolchainVersion accepts versions with and without the "go" prefix, e.g. go1.21.5 and 1.21.5
+func normaliseGoToolchainVersion(version string) string {
+	return strings.TrimPrefix(version, "go")
+}
+
+func validateGoToolchainVersion(version string) error {
+	if !goToolchainVersionPattern.MatchString(normaliseGoToolchainVersion(version)) {
+		return xerrors.Errorf("invalid Go toolchain version %q: expected a release like 1.21.5", version)
+	}
+	return nil
+}
+
+// goToolchainEnvManifestEntries produces an environment manifest entry for each Go toolchain pinned by a package
+func goToolchainEnvManifestEntries(pkgs map[string]*Package) EnvironmentManifest {
+	versions := make(map[string]struct{})
+	for _, p := range pkgs {
+		cfg, ok := p.Config.(GoPkgConfig)
+		if !ok || cfg.Go == "" {
+			continue
+		}
+		versions[normaliseGoToolchainVersion(cfg.Go)] = struct{}{}
+	}
+
+	res := make(EnvironmentManifest, 0, len(versions))
+	for v := range versions {
+		res = append(res, EnvironmentManifestEntry{
+			Name:    goToolchainEnvManifestPrefix + v,
+			Command: []string{builtinEnvManifestGoToolchain, v},
+			Builtin: true,
+		})
+	}
+	return res
+}
+
+// goToolchain makes sure the Go toolchain of the version is in the toolchain cache and returns its GOROOT
+func (c *buildContext) goToolchain(p *Package, version string) (goroot string, err error) {
+	version = normaliseGoToolchainVersion(version)
+	dir := c.GoToolchainDir
+	if dir == "" {
+		dir = filepath.Join(c.buildDir, "go-toolchains")
+	}
+	goroot = filepath.Join(dir, "go"+version)
+	if _, err := os.Stat(filepath.Join(goroot, "bin", "go")); err == nil {
+		return goroot, nil
+	}
+
+	// packages built concurrently often share a toolchain, which we download only once
+	c.goToolchainMu.Lock()
+	defer c.goToolchainMu.Unlock()
+	if _, err := os.Stat(filepath.Join(goroot, "bin", "go")); err == nil {
+		return goroot, nil
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create Go toolchain cache %s: %w", dir, err)
+	}
+	tmpdir, err := ioutil.TempDir(dir, ".go"+version+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	url := fmt.Sprintf("%s/go%s.%s-%s.tar.gz", goToolchainURL, version, runtime.GOOS, runtime.GOARCH)
+	c.Reporter.PackageBuildLog(p, false, []byte(fmt.Sprintf("downloading Go toolchain %s\n", url)))
+	sum, err := fetchChecksum(url + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	archive := filepath.Join(tmpdir, "go.tar.gz")
+	err = downloadVerified(url, sum, archive)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("tar", "xzf", archive, "-C", tmpdir).CombinedOutput()
+	if err != nil {
+		return "", xerrors.Errorf("cannot extract Go toolchain %s: %w: %s", version, err, string(out))
+	}
+	err = os.Rename(filepath.Join(tmpdir, "go"), goroot)
+	if err != nil {
+		return "", xerrors.Errorf("cannot store Go toolchain %s: %w", version, err)
+	}
+	return goroot, nil
+}
+
+// fetchChecksum downloads a file which contains a hex encoded sha256 checksum
+func fetchChecksum(url string) (string, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return "", xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("cannot fetch %s: %s", url, resp.Status)
+	}
+	fc, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	fields := strings.Fields(string(fc))
+	if len(fields) == 0 || !sha256Pattern.MatchString(fields[0]) {
+		return "", xerrors.Errorf("%s does not contain a sha256 checksum", url)
+	}
+	return fields[0], nil
+}
+
+// WithGoToolchains configures the directory the Go toolchains pinned by packages are kept in.
+// Defaults to a directory in the build dir.
+func WithGoToolchains(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.GoToolchainDir = dir
+		return nil
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGoToolchain(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	script := []byte("#!/bin/sh\necho go version go1.21.5\n")
+	err := tw.WriteHeader(&tar.Header{Name: "go/bin/go", Mode: 0755, Size: int64(len(script)), Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tw.Write(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	gz.Close()
+	sum := sha256.Sum256(archive.Bytes())
+
+	var downloads int
+	name := fmt.Sprintf("/go1.21.5.%s-%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case name:
+			downloads++
+			w.Write(archive.Bytes())
+		case name + ".sha256":
+			w.Write([]byte(hex.EncodeToString(sum[:])))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { goToolchainURL = url }(goToolchainURL)
+	goToolchainURL = srv.URL
+
+	buildctx := &buildContext{buildOptions: buildOptions{
+		Reporter:       &shardReporter{},
+		GoToolchainDir: t.TempDir(),
+	}}
+	pkg := &Package{C: &Component{Name: "comp"}, packageInternal: packageInternal{Name: "lib"}}
+	for _, version := range []string{"1.21.5", "go1.21.5"} {
+		goroot, err := buildctx.goToolchain(pkg, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := filepath.Join(buildctx.GoToolchainDir, "go1.21.5"); goroot != exp {
+			t.Errorf("expected GOROOT %s, got %s", exp, goroot)
+		}
+		if _, err := os.Stat(filepath.Join(goroot, "bin", "go")); err != nil {
+			t.Errorf("toolchain was not extracted: %v", err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("expected the toolchain to be downloaded once, got %d downloads", downloads)
+	}
+
+	_, err = buildctx.goToolchain(pkg, "1.20.1")
+	if err == nil {
+		t.Errorf("expected an error for a toolchain which does not exist")
+	}
+}
+
+func TestPackageEnvironmentManifest(t *testing.T) {
+	ba := &Application{EnvironmentManifest: EnvironmentManifest{
+		{Name: "go", Value: "go version go1.17.5 linux/amd64"},
+		{Name: "go@1.20.1", Value: "go version go1.20.1 linux/amd64"},
+		{Name: "go@1.21.5", Value: "go version go1.21.5 linux/amd64"},
+		{Name: "os", Value: "linux"},
+	}}
+	newPkg := func(cfg PackageConfig) *Package {
+		return &Package{C: &Component{W: ba}, packageInternal: packageInternal{Type: GoPackage}, Config: cfg}
+	}
+
+	tests := []struct {
+		Name        string
+		Config      PackageConfig
+		Expectation []string
+	}{
+		{Name: "go on PATH", Config: GoPkgConfig{}, Expectation: []string{"go", "os"}},
+		{Name: "pinned toolchain", Config: GoPkgConfig{Go: "go1.21.5"}, Expectation: []string{"go@1.21.5", "os"}},
+		{Name: "generic", Config: GenericPkgConfig{}, Expectation: []string{"go", "os"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var act []string
+			for _, e := range newPkg(test.Config).environmentManifest() {
+				act = append(act, e.Name)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("environmentManifest() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
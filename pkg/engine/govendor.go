@@ -0,0 +1,169 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/xerrors"
+)
+
+// goVendorModule is a module listed in vendor/modules.txt
+type goVendorModule struct {
+	Version     string
+	Replacement string
+	Explicit    bool
+}
+
+// CheckGoVendor returns an error if the vendor directory of the Go module in dir does not match its go.mod,
+// the same way the go command would refuse to build with -mod=vendor.
+func CheckGoVendor(dir string) error {
+	goModFn := filepath.Join(dir, "go.mod")
+	fc, err := ioutil.ReadFile(goModFn)
+	if err != nil {
+		return err
+	}
+	gomod, err := modfile.Parse(goModFn, fc, nil)
+	if err != nil {
+		return err
+	}
+	modulesTxt, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "modules.txt"))
+	if err != nil {
+		return xerrors.Errorf("vendor mode requires a vendor directory: %w", err)
+	}
+	vendored, err := parseGoVendorModules(modulesTxt)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	required := make(map[string]string, len(gomod.Require))
+	for _, req := range gomod.Require {
+		required[req.Mod.Path] = req.Mod.Version
+
+		vnd, ok := vendored[req.Mod.Path]
+		switch {
+		case !ok:
+			problems = append(problems, req.Mod.String()+" is required in go.mod but not vendored")
+		case vnd.Version != req.Mod.Version:
+			problems = append(problems, req.Mod.String()+" is required in go.mod but "+vnd.Version+" is vendored")
+		case !vnd.Explicit:
+			problems = append(problems, req.Mod.String()+" is required in go.mod but not marked as explicit in vendor/modules.txt")
+		}
+	}
+	for path, vnd := range vendored {
+		if !vnd.Explicit {
+			continue
+		}
+		if _, ok := required[path]; !ok {
+			problems = append(problems, path+"@"+vnd.Version+" is marked as explicit in vendor/modules.txt but not required in go.mod")
+		}
+	}
+	for _, rep := range gomod.Replace {
+		vnd, ok := vendored[rep.Old.Path]
+		if !ok || (rep.Old.Version != "" && rep.Old.Version != vnd.Version) {
+			continue
+		}
+		if repl := formatGoVendorReplacement(rep.New.Path, rep.New.Version); vnd.Replacement != repl {
+			problems = append(problems, rep.Old.Path+" is replaced by "+repl+" in go.mod but not in vendor/modules.txt")
+		}
+	}
+	for path, vnd := range vendored {
+		if vnd.Replacement == "" {
+			continue
+		}
+		var replaced bool
+		for _, rep := range gomod.Replace {
+			if rep.Old.Path == path && (rep.Old.Version == "" || rep.Old.Version == vnd.Version) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			problems = append(problems, path+" is replaced by "+vnd.Replacement+" in vendor/modules.txt but not in go.mod")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return xerrors.Errorf("vendor directory is inconsistent with go.mod - run go mod vendor:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// parseGoVendorModules parses the modules of a vendor/modules.txt file, e.g.
+//
+//	# example.com/mod v1.2.3 => ../mod
+//	## explicit; go 1.17
+//	example.com/mod/pkg
+func parseGoVendorModules(fc []byte) (map[string]*goVendorModule, error) {
+	var (
+		res     = make(map[string]*goVendorModule)
+		current *goVendorModule
+		scanner = bufio.NewScanner(bytes.NewReader(fc))
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if current == nil {
+				return nil, xerrors.Errorf("vendor/modules.txt: annotation without module: %s", line)
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				if strings.TrimSpace(annotation) == "explicit" {
+					current.Explicit = true
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			if len(fields) < 2 {
+				return nil, xerrors.Errorf("vendor/modules.txt: invalid module line: %s", line)
+			}
+			if fields[1] == "=>" {
+				// wildcard replacements of modules which are not required are listed for completeness only
+				current = nil
+				continue
+			}
+			mod := &goVendorModule{Version: fields[1]}
+			if len(fields) > 3 && fields[2] == "=>" {
+				mod.Replacement = strings.Join(fields[3:], " ")
+			}
+			res[fields[0]] = mod
+			current = mod
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func formatGoVendorReplacement(path, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + " " + version
+}
@@ -0,0 +1,123 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckGoVendor(t *testing.T) {
+	const goMod = `module example.com/app
+
+go 1.17
+
+require (
+	example.com/dep v0.0.0
+	github.com/pkg/errors v0.9.1
+)
+
+require golang.org/x/sys v0.1.0 // indirect
+
+replace example.com/dep => ../dep
+`
+	tests := []struct {
+		Name       string
+		GoMod      string
+		ModulesTxt string
+		Problems   []string
+	}{
+		{
+			Name:  "consistent",
+			GoMod: goMod,
+			ModulesTxt: `# example.com/dep v0.0.0 => ../dep
+## explicit; go 1.17
+example.com/dep
+# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# golang.org/x/sys v0.1.0
+## explicit; go 1.17
+golang.org/x/sys/unix
+# example.com/dep => ../dep
+`,
+		},
+		{
+			Name:  "outdated",
+			GoMod: goMod,
+			ModulesTxt: `# example.com/dep v0.0.0
+## explicit; go 1.17
+example.com/dep
+# github.com/pkg/errors v0.8.0
+## explicit
+github.com/pkg/errors
+# golang.org/x/net v0.1.0
+## explicit
+golang.org/x/net/http2
+`,
+			Problems: []string{
+				"example.com/dep is replaced by ../dep in go.mod but not in vendor/modules.txt",
+				"github.com/pkg/errors@v0.9.1 is required in go.mod but v0.8.0 is vendored",
+				"golang.org/x/net@v0.1.0 is marked as explicit in vendor/modules.txt but not required in go.mod",
+				"golang.org/x/sys@v0.1.0 is required in go.mod but not vendored",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gorpa-vendor")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			err = os.MkdirAll(filepath.Join(dir, "vendor"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(test.GoMod), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(filepath.Join(dir, "vendor", "modules.txt"), []byte(test.ModulesTxt), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = CheckGoVendor(dir)
+			if len(test.Problems) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			act := strings.Split(err.Error(), "\n\t")[1:]
+			if strings.Join(act, "\n") != strings.Join(test.Problems, "\n") {
+				t.Errorf("unexpected problems:\n%s\nexpected:\n%s", strings.Join(act, "\n"), strings.Join(test.Problems, "\n"))
+			}
+		})
+	}
+}
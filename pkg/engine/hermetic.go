@@ -0,0 +1,154 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// HermeticEnvironment limits the environment the commands of a package build inherit from Bhojpur GoRPA, s.t.
+// the build does not depend on whatever happens to be set on the machine it runs on. The package's own env
+// is added regardless.
+type HermeticEnvironment struct {
+	// Path replaces the PATH of the build commands, which are looked up in these directories only.
+	// If empty, the PATH is passed through.
+	Path []string `yaml:"path,omitempty"`
+	// Pass lists the environment variables which are passed through, e.g. SSH_AUTH_SOCK. A trailing * passes
+	// all variables with that prefix, e.g. GOPRIVATE* or AWS_*.
+	Pass []string `yaml:"pass,omitempty"`
+}
+
+// hermeticDefaultVariables are passed through to all hermetic builds as most tools do not work without them
+var hermeticDefaultVariables = []string{"HOME", "TMPDIR"}
+
+// Validate returns an error if a PATH entry is not absolute or a variable name is invalid
+func (h *HermeticEnvironment) Validate() error {
+	if h == nil {
+		return nil
+	}
+	for _, dir := range h.Path {
+		if !filepath.IsAbs(dir) {
+			return xerrors.Errorf("hermetic PATH entry %q is not absolute", dir)
+		}
+	}
+	for _, name := range h.Pass {
+		pattern := strings.TrimSuffix(name, "*")
+		if pattern == "" || strings.ContainsAny(pattern, "=*") {
+			return xerrors.Errorf("invalid hermetic environment variable %q", name)
+		}
+	}
+	return nil
+}
+
+// filter returns the variables of environ which pass the hermetic environment, and the hermetic PATH
+// if there is one. Without a hermetic environment all variables pass.
+func (h *HermeticEnvironment) filter(environ []string) []string {
+	if h == nil {
+		return environ
+	}
+
+	res := make([]string, 0, len(h.Pass)+len(hermeticDefaultVariables)+1)
+	for _, e := range environ {
+		name := strings.SplitN(e, "=", 2)[0]
+		if isPathVariable(name) {
+			if len(h.Path) == 0 {
+				res = append(res, e)
+			}
+			continue
+		}
+		if h.passes(name) {
+			res = append(res, e)
+		}
+	}
+	if len(h.Path) > 0 {
+		res = append(res, "PATH="+strings.Join(h.Path, string(os.PathListSeparator)))
+	}
+	return res
+}
+
+func (h *HermeticEnvironment) passes(name string) bool {
+	for _, n := range hermeticDefaultVariables {
+		if n == name {
+			return true
+		}
+	}
+	for _, n := range h.Pass {
+		if n == name || strings.HasSuffix(n, "*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// prependPath returns the PATH variable of the build commands with dir in front: the hermetic PATH if there is
+// one, the PATH of this process otherwise.
+func (h *HermeticEnvironment) prependPath(dir string) string {
+	path := os.Getenv("PATH")
+	if h != nil && len(h.Path) > 0 {
+		path = strings.Join(h.Path, string(os.PathListSeparator))
+	}
+	return "PATH=" + dir + string(os.PathListSeparator) + path
+}
+
+// lookPath finds a command in the hermetic PATH. exec.Command looks commands up in the PATH of this process,
+// which does not match the one the build commands get.
+func (h *HermeticEnvironment) lookPath(name string) (string, error) {
+	if h == nil || len(h.Path) == 0 || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+
+	candidates := []string{name}
+	if runtime.GOOS == "windows" && filepath.Ext(name) == "" {
+		candidates = append(candidates, name+".exe")
+	}
+	for _, dir := range h.Path {
+		for _, c := range candidates {
+			fn := filepath.Join(dir, c)
+			stat, err := os.Stat(fn)
+			if err != nil || stat.IsDir() {
+				continue
+			}
+			if runtime.GOOS != "windows" && stat.Mode()&0111 == 0 {
+				continue
+			}
+			return fn, nil
+		}
+	}
+	return "", xerrors.Errorf("%s: executable file not found in the hermetic PATH %s", name, strings.Join(h.Path, string(os.PathListSeparator)))
+}
+
+func isPathVariable(name string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(name, "PATH")
+	}
+	return name == "PATH"
+}
+
+// environ returns the environment the commands of the package build start from: the environment of this
+// process as far as the hermetic environment of the package lets it through, and the package's env.
+func (p *Package) environ() []string {
+	return append(p.Hermetic.filter(os.Environ()), p.Environment...)
+}
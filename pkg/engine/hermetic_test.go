@@ -0,0 +1,110 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHermeticEnvironmentFilter(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "HOME=/root", "SECRET=x", "AWS_REGION=eu", "AWS_KEY=k", "GOPROXY=p"}
+	tests := []struct {
+		Name        string
+		Hermetic    *HermeticEnvironment
+		Expectation []string
+	}{
+		{Name: "not hermetic", Expectation: environ},
+		{Name: "defaults only", Hermetic: &HermeticEnvironment{}, Expectation: []string{"PATH=/usr/bin", "HOME=/root"}},
+		{
+			Name:        "pass",
+			Hermetic:    &HermeticEnvironment{Pass: []string{"AWS_*", "GOPROXY"}},
+			Expectation: []string{"PATH=/usr/bin", "HOME=/root", "AWS_REGION=eu", "AWS_KEY=k", "GOPROXY=p"},
+		},
+		{
+			Name:        "path",
+			Hermetic:    &HermeticEnvironment{Path: []string{"/opt/bin", "/bin"}},
+			Expectation: []string{"HOME=/root", "PATH=/opt/bin:/bin"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Hermetic.filter(environ)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("environment mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, h := range []HermeticEnvironment{{Path: []string{"bin"}}, {Pass: []string{"FOO=bar"}}, {Pass: []string{"*"}}, {Pass: []string{"A*B"}}} {
+		if err := h.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", h)
+		}
+	}
+}
+
+func TestHermeticBuildCommands(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("cannot find sh: %v", err)
+	}
+	t.Setenv("GORPA_HERMETIC_SECRET", "secret")
+
+	var (
+		wd  = t.TempDir()
+		pkg = &Package{
+			C: &Component{Name: "comp", W: &Application{}},
+			packageInternal: packageInternal{
+				Name:        "pkg",
+				Type:        GenericPackage,
+				Environment: []string{"FOO=bar"},
+				Hermetic:    &HermeticEnvironment{Path: []string{filepath.Dir(sh)}},
+			},
+		}
+	)
+	err = executeCommandsWithReporter(&buildContext{}, &shardReporter{}, pkg, wd, [][]string{{"sh", "-c", "env > env.txt"}}, []string{"EXTRA=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := ioutil.ReadFile(filepath.Join(wd, "env.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := string(fc)
+	for _, exp := range []string{"FOO=bar\n", "EXTRA=1\n", "PATH=" + filepath.Dir(sh) + "\n"} {
+		if !strings.Contains(env, exp) {
+			t.Errorf("expected %q in the environment of the build commands:\n%s", exp, env)
+		}
+	}
+	if strings.Contains(env, "GORPA_HERMETIC_SECRET") {
+		t.Errorf("hermetic build inherited GORPA_HERMETIC_SECRET:\n%s", env)
+	}
+
+	err = executeCommandsWithReporter(&buildContext{}, &shardReporter{}, pkg, wd, [][]string{{"gorpa-does-not-exist"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "hermetic PATH") {
+		t.Errorf("expected the command not to be found in the hermetic PATH, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// GraphSnapshot is a compact record of the application's package graph at a particular Git commit
+type GraphSnapshot struct {
+	Commit     string                     `json:"commit"`
+	CommitTime time.Time                  `json:"commitTime"`
+	Packages   map[string]PackageSnapshot `json:"packages"`
+}
+
+// PackageSnapshot records a package's version and everything that went into computing it
+type PackageSnapshot struct {
+	Version              string            `json:"version"`
+	Environment          string            `json:"environment"`
+	Definition           string            `json:"definition"`
+	ArgumentDependencies []string          `json:"argdeps,omitempty"`
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	Sources              map[string]string `json:"sources,omitempty"`
+}
+
+// NewGraphSnapshot produces a snapshot of all packages in the application.
+// The application must be a clean Git working copy, otherwise the snapshot could not be attributed to a commit.
+func NewGraphSnapshot(application *Application) (*GraphSnapshot, error) {
+	if application.Git.Commit == "" {
+		return nil, xerrors.Errorf("application is not a Git working copy")
+	}
+	if application.Git.Dirty {
+		return nil, xerrors.Errorf("application has uncommitted changes")
+	}
+
+	out, err := exec.Command("git", "-C", application.Origin, "show", "-s", "--format=%cI", application.Git.Commit).Output()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot get commit time: %w", err)
+	}
+	commitTime, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot get commit time: %w", err)
+	}
+
+	envhash, err := application.EnvironmentManifest.hash(application.ContentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GraphSnapshot{
+		Commit:     application.Git.Commit,
+		CommitTime: commitTime,
+		Packages:   make(map[string]PackageSnapshot, len(application.Packages)),
+	}
+	for name, pkg := range application.Packages {
+		version, err := pkg.Version()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+		defhash, err := pkg.DefinitionHash()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+		manifest, err := pkg.ContentManifest()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", name, err)
+		}
+
+		ps := PackageSnapshot{
+			Version:              version,
+			Environment:          envhash,
+			Definition:           defhash,
+			ArgumentDependencies: pkg.ArgumentDependencies,
+			Dependencies:         make(map[string]string, len(pkg.GetDependencies())),
+			Sources:              make(map[string]string, len(manifest)),
+		}
+		for _, dep := range pkg.GetDependencies() {
+			ps.Dependencies[dep.FullName()], err = dep.Version()
+			if err != nil {
+				return nil, xerrors.Errorf("%s: %w", name, err)
+			}
+		}
+		for _, m := range manifest {
+			segs := strings.SplitN(m, ":", 2)
+			ps.Sources[segs[0]] = segs[1]
+		}
+		res.Packages[name] = ps
+	}
+
+	return res, nil
+}
+
+// Changes explains why this package snapshot's version differs from prev
+func (ps PackageSnapshot) Changes(prev PackageSnapshot) []string {
+	if ps.Version == prev.Version {
+		return nil
+	}
+
+	var res []string
+	if ps.Definition != prev.Definition {
+		res = append(res, "package definition changed")
+	}
+	if ps.Environment != prev.Environment {
+		res = append(res, "environment manifest changed")
+	}
+	if strings.Join(ps.ArgumentDependencies, " ") != strings.Join(prev.ArgumentDependencies, " ") {
+		res = append(res, "argument dependencies changed")
+	}
+	res = append(res, diffHashMap("dependency", ps.Dependencies, prev.Dependencies)...)
+	res = append(res, diffHashMap("source", ps.Sources, prev.Sources)...)
+
+	if len(res) == 0 {
+		// nothing we track changed, hence the build process itself (or provenance config) must have
+		res = append(res, "build process changed")
+	}
+	return res
+}
+
+func diffHashMap(kind string, cur, prev map[string]string) []string {
+	var res []string
+	for k, v := range cur {
+		pv, ok := prev[k]
+		if !ok {
+			res = append(res, fmt.Sprintf("%s added: %s", kind, k))
+		} else if pv != v {
+			res = append(res, fmt.Sprintf("%s changed: %s", kind, k))
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			res = append(res, fmt.Sprintf("%s removed: %s", kind, k))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// GraphHistory stores graph snapshots in a directory, one gzipped JSON file per commit
+type GraphHistory struct {
+	Location string
+}
+
+// Has returns true if there's a snapshot for the commit already
+func (h GraphHistory) Has(commit string) bool {
+	_, err := os.Stat(h.snapshotFilename(commit))
+	return err == nil
+}
+
+// Store writes the snapshot to the history, replacing any snapshot of the same commit
+func (h GraphHistory) Store(snapshot *GraphSnapshot) error {
+	err := os.MkdirAll(h.Location, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(h.Location, "snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(snapshot)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), h.snapshotFilename(snapshot.Commit))
+}
+
+// Snapshots loads all snapshots in the history ordered by commit time, oldest first
+func (h GraphHistory) Snapshots() ([]*GraphSnapshot, error) {
+	fns, err := filepath.Glob(filepath.Join(h.Location, "*.json.gz"))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*GraphSnapshot, 0, len(fns))
+	for _, fn := range fns {
+		snapshot, err := loadGraphSnapshot(fn)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot load %s: %w", fn, err)
+		}
+		res = append(res, snapshot)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CommitTime.Before(res[j].CommitTime)
+	})
+	return res, nil
+}
+
+func (h GraphHistory) snapshotFilename(commit string) string {
+	return filepath.Join(h.Location, commit+".json.gz")
+}
+
+func loadGraphSnapshot(fn string) (*GraphSnapshot, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var res GraphSnapshot
+	err = json.NewDecoder(zr).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PackageVersionChange describes a commit at which a package's version changed
+type PackageVersionChange struct {
+	Commit     string    `json:"commit" yaml:"commit"`
+	CommitTime time.Time `json:"commitTime" yaml:"commitTime"`
+	Version    string    `json:"version" yaml:"version"`
+	Reasons    []string  `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+}
+
+// PackageVersionHistory lists all recorded version changes of a package, oldest first
+func PackageVersionHistory(snapshots []*GraphSnapshot, pkg string) []PackageVersionChange {
+	var (
+		res  []PackageVersionChange
+		prev *PackageSnapshot
+	)
+	for i, snapshot := range snapshots {
+		ps, ok := snapshot.Packages[pkg]
+		if !ok {
+			if prev != nil {
+				res = append(res, PackageVersionChange{
+					Commit:     snapshot.Commit,
+					CommitTime: snapshot.CommitTime,
+					Reasons:    []string{"package removed"},
+				})
+			}
+			prev = nil
+			continue
+		}
+
+		var reasons []string
+		if prev == nil && i == 0 {
+			reasons = []string{"first recorded"}
+		} else if prev == nil {
+			reasons = []string{"package added"}
+		} else {
+			reasons = ps.Changes(*prev)
+		}
+		if len(reasons) > 0 {
+			res = append(res, PackageVersionChange{
+				Commit:     snapshot.Commit,
+				CommitTime: snapshot.CommitTime,
+				Version:    ps.Version,
+				Reasons:    reasons,
+			})
+		}
+		prev = &ps
+	}
+	return res
+}
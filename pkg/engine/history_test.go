@@ -0,0 +1,91 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGraphHistory(t *testing.T) {
+	var (
+		day      = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		snapshot = func(commit string, days int, pkgs map[string]PackageSnapshot) *GraphSnapshot {
+			return &GraphSnapshot{Commit: commit, CommitTime: day.AddDate(0, 0, days), Packages: pkgs}
+		}
+		v1 = PackageSnapshot{Version: "v1", Definition: "def", Sources: map[string]string{"main.go": "a"}}
+		v2 = PackageSnapshot{Version: "v2", Definition: "def", Sources: map[string]string{"main.go": "b", "util.go": "c"}}
+		v3 = PackageSnapshot{Version: "v3", Definition: "other", Sources: map[string]string{"main.go": "b", "util.go": "c"}}
+	)
+	history := GraphHistory{Location: t.TempDir()}
+	// stored out of order on purpose: the history is sorted by commit time, not by the time of recording
+	for _, s := range []*GraphSnapshot{
+		snapshot("c3", 2, map[string]PackageSnapshot{"comp:pkg": v2}),
+		snapshot("c1", 0, map[string]PackageSnapshot{"comp:pkg": v1}),
+		snapshot("c2", 1, map[string]PackageSnapshot{"comp:pkg": v1}),
+		snapshot("c4", 3, map[string]PackageSnapshot{}),
+		snapshot("c5", 4, map[string]PackageSnapshot{"comp:pkg": v3}),
+	} {
+		err := history.Store(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !history.Has("c1") || history.Has("c6") {
+		t.Errorf("history does not know which commits it has")
+	}
+
+	snapshots, err := history.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commits []string
+	for _, s := range snapshots {
+		commits = append(commits, s.Commit)
+	}
+	if diff := cmp.Diff([]string{"c1", "c2", "c3", "c4", "c5"}, commits); diff != "" {
+		t.Errorf("unexpected snapshot order (-want +got):\n%s", diff)
+	}
+
+	var changes []string
+	for _, c := range PackageVersionHistory(snapshots, "comp:pkg") {
+		changes = append(changes, c.Commit+" "+c.Version+": "+strings.Join(c.Reasons, ", "))
+	}
+	expectation := []string{
+		"c1 v1: first recorded",
+		"c3 v2: source added: util.go, source changed: main.go",
+		"c4 : package removed",
+		"c5 v3: package added",
+	}
+	if diff := cmp.Diff(expectation, changes); diff != "" {
+		t.Errorf("unexpected version history (-want +got):\n%s", diff)
+	}
+
+	if reasons := v3.Changes(v2); len(reasons) != 1 || reasons[0] != "package definition changed" {
+		t.Errorf("unexpected changes of the definition: %v", reasons)
+	}
+	if reasons := (PackageSnapshot{Version: "v4"}).Changes(PackageSnapshot{Version: "v3"}); len(reasons) != 1 || reasons[0] != "build process changed" {
+		t.Errorf("expected a build process change, got %v", reasons)
+	}
+}
@@ -0,0 +1,125 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// BuildHook names the point of a package build at which hooks run
+type BuildHook string
+
+const (
+	// HookPreBuild runs once the build directory is prepared, before the build commands
+	HookPreBuild BuildHook = "preBuild"
+	// HookPostBuild runs once the build artifact is in the local cache
+	HookPostBuild BuildHook = "postBuild"
+	// HookOnFailure runs when a package build failed
+	HookOnFailure BuildHook = "onFailure"
+)
+
+// BuildHooks are commands which run at certain points of package builds, e.g. to send notifications
+// or upload artifacts. Hooks run for packages which are built, but not for packages found in a cache.
+type BuildHooks struct {
+	PreBuild  [][]string `yaml:"preBuild,omitempty"`
+	PostBuild [][]string `yaml:"postBuild,omitempty"`
+	OnFailure [][]string `yaml:"onFailure,omitempty"`
+}
+
+// Validate returns an error if a hook has an empty command
+func (h BuildHooks) Validate() error {
+	for _, hook := range []BuildHook{HookPreBuild, HookPostBuild, HookOnFailure} {
+		for _, cmd := range h.commands(hook) {
+			if len(cmd) == 0 {
+				return xerrors.Errorf("hooks: %s must not contain empty commands", hook)
+			}
+		}
+	}
+	return nil
+}
+
+func (h BuildHooks) commands(hook BuildHook) [][]string {
+	switch hook {
+	case HookPreBuild:
+		return h.PreBuild
+	case HookPostBuild:
+		return h.PostBuild
+	case HookOnFailure:
+		return h.OnFailure
+	default:
+		return nil
+	}
+}
+
+// runHooks runs the hooks of the application and then those of the package in the build directory wd.
+// The hooks find the package metadata, the location of the build artifact and, if the build failed,
+// the build error in their environment.
+func (p *Package) runHooks(buildctx *buildContext, hook BuildHook, wd string, buildErr error) error {
+	commands := append(p.C.W.Hooks.commands(hook), p.Hooks.commands(hook)...)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	version, err := p.Version()
+	if err != nil {
+		return err
+	}
+	artifact, _ := buildctx.LocalCache.Location(p)
+	env := p.environ()
+	env = append(env,
+		"GORPA_HOOK="+string(hook),
+		"GORPA_PACKAGE="+p.FullName(),
+		"GORPA_PACKAGE_VERSION="+version,
+		"GORPA_PACKAGE_TYPE="+string(p.Type),
+		"GORPA_COMPONENT="+p.C.Name,
+		"GORPA_PACKAGE_DIR="+wd,
+		"GORPA_ARTIFACT="+artifact,
+	)
+	if buildErr != nil {
+		env = append(env, "GORPA_BUILD_ERROR="+buildErr.Error())
+	}
+
+	for _, cmd := range commands {
+		log.WithField("package", p.FullName()).WithField("hook", hook).WithField("command", strings.Join(cmd, " ")).Debug("running hook")
+		name, err := p.Hermetic.lookPath(cmd[0])
+		if err != nil {
+			return xerrors.Errorf("%s hook %s failed: %w", hook, strings.Join(cmd, " "), err)
+		}
+		err = run(buildctx.Reporter, p, nil, env, wd, name, cmd[1:]...)
+		if err != nil {
+			return xerrors.Errorf("%s hook %s failed: %w", hook, strings.Join(cmd, " "), err)
+		}
+	}
+	return nil
+}
+
+// runFailureHooks runs the onFailure hooks of a failed package build. Their failure is reported, but doesn't
+// replace the build error.
+func (p *Package) runFailureHooks(buildctx *buildContext, wd string, buildErr error) {
+	err := p.runHooks(buildctx, HookOnFailure, wd, buildErr)
+	if err != nil {
+		buildctx.Reporter.PackageBuildLog(p, true, []byte(fmt.Sprintf("%v\n", err)))
+	}
+}
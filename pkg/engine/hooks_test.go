@@ -0,0 +1,85 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildHooks(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	var (
+		log  = filepath.Join(t.TempDir(), "hooks.log")
+		hook = func(msg string) []string {
+			return []string{"sh", "-c", "echo \"" + msg + "\" >> " + log}
+		}
+		app = &Application{Hooks: BuildHooks{PreBuild: [][]string{hook("application $GORPA_HOOK")}}}
+		pkg = func(name string, cmd []string) *Package {
+			p := testPackage(app, name, GenericPackage)
+			p.Hooks = BuildHooks{
+				PreBuild:  [][]string{hook("$GORPA_HOOK $GORPA_PACKAGE")},
+				PostBuild: [][]string{hook("$GORPA_HOOK $GORPA_PACKAGE $(test -f $GORPA_ARTIFACT && echo cached)")},
+				OnFailure: [][]string{hook("$GORPA_HOOK $GORPA_PACKAGE $GORPA_BUILD_ERROR")},
+			}
+			p.Config = GenericPkgConfig{Commands: [][]string{cmd}}
+			return p
+		}
+	)
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []BuildOption{WithLocalCache(cache), WithReporter(NewMetricsReporter(cache))}
+
+	err = Build(pkg("ok", []string{"true"}), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Build(pkg("broken", []string{"false"}), opts...)
+	if err == nil {
+		t.Fatal("expected the build to fail")
+	}
+
+	fc, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := strings.Join([]string{
+		"application preBuild",
+		"preBuild comp:ok",
+		"postBuild comp:ok cached",
+		"application preBuild",
+		"preBuild comp:broken",
+		"onFailure comp:broken exit status 1",
+	}, "\n")
+	if act := strings.TrimSpace(string(fc)); act != expectation {
+		t.Errorf("unexpected hooks: got\n%s\nexpected\n%s", act, expectation)
+	}
+
+	err = BuildHooks{PostBuild: [][]string{{}}}.Validate()
+	if err == nil {
+		t.Errorf("expected empty hook commands to be invalid")
+	}
+}
@@ -0,0 +1,120 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var dockerTagSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// DockerImageRewrite rewrites the image references of Docker packages for a single build, e.g. to push
+// development builds to a personal registry namespace without changing the BUILD.yaml. The rewrite does not
+// change package versions: a cached build is re-tagged using the rewritten names. Artifacts built with a rewrite
+// refer to the rewritten images, hence they are not uploaded to the remote cache.
+type DockerImageRewrite struct {
+	// Namespace replaces the registry and repository path of an image, e.g. eu.gcr.io/some-project/app:v1
+	// becomes docker.io/alice/app:v1 for namespace docker.io/alice.
+	Namespace string `yaml:"namespace,omitempty"`
+	// Suffix is appended to the image tag, e.g. app:v1 becomes app:v1-dev for suffix -dev.
+	// Images without tag are treated as if they were tagged latest.
+	Suffix string `yaml:"suffix,omitempty"`
+}
+
+// IsEmpty returns true if the rewrite leaves all images alone
+func (r DockerImageRewrite) IsEmpty() bool {
+	return r.Namespace == "" && r.Suffix == ""
+}
+
+// Validate ensures the rewrite produces valid image references
+func (r DockerImageRewrite) Validate() error {
+	if r.Suffix != "" && !dockerTagSuffixPattern.MatchString(r.Suffix) {
+		return xerrors.Errorf("invalid image suffix %q: only letters, digits, _, . and - are allowed", r.Suffix)
+	}
+	if strings.HasSuffix(r.Namespace, "/") || strings.ContainsAny(r.Namespace, "@ ") {
+		return xerrors.Errorf("invalid image namespace %q", r.Namespace)
+	}
+	return nil
+}
+
+// Apply rewrites a single image reference. References pinned by digest are left alone.
+func (r DockerImageRewrite) Apply(img string) string {
+	if r.IsEmpty() || strings.Contains(img, "@") {
+		return img
+	}
+
+	var (
+		repo = img
+		tag  string
+	)
+	if idx := strings.LastIndex(img, ":"); idx > strings.LastIndex(img, "/") {
+		repo, tag = img[:idx], img[idx+1:]
+	}
+
+	if r.Namespace != "" {
+		name := repo
+		if idx := strings.LastIndex(repo, "/"); idx >= 0 {
+			name = repo[idx+1:]
+		}
+		repo = r.Namespace + "/" + name
+	}
+	if r.Suffix != "" {
+		if tag == "" {
+			tag = "latest"
+		}
+		tag += r.Suffix
+	}
+
+	if tag == "" {
+		return repo
+	}
+	return repo + ":" + tag
+}
+
+// ApplyAll rewrites all image references
+func (r DockerImageRewrite) ApplyAll(imgs []string) []string {
+	if r.IsEmpty() {
+		return imgs
+	}
+
+	res := make([]string, len(imgs))
+	for i, img := range imgs {
+		res[i] = r.Apply(img)
+	}
+	return res
+}
+
+// dockerImageRewriteEntry is written to the imgrewrites.yaml of Docker build artifacts
+type dockerImageRewriteEntry struct {
+	Original  string `yaml:"original"`
+	Rewritten string `yaml:"rewritten"`
+}
+
+func dockerImageRewrites(original, rewritten []string) []dockerImageRewriteEntry {
+	res := make([]dockerImageRewriteEntry, len(original))
+	for i := range original {
+		res[i] = dockerImageRewriteEntry{Original: original[i], Rewritten: rewritten[i]}
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDockerImageRewrite(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Rewrite     DockerImageRewrite
+		Image       string
+		Expectation string
+	}{
+		{"empty", DockerImageRewrite{}, "eu.gcr.io/some-project/app:v1", "eu.gcr.io/some-project/app:v1"},
+		{"namespace", DockerImageRewrite{Namespace: "docker.io/alice"}, "eu.gcr.io/some-project/app:v1", "docker.io/alice/app:v1"},
+		{"namespace without path", DockerImageRewrite{Namespace: "alice"}, "app:v1", "alice/app:v1"},
+		{"namespace with registry port", DockerImageRewrite{Namespace: "localhost:5000/dev"}, "registry:5000/app", "localhost:5000/dev/app"},
+		{"suffix", DockerImageRewrite{Suffix: "-dev"}, "eu.gcr.io/some-project/app:v1", "eu.gcr.io/some-project/app:v1-dev"},
+		{"suffix without tag", DockerImageRewrite{Suffix: "-dev"}, "registry:5000/app", "registry:5000/app:latest-dev"},
+		{"both", DockerImageRewrite{Namespace: "docker.io/alice", Suffix: "-dev"}, "eu.gcr.io/some-project/app:v1", "docker.io/alice/app:v1-dev"},
+		{"digest", DockerImageRewrite{Namespace: "docker.io/alice", Suffix: "-dev"}, "app@sha256:abc", "app@sha256:abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Rewrite.Apply(test.Image)
+			if act != test.Expectation {
+				t.Errorf("expected %q, got %q", test.Expectation, act)
+			}
+		})
+	}
+}
+
+func TestDockerImageRewriteRemoteCache(t *testing.T) {
+	var (
+		ba      = &Application{}
+		image   = testPackage(ba, "image", DockerPackage)
+		tarball = testPackage(ba, "tarball", DockerPackage)
+		generic = testPackage(ba, "generic", GenericPackage)
+	)
+	image.Config = DockerPkgConfig{Image: []string{"eu.gcr.io/some-project/app:v1"}}
+	tarball.Config = DockerPkgConfig{}
+
+	for _, test := range []struct {
+		Rewrite     DockerImageRewrite
+		Expectation []string
+	}{
+		{Expectation: []string{"generic", "image", "tarball"}},
+		{Rewrite: DockerImageRewrite{Namespace: "docker.io/alice"}, Expectation: []string{"generic", "tarball"}},
+	} {
+		ctx := &buildContext{
+			buildOptions:       buildOptions{DockerImageRewrite: test.Rewrite},
+			newlyBuiltPackages: map[string]*Package{"1": image, "2": tarball, "3": generic},
+		}
+		var act []string
+		for _, p := range ctx.GetNewPackagesForCache() {
+			act = append(act, p.Name)
+		}
+		sort.Strings(act)
+		if diff := cmp.Diff(test.Expectation, act); diff != "" {
+			t.Errorf("unexpected packages for the remote cache with rewrite %+v (-want +got):\n%s", test.Rewrite, diff)
+		}
+	}
+}
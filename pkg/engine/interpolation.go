@@ -0,0 +1,134 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// envInterpolationPattern matches ${env:VAR} and ${env:VAR:-default}
+var envInterpolationPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// EnvInterpolation records how an ${env:...} reference in the APPLICATION.yaml was resolved
+type EnvInterpolation struct {
+	// Field is the location of the value in the APPLICATION.yaml, e.g. remoteCache.minio.endpoint
+	Field string `json:"field" yaml:"field"`
+	// Variable is the name of the environment variable
+	Variable string `json:"variable" yaml:"variable"`
+	// Value is what the reference resolved to
+	Value string `json:"value" yaml:"value"`
+	// Default is true if the variable was not set and the default was used
+	Default bool `json:"default" yaml:"default"`
+}
+
+// interpolateEnv replaces all ${env:VAR:-default} references in the scalar values of the YAML document.
+// A default is used if the variable is unset or empty. References without default fail if the variable is unset.
+func interpolateEnv(node *yaml.Node, lookup func(string) (string, bool)) ([]EnvInterpolation, error) {
+	var res []EnvInterpolation
+	err := walkInterpolationNodes(node, "", func(field string, n *yaml.Node) error {
+		if !strings.Contains(n.Value, "${env:") {
+			return nil
+		}
+
+		var (
+			whole = envInterpolationPattern.FindStringSubmatchIndex(n.Value)
+			err   error
+		)
+		val := envInterpolationPattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			m := envInterpolationPattern.FindStringSubmatch(ref)
+			var (
+				name, hasDefault, def = m[1], m[2] != "", m[3]
+				ip                    = EnvInterpolation{Field: field, Variable: name}
+			)
+
+			v, ok := lookup(name)
+			switch {
+			case ok && v != "":
+				ip.Value = v
+			case hasDefault:
+				ip.Value = def
+				ip.Default = true
+			case ok:
+				ip.Value = v
+			default:
+				if err == nil {
+					err = xerrors.Errorf("%s: environment variable %s is not set and has no default (use ${env:%s:-default})", field, name, name)
+				}
+				return ref
+			}
+			res = append(res, ip)
+			return ip.Value
+		})
+		if err != nil {
+			return err
+		}
+
+		// A plain value that consists of a single reference only should be resolved as if the value had
+		// been written there, e.g. to allow booleans or numbers.
+		if n.Style == 0 && whole != nil && whole[0] == 0 && whole[1] == len(n.Value) {
+			n.Tag = ""
+		}
+		n.Value = val
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func walkInterpolationNodes(n *yaml.Node, field string, f func(field string, n *yaml.Node) error) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			err := walkInterpolationNodes(c, field, f)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if field != "" {
+				key = field + "." + key
+			}
+			err := walkInterpolationNodes(n.Content[i+1], key, f)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			err := walkInterpolationNodes(c, fmt.Sprintf("%s[%d]", field, i), f)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return f(field, n)
+	}
+	return nil
+}
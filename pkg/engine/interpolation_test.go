@@ -0,0 +1,124 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	env := map[string]string{
+		"BUCKET": "my-bucket",
+		"EMPTY":  "",
+		"SLSA":   "true",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		Name           string
+		YAML           string
+		Expectation    Application
+		Interpolations []EnvInterpolation
+		Error          bool
+	}{
+		{
+			Name: "set, default and empty",
+			YAML: "defaultArgs:\n  bucket: ${env:BUCKET:-other}\n  region: ${env:REGION:-eu}\n  empty: ${env:EMPTY:-fallback}\n",
+			Expectation: Application{ArgumentDefaults: map[string]string{
+				"bucket": "my-bucket",
+				"region": "eu",
+				"empty":  "fallback",
+			}},
+			Interpolations: []EnvInterpolation{
+				{Field: "defaultArgs.bucket", Variable: "BUCKET", Value: "my-bucket"},
+				{Field: "defaultArgs.region", Variable: "REGION", Value: "eu", Default: true},
+				{Field: "defaultArgs.empty", Variable: "EMPTY", Value: "fallback", Default: true},
+			},
+		},
+		{
+			Name:        "embedded reference",
+			YAML:        "provenance:\n  key: \"/keys/${env:BUCKET}.pem\"\n",
+			Expectation: Application{Provenance: ApplicationProvenance{KeyPath: "/keys/my-bucket.pem"}},
+			Interpolations: []EnvInterpolation{
+				{Field: "provenance.key", Variable: "BUCKET", Value: "my-bucket"},
+			},
+		},
+		{
+			Name:        "non-string field",
+			YAML:        "provenance:\n  slsa: ${env:SLSA:-false}\n",
+			Expectation: Application{Provenance: ApplicationProvenance{SLSA: true}},
+			Interpolations: []EnvInterpolation{
+				{Field: "provenance.slsa", Variable: "SLSA", Value: "true"},
+			},
+		},
+		{
+			Name:  "unset without default",
+			YAML:  "defaultArgs:\n  foo: ${env:DOES_NOT_EXIST}\n",
+			Error: true,
+		},
+		{
+			Name:        "build arguments are left alone",
+			YAML:        "defaultArgs:\n  foo: ${bar}\n",
+			Expectation: Application{ArgumentDefaults: map[string]string{"foo": "${bar}"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var doc yaml.Node
+			err := yaml.Unmarshal([]byte(test.YAML), &doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ips, err := interpolateEnv(&doc, lookup)
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Interpolations, ips); diff != "" {
+				t.Errorf("interpolations mismatch (-want +got):\n%s", diff)
+			}
+
+			var act Application
+			err = doc.Decode(&act)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation.ArgumentDefaults, act.ArgumentDefaults); diff != "" {
+				t.Errorf("defaultArgs mismatch (-want +got):\n%s", diff)
+			}
+			if test.Expectation.Provenance.KeyPath != act.Provenance.KeyPath || test.Expectation.Provenance.SLSA != act.Provenance.SLSA {
+				t.Errorf("provenance mismatch: expected %+v, got %+v", test.Expectation.Provenance, act.Provenance)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BuildFailure is a package whose build failed
+type BuildFailure struct {
+	Package string
+	Err     error
+}
+
+// BuildFailuresErr is returned by builds which kept going after a package build failed. It lists all packages
+// whose build failed, but not the packages which were not built because one of their dependencies failed.
+type BuildFailuresErr struct {
+	Failures []BuildFailure
+}
+
+func (e BuildFailuresErr) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("%s (%v)", f.Package, f.Err))
+	}
+	if len(msgs) == 1 {
+		return "1 package failed: " + msgs[0]
+	}
+	return fmt.Sprintf("%d packages failed: %s", len(msgs), strings.Join(msgs, ", "))
+}
+
+// recordFailure remembers that the build of a package failed, s.t. packages which depend on it do not
+// try to build it again
+func (c *buildContext) recordFailure(p *Package, err error) {
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures == nil {
+		c.failures = make(map[*Package]error)
+	}
+	c.failures[p] = err
+}
+
+// failure returns the error the build of a package failed with, or nil if it did not fail
+func (c *buildContext) failure(p *Package) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failures[p]
+}
+
+// failuresErr returns a BuildFailuresErr if any package build failed, or nil otherwise
+func (c *buildContext) failuresErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failures) == 0 {
+		return nil
+	}
+
+	res := BuildFailuresErr{Failures: make([]BuildFailure, 0, len(c.failures))}
+	for p, err := range c.failures {
+		res.Failures = append(res.Failures, BuildFailure{Package: p.FullName(), Err: err})
+	}
+	sort.Slice(res.Failures, func(i, j int) bool { return res.Failures[i].Package < res.Failures[j].Package })
+	return res
+}
+
+// WithKeepGoing keeps building all packages whose dependencies were built once a package build failed,
+// instead of stopping the build. The build then fails with a BuildFailuresErr listing all failed packages.
+func WithKeepGoing(keepGoing bool) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.KeepGoing = keepGoing
+		return nil
+	}
+}
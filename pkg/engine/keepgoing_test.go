@@ -0,0 +1,61 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeepGoing(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	pkg := func(name string, cmd string, deps ...*Package) *Package {
+		p := testPackage(&Application{}, name, GenericPackage, deps...)
+		p.Config = GenericPkgConfig{Commands: [][]string{{"sh", "-c", cmd}}}
+		return p
+	}
+	var (
+		broken    = pkg("broken", "exit 1")
+		healthy   = pkg("healthy", "true")
+		dependent = pkg("dependent", "true", broken)
+		target    = pkg("target", "true", dependent, healthy, broken)
+	)
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Build(target, WithLocalCache(cache), WithReporter(NewMetricsReporter(cache)), WithKeepGoing(true))
+	var failures BuildFailuresErr
+	if !errors.As(err, &failures) {
+		t.Fatalf("expected build failures, got %v", err)
+	}
+	if len(failures.Failures) != 1 || failures.Failures[0].Package != broken.FullName() {
+		t.Errorf("unexpected build failures: %v", failures)
+	}
+	if _, built := cache.Location(healthy); !built {
+		t.Errorf("expected %s to be built", healthy.FullName())
+	}
+	if _, built := cache.Location(dependent); built {
+		t.Errorf("expected %s not to be built", dependent.FullName())
+	}
+}
@@ -0,0 +1,148 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// layerCacheObjectSuffix is appended to the filesystem safe name of a package to name its layer cache in the remote cache
+	layerCacheObjectSuffix = ".layer-cache.tar.gz"
+
+	// layerCacheExportSuffix is appended to the layer cache directory of a package to name the directory BuildKit
+	// exports the new cache to. BuildKit never removes blobs from a local cache, hence exporting into the directory
+	// we imported from would grow the cache with every build.
+	layerCacheExportSuffix = ".export"
+)
+
+// layerCacheDir returns the directory the BuildKit layer cache of the package is kept in
+func (p *Package) layerCacheDir(buildctx *buildContext) string {
+	return filepath.Join(buildctx.BuildKit.CacheDir, p.FilesystemSafeName())
+}
+
+// layerCacheStore returns the remote cache the layer cache is stored in, or nil if it is not stored remotely
+func (buildctx *buildContext) layerCacheStore() objectStore {
+	if buildctx.BuildKit.Cache != BuildKitCacheRemote {
+		return nil
+	}
+	store, _ := buildctx.BuildKit.Remote.(objectStore)
+	return store
+}
+
+// downloadLayerCache downloads the layer cache of the package from the remote cache unless it is available locally.
+// Like all remote cache transfers this is best effort: if there is no layer cache, the image is built without one.
+func (p *Package) downloadLayerCache(buildctx *buildContext) {
+	store := buildctx.layerCacheStore()
+	if store == nil || buildctx.BuildKit.RemoteLevel == CacheRemotePush {
+		return
+	}
+	dir := p.layerCacheDir(buildctx)
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-layer-cache-*")
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot download layer cache")
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	fn := filepath.Join(tmpdir, "cache.tar.gz")
+	store.getObjects(map[string]string{p.FilesystemSafeName() + layerCacheObjectSuffix: fn})
+	if _, err := os.Stat(fn); err != nil {
+		log.WithField("package", p.FullName()).Debug("no layer cache in remote cache")
+		return
+	}
+
+	err = extractLayerCache(fn, dir)
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot extract layer cache")
+		os.RemoveAll(dir)
+		return
+	}
+	log.WithField("package", p.FullName()).Debug("downloaded layer cache")
+}
+
+// uploadLayerCache replaces the layer cache of the package with the one the build just exported and
+// uploads it to the remote cache. Failing to upload the layer cache does not fail the build.
+func (p *Package) uploadLayerCache(buildctx *buildContext) {
+	store := buildctx.layerCacheStore()
+	if store == nil {
+		return
+	}
+	dir := p.layerCacheDir(buildctx)
+	export := dir + layerCacheExportSuffix
+	if _, err := os.Stat(filepath.Join(export, "index.json")); err != nil {
+		log.WithField("package", p.FullName()).Debug("build exported no layer cache")
+		return
+	}
+	err := os.RemoveAll(dir)
+	if err == nil {
+		err = os.Rename(export, dir)
+	}
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot store layer cache")
+		return
+	}
+	if buildctx.BuildKit.RemoteLevel == CacheRemotePull {
+		return
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-layer-cache-*")
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot upload layer cache")
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	fn := filepath.Join(tmpdir, "cache.tar.gz")
+	out, err := exec.Command("tar", "czf", fn, "-C", dir, ".").CombinedOutput()
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).WithField("output", string(out)).Warn("cannot archive layer cache")
+		return
+	}
+	store.putObjects(map[string]string{p.FilesystemSafeName() + layerCacheObjectSuffix: fn})
+	log.WithField("package", p.FullName()).Debug("uploaded layer cache")
+}
+
+func extractLayerCache(fn, dir string) error {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("tar", "xzf", fn, "-C", dir).CombinedOutput()
+	if err != nil {
+		return xerrors.Errorf("%w: %s", err, string(out))
+	}
+	return nil
+}
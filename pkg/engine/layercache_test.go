@@ -0,0 +1,115 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirObjectStore is a remote cache which stores objects in a directory
+type dirObjectStore struct {
+	NoRemoteCache
+	Dir string
+}
+
+func (s dirObjectStore) getObjects(objs map[string]string) {
+	for name, fn := range objs {
+		fc, err := ioutil.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			continue
+		}
+		_ = ioutil.WriteFile(fn, fc, 0644)
+	}
+}
+
+func (s dirObjectStore) listObjects(prefix string) ([]string, error) {
+	fns, err := filepath.Glob(filepath.Join(s.Dir, prefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(fns))
+	for _, fn := range fns {
+		res = append(res, filepath.Base(fn))
+	}
+	return res, nil
+}
+
+func (s dirObjectStore) putObjects(objs map[string]string) {
+	for name, fn := range objs {
+		fc, err := ioutil.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		_ = ioutil.WriteFile(filepath.Join(s.Dir, name), fc, 0644)
+	}
+}
+
+func TestLayerCacheRoundTrip(t *testing.T) {
+	store := dirObjectStore{Dir: t.TempDir()}
+	pkg := &Package{
+		C:               &Component{Name: "comp"},
+		packageInternal: packageInternal{Name: "img", Type: DockerPackage},
+	}
+	newBuildContext := func(level CacheLevel) *buildContext {
+		return &buildContext{buildOptions: buildOptions{BuildKit: BuildKitOptions{
+			Cache:       BuildKitCacheRemote,
+			CacheDir:    t.TempDir(),
+			Remote:      store,
+			RemoteLevel: level,
+		}}}
+	}
+
+	// the first runner builds the package and uploads the layer cache BuildKit exported
+	first := newBuildContext(CacheRemote)
+	export := pkg.layerCacheDir(first) + layerCacheExportSuffix
+	err := os.MkdirAll(filepath.Join(export, "blobs"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(export, "index.json"), []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.uploadLayerCache(first)
+	if _, err := os.Stat(export); !os.IsNotExist(err) {
+		t.Errorf("export directory was not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "comp--img"+layerCacheObjectSuffix)); err != nil {
+		t.Fatalf("layer cache was not uploaded: %v", err)
+	}
+
+	// a fresh runner downloads the layer cache before building
+	second := newBuildContext(CacheRemotePull)
+	pkg.downloadLayerCache(second)
+	if _, err := os.Stat(filepath.Join(pkg.layerCacheDir(second), "index.json")); err != nil {
+		t.Errorf("layer cache was not downloaded: %v", err)
+	}
+
+	// push-only runners never download the layer cache
+	third := newBuildContext(CacheRemotePush)
+	pkg.downloadLayerCache(third)
+	if _, err := os.Stat(pkg.layerCacheDir(third)); !os.IsNotExist(err) {
+		t.Errorf("push-only runner downloaded the layer cache: %v", err)
+	}
+}
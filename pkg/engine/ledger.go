@@ -0,0 +1,536 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+
+	"github.com/bhojpur/gorpa/pkg/version"
+)
+
+// LedgerRecord describes a single build invocation in the ledger
+type LedgerRecord struct {
+	Time         time.Time     `json:"time"`
+	User         string        `json:"user"`
+	Host         string        `json:"host,omitempty"`
+	GorpaVersion string        `json:"gorpaVersion"`
+	Repository   string        `json:"repository,omitempty"`
+	Commit       string        `json:"commit,omitempty"`
+	Target       string        `json:"target"`
+	Version      string        `json:"version,omitempty"`
+	Duration     time.Duration `json:"duration"`
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+	Cache        LedgerCache   `json:"cache"`
+	// Packages lists the packages which were built (or failed to build) during the invocation
+	Packages []LedgerPackage `json:"packages,omitempty"`
+}
+
+// LedgerCache counts how the packages of a build invocation were satisfied
+type LedgerCache struct {
+	// Local packages were found in the local cache
+	Local int `json:"local"`
+	// Remote packages were downloaded from a remote cache
+	Remote  int `json:"remote"`
+	Built   int `json:"built"`
+	Failed  int `json:"failed,omitempty"`
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// LedgerPackage records the build of a package in the ledger
+type LedgerPackage struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Duration time.Duration `json:"duration"`
+	Success  bool          `json:"success"`
+}
+
+// Ledger keeps a record of build invocations
+type Ledger interface {
+	// Append adds a record to the ledger
+	Append(rec LedgerRecord) error
+	// Read returns all records of invocations since the given time, oldest first
+	Read(since time.Time) ([]LedgerRecord, error)
+}
+
+// FileLedger appends records as JSON lines to a local file
+type FileLedger struct {
+	Path string
+}
+
+// Append adds a record to the ledger
+func (l FileLedger) Append(rec LedgerRecord) error {
+	fc, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(l.Path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(fc, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns all records of invocations since the given time, oldest first
+func (l FileLedger) Read(since time.Time) ([]LedgerRecord, error) {
+	fc, err := ioutil.ReadFile(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseLedger(fc, since)
+}
+
+// ledgerObjectPrefix starts the names of the ledger objects in a remote cache, e.g. gorpa-ledger-2006-01-02-<id>.json
+const ledgerObjectPrefix = "gorpa-ledger-"
+
+// objectLister is implemented by remote caches which can list the objects they store
+type objectLister interface {
+	// listObjects returns the names of all objects whose name starts with prefix
+	listObjects(prefix string) ([]string, error)
+}
+
+// NewRemoteLedger keeps the ledger in a remote cache, next to the build artifacts
+func NewRemoteLedger(rc RemoteCache) (*RemoteLedger, error) {
+	store, ok := rc.(objectStore)
+	if !ok {
+		return nil, xerrors.Errorf("remote cache %T cannot store a ledger", rc)
+	}
+	lister, ok := rc.(objectLister)
+	if !ok {
+		return nil, xerrors.Errorf("remote cache %T cannot list the objects of a ledger", rc)
+	}
+	return &RemoteLedger{store: store, lister: lister}, nil
+}
+
+// RemoteLedger keeps one object per invocation in a remote cache, s.t. concurrent invocations never
+// overwrite each other's records. Reading the ledger lists and merges the objects of each day.
+type RemoteLedger struct {
+	store  objectStore
+	lister objectLister
+}
+
+func ledgerDayPrefix(t time.Time) string {
+	return ledgerObjectPrefix + t.UTC().Format("2006-01-02") + "-"
+}
+
+// Append adds a record to the ledger
+func (l *RemoteLedger) Append(rec LedgerRecord) error {
+	dir, err := ioutil.TempDir("", "gorpa-ledger")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	id := make([]byte, 8)
+	_, err = rand.Read(id)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s%d-%s.json", ledgerDayPrefix(rec.Time), rec.Time.UnixNano(), hex.EncodeToString(id))
+	fn := filepath.Join(dir, name)
+	err = FileLedger{Path: fn}.Append(rec)
+	if err != nil {
+		return err
+	}
+	l.store.putObjects(map[string]string{name: fn})
+	return nil
+}
+
+// Read returns all records of invocations since the given time, oldest first
+func (l *RemoteLedger) Read(since time.Time) ([]LedgerRecord, error) {
+	dir, err := ioutil.TempDir("", "gorpa-ledger")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	objs := make(map[string]string)
+	for day := since.UTC().Truncate(24 * time.Hour); !day.After(time.Now()); day = day.Add(24 * time.Hour) {
+		names, err := l.lister.listObjects(ledgerDayPrefix(day))
+		if err != nil {
+			return nil, xerrors.Errorf("cannot list ledger objects: %w", err)
+		}
+		for _, name := range names {
+			objs[name] = filepath.Join(dir, name)
+		}
+	}
+	l.store.getObjects(objs)
+
+	var res []LedgerRecord
+	for _, fn := range objs {
+		fc, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		recs, err := parseLedger(fc, since)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, recs...)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res, nil
+}
+
+// listObjectsWith lists the objects of a remote cache with the timeout and retries of its transfers.
+// A prefix which matches no objects is no error.
+func listObjectsWith(opts TransferOptions, prefix string, list func(ctx context.Context, prefix string) ([]string, error)) (res []string, err error) {
+	err = transferFileWithRetry(opts, fileTransfer{Src: prefix}, func(ctx context.Context, prefix, _ string) error {
+		names, err := list(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		res = names
+		return nil
+	})
+	if err == ErrTransferNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// parseObjectList parses the output of a command which lists one object path or URL per line
+func parseObjectList(out, prefix string) []string {
+	var res []string
+	for _, line := range strings.Split(out, "\n") {
+		name := path.Base(strings.TrimSpace(line))
+		if !strings.HasPrefix(name, prefix) || !cacheObjectName.MatchString(name) {
+			continue
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+func (rs GSUtilRemoteCache) listObjects(prefix string) ([]string, error) {
+	return listObjectsWith(rs.Transfer, prefix, func(ctx context.Context, prefix string) ([]string, error) {
+		out, err := statCommandOutput(ctx, []string{"matched no objects", "No URLs matched"}, "gsutil", "ls", fmt.Sprintf("gs://%s/%s*", rs.BucketName, prefix))
+		if err != nil {
+			return nil, err
+		}
+		return parseObjectList(out, prefix), nil
+	})
+}
+
+func (rs SSHRemoteCache) listObjects(prefix string) ([]string, error) {
+	host, dir := rs.splitLocation()
+	return listObjectsWith(rs.Transfer, prefix, func(ctx context.Context, prefix string) ([]string, error) {
+		var (
+			out string
+			err error
+		)
+		if rs.Protocol == SSHProtocolSFTP {
+			args := append(append([]string{"-q", "-b", "-"}, rs.SSHOptions...), host)
+			out, err = statCommandOutputWithInput(ctx, sftpNotFound, strings.NewReader(fmt.Sprintf("ls -1 %q\n", path.Join(dir, prefix+"*"))), "sftp", args...)
+		} else {
+			// ssh passes the command to the remote shell, hence the pattern must be quoted
+			args := append(append([]string{}, rs.SSHOptions...), host, shellJoin("find", dir, "-maxdepth", "1", "-type", "f", "-name", prefix+"*"))
+			out, err = statCommandOutput(ctx, []string{"No such file or directory"}, "ssh", args...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseObjectList(out, prefix), nil
+	})
+}
+
+func (rs MinioRemoteCache) listObjects(prefix string) ([]string, error) {
+	client, err := rs.Config.newClient()
+	if err != nil {
+		return nil, err
+	}
+	return listObjectsWith(rs.Transfer, prefix, func(ctx context.Context, prefix string) ([]string, error) {
+		var res []string
+		for obj := range client.ListObjects(ctx, rs.BucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+			if obj.Err != nil {
+				return nil, obj.Err
+			}
+			res = append(res, obj.Key)
+		}
+		return res, nil
+	})
+}
+
+func parseLedger(fc []byte, since time.Time) ([]LedgerRecord, error) {
+	var (
+		res     []LedgerRecord
+		scanner = bufio.NewScanner(bytes.NewReader(fc))
+	)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec LedgerRecord
+		err := json.Unmarshal(line, &rec)
+		if err != nil {
+			// a record which was cut short must not render the whole ledger unreadable
+			log.WithError(err).Warn("skipping invalid ledger record")
+			continue
+		}
+		if rec.Time.Before(since) {
+			continue
+		}
+		res = append(res, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewLedgerReporter produces a reporter which appends a record of every build to the ledger.
+// Cached artifacts whose origin was recorded after the reporter was created count as downloads.
+func NewLedgerReporter(ledger Ledger, cache Cache) *LedgerReporter {
+	return &LedgerReporter{
+		Ledger:  ledger,
+		Cache:   cache,
+		created: time.Now(),
+		started: make(map[string]time.Time),
+	}
+}
+
+// LedgerReporter records build invocations in a ledger. Use NewLedgerReporter to create an instance.
+type LedgerReporter struct {
+	Ledger Ledger
+	Cache  Cache
+
+	mu      sync.Mutex
+	created time.Time
+	record  LedgerRecord
+	started map[string]time.Time
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *LedgerReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var username string
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	} else {
+		username = os.Getenv("USER")
+	}
+	host, _ := os.Hostname()
+
+	r.record = LedgerRecord{
+		Time:         time.Now().UTC(),
+		User:         username,
+		Host:         host,
+		GorpaVersion: version.Version,
+		Repository:   pkg.C.W.Git.Origin,
+		Commit:       pkg.C.W.Git.Commit,
+		Target:       pkg.FullName(),
+	}
+	r.record.Version, _ = pkg.Version()
+	r.started = make(map[string]time.Time)
+
+	for p, s := range status {
+		switch s {
+		case PackageSkipped:
+			r.record.Cache.Skipped++
+		case PackageBuilt:
+			fn, exists := r.Cache.Location(p)
+			if !exists {
+				continue
+			}
+			origin, err := ReadArtifactOrigin(fn)
+			if err == nil && origin.Source == ArtifactDownloaded && !origin.Time.Before(r.created) {
+				r.record.Cache.Remote++
+			} else {
+				r.record.Cache.Local++
+			}
+		}
+	}
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *LedgerReporter) BuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := r.record
+	rec.Duration = time.Since(rec.Time)
+	rec.Success = err == nil
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	sort.Slice(rec.Packages, func(i, j int) bool { return rec.Packages[i].Name < rec.Packages[j].Name })
+
+	// the ledger is for statistics only - failing to append to it must not fail the build
+	aerr := r.Ledger.Append(rec)
+	if aerr != nil {
+		log.WithError(aerr).Warn("cannot append to build ledger")
+	}
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *LedgerReporter) PackageBuildStarted(pkg *Package) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started[pkg.FullName()] = time.Now()
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *LedgerReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *LedgerReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := LedgerPackage{Name: pkg.FullName(), Success: err == nil}
+	p.Version, _ = pkg.Version()
+	if t, ok := r.started[p.Name]; ok {
+		p.Duration = time.Since(t)
+	}
+	r.record.Packages = append(r.record.Packages, p)
+	if err != nil {
+		r.record.Cache.Failed++
+	} else {
+		r.record.Cache.Built++
+	}
+}
+
+// LedgerSummary aggregates the records of a ledger
+type LedgerSummary struct {
+	Since         time.Time     `json:"since" yaml:"since"`
+	Invocations   int           `json:"invocations" yaml:"invocations"`
+	Failures      int           `json:"failures" yaml:"failures"`
+	TotalDuration time.Duration `json:"totalDuration" yaml:"totalDuration"`
+	Cache         LedgerCache   `json:"cache" yaml:"cache"`
+	// CacheHitRate is the share of the packages which did not need building because they were cached locally or remotely
+	CacheHitRate float64       `json:"cacheHitRate" yaml:"cacheHitRate"`
+	Users        []LedgerUsage `json:"users" yaml:"users"`
+	Hosts        []LedgerUsage `json:"hosts" yaml:"hosts"`
+	Targets      []LedgerUsage `json:"targets" yaml:"targets"`
+	Versions     []LedgerUsage `json:"gorpaVersions" yaml:"gorpaVersions"`
+}
+
+// LedgerUsage summarises the invocations of a user, host, target or Bhojpur GoRPA version
+type LedgerUsage struct {
+	Name        string        `json:"name" yaml:"name"`
+	Invocations int           `json:"invocations" yaml:"invocations"`
+	Failures    int           `json:"failures" yaml:"failures"`
+	Duration    time.Duration `json:"duration" yaml:"duration"`
+}
+
+// SummarizeLedger aggregates ledger records. Usages are sorted by the number of invocations, most first.
+func SummarizeLedger(since time.Time, recs []LedgerRecord) LedgerSummary {
+	var (
+		res      = LedgerSummary{Since: since}
+		users    = make(map[string]*LedgerUsage)
+		hosts    = make(map[string]*LedgerUsage)
+		targets  = make(map[string]*LedgerUsage)
+		versions = make(map[string]*LedgerUsage)
+	)
+	count := func(idx map[string]*LedgerUsage, name string, rec LedgerRecord) {
+		u, ok := idx[name]
+		if !ok {
+			u = &LedgerUsage{Name: name}
+			idx[name] = u
+		}
+		u.Invocations++
+		if !rec.Success {
+			u.Failures++
+		}
+		u.Duration += rec.Duration
+	}
+	for _, rec := range recs {
+		res.Invocations++
+		if !rec.Success {
+			res.Failures++
+		}
+		res.TotalDuration += rec.Duration
+		res.Cache.Local += rec.Cache.Local
+		res.Cache.Remote += rec.Cache.Remote
+		res.Cache.Built += rec.Cache.Built
+		res.Cache.Failed += rec.Cache.Failed
+		res.Cache.Skipped += rec.Cache.Skipped
+
+		count(users, rec.User, rec)
+		count(hosts, rec.Host, rec)
+		count(targets, rec.Target, rec)
+		count(versions, rec.GorpaVersion, rec)
+	}
+	if total := res.Cache.Local + res.Cache.Remote + res.Cache.Built + res.Cache.Failed; total > 0 {
+		res.CacheHitRate = float64(res.Cache.Local+res.Cache.Remote) / float64(total)
+	}
+
+	sorted := func(idx map[string]*LedgerUsage) []LedgerUsage {
+		res := make([]LedgerUsage, 0, len(idx))
+		for _, u := range idx {
+			res = append(res, *u)
+		}
+		sort.Slice(res, func(i, j int) bool {
+			if res[i].Invocations != res[j].Invocations {
+				return res[i].Invocations > res[j].Invocations
+			}
+			return res[i].Name < res[j].Name
+		})
+		return res
+	}
+	res.Users = sorted(users)
+	res.Hosts = sorted(hosts)
+	res.Targets = sorted(targets)
+	res.Versions = sorted(versions)
+	return res
+}
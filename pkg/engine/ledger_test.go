@@ -0,0 +1,132 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLedgers(t *testing.T) {
+	remote, err := NewRemoteLedger(dirObjectStore{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewCacheServer(t.TempDir(), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+	server, err := NewRemoteLedger(HTTPRemoteCache{URL: hs.URL, Transfer: TransferOptions{Jobs: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledgers := map[string]Ledger{
+		"file":         FileLedger{Path: filepath.Join(t.TempDir(), "ledger", "ledger.jsonl")},
+		"remote":       remote,
+		"cache server": server,
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	recs := []LedgerRecord{
+		{Time: now.Add(-72 * time.Hour), User: "alice", Target: "comp:old", Success: true},
+		{Time: now.Add(-25 * time.Hour), User: "alice", Target: "comp:app", Success: true, Cache: LedgerCache{Built: 2}},
+		{Time: now.Add(-1 * time.Hour), User: "bob", Target: "comp:app", Error: "build failed", Cache: LedgerCache{Local: 1, Failed: 1}},
+		{Time: now, User: "alice", Target: "comp:lib", Success: true, Cache: LedgerCache{Remote: 1, Local: 1}},
+		// invocations which finish at the same time must not overwrite each other's records
+		{Time: now, User: "bob", Target: "comp:lib", Success: true, Cache: LedgerCache{Local: 2}},
+	}
+	for name, ledger := range ledgers {
+		t.Run(name, func(t *testing.T) {
+			act, err := ledger.Read(now.Add(-48 * time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(act) != 0 {
+				t.Errorf("expected an empty ledger, got %d records", len(act))
+			}
+
+			for _, rec := range recs {
+				err = ledger.Append(rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			act, err = ledger.Read(now.Add(-48 * time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(act, func(i, j int) bool {
+				if !act[i].Time.Equal(act[j].Time) {
+					return act[i].Time.Before(act[j].Time)
+				}
+				return act[i].User < act[j].User
+			})
+			if diff := cmp.Diff(recs[1:], act); diff != "" {
+				t.Errorf("Read() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSummarizeLedger(t *testing.T) {
+	since := time.Now()
+	recs := []LedgerRecord{
+		{User: "alice", Host: "ci", Target: "comp:app", GorpaVersion: "v1", Duration: time.Minute, Success: true, Cache: LedgerCache{Built: 2, Local: 1, Skipped: 1}},
+		{User: "bob", Host: "ci", Target: "comp:app", GorpaVersion: "v1", Duration: time.Second, Cache: LedgerCache{Remote: 1, Failed: 1}},
+		{User: "alice", Host: "laptop", Target: "comp:lib", GorpaVersion: "v2", Duration: time.Second, Success: true, Cache: LedgerCache{Local: 3}},
+	}
+
+	act := SummarizeLedger(since, recs)
+	expectation := LedgerSummary{
+		Since:         since,
+		Invocations:   3,
+		Failures:      1,
+		TotalDuration: time.Minute + 2*time.Second,
+		Cache:         LedgerCache{Local: 4, Remote: 1, Built: 2, Failed: 1, Skipped: 1},
+		CacheHitRate:  0.625,
+		Users: []LedgerUsage{
+			{Name: "alice", Invocations: 2, Duration: time.Minute + time.Second},
+			{Name: "bob", Invocations: 1, Failures: 1, Duration: time.Second},
+		},
+		Hosts: []LedgerUsage{
+			{Name: "ci", Invocations: 2, Failures: 1, Duration: time.Minute + time.Second},
+			{Name: "laptop", Invocations: 1, Duration: time.Second},
+		},
+		Targets: []LedgerUsage{
+			{Name: "comp:app", Invocations: 2, Failures: 1, Duration: time.Minute + time.Second},
+			{Name: "comp:lib", Invocations: 1, Duration: time.Second},
+		},
+		Versions: []LedgerUsage{
+			{Name: "v1", Invocations: 2, Failures: 1, Duration: time.Minute + time.Second},
+			{Name: "v2", Invocations: 1, Duration: time.Second},
+		},
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("SummarizeLedger() mismatch (-want +got):\n%s", diff)
+	}
+}
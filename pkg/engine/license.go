@@ -0,0 +1,121 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// licenseFilenames are the files we look for when determining the license of a component
+var licenseFilenames = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "LICENCE.md", "COPYING"}
+
+// licenseMarkers identify a license by phrases of its text. The first entry all of whose phrases are found wins,
+// hence more specific licenses have to come first.
+var licenseMarkers = []struct {
+	ID      string
+	Phrases []string
+}{
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"AGPL-3.0", []string{"gnu affero general public license"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+}
+
+// License describes the license a package is distributed under
+type License struct {
+	// ID is the SPDX identifier of the license, or empty if we could not identify it
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// File is the license file relative to the application root, if the license was found in a file
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// License determines the license of a package. Yarn packages use the license field of their package.json.
+// Otherwise the nearest license file in the component directory or one of its parents within the application
+// is identified by its text. Returns nil if no license could be found.
+func (p *Package) License() (*License, error) {
+	if p.Type == YarnPackage {
+		fc, err := ioutil.ReadFile(filepath.Join(p.C.Origin, "package.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var pkgjson struct {
+				License string `json:"license"`
+			}
+			if err := json.Unmarshal(fc, &pkgjson); err == nil && pkgjson.License != "" {
+				return &License{ID: pkgjson.License}, nil
+			}
+		}
+	}
+
+	root := p.C.W.Origin
+	for dir := p.C.Origin; ; dir = filepath.Dir(dir) {
+		for _, n := range licenseFilenames {
+			fn := filepath.Join(dir, n)
+			fc, err := ioutil.ReadFile(fn)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			res := &License{ID: identifyLicense(string(fc)), File: fn}
+			if rel, err := filepath.Rel(root, fn); err == nil {
+				res.File = rel
+			}
+			return res, nil
+		}
+
+		if dir == root || !strings.HasPrefix(dir, root) || filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
+
+// identifyLicense returns the SPDX identifier of a license text, or an empty string if the text is unknown
+func identifyLicense(text string) string {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	for _, m := range licenseMarkers {
+		found := true
+		for _, phrase := range m.Phrases {
+			if !strings.Contains(text, phrase) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return m.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Expected string
+	}{
+		{"MIT License\n\nPermission is hereby granted, free of\n charge, to any person", "MIT"},
+		{"Apache License\n Version 2.0, January 2004", "Apache-2.0"},
+		{"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007", "LGPL-3.0"},
+		{"GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007", "GPL-3.0"},
+		{"Redistribution and use in source and binary forms ... Neither the name of", "BSD-3-Clause"},
+		{"All rights reserved.", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.Expected, func(t *testing.T) {
+			act := identifyLicense(test.Text)
+			if act != test.Expected {
+				t.Errorf("expected %q, got %q", test.Expected, act)
+			}
+		})
+	}
+}
+
+func TestPackageLicense(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "comp", "yarn"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "LICENSE"), []byte("Permission is hereby granted, free of charge"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "comp", "yarn", "package.json"), []byte(`{"license":"Apache-2.0"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := NewTestPackage("pkg")
+	pkg.C.W.Origin = root
+	pkg.C.Origin = filepath.Join(root, "comp")
+	lic, err := pkg.License()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lic == nil || lic.ID != "MIT" || lic.File != "LICENSE" {
+		t.Errorf("expected MIT license from the application root, got %+v", lic)
+	}
+
+	pkg.Type = YarnPackage
+	pkg.C.Origin = filepath.Join(root, "comp", "yarn")
+	lic, err = pkg.License()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lic == nil || lic.ID != "Apache-2.0" || lic.File != "" {
+		t.Errorf("expected Apache-2.0 license from package.json, got %+v", lic)
+	}
+}
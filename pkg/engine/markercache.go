@@ -0,0 +1,95 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// markerCache remembers facts about package versions, e.g. that their lint or tests passed, using marker files
+// named <version><suffix> in a directory. A markerCache without directory remembers nothing.
+type markerCache struct {
+	Dir string
+	// Name describes what the cache remembers in error messages
+	Name string
+}
+
+func (m markerCache) enabled() bool {
+	return m.Dir != ""
+}
+
+// path returns the name of the marker file of a package version
+func (m markerCache) path(p *Package, suffix string) (string, error) {
+	version, err := p.Version()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(m.Dir, version+suffix), nil
+}
+
+// has returns true if the marker of the package version exists
+func (m markerCache) has(p *Package, suffix string) bool {
+	if !m.enabled() {
+		return false
+	}
+	fn, err := m.path(p, suffix)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(fn)
+	return err == nil
+}
+
+// prepare creates the cache directory and returns the marker file of the package version,
+// s.t. a build command can create the marker
+func (m markerCache) prepare(p *Package, suffix string) (string, error) {
+	err := os.MkdirAll(m.Dir, 0755)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create %s %s: %w", m.Name, m.Dir, err)
+	}
+	return m.path(p, suffix)
+}
+
+// mark writes the marker of the package version
+func (m markerCache) mark(p *Package, suffix string, content []byte) error {
+	fn, err := m.prepare(p, suffix)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, content, 0644)
+}
+
+// unmark removes the marker of the package version if it exists
+func (m markerCache) unmark(p *Package, suffix string) error {
+	fn, err := m.path(p, suffix)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
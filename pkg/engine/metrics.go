@@ -0,0 +1,340 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// metricsDurationBuckets are the upper bounds (in seconds) of the package build duration histogram
+var metricsDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// NewMetricsReporter produces a reporter which collects build metrics in the Prometheus text format.
+// Cached artifacts whose origin was recorded after the reporter was created count as remote cache hits.
+func NewMetricsReporter(cache Cache) *MetricsReporter {
+	return &MetricsReporter{
+		Cache:      cache,
+		Job:        "gorpa",
+		created:    time.Now(),
+		started:    make(map[string]time.Time),
+		builds:     make(map[string]float64),
+		cacheHits:  make(map[string]float64),
+		pkgBuilds:  make(map[metricsPackageKey]float64),
+		durations:  make(map[string]*metricsHistogram),
+		flakyTests: make(map[metricsFlakyKey]float64),
+	}
+}
+
+// MetricsReporter counts cache hits, package builds and their durations, and keeps track of the build queue.
+// It serves the metrics via HTTP and, if PushGateway is set, pushes them to a Prometheus pushgateway
+// once a build has finished. Use NewMetricsReporter to create an instance.
+type MetricsReporter struct {
+	Cache Cache
+	// PushGateway is the URL of the pushgateway the metrics are pushed to, e.g. http://pushgateway:9091
+	PushGateway string
+	// Job is the job label of the pushed metrics
+	Job string
+
+	mu          sync.Mutex
+	created     time.Time
+	started     map[string]time.Time
+	builds      map[string]float64
+	cacheHits   map[string]float64
+	cacheMisses float64
+	pkgBuilds   map[metricsPackageKey]float64
+	durations   map[string]*metricsHistogram
+	queued      int
+	running     int
+	flakyTests  map[metricsFlakyKey]float64
+}
+
+type metricsFlakyKey struct {
+	Type        PackageType
+	Quarantined bool
+}
+
+type metricsPackageKey struct {
+	Type   PackageType
+	Result string
+}
+
+type metricsHistogram struct {
+	Counts []float64
+	Sum    float64
+	Count  float64
+}
+
+func (h *metricsHistogram) observe(v float64) {
+	for i, le := range metricsDurationBuckets {
+		if v <= le {
+			h.Counts[i]++
+		}
+	}
+	h.Sum += v
+	h.Count++
+}
+
+func metricsResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *MetricsReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queued = 0
+	r.running = 0
+	for p, s := range status {
+		switch s {
+		case PackageNotBuiltYet:
+			r.queued++
+			r.cacheMisses++
+		case PackageBuilt:
+			source := "local"
+			if fn, exists := r.Cache.Location(p); exists {
+				origin, err := ReadArtifactOrigin(fn)
+				if err == nil && origin.Source == ArtifactDownloaded && !origin.Time.Before(r.created) {
+					source = "remote"
+				}
+			}
+			r.cacheHits[source]++
+		}
+	}
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *MetricsReporter) BuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	r.builds[metricsResult(err)]++
+	r.queued = 0
+	r.running = 0
+	r.mu.Unlock()
+
+	if r.PushGateway == "" {
+		return
+	}
+	// metrics are for monitoring only - failing to push them must not fail the build
+	perr := r.Push()
+	if perr != nil {
+		log.WithError(perr).Warn("cannot push build metrics")
+	}
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *MetricsReporter) PackageBuildStarted(pkg *Package) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.queued > 0 {
+		r.queued--
+	}
+	r.running++
+	r.started[pkg.FullName()] = time.Now()
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *MetricsReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *MetricsReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running > 0 {
+		r.running--
+	}
+	r.pkgBuilds[metricsPackageKey{Type: pkg.Type, Result: metricsResult(err)}]++
+
+	start, ok := r.started[pkg.FullName()]
+	if !ok {
+		return
+	}
+	delete(r.started, pkg.FullName())
+	h, ok := r.durations[string(pkg.Type)]
+	if !ok {
+		h = &metricsHistogram{Counts: make([]float64, len(metricsDurationBuckets))}
+		r.durations[string(pkg.Type)] = h
+	}
+	h.observe(time.Since(start).Seconds())
+}
+
+// PackageTestsFlaky is called when the tests of a package turned out to be flaky.
+func (r *MetricsReporter) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.flakyTests[metricsFlakyKey{Type: pkg.Type, Quarantined: quarantined}]++
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (r *MetricsReporter) WriteTo(out io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	header := func(name, tpe, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, tpe)
+	}
+
+	header("gorpa_builds_total", "counter", "Builds started by the user, by result.")
+	for _, res := range sortedMetricsKeys(r.builds) {
+		fmt.Fprintf(&buf, "gorpa_builds_total%s %s\n", metricsLabels("result", res), formatMetric(r.builds[res]))
+	}
+
+	header("gorpa_cache_hits_total", "counter", "Packages which did not need building because they were cached, by cache.")
+	for _, src := range sortedMetricsKeys(r.cacheHits) {
+		fmt.Fprintf(&buf, "gorpa_cache_hits_total%s %s\n", metricsLabels("cache", src), formatMetric(r.cacheHits[src]))
+	}
+
+	header("gorpa_cache_misses_total", "counter", "Packages which had to be built because they were not cached.")
+	fmt.Fprintf(&buf, "gorpa_cache_misses_total %s\n", formatMetric(r.cacheMisses))
+
+	header("gorpa_package_builds_total", "counter", "Package builds, by package type and result.")
+	keys := make([]metricsPackageKey, 0, len(r.pkgBuilds))
+	for k := range r.pkgBuilds {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Result < keys[j].Result
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "gorpa_package_builds_total%s %s\n", metricsLabels("type", string(k.Type), "result", k.Result), formatMetric(r.pkgBuilds[k]))
+	}
+
+	header("gorpa_package_build_duration_seconds", "histogram", "Duration of package builds, by package type.")
+	tpes := make([]string, 0, len(r.durations))
+	for tpe := range r.durations {
+		tpes = append(tpes, tpe)
+	}
+	sort.Strings(tpes)
+	for _, tpe := range tpes {
+		h := r.durations[tpe]
+		for i, le := range metricsDurationBuckets {
+			fmt.Fprintf(&buf, "gorpa_package_build_duration_seconds_bucket%s %s\n", metricsLabels("type", tpe, "le", formatMetric(le)), formatMetric(h.Counts[i]))
+		}
+		fmt.Fprintf(&buf, "gorpa_package_build_duration_seconds_bucket%s %s\n", metricsLabels("type", tpe, "le", "+Inf"), formatMetric(h.Count))
+		fmt.Fprintf(&buf, "gorpa_package_build_duration_seconds_sum%s %s\n", metricsLabels("type", tpe), formatMetric(h.Sum))
+		fmt.Fprintf(&buf, "gorpa_package_build_duration_seconds_count%s %s\n", metricsLabels("type", tpe), formatMetric(h.Count))
+	}
+
+	header("gorpa_flaky_tests_total", "counter", "Packages whose tests passed on a retry, or failed but are quarantined, by package type.")
+	flaky := make([]metricsFlakyKey, 0, len(r.flakyTests))
+	for k := range r.flakyTests {
+		flaky = append(flaky, k)
+	}
+	sort.Slice(flaky, func(i, j int) bool {
+		if flaky[i].Type != flaky[j].Type {
+			return flaky[i].Type < flaky[j].Type
+		}
+		return !flaky[i].Quarantined && flaky[j].Quarantined
+	})
+	for _, k := range flaky {
+		fmt.Fprintf(&buf, "gorpa_flaky_tests_total%s %s\n", metricsLabels("type", string(k.Type), "quarantined", fmt.Sprint(k.Quarantined)), formatMetric(r.flakyTests[k]))
+	}
+
+	header("gorpa_build_queue_depth", "gauge", "Packages which still have to be built in the current build.")
+	fmt.Fprintf(&buf, "gorpa_build_queue_depth %d\n", r.queued)
+
+	header("gorpa_package_builds_running", "gauge", "Packages which are being built right now.")
+	fmt.Fprintf(&buf, "gorpa_package_builds_running %d\n", r.running)
+
+	return buf.WriteTo(out)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (r *MetricsReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// Push replaces the metrics of the job in the pushgateway
+func (r *MetricsReporter) Push() error {
+	var buf bytes.Buffer
+	_, _ = r.WriteTo(&buf)
+
+	dst := strings.TrimSuffix(r.PushGateway, "/") + "/metrics/job/" + url.PathEscape(r.Job)
+	req, err := http.NewRequest(http.MethodPut, dst, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return xerrors.Errorf("pushgateway %s responded with %s", r.PushGateway, resp.Status)
+	}
+	return nil
+}
+
+func sortedMetricsKeys(m map[string]float64) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// metricsLabelEscaper escapes label values as the Prometheus text exposition format requires
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsLabels formats label name/value pairs, e.g. {type="go",result="success"}
+func metricsLabels(kv ...string) string {
+	var res strings.Builder
+	res.WriteString("{")
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			res.WriteString(",")
+		}
+		res.WriteString(kv[i])
+		res.WriteString(`="`)
+		res.WriteString(metricsLabelEscaper.Replace(kv[i+1]))
+		res.WriteString(`"`)
+	}
+	res.WriteString("}")
+	return res.String()
+}
+
+func formatMetric(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,113 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestMetricsReporter(t *testing.T) {
+	errFailed := xerrors.Errorf("build failed")
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		comp = &Component{Name: "comp", W: &Application{}}
+		lib  = &Package{C: comp, packageInternal: packageInternal{Name: "lib", Type: GoPackage}}
+		app  = &Package{C: comp, packageInternal: packageInternal{Name: "app", Type: DockerPackage}}
+		img  = &Package{C: comp, packageInternal: packageInternal{Name: "img", Type: DockerPackage}}
+	)
+
+	var pushed []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/metrics/job/gorpa" {
+			t.Errorf("unexpected push: %s %s", r.Method, r.URL.Path)
+		}
+		pushed, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	rep := NewMetricsReporter(cache)
+	rep.PushGateway = srv.URL
+	rep.BuildStarted(app, map[*Package]PackageBuildStatus{
+		lib: PackageBuilt,
+		img: PackageNotBuiltYet,
+		app: PackageNotBuiltYet,
+	})
+	rep.PackageBuildStarted(img)
+
+	var buf bytes.Buffer
+	_, _ = rep.WriteTo(&buf)
+	for _, line := range []string{
+		`gorpa_cache_hits_total{cache="local"} 1`,
+		`gorpa_cache_misses_total 2`,
+		`gorpa_build_queue_depth 1`,
+		`gorpa_package_builds_running 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, buf.String())
+		}
+	}
+
+	rep.PackageBuildFinished(img, nil)
+	rep.PackageBuildStarted(app)
+	rep.PackageBuildFinished(app, errFailed)
+	rep.BuildFinished(app, errFailed)
+
+	for _, line := range []string{
+		`gorpa_builds_total{result="failure"} 1`,
+		`gorpa_package_builds_total{type="docker",result="failure"} 1`,
+		`gorpa_package_builds_total{type="docker",result="success"} 1`,
+		`gorpa_package_build_duration_seconds_bucket{type="docker",le="1"} 2`,
+		`gorpa_package_build_duration_seconds_bucket{type="docker",le="+Inf"} 2`,
+		`gorpa_package_build_duration_seconds_count{type="docker"} 2`,
+		`gorpa_build_queue_depth 0`,
+		`gorpa_package_builds_running 0`,
+	} {
+		if !strings.Contains(string(pushed), line+"\n") {
+			t.Errorf("pushed metrics lack %q:\n%s", line, pushed)
+		}
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	tests := []struct {
+		Labels      []string
+		Expectation string
+	}{
+		{Labels: []string{"type", "go"}, Expectation: `{type="go"}`},
+		{Labels: []string{"type", "go", "le", "+Inf"}, Expectation: `{type="go",le="+Inf"}`},
+		{Labels: []string{"cache", "a \"quoted\" back\\slash\nnewline é"}, Expectation: `{cache="a \"quoted\" back\\slash\nnewline é"}`},
+	}
+	for _, test := range tests {
+		if act := metricsLabels(test.Labels...); act != test.Expectation {
+			t.Errorf("metricsLabels(%q): expected %s, got %s", test.Labels, test.Expectation, act)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// dockerPlatformsFile is the name of the file which records the per-platform digests of multi-arch Docker packages
+const dockerPlatformsFile = "imgplatforms.yaml"
+
+// DockerPlatformDigests lists the image digest of each platform of a multi-arch image
+type DockerPlatformDigests struct {
+	// Digest is the digest of the manifest list/image index
+	Digest    string                 `yaml:"digest" json:"digest"`
+	Platforms []DockerPlatformDigest `yaml:"platforms" json:"platforms"`
+}
+
+// DockerPlatformDigest is the image digest of a single platform
+type DockerPlatformDigest struct {
+	Platform string `yaml:"platform" json:"platform"`
+	Digest   string `yaml:"digest" json:"digest"`
+}
+
+// Subjects produces a provenance subject for the manifest list and each platform of each image
+func (d DockerPlatformDigests) Subjects(images []string) ([]in_toto.Subject, error) {
+	res := make([]in_toto.Subject, 0, len(images)*(len(d.Platforms)+1))
+	for _, img := range images {
+		digest, err := parseDigestSet(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, in_toto.Subject{Name: img, Digest: digest})
+
+		for _, p := range d.Platforms {
+			digest, err := parseDigestSet(p.Digest)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, in_toto.Subject{Name: fmt.Sprintf("%s (%s)", img, p.Platform), Digest: digest})
+		}
+	}
+	return res, nil
+}
+
+func parseDigestSet(digest string) (in_toto.DigestSet, error) {
+	segs := strings.Split(digest, ":")
+	if len(segs) != 2 {
+		return nil, xerrors.Errorf("invalid digest: %s", digest)
+	}
+	return in_toto.DigestSet{segs[0]: segs[1]}, nil
+}
+
+// ociIndex is the subset of an OCI image index/Docker manifest list we care about
+type ociIndex struct {
+	Manifests []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Platform  *struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+			Variant      string `json:"variant,omitempty"`
+		} `json:"platform,omitempty"`
+	} `json:"manifests"`
+}
+
+// parsePlatformDigests produces the per-platform digests from the raw content of an image index
+func parsePlatformDigests(raw []byte) (*DockerPlatformDigests, error) {
+	var idx ociIndex
+	err := json.Unmarshal(raw, &idx)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal image index: %w", err)
+	}
+
+	hash := sha256.Sum256(raw)
+	res := &DockerPlatformDigests{Digest: "sha256:" + hex.EncodeToString(hash[:])}
+	for _, m := range idx.Manifests {
+		// BuildKit adds attestation manifests with an unknown platform to the index
+		if m.Platform == nil || m.Platform.OS == "unknown" {
+			continue
+		}
+		platform := m.Platform.OS + "/" + m.Platform.Architecture
+		if m.Platform.Variant != "" {
+			platform += "/" + m.Platform.Variant
+		}
+		res.Platforms = append(res.Platforms, DockerPlatformDigest{Platform: platform, Digest: m.Digest})
+	}
+	if len(res.Platforms) == 0 {
+		return nil, xerrors.Errorf("image index lists no platforms")
+	}
+	return res, nil
+}
+
+// registryPlatformDigests reads the per-platform digests of a pushed image from its registry
+func registryPlatformDigests(image string, env []string) (*DockerPlatformDigests, error) {
+	cmd := exec.Command("docker", "buildx", "imagetools", "inspect", "--raw", image)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot inspect %s: %w", image, err)
+	}
+	return parsePlatformDigests(out)
+}
+
+// ociArchivePlatformDigests reads the per-platform digests from an OCI image archive. The index.json
+// of such an archive points to the image index which lists the platforms.
+func ociArchivePlatformDigests(fn string) (*DockerPlatformDigests, error) {
+	index, err := readTarFile(fn, "index.json")
+	if err != nil {
+		return nil, err
+	}
+	var top ociIndex
+	err = json.Unmarshal(index, &top)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal index.json: %w", err)
+	}
+	if len(top.Manifests) != 1 {
+		return nil, xerrors.Errorf("expected exactly one image index in %s, found %d", fn, len(top.Manifests))
+	}
+
+	segs := strings.Split(top.Manifests[0].Digest, ":")
+	if len(segs) != 2 {
+		return nil, xerrors.Errorf("invalid digest: %s", top.Manifests[0].Digest)
+	}
+	raw, err := readTarFile(fn, filepath.Join("blobs", segs[0], segs[1]))
+	if err != nil {
+		return nil, err
+	}
+	return parsePlatformDigests(raw)
+}
+
+func readTarFile(archive, name string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, xerrors.Errorf("%s not found in %s", name, archive)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(hdr.Name, "./") != name {
+			continue
+		}
+		return ioutil.ReadAll(tr)
+	}
+}
+
+// writeDockerPlatforms records the per-platform digests in the build directory
+func writeDockerPlatforms(wd string, digests *DockerPlatformDigests) error {
+	fc, err := yaml.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(wd, dockerPlatformsFile), fc, 0644)
+}
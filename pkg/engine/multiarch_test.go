@@ -0,0 +1,97 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testImageIndex = `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.oci.image.index.v1+json",
+  "manifests": [
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:aaaa", "platform": {"architecture": "amd64", "os": "linux"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:bbbb", "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:cccc", "platform": {"architecture": "unknown", "os": "unknown"}}
+  ]
+}`
+
+func TestOCIArchivePlatformDigests(t *testing.T) {
+	hash := sha256.Sum256([]byte(testImageIndex))
+	indexDigest := hex.EncodeToString(hash[:])
+
+	fn := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for name, content := range map[string]string{
+		"oci-layout":                  `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json":                  `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.index.v1+json","digest":"sha256:` + indexDigest + `"}]}`,
+		"blobs/sha256/" + indexDigest: testImageIndex,
+	} {
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	f.Close()
+
+	act, err := ociArchivePlatformDigests(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := &DockerPlatformDigests{
+		Digest: "sha256:" + indexDigest,
+		Platforms: []DockerPlatformDigest{
+			{Platform: "linux/amd64", Digest: "sha256:aaaa"},
+			{Platform: "linux/arm64/v8", Digest: "sha256:bbbb"},
+		},
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("ociArchivePlatformDigests() mismatch (-want +got):\n%s", diff)
+	}
+
+	subjects, err := act.Subjects([]string{"registry/app:v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range subjects {
+		names = append(names, s.Name)
+	}
+	if diff := cmp.Diff([]string{"registry/app:v1", "registry/app:v1 (linux/amd64)", "registry/app:v1 (linux/arm64/v8)"}, names); diff != "" {
+		t.Errorf("Subjects() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,254 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// nodeToolchainURL is where pinned Node.js versions are downloaded from
+var nodeToolchainURL = "https://nodejs.org/dist"
+
+// nodeToolchainEnvManifestPrefix prefixes the environment manifest entries of pinned Node.js versions, e.g. node@18.17.1
+const nodeToolchainEnvManifestPrefix = "node@"
+
+const builtinEnvManifestNodeToolchain = "nodetoolchain"
+
+// NodeVersionAuto pins the Node.js version of the .nvmrc of the component or the volta config of the package.json
+const NodeVersionAuto = "auto"
+
+var nodeVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// normaliseNodeVersion accepts versions with and without the "v" prefix, e.g. v18.17.1 and 18.17.1
+func normaliseNodeVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
+
+func validateNodeVersion(version string) error {
+	if !nodeVersionPattern.MatchString(normaliseNodeVersion(version)) {
+		return xerrors.Errorf("invalid Node.js version %q: expected a release like 18.17.1", version)
+	}
+	return nil
+}
+
+// resolveNodeVersion reads the Node.js version a component pins using an .nvmrc or the volta config of its package.json
+func resolveNodeVersion(origin string) (string, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(origin, ".nvmrc"))
+	if err == nil {
+		version := strings.TrimSpace(strings.SplitN(string(fc), "\n", 2)[0])
+		if err := validateNodeVersion(version); err != nil {
+			return "", xerrors.Errorf(".nvmrc: %w", err)
+		}
+		return normaliseNodeVersion(version), nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	fc, err = ioutil.ReadFile(filepath.Join(origin, "package.json"))
+	if err != nil {
+		return "", err
+	}
+	var pkgjson struct {
+		Volta struct {
+			Node string `json:"node"`
+		} `json:"volta"`
+	}
+	err = json.Unmarshal(fc, &pkgjson)
+	if err != nil {
+		return "", xerrors.Errorf("package.json: %w", err)
+	}
+	if pkgjson.Volta.Node == "" {
+		return "", xerrors.Errorf("node: %s requires an .nvmrc or a volta config in the package.json", NodeVersionAuto)
+	}
+	if err := validateNodeVersion(pkgjson.Volta.Node); err != nil {
+		return "", xerrors.Errorf("package.json volta config: %w", err)
+	}
+	return normaliseNodeVersion(pkgjson.Volta.Node), nil
+}
+
+// nodeToolchainEnvManifestEntries produces an environment manifest entry for each Node.js version pinned by a package
+func nodeToolchainEnvManifestEntries(pkgs map[string]*Package) EnvironmentManifest {
+	versions := make(map[string]struct{})
+	for _, p := range pkgs {
+		cfg, ok := p.Config.(YarnPkgConfig)
+		if !ok || cfg.Node == "" {
+			continue
+		}
+		versions[normaliseNodeVersion(cfg.Node)] = struct{}{}
+	}
+
+	res := make(EnvironmentManifest, 0, len(versions))
+	for v := range versions {
+		res = append(res, EnvironmentManifestEntry{
+			Name:    nodeToolchainEnvManifestPrefix + v,
+			Command: []string{builtinEnvManifestNodeToolchain, v},
+			Builtin: true,
+		})
+	}
+	return res
+}
+
+// nodePlatform returns the platform name of Node.js distributions for this machine, e.g. linux-x64
+func nodePlatform() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x64"
+	case "386":
+		arch = "x86"
+	case "arm":
+		arch = "armv7l"
+	}
+	return runtime.GOOS + "-" + arch
+}
+
+// nodeToolchain makes sure the Node.js distribution of the version is in the toolchain cache and returns its directory
+func (c *buildContext) nodeToolchain(p *Package, version string) (home string, err error) {
+	version = normaliseNodeVersion(version)
+	dir := c.NodeToolchainDir
+	if dir == "" {
+		dir = filepath.Join(c.buildDir, "node-toolchains")
+	}
+	home = filepath.Join(dir, "node"+version)
+	if _, err := os.Stat(filepath.Join(home, "bin", "node")); err == nil {
+		return home, nil
+	}
+
+	// packages built concurrently often share a version, which we download only once
+	c.nodeToolchainMu.Lock()
+	defer c.nodeToolchainMu.Unlock()
+	if _, err := os.Stat(filepath.Join(home, "bin", "node")); err == nil {
+		return home, nil
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create Node.js toolchain cache %s: %w", dir, err)
+	}
+	tmpdir, err := ioutil.TempDir(dir, ".node"+version+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	name := fmt.Sprintf("node-v%s-%s", version, nodePlatform())
+	base := fmt.Sprintf("%s/v%s", nodeToolchainURL, version)
+	c.Reporter.PackageBuildLog(p, false, []byte(fmt.Sprintf("downloading Node.js %s/%s.tar.gz\n", base, name)))
+	sum, err := fetchNodeChecksum(base+"/SHASUMS256.txt", name+".tar.gz")
+	if err != nil {
+		return "", err
+	}
+	archive := filepath.Join(tmpdir, "node.tar.gz")
+	err = downloadVerified(base+"/"+name+".tar.gz", sum, archive)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("tar", "xzf", archive, "-C", tmpdir).CombinedOutput()
+	if err != nil {
+		return "", xerrors.Errorf("cannot extract Node.js %s: %w: %s", version, err, string(out))
+	}
+	err = os.Rename(filepath.Join(tmpdir, name), home)
+	if err != nil {
+		return "", xerrors.Errorf("cannot store Node.js %s: %w", version, err)
+	}
+	return home, nil
+}
+
+// fetchNodeChecksum finds the sha256 checksum of a file in the SHASUMS256.txt of a Node.js release
+func fetchNodeChecksum(url, name string) (string, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return "", xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("cannot fetch %s: %s", url, resp.Status)
+	}
+	fc, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", xerrors.Errorf("cannot fetch %s: %w", url, err)
+	}
+	for _, line := range strings.Split(string(fc), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == name && sha256Pattern.MatchString(fields[0]) {
+			return fields[0], nil
+		}
+	}
+	return "", xerrors.Errorf("%s does not contain a sha256 checksum for %s", url, name)
+}
+
+// nodeBinaries are the commands of a Node.js distribution which run the pinned version rather than the one on the PATH
+var nodeBinaries = map[string]struct{}{
+	"node":     {},
+	"npm":      {},
+	"npx":      {},
+	"corepack": {},
+}
+
+// pinNodeToolchain makes the commands of a yarn package build use the Node.js version the package pins.
+// Commands run through sh and scripts like yarn find the pinned version on the PATH.
+func (c *buildContext) pinNodeToolchain(p *Package, bld *packageBuild) error {
+	cfg, ok := p.Config.(YarnPkgConfig)
+	if !ok || cfg.Node == "" {
+		return nil
+	}
+	home, err := c.nodeToolchain(p, cfg.Node)
+	if err != nil {
+		return err
+	}
+
+	bin := filepath.Join(home, "bin")
+	pin := func(cmds [][]string) {
+		for i, cmd := range cmds {
+			if len(cmd) == 0 {
+				continue
+			}
+			if _, ok := nodeBinaries[cmd[0]]; ok {
+				// commands may be those of the package config, which we must not modify
+				cmds[i] = append([]string{filepath.Join(bin, cmd[0])}, cmd[1:]...)
+			}
+		}
+	}
+	pin(bld.BuildCommands)
+	pin(bld.PackageCommands)
+	bld.Environment = append(bld.Environment, p.Hermetic.prependPath(bin))
+	return nil
+}
+
+// WithNodeToolchains configures the directory the Node.js versions pinned by packages are kept in.
+// Defaults to a directory in the build dir.
+func WithNodeToolchains(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.NodeToolchainDir = dir
+		return nil
+	}
+}
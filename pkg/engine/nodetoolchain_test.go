@@ -0,0 +1,179 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNodeToolchain(t *testing.T) {
+	name := fmt.Sprintf("node-v18.17.1-%s", nodePlatform())
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	script := []byte("#!/bin/sh\necho v18.17.1\n")
+	err := tw.WriteHeader(&tar.Header{Name: name + "/bin/node", Mode: 0755, Size: int64(len(script)), Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tw.Write(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	gz.Close()
+	sum := sha256.Sum256(archive.Bytes())
+
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v18.17.1/" + name + ".tar.gz":
+			downloads++
+			w.Write(archive.Bytes())
+		case "/v18.17.1/SHASUMS256.txt":
+			fmt.Fprintf(w, "%s  node-v18.17.1.tar.gz\n%s  %s.tar.gz\n", hex.EncodeToString(make([]byte, 32)), hex.EncodeToString(sum[:]), name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { nodeToolchainURL = url }(nodeToolchainURL)
+	nodeToolchainURL = srv.URL
+
+	buildctx := &buildContext{buildOptions: buildOptions{
+		Reporter:         &shardReporter{},
+		NodeToolchainDir: t.TempDir(),
+	}}
+	pkg := &Package{
+		C:               &Component{Name: "comp"},
+		packageInternal: packageInternal{Name: "app", Type: YarnPackage},
+		Config:          YarnPkgConfig{Node: "v18.17.1"},
+	}
+	for i := 0; i < 2; i++ {
+		bld := &packageBuild{
+			BuildCommands:   [][]string{{"npm", "ci"}, {"yarn", "build"}},
+			PackageCommands: [][]string{{"npm", "pack"}},
+		}
+		err := buildctx.pinNodeToolchain(pkg, bld)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bin := filepath.Join(buildctx.NodeToolchainDir, "node18.17.1", "bin")
+		expectation := [][]string{{filepath.Join(bin, "npm"), "ci"}, {"yarn", "build"}}
+		if diff := cmp.Diff(expectation, bld.BuildCommands); diff != "" {
+			t.Errorf("pinNodeToolchain() mismatch (-want +got):\n%s", diff)
+		}
+		if _, err := os.Stat(filepath.Join(bin, "node")); err != nil {
+			t.Errorf("Node.js was not extracted: %v", err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("expected Node.js to be downloaded once, got %d downloads", downloads)
+	}
+
+	// the pinned version goes in front of the hermetic PATH rather than the PATH of this process
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatalf("cannot find sh: %v", err)
+	}
+	pkg.Hermetic = &HermeticEnvironment{Path: []string{filepath.Dir(sh)}}
+	bld := &packageBuild{BuildCommands: [][]string{{"sh", "-c", "echo \"$PATH\" > path.txt && node > version.txt"}}}
+	err = buildctx.pinNodeToolchain(pkg, bld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd := t.TempDir()
+	err = executeCommandsWithReporter(buildctx, &shardReporter{}, pkg, wd, bld.BuildCommands, bld.Environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(buildctx.NodeToolchainDir, "node18.17.1", "bin")
+	for fn, exp := range map[string]string{
+		"path.txt":    bin + string(os.PathListSeparator) + filepath.Dir(sh) + "\n",
+		"version.txt": "v18.17.1\n",
+	} {
+		fc, err := ioutil.ReadFile(filepath.Join(wd, fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(exp, string(fc)); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", fn, diff)
+		}
+	}
+
+	_, err = buildctx.nodeToolchain(pkg, "16.0.0")
+	if err == nil {
+		t.Errorf("expected an error for a version which does not exist")
+	}
+}
+
+func TestResolveNodeVersion(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Files       map[string]string
+		Expectation string
+		Error       bool
+	}{
+		{Name: "nvmrc", Files: map[string]string{".nvmrc": "v18.17.1\n", "package.json": `{"volta":{"node":"16.20.0"}}`}, Expectation: "18.17.1"},
+		{Name: "volta", Files: map[string]string{"package.json": `{"volta":{"node":"16.20.0"}}`}, Expectation: "16.20.0"},
+		{Name: "partial version", Files: map[string]string{".nvmrc": "lts/*\n"}, Error: true},
+		{Name: "nothing pinned", Files: map[string]string{"package.json": `{"name":"app"}`}, Error: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			for fn, content := range test.Files {
+				err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			act, err := resolveNodeVersion(dir)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected an error, got version %s", act)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act != test.Expectation {
+				t.Errorf("expected version %s, got %s", test.Expectation, act)
+			}
+		})
+	}
+}
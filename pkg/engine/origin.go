@@ -0,0 +1,114 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// artifactOriginSuffix is appended to the filename of a cached artifact to record where it came from
+const artifactOriginSuffix = ".origin.json"
+
+// ArtifactSource describes how an artifact got into the local cache
+type ArtifactSource string
+
+const (
+	// ArtifactBuilt artifacts were built on this machine
+	ArtifactBuilt ArtifactSource = "built"
+	// ArtifactDownloaded artifacts were downloaded from a remote cache
+	ArtifactDownloaded ArtifactSource = "remote"
+	// ArtifactUnknown artifacts got into the local cache before their origin was recorded
+	ArtifactUnknown ArtifactSource = "unknown"
+)
+
+// ArtifactOrigin records where a cached artifact came from
+type ArtifactOrigin struct {
+	Source ArtifactSource `json:"source"`
+	// RemoteCache names the remote cache a downloaded artifact came from
+	RemoteCache string    `json:"remoteCache,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// ReadArtifactOrigin returns the recorded origin of a cached artifact. Artifacts with a recorded checksum
+// but no origin were built locally, by a version of Bhojpur GoRPA which did not record origins yet.
+func ReadArtifactOrigin(fn string) (ArtifactOrigin, error) {
+	fc, err := ioutil.ReadFile(fn + artifactOriginSuffix)
+	if os.IsNotExist(err) {
+		if _, err := os.Stat(fn + artifactChecksumSuffix); err == nil {
+			return ArtifactOrigin{Source: ArtifactBuilt}, nil
+		}
+		return ArtifactOrigin{Source: ArtifactUnknown}, nil
+	}
+	if err != nil {
+		return ArtifactOrigin{}, err
+	}
+
+	var res ArtifactOrigin
+	err = json.Unmarshal(fc, &res)
+	if err != nil {
+		return ArtifactOrigin{}, xerrors.Errorf("cannot read origin of %s: %w", fn, err)
+	}
+	return res, nil
+}
+
+func writeArtifactOrigin(fn string, origin ArtifactOrigin) error {
+	fc, err := json.Marshal(origin)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn+artifactOriginSuffix, fc, 0644)
+}
+
+// RemoteCacheName describes a remote cache for humans, e.g. gs://some-bucket
+func RemoteCacheName(rc RemoteCache) string {
+	if s, ok := rc.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", rc)
+}
+
+// recordDownloads records the origin of all artifacts which are in the local cache now but were not
+// in the cached list before the download from the remote cache.
+func recordDownloads(local Cache, rc RemoteCache, pkgs []*Package, cached map[*Package]bool) {
+	now := time.Now().UTC()
+	for _, p := range pkgs {
+		if cached[p] {
+			continue
+		}
+		fn, exists := local.Location(p)
+		if !exists {
+			continue
+		}
+		cached[p] = true
+
+		err := writeArtifactOrigin(fn, ArtifactOrigin{Source: ArtifactDownloaded, RemoteCache: RemoteCacheName(rc), Time: now})
+		if err != nil {
+			log.WithError(err).WithField("package", p.FullName()).Warn("cannot record artifact origin")
+		}
+	}
+}
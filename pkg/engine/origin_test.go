@@ -0,0 +1,88 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestArtifactOrigin(t *testing.T) {
+	ba := &Application{}
+	newPkg := func(name string) *Package {
+		return testPackage(ba, name, GenericPackage)
+	}
+	var (
+		legacy     = newPkg("legacy")
+		built      = newPkg("built")
+		downloaded = newPkg("downloaded")
+		missing    = newPkg("missing")
+		cache      = &FilesystemCache{Origin: t.TempDir()}
+	)
+	write := func(fn string) {
+		err := ioutil.WriteFile(fn, []byte("artifact"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []*Package{legacy, built} {
+		fn, _ := cache.Location(p)
+		write(fn)
+	}
+	fn, _ := cache.Location(built)
+	write(fn + artifactChecksumSuffix)
+
+	cached := map[*Package]bool{legacy: true, built: true}
+	fn, _ = cache.Location(downloaded)
+	write(fn)
+	recordDownloads(cache, GSUtilRemoteCache{BucketName: "some-bucket"}, []*Package{legacy, built, downloaded, missing}, cached)
+
+	tests := []struct {
+		Pkg         *Package
+		Source      ArtifactSource
+		RemoteCache string
+	}{
+		{Pkg: legacy, Source: ArtifactUnknown},
+		{Pkg: built, Source: ArtifactBuilt},
+		{Pkg: downloaded, Source: ArtifactDownloaded, RemoteCache: "gs://some-bucket"},
+	}
+	for _, test := range tests {
+		t.Run(test.Pkg.Name, func(t *testing.T) {
+			fn, exists := cache.Location(test.Pkg)
+			if !exists {
+				t.Fatal("artifact does not exist")
+			}
+			origin, err := ReadArtifactOrigin(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if origin.Source != test.Source {
+				t.Errorf("expected source %s, got %s", test.Source, origin.Source)
+			}
+			if origin.RemoteCache != test.RemoteCache {
+				t.Errorf("expected remote cache %q, got %q", test.RemoteCache, origin.RemoteCache)
+			}
+		})
+	}
+	if cached[missing] {
+		t.Error("recorded the origin of an artifact which is not in the local cache")
+	}
+}
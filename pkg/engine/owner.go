@@ -0,0 +1,55 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// PackagesForFile returns the packages which own a file, sorted by name. Packages own their sources, and
+// all packages of a component own its BUILD.yaml.
+func (a *Application) PackagesForFile(fn string) ([]*Package, error) {
+	fn, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	// sources are located below the application origin as it was given, which may differ from the path of the file
+	// if either contains symlinks
+	if resolvedOrigin, err := filepath.EvalSymlinks(a.Origin); err == nil {
+		if resolved, err := filepath.EvalSymlinks(fn); err == nil {
+			if rel, err := filepath.Rel(resolvedOrigin, resolved); err == nil {
+				fn = filepath.Join(a.Origin, rel)
+			}
+		}
+	}
+	if fn == filepath.Join(a.Origin, "APPLICATION.yaml") {
+		return nil, nil
+	}
+
+	_, pkgs := a.affectedBy([]string{fn})
+	res := make([]*Package, 0, len(pkgs))
+	for _, p := range pkgs {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].FullName() < res[j].FullName() })
+	return res, nil
+}
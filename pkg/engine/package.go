@@ -26,11 +26,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 
-	"github.com/minio/highwayhash"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
 
@@ -53,7 +53,12 @@ const (
 	// If this variable is used and the build is not executed from within a Git working copy the variable resolution will fail.
 	BuildinArgGitCommit = "__git_commit"
 
-	// contentHashKey is the key we use to hash source files. Change this key and you'll break all past versions of all Bhojpur GoRPA builds ever.
+	// BuiltinArgPackageBuildInfo is a builtin argument/variable which contains the path of the package's build-info file.
+	// The path is relative to the build directory of the package, i.e. the working directory of all build commands.
+	BuiltinArgPackageBuildInfo = "__pkg_buildinfo"
+
+	// contentHashKey is the key we use to hash source files unless the application configures its own content hash.
+	// Change this key and you'll break all past versions of all Bhojpur GoRPA builds ever.
 	contentHashKey = "0340f3c8947cad7875140f4c4af7c62b43131dc2a8c7fc4628f0685e369a3b0b"
 )
 
@@ -89,6 +94,11 @@ func FindUnresolvedArguments(pkg *Package) ([]string, error) {
 		vars[fmt.Sprintf("${%s}", segs[0])] = struct{}{}
 	}
 
+	if cfg, ok := pkg.Config.(GoPkgConfig); ok && len(cfg.Platforms) > 0 {
+		// resolved per platform during the build
+		delete(vars, fmt.Sprintf("${%s}", BuiltinArgPlatform))
+	}
+
 	var res []string
 	for v := range vars {
 		res = append(res, v)
@@ -126,9 +136,55 @@ type Component struct {
 	// have a commit. This field is private to encourage the use of the GitCommit function.
 	git *GitInfo
 
-	Constants Arguments  `yaml:"const"`
-	Packages  []*Package `yaml:"packages"`
-	Scripts   []*Script  `yaml:"scripts"`
+	Constants Arguments         `yaml:"const"`
+	Defaults  ComponentDefaults `yaml:"defaults"`
+	Packages  []*Package        `yaml:"packages"`
+	Scripts   []*Script         `yaml:"scripts"`
+}
+
+// ComponentDefaults are merged into every package of a component
+type ComponentDefaults struct {
+	Sources      []string `yaml:"srcs,omitempty"`
+	Dependencies []string `yaml:"deps,omitempty"`
+	Environment  []string `yaml:"env,omitempty"`
+}
+
+// IsEmpty returns true if there are no defaults to apply
+func (d ComponentDefaults) IsEmpty() bool {
+	return len(d.Sources) == 0 && len(d.Dependencies) == 0 && len(d.Environment) == 0
+}
+
+// apply merges the defaults into a package. Sources and dependencies are added to those of the package,
+// whereas environment variables the package sets itself take precedence over the defaults.
+// A package never inherits a dependency on itself.
+func (d ComponentDefaults) apply(pkg *Package) error {
+	pkg.Sources = appendMissing(append([]string{}, d.Sources...), pkg.Sources)
+
+	deps := make([]string, 0, len(d.Dependencies))
+	for _, dep := range d.Dependencies {
+		if dep == ":"+pkg.Name || dep == pkg.FullName() {
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	pkg.Dependencies = appendMissing(deps, pkg.Dependencies)
+
+	return mergeDefaultEnv(pkg, d.Environment)
+}
+
+func appendMissing(dst []string, src []string) []string {
+	idx := make(map[string]struct{}, len(dst))
+	for _, e := range dst {
+		idx[e] = struct{}{}
+	}
+	for _, e := range src {
+		if _, exists := idx[e]; exists {
+			continue
+		}
+		idx[e] = struct{}{}
+		dst = append(dst, e)
+	}
+	return dst
 }
 
 // GitCommit returns the git commit of this component or the application. Returns an empty string if
@@ -151,15 +207,20 @@ func (n PackageNotFoundErr) Error() string {
 }
 
 type packageInternal struct {
-	Name                 string            `yaml:"name"`
-	Type                 PackageType       `yaml:"type"`
-	Sources              []string          `yaml:"srcs"`
-	Dependencies         []string          `yaml:"deps"`
-	Layout               map[string]string `yaml:"layout"`
-	ArgumentDependencies []string          `yaml:"argdeps"`
-	Environment          []string          `yaml:"env"`
-	Ephemeral            bool              `yaml:"ephemeral"`
-	PreparationCommands  [][]string        `yaml:"prep"`
+	Name                 string               `yaml:"name"`
+	Type                 PackageType          `yaml:"type"`
+	Sources              []string             `yaml:"srcs"`
+	Dependencies         []string             `yaml:"deps"`
+	Layout               map[string]string    `yaml:"layout"`
+	ArgumentDependencies []string             `yaml:"argdeps"`
+	Environment          []string             `yaml:"env"`
+	Ephemeral            bool                 `yaml:"ephemeral"`
+	PreparationCommands  [][]string           `yaml:"prep"`
+	Resources            ResourceLimits       `yaml:"resources,omitempty"`
+	TestRetry            TestRetryPolicy      `yaml:"testRetry,omitempty"`
+	Timeout              Timeouts             `yaml:"timeout,omitempty"`
+	Hooks                BuildHooks           `yaml:"hooks,omitempty"`
+	Hermetic             *HermeticEnvironment `yaml:"hermetic,omitempty"`
 }
 
 // Package is a single buildable artifact within a component
@@ -178,6 +239,20 @@ type Package struct {
 	layout           map[*Package]string
 	originalSources  []string
 	fullNameOverride string
+
+	// script is the script this package builds the outputs of, if any
+	script *Script
+	// targetGroup marks the packages GroupTargets produces, which only build their dependencies
+	targetGroup bool
+
+	// baseImages maps the base images of a Docker package to their digests if base images are pinned
+	baseImages     map[string]string
+	baseImageFroms []dockerfileFrom
+}
+
+// Script returns the script this package builds the outputs of, or nil if this is a regular package
+func (p *Package) Script() *Script {
+	return p.script
 }
 
 // link connects resolves the references to the dependencies
@@ -308,6 +383,26 @@ func (p *Package) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		return err
 	}
+	err = tpe.Resources.Validate()
+	if err != nil {
+		return xerrors.Errorf("%s: %w", tpe.Name, err)
+	}
+	err = tpe.TestRetry.Validate()
+	if err != nil {
+		return xerrors.Errorf("%s: %w", tpe.Name, err)
+	}
+	err = tpe.Timeout.Validate()
+	if err != nil {
+		return xerrors.Errorf("%s: %w", tpe.Name, err)
+	}
+	err = tpe.Hooks.Validate()
+	if err != nil {
+		return xerrors.Errorf("%s: %w", tpe.Name, err)
+	}
+	err = tpe.Hermetic.Validate()
+	if err != nil {
+		return xerrors.Errorf("%s: %w", tpe.Name, err)
+	}
 	*p = Package{packageInternal: tpe}
 
 	var buf yaml.Node
@@ -367,6 +462,12 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 		if cfg.Config.Dockerfile == "" {
 			cfg.Config.Dockerfile = "Dockerfile"
 		}
+		if err := validateFetchSpecs(cfg.Config.Fetch); err != nil {
+			return nil, err
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
 		return cfg.Config, nil
 	case GenericPackage:
 		var cfg struct {
@@ -375,6 +476,48 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 		if err := unmarshal(&cfg); err != nil {
 			return nil, err
 		}
+		if err := validateFetchSpecs(cfg.Config.Fetch); err != nil {
+			return nil, err
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg.Config, nil
+	case ProtoPackage:
+		var cfg struct {
+			Config ProtoPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Config.Generator == "" {
+			cfg.Config.Generator = ProtoGeneratorProtoc
+		}
+		if cfg.Config.Output == "" {
+			cfg.Config.Output = "gen"
+		}
+		if err := cfg.Config.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg.Config, nil
+	case PluginPackage:
+		var cfg struct {
+			Config PluginPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Config.Plugin == "" {
+			return nil, xerrors.Errorf("plugin packages must name their plugin")
+		}
+		return cfg.Config, nil
+	case MetaPackage:
+		var cfg struct {
+			Config MetaPkgConfig `yaml:"config"`
+		}
+		if err := unmarshal(&cfg); err != nil {
+			return nil, err
+		}
 		return cfg.Config, nil
 	default:
 		return nil, xerrors.Errorf("unknown package type \"%s\"", tpe)
@@ -382,7 +525,7 @@ func unmarshalTypeDependentConfig(tpe PackageType, unmarshal func(interface{}) e
 }
 
 // PackageConfig is the YAML unmarshalling config type of packages.
-// This is one of YarnPkgConfig, GoPkgConfig, DockerPkgConfig or GenericPkgConfig.
+// This is one of YarnPkgConfig, GoPkgConfig, DockerPkgConfig, GenericPkgConfig, ProtoPkgConfig, PluginPkgConfig or MetaPkgConfig.
 type PackageConfig interface {
 	AdditionalSources() []string
 }
@@ -393,11 +536,64 @@ type YarnPkgConfig struct {
 	TSConfig  string        `yaml:"tsconfig"`
 	Packaging YarnPackaging `yaml:"packaging,omitempty"`
 	DontTest  bool          `yaml:"dontTest,omitempty"`
-	Commands  struct {
+	// PackageManager selects the tool used to install, build, test and pack the package. Defaults to yarn.
+	PackageManager NodePackageManager `yaml:"packageManager,omitempty"`
+	// PackageLock is the npm lockfile of the package. Defaults to package-lock.json if npm is the package manager.
+	PackageLock string `yaml:"packageLock,omitempty"`
+	Commands    struct {
 		Install []string `yaml:"install,omitempty"`
 		Build   []string `yaml:"build,omitempty"`
 		Test    []string `yaml:"test,omitempty"`
 	} `yaml:"commands,omitempty"`
+	Prune YarnPruneConfig `yaml:"prune,omitempty"`
+	// Node pins the Node.js version, e.g. 18.17.1, which is downloaded and used instead of the node on the PATH.
+	// "auto" reads the version from the .nvmrc of the component or the volta config of the package.json.
+	Node string `yaml:"node,omitempty"`
+}
+
+// YarnPruneConfig configures the removal of devDependencies and unnecessary files from node_modules prior to packaging
+type YarnPruneConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Patterns are file name patterns (as understood by find -name) removed from node_modules in addition to the defaults
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Keep lists default patterns which should not be removed
+	Keep []string `yaml:"keep,omitempty"`
+}
+
+// defaultYarnPrunePatterns are removed from node_modules when pruning is enabled. License files are always kept.
+var defaultYarnPrunePatterns = []string{
+	"*.md",
+	"*.markdown",
+	"*.map",
+	"*.tsbuildinfo",
+	".github",
+	".eslintrc*",
+	".npmignore",
+	".travis.yml",
+	"__tests__",
+	"test",
+	"tests",
+	"doc",
+	"docs",
+	"example",
+	"examples",
+}
+
+// PrunePatterns returns the file name patterns removed from node_modules
+func (cfg YarnPruneConfig) PrunePatterns() []string {
+	keep := make(map[string]struct{}, len(cfg.Keep))
+	for _, k := range cfg.Keep {
+		keep[k] = struct{}{}
+	}
+
+	res := make([]string, 0, len(defaultYarnPrunePatterns)+len(cfg.Patterns))
+	for _, p := range defaultYarnPrunePatterns {
+		if _, ok := keep[p]; ok {
+			continue
+		}
+		res = append(res, p)
+	}
+	return append(res, cfg.Patterns...)
 }
 
 // Validate ensures this config can be acted upon/is valid
@@ -411,9 +607,72 @@ func (cfg YarnPkgConfig) Validate() error {
 		return xerrors.Errorf("unknown packaging: %s", cfg.Packaging)
 	}
 
+	if cfg.Prune.Enabled && cfg.Packaging != YarnApp && cfg.Packaging != YarnArchive {
+		return xerrors.Errorf("prune is only supported for %s and %s packaging", YarnApp, YarnArchive)
+	}
+
+	switch cfg.PackageManager {
+	case "", YarnPackageManager:
+		if cfg.PackageLock != "" {
+			return xerrors.Errorf("packageLock is only supported with the %s package manager", NpmPackageManager)
+		}
+	case NpmPackageManager:
+		if cfg.Packaging != YarnLibrary && cfg.Packaging != YarnArchive {
+			return xerrors.Errorf("the %s package manager only supports %s and %s packaging", NpmPackageManager, YarnLibrary, YarnArchive)
+		}
+		if cfg.YarnLock != "" {
+			return xerrors.Errorf("yarnLock is not supported with the %s package manager - use packageLock instead", NpmPackageManager)
+		}
+	case YarnBerryPackageManager:
+		if cfg.Packaging == YarnOfflineMirror {
+			return xerrors.Errorf("the %s package manager does not support %s packaging", YarnBerryPackageManager, YarnOfflineMirror)
+		}
+		if cfg.PackageLock != "" {
+			return xerrors.Errorf("packageLock is only supported with the %s package manager", NpmPackageManager)
+		}
+	default:
+		return xerrors.Errorf("unknown package manager: %s", cfg.PackageManager)
+	}
+
+	if cfg.Node != "" && cfg.Node != NodeVersionAuto {
+		if err := validateNodeVersion(cfg.Node); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// NodePackageManager is the tool a yarn package is built with
+type NodePackageManager string
+
+const (
+	// YarnPackageManager builds the package using yarn
+	YarnPackageManager NodePackageManager = "yarn"
+	// NpmPackageManager builds the package using npm ci and npm run scripts
+	NpmPackageManager NodePackageManager = "npm"
+	// YarnBerryPackageManager builds the package using Yarn Berry (v2 and later), honouring its .yarnrc.yml
+	YarnBerryPackageManager NodePackageManager = "yarn-berry"
+)
+
+// IsNpm returns true if this package is built using npm rather than yarn
+func (cfg YarnPkgConfig) IsNpm() bool {
+	return cfg.PackageManager == NpmPackageManager
+}
+
+// IsYarnBerry returns true if this package is built using Yarn Berry rather than Yarn Classic
+func (cfg YarnPkgConfig) IsYarnBerry() bool {
+	return cfg.PackageManager == YarnBerryPackageManager
+}
+
+// packageLock returns the lockfile of an npm package
+func (cfg YarnPkgConfig) packageLock() string {
+	if cfg.PackageLock != "" {
+		return cfg.PackageLock
+	}
+	return "package-lock.json"
+}
+
 // YarnPackaging configures the packaging method of a yarn package
 type YarnPackaging string
 
@@ -434,12 +693,27 @@ func (cfg YarnPkgConfig) AdditionalSources() []string {
 	if cfg.YarnLock != "" {
 		res = append(res, cfg.YarnLock)
 	}
+	if cfg.IsNpm() {
+		res = append(res, cfg.packageLock())
+	}
 	if cfg.TSConfig != "" {
 		res = append(res, cfg.TSConfig)
 	}
 	return res
 }
 
+// OptionalSources returns sources which are added to the package if they exist
+func (cfg YarnPkgConfig) OptionalSources() []string {
+	if !cfg.IsYarnBerry() {
+		return nil
+	}
+	res := []string{yarnRCFilename}
+	if cfg.YarnLock == "" {
+		res = append(res, "yarn.lock")
+	}
+	return res
+}
+
 // GoPkgConfig configures a Go package
 type GoPkgConfig struct {
 	Packaging      GoPackaging `yaml:"packaging,omitempty"`
@@ -455,6 +729,38 @@ type GoPkgConfig struct {
 	BuildCommand []string `yaml:"buildCommand,omitempty"`
 	LintCommand  []string `yaml:"lintCommand,omitempty"`
 	GoVersion    string   `yaml:"goVersion,omitempty"`
+	BuildTags    []string `yaml:"buildTags,omitempty"`
+	Race         bool     `yaml:"race,omitempty"`
+	// Go pins the Go toolchain, e.g. 1.21.5, which is downloaded and used instead of the go on the PATH
+	Go string `yaml:"go,omitempty"`
+	// Platforms builds the app for each of the GOOS/GOARCH targets, e.g. linux/arm64, into a directory per platform
+	Platforms []string `yaml:"platforms,omitempty"`
+	// TestShards splits the Go packages of the module into this many shards whose tests run concurrently
+	TestShards int `yaml:"testShards,omitempty"`
+	// Lint configures golangci-lint. It replaces lintCommand.
+	Lint GoLintConfig `yaml:"lint,omitempty"`
+	// GenerateInputs are globs of the sources go generate depends on. Its outputs are cached by those inputs.
+	GenerateInputs []string `yaml:"generateInputs,omitempty"`
+	// Vendor builds the module with -mod=vendor, i.e. without access to a module proxy. Go dependencies
+	// within the application are used from the vendor directory, too.
+	Vendor bool `yaml:"vendor,omitempty"`
+	// Stamp names the variables set using -X if provenance.stamp is enabled. Defaults to main.version, main.commit and main.date.
+	Stamp GoStampConfig `yaml:"stamp,omitempty"`
+
+	// IsolateGoCache builds this package with its own GOCACHE rather than the one shared by all Go packages
+	IsolateGoCache bool `yaml:"isolateGoCache,omitempty"`
+}
+
+// goFlags returns the flags passed to go build and go test
+func (cfg GoPkgConfig) goFlags() []string {
+	var res []string
+	if len(cfg.BuildTags) > 0 {
+		res = append(res, "-tags="+strings.Join(cfg.BuildTags, ","))
+	}
+	if cfg.Race {
+		res = append(res, "-race")
+	}
+	return res
 }
 
 // Validate ensures this config can be acted upon/is valid
@@ -474,6 +780,36 @@ func (cfg GoPkgConfig) Validate() error {
 			return xerrors.Errorf("buildCommand and goVersion are exclusive - use one or the other")
 		}
 	}
+	if cfg.Go != "" {
+		if cfg.GoVersion != "" {
+			return xerrors.Errorf("go and goVersion are exclusive - use one or the other")
+		}
+		err := validateGoToolchainVersion(cfg.Go)
+		if err != nil {
+			return err
+		}
+	}
+	if len(cfg.Platforms) > 0 && cfg.Packaging != GoApp {
+		return xerrors.Errorf("platforms require %s packaging", GoApp)
+	}
+	for _, platform := range cfg.Platforms {
+		if _, err := parseGoPlatform(platform); err != nil {
+			return err
+		}
+	}
+	if cfg.TestShards < 0 {
+		return xerrors.Errorf("testShards must not be negative")
+	}
+	if len(cfg.GenerateInputs) > 0 && !cfg.Generate {
+		return xerrors.Errorf("generateInputs require generate")
+	}
+	if !cfg.Lint.isEmpty() && len(cfg.LintCommand) > 0 {
+		return xerrors.Errorf("lint and lintCommand are exclusive - use one or the other")
+	}
+	err := cfg.Lint.Validate()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -490,7 +826,14 @@ const (
 
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
 func (cfg GoPkgConfig) AdditionalSources() []string {
-	return []string{}
+	res := []string{}
+	if cfg.Lint.Config != "" {
+		res = append(res, cfg.Lint.Config)
+	}
+	if cfg.Vendor {
+		res = append(res, filepath.Join("vendor", "modules.txt"))
+	}
+	return res
 }
 
 // DockerPkgConfig configures a Docker package
@@ -500,6 +843,55 @@ type DockerPkgConfig struct {
 	BuildArgs  map[string]string `yaml:"buildArgs,omitempty"`
 	Squash     bool              `yaml:"squash,omitempty"`
 	Metadata   map[string]string `yaml:"metadata,omitempty"`
+	Fetch      []FetchSpec       `yaml:"fetch,omitempty"`
+	// Platforms turns the image into a multi-arch image built for each of the platforms, e.g. linux/arm64.
+	// Multi-arch images are always built using BuildKit.
+	Platforms []string `yaml:"platforms,omitempty"`
+	// Secrets are made available to RUN --mount=type=secret instructions. They are neither part of the image
+	// nor of the package version.
+	Secrets []DockerSecret `yaml:"secrets,omitempty"`
+	// SSH forwards SSH agents or keys to RUN --mount=type=ssh instructions, e.g. "default" or "id=/path/to/key"
+	SSH []string `yaml:"ssh,omitempty"`
+	// Labels are added to the image
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// DockerSecret is a secret of a Docker build which is read from a file or an environment variable
+type DockerSecret struct {
+	// ID is the id the Dockerfile refers to the secret by
+	ID string `yaml:"id"`
+	// Src is the file the secret is read from. Relative paths are relative to the component, ~/ refers to the home directory.
+	Src string `yaml:"src,omitempty"`
+	// Env is the environment variable the secret is read from
+	Env string `yaml:"env,omitempty"`
+}
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg DockerPkgConfig) Validate() error {
+	for _, platform := range cfg.Platforms {
+		if segs := strings.Split(platform, "/"); len(segs) < 2 || len(segs) > 3 {
+			return xerrors.Errorf("invalid platform %q: must be os/arch or os/arch/variant", platform)
+		}
+	}
+	ids := make(map[string]struct{}, len(cfg.Secrets))
+	for _, secret := range cfg.Secrets {
+		if secret.ID == "" {
+			return xerrors.Errorf("secrets: id is required")
+		}
+		if _, exists := ids[secret.ID]; exists {
+			return xerrors.Errorf("secrets: duplicate id %s", secret.ID)
+		}
+		ids[secret.ID] = struct{}{}
+		if (secret.Src == "") == (secret.Env == "") {
+			return xerrors.Errorf("secrets: %s must have either src or env", secret.ID)
+		}
+	}
+	for _, ssh := range cfg.SSH {
+		if strings.TrimSpace(ssh) == "" {
+			return xerrors.Errorf("ssh: must not be empty")
+		}
+	}
+	return nil
 }
 
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
@@ -509,9 +901,23 @@ func (cfg DockerPkgConfig) AdditionalSources() []string {
 
 // GenericPkgConfig configures a generic package
 type GenericPkgConfig struct {
-	Commands [][]string `yaml:"commands"`
-	Test     [][]string `yaml:"test,omitempty"`
-	DontTest bool       `yaml:"dontTest,omitempty"`
+	Commands [][]string  `yaml:"commands"`
+	Test     [][]string  `yaml:"test,omitempty"`
+	DontTest bool        `yaml:"dontTest,omitempty"`
+	Fetch    []FetchSpec `yaml:"fetch,omitempty"`
+	// Outputs are globs relative to the build directory. If set, only files matching the globs
+	// end up in the build artifact, and every glob must match at least one file.
+	Outputs []string `yaml:"outputs,omitempty"`
+}
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg GenericPkgConfig) Validate() error {
+	for _, out := range cfg.Outputs {
+		if out == "" || filepath.IsAbs(out) || out == ".." || strings.HasPrefix(filepath.Clean(out), "../") {
+			return xerrors.Errorf("outputs: %q must be a glob relative to the build directory", out)
+		}
+	}
+	return nil
 }
 
 // AdditionalSources returns a list of unresolved sources coming in through this configuration
@@ -519,6 +925,117 @@ func (cfg GenericPkgConfig) AdditionalSources() []string {
 	return []string{}
 }
 
+// MetaPkgConfig configures a meta package. Meta packages have no build steps of their own, hence there's nothing to configure.
+type MetaPkgConfig struct{}
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration
+func (cfg MetaPkgConfig) AdditionalSources() []string {
+	return []string{}
+}
+
+// ProtoPkgConfig configures a proto package
+type ProtoPkgConfig struct {
+	// Generator is the tool which generates the code. Defaults to protoc.
+	Generator ProtoGenerator `yaml:"generator,omitempty"`
+	// Output is the directory the code is generated into, relative to the build directory. Only this
+	// directory ends up in the build artifact. Defaults to gen.
+	Output string `yaml:"output,omitempty"`
+	// Plugins are the protoc plugins that generate the code (protoc only)
+	Plugins []ProtoPlugin `yaml:"plugins,omitempty"`
+	// IncludePaths are passed to protoc as -I, relative to the build directory (protoc only).
+	// The component directory and the location of all dependencies are always included.
+	IncludePaths []string `yaml:"includePaths,omitempty"`
+	// BufConfig is the buf.yaml of the module (buf only). Defaults to buf.yaml.
+	BufConfig string `yaml:"bufConfig,omitempty"`
+	// BufTemplate is the buf.gen.yaml which configures the plugins (buf only). Defaults to buf.gen.yaml.
+	BufTemplate string `yaml:"bufTemplate,omitempty"`
+}
+
+// ProtoPlugin is a protoc plugin, e.g. go for protoc-gen-go
+type ProtoPlugin struct {
+	Name string `yaml:"name"`
+	// Out is the output directory of the plugin relative to the output of the package
+	Out string `yaml:"out,omitempty"`
+	// Opt are options passed to the plugin using --<name>_opt
+	Opt []string `yaml:"opt,omitempty"`
+	// Path is the plugin executable. If empty, protoc looks for protoc-gen-<name> in the PATH.
+	Path string `yaml:"path,omitempty"`
+}
+
+// ProtoGenerator is the tool that generates the code of a proto package
+type ProtoGenerator string
+
+const (
+	// ProtoGeneratorProtoc runs protoc with the configured plugins
+	ProtoGeneratorProtoc ProtoGenerator = "protoc"
+	// ProtoGeneratorBuf runs buf generate
+	ProtoGeneratorBuf ProtoGenerator = "buf"
+)
+
+// Validate ensures this config can be acted upon/is valid
+func (cfg ProtoPkgConfig) Validate() error {
+	if filepath.IsAbs(cfg.Output) || strings.HasPrefix(filepath.Clean(cfg.Output), "..") || filepath.Clean(cfg.Output) == "." {
+		return xerrors.Errorf("output must be a directory within the build directory: %s", cfg.Output)
+	}
+
+	switch cfg.Generator {
+	case ProtoGeneratorProtoc:
+		if len(cfg.Plugins) == 0 {
+			return xerrors.Errorf("protoc needs at least one plugin")
+		}
+		for _, p := range cfg.Plugins {
+			if p.Name == "" {
+				return xerrors.Errorf("plugins must have a name")
+			}
+		}
+		if cfg.BufConfig != "" || cfg.BufTemplate != "" {
+			return xerrors.Errorf("bufConfig and bufTemplate are only supported by the %s generator", ProtoGeneratorBuf)
+		}
+	case ProtoGeneratorBuf:
+		if len(cfg.Plugins) > 0 || len(cfg.IncludePaths) > 0 {
+			return xerrors.Errorf("plugins and includePaths are only supported by the %s generator - configure buf using %s instead", ProtoGeneratorProtoc, cfg.bufTemplate())
+		}
+	default:
+		return xerrors.Errorf("unknown proto generator: %s", cfg.Generator)
+	}
+	return nil
+}
+
+func (cfg ProtoPkgConfig) bufConfig() string {
+	if cfg.BufConfig != "" {
+		return cfg.BufConfig
+	}
+	return "buf.yaml"
+}
+
+func (cfg ProtoPkgConfig) bufTemplate() string {
+	if cfg.BufTemplate != "" {
+		return cfg.BufTemplate
+	}
+	return "buf.gen.yaml"
+}
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration
+func (cfg ProtoPkgConfig) AdditionalSources() []string {
+	if cfg.Generator != ProtoGeneratorBuf {
+		return []string{}
+	}
+	return []string{cfg.bufConfig(), cfg.bufTemplate()}
+}
+
+// OptionalSources returns sources which are added to the package if they exist
+func (cfg ProtoPkgConfig) OptionalSources() []string {
+	if cfg.Generator != ProtoGeneratorBuf {
+		return nil
+	}
+	return []string{filepath.Join(filepath.Dir(cfg.bufConfig()), "buf.lock")}
+}
+
+// optionalSourcesConfig is implemented by package configs with additional sources that need not exist
+type optionalSourcesConfig interface {
+	OptionalSources() []string
+}
+
 // PackageType describes the way a package is built and what it produces
 type PackageType string
 
@@ -537,6 +1054,15 @@ const (
 
 	// GenericPackage runs an arbitary shell command
 	GenericPackage PackageType = "generic"
+
+	// ProtoPackage generates code from protobuf definitions using protoc or buf
+	ProtoPackage PackageType = "proto"
+
+	// PluginPackage is built by a plugin registered in the APPLICATION.yaml
+	PluginPackage PackageType = "plugin"
+
+	// MetaPackage has no build steps but aggregates the build artifacts of its dependencies
+	MetaPackage PackageType = "meta"
 )
 
 // UnmarshalYAML unmarshals and validates a package type
@@ -549,7 +1075,7 @@ func (p *PackageType) UnmarshalYAML(unmarshal func(interface{}) error) (err erro
 
 	*p = PackageType(val)
 	switch *p {
-	case DeprecatedTypescriptPackage, YarnPackage, GoPackage, DockerPackage, GenericPackage:
+	case DeprecatedTypescriptPackage, YarnPackage, GoPackage, DockerPackage, GenericPackage, ProtoPackage, PluginPackage, MetaPackage:
 	default:
 		return fmt.Errorf("invalid package type: %s", err)
 	}
@@ -569,6 +1095,61 @@ type packageVariantInternal struct {
 	RawConfig   map[PackageType]yaml.Node `yaml:"config"`
 }
 
+// PackageDefaults are the application-wide defaults for packages of a particular type
+type PackageDefaults map[PackageType]*PackageTypeDefaults
+
+// PackageTypeDefaults are merged beneath the environment and config of all packages of a type.
+// Package variants still take precedence over these defaults.
+type PackageTypeDefaults struct {
+	Environment []string  `yaml:"env,omitempty"`
+	RawConfig   yaml.Node `yaml:"config,omitempty"`
+
+	config PackageConfig
+}
+
+// UnmarshalYAML unmarshals the package defaults of all types
+func (d *PackageDefaults) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[PackageType]*PackageTypeDefaults
+	err := unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+
+	for tpe, defs := range raw {
+		if defs == nil {
+			delete(raw, tpe)
+			continue
+		}
+		if defs.RawConfig.Kind == 0 {
+			continue
+		}
+
+		b, err := yaml.Marshal(&defs.RawConfig)
+		if err != nil {
+			return err
+		}
+		defs.config, err = unmarshalTypeDependentConfig(tpe, func(dst interface{}) error {
+			lines := strings.Split(string(b), "\n")
+			for i, l := range lines {
+				lines[i] = "    " + l
+			}
+			b := []byte("config:\n" + strings.Join(lines, "\n"))
+			return yaml.Unmarshal(b, dst)
+		})
+		if err != nil {
+			return xerrors.Errorf("packageDefaults.%s: %w", tpe, err)
+		}
+	}
+
+	*d = raw
+	return nil
+}
+
+// Config returns the default configuration for packages of this type
+func (d *PackageTypeDefaults) Config() (cfg PackageConfig, ok bool) {
+	return d.config, d.config != nil
+}
+
 // PackageVariant provides a variation point for a package's sources,
 // environment variables and config.
 type PackageVariant struct {
@@ -754,7 +1335,7 @@ func (p *Package) resolveBuiltinVariables() error {
 		case BuildinArgGitCommit:
 			foundGitVar = true
 			fallthrough
-		case BuiltinArgPackageVersion:
+		case BuiltinArgPackageVersion, BuiltinArgPackageBuildInfo:
 			found = true
 		}
 	}
@@ -768,7 +1349,8 @@ func (p *Package) resolveBuiltinVariables() error {
 		return err
 	}
 	builtinArgs := map[string]string{
-		BuiltinArgPackageVersion: version,
+		BuiltinArgPackageVersion:   version,
+		BuiltinArgPackageBuildInfo: buildInfoFilename,
 	}
 	if foundGitVar {
 		err = resolveBuiltinGitVariables(p, builtinArgs)
@@ -801,12 +1383,7 @@ func (p *Package) resolveBuiltinVariables() error {
 
 // DefinitionHash hashes the package definition
 func (p *Package) DefinitionHash() (string, error) {
-	key, err := hex.DecodeString(contentHashKey)
-	if err != nil {
-		return "", err
-	}
-
-	hash, err := highwayhash.New(key)
+	hash, err := p.C.W.ContentHash.newHash()
 	if err != nil {
 		return "", err
 	}
@@ -822,11 +1399,6 @@ func (p *Package) DefinitionHash() (string, error) {
 // ContentManifest produces an ordered list of content hashes (<filename>:<hash>) for each source file.
 // Expects the sources to be resolved.
 func (p *Package) ContentManifest() ([]string, error) {
-	key, err := hex.DecodeString(contentHashKey)
-	if err != nil {
-		return nil, err
-	}
-
 	// TODO: parallelize
 	res := make([]string, len(p.Sources))
 	for i, src := range p.Sources {
@@ -841,7 +1413,7 @@ func (p *Package) ContentManifest() ([]string, error) {
 			return nil, err
 		}
 
-		hash, err := highwayhash.New(key)
+		hash, err := p.C.W.ContentHash.newHash()
 		if err != nil {
 			file.Close()
 			return nil, err
@@ -869,13 +1441,70 @@ func (p *Package) ContentManifest() ([]string, error) {
 	return res, nil
 }
 
+// environmentManifestExclusions returns the sorted names of the environment manifest entries which
+// do not contribute to the version of this package.
+func (p *Package) environmentManifestExclusions() []string {
+	names := p.C.W.EnvironmentManifestExclusions[p.Type]
+	if len(names) == 0 {
+		return nil
+	}
+
+	res := make([]string, 0, len(names))
+	for _, e := range p.C.W.EnvironmentManifest {
+		for _, n := range names {
+			if e.Name == n {
+				res = append(res, n)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// environmentManifest returns the environment manifest entries of the tools this package is built with:
+// a Go package which pins a toolchain depends on that toolchain rather than the go on the PATH, a yarn
+// package which pins Node.js on that version rather than the node on the PATH, and no package depends on
+// the toolchains pinned by other packages.
+func (p *Package) environmentManifest() EnvironmentManifest {
+	var own, replaced string
+	switch cfg := p.Config.(type) {
+	case GoPkgConfig:
+		if cfg.Go != "" {
+			own, replaced = goToolchainEnvManifestPrefix+normaliseGoToolchainVersion(cfg.Go), "go"
+		}
+	case YarnPkgConfig:
+		if cfg.Node != "" {
+			own, replaced = nodeToolchainEnvManifestPrefix+normaliseNodeVersion(cfg.Node), "node"
+		}
+	}
+
+	res := make(EnvironmentManifest, 0, len(p.C.W.EnvironmentManifest))
+	for _, e := range p.C.W.EnvironmentManifest {
+		pinned := strings.HasPrefix(e.Name, goToolchainEnvManifestPrefix) || strings.HasPrefix(e.Name, nodeToolchainEnvManifestPrefix)
+		if pinned && e.Name != own {
+			continue
+		}
+		if replaced != "" && e.Name == replaced {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
 // WriteVersionManifest writes the manifest whoose hash is the version of this package (see Version())
 func (p *Package) WriteVersionManifest(out io.Writer) error {
+	return p.writeVersionManifest(out, p.ContentManifest)
+}
+
+// writeVersionManifest writes the version manifest using the sources listed by contentManifest
+func (p *Package) writeVersionManifest(out io.Writer, contentManifest func() ([]string, error)) error {
 	if p.dependencies == nil {
 		return xerrors.Errorf("package is not linked")
 	}
 
-	envhash, err := p.C.W.EnvironmentManifest.Hash()
+	excluded := p.environmentManifestExclusions()
+	envhash, err := p.environmentManifest().Without(excluded).hash(p.C.W.ContentHash)
 	if err != nil {
 		return err
 	}
@@ -883,7 +1512,7 @@ func (p *Package) WriteVersionManifest(out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	manifest, err := p.ContentManifest()
+	manifest, err := contentManifest()
 	if err != nil {
 		return err
 	}
@@ -891,22 +1520,42 @@ func (p *Package) WriteVersionManifest(out io.Writer) error {
 	var bundle []string
 
 	bundle = append(bundle, fmt.Sprintf("buildProcessVersion: %d\n", buildProcessVersions[p.Type]))
+	if !p.C.W.ContentHash.isDefault() {
+		bundle = append(bundle, fmt.Sprintf("contentHash: %s\n", p.C.W.ContentHash))
+	}
 	if p.C.W.Provenance.Enabled {
 		bundle = append(bundle, fmt.Sprintf("provenance: version=%d", provenanceProcessVersion))
 		if p.C.W.Provenance.SLSA {
 			bundle = append(bundle, " slsa")
 		}
+		if p.generatesSBOM() {
+			bundle = append(bundle, " sbom")
+		}
 		if p.C.W.Provenance.key != nil {
 			bundle = append(bundle, fmt.Sprintf(" key:%s", p.C.W.Provenance.key.KeyID))
 		}
 		bundle = append(bundle, "\n")
 	}
+	if p.C.W.Provenance.Stamp {
+		bundle = append(bundle, "stamp: true\n")
+	}
 
 	bundle = append(bundle, fmt.Sprintf("environment: %s\n", envhash))
+	if len(excluded) > 0 {
+		// the exclusion itself changes the version, s.t. dropping an entry does not silently reuse older builds
+		bundle = append(bundle, fmt.Sprintf("environmentExclusions: %s\n", strings.Join(excluded, ",")))
+	}
 	bundle = append(bundle, fmt.Sprintf("definition: %s\n", defhash))
+	if cfg, ok := p.Config.(GoPkgConfig); ok {
+		// build tags and the race detector can be set per invocation, hence aren't necessarily part of the definition
+		if flags := cfg.goFlags(); len(flags) > 0 {
+			bundle = append(bundle, fmt.Sprintf("goFlags: %s\n", strings.Join(flags, " ")))
+		}
+	}
 	for _, argdep := range p.ArgumentDependencies {
 		bundle = append(bundle, fmt.Sprintf("arg %s\n", argdep))
 	}
+	bundle = append(bundle, p.baseImageManifest()...)
 	for _, dep := range p.dependencies {
 		ver, err := dep.Version()
 		if err != nil {
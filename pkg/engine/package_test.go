@@ -24,6 +24,9 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
 )
 
 func TestResolveBuiltinVariables(t *testing.T) {
@@ -37,6 +40,7 @@ func TestResolveBuiltinVariables(t *testing.T) {
 		{DockerPackage, DockerPkgConfig{Dockerfile: "gorpa.Dockerfile", Image: []string{"foobar:${__pkg_version}"}}, nil, DockerPkgConfig{Dockerfile: "gorpa.Dockerfile", Image: []string{"foobar:this-version"}}},
 		{GoPackage, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.version=${__pkg_version}"}}, nil, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.version=this-version"}}},
 		{GenericPackage, GenericPkgConfig{Commands: [][]string{{"echo", "${__pkg_version}"}}}, nil, GenericPkgConfig{Commands: [][]string{{"echo", "this-version"}}}},
+		{GoPackage, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.buildinfo=${__pkg_buildinfo}"}}, nil, GoPkgConfig{Packaging: GoApp, BuildFlags: []string{"-ldflags", "-X cmd.buildinfo=.gorpa-buildinfo.json"}}},
 	}
 
 	for _, test := range tests {
@@ -176,6 +180,54 @@ func BenchmarkFindCycle(b *testing.B) {
 
 }
 
+func TestComponentDefaultsApply(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Defaults ComponentDefaults
+		Pkg      packageInternal
+		Expected packageInternal
+	}{
+		{
+			Name:     "no defaults",
+			Pkg:      packageInternal{Name: "pkg", Sources: []string{"*.go"}, Dependencies: []string{":dep"}, Environment: []string{"FOO=bar"}},
+			Expected: packageInternal{Name: "pkg", Sources: []string{"*.go"}, Dependencies: []string{":dep"}, Environment: []string{"FOO=bar"}},
+		},
+		{
+			Name:     "merge",
+			Defaults: ComponentDefaults{Sources: []string{"go.mod", "*.go"}, Dependencies: []string{":dep", ":other"}, Environment: []string{"FOO=default"}},
+			Pkg:      packageInternal{Name: "pkg", Sources: []string{"*.go"}, Dependencies: []string{":dep"}},
+			Expected: packageInternal{Name: "pkg", Sources: []string{"go.mod", "*.go"}, Dependencies: []string{":dep", ":other"}, Environment: []string{"FOO=default"}},
+		},
+		{
+			Name:     "package env takes precedence",
+			Defaults: ComponentDefaults{Environment: []string{"FOO=default"}},
+			Pkg:      packageInternal{Name: "pkg", Environment: []string{"FOO=bar"}},
+			Expected: packageInternal{Name: "pkg", Sources: []string{}, Dependencies: []string{}, Environment: []string{"FOO=bar"}},
+		},
+		{
+			Name:     "no self dependency",
+			Defaults: ComponentDefaults{Dependencies: []string{":pkg", "testcomp:pkg", ":dep"}},
+			Pkg:      packageInternal{Name: "pkg"},
+			Expected: packageInternal{Name: "pkg", Sources: []string{}, Dependencies: []string{":dep"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			pkg := NewTestPackage("pkg")
+			pkg.packageInternal = test.Pkg
+
+			err := test.Defaults.apply(pkg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(pkg.packageInternal, test.Expected) {
+				t.Errorf("expected: %+v, actual: %+v", test.Expected, pkg.packageInternal)
+			}
+		})
+	}
+}
+
 func NewTestPackage(name string) *Package {
 	return &Package{
 		C: &Component{
@@ -194,3 +246,181 @@ func NewTestPackage(name string) *Package {
 		Config:       GenericPkgConfig{},
 	}
 }
+
+func TestYarnPkgConfigValidate(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Config YarnPkgConfig
+		Error  string
+	}{
+		{Name: "yarn library", Config: YarnPkgConfig{Packaging: YarnLibrary}},
+		{Name: "npm archive", Config: YarnPkgConfig{Packaging: YarnArchive, PackageManager: NpmPackageManager, PackageLock: "../package-lock.json"}},
+		{Name: "npm app", Config: YarnPkgConfig{Packaging: YarnApp, PackageManager: NpmPackageManager}, Error: "the npm package manager only supports library and archive packaging"},
+		{Name: "npm with yarn lock", Config: YarnPkgConfig{Packaging: YarnLibrary, PackageManager: NpmPackageManager, YarnLock: "yarn.lock"}, Error: "yarnLock is not supported with the npm package manager - use packageLock instead"},
+		{Name: "yarn with package lock", Config: YarnPkgConfig{Packaging: YarnLibrary, PackageLock: "package-lock.json"}, Error: "packageLock is only supported with the npm package manager"},
+		{Name: "unknown package manager", Config: YarnPkgConfig{Packaging: YarnLibrary, PackageManager: "pnpm"}, Error: "unknown package manager: pnpm"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var errmsg string
+			if err := test.Config.Validate(); err != nil {
+				errmsg = err.Error()
+			}
+			if errmsg != test.Error {
+				t.Errorf("expected error %q, got %q", test.Error, errmsg)
+			}
+		})
+	}
+}
+
+func TestGoRaceFlavor(t *testing.T) {
+	ba := &Application{}
+	newPkg := func(cfg GoPkgConfig) *Package {
+		return &Package{
+			C:               &Component{W: ba},
+			packageInternal: packageInternal{Name: "pkg", Type: GoPackage},
+			Config:          cfg,
+			dependencies:    []*Package{},
+		}
+	}
+
+	regular, err := newPkg(GoPkgConfig{Packaging: GoApp}).Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	race, err := newPkg(GoBuildProfile{Race: true}.apply(GoPkgConfig{Packaging: GoApp})).Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regular == race {
+		t.Errorf("race detector build has the same version as the regular build: %s", race)
+	}
+
+	// variants toggle the race detector by merging their config onto the package's
+	pkg := newPkg(GoPkgConfig{Packaging: GoApp})
+	err = mergeConfig(pkg, GoPkgConfig{Race: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant, err := pkg.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variant != race {
+		t.Errorf("race detector variant has version %s, expected %s", variant, race)
+	}
+}
+
+func TestGoBuildProfile(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Profile     GoBuildProfile
+		Config      GoPkgConfig
+		Expectation []string
+	}{
+		{Name: "empty"},
+		{Name: "package config only", Config: GoPkgConfig{BuildTags: []string{"integration"}}, Expectation: []string{"-tags=integration"}},
+		{Name: "profile only", Profile: GoBuildProfile{BuildTags: []string{"b", "a"}, Race: true}, Expectation: []string{"-tags=a,b", "-race"}},
+		{
+			Name:        "merged",
+			Profile:     GoBuildProfile{BuildTags: []string{"netgo", "integration"}},
+			Config:      GoPkgConfig{BuildTags: []string{"integration", "linux"}, Race: true},
+			Expectation: []string{"-tags=integration,linux,netgo", "-race"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Profile.apply(test.Config).goFlags()
+			if !reflect.DeepEqual(act, test.Expectation) {
+				t.Errorf("expected %v, got %v", test.Expectation, act)
+			}
+		})
+	}
+
+	version := func(cfg GoPkgConfig) string {
+		p := testPackage(&Application{}, "pkg", GoPackage)
+		p.Config = cfg
+		v, err := p.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	var (
+		untagged = version(GoPkgConfig{})
+		ab       = version(GoBuildProfile{BuildTags: []string{"a", "b"}}.apply(GoPkgConfig{}))
+		ba       = version(GoBuildProfile{BuildTags: []string{"b"}}.apply(GoPkgConfig{BuildTags: []string{"a"}}))
+	)
+	if untagged == ab {
+		t.Errorf("build tags do not change the version")
+	}
+	if ab != ba {
+		t.Errorf("version depends on the order of the build tags: %s != %s", ab, ba)
+	}
+}
+
+func TestVersionRelevantDefinition(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Definition  string
+		Expectation string
+	}{
+		{
+			Name:        "no irrelevant fields",
+			Definition:  "name: foo\ntype: generic\nsrcs:\n    - \"**\"\n",
+			Expectation: "name: foo\ntype: generic\nsrcs:\n    - \"**\"\n",
+		},
+		{
+			Name:        "resource limits",
+			Definition:  "name: foo\nresources:\n    memory: 4G\n    cpus: 2\n    pids: 1024\ntype: generic\n",
+			Expectation: "name: foo\ntype: generic\n",
+		},
+		{
+			Name:        "scheduling",
+			Definition:  "name: foo\nresources:\n    cpus: 8\n    exclusive: true\n",
+			Expectation: "name: foo\n",
+		},
+		{
+			Name:        "test retries",
+			Definition:  "name: foo\ntestRetry:\n    retries: 2\n    quarantine: true\n",
+			Expectation: "name: foo\n",
+		},
+		{
+			Name:        "hooks",
+			Definition:  "name: foo\nhooks:\n    postBuild:\n        - - echo\n          - done\n",
+			Expectation: "name: foo\n",
+		},
+		{
+			Name:        "timeouts",
+			Definition:  "name: foo\ntimeout:\n    build: 30m\ntype: go\n",
+			Expectation: "name: foo\ntype: go\n",
+		},
+		{
+			Name:        "config fields of the same name",
+			Definition:  "name: foo\nconfig:\n    resources:\n        memory: 4G\n",
+			Expectation: "name: foo\nconfig:\n    resources:\n        memory: 4G\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(test.Definition), &node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			act, err := yaml.Marshal(versionRelevantDefinition(node.Content[0]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, string(act)); diff != "" {
+				t.Errorf("unexpected definition (-want +got):\n%s", diff)
+			}
+
+			orig, _ := yaml.Marshal(&node)
+			if diff := cmp.Diff(test.Definition, string(orig)); diff != "" {
+				t.Errorf("the original definition was modified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// packageLogSuffix is appended to the artifact version to name the log of a package build in the remote cache
+	packageLogSuffix = ".log"
+
+	// DefaultConciseLogLines is the number of lines of a failed package build the ConciseReporter shows
+	DefaultConciseLogLines = 30
+
+	// conciseLogLimit is the number of bytes of output the ConciseReporter keeps per package build
+	conciseLogLimit = 64 * 1024
+)
+
+// PackageLogOptions configures the log files of package builds
+type PackageLogOptions struct {
+	// Enabled writes the full output of each package build to a file in the logs directory of the build directory,
+	// see PackageLogLocation
+	Enabled bool
+	// Remote is the remote cache the logs of newly built packages are uploaded to, next to their artifacts.
+	// If nil, the logs are kept locally only.
+	Remote RemoteCache
+}
+
+// WithPackageLogs writes the output of each package build to a log file
+func WithPackageLogs(logs PackageLogOptions) BuildOption {
+	return func(opts *buildOptions) error {
+		if logs.Remote != nil {
+			if _, ok := logs.Remote.(objectStore); !ok {
+				return xerrors.Errorf("the remote cache cannot store package logs")
+			}
+		}
+		opts.PackageLogs = logs
+		return nil
+	}
+}
+
+// buildDirLocation returns the directory packages are built in
+func buildDirLocation() string {
+	buildDir := os.Getenv(EnvvarBuildDir)
+	if buildDir == "" {
+		buildDir = filepath.Join(os.TempDir(), "build")
+	}
+	return buildDir
+}
+
+// PackageLogLocation returns the file the output of the latest build of a package is written to
+func PackageLogLocation(pkg *Package) string {
+	return filepath.Join(buildDirLocation(), "logs", pkg.FilesystemSafeName()+".log")
+}
+
+// packageLogReporter writes the output of each package build to its own log file. Every build of a package
+// replaces the log of its previous build.
+type packageLogReporter struct {
+	mu    sync.Mutex
+	files map[*Package]*os.File
+	times map[*Package]time.Time
+}
+
+func newPackageLogReporter() *packageLogReporter {
+	return &packageLogReporter{
+		files: make(map[*Package]*os.File),
+		times: make(map[*Package]time.Time),
+	}
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *packageLogReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *packageLogReporter) BuildFinished(pkg *Package, err error) {}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *packageLogReporter) PackageBuildStarted(pkg *Package) {
+	fn := PackageLogLocation(pkg)
+	err := os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		log.WithError(err).WithField("package", pkg.FullName()).Warn("cannot write package log")
+		return
+	}
+	f, err := os.Create(fn)
+	if err != nil {
+		log.WithError(err).WithField("package", pkg.FullName()).Warn("cannot write package log")
+		return
+	}
+	version, err := pkg.Version()
+	if err != nil {
+		version = "unknown"
+	}
+	now := time.Now()
+	fmt.Fprintf(f, "# %s (version %s), build started %s\n", pkg.FullName(), version, now.Format(time.RFC3339))
+
+	r.mu.Lock()
+	r.files[pkg] = f
+	r.times[pkg] = now
+	r.mu.Unlock()
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *packageLogReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.files[pkg]; ok {
+		_, _ = f.Write(buf)
+	}
+}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *packageLogReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	f, ok := r.files[pkg]
+	dur := time.Since(r.times[pkg])
+	delete(r.files, pkg)
+	delete(r.times, pkg)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(f, "\n# build failed after %.2fs: %s\n", dur.Seconds(), err)
+	} else {
+		fmt.Fprintf(f, "\n# build succeeded in %.2fs\n", dur.Seconds())
+	}
+	f.Close()
+}
+
+// uploadPackageLogs uploads the logs of the packages to the remote cache, named like their artifacts.
+// Like all remote cache transfers, uploading the logs is best effort.
+func (c *buildContext) uploadPackageLogs(pkgs []*Package) {
+	if c.PackageLogs.Remote == nil {
+		return
+	}
+
+	objs := make(map[string]string, len(pkgs))
+	for _, p := range pkgs {
+		artifact, exists := c.LocalCache.Location(p)
+		if !exists {
+			continue
+		}
+		fn := PackageLogLocation(p)
+		if _, err := os.Stat(fn); err != nil {
+			continue
+		}
+		objs[strings.TrimSuffix(filepath.Base(artifact), ".tar.gz")+packageLogSuffix] = fn
+	}
+	if len(objs) == 0 {
+		return
+	}
+	c.PackageLogs.Remote.(objectStore).putObjects(objs)
+}
+
+// NewConciseReporter produces a reporter which forwards all calls to rep, except the output of package builds:
+// rep receives only the last lines of the output of failed package builds, and where to find their full log.
+func NewConciseReporter(rep Reporter) *ConciseReporter {
+	return &ConciseReporter{
+		Reporter: rep,
+		Lines:    DefaultConciseLogLines,
+		output:   make(map[*Package][]byte),
+	}
+}
+
+// ConciseReporter keeps the console output of a build short. Use NewConciseReporter to create an instance.
+type ConciseReporter struct {
+	Reporter
+	// Lines is the number of lines of the output of a failed package build which are forwarded
+	Lines int
+
+	mu     sync.Mutex
+	output map[*Package][]byte
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *ConciseReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := append(r.output[pkg], buf...)
+	if len(out) > conciseLogLimit {
+		out = out[len(out)-conciseLogLimit:]
+	}
+	r.output[pkg] = out
+}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *ConciseReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	out := r.output[pkg]
+	delete(r.output, pkg)
+	r.mu.Unlock()
+
+	if err != nil && len(out) > 0 {
+		r.Reporter.PackageBuildLog(pkg, true, tailLines(out, r.Lines))
+		r.Reporter.PackageBuildLog(pkg, true, []byte(fmt.Sprintf("full log: %s\n", PackageLogLocation(pkg))))
+	}
+	r.Reporter.PackageBuildFinished(pkg, err)
+}
+
+// PackageTestsFlaky is called when the tests of a package failed before they passed on a retry, or when the
+// tests of a quarantined package failed in all attempts.
+func (r *ConciseReporter) PackageTestsFlaky(pkg *Package, attempts int, quarantined bool, err error) {
+	reportFlakyTests(r.Reporter, pkg, attempts, quarantined, err)
+}
+
+// BuildPhaseStarted is called when a phase of a package build starts.
+func (r *ConciseReporter) BuildPhaseStarted(pkg *Package, phase BuildPhase) {
+	if rep, ok := r.Reporter.(BuildPhaseReporter); ok {
+		rep.BuildPhaseStarted(pkg, phase)
+	}
+}
+
+// BuildPhaseFinished is called when a phase of a package build has finished.
+func (r *ConciseReporter) BuildPhaseFinished(pkg *Package, phase BuildPhase) {
+	if rep, ok := r.Reporter.(BuildPhaseReporter); ok {
+		rep.BuildPhaseFinished(pkg, phase)
+	}
+}
+
+// tailLines returns the last n lines of out, which always ends in a newline
+func tailLines(out []byte, n int) []byte {
+	out = bytes.TrimRight(out, "\n")
+	lines := bytes.Split(out, []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
@@ -0,0 +1,62 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPackageLogs(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	pkg := testPackage(&Application{}, "broken", GenericPackage)
+	pkg.Config = GenericPkgConfig{Commands: [][]string{{"sh", "-c", "echo one; echo two; echo three; exit 1"}}}
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := &shardReporter{Reporter: NewMetricsReporter(cache)}
+	rep := NewConciseReporter(console)
+	rep.Lines = 2
+
+	err = Build(pkg, WithLocalCache(cache), WithReporter(rep), WithPackageLogs(PackageLogOptions{Enabled: true}))
+	if err == nil {
+		t.Fatal("expected the build to fail")
+	}
+
+	fc, err := ioutil.ReadFile(PackageLogLocation(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log := string(fc); !strings.Contains(log, "one\ntwo\nthree\n") || !strings.Contains(log, "# build failed") {
+		t.Errorf("unexpected package log:\n%s", log)
+	}
+
+	var printed string
+	for _, e := range console.log {
+		printed += string(e.Buf)
+	}
+	if expectation := "two\nthree\nfull log: " + PackageLogLocation(pkg) + "\n"; printed != expectation {
+		t.Errorf("unexpected console output: got %q, expected %q", printed, expectation)
+	}
+}
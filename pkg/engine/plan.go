@@ -0,0 +1,554 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gookit/color"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// ObjectStatter is implemented by remote caches which can tell whether they hold an object, and how big it is,
+// without downloading it
+type ObjectStatter interface {
+	// StatObjects returns the size of the objects the cache holds, keyed by name. Objects which the cache
+	// does not hold are missing from sizes, objects whose existence the cache cannot tell are listed in failed.
+	StatObjects(names []string) (sizes map[string]int64, failed map[string]error)
+}
+
+// statObjectsWith stats the objects concurrently using the transfer options of a remote cache
+func statObjectsWith(opts TransferOptions, names []string, stat func(ctx context.Context, name string) (int64, error)) (sizes map[string]int64, failed map[string]error) {
+	var mu sync.Mutex
+	sizes = make(map[string]int64, len(names))
+	failed = make(map[string]error)
+
+	transfers := make([]fileTransfer, 0, len(names))
+	for _, n := range names {
+		transfers = append(transfers, fileTransfer{Src: n})
+	}
+	transferFiles(opts, transfers, func(ctx context.Context, name, _ string) error {
+		size, err := stat(ctx, name)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			sizes[name] = size
+			delete(failed, name)
+		} else if err != ErrTransferNotFound {
+			failed[name] = err
+		}
+		return err
+	})
+	return sizes, failed
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (NoRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	return map[string]int64{}, map[string]error{}
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs HTTPRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	return statObjectsWith(rs.Transfer, names, func(ctx context.Context, name string) (int64, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, rs.objectURL(name), nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return 0, ErrTransferNotFound
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, xerrors.Errorf("HEAD %s: %s", name, resp.Status)
+		}
+		return resp.ContentLength, nil
+	})
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs MinioRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	client, err := rs.Config.newClient()
+	if err != nil {
+		failed := make(map[string]error, len(names))
+		for _, n := range names {
+			failed[n] = err
+		}
+		return map[string]int64{}, failed
+	}
+	return statObjectsWith(rs.Transfer, names, func(ctx context.Context, name string) (int64, error) {
+		info, err := client.StatObject(ctx, rs.BucketName, name, minio.StatObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, ErrTransferNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		return info.Size, nil
+	})
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs GSUtilRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	return statObjectsWith(rs.Transfer, names, func(ctx context.Context, name string) (int64, error) {
+		// gsutil ls -l prints "<size>  <time>  <url>" for each object, followed by a total
+		out, err := statCommandOutput(ctx, gsutilNotFound, "gsutil", "ls", "-l", fmt.Sprintf("gs://%s/%s", rs.BucketName, name))
+		if err != nil {
+			return 0, err
+		}
+		return parseSizeField(out, 0)
+	})
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs SSHRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	host, dir := rs.splitLocation()
+	return statObjectsWith(rs.Transfer, names, func(ctx context.Context, name string) (int64, error) {
+		fn := path.Join(dir, name)
+		if rs.Protocol == SSHProtocolSFTP {
+			// sftp's ls -l prints the size in the fifth column, like ls does
+			args := append(append([]string{"-q", "-b", "-"}, rs.SSHOptions...), host)
+			out, err := statCommandOutputWithInput(ctx, sftpNotFound, strings.NewReader(fmt.Sprintf("ls -l %q\n", fn)), "sftp", args...)
+			if err != nil {
+				return 0, err
+			}
+			return parseSizeField(out, 4)
+		}
+
+		args := append(append([]string{}, rs.SSHOptions...), host, "stat", "-c", "%s", fn)
+		out, err := statCommandOutput(ctx, []string{"No such file or directory"}, "ssh", args...)
+		if err != nil {
+			return 0, err
+		}
+		return parseSizeField(out, 0)
+	})
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs EncryptedRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	// encrypted artifacts are slightly bigger than the plaintext ones, which is good enough for an estimate
+	return StatRemoteObjects(rs.C, names)
+}
+
+// StatObjects tells which artifacts the remote cache holds
+func (rs *DeltaRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	sizes, failed := StatRemoteObjects(rs.C, names)
+
+	// artifacts which are not available in full may be reconstructed from a delta, whose size we cannot tell
+	var manifests []string
+	for _, n := range names {
+		if _, ok := sizes[n]; ok {
+			continue
+		}
+		if _, ok := failed[n]; ok {
+			continue
+		}
+		manifests = append(manifests, strings.TrimSuffix(n, ".tar.gz")+deltaManifestSuffix)
+	}
+	if len(manifests) == 0 {
+		return sizes, failed
+	}
+	msizes, mfailed := StatRemoteObjects(rs.C, manifests)
+	for _, n := range names {
+		mf := strings.TrimSuffix(n, ".tar.gz") + deltaManifestSuffix
+		if _, ok := msizes[mf]; ok {
+			sizes[n] = -1
+		} else if err, ok := mfailed[mf]; ok {
+			failed[n] = err
+		}
+	}
+	return sizes, failed
+}
+
+// StatRemoteObjects stats the objects if the remote cache supports it, and fails all of them otherwise
+func StatRemoteObjects(rc RemoteCache, names []string) (map[string]int64, map[string]error) {
+	if s, ok := rc.(ObjectStatter); ok {
+		return s.StatObjects(names)
+	}
+	failed := make(map[string]error, len(names))
+	for _, n := range names {
+		failed[n] = xerrors.Errorf("%s cannot tell which artifacts it holds", RemoteCacheName(rc))
+	}
+	return map[string]int64{}, failed
+}
+
+func statCommandOutput(ctx context.Context, notFound []string, name string, args ...string) (string, error) {
+	return statCommandOutputWithInput(ctx, notFound, nil, name, args...)
+}
+
+func statCommandOutputWithInput(ctx context.Context, notFound []string, stdin io.Reader, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err == nil {
+		return string(out), nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	for _, marker := range notFound {
+		if strings.Contains(string(out), marker) || strings.Contains(stderr.String(), marker) {
+			return "", ErrTransferNotFound
+		}
+	}
+	return "", xerrors.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+}
+
+// parseSizeField parses the field of the first output line which has one as size
+func parseSizeField(out string, field int) (int64, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) <= field {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[field], 10, 64)
+		if err != nil {
+			continue
+		}
+		return size, nil
+	}
+	return 0, xerrors.Errorf("cannot find the size in %q", out)
+}
+
+// PlanStatus describes what a build does with a package
+type PlanStatus string
+
+const (
+	// PlanCached means the artifact is in the local cache already
+	PlanCached PlanStatus = "cached"
+	// PlanDownload means the artifact is downloaded from a remote cache
+	PlanDownload PlanStatus = "download"
+	// PlanBuild means the package is built
+	PlanBuild PlanStatus = "build"
+	// PlanUnknown means the remote caches cannot tell whether they hold the artifact, i.e. it is either downloaded or built
+	PlanUnknown PlanStatus = "unknown"
+	// PlanSkipped means the package is not built because it was filtered from the build
+	PlanSkipped PlanStatus = "skipped"
+)
+
+// PlannedPackage is a package of a build plan
+type PlannedPackage struct {
+	Package string     `json:"package"`
+	Version string     `json:"version"`
+	Status  PlanStatus `json:"status"`
+	// Size is the size of the artifact to download, or -1 if the remote cache cannot tell
+	Size ByteSize `json:"size,omitempty"`
+	// Remote is the remote cache the artifact is downloaded from
+	Remote string `json:"remote,omitempty"`
+	// Dependencies are the direct dependencies of the package
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// BuildPlan describes what a build does
+type BuildPlan struct {
+	// Steps are the packages to build in order, where the packages of a step can be built in parallel
+	Steps    [][]string       `json:"steps"`
+	Packages []PlannedPackage `json:"packages"`
+	// DownloadSize is the total size of the artifacts to download as far as the remote caches can tell
+	DownloadSize ByteSize `json:"downloadSize"`
+}
+
+// remoteArtifact is an artifact a remote cache holds
+type remoteArtifact struct {
+	Remote string
+	Size   int64
+}
+
+// queryRemoteCaches finds out which remote cache holds the artifacts of packages which are not in the local cache,
+// without downloading them. Packages whose availability no remote cache can tell are returned as unknown.
+func (c *buildContext) queryRemoteCaches(pkgs []*Package) (available map[*Package]remoteArtifact, unknown map[*Package]struct{}) {
+	available = make(map[*Package]remoteArtifact)
+	unknown = make(map[*Package]struct{})
+
+	names := make(map[string]*Package)
+	for _, p := range pkgs {
+		fn, exists := c.LocalCache.Location(p)
+		if exists || fn == "" {
+			continue
+		}
+		names[filepath.Base(fn)] = p
+	}
+
+	for _, rc := range append([]RemoteCache{c.RemoteCache}, c.AdditionalRemoteCaches...) {
+		if len(names) == 0 {
+			break
+		}
+		query := make([]string, 0, len(names))
+		for n := range names {
+			query = append(query, n)
+		}
+		sizes, failed := StatRemoteObjects(rc, query)
+		for n, size := range sizes {
+			p := names[n]
+			available[p] = remoteArtifact{Remote: RemoteCacheName(rc), Size: size}
+			delete(unknown, p)
+			delete(names, n)
+		}
+		for n, err := range failed {
+			log.WithError(err).WithField("package", names[n].FullName()).Debug("cannot query remote cache")
+			unknown[names[n]] = struct{}{}
+		}
+	}
+	return available, unknown
+}
+
+// newBuildPlan annotates the packages of a build with what the build does with them. Downloads are the
+// artifacts the remote caches hold during a dry run, and the ones which were downloaded otherwise.
+func newBuildPlan(pkg *Package, allpkg []*Package, status map[*Package]PackageBuildStatus, remote map[*Package]remoteArtifact, unknown map[*Package]struct{}) (*BuildPlan, error) {
+	steps, err := buildSteps(pkg, status)
+	if err != nil {
+		return nil, err
+	}
+	res := &BuildPlan{Steps: steps}
+	for _, p := range allpkg {
+		version, err := p.Version()
+		if err != nil {
+			return nil, err
+		}
+		pp := PlannedPackage{Package: p.FullName(), Version: version}
+		for _, dep := range p.GetDependencies() {
+			pp.Dependencies = append(pp.Dependencies, dep.FullName())
+		}
+		sort.Strings(pp.Dependencies)
+		ra, downloaded := remote[p]
+		_, maybeDownloaded := unknown[p]
+		switch {
+		case status[p] == PackageSkipped:
+			pp.Status = PlanSkipped
+		case status[p] == PackageBuilt && downloaded:
+			pp.Status, pp.Size, pp.Remote = PlanDownload, ByteSize(ra.Size), ra.Remote
+			if ra.Size > 0 {
+				res.DownloadSize += ByteSize(ra.Size)
+			}
+		case status[p] == PackageBuilt:
+			pp.Status = PlanCached
+		case maybeDownloaded && !p.Ephemeral:
+			pp.Status = PlanUnknown
+		default:
+			pp.Status = PlanBuild
+		}
+		res.Packages = append(res.Packages, pp)
+	}
+	sort.Slice(res.Packages, func(i, j int) bool { return res.Packages[i].Package < res.Packages[j].Package })
+	return res, nil
+}
+
+// Write writes the steps of the plan as JSON
+func (p *BuildPlan) Write(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Steps)
+}
+
+// WriteAnnotated writes the plan as JSON, including the status of every package and the download size
+func (p *BuildPlan) WriteAnnotated(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// BuildPlanFormat is the format a build plan is written in
+type BuildPlanFormat string
+
+const (
+	// BuildPlanJSON writes the steps of the plan as JSON, which is the default
+	BuildPlanJSON BuildPlanFormat = "json"
+	// BuildPlanAnnotated writes the plan as JSON, including the status of every package
+	BuildPlanAnnotated BuildPlanFormat = "annotated"
+	// BuildPlanDot writes the package graph of the plan in Graphviz's dot format
+	BuildPlanDot BuildPlanFormat = "dot"
+	// BuildPlanMermaid writes the package graph of the plan as Mermaid flowchart
+	BuildPlanMermaid BuildPlanFormat = "mermaid"
+)
+
+func (f BuildPlanFormat) valid() bool {
+	switch f {
+	case "", BuildPlanJSON, BuildPlanAnnotated, BuildPlanDot, BuildPlanMermaid:
+		return true
+	default:
+		return false
+	}
+}
+
+// planStatusColors are the fill colors of the packages in the graph formats
+var planStatusColors = map[PlanStatus]string{
+	PlanCached:   "#c8e6c9",
+	PlanDownload: "#bbdefb",
+	PlanBuild:    "#ffe0b2",
+	PlanUnknown:  "#eeeeee",
+	PlanSkipped:  "#ffffff",
+}
+
+// WriteAs writes the plan in the given format
+func (p *BuildPlan) WriteAs(out io.Writer, format BuildPlanFormat) error {
+	switch format {
+	case "", BuildPlanJSON:
+		return p.Write(out)
+	case BuildPlanAnnotated:
+		return p.WriteAnnotated(out)
+	case BuildPlanDot:
+		return p.WriteDot(out)
+	case BuildPlanMermaid:
+		return p.WriteMermaid(out)
+	default:
+		return xerrors.Errorf("unknown build plan format %q", format)
+	}
+}
+
+// WriteDot writes the package graph of the plan in Graphviz's dot format, colored by the status of the packages
+func (p *BuildPlan) WriteDot(out io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph G {\n  node [shape=box, style=filled];\n")
+	for _, pp := range p.Packages {
+		fmt.Fprintf(&b, "  %q [label=%q, fillcolor=%q];\n", pp.Package, pp.Package+"\n"+pp.statusLabel(), planStatusColors[pp.Status])
+	}
+	for _, pp := range p.Packages {
+		for _, dep := range pp.Dependencies {
+			fmt.Fprintf(&b, "  %q -> %q;\n", pp.Package, dep)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// WriteMermaid writes the package graph of the plan as Mermaid flowchart, colored by the status of the packages
+func (p *BuildPlan) WriteMermaid(out io.Writer) error {
+	// Mermaid node IDs cannot contain the colons and slashes of package names
+	ids := make(map[string]string, len(p.Packages))
+	for i, pp := range p.Packages {
+		ids[pp.Package] = fmt.Sprintf("p%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	for _, pp := range p.Packages {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>%s\"]:::%s\n", ids[pp.Package], pp.Package, pp.statusLabel(), pp.Status)
+	}
+	for _, pp := range p.Packages {
+		for _, dep := range pp.Dependencies {
+			if _, ok := ids[dep]; !ok {
+				continue
+			}
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[pp.Package], ids[dep])
+		}
+	}
+	for _, status := range []PlanStatus{PlanCached, PlanDownload, PlanBuild, PlanUnknown, PlanSkipped} {
+		fmt.Fprintf(&b, "  classDef %s fill:%s,stroke:#616161,color:#000000\n", status, planStatusColors[status])
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// statusLabel describes the status of the package in a few words
+func (pp PlannedPackage) statusLabel() string {
+	switch pp.Status {
+	case PlanDownload:
+		if pp.Size < 0 {
+			return "download"
+		}
+		return fmt.Sprintf("download (%s)", pp.Size)
+	case PlanUnknown:
+		return "download or build"
+	default:
+		return string(pp.Status)
+	}
+}
+
+// Print prints the plan for humans
+func (p *BuildPlan) Print(out io.Writer) {
+	count := make(map[PlanStatus]int)
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	for _, pp := range p.Packages {
+		count[pp.Status]++
+		version := color.Gray.Sprintf("(version %s)", pp.Version)
+		switch pp.Status {
+		case PlanCached:
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", color.Green.Sprint("📦\tcached"), pp.Package, version)
+		case PlanDownload:
+			size := "size unknown"
+			if pp.Size >= 0 {
+				size = pp.Size.String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s %s\n", color.Cyan.Sprint("☁️\tdownload"), pp.Package, version, color.Gray.Sprintf("%s from %s", size, pp.Remote))
+		case PlanUnknown:
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", color.Yellow.Sprint("❔\tdownload or build"), pp.Package, version)
+		case PlanSkipped:
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", color.Gray.Sprint("⏩\tskipped"), pp.Package, version)
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", color.Yellow.Sprint("🔧\tbuild"), pp.Package, version)
+		}
+	}
+	tw.Flush()
+
+	summary := fmt.Sprintf("\n%d to build, %d to download (%s), %d cached", count[PlanBuild], count[PlanDownload], p.DownloadSize, count[PlanCached])
+	if count[PlanUnknown] > 0 {
+		summary += fmt.Sprintf(", %d to download or build", count[PlanUnknown])
+	}
+	if count[PlanSkipped] > 0 {
+		summary += fmt.Sprintf(", %d skipped", count[PlanSkipped])
+	}
+	fmt.Fprintln(out, summary)
+}
+
+// collectDownloads adds the packages which a remote cache downloaded to the local cache to downloads
+func collectDownloads(local Cache, rc RemoteCache, pkgs []*Package, cached map[*Package]bool, downloads map[*Package]remoteArtifact) {
+	for _, p := range pkgs {
+		if cached[p] {
+			continue
+		}
+		fn, exists := local.Location(p)
+		if !exists {
+			continue
+		}
+		downloads[p] = remoteArtifact{Remote: RemoteCacheName(rc), Size: artifactSize(fn)}
+	}
+}
+
+// artifactSize returns the size of a file, or zero if it doesn't exist
+func artifactSize(fn string) int64 {
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
@@ -0,0 +1,216 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func (rc dirRemoteCache) StatObjects(names []string) (map[string]int64, map[string]error) {
+	sizes := make(map[string]int64)
+	for _, n := range names {
+		stat, err := os.Stat(filepath.Join(rc.Dir, n))
+		if err != nil {
+			continue
+		}
+		sizes[n] = stat.Size()
+	}
+	return sizes, map[string]error{}
+}
+
+// blindRemoteCache is a remote cache which cannot tell which artifacts it holds
+type blindRemoteCache struct{}
+
+func (blindRemoteCache) Download(dst Cache, pkgs []*Package) error { return nil }
+
+func (blindRemoteCache) Upload(src Cache, pkgs []*Package) error { return nil }
+
+func TestBuildPlan(t *testing.T) {
+	var (
+		ba  = &Application{}
+		pkg = func(name string, deps ...*Package) *Package {
+			return testPackage(ba, name, GenericPackage, deps...)
+		}
+		cached       = pkg("cached")
+		remote       = pkg("remote")
+		unknown      = pkg("unknown")
+		target       = pkg("target", cached, remote, unknown)
+		local        = &FilesystemCache{Origin: t.TempDir()}
+		remoteDir    = dirRemoteCache{Dir: t.TempDir()}
+		requirements = []*Package{cached, remote, unknown}
+	)
+	for _, p := range []*Package{cached, remote} {
+		fn, _ := local.Location(p)
+		err := ioutil.WriteFile(fn, []byte("artifact"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := remoteDir.Upload(local, []*Package{remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, _ := local.Location(remote)
+	err = os.Remove(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &buildContext{buildOptions: buildOptions{
+		LocalCache:             local,
+		RemoteCache:            remoteDir,
+		AdditionalRemoteCaches: []RemoteCache{blindRemoteCache{}},
+	}}
+	available, remoteUnknown := ctx.queryRemoteCaches(requirements)
+	status := map[*Package]PackageBuildStatus{
+		cached:  PackageBuilt,
+		remote:  PackageBuilt,
+		unknown: PackageNotBuiltYet,
+		target:  PackageNotBuiltYet,
+	}
+	plan, err := newBuildPlan(target, append(requirements, target), status, available, remoteUnknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	act := make(map[string]PlanStatus)
+	for _, pp := range plan.Packages {
+		act[pp.Package] = pp.Status
+		if pp.Package == remote.FullName() && (pp.Size != 8 || pp.Remote != RemoteCacheName(remoteDir)) {
+			t.Errorf("unexpected download of %s: %d bytes from %s", pp.Package, pp.Size, pp.Remote)
+		}
+	}
+	expectation := map[string]PlanStatus{
+		cached.FullName():  PlanCached,
+		remote.FullName():  PlanDownload,
+		unknown.FullName(): PlanUnknown,
+		target.FullName():  PlanBuild,
+	}
+	if !reflect.DeepEqual(act, expectation) {
+		t.Errorf("unexpected plan: %v, expected %v", act, expectation)
+	}
+	if plan.DownloadSize != 8 {
+		t.Errorf("unexpected download size %d", plan.DownloadSize)
+	}
+	if expSteps := [][]string{{unknown.FullName()}, {target.FullName()}}; !reflect.DeepEqual(plan.Steps, expSteps) {
+		t.Errorf("unexpected steps %v, expected %v", plan.Steps, expSteps)
+	}
+}
+
+func TestBuildPlanGraph(t *testing.T) {
+	plan := &BuildPlan{Steps: [][]string{{"comp:app"}}, Packages: []PlannedPackage{
+		{Package: "comp:app", Status: PlanBuild, Dependencies: []string{"lib/a:pkg"}},
+		{Package: "lib/a:pkg", Status: PlanDownload, Size: 2048},
+	}}
+
+	tests := []struct {
+		Format      BuildPlanFormat
+		Expectation []string
+	}{
+		{
+			Format:      BuildPlanJSON,
+			Expectation: []string{"[\n  [\n    \"comp:app\"\n  ]\n]\n"},
+		},
+		{
+			Format:      BuildPlanAnnotated,
+			Expectation: []string{`"steps": [`, `"package": "lib/a:pkg"`, `"status": "download"`},
+		},
+		{
+			Format: BuildPlanDot,
+			Expectation: []string{
+				`"comp:app" [label="comp:app\nbuild", fillcolor="#ffe0b2"];`,
+				`"lib/a:pkg" [label="lib/a:pkg\ndownload (2.0 KiB)", fillcolor="#bbdefb"];`,
+				`"comp:app" -> "lib/a:pkg";`,
+			},
+		},
+		{
+			Format: BuildPlanMermaid,
+			Expectation: []string{
+				`p0["comp:app<br/>build"]:::build`,
+				`p1["lib/a:pkg<br/>download (2.0 KiB)"]:::download`,
+				`p0 --> p1`,
+				`classDef download fill:#bbdefb`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.Format), func(t *testing.T) {
+			var out bytes.Buffer
+			err := plan.WriteAs(&out, test.Format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, exp := range test.Expectation {
+				if !strings.Contains(out.String(), exp) {
+					t.Errorf("expected %q in\n%s", exp, out.String())
+				}
+			}
+		})
+	}
+
+	if err := plan.WriteAs(&bytes.Buffer{}, "svg"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	var (
+		loc = t.TempDir()
+		pkg = testPackage(&Application{}, "pkg", GenericPackage)
+		rep = NewRecordingReporter(loc)
+	)
+	pkg.Config = GenericPkgConfig{Commands: [][]string{{"false"}}}
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plan, printed bytes.Buffer
+	err = Build(pkg, WithLocalCache(cache), WithReporter(rep), WithHumanOutput(&printed), WithDryRun(true), WithBuildPlan(&plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(printed.String(), "1 to build") {
+		t.Errorf("a dry run must print the plan, got %q", printed)
+	}
+	if exp := "[\n  [\n    \"comp:pkg\"\n  ]\n]\n"; plan.String() != exp {
+		t.Errorf("unexpected build plan %q, expected %q", plan.String(), exp)
+	}
+	if _, exists := cache.Location(pkg); exists {
+		t.Errorf("a dry run must not build the package")
+	}
+
+	fc, err := ioutil.ReadFile(filepath.Join(loc, BuildReportFilename))
+	if err != nil {
+		t.Fatalf("a dry run must report the build: %v", err)
+	}
+	if !strings.Contains(string(fc), `"target": "comp:pkg"`) {
+		t.Errorf("unexpected build report:\n%s", fc)
+	}
+}
@@ -0,0 +1,296 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+)
+
+// PluginAPIVersion is the version of the protocol Bhojpur GoRPA speaks with package plugins
+const PluginAPIVersion = 1
+
+// PluginPhase is the reason a plugin is invoked
+type PluginPhase string
+
+const (
+	// PluginPhaseSchema asks the plugin for the JSON schema of its package config
+	PluginPhaseSchema PluginPhase = "schema"
+	// PluginPhaseVersion asks the plugin for inputs which influence the package version in addition to
+	// the package definition, sources and dependencies. It's invoked whenever the application is loaded.
+	PluginPhaseVersion PluginPhase = "version"
+	// PluginPhaseBuild asks the plugin for the commands that build, test and package the package
+	PluginPhaseBuild PluginPhase = "build"
+)
+
+// PackagePlugin is an external executable or gRPC server which implements the build of plugin packages.
+//
+// An executable plugin is invoked with the phase as last argument. It receives a PluginRequest as JSON on stdin
+// and must print a PluginResponse as JSON to stdout. Anything it prints to stderr is reported if it fails.
+// A gRPC plugin implements the PluginServer service (see RegisterPluginServer).
+type PackagePlugin struct {
+	// Command is the plugin executable and its arguments. Paths containing a slash are relative to the
+	// application root, otherwise the executable is looked up in the PATH.
+	Command []string `yaml:"command,omitempty"`
+	// Address is the gRPC endpoint of a plugin server, e.g. localhost:9000 or unix:///run/plugin.sock.
+	// Plugins have either a command or an address.
+	Address string `yaml:"address,omitempty"`
+
+	Name           string `yaml:"-"`
+	executable     string
+	executableHash string
+	conn           *grpc.ClientConn
+}
+
+// resolve finds the plugin executable or connects to the plugin server. If the executable is part of the
+// application, its hash becomes part of the version of all packages built using the plugin.
+func (pp *PackagePlugin) resolve(application *Application) error {
+	if pp.Address != "" {
+		if len(pp.Command) > 0 {
+			return xerrors.Errorf("plugin %s: command and address are mutually exclusive", pp.Name)
+		}
+		conn, err := dialPlugin(pp.Address)
+		if err != nil {
+			return xerrors.Errorf("plugin %s: %w", pp.Name, err)
+		}
+		pp.conn = conn
+		return nil
+	}
+	if len(pp.Command) == 0 {
+		return xerrors.Errorf("plugin %s: command or address is required", pp.Name)
+	}
+
+	exe := pp.Command[0]
+	if strings.Contains(exe, "/") {
+		if !filepath.IsAbs(exe) {
+			exe = filepath.Join(application.Origin, exe)
+		}
+		if _, err := os.Stat(exe); err != nil {
+			return xerrors.Errorf("plugin %s: %w", pp.Name, err)
+		}
+	} else {
+		var err error
+		exe, err = exec.LookPath(exe)
+		if err != nil {
+			return xerrors.Errorf("plugin %s: %w", pp.Name, err)
+		}
+	}
+	pp.executable = exe
+
+	if strings.HasPrefix(exe, application.Origin+"/") {
+		hash, err := sha256Hash(exe)
+		if err != nil {
+			return xerrors.Errorf("plugin %s: %w", pp.Name, err)
+		}
+		pp.executableHash = hash
+	}
+	return nil
+}
+
+// Executable returns the resolved path of the plugin executable, or an empty string for gRPC plugins
+func (pp *PackagePlugin) Executable() string {
+	return pp.executable
+}
+
+// PluginRequest is sent to a plugin on stdin
+type PluginRequest struct {
+	APIVersion int                `json:"apiVersion"`
+	Phase      PluginPhase        `json:"phase"`
+	Package    *PluginPackageInfo `json:"package,omitempty"`
+	Build      *PluginBuildInfo   `json:"build,omitempty"`
+}
+
+// PluginPackageInfo describes the package a plugin works on
+type PluginPackageInfo struct {
+	Name      string `json:"name"`
+	FullName  string `json:"fullName"`
+	Component string `json:"component"`
+	// Origin is the absolute path of the package's component
+	Origin string `json:"origin"`
+	// Sources are the absolute paths of the package sources
+	Sources []string `json:"sources"`
+	// Config is the package config without the plugin field
+	Config      map[string]interface{} `json:"config"`
+	Environment []string               `json:"env,omitempty"`
+}
+
+// PluginBuildInfo describes the build a plugin plans the commands for
+type PluginBuildInfo struct {
+	// Dir is the build directory. All commands run in this directory, which holds a copy of
+	// the package sources and the dependencies at their layout location.
+	Dir string `json:"dir"`
+	// Result is where the package commands must place the gzipped tar build artifact. If the
+	// plugin returns no package commands, the whole build directory is archived.
+	Result       string                  `json:"result"`
+	DontTest     bool                    `json:"dontTest"`
+	Dependencies []PluginBuildDependency `json:"dependencies,omitempty"`
+}
+
+// PluginBuildDependency is a dependency of the package which is built
+type PluginBuildDependency struct {
+	FullName string      `json:"fullName"`
+	Type     PackageType `json:"type"`
+	Version  string      `json:"version"`
+	// Location is where the dependency is extracted to, relative to the build directory
+	Location string `json:"location"`
+}
+
+// PluginResponse is what a plugin prints to stdout
+type PluginResponse struct {
+	// Error fails the invocation with this message
+	Error string `json:"error,omitempty"`
+
+	// Schema is the JSON schema of the package config (schema phase)
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	// VersionInputs influence the version of the package (version phase)
+	VersionInputs map[string]string `json:"versionInputs,omitempty"`
+
+	// Build, Test and Package are the commands of the build (build phase)
+	Build   [][]string `json:"build,omitempty"`
+	Test    [][]string `json:"test,omitempty"`
+	Package [][]string `json:"package,omitempty"`
+	// Env is added to the environment of all commands (build phase)
+	Env []string `json:"env,omitempty"`
+}
+
+// Invoke runs the plugin for a phase in the working directory wd
+func (pp *PackagePlugin) Invoke(phase PluginPhase, req PluginRequest, wd string) (*PluginResponse, error) {
+	req.APIVersion = PluginAPIVersion
+	req.Phase = phase
+
+	var (
+		resp *PluginResponse
+		err  error
+	)
+	if pp.conn != nil {
+		resp, err = invokePluginServer(pp.conn, &req)
+		if err != nil {
+			return nil, xerrors.Errorf("plugin %s (%s phase) failed: %w", pp.Name, phase, err)
+		}
+	} else {
+		resp, err = pp.invokeExecutable(&req, wd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.Error != "" {
+		return nil, xerrors.Errorf("plugin %s (%s phase): %s", pp.Name, phase, resp.Error)
+	}
+	return resp, nil
+}
+
+// invokeExecutable runs the plugin executable with the request on stdin
+func (pp *PackagePlugin) invokeExecutable(req *PluginRequest, wd string) (*PluginResponse, error) {
+	phase := req.Phase
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		args           = append(append([]string{}, pp.Command[1:]...), string(phase))
+		stdout, stderr bytes.Buffer
+	)
+	cmd := exec.Command(pp.executable, args...)
+	cmd.Dir = wd
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, xerrors.Errorf("plugin %s (%s phase) failed: %w: %s", pp.Name, phase, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp PluginResponse
+	err = json.Unmarshal(stdout.Bytes(), &resp)
+	if err != nil {
+		return nil, xerrors.Errorf("plugin %s (%s phase) returned an invalid response: %w", pp.Name, phase, err)
+	}
+	return &resp, nil
+}
+
+// PluginPkgConfig configures a plugin package. Everything but the plugin field is passed to the plugin.
+type PluginPkgConfig struct {
+	Plugin   string                 `yaml:"plugin"`
+	Settings map[string]interface{} `yaml:",inline"`
+}
+
+// AdditionalSources returns a list of unresolved sources coming in through this configuration
+func (cfg PluginPkgConfig) AdditionalSources() []string {
+	return []string{}
+}
+
+func (p *Package) pluginPackageInfo() *PluginPackageInfo {
+	var settings map[string]interface{}
+	if cfg, ok := p.Config.(PluginPkgConfig); ok {
+		settings = cfg.Settings
+	}
+	return &PluginPackageInfo{
+		Name:        p.Name,
+		FullName:    p.FullName(),
+		Component:   p.C.Name,
+		Origin:      p.C.Origin,
+		Sources:     p.Sources,
+		Config:      settings,
+		Environment: p.Environment,
+	}
+}
+
+// pluginDefinition is added to the definition of plugin packages
+type pluginDefinition struct {
+	Hash   string            `yaml:"hash,omitempty"`
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+}
+
+// resolvePluginVersionInputs asks the plugin of a plugin package for its version inputs and adds them to the package definition
+func (p *Package) resolvePluginVersionInputs() error {
+	cfg, ok := p.Config.(PluginPkgConfig)
+	if !ok {
+		return xerrors.Errorf("package should have plugin config")
+	}
+	plugin, ok := p.C.W.Plugins[cfg.Plugin]
+	if !ok {
+		return xerrors.Errorf("unknown plugin %q - plugins must be registered in the APPLICATION.yaml", cfg.Plugin)
+	}
+
+	resp, err := plugin.Invoke(PluginPhaseVersion, PluginRequest{Package: p.pluginPackageInfo()}, p.C.Origin)
+	if err != nil {
+		return err
+	}
+
+	defs, err := yaml.Marshal(struct {
+		Plugin pluginDefinition `yaml:"plugin"`
+	}{pluginDefinition{Hash: plugin.executableHash, Inputs: resp.VersionInputs}})
+	if err != nil {
+		return err
+	}
+	p.Definition = append(p.Definition, defs...)
+	return nil
+}
@@ -0,0 +1,106 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+// PluginServiceName is the name of the gRPC service package plugin servers implement
+const PluginServiceName = "gorpa.plugin.v1.PackagePlugin"
+
+// PluginServer is implemented by package plugins which are served via gRPC rather than invoked as executable
+type PluginServer interface {
+	// Invoke answers a request just like an executable plugin does. The phase is part of the request.
+	Invoke(ctx context.Context, req *PluginRequest) (*PluginResponse, error)
+}
+
+// RegisterPluginServer registers a package plugin with a gRPC server.
+//
+// Requests and responses are JSON encoded (content-subtype "json") using the same PluginRequest and
+// PluginResponse as executable plugins, hence plugins in other languages need no generated code either:
+// the service has a single unary method Invoke.
+func RegisterPluginServer(s *grpc.Server, srv PluginServer) {
+	s.RegisterService(&pluginServiceDesc, srv)
+}
+
+var pluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: PluginServiceName,
+	HandlerType: (*PluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Invoke", Handler: pluginInvokeHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func pluginInvokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(PluginRequest)
+	err := dec(req)
+	if err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).Invoke(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + PluginServiceName + "/Invoke"}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Invoke(ctx, req.(*PluginRequest))
+	})
+}
+
+// pluginCodec encodes plugin requests and responses as JSON
+type pluginCodec struct{}
+
+func (pluginCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (pluginCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (pluginCodec) Name() string { return "json" }
+
+func init() {
+	// gRPC servers pick the codec by the content-subtype of the request
+	encoding.RegisterCodec(pluginCodec{})
+}
+
+// dialPlugin connects to a plugin server. The connection is established lazily on the first invocation.
+// Plugin servers are expected to run alongside the build, hence the connection is not encrypted.
+func dialPlugin(addr string) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(pluginCodec{})),
+	)
+}
+
+// invokePluginServer sends a request to a plugin server
+func invokePluginServer(conn *grpc.ClientConn, req *PluginRequest) (*PluginResponse, error) {
+	var resp PluginResponse
+	err := conn.Invoke(context.Background(), "/"+PluginServiceName+"/Invoke", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
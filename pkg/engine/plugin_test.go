@@ -0,0 +1,182 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc"
+)
+
+const testPlugin = `#!/bin/sh
+cat >/dev/null
+case "$1" in
+  schema) echo '{"schema":{"type":"object"}}';;
+  version) echo '{"versionInputs":{"tool":"%s"}}';;
+  build) echo '{"build":[["echo","hello"]]}';;
+esac
+`
+
+func TestPluginPackage(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"APPLICATION.yaml":   "plugins:\n  test:\n    command: [\"tools/plugin\"]\n",
+		"tools/plugin":       strings.Replace(testPlugin, "%s", "1.0", 1),
+		"comp/BUILD.yaml":    "packages:\n- name: pkg\n  type: plugin\n  config:\n    plugin: test\n    foo: bar\n",
+		"other/BUILD.yaml":   "packages:\n- name: pkg\n  type: plugin\n  config:\n    foo: bar\n",
+		"unknown/BUILD.yaml": "packages:\n- name: pkg\n  type: plugin\n  config:\n    plugin: unknown\n",
+	}
+	for fn, content := range files {
+		fn = filepath.Join(root, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// packages without plugin and with an unregistered plugin must fail loading
+	for _, comp := range []string{"other", "unknown"} {
+		_, err := FindApplication(root, nil, "", "")
+		if err == nil {
+			t.Fatalf("expected an error for %s", comp)
+		}
+		err = os.RemoveAll(filepath.Join(root, comp))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loadVersion := func(input string) string {
+		ba, err := FindApplication(root, nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := ba.Packages["comp:pkg"]
+		if pkg == nil {
+			t.Fatal("package comp:pkg not found")
+		}
+		cfg, ok := pkg.Config.(PluginPkgConfig)
+		if !ok || cfg.Plugin != "test" || cfg.Settings["foo"] != "bar" {
+			t.Fatalf("unexpected config: %+v", pkg.Config)
+		}
+		if !strings.Contains(string(pkg.Definition), "tool: \""+input+"\"") {
+			t.Errorf("package definition does not contain the version inputs:\n%s", pkg.Definition)
+		}
+		version, err := pkg.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+
+	v1 := loadVersion("1.0")
+	err := ioutil.WriteFile(filepath.Join(root, "tools/plugin"), []byte(strings.Replace(testPlugin, "%s", "2.0", 1)), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := loadVersion("2.0")
+	if v1 == v2 {
+		t.Errorf("version did not change with the plugin's version inputs")
+	}
+}
+
+type testPluginServer struct {
+	Requests []PluginRequest
+}
+
+func (s *testPluginServer) Invoke(ctx context.Context, req *PluginRequest) (*PluginResponse, error) {
+	s.Requests = append(s.Requests, *req)
+	switch req.Phase {
+	case PluginPhaseSchema:
+		return &PluginResponse{Schema: json.RawMessage(`{"type":"object"}`)}, nil
+	case PluginPhaseBuild:
+		return &PluginResponse{Build: [][]string{{"echo", req.Package.Name}}, Env: []string{"FOO=bar"}}, nil
+	default:
+		return &PluginResponse{Error: "unsupported phase " + string(req.Phase)}, nil
+	}
+}
+
+func TestPluginServer(t *testing.T) {
+	lis, err := net.Listen("unix", filepath.Join(t.TempDir(), "plugin.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		srv    = grpc.NewServer()
+		plugin = &testPluginServer{}
+	)
+	RegisterPluginServer(srv, plugin)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	pp := &PackagePlugin{Name: "test", Address: "unix://" + lis.Addr().String()}
+	err = pp.resolve(&Application{Origin: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := pp.Invoke(PluginPhaseSchema, PluginRequest{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`{"type":"object"}`, string(resp.Schema)); diff != "" {
+		t.Errorf("unexpected schema (-want +got):\n%s", diff)
+	}
+
+	resp, err = pp.Invoke(PluginPhaseBuild, PluginRequest{Package: &PluginPackageInfo{Name: "pkg"}, Build: &PluginBuildInfo{Dir: "/build"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&PluginResponse{Build: [][]string{{"echo", "pkg"}}, Env: []string{"FOO=bar"}}, resp, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected build response (-want +got):\n%s", diff)
+	}
+
+	_, err = pp.Invoke(PluginPhaseVersion, PluginRequest{}, "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported phase version") {
+		t.Errorf("expected the error of the plugin, got %v", err)
+	}
+
+	if len(plugin.Requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(plugin.Requests))
+	}
+	if req := plugin.Requests[1]; req.APIVersion != PluginAPIVersion || req.Phase != PluginPhaseBuild || req.Build.Dir != "/build" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	for _, invalid := range []PackagePlugin{{Name: "none"}, {Name: "both", Command: []string{"sh"}, Address: "localhost:1"}} {
+		if err := invalid.resolve(&Application{}); err == nil {
+			t.Errorf("expected plugin %s to be invalid", invalid.Name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// PorcelainStatus is the outcome of a package in a build as reported by the PorcelainReporter
+type PorcelainStatus string
+
+const (
+	// PorcelainCached means the package was in the cache already and was not built
+	PorcelainCached PorcelainStatus = "cached"
+	// PorcelainSkipped means the package was skipped, e.g. using --skip
+	PorcelainSkipped PorcelainStatus = "skipped"
+	// PorcelainBuilt means the package was built
+	PorcelainBuilt PorcelainStatus = "built"
+	// PorcelainTested means the package was in the cache, and only its tests ran
+	PorcelainTested PorcelainStatus = "tested"
+	// PorcelainFailed means the build or the tests of the package failed
+	PorcelainFailed PorcelainStatus = "failed"
+	// PorcelainNotBuilt means the package was not built because the build failed before
+	PorcelainNotBuilt PorcelainStatus = "not-built"
+)
+
+// NewPorcelainReporter produces a reporter which writes a stable, line-oriented record of each package of a
+// build to out once the build has finished, e.g. for scripts.
+func NewPorcelainReporter(out io.Writer, cache Cache) *PorcelainReporter {
+	return &PorcelainReporter{
+		Out:    out,
+		Cache:  cache,
+		status: make(map[*Package]PorcelainStatus),
+	}
+}
+
+// PorcelainReporter reports the outcome of a build as one record per package, sorted by package name:
+//
+//	<package>\t<status>\t<version>\t<artifact>
+//
+// The status is one of the PorcelainStatus values. The artifact is the location of the package's build artifact
+// in the local cache, or - if there is none. Use NewPorcelainReporter to create an instance.
+type PorcelainReporter struct {
+	Out   io.Writer
+	Cache Cache
+
+	mu     sync.Mutex
+	status map[*Package]PorcelainStatus
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *PorcelainReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status = make(map[*Package]PorcelainStatus, len(status))
+	for p, s := range status {
+		switch s {
+		case PackageBuilt:
+			r.status[p] = PorcelainCached
+		case PackageSkipped:
+			r.status[p] = PorcelainSkipped
+		default:
+			r.status[p] = PorcelainNotBuilt
+		}
+	}
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *PorcelainReporter) BuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkgs := make([]*Package, 0, len(r.status))
+	for p := range r.status {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].FullName() < pkgs[j].FullName() })
+	for _, p := range pkgs {
+		version, verr := p.Version()
+		if verr != nil {
+			version = "-"
+		}
+		artifact, exists := r.Cache.Location(p)
+		if !exists {
+			artifact = "-"
+		}
+		fmt.Fprintf(r.Out, "%s\t%s\t%s\t%s\n", p.FullName(), r.status[p], version, artifact)
+	}
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *PorcelainReporter) PackageBuildStarted(pkg *Package) {}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *PorcelainReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *PorcelainReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case err != nil:
+		r.status[pkg] = PorcelainFailed
+	case r.status[pkg] == PorcelainCached:
+		r.status[pkg] = PorcelainTested
+	default:
+		r.status[pkg] = PorcelainBuilt
+	}
+}
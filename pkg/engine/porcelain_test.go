@@ -0,0 +1,87 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestPorcelainReporter(t *testing.T) {
+	pkg := func(name string) *Package {
+		p := testPackage(&Application{}, name, GenericPackage)
+		p.Config = GenericPkgConfig{}
+		return p
+	}
+	var (
+		cached  = pkg("cached")
+		built   = pkg("built")
+		broken  = pkg("broken")
+		pending = pkg("pending")
+		skipped = pkg("skipped")
+		out     bytes.Buffer
+		human   bytes.Buffer
+	)
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := NewConsoleReporter()
+	console.Out = &human
+	rep := CompositeReporter{console, NewPorcelainReporter(&out, cache)}
+
+	rep.BuildStarted(built, map[*Package]PackageBuildStatus{
+		cached:  PackageBuilt,
+		built:   PackageNotBuiltYet,
+		broken:  PackageNotBuiltYet,
+		pending: PackageNotBuiltYet,
+		skipped: PackageSkipped,
+	})
+	rep.PackageBuildStarted(built)
+	rep.PackageBuildLog(built, false, []byte("human chatter\n"))
+	rep.PackageBuildFinished(built, nil)
+	rep.PackageBuildFinished(broken, xerrors.Errorf("exit status 1"))
+	rep.BuildFinished(built, xerrors.Errorf("build failed"))
+
+	var expectation string
+	for _, r := range []struct {
+		Pkg    *Package
+		Status PorcelainStatus
+	}{{broken, PorcelainFailed}, {built, PorcelainBuilt}, {cached, PorcelainCached}, {pending, PorcelainNotBuilt}, {skipped, PorcelainSkipped}} {
+		version, err := r.Pkg.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectation += fmt.Sprintf("%s\t%s\t%s\t-\n", r.Pkg.FullName(), r.Status, version)
+	}
+	if act := out.String(); act != expectation {
+		t.Errorf("unexpected porcelain output: got\n%s\nexpected\n%s", act, expectation)
+	}
+	for _, exp := range []string{"human chatter", "build failed"} {
+		if !strings.Contains(human.String(), exp) {
+			t.Errorf("console output lacks %q: got\n%s", exp, human.String())
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BuildPhase is a phase of a package build or of the build as a whole
+type BuildPhase string
+
+const (
+	// BuildPhaseDownload downloads cached artifacts from the remote caches before any package is built
+	BuildPhaseDownload BuildPhase = "download"
+	// BuildPhaseUpload uploads the newly built artifacts to the remote cache once all packages are built
+	BuildPhaseUpload BuildPhase = "upload"
+	// BuildPhasePrepare copies the sources of a package into its build directory
+	BuildPhasePrepare BuildPhase = "prepare"
+	// BuildPhaseWait waits for the scheduler to let the package build start
+	BuildPhaseWait BuildPhase = "wait"
+	// BuildPhaseBuild runs the build commands of a package
+	BuildPhaseBuild BuildPhase = "build"
+	// BuildPhaseTest runs the tests of a package
+	BuildPhaseTest BuildPhase = "test"
+	// BuildPhasePackage produces the provenance, pushes images and packages the build artifact
+	BuildPhasePackage BuildPhase = "package"
+)
+
+const (
+	// ProfileTraceFilename is the name of the Chrome trace the ProfilingReporter writes
+	ProfileTraceFilename = "trace.json"
+	// ProfileSummaryFilename is the name of the summary the ProfilingReporter writes
+	ProfileSummaryFilename = "summary.txt"
+)
+
+// BuildPhaseReporter is implemented by reporters which want to know how long the phases of a build take.
+// Reporters need not implement it.
+type BuildPhaseReporter interface {
+	// BuildPhaseStarted is called when a phase of a package build starts. The phases of the build as a whole,
+	// i.e. download and upload, are reported for the target package.
+	BuildPhaseStarted(pkg *Package, phase BuildPhase)
+	// BuildPhaseFinished is called when a phase of a package build has finished
+	BuildPhaseFinished(pkg *Package, phase BuildPhase)
+}
+
+// startPhase reports the start of a build phase and returns a function which reports its end
+func startPhase(rep Reporter, pkg *Package, phase BuildPhase) (done func()) {
+	r, ok := rep.(BuildPhaseReporter)
+	if !ok {
+		return func() {}
+	}
+	r.BuildPhaseStarted(pkg, phase)
+	return func() { r.BuildPhaseFinished(pkg, phase) }
+}
+
+// NewProfilingReporter produces a reporter which writes a Chrome trace and a summary of the build to dir
+// once the build has finished.
+func NewProfilingReporter(dir string) *ProfilingReporter {
+	return &ProfilingReporter{
+		Dir:     dir,
+		start:   time.Now(),
+		lanes:   make(map[string]int),
+		started: make(map[string]time.Time),
+		running: make(map[string]time.Time),
+		waited:  make(map[string]map[BuildPhase]time.Duration),
+		phases:  make(map[string]time.Time),
+	}
+}
+
+// ProfilingReporter records when packages and their build phases start and finish. The trace it writes can be
+// loaded into chrome://tracing, https://ui.perfetto.dev or https://www.speedscope.app to see a flame chart of the
+// build, where each row is one concurrently building package. Packages get a row once the scheduler lets their
+// build start, the time they spent preparing and waiting before is part of the summary. Use NewProfilingReporter
+// to create an instance.
+type ProfilingReporter struct {
+	Dir string
+
+	mu     sync.Mutex
+	start  time.Time
+	target string
+	events []profileEvent
+	lanes  map[string]int
+	busy   []bool
+	// started is when a package build got underway, running when it got its lane
+	started map[string]time.Time
+	running map[string]time.Time
+	// waited are the phases of the packages which ended before they got a lane
+	waited   map[string]map[BuildPhase]time.Duration
+	phases   map[string]time.Time
+	packages []profiledPackage
+}
+
+type profileEvent struct {
+	Name     string            `json:"name"`
+	Category string            `json:"cat"`
+	Phase    string            `json:"ph"`
+	Time     int64             `json:"ts"`
+	Duration int64             `json:"dur"`
+	PID      int               `json:"pid"`
+	TID      int               `json:"tid"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+type profiledPackage struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Failed   bool
+	Phases   map[BuildPhase]time.Duration
+}
+
+func (r *ProfilingReporter) micros(t time.Time) int64 {
+	return t.Sub(r.start).Microseconds()
+}
+
+// BuildStarted is called when the build of a package is started by the user.
+func (r *ProfilingReporter) BuildStarted(pkg *Package, status map[*Package]PackageBuildStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.target = pkg.FullName()
+}
+
+// BuildFinished is called when the build of a package which was started by the user has finished.
+func (r *ProfilingReporter) BuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	args := map[string]string{"target": pkg.FullName()}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	r.events = append(r.events, profileEvent{Name: pkg.FullName(), Category: "build", Phase: "X", Time: 0, Duration: r.micros(now), PID: 1, TID: 0, Args: args})
+
+	// the profile is a debugging aid - failing to write it must not fail the build
+	werr := r.write(now)
+	if werr != nil {
+		fmt.Fprintf(os.Stderr, "cannot write build profile: %v\n", werr)
+	}
+}
+
+// PackageBuildStarted is called when a package build actually gets underway.
+func (r *ProfilingReporter) PackageBuildStarted(pkg *Package) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := pkg.FullName()
+	r.started[name] = time.Now()
+	r.waited[name] = make(map[BuildPhase]time.Duration)
+}
+
+// lane returns the lane of a package, which it gets once the scheduler lets its build start
+func (r *ProfilingReporter) lane(name string) int {
+	if lane, ok := r.lanes[name]; ok {
+		return lane
+	}
+
+	lane := -1
+	for i, b := range r.busy {
+		if !b {
+			lane = i
+			break
+		}
+	}
+	if lane < 0 {
+		lane = len(r.busy)
+		r.busy = append(r.busy, false)
+	}
+	r.busy[lane] = true
+	// lane 0 of the trace shows the build as a whole
+	r.lanes[name] = lane + 1
+	r.running[name] = time.Now()
+	return lane + 1
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (r *ProfilingReporter) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {}
+
+// PackageBuildFinished is called when the package build has finished.
+func (r *ProfilingReporter) PackageBuildFinished(pkg *Package, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := pkg.FullName()
+	if _, ok := r.started[name]; !ok {
+		return
+	}
+	lane := r.lane(name)
+	start := r.running[name]
+	waited := r.waited[name]
+	delete(r.started, name)
+	delete(r.running, name)
+	delete(r.waited, name)
+	delete(r.lanes, name)
+	r.busy[lane-1] = false
+
+	now := time.Now()
+	version, _ := pkg.Version()
+	args := map[string]string{"version": version, "type": string(pkg.Type)}
+	for phase, d := range waited {
+		args[string(phase)] = d.Round(time.Millisecond).String()
+	}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+	r.events = append(r.events, profileEvent{Name: name, Category: "package", Phase: "X", Time: r.micros(start), Duration: now.Sub(start).Microseconds(), PID: 1, TID: lane, Args: args})
+
+	prof := profiledPackage{Name: name, Start: start, Duration: now.Sub(start), Failed: err != nil, Phases: make(map[BuildPhase]time.Duration)}
+	for phase, d := range waited {
+		prof.Phases[phase] += d
+	}
+	for _, evt := range r.events {
+		if evt.Category == "phase" && evt.TID == lane && evt.Time >= r.micros(start) {
+			prof.Phases[BuildPhase(evt.Name)] += time.Duration(evt.Duration) * time.Microsecond
+		}
+	}
+	r.packages = append(r.packages, prof)
+}
+
+func phaseKey(pkg *Package, phase BuildPhase) string {
+	return pkg.FullName() + "/" + string(phase)
+}
+
+// BuildPhaseStarted is called when a phase of a package build starts.
+func (r *ProfilingReporter) BuildPhaseStarted(pkg *Package, phase BuildPhase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.phases[phaseKey(pkg, phase)] = time.Now()
+}
+
+// BuildPhaseFinished is called when a phase of a package build has finished.
+func (r *ProfilingReporter) BuildPhaseFinished(pkg *Package, phase BuildPhase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := phaseKey(pkg, phase)
+	start, ok := r.phases[key]
+	if !ok {
+		return
+	}
+	delete(r.phases, key)
+
+	var (
+		name = pkg.FullName()
+		lane int
+	)
+	if waited, ok := r.waited[name]; ok && phase != BuildPhaseDownload && phase != BuildPhaseUpload {
+		_, running := r.lanes[name]
+		if !running && (phase == BuildPhasePrepare || phase == BuildPhaseWait) {
+			// the package isn't building before the scheduler lets it, hence it gets a lane only once it waited
+			waited[phase] += time.Since(start)
+			if phase == BuildPhaseWait {
+				r.lane(name)
+			}
+			return
+		}
+		lane = r.lane(name)
+	}
+	r.events = append(r.events, profileEvent{Name: string(phase), Category: "phase", Phase: "X", Time: r.micros(start), Duration: time.Since(start).Microseconds(), PID: 1, TID: lane})
+}
+
+func (r *ProfilingReporter) write(now time.Time) error {
+	err := os.MkdirAll(r.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	events := make([]interface{}, 0, len(r.events)+len(r.busy)+1)
+	events = append(events, map[string]interface{}{"name": "thread_name", "ph": "M", "pid": 1, "tid": 0, "args": map[string]string{"name": "build"}})
+	for i := range r.busy {
+		events = append(events, map[string]interface{}{"name": "thread_name", "ph": "M", "pid": 1, "tid": i + 1, "args": map[string]string{"name": fmt.Sprintf("worker %d", i+1)}})
+	}
+	for _, evt := range r.events {
+		events = append(events, evt)
+	}
+	fc, err := json.Marshal(map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ms"})
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(r.Dir, ProfileTraceFilename), fc, 0644)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(r.Dir, ProfileSummaryFilename))
+	if err != nil {
+		return err
+	}
+	r.writeSummary(f, now)
+	return f.Close()
+}
+
+// idleTime returns how long no package was building between the first package build starting and the last one finishing
+func (r *ProfilingReporter) idleTime() time.Duration {
+	if len(r.packages) == 0 {
+		return 0
+	}
+	pkgs := make([]profiledPackage, len(r.packages))
+	copy(pkgs, r.packages)
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Start.Before(pkgs[j].Start) })
+
+	var (
+		idle time.Duration
+		end  = pkgs[0].Start
+	)
+	for _, p := range pkgs {
+		if p.Start.After(end) {
+			idle += p.Start.Sub(end)
+		}
+		if pend := p.Start.Add(p.Duration); pend.After(end) {
+			end = pend
+		}
+	}
+	return idle
+}
+
+func (r *ProfilingReporter) writeSummary(out io.Writer, now time.Time) {
+	var buildPhases = make(map[BuildPhase]time.Duration)
+	for _, evt := range r.events {
+		if evt.Category == "phase" && evt.TID == 0 {
+			buildPhases[BuildPhase(evt.Name)] += time.Duration(evt.Duration) * time.Microsecond
+		}
+	}
+	var wait time.Duration
+	for _, p := range r.packages {
+		wait += p.Phases[BuildPhaseWait]
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "target:\t%s\n", r.target)
+	fmt.Fprintf(tw, "total:\t%s\n", now.Sub(r.start).Round(time.Millisecond))
+	fmt.Fprintf(tw, "packages built:\t%d\n", len(r.packages))
+	fmt.Fprintf(tw, "max. concurrent packages:\t%d\n", len(r.busy))
+	fmt.Fprintf(tw, "remote cache download:\t%s\n", buildPhases[BuildPhaseDownload].Round(time.Millisecond))
+	fmt.Fprintf(tw, "remote cache upload:\t%s\n", buildPhases[BuildPhaseUpload].Round(time.Millisecond))
+	fmt.Fprintf(tw, "scheduler idle time:\t%s\n", r.idleTime().Round(time.Millisecond))
+	fmt.Fprintf(tw, "waiting for the scheduler:\t%s\n", wait.Round(time.Millisecond))
+	tw.Flush()
+
+	pkgs := make([]profiledPackage, len(r.packages))
+	copy(pkgs, r.packages)
+	sort.SliceStable(pkgs, func(i, j int) bool { return pkgs[i].Duration > pkgs[j].Duration })
+	if len(pkgs) > 10 {
+		pkgs = pkgs[:10]
+	}
+	if len(pkgs) == 0 {
+		return
+	}
+
+	phases := []BuildPhase{BuildPhasePrepare, BuildPhaseWait, BuildPhaseBuild, BuildPhaseTest, BuildPhasePackage}
+	fmt.Fprintln(out, "\nslowest packages:")
+	tw = tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	header := []string{"PACKAGE", "TOTAL"}
+	for _, ph := range phases {
+		header = append(header, strings.ToUpper(string(ph)))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, p := range pkgs {
+		name := p.Name
+		if p.Failed {
+			name += " (failed)"
+		}
+		line := []string{name, p.Duration.Round(time.Millisecond).String()}
+		for _, ph := range phases {
+			line = append(line, p.Phases[ph].Round(time.Millisecond).String())
+		}
+		fmt.Fprintln(tw, strings.Join(line, "\t"))
+	}
+	tw.Flush()
+}
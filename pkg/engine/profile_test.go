@@ -0,0 +1,100 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestProfilingReporter(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		ba   = &Application{}
+		lib  = testPackage(ba, "lib", GenericPackage)
+		app  = testPackage(ba, "app", GenericPackage)
+		tool = testPackage(ba, "tool", GenericPackage)
+		rep  = CompositeReporter{NewProfilingReporter(dir)}
+	)
+
+	downloaded := startPhase(rep, app, BuildPhaseDownload)
+	downloaded()
+	rep.BuildStarted(app, map[*Package]PackageBuildStatus{lib: PackageNotBuiltYet, app: PackageNotBuiltYet, tool: PackageNotBuiltYet})
+	// all three packages queue up at the same time, but tool only gets to build once lib is done
+	rep.PackageBuildStarted(lib)
+	rep.PackageBuildStarted(app)
+	rep.PackageBuildStarted(tool)
+	libWaited := startPhase(rep, lib, BuildPhaseWait)
+	appWaited := startPhase(rep, app, BuildPhaseWait)
+	toolWaited := startPhase(rep, tool, BuildPhaseWait)
+	libWaited()
+	appWaited()
+	built := startPhase(rep, lib, BuildPhaseBuild)
+	built()
+	rep.PackageBuildFinished(lib, nil)
+	toolWaited()
+	rep.PackageBuildFinished(tool, nil)
+	rep.PackageBuildFinished(app, nil)
+	rep.BuildFinished(app, nil)
+
+	fc, err := ioutil.ReadFile(filepath.Join(dir, ProfileTraceFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []profileEvent `json:"traceEvents"`
+	}
+	err = json.Unmarshal(fc, &trace)
+	if err != nil {
+		t.Fatalf("invalid trace: %v", err)
+	}
+	lanes := make(map[string]int)
+	for _, evt := range trace.TraceEvents {
+		if evt.Phase == "X" {
+			lanes[evt.Category+":"+evt.Name] = evt.TID
+		}
+	}
+	for evt, lane := range map[string]int{"build:comp:app": 0, "phase:download": 0, "package:comp:lib": 1, "phase:build": 1, "package:comp:app": 2, "package:comp:tool": 1} {
+		if l, ok := lanes[evt]; !ok || l != lane {
+			t.Errorf("expected %s in lane %d, got %v", evt, lane, lanes)
+		}
+	}
+
+	summary, err := ioutil.ReadFile(filepath.Join(dir, ProfileSummaryFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lanes["phase:wait"] != 0 {
+		t.Errorf("waiting packages must not occupy a lane: %v", lanes)
+	}
+	for _, s := range []string{"packages built:", "comp:lib", "comp:app"} {
+		if !strings.Contains(string(summary), s) {
+			t.Errorf("summary lacks %q:\n%s", s, summary)
+		}
+	}
+	if !regexp.MustCompile(`max. concurrent packages:\s+2\n`).Match(summary) {
+		t.Errorf("expected two concurrent packages:\n%s", summary)
+	}
+}
@@ -108,6 +108,13 @@ func writeProvenance(p *Package, buildctx *buildContext, builddir string, subjec
 		if err != nil {
 			return err
 		}
+
+		if p.Type == DockerPackage && buildctx.ImageSigning.Enabled {
+			err = writeProvenancePredicate(builddir, env)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	log.WithField("fn", fn).WithField("package", p.FullName()).Debug("wrote provenance bundle")
@@ -281,6 +288,7 @@ func (p *Package) produceSLSAEnvelope(buildctx *buildContext, subjects []in_toto
 		DefinedInMaterial: recipeMaterial,
 		Environment: provenanceEnvironment{
 			Manifest: p.C.W.EnvironmentManifest,
+			Excluded: p.environmentManifestExclusions(),
 		},
 	}
 
@@ -311,6 +319,8 @@ func (p *Package) produceSLSAEnvelope(buildctx *buildContext, subjects []in_toto
 
 type provenanceEnvironment struct {
 	Manifest EnvironmentManifest `json:"manifest"`
+	// Excluded lists the manifest entries which did not contribute to the package version
+	Excluded []string `json:"excluded,omitempty"`
 }
 
 func (p *Package) inTotoMaterials() ([]in_toto.ProvenanceMaterial, error) {
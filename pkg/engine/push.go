@@ -0,0 +1,107 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// PushOptions configures how Docker packages push their images
+type PushOptions struct {
+	// Jobs is the number of images which are pushed concurrently, across all packages of a build
+	Jobs int
+	// Retries is the number of times a failed push is retried
+	Retries int
+	// Backoff is the delay before the first retry. The delay doubles with every subsequent retry.
+	Backoff time.Duration
+}
+
+// DefaultPushOptions are used if a build does not configure push options
+var DefaultPushOptions = PushOptions{
+	Jobs:    4,
+	Retries: 3,
+	Backoff: 2 * time.Second,
+}
+
+// WithPushOptions configures how Docker packages push their images
+func WithPushOptions(opts PushOptions) BuildOption {
+	return func(o *buildOptions) error {
+		if opts.Jobs <= 0 {
+			return xerrors.Errorf("push jobs must be greater than zero")
+		}
+		if opts.Retries < 0 {
+			return xerrors.Errorf("push retries must not be negative")
+		}
+		o.Push = opts
+		return nil
+	}
+}
+
+// executePushCommands runs the push commands of a package concurrently, retrying failed pushes with exponential backoff.
+// The number of concurrent pushes is limited across all packages of a build.
+func executePushCommands(buildctx *buildContext, p *Package, wd string, pushes [][]string, extraEnv []string) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, cmd := range pushes {
+		wg.Add(1)
+		go func(cmd []string) {
+			defer wg.Done()
+
+			_ = buildctx.pushLimit.Acquire(context.Background(), 1)
+			defer buildctx.pushLimit.Release(1)
+
+			err := pushWithRetry(buildctx, p, wd, cmd, extraEnv)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(cmd)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func pushWithRetry(buildctx *buildContext, p *Package, wd string, cmd []string, extraEnv []string) (err error) {
+	backoff := buildctx.Push.Backoff
+	for attempt := 0; ; attempt++ {
+		err = executeCommandsForPackage(buildctx, p, wd, [][]string{cmd}, extraEnv)
+		if err == nil || attempt >= buildctx.Push.Retries {
+			return err
+		}
+
+		log.WithError(err).WithField("package", p.FullName()).WithField("attempt", attempt+1).Warnf("push failed - retrying in %s", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+func TestExecutePushCommands(t *testing.T) {
+	// each push fails once and succeeds when it's retried
+	flaky := func(name string) []string {
+		return []string{"sh", "-c", `if [ -e "pushed-$1" ]; then exit 0; fi; touch "pushed-$1"; exit 1`, "sh", name}
+	}
+
+	tests := []struct {
+		Name        string
+		Retries     int
+		ExpectError bool
+	}{
+		{Name: "retried", Retries: 1},
+		{Name: "no retries", Retries: 0, ExpectError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			wd, err := ioutil.TempDir("", "gorpa-push-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(wd)
+
+			buildctx := &buildContext{
+				buildOptions: buildOptions{
+					Reporter: NewConsoleReporter(),
+					Push:     PushOptions{Jobs: 2, Retries: test.Retries, Backoff: time.Millisecond},
+				},
+				pushLimit: semaphore.NewWeighted(2),
+			}
+			pkg := &Package{C: &Component{Name: "comp", W: &Application{}}, packageInternal: packageInternal{Name: "img"}}
+
+			err = executePushCommands(buildctx, pkg, wd, [][]string{flaky("a"), flaky("b"), flaky("c")}, nil)
+			if test.ExpectError && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !test.ExpectError && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
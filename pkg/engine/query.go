@@ -0,0 +1,442 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// Query evaluates a query over the package graph of the application and returns the matching packages.
+// An expression is a target pattern (see SelectPackages), a function or a set operation:
+//
+//	deps(x)               the packages of x and their transitive dependencies
+//	deps(x, n)            the packages of x and their dependencies up to a depth of n
+//	rdeps(x), rdeps(x, n) the packages of x and the packages which depend on them
+//	somepath(x, y)        a dependency path from a package of x to a package of y, if there is one
+//	allpaths(x, y)        all packages on dependency paths from a package of x to a package of y
+//	kind(type, x)         the packages of x which have this type
+//	filter(regexp, x)     the packages of x whose full name matches the regular expression
+//	x + y, x union y      the packages of x or y
+//	x - y, x except y     the packages of x which are not part of y
+//	x ^ y, x intersect y  the packages of both x and y
+//
+// Set operations are left-associative and have equal precedence, parentheses group them. Arguments which contain
+// spaces, parentheses or commas can be quoted. The result of somepath is in path order, all other results are
+// sorted by name.
+func (a *Application) Query(query string) ([]*Package, error) {
+	toks, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{app: a, toks: toks}
+	res, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, xerrors.Errorf("query: unexpected %s", p.toks[p.pos])
+	}
+	return res, nil
+}
+
+type queryToken struct {
+	Value  string
+	Quoted bool
+	Pos    int
+}
+
+func (t queryToken) String() string {
+	return strconv.Quote(t.Value) + " at " + strconv.Itoa(t.Pos)
+}
+
+// tokenizeQuery splits a query into parentheses, commas and words. Commas within brackets are part of the word,
+// s.t. type filters such as //...[go,yarn] remain one pattern.
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var (
+		res []queryToken
+		rs  = []rune(query)
+	)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			res = append(res, queryToken{Value: string(r), Pos: i})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(rs) && rs[end] != r {
+				end++
+			}
+			if end == len(rs) {
+				return nil, xerrors.Errorf("query: unterminated quote at %d", i)
+			}
+			res = append(res, queryToken{Value: string(rs[i+1 : end]), Quoted: true, Pos: i})
+			i = end + 1
+		default:
+			var (
+				start    = i
+				brackets int
+			)
+			for ; i < len(rs); i++ {
+				c := rs[i]
+				if c == '[' {
+					brackets++
+				} else if c == ']' && brackets > 0 {
+					brackets--
+				} else if brackets == 0 && (unicode.IsSpace(c) || c == '(' || c == ')' || c == ',' || c == '"' || c == '\'') {
+					break
+				}
+			}
+			res = append(res, queryToken{Value: string(rs[start:i]), Pos: start})
+		}
+	}
+	return res, nil
+}
+
+type queryParser struct {
+	app  *Application
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.toks) {
+		return queryToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *queryParser) expect(value string) error {
+	tok, ok := p.peek()
+	if !ok {
+		return xerrors.Errorf("query: expected \"%s\" but the query ended", value)
+	}
+	if tok.Quoted || tok.Value != value {
+		return xerrors.Errorf("query: expected \"%s\" but found %s", value, tok)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *queryParser) parseExpr() ([]*Package, error) {
+	res, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.Quoted {
+			return res, nil
+		}
+		var op func(a, b []*Package) []*Package
+		switch tok.Value {
+		case "+", "union":
+			op = unionPackages
+		case "-", "except":
+			op = exceptPackages
+		case "^", "intersect":
+			op = intersectPackages
+		default:
+			return res, nil
+		}
+		p.pos++
+
+		other, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		res = op(res, other)
+	}
+}
+
+func (p *queryParser) parseTerm() ([]*Package, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, xerrors.Errorf("query: expected an expression but the query ended")
+	}
+	p.pos++
+	if !tok.Quoted && tok.Value == "(" {
+		res, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return res, p.expect(")")
+	}
+	if !tok.Quoted && (tok.Value == ")" || tok.Value == ",") {
+		return nil, xerrors.Errorf("query: expected an expression but found %s", tok)
+	}
+	if next, ok := p.peek(); ok && !tok.Quoted && !next.Quoted && next.Value == "(" {
+		p.pos++
+		return p.parseFunction(tok)
+	}
+
+	res, err := p.app.SelectPackages([]string{tok.Value})
+	if err != nil {
+		return nil, xerrors.Errorf("query: %w", err)
+	}
+	return res, nil
+}
+
+func (p *queryParser) parseFunction(name queryToken) (res []*Package, err error) {
+	switch name.Value {
+	case "deps", "rdeps":
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		depth := -1
+		if tok, ok := p.peek(); ok && !tok.Quoted && tok.Value == "," {
+			p.pos++
+			depth, err = p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if name.Value == "deps" {
+			res = walkPackages(x, depth, (*Package).GetDependencies)
+		} else {
+			rdeps := p.app.reverseDependencies()
+			res = walkPackages(x, depth, func(pkg *Package) []*Package { return rdeps[pkg] })
+		}
+	case "somepath", "allpaths":
+		from, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(",")
+		if err != nil {
+			return nil, err
+		}
+		to, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if name.Value == "somepath" {
+			res = somePath(from, to)
+		} else {
+			res = allPaths(from, to)
+		}
+	case "kind", "filter":
+		arg, ok := p.peek()
+		if !ok {
+			return nil, xerrors.Errorf("query: %s expects two arguments", name.Value)
+		}
+		p.pos++
+		err := p.expect(",")
+		if err != nil {
+			return nil, err
+		}
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		var matches func(pkg *Package) bool
+		if name.Value == "kind" {
+			tpe, err := parsePackageType(arg.Value)
+			if err != nil {
+				return nil, xerrors.Errorf("query: kind: %w", err)
+			}
+			matches = func(pkg *Package) bool { return pkg.Type == tpe }
+		} else {
+			expr, err := regexp.Compile(arg.Value)
+			if err != nil {
+				return nil, xerrors.Errorf("query: filter: %w", err)
+			}
+			matches = func(pkg *Package) bool { return expr.MatchString(pkg.FullName()) }
+		}
+		for _, pkg := range x {
+			if matches(pkg) {
+				res = append(res, pkg)
+			}
+		}
+	default:
+		return nil, xerrors.Errorf("query: unknown function %s", name)
+	}
+	if res == nil {
+		res = []*Package{}
+	}
+	return res, p.expect(")")
+}
+
+func (p *queryParser) parseInt() (int, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return 0, xerrors.Errorf("query: expected a depth but the query ended")
+	}
+	p.pos++
+	n, err := strconv.Atoi(tok.Value)
+	if err != nil || n < 0 {
+		return 0, xerrors.Errorf("query: expected a depth but found %s", tok)
+	}
+	return n, nil
+}
+
+// reverseDependencies indexes the packages which directly depend on a package
+func (a *Application) reverseDependencies() map[*Package][]*Package {
+	res := make(map[*Package][]*Package)
+	for _, p := range a.Packages {
+		for _, dep := range p.GetDependencies() {
+			res[dep] = append(res[dep], p)
+		}
+	}
+	return res
+}
+
+// walkPackages returns the packages and the packages reachable from them up to a depth, or without limit if
+// depth is negative
+func walkPackages(pkgs []*Package, depth int, next func(*Package) []*Package) []*Package {
+	seen := make(map[*Package]struct{}, len(pkgs))
+	for _, p := range pkgs {
+		seen[p] = struct{}{}
+	}
+	current := pkgs
+	for d := 0; len(current) > 0 && (depth < 0 || d < depth); d++ {
+		var found []*Package
+		for _, p := range current {
+			for _, n := range next(p) {
+				if _, ok := seen[n]; ok {
+					continue
+				}
+				seen[n] = struct{}{}
+				found = append(found, n)
+			}
+		}
+		current = found
+	}
+	return sortedPackages(seen)
+}
+
+// somePath returns the shortest dependency path from one of the from packages to one of the to packages
+func somePath(from, to []*Package) []*Package {
+	target := packageSet(to)
+	prev := make(map[*Package]*Package)
+	queue := append([]*Package{}, from...)
+	for _, p := range from {
+		prev[p] = nil
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if _, ok := target[p]; ok {
+			var path []*Package
+			for ; p != nil; p = prev[p] {
+				path = append([]*Package{p}, path...)
+			}
+			return path
+		}
+		for _, dep := range p.GetDependencies() {
+			if _, ok := prev[dep]; ok {
+				continue
+			}
+			prev[dep] = p
+			queue = append(queue, dep)
+		}
+	}
+	return nil
+}
+
+// allPaths returns all packages which are on a dependency path from one of the from packages to one of the to packages
+func allPaths(from, to []*Package) []*Package {
+	var (
+		target = packageSet(to)
+		onPath = make(map[*Package]bool)
+		visit  func(p *Package) bool
+	)
+	visit = func(p *Package) bool {
+		if res, ok := onPath[p]; ok {
+			return res
+		}
+		_, res := target[p]
+		onPath[p] = res
+		for _, dep := range p.GetDependencies() {
+			if visit(dep) {
+				res = true
+			}
+		}
+		onPath[p] = res
+		return res
+	}
+
+	res := make(map[*Package]struct{})
+	for _, p := range from {
+		visit(p)
+	}
+	for p, ok := range onPath {
+		if ok {
+			res[p] = struct{}{}
+		}
+	}
+	return sortedPackages(res)
+}
+
+func packageSet(pkgs []*Package) map[*Package]struct{} {
+	res := make(map[*Package]struct{}, len(pkgs))
+	for _, p := range pkgs {
+		res[p] = struct{}{}
+	}
+	return res
+}
+
+func sortedPackages(set map[*Package]struct{}) []*Package {
+	res := make([]*Package, 0, len(set))
+	for p := range set {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].FullName() < res[j].FullName() })
+	return res
+}
+
+func unionPackages(a, b []*Package) []*Package {
+	res := packageSet(a)
+	for _, p := range b {
+		res[p] = struct{}{}
+	}
+	return sortedPackages(res)
+}
+
+func exceptPackages(a, b []*Package) []*Package {
+	res := packageSet(a)
+	for _, p := range b {
+		delete(res, p)
+	}
+	return sortedPackages(res)
+}
+
+func intersectPackages(a, b []*Package) []*Package {
+	var (
+		other = packageSet(b)
+		res   = make(map[*Package]struct{})
+	)
+	for _, p := range a {
+		if _, ok := other[p]; ok {
+			res[p] = struct{}{}
+		}
+	}
+	return sortedPackages(res)
+}
@@ -0,0 +1,89 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQuery(t *testing.T) {
+	app := &Application{Packages: make(map[string]*Package)}
+	addPkg := func(name string, tpe PackageType, deps ...string) {
+		comp, pkg := name[:len(name)-4], name[len(name)-3:]
+		p := testPackage(app, pkg, tpe)
+		p.C.Name = comp
+		p.Definition = []byte(name)
+		for _, dep := range deps {
+			p.dependencies = append(p.dependencies, app.Packages[dep])
+		}
+		app.Packages[name] = p
+	}
+	addPkg("libs/proto:api", ProtoPackage)
+	addPkg("libs/util:lib", GoPackage)
+	addPkg("server:lib", GoPackage, "libs/proto:api", "libs/util:lib")
+	addPkg("server:app", DockerPackage, "server:lib")
+	addPkg("web:app", YarnPackage, "libs/proto:api")
+
+	tests := []struct {
+		Query       string
+		Expectation []string
+		Error       bool
+	}{
+		{Query: "server:app", Expectation: []string{"server:app"}},
+		{Query: "deps(server:app)", Expectation: []string{"libs/proto:api", "libs/util:lib", "server:app", "server:lib"}},
+		{Query: "deps(server:app, 1)", Expectation: []string{"server:app", "server:lib"}},
+		{Query: "rdeps(libs/proto:api)", Expectation: []string{"libs/proto:api", "server:app", "server:lib", "web:app"}},
+		{Query: "rdeps(libs/proto:api, 1) - libs/proto:api", Expectation: []string{"server:lib", "web:app"}},
+		{Query: "somepath(server:app, libs/proto:api)", Expectation: []string{"server:app", "server:lib", "libs/proto:api"}},
+		{Query: "somepath(web:app, libs/util:lib)", Expectation: []string{}},
+		{Query: "allpaths(//..., libs/proto:api)", Expectation: []string{"libs/proto:api", "server:app", "server:lib", "web:app"}},
+		{Query: "kind(go, deps(server:app))", Expectation: []string{"libs/util:lib", "server:lib"}},
+		{Query: "//...[go,docker] intersect deps(server:lib)", Expectation: []string{"libs/util:lib", "server:lib"}},
+		{Query: "filter('^libs/', //...) union web:app", Expectation: []string{"libs/proto:api", "libs/util:lib", "web:app"}},
+		{Query: "//... - (deps(server:app) + web:app)", Expectation: []string{}},
+		{Query: "kind(rust, //...)", Error: true},
+		{Query: "deps(server:app", Error: true},
+		{Query: "nope(server:app)", Error: true},
+		{Query: "server:app web:app", Error: true},
+	}
+	for _, test := range tests {
+		pkgs, err := app.Query(test.Query)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.Query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.Query, err)
+			continue
+		}
+		act := []string{}
+		for _, p := range pkgs {
+			act = append(act, p.FullName())
+		}
+		if diff := cmp.Diff(test.Expectation, act); diff != "" {
+			t.Errorf("%s: Query() mismatch (-want +got):\n%s", test.Query, diff)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// RegistryAuth configures how Docker packages authenticate against a container registry, both for pulling
+// base images and for pushing the images they build.
+type RegistryAuth struct {
+	// Host is the registry host as used in image names, e.g. eu.gcr.io
+	Host string `yaml:"host"`
+	// CredentialHelper names the Docker credential helper for this registry, e.g. gcloud for docker-credential-gcloud
+	CredentialHelper string `yaml:"credentialHelper,omitempty"`
+	// Username and PasswordEnv configure basic auth. The password is read from the PasswordEnv environment variable.
+	Username    string `yaml:"username,omitempty"`
+	PasswordEnv string `yaml:"passwordEnv,omitempty"`
+}
+
+// Validate returns an error if the registry configuration is incomplete
+func (r RegistryAuth) Validate() error {
+	if r.Host == "" {
+		return xerrors.Errorf("registry host is required")
+	}
+	if (r.CredentialHelper == "") == (r.Username == "") {
+		return xerrors.Errorf("registry %s: either credentialHelper or username is required", r.Host)
+	}
+	if r.Username != "" && r.PasswordEnv == "" {
+		return xerrors.Errorf("registry %s: passwordEnv is required", r.Host)
+	}
+	return nil
+}
+
+func validateRegistries(registries []RegistryAuth) error {
+	hosts := make(map[string]struct{}, len(registries))
+	for _, r := range registries {
+		err := r.Validate()
+		if err != nil {
+			return err
+		}
+		if _, exists := hosts[r.Host]; exists {
+			return xerrors.Errorf("registry %s is configured more than once", r.Host)
+		}
+		hosts[r.Host] = struct{}{}
+	}
+	return nil
+}
+
+// ambientDockerConfigDir returns the Docker CLI config directory of the environment
+func ambientDockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// writeRegistryConfig produces a Docker CLI config directory in dir which contains the ambient Docker config
+// plus the configured registry credentials. It returns the environment which makes the container tools use that config.
+func writeRegistryConfig(dir string, registries []RegistryAuth) (env []string, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := make(map[string]interface{})
+	ambient := ambientDockerConfigDir()
+	if ambient != "" {
+		// the config dir also holds CLI plugins, buildx builders and contexts, which builds still need
+		entries, err := ioutil.ReadDir(ambient)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Name() == "config.json" {
+				continue
+			}
+			err = os.Symlink(filepath.Join(ambient, e.Name()), filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fc, err := ioutil.ReadFile(filepath.Join(ambient, "config.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			err = json.Unmarshal(fc, &cfg)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot unmarshal Docker config: %w", err)
+			}
+		}
+	}
+
+	auths := jsonObject(cfg, "auths")
+	helpers := jsonObject(cfg, "credHelpers")
+	if store, ok := cfg["credsStore"].(string); ok && store != "" {
+		// a credentials store takes precedence over the auths entries, hence we turn it into per-registry helpers
+		for host := range auths {
+			if _, exists := helpers[host]; !exists {
+				helpers[host] = store
+			}
+		}
+		delete(cfg, "credsStore")
+	}
+
+	for _, r := range registries {
+		if r.CredentialHelper != "" {
+			helpers[r.Host] = r.CredentialHelper
+			continue
+		}
+
+		password := os.Getenv(r.PasswordEnv)
+		if password == "" {
+			log.WithField("registry", r.Host).Warnf("%s is not set - using the ambient credentials of this registry", r.PasswordEnv)
+			continue
+		}
+		delete(helpers, r.Host)
+		auths[r.Host] = map[string]interface{}{
+			"auth": base64.StdEncoding.EncodeToString([]byte(r.Username + ":" + password)),
+		}
+	}
+	cfg["auths"] = auths
+	cfg["credHelpers"] = helpers
+
+	fc, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fn := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(fn, fc, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"DOCKER_CONFIG=" + dir,
+		// podman, buildah and skopeo read the same format
+		"REGISTRY_AUTH_FILE=" + fn,
+	}, nil
+}
+
+func jsonObject(cfg map[string]interface{}, key string) map[string]interface{} {
+	if res, ok := cfg[key].(map[string]interface{}); ok {
+		return res
+	}
+	return make(map[string]interface{})
+}
@@ -0,0 +1,92 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteRegistryConfig(t *testing.T) {
+	ambient, err := ioutil.TempDir("", "gorpa-registry-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(ambient)
+
+	err = os.Mkdir(filepath.Join(ambient, "cli-plugins"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(ambient, "config.json"), []byte(`{"auths":{"ghcr.io":{},"docker.io":{}},"credsStore":"desktop","credHelpers":{"docker.io":"other"},"detachKeys":"ctrl-x"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", ambient)
+	t.Setenv("GORPA_TEST_REGISTRY_PASSWORD", "secret")
+
+	dir := filepath.Join(ambient, "generated")
+	env, err := writeRegistryConfig(dir, []RegistryAuth{
+		{Host: "eu.gcr.io", CredentialHelper: "gcloud"},
+		{Host: "ghcr.io", Username: "alice", PasswordEnv: "GORPA_TEST_REGISTRY_PASSWORD"},
+		{Host: "quay.io", Username: "bob", PasswordEnv: "GORPA_TEST_REGISTRY_UNSET"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEnv := []string{"DOCKER_CONFIG=" + dir, "REGISTRY_AUTH_FILE=" + filepath.Join(dir, "config.json")}
+	if diff := cmp.Diff(expectedEnv, env); diff != "" {
+		t.Errorf("writeRegistryConfig() env mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cli-plugins")); err != nil {
+		t.Errorf("ambient config dir entries are not available: %v", err)
+	}
+
+	fc, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var act map[string]interface{}
+	err = json.Unmarshal(fc, &act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := map[string]interface{}{
+		"auths": map[string]interface{}{
+			"docker.io": map[string]interface{}{},
+			"ghcr.io":   map[string]interface{}{"auth": "YWxpY2U6c2VjcmV0"},
+		},
+		"credHelpers": map[string]interface{}{
+			"docker.io": "other",
+			"eu.gcr.io": "gcloud",
+		},
+		"detachKeys": "ctrl-x",
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("writeRegistryConfig() config mismatch (-want +got):\n%s", diff)
+	}
+}
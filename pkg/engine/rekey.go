@@ -0,0 +1,129 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// Rekey copies the artifacts of the packages which the remote cache holds under their versions computed using
+// a previous content hash configuration to their current versions, s.t. changing the content hash algorithm or key
+// does not invalidate the remote cache. The artifacts themselves are not modified, i.e. provenance they contain
+// still refers to the previous versions. Rekey returns the packages whose artifacts were copied.
+func Rekey(pkgs []*Package, from ContentHash, opts ...BuildOption) (rekeyed []*Package, err error) {
+	options, err := applyBuildOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = from.Validate()
+	if err != nil {
+		return nil, xerrors.Errorf("invalid previous content hash: %w", err)
+	}
+
+	var (
+		idx     = make(map[string]struct{})
+		apps    = make(map[*Application]ContentHash)
+		visited []*Package
+		all     []*Package
+	)
+	for _, pkg := range pkgs {
+		for _, p := range append(pkg.GetTransitiveDependencies(), pkg) {
+			if _, exists := idx[p.FullName()]; exists {
+				continue
+			}
+			idx[p.FullName()] = struct{}{}
+			apps[p.C.W] = p.C.W.ContentHash
+			visited = append(visited, p)
+
+			// ephemeral packages are never cached
+			if p.Ephemeral {
+				continue
+			}
+			all = append(all, p)
+		}
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-rekey-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+	tmp := &FilesystemCache{Origin: tmpdir}
+
+	// the versions of all packages are computed using the previous content hash until we switch back.
+	// Ephemeral packages are not cached, but their versions are part of the versions of their dependants.
+	setContentHash := func(cfg func(a *Application) ContentHash) {
+		for a := range apps {
+			a.ContentHash = cfg(a)
+		}
+		for _, p := range visited {
+			p.versionCache = ""
+		}
+	}
+	setContentHash(func(*Application) ContentHash { return from })
+	defer setContentHash(func(a *Application) ContentHash { return apps[a] })
+
+	err = options.RemoteCache.Download(tmp, all)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[*Package]string)
+	for _, p := range all {
+		if fn, exists := tmp.Location(p); exists {
+			previous[p] = fn
+		}
+	}
+
+	setContentHash(func(a *Application) ContentHash { return apps[a] })
+	moved := make(map[*Package]string)
+	for _, p := range all {
+		fn, ok := previous[p]
+		if !ok {
+			log.WithField("package", p.FullName()).Debug("no artifact of previous version in remote cache")
+			continue
+		}
+		dst, _ := tmp.Location(p)
+		if dst == fn {
+			// the content hash did not change the version, e.g. because it's the same configuration
+			continue
+		}
+		err = os.Rename(fn, dst)
+		if err != nil {
+			return nil, err
+		}
+		rekeyed = append(rekeyed, p)
+		moved[p] = fn
+	}
+
+	err = options.RemoteCache.Upload(tmp, rekeyed)
+	if err != nil {
+		return nil, err
+	}
+	err = rekeyRetention(options.releaseStore, options.ReleaseTag, moved, tmp)
+	if err != nil {
+		return nil, err
+	}
+	return rekeyed, nil
+}
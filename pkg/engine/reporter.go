@@ -64,6 +64,9 @@ type Reporter interface {
 
 // ConsoleReporter reports build progress by printing to stdout/stderr
 type ConsoleReporter struct {
+	// Out receives the build progress. Defaults to stdout.
+	Out io.Writer
+
 	writer map[string]io.Writer
 	times  map[string]time.Time
 	mu     sync.RWMutex
@@ -85,6 +88,7 @@ func (w *exclusiveWriter) Write(p []byte) (n int, err error) {
 // NewConsoleReporter produces a new console logger
 func NewConsoleReporter() *ConsoleReporter {
 	return &ConsoleReporter{
+		Out:    os.Stdout,
 		writer: make(map[string]io.Writer),
 		times:  make(map[string]time.Time),
 	}
@@ -106,7 +110,7 @@ func (r *ConsoleReporter) getWriter(pkg *Package) io.Writer {
 			return res
 		}
 
-		res = &exclusiveWriter{O: textio.NewPrefixWriter(os.Stdout, getRunPrefix(pkg))}
+		res = &exclusiveWriter{O: textio.NewPrefixWriter(r.Out, getRunPrefix(pkg))}
 		r.writer[name] = res
 		r.mu.Unlock()
 	}
@@ -128,13 +132,15 @@ func (r *ConsoleReporter) BuildStarted(pkg *Package, status map[*Package]Package
 		format := "%s\t%s\t%s\n"
 		if status == PackageBuilt {
 			lines[i] = fmt.Sprintf(format, color.Green.Sprint("📦\tcached"), pkg.FullName(), color.Gray.Sprintf("(version %s)", version))
+		} else if status == PackageSkipped {
+			lines[i] = fmt.Sprintf(format, color.Gray.Sprint("⏩\tskipped"), pkg.FullName(), color.Gray.Sprintf("(version %s)", version))
 		} else {
 			lines[i] = fmt.Sprintf(format, color.Yellow.Sprint("🔧\tbuild"), pkg.FullName(), color.Gray.Sprintf("(version %s)", version))
 		}
 		i++
 	}
 	sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
-	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	tw := tabwriter.NewWriter(r.Out, 0, 2, 2, ' ', 0)
 	fmt.Fprintln(tw, strings.Join(lines, ""))
 	tw.Flush()
 }
@@ -142,11 +148,11 @@ func (r *ConsoleReporter) BuildStarted(pkg *Package, status map[*Package]Package
 // BuildFinished is called when the build of a package whcih was started by the user has finished.
 func (r *ConsoleReporter) BuildFinished(pkg *Package, err error) {
 	if err != nil {
-		color.Printf("<red>build failed</>\n<white>Reason:</> %s\n", err)
+		color.Fprintf(r.Out, "<red>build failed</>\n<white>Reason:</> %s\n", err)
 		return
 	}
 
-	color.Println("\n<green>build succeded</>")
+	color.Fprintln(r.Out, "\n<green>build succeded</>")
 }
 
 // PackageBuildStarted is called when a package build actually gets underway.
@@ -184,7 +190,9 @@ func (r *ConsoleReporter) PackageBuildFinished(pkg *Package, err error) {
 	r.mu.Unlock()
 
 	msg := color.Sprintf("<green>package build succeded</> <gray>(%.2fs)</>\n", dur.Seconds())
-	if err != nil {
+	if err != nil && ErrorClass(err) == ErrorClassInfrastructure {
+		msg = color.Sprintf("<red>package build failed (infrastructure error)</>\n<white>Reason:</> %s\n", err)
+	} else if err != nil {
 		msg = color.Sprintf("<red>package build failed</>\n<white>Reason:</> %s\n", err)
 	}
 	//nolint:errcheck
@@ -205,6 +213,9 @@ func NewGorpaReporter() *GorpaReporter {
 // GorpaReporter works like the console reporter but adds GoRPA output
 type GorpaReporter struct {
 	*ConsoleReporter
+
+	// ImageRewrite must match the Docker image rewrite of the build for the reported images to be correct
+	ImageRewrite DockerImageRewrite
 }
 
 // BuildStarted is called when the build of a package is started by the user.
@@ -219,7 +230,7 @@ func (r *GorpaReporter) BuildStarted(pkg *Package, status map[*Package]PackageBu
 			continue
 		}
 
-		fmt.Printf("[%s|START] will be built\n", p.FullName())
+		fmt.Fprintf(r.Out, "[%s|START] will be built\n", p.FullName())
 	}
 }
 
@@ -228,8 +239,8 @@ func (r *GorpaReporter) PackageBuildFinished(pkg *Package, err error) {
 	r.ConsoleReporter.PackageBuildFinished(pkg, err)
 
 	if cfg, ok := pkg.Config.(DockerPkgConfig); ok && pkg.Type == DockerPackage {
-		for _, img := range cfg.Image {
-			fmt.Printf("[docker|RESULT] %s\n", img)
+		for _, img := range r.ImageRewrite.ApplyAll(cfg.Image) {
+			fmt.Fprintf(r.Out, "[docker|RESULT] %s\n", img)
 		}
 	}
 
@@ -244,5 +255,5 @@ func (r *GorpaReporter) PackageBuildFinished(pkg *Package, err error) {
 		status = "FAIL"
 		msg = err.Error()
 	}
-	fmt.Printf("[%s|%s] %s\n", pkg.FullName(), status, msg)
+	fmt.Fprintf(r.Out, "[%s|%s] %s\n", pkg.FullName(), status, msg)
 }
@@ -0,0 +1,197 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// reproducibilityIgnoredFiles are added to build artifacts by Bhojpur GoRPA and record when and where a package was built
+var reproducibilityIgnoredFiles = map[string]struct{}{
+	buildInfoFilename:           {},
+	provenanceBundleFilename:    {},
+	provenancePredicateFilename: {},
+	sbomFilename:                {},
+}
+
+// ArtifactDifference describes how a file differs between the artifacts of two builds of a package
+type ArtifactDifference struct {
+	Name   string
+	Reason string
+}
+
+// ReproducibilityReport is the result of a reproducibility check
+type ReproducibilityReport struct {
+	Package     *Package
+	Version     string
+	Files       int
+	Differences []ArtifactDifference
+}
+
+// Reproducible returns true if both builds produced the same files
+func (r *ReproducibilityReport) Reproducible() bool {
+	return len(r.Differences) == 0
+}
+
+// CheckReproducibility builds a package twice, each time in a clean build directory, and compares the two artifacts.
+// Dependencies are taken from (or built into) the configured local cache, but the package itself always builds into
+// an empty cache of its own and nothing is uploaded to the remote cache.
+func CheckReproducibility(pkg *Package, opts ...BuildOption) (*ReproducibilityReport, error) {
+	if pkg.Type == DockerPackage {
+		return nil, xerrors.Errorf("cannot check the reproducibility of %s: Docker packages are not supported", pkg.FullName())
+	}
+	options, err := applyBuildOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	version, err := pkg.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-repro-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var artifacts [2]string
+	for i := range artifacts {
+		cache := &reproducibilityCache{
+			Cache:   options.LocalCache,
+			Package: pkg,
+			Target:  &FilesystemCache{Origin: filepath.Join(tmpdir, fmt.Sprintf("build-%d", i+1))},
+		}
+		err = os.MkdirAll(cache.Target.Origin, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(options.HumanOutput, "🔁  building %s (%d/%d)\n", pkg.FullName(), i+1, len(artifacts))
+		err = Build(pkg, append(opts,
+			WithLocalCache(cache),
+			WithRemoteCache(&downloadOnlyRemoteCache{options.RemoteCache}),
+		)...)
+		if err != nil {
+			return nil, xerrors.Errorf("build %d of %s failed: %w", i+1, pkg.FullName(), err)
+		}
+
+		fn, exists := cache.Target.Location(pkg)
+		if !exists {
+			return nil, xerrors.Errorf("build %d of %s did not produce an artifact", i+1, pkg.FullName())
+		}
+		artifacts[i] = fn
+	}
+
+	res, err := compareArtifacts(artifacts[0], artifacts[1])
+	if err != nil {
+		return nil, err
+	}
+	res.Package = pkg
+	res.Version = version
+	return res, nil
+}
+
+// compareArtifacts lists the files which differ between two build artifacts
+func compareArtifacts(fn1, fn2 string) (*ReproducibilityReport, error) {
+	var entries [2]map[string]deltaEntry
+	for i, fn := range []string{fn1, fn2} {
+		mf, err := readArtifactManifest(fn)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read artifact %s: %w", fn, err)
+		}
+		entries[i] = make(map[string]deltaEntry, len(mf))
+		for _, e := range mf {
+			name := path.Clean(e.Name)
+			if _, ignored := reproducibilityIgnoredFiles[name]; ignored {
+				continue
+			}
+			entries[i][name] = e
+		}
+	}
+
+	res := &ReproducibilityReport{Files: len(entries[0])}
+	for name, a := range entries[0] {
+		b, ok := entries[1][name]
+		var reason string
+		switch {
+		case !ok:
+			reason = "only in build 1"
+		case a.Type != b.Type:
+			reason = "type"
+		case a.Hash != b.Hash || a.Size != b.Size:
+			reason = "content"
+		case a.Linkname != b.Linkname:
+			reason = "link target"
+		case a.Mode != b.Mode:
+			reason = "mode"
+		default:
+			continue
+		}
+		res.Differences = append(res.Differences, ArtifactDifference{Name: name, Reason: reason})
+	}
+	for name := range entries[1] {
+		if _, ok := entries[0][name]; !ok {
+			res.Files++
+			res.Differences = append(res.Differences, ArtifactDifference{Name: name, Reason: "only in build 2"})
+		}
+	}
+	sort.Slice(res.Differences, func(i, j int) bool {
+		return res.Differences[i].Name < res.Differences[j].Name
+	})
+	return res, nil
+}
+
+// reproducibilityCache keeps the artifact of the package under test apart from those of its dependencies
+type reproducibilityCache struct {
+	Cache
+	Package *Package
+	Target  *FilesystemCache
+}
+
+// Location returns the absolute filesystem path for a package build artifact
+func (c *reproducibilityCache) Location(pkg *Package) (path string, exists bool) {
+	if pkg == c.Package {
+		return c.Target.Location(pkg)
+	}
+	return c.Cache.Location(pkg)
+}
+
+// downloadOnlyRemoteCache keeps the artifacts of a reproducibility check out of the remote cache
+type downloadOnlyRemoteCache struct {
+	RemoteCache
+}
+
+func (c downloadOnlyRemoteCache) String() string {
+	return RemoteCacheName(c.RemoteCache)
+}
+
+// Upload does nothing
+func (downloadOnlyRemoteCache) Upload(src Cache, pkgs []*Package) error {
+	return nil
+}
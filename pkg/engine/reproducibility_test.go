@@ -0,0 +1,102 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorpa-repro-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(fn string, files map[string]string) {
+		err := writeArtifact(fn, func(out *tar.Writer) error {
+			for name, content := range files {
+				hdr := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(content))}
+				err := copyArtifactEntry(out, hdr, strings.NewReader(content))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		fn1 = filepath.Join(dir, "build-1.tar.gz")
+		fn2 = filepath.Join(dir, "build-2.tar.gz")
+	)
+	write(fn1, map[string]string{
+		"./" + buildInfoFilename: `{"package":"comp:pkg","buildTime":"2021-06-01T12:00:00Z"}`,
+		"./bin":                  "binary",
+		"./same":                 "same",
+		"./stamp":                "12:00",
+		"./removed":              "gone",
+	})
+	write(fn2, map[string]string{
+		"./" + buildInfoFilename: `{"package":"comp:pkg","buildTime":"2021-06-01T12:01:00Z"}`,
+		"./bin":                  "binary",
+		"./same":                 "same",
+		"./stamp":                "12:01",
+		"./added":                "new",
+	})
+
+	report, err := compareArtifacts(fn1, fn2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectation := []ArtifactDifference{
+		{Name: "added", Reason: "only in build 2"},
+		{Name: "removed", Reason: "only in build 1"},
+		{Name: "stamp", Reason: "content"},
+	}
+	if diff := cmp.Diff(expectation, report.Differences); diff != "" {
+		t.Errorf("compareArtifacts() mismatch (-want +got):\n%s", diff)
+	}
+	if report.Files != 5 {
+		t.Errorf("expected 5 files, got %d", report.Files)
+	}
+	if report.Reproducible() {
+		t.Errorf("expected artifacts with differences not to be reproducible")
+	}
+
+	report, err = compareArtifacts(fn1, fn1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Reproducible() {
+		t.Errorf("expected identical artifacts to be reproducible, got %v", report.Differences)
+	}
+}
@@ -0,0 +1,409 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvvarCgroupRoot names a delegated cgroup (v2) below which package builds with resource limits run.
+	// Defaults to the cgroup Bhojpur GoRPA runs in, which then must not contain other processes.
+	EnvvarCgroupRoot = "GORPA_CGROUP_ROOT"
+
+	// ErrorClassInfrastructure marks build errors caused by the build environment rather than the package itself
+	ErrorClassInfrastructure = "infrastructure"
+
+	cgroupMount = "/sys/fs/cgroup"
+)
+
+// ResourceLimits restrict the resources the build of a package may use. Limits are enforced using cgroups on Linux.
+// The scheduler weighs package builds by their CPUs and memory, too.
+type ResourceLimits struct {
+	// Memory is the maximum memory of all build processes, e.g. 512M or 4G
+	Memory string `yaml:"memory,omitempty"`
+	// CPUs is the number of CPUs the build processes may use, e.g. 1.5
+	CPUs float64 `yaml:"cpus,omitempty"`
+	// Pids is the maximum number of build processes and threads
+	Pids int64 `yaml:"pids,omitempty"`
+	// Exclusive packages build while no other package builds
+	Exclusive bool `yaml:"exclusive,omitempty"`
+}
+
+// IsEmpty returns true if no limits are set. Exclusive builds need no limits to be enforced.
+func (r ResourceLimits) IsEmpty() bool {
+	return r.Memory == "" && r.CPUs == 0 && r.Pids == 0
+}
+
+// Validate returns an error if a limit is invalid
+func (r ResourceLimits) Validate() error {
+	if r.Memory != "" {
+		if _, err := parseMemoryLimit(r.Memory); err != nil {
+			return err
+		}
+	}
+	if r.CPUs < 0 {
+		return xerrors.Errorf("invalid cpus limit: %v", r.CPUs)
+	}
+	if r.Pids < 0 {
+		return xerrors.Errorf("invalid pids limit: %d", r.Pids)
+	}
+	return nil
+}
+
+// parseMemoryLimit parses a number of bytes with an optional K, M or G suffix (powers of 1024)
+func parseMemoryLimit(s string) (int64, error) {
+	var (
+		num  = strings.TrimSuffix(strings.TrimSpace(s), "i")
+		mult = map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+		unit = int64(1)
+	)
+	if n := len(num); n > 0 {
+		if m, ok := mult[strings.ToUpper(num[n-1:])]; ok {
+			unit = m
+			num = num[:n-1]
+		}
+	}
+	res, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || res <= 0 {
+		return 0, xerrors.Errorf("invalid memory limit: %s", s)
+	}
+	return res * unit, nil
+}
+
+// ResourceLimitErr is returned when a package build failed after exceeding its resource limits
+type ResourceLimitErr struct {
+	Package  *Package
+	Resource string
+	Limit    string
+	Err      error
+}
+
+func (e ResourceLimitErr) Error() string {
+	return fmt.Sprintf("build of %s exceeded its %s limit of %s: %v", e.Package.FullName(), e.Resource, e.Limit, e.Err)
+}
+
+func (e ResourceLimitErr) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass classifies a build error. It returns an empty string for regular build failures.
+func ErrorClass(err error) string {
+	var rle ResourceLimitErr
+	if errors.As(err, &rle) {
+		return ErrorClassInfrastructure
+	}
+	return ""
+}
+
+// cgroupManager creates the cgroups of package builds below a common parent
+type cgroupManager struct {
+	once   sync.Once
+	parent string
+	err    error
+
+	mu     sync.Mutex
+	groups map[*Package]*packageCgroup
+}
+
+func (m *cgroupManager) init() {
+	if runtime.GOOS != "linux" {
+		m.err = xerrors.Errorf("resource limits are only supported on Linux")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		m.err = xerrors.Errorf("resource limits require cgroup v2")
+		return
+	}
+
+	if root := os.Getenv(EnvvarCgroupRoot); root != "" {
+		m.parent = root
+		if !filepath.IsAbs(root) || !strings.HasPrefix(root, cgroupMount) {
+			m.parent = filepath.Join(cgroupMount, root)
+		}
+	} else {
+		self, err := ownCgroup()
+		if err != nil {
+			m.err = err
+			return
+		}
+
+		// cgroups with processes cannot delegate controllers to their children, hence we move ourselves into a leaf
+		procs, err := ioutil.ReadFile(filepath.Join(self, "cgroup.procs"))
+		if err != nil {
+			m.err = err
+			return
+		}
+		if pids := strings.Fields(string(procs)); len(pids) != 1 || pids[0] != strconv.Itoa(os.Getpid()) {
+			m.err = xerrors.Errorf("cgroup %s contains other processes - set %s to a delegated cgroup", self, EnvvarCgroupRoot)
+			return
+		}
+		leaf := filepath.Join(self, "gorpa")
+		err = os.MkdirAll(leaf, 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644)
+		}
+		if err != nil {
+			m.err = xerrors.Errorf("cannot move into leaf cgroup: %w", err)
+			return
+		}
+		m.parent = self
+	}
+
+	err := ioutil.WriteFile(filepath.Join(m.parent, "cgroup.subtree_control"), []byte("+memory +cpu +pids"), 0644)
+	if err != nil {
+		m.err = xerrors.Errorf("cannot enable cgroup controllers in %s: %w", m.parent, err)
+	}
+}
+
+// ownCgroup returns the cgroup v2 directory of this process
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "0::") {
+			return filepath.Join(cgroupMount, strings.TrimPrefix(scanner.Text(), "0::")), nil
+		}
+	}
+	return "", xerrors.Errorf("cannot find own cgroup")
+}
+
+// Create produces the cgroup for a package build. If resource limits cannot be enforced, Create warns and returns nil.
+func (m *cgroupManager) Create(p *Package, buildID string) (*packageCgroup, error) {
+	if p.Resources.IsEmpty() {
+		return nil, nil
+	}
+
+	m.once.Do(m.init)
+	if m.err != nil {
+		log.WithError(m.err).WithField("package", p.FullName()).Warn("cannot enforce resource limits")
+		return nil, nil
+	}
+
+	dir := filepath.Join(m.parent, fmt.Sprintf("%s-%s", buildID, p.FilesystemSafeName()))
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot create cgroup: %w", err)
+	}
+	cg := &packageCgroup{Dir: dir, Limits: p.Resources}
+
+	settings := make(map[string]string)
+	if p.Resources.Memory != "" {
+		mem, _ := parseMemoryLimit(p.Resources.Memory)
+		settings["memory.max"] = strconv.FormatInt(mem, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if p.Resources.CPUs > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d 100000", int64(p.Resources.CPUs*100000))
+	}
+	if p.Resources.Pids > 0 {
+		settings["pids.max"] = strconv.FormatInt(p.Resources.Pids, 10)
+	}
+	for fn, val := range settings {
+		err = ioutil.WriteFile(filepath.Join(dir, fn), []byte(val), 0644)
+		if err != nil && !(fn == "memory.swap.max" && os.IsNotExist(err)) {
+			cg.Remove()
+			return nil, xerrors.Errorf("cannot set %s: %w", fn, err)
+		}
+	}
+
+	m.mu.Lock()
+	if m.groups == nil {
+		m.groups = make(map[*Package]*packageCgroup)
+	}
+	m.groups[p] = cg
+	m.mu.Unlock()
+
+	return cg, nil
+}
+
+// Get returns the cgroup of a package build, or nil if the package builds without limits
+func (m *cgroupManager) Get(p *Package) *packageCgroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.groups[p]
+}
+
+// Release removes the cgroup of a package build
+func (m *cgroupManager) Release(p *Package) {
+	m.mu.Lock()
+	cg := m.groups[p]
+	delete(m.groups, p)
+	m.mu.Unlock()
+
+	if cg != nil {
+		cg.Remove()
+	}
+}
+
+type packageCgroup struct {
+	Dir    string
+	Limits ResourceLimits
+}
+
+// Command wraps a command s.t. it and all its children run in the cgroup
+func (cg *packageCgroup) Command(name string, args ...string) (string, []string) {
+	return "sh", append([]string{"-c", `echo $$ > "$0" && exec "$@"`, filepath.Join(cg.Dir, "cgroup.procs"), name}, args...)
+}
+
+// Violation returns an error if a resource limit was hit
+func (cg *packageCgroup) Violation(p *Package, err error) error {
+	if cg.eventCount("memory.events", "oom_kill") > 0 {
+		return ResourceLimitErr{Package: p, Resource: "memory", Limit: cg.Limits.Memory, Err: err}
+	}
+	if cg.eventCount("pids.events", "max") > 0 {
+		return ResourceLimitErr{Package: p, Resource: "pids", Limit: strconv.FormatInt(cg.Limits.Pids, 10), Err: err}
+	}
+	return err
+}
+
+func (cg *packageCgroup) eventCount(fn, event string) int64 {
+	fc, err := ioutil.ReadFile(filepath.Join(cg.Dir, fn))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(fc), "\n") {
+		segs := strings.Fields(line)
+		if len(segs) == 2 && segs[0] == event {
+			res, _ := strconv.ParseInt(segs[1], 10, 64)
+			return res
+		}
+	}
+	return 0
+}
+
+// Remove kills left-over processes and removes the cgroup
+func (cg *packageCgroup) Remove() {
+	// cgroup.kill exists from Linux 5.14 onwards
+	_ = ioutil.WriteFile(filepath.Join(cg.Dir, "cgroup.kill"), []byte("1"), 0644)
+
+	// killed processes leave the cgroup asynchronously
+	var err error
+	for i := 0; i < 10; i++ {
+		err = os.Remove(cg.Dir)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		log.WithError(err).WithField("cgroup", cg.Dir).Warn("cannot remove cgroup")
+	}
+}
+
+// newBuildScheduler produces a scheduler for up to maxTasks concurrent builds which together declare up to maxMemory bytes.
+// Zero disables the respective limit.
+func newBuildScheduler(maxTasks, maxMemory int64) *buildScheduler {
+	res := &buildScheduler{maxTasks: maxTasks, maxMemory: maxMemory}
+	if maxTasks > 0 {
+		res.tasks = semaphore.NewWeighted(maxTasks)
+	}
+	if maxMemory > 0 {
+		res.memory = semaphore.NewWeighted(maxMemory)
+	}
+	return res
+}
+
+// buildScheduler limits concurrent package builds according to the resources they declare. A build takes one task
+// slot per declared CPU and the declared memory, but never more than there is. Exclusive builds wait for all other
+// builds to finish and block new ones until they're done.
+type buildScheduler struct {
+	maxTasks  int64
+	maxMemory int64
+
+	tasks     *semaphore.Weighted
+	memory    *semaphore.Weighted
+	exclusive sync.RWMutex
+}
+
+// weights returns the task slots and bytes of memory a build with the given resources takes
+func (s *buildScheduler) weights(res ResourceLimits) (tasks, memory int64) {
+	tasks = 1
+	if res.CPUs > 1 {
+		tasks = int64(math.Ceil(res.CPUs))
+	}
+	if s.maxTasks > 0 && tasks > s.maxTasks {
+		tasks = s.maxTasks
+	}
+
+	if res.Memory != "" {
+		memory, _ = parseMemoryLimit(res.Memory)
+	}
+	if s.maxMemory > 0 && memory > s.maxMemory {
+		memory = s.maxMemory
+	}
+	return
+}
+
+// Acquire blocks until a build with the given resources may start. Callers must call Release once the build is done.
+func (s *buildScheduler) Acquire(res ResourceLimits) {
+	if res.Exclusive {
+		s.exclusive.Lock()
+	} else {
+		s.exclusive.RLock()
+	}
+
+	tasks, memory := s.weights(res)
+	if s.tasks != nil {
+		_ = s.tasks.Acquire(context.Background(), tasks)
+	}
+	if s.memory != nil && memory > 0 {
+		_ = s.memory.Acquire(context.Background(), memory)
+	}
+}
+
+// Release returns the resources acquired for a build
+func (s *buildScheduler) Release(res ResourceLimits) {
+	tasks, memory := s.weights(res)
+	if s.memory != nil && memory > 0 {
+		s.memory.Release(memory)
+	}
+	if s.tasks != nil {
+		s.tasks.Release(tasks)
+	}
+
+	if res.Exclusive {
+		s.exclusive.Unlock()
+	} else {
+		s.exclusive.RUnlock()
+	}
+}
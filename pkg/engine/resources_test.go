@@ -0,0 +1,148 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseMemoryLimit(t *testing.T) {
+	tests := []struct {
+		Input       string
+		Expectation int64
+		ExpectError bool
+	}{
+		{Input: "1024", Expectation: 1024},
+		{Input: "512M", Expectation: 512 << 20},
+		{Input: "2Gi", Expectation: 2 << 30},
+		{Input: "64k", Expectation: 64 << 10},
+		{Input: "G", ExpectError: true},
+		{Input: "-1G", ExpectError: true},
+		{Input: "lots", ExpectError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Input, func(t *testing.T) {
+			act, err := parseMemoryLimit(test.Input)
+			if test.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act != test.Expectation {
+				t.Errorf("parseMemoryLimit(%q) = %d, expected %d", test.Input, act, test.Expectation)
+			}
+		})
+	}
+}
+
+func TestCgroupViolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorpa-cgroup-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		pkg      = &Package{C: &Component{Name: "comp"}, packageInternal: packageInternal{Name: "pkg"}}
+		cg       = &packageCgroup{Dir: dir, Limits: ResourceLimits{Memory: "1G", Pids: 10}}
+		buildErr = errors.New("exit status 137")
+	)
+	if err := cg.Violation(pkg, buildErr); err != buildErr || ErrorClass(err) != "" {
+		t.Errorf("expected the build error for a cgroup without events, got %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "memory.events"), []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cg.Violation(pkg, buildErr)
+	var rle ResourceLimitErr
+	if !errors.As(err, &rle) || rle.Resource != "memory" {
+		t.Fatalf("expected a memory limit error, got %v", err)
+	}
+	if ErrorClass(err) != ErrorClassInfrastructure {
+		t.Errorf("expected the %s error class, got %q", ErrorClassInfrastructure, ErrorClass(err))
+	}
+	if !errors.Is(err, buildErr) {
+		t.Errorf("resource limit error does not wrap the build error")
+	}
+}
+
+func TestBuildSchedulerWeights(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Res    ResourceLimits
+		Tasks  int64
+		Memory int64
+	}{
+		{Name: "no resources", Tasks: 1},
+		{Name: "fraction of a CPU", Res: ResourceLimits{CPUs: 0.5}, Tasks: 1},
+		{Name: "CPUs round up", Res: ResourceLimits{CPUs: 2.5}, Tasks: 3},
+		{Name: "more CPUs than tasks", Res: ResourceLimits{CPUs: 16}, Tasks: 4},
+		{Name: "memory", Res: ResourceLimits{Memory: "2G"}, Tasks: 1, Memory: 2 << 30},
+		{Name: "more memory than available", Res: ResourceLimits{Memory: "64G"}, Tasks: 1, Memory: 8 << 30},
+	}
+	s := newBuildScheduler(4, 8<<30)
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tasks, memory := s.weights(test.Res)
+			if tasks != test.Tasks || memory != test.Memory {
+				t.Errorf("expected %d tasks and %d bytes, got %d tasks and %d bytes", test.Tasks, test.Memory, tasks, memory)
+			}
+		})
+	}
+}
+
+func TestBuildSchedulerExclusive(t *testing.T) {
+	var (
+		s         = newBuildScheduler(0, 0)
+		exclusive = ResourceLimits{Exclusive: true}
+		acquired  = make(chan struct{})
+	)
+	s.Acquire(ResourceLimits{})
+	go func() {
+		s.Acquire(exclusive)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("exclusive build started while another build was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Release(ResourceLimits{})
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exclusive build did not start once the other build finished")
+	}
+	s.Release(exclusive)
+}
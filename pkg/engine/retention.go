@@ -0,0 +1,200 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// retentionMarkerInfix separates the version of an artifact from the release tag in the name of its retention marker,
+// e.g. <version>.retention.v1.2.3.json. Pruning the remote cache must keep all objects of a version for which a
+// retention marker exists.
+const retentionMarkerInfix = ".retention."
+
+var releaseTagPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// retentionMarker is stored next to the artifacts of a release build
+type retentionMarker struct {
+	Tag      string    `json:"tag"`
+	Package  string    `json:"package"`
+	Version  string    `json:"version"`
+	Artifact string    `json:"artifact"`
+	Created  time.Time `json:"created"`
+}
+
+// retentionMarkerName returns the name of the retention marker object of an artifact for a release tag
+func retentionMarkerName(artifact, tag string) string {
+	version := strings.TrimSuffix(filepath.Base(artifact), ".tar.gz")
+	return version + retentionMarkerInfix + tag + ".json"
+}
+
+// WithReleaseTag marks the artifacts of all packages of the build with a retention marker in the remote
+// cache, s.t. they're never pruned. The store must be able to store objects other than artifacts.
+func WithReleaseTag(tag string, store RemoteCache) BuildOption {
+	return func(opts *buildOptions) error {
+		if tag == "" {
+			return nil
+		}
+		if !releaseTagPattern.MatchString(tag) {
+			return xerrors.Errorf("invalid release tag %q: must consist of letters, digits, dots, dashes and underscores", tag)
+		}
+		objs, ok := store.(objectStore)
+		if !ok {
+			return xerrors.Errorf("release tags require a remote cache which can store retention markers, not %T", store)
+		}
+		opts.ReleaseTag = tag
+		opts.releaseStore = objs
+		return nil
+	}
+}
+
+// tagRelease uploads a retention marker for each of the packages whose artifact is in the local cache.
+// Markers are uploaded on a best effort basis like all remote cache transfers.
+func (c *buildContext) tagRelease(pkgs []*Package) error {
+	if c.ReleaseTag == "" {
+		return nil
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-retention-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		objs = make(map[string]string, len(pkgs))
+		now  = time.Now().UTC()
+	)
+	for _, p := range pkgs {
+		artifact, exists := c.LocalCache.Location(p)
+		if !exists || p.Ephemeral {
+			log.WithField("package", p.FullName()).Warn("package has no cached artifact - cannot tag it for release")
+			continue
+		}
+		version, err := p.Version()
+		if err != nil {
+			return err
+		}
+
+		fc, err := json.MarshalIndent(retentionMarker{
+			Tag:      c.ReleaseTag,
+			Package:  p.FullName(),
+			Version:  version,
+			Artifact: filepath.Base(artifact),
+			Created:  now,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		name := retentionMarkerName(artifact, c.ReleaseTag)
+		fn := filepath.Join(tmpdir, name)
+		err = ioutil.WriteFile(fn, fc, 0644)
+		if err != nil {
+			return err
+		}
+		objs[name] = fn
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	log.WithField("release", c.ReleaseTag).WithField("artifacts", len(objs)).Info("tagging artifacts for release")
+	c.releaseStore.putObjects(objs)
+	return nil
+}
+
+// rekeyRetention carries the retention markers of a release over to the new versions of rekeyed artifacts.
+// previous maps the rekeyed packages to the names of their previous artifacts. Only artifacts whose
+// previous version was retained for the release are marked again.
+func rekeyRetention(store objectStore, tag string, previous map[*Package]string, cache Cache) error {
+	if tag == "" || len(previous) == 0 {
+		return nil
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-retention-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var (
+		old  = make(map[string]string, len(previous))
+		pkgs = make(map[string]*Package, len(previous))
+	)
+	for p, artifact := range previous {
+		name := retentionMarkerName(artifact, tag)
+		old[name] = filepath.Join(tmpdir, name)
+		pkgs[name] = p
+	}
+	store.getObjects(old)
+
+	objs := make(map[string]string)
+	for name, fn := range old {
+		fc, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var marker retentionMarker
+		err = json.Unmarshal(fc, &marker)
+		if err != nil {
+			log.WithError(err).WithField("marker", name).Warn("cannot parse retention marker - not carrying it over")
+			continue
+		}
+
+		p := pkgs[name]
+		artifact, _ := cache.Location(p)
+		marker.Version, err = p.Version()
+		if err != nil {
+			return err
+		}
+		marker.Artifact = filepath.Base(artifact)
+		fc, err = json.MarshalIndent(marker, "", "  ")
+		if err != nil {
+			return err
+		}
+		newName := retentionMarkerName(artifact, tag)
+		dst := filepath.Join(tmpdir, newName)
+		err = ioutil.WriteFile(dst, fc, 0644)
+		if err != nil {
+			return err
+		}
+		objs[newName] = dst
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	log.WithField("release", tag).WithField("artifacts", len(objs)).Info("carrying release retention over to rekeyed artifacts")
+	store.putObjects(objs)
+	return nil
+}
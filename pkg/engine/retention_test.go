@@ -0,0 +1,159 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagRelease(t *testing.T) {
+	ba := &Application{}
+	newPkg := func(name string) *Package {
+		return testPackage(ba, name, GenericPackage)
+	}
+	var (
+		cached   = newPkg("cached")
+		uncached = newPkg("uncached")
+		store    = dirObjectStore{Dir: t.TempDir()}
+		cache    = &FilesystemCache{Origin: t.TempDir()}
+	)
+	fn, _ := cache.Location(cached)
+	err := ioutil.WriteFile(fn, []byte("artifact"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opts buildOptions
+	err = WithReleaseTag("v1.2.3", store)(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.LocalCache = cache
+	err = (&buildContext{buildOptions: opts}).tagRelease([]*Package{cached, uncached})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	markers, err := filepath.Glob(filepath.Join(store.Dir, "*"+retentionMarkerInfix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markers) != 1 {
+		t.Fatalf("expected one retention marker, got %v", markers)
+	}
+	if exp := filepath.Join(store.Dir, retentionMarkerName(fn, "v1.2.3")); markers[0] != exp {
+		t.Errorf("expected marker %s, got %s", exp, markers[0])
+	}
+	fc, err := ioutil.ReadFile(markers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marker retentionMarker
+	err = json.Unmarshal(fc, &marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker.Tag != "v1.2.3" || marker.Package != "comp:cached" || marker.Artifact != filepath.Base(fn) {
+		t.Errorf("unexpected retention marker: %+v", marker)
+	}
+}
+
+func TestWithReleaseTag(t *testing.T) {
+	tests := []struct {
+		Tag   string
+		Store RemoteCache
+		Err   bool
+	}{
+		{Tag: "", Store: nil},
+		{Tag: "v1.2.3", Store: dirObjectStore{}},
+		{Tag: "release_2022-01", Store: dirObjectStore{}},
+		{Tag: "v1.2.3", Store: NoRemoteCache{}, Err: true},
+		{Tag: "../v1", Store: dirObjectStore{}, Err: true},
+		{Tag: "v1 2", Store: dirObjectStore{}, Err: true},
+	}
+	for _, test := range tests {
+		var opts buildOptions
+		err := WithReleaseTag(test.Tag, test.Store)(&opts)
+		if (err != nil) != test.Err {
+			t.Errorf("WithReleaseTag(%q, %T): unexpected error %v", test.Tag, test.Store, err)
+		}
+	}
+}
+
+func TestRekeyRetention(t *testing.T) {
+	var (
+		ba     = &Application{}
+		p      = testPackage(ba, "pkg", GenericPackage)
+		remote = dirRemoteCache{Dir: t.TempDir()}
+		store  = dirObjectStore{Dir: remote.Dir}
+		local  = &FilesystemCache{Origin: t.TempDir()}
+	)
+	fn, _ := local.Location(p)
+	err := ioutil.WriteFile(fn, []byte("artifact"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.Upload(local, []*Package{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opts buildOptions
+	err = WithReleaseTag("v1.2.3", store)(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.LocalCache = local
+	err = (&buildContext{buildOptions: opts}).tagRelease([]*Package{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ba.ContentHash = ContentHash{Algorithm: ContentHashBLAKE3}
+	p.versionCache = ""
+	_, err = Rekey([]*Package{p}, ContentHash{}, WithLocalCache(local), WithRemoteCache(remote), WithReleaseTag("v1.2.3", store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ := local.Location(p)
+	fc, err := ioutil.ReadFile(filepath.Join(store.Dir, retentionMarkerName(current, "v1.2.3")))
+	if err != nil {
+		t.Fatalf("retention marker was not carried over to the current version: %v", err)
+	}
+	var marker retentionMarker
+	err = json.Unmarshal(fc, &marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := p.Version()
+	if marker.Tag != "v1.2.3" || marker.Version != version || marker.Artifact != filepath.Base(current) {
+		t.Errorf("unexpected retention marker: %+v", marker)
+	}
+
+	_, err = os.Stat(filepath.Join(store.Dir, retentionMarkerName(current, "v2.0.0")))
+	if !os.IsNotExist(err) {
+		t.Errorf("unexpected retention marker for another release: %v", err)
+	}
+}
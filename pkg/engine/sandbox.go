@@ -0,0 +1,268 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// sandboxScript mounts the overlays given as pairs of mount point and options up to "--", and then binds the
+// build directory which follows back into place, as the overlays may hide it. The command runs in the build
+// directory as seen through the mounts, such that ../ no longer leads out of the sandbox.
+const sandboxScript = `mount="$0"; while [ "$1" != "--" ]; do "$mount" -t overlay -o "$2" gorpa-sandbox "$1" || exit 126; shift 2; done; shift; wd="$1"; shift; "$mount" --no-canonicalize --bind . "$wd" && cd "$wd" || exit 126; exec "$@"`
+
+// sandboxOutputLimit is the amount of output of a sandboxed build command which we search for undeclared inputs
+const sandboxOutputLimit = 64 * 1024
+
+// UndeclaredInputErr is returned when a sandboxed package build failed after trying to read files which are
+// neither among its declared sources nor its dependencies
+type UndeclaredInputErr struct {
+	Package *Package
+	Paths   []string
+	Err     error
+}
+
+func (e UndeclaredInputErr) Error() string {
+	return fmt.Sprintf("build of %s read undeclared inputs (%s) - add them to the sources of the package or make them a dependency: %v", e.Package.FullName(), strings.Join(e.Paths, ", "), e.Err)
+}
+
+func (e UndeclaredInputErr) Unwrap() error {
+	return e.Err
+}
+
+// buildSandbox shows the build commands of a package only their declared inputs, i.e. the sources and
+// dependencies of the package in its build directory. The application and the build directories of all other
+// packages are hidden by overlays which contain nothing but the build directory of the package. Build commands
+// run in their own mount namespace, created using unshare. Unless Bhojpur GoRPA runs as root, that's a user
+// namespace, too, in which the build commands run as root.
+type buildSandbox struct {
+	once sync.Once
+	args []string
+	// sh and mount are resolved upfront, as the build commands may run with a hermetic PATH which lacks them
+	sh, mount string
+	err       error
+}
+
+func (s *buildSandbox) init() {
+	if runtime.GOOS != "linux" {
+		s.err = xerrors.Errorf("the build sandbox is only supported on Linux")
+		return
+	}
+	if _, err := exec.LookPath("unshare"); err != nil {
+		s.err = xerrors.Errorf("the build sandbox requires unshare: %w", err)
+		return
+	}
+	var err error
+	s.sh, err = exec.LookPath("sh")
+	if err != nil {
+		s.err = xerrors.Errorf("the build sandbox requires sh: %w", err)
+		return
+	}
+	s.mount, err = exec.LookPath("mount")
+	if err != nil {
+		s.err = xerrors.Errorf("the build sandbox requires mount: %w", err)
+		return
+	}
+
+	s.args = []string{"--mount", "--propagation", "private"}
+	if os.Getuid() != 0 {
+		s.args = append([]string{"--user", "--map-root-user"}, s.args...)
+	}
+	out, err := exec.Command("unshare", append(s.args, "true")...).CombinedOutput()
+	if err != nil {
+		s.err = xerrors.Errorf("cannot create build sandbox, e.g. because user namespaces are disabled: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+}
+
+// hiddenPaths returns the paths the sandbox hides from the build commands of a package, outermost first
+func (s *buildSandbox) hiddenPaths(p *Package, buildDir string) []string {
+	var res []string
+	for _, path := range []string{p.C.W.Origin, buildDir} {
+		if path == "" {
+			continue
+		}
+		res = append(res, filepath.Clean(path))
+	}
+	sort.Slice(res, func(i, j int) bool { return len(res[i]) < len(res[j]) })
+	return res
+}
+
+// overlays produces the layers of the overlays which hide the paths in dir. The lower layer of each overlay has
+// only the directories needed to reach wd and the other hidden paths, its upper layer keeps what the build
+// commands write outside of wd until the sandbox is gone. It returns the mount points and options.
+func (s *buildSandbox) overlays(dir, wd string, hidden []string) ([]string, error) {
+	var res []string
+	for i, h := range hidden {
+		var (
+			layers = filepath.Join(dir, strconv.Itoa(i))
+			lower  = filepath.Join(layers, "lower")
+			upper  = filepath.Join(layers, "upper")
+			work   = filepath.Join(layers, "work")
+		)
+		for _, d := range []string{lower, upper, work} {
+			err := os.MkdirAll(d, 0755)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, keep := range append([]string{wd}, hidden[i+1:]...) {
+			if keep == h || !isWithin(keep, h) {
+				continue
+			}
+			rel, err := filepath.Rel(h, keep)
+			if err != nil {
+				return nil, err
+			}
+			err = os.MkdirAll(filepath.Join(lower, rel), 0755)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, h, OverlayOptions(lower, upper, work))
+	}
+	return res, nil
+}
+
+// Command produces a command which runs name in the sandbox. Once the command has run, done must be called to
+// remove the sandbox.
+func (s *buildSandbox) Command(p *Package, buildDir, wd, name string, args ...string) (cmd string, cmdArgs []string, done func(), err error) {
+	s.once.Do(s.init)
+	if s.err != nil {
+		return "", nil, nil, s.err
+	}
+
+	dir, err := ioutil.TempDir("", "gorpa-sandbox-*")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	done = func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			log.WithError(err).WithField("dir", dir).Warn("cannot remove build sandbox")
+		}
+	}
+	mounts, err := s.overlays(dir, filepath.Clean(wd), s.hiddenPaths(p, buildDir))
+	if err != nil {
+		done()
+		return "", nil, nil, xerrors.Errorf("cannot create build sandbox: %w", err)
+	}
+
+	res := append([]string{}, s.args...)
+	res = append(res, s.sh, "-c", sandboxScript, s.mount)
+	res = append(res, mounts...)
+	res = append(res, "--", wd, name)
+	return "unshare", append(res, args...), done, nil
+}
+
+// Violation returns an UndeclaredInputErr if the output of a failed build command mentions files which are
+// hidden by the sandbox. The build command failed to read those files irrespective of its output, but the
+// error tells which inputs the package lacks.
+func (s *buildSandbox) Violation(p *Package, buildDir, wd string, output []byte, err error) error {
+	paths := undeclaredPaths(output, wd, s.hiddenPaths(p, buildDir))
+	if len(paths) == 0 {
+		return err
+	}
+	return UndeclaredInputErr{Package: p, Paths: paths, Err: err}
+}
+
+// undeclaredPaths returns all existing files below one of the hidden paths but outside of wd which appear in
+// the output. Relative paths are relative to wd.
+func undeclaredPaths(output []byte, wd string, hidden []string) []string {
+	idx := make(map[string]struct{})
+	tokens := bytes.FieldsFunc(output, func(r rune) bool { return strings.ContainsRune(" \t\r\n'\"`:,;()[]{}<>", r) })
+	for _, tkn := range tokens {
+		if !bytes.ContainsRune(tkn, '/') {
+			continue
+		}
+		path := string(tkn)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(wd, path)
+		}
+		path = filepath.Clean(path)
+		if isWithin(path, wd) {
+			continue
+		}
+		for _, h := range hidden {
+			if !isWithin(path, h) {
+				continue
+			}
+			if _, err := os.Lstat(path); err == nil {
+				idx[path] = struct{}{}
+			}
+			break
+		}
+	}
+
+	res := make([]string, 0, len(idx))
+	for p := range idx {
+		res = append(res, p)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// isWithin returns true if path is dir or below it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// sandboxOutput keeps the last sandboxOutputLimit bytes of output of a sandboxed build command, so that
+// undeclared inputs can be found in it
+type sandboxOutput struct {
+	Reporter
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// PackageBuildLog is called during a package build whenever a build command produced some output.
+func (o *sandboxOutput) PackageBuildLog(pkg *Package, isErr bool, buf []byte) {
+	o.mu.Lock()
+	o.buf = append(o.buf, buf...)
+	if len(o.buf) > sandboxOutputLimit {
+		o.buf = append(o.buf[:0], o.buf[len(o.buf)-sandboxOutputLimit:]...)
+	}
+	o.mu.Unlock()
+
+	o.Reporter.PackageBuildLog(pkg, isErr, buf)
+}
+
+// WithSandbox runs all build commands in a sandbox which hides undeclared inputs from them
+func WithSandbox(enabled bool) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.Sandbox = enabled
+		return nil
+	}
+}
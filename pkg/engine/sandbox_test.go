@@ -0,0 +1,129 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for fn, content := range files {
+		fn = filepath.Join(root, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUndeclaredPaths(t *testing.T) {
+	var (
+		app      = t.TempDir()
+		buildDir = t.TempDir()
+		wd       = filepath.Join(buildDir, "comp-pkg.v1")
+	)
+	writeTestFiles(t, app, map[string]string{"shared/config.json": "{}", "lib/a.txt": "a"})
+	writeTestFiles(t, buildDir, map[string]string{"comp-pkg.v1/declared.txt": "d", "comp-other.v1/out.txt": "o"})
+
+	output := []byte("cat: " + app + "/shared/config.json: No such file or directory\n" +
+		"open '" + app + "/lib/a.txt', " + app + "/missing.txt\n" +
+		"cat: ../comp-other.v1/out.txt: No such file or directory\n" +
+		"cat: declared.txt ./declared.txt /usr/bin/env\n" +
+		"error: " + app + "/shared/config.json (again)")
+
+	act := undeclaredPaths(output, wd, []string{app, buildDir})
+	expectation := []string{filepath.Join(app, "lib/a.txt"), filepath.Join(app, "shared/config.json"), filepath.Join(buildDir, "comp-other.v1/out.txt")}
+	sort.Strings(expectation)
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("undeclaredPaths() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSandboxOutputLimit(t *testing.T) {
+	var (
+		pkg    = &Package{C: &Component{Name: "comp"}, packageInternal: packageInternal{Name: "pkg"}}
+		output = &sandboxOutput{Reporter: &shardReporter{}}
+	)
+	for i := 0; i < 3; i++ {
+		output.PackageBuildLog(pkg, false, bytes.Repeat([]byte{'a' + byte(i)}, sandboxOutputLimit/2+1))
+	}
+	if len(output.buf) != sandboxOutputLimit {
+		t.Fatalf("expected %d bytes of output, got %d", sandboxOutputLimit, len(output.buf))
+	}
+	if output.buf[len(output.buf)-1] != 'c' || output.buf[0] != 'b' {
+		t.Errorf("expected the sandbox to keep the last output")
+	}
+}
+
+func TestSandboxHidesUndeclaredInputs(t *testing.T) {
+	if err := exec.Command("unshare", "--user", "--map-root-user", "--mount", "true").Run(); err != nil {
+		t.Skipf("cannot create mount namespaces: %v", err)
+	}
+
+	var (
+		app      = t.TempDir()
+		buildDir = t.TempDir()
+		wd       = filepath.Join(buildDir, "comp-pkg.v1")
+	)
+	writeTestFiles(t, app, map[string]string{"undeclared.txt": "secret"})
+	writeTestFiles(t, buildDir, map[string]string{"comp-pkg.v1/declared.txt": "declared", "comp-other.v1/out.txt": "other"})
+
+	var (
+		pkg      = &Package{C: &Component{Name: "comp", W: &Application{Origin: app}}, packageInternal: packageInternal{Name: "pkg", Type: GenericPackage}}
+		buildctx = &buildContext{buildOptions: buildOptions{Sandbox: true}, buildDir: buildDir}
+		rep      = &shardReporter{}
+	)
+
+	err := executeCommandsWithReporter(buildctx, rep, pkg, wd, [][]string{{"cat", "declared.txt"}, {"sh", "-c", "echo built > out.txt"}}, nil)
+	if err != nil {
+		t.Fatalf("sandboxed build command failed: %v", err)
+	}
+	if fc, err := ioutil.ReadFile(filepath.Join(wd, "out.txt")); err != nil || string(fc) != "built\n" {
+		t.Errorf("sandboxed build command did not write to its build directory: %q, %v", fc, err)
+	}
+
+	for _, path := range []string{filepath.Join(app, "undeclared.txt"), "../comp-other.v1/out.txt"} {
+		err = executeCommandsWithReporter(buildctx, rep, pkg, wd, [][]string{{"cat", path}}, nil)
+		var uie UndeclaredInputErr
+		if !errors.As(err, &uie) {
+			t.Fatalf("expected an undeclared input error reading %s, got %v", path, err)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(wd, path)
+		}
+		if diff := cmp.Diff([]string{filepath.Clean(path)}, uie.Paths); diff != "" {
+			t.Errorf("undeclared paths mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// sbomFilename is the SPDX SBOM of a package which we store in the build artifact
+const sbomFilename = "sbom.spdx.json"
+
+// sbomCommands produces the commands which generate the SBOM of an image using syft, and attach it to the pushed images.
+// Signed images get the SBOM as cosign attestation, others as OCI referrer using oras.
+func sbomCommands(src string, images []string, signing ImageSigning) [][]string {
+	res := [][]string{
+		{"syft", src, "-o", "spdx-json=" + sbomFilename},
+	}
+	for _, img := range images {
+		if signing.Enabled {
+			res = append(res, signing.cosign("attest", "--type", "spdxjson", "--predicate", sbomFilename, img))
+			continue
+		}
+		res = append(res, []string{"oras", "attach", "--artifact-type", "application/spdx+json", img, sbomFilename + ":application/spdx+json"})
+	}
+	return res
+}
+
+// generatesSBOM returns true if the package build produces an SBOM. Docker packages use syft to find the
+// OS packages in the image, Go and yarn packages list the dependencies of their go.mod or lockfile.
+func (p *Package) generatesSBOM() bool {
+	if !p.C.W.Provenance.Enabled || !p.C.W.Provenance.SBOM {
+		return false
+	}
+	switch p.Type {
+	case DockerPackage, GoPackage, YarnPackage:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrNoSBOM is returned when a build artifact does not contain an SBOM
+var ErrNoSBOM = xerrors.Errorf("no SBOM found")
+
+// AccessSBOMInCachedArchive provides access to the SPDX SBOM in a cached build artifact.
+// If no such SBOM exists, ErrNoSBOM is returned.
+func AccessSBOMInCachedArchive(fn string, handler func(sbom io.Reader) error) error {
+	found := xerrors.Errorf("found")
+	err := walkArtifact(fn, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name != "./"+sbomFilename && hdr.Name != "package/"+sbomFilename {
+			return nil
+		}
+		err := handler(r)
+		if err != nil {
+			return err
+		}
+		return found
+	})
+	if err == found {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("error extracting SBOM from %s: %w", fn, err)
+	}
+	return ErrNoSBOM
+}
+
+// spdxDocument is an SPDX 2.2 document in its JSON serialisation
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SpdxElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+// sbomComponent is a third-party dependency of a package
+type sbomComponent struct {
+	Name     string
+	Version  string
+	PURL     string
+	Checksum *spdxChecksum
+}
+
+// writeSBOM writes the SPDX SBOM of a Go or yarn package to dst. The dependencies are read from the go.mod or
+// lockfile in the build directory wd. Docker packages produce their SBOM using syft instead.
+func (p *Package) writeSBOM(wd, dst string, created time.Time) error {
+	var (
+		components []sbomComponent
+		err        error
+	)
+	switch cfg := p.Config.(type) {
+	case GoPkgConfig:
+		components, err = goModComponents(filepath.Join(wd, "go.mod"))
+	case YarnPkgConfig:
+		lockfile := filepath.Join(wd, "yarn.lock")
+		if cfg.IsNpm() {
+			lockfile = filepath.Join(wd, cfg.packageLock())
+		}
+		components, err = nodeLockfileComponents(lockfile)
+	default:
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("cannot produce SBOM for %s: %w", p.FullName(), err)
+	}
+
+	doc, err := p.spdxDocument(components, created)
+	if err != nil {
+		return xerrors.Errorf("cannot produce SBOM for %s: %w", p.FullName(), err)
+	}
+	fc, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, sbomFilename), fc, 0644)
+}
+
+// spdxDocument describes the package and its third-party dependencies
+func (p *Package) spdxDocument(components []sbomComponent, created time.Time) (*spdxDocument, error) {
+	version, err := p.Version()
+	if err != nil {
+		return nil, err
+	}
+	license := spdxNoAssertion
+	if l, err := p.License(); err == nil && l != nil && l.ID != "" {
+		license = l.ID
+	}
+
+	const rootID = "SPDXRef-Package-root"
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              p.FullName(),
+		DocumentNamespace: fmt.Sprintf("https://%s/sbom/%s-%s", ProvenanceBuilderID, p.FilesystemSafeName(), version),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + ProvenanceBuilderID},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           rootID,
+			Name:             p.FullName(),
+			VersionInfo:      version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  license,
+			CopyrightText:    spdxNoAssertion,
+		}},
+		Relationships: []spdxRelationship{{SpdxElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSpdxElement: rootID}},
+	}
+	for i, c := range components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		pkg := spdxPackage{
+			SPDXID:           id,
+			Name:             c.Name,
+			VersionInfo:      c.Version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+		}
+		if c.Checksum != nil {
+			pkg.Checksums = []spdxChecksum{*c.Checksum}
+		}
+		if c.PURL != "" {
+			pkg.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: c.PURL}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SpdxElementID: rootID, RelationshipType: "DEPENDS_ON", RelatedSpdxElement: id})
+	}
+	return doc, nil
+}
+
+// goModComponents lists the modules a go.mod requires. Modules replaced by a directory are part of the
+// application, e.g. linked Bhojpur GoRPA packages, and have an SBOM of their own.
+func goModComponents(fn string) ([]sbomComponent, error) {
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	gomod, err := modfile.Parse(fn, fc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]sbomComponent, 0, len(gomod.Require))
+	for _, req := range gomod.Require {
+		mod := req.Mod
+		for _, rep := range gomod.Replace {
+			if rep.Old.Path == mod.Path && (rep.Old.Version == "" || rep.Old.Version == mod.Version) {
+				mod = rep.New
+				break
+			}
+		}
+		if mod.Version == "" {
+			continue
+		}
+		res = append(res, sbomComponent{Name: mod.Path, Version: mod.Version, PURL: fmt.Sprintf("pkg:golang/%s@%s", mod.Path, mod.Version)})
+	}
+	return res, nil
+}
+
+// nodeLockfileComponents lists the packages in a yarn.lock of Yarn Classic or Berry, or in an npm package-lock.json.
+// Packages which are not resolved from a registry, e.g. linked Bhojpur GoRPA packages, are skipped.
+func nodeLockfileComponents(fn string) ([]sbomComponent, error) {
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []sbomComponent
+	switch {
+	case strings.HasSuffix(fn, ".json"):
+		res, err = npmLockComponents(fc)
+	case bytes.Contains(fc, []byte("\n__metadata:")):
+		res, err = yarnBerryLockComponents(fc)
+	default:
+		res = yarnClassicLockComponents(fc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// lockfiles list a package once per version range
+	idx := make(map[string]sbomComponent, len(res))
+	for _, c := range res {
+		idx[c.Name+"@"+c.Version] = c
+	}
+	res = make([]sbomComponent, 0, len(idx))
+	for _, c := range idx {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Version < res[j].Version
+	})
+	return res, nil
+}
+
+func yarnClassicLockComponents(fc []byte) []sbomComponent {
+	var (
+		res []sbomComponent
+		cur *sbomComponent
+		ext bool
+	)
+	flush := func() {
+		if cur != nil && cur.Version != "" && !ext {
+			res = append(res, *cur)
+		}
+		cur, ext = nil, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(fc))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			flush()
+			spec := strings.Trim(strings.SplitN(strings.TrimSuffix(line, ":"), ",", 2)[0], `"`)
+			cur = &sbomComponent{Name: nodePackageName(spec)}
+			continue
+		}
+		if cur == nil || strings.HasPrefix(line, "    ") {
+			// the dependencies of an entry are indented further
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value := strings.Trim(fields[1], `"`)
+		switch fields[0] {
+		case "version":
+			cur.Version = value
+		case "resolved":
+			ext = strings.HasPrefix(value, "file:")
+		case "integrity":
+			cur.Checksum = integrityChecksum(value)
+		}
+	}
+	flush()
+	for i := range res {
+		res[i].PURL = npmPURL(res[i].Name, res[i].Version)
+	}
+	return res
+}
+
+func yarnBerryLockComponents(fc []byte) ([]sbomComponent, error) {
+	var lock map[string]struct {
+		Version    string `yaml:"version"`
+		Resolution string `yaml:"resolution"`
+	}
+	err := yaml.Unmarshal(fc, &lock)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []sbomComponent
+	for key, e := range lock {
+		if key == "__metadata" || !strings.Contains(e.Resolution, "@npm:") {
+			continue
+		}
+		name := nodePackageName(e.Resolution)
+		res = append(res, sbomComponent{Name: name, Version: e.Version, PURL: npmPURL(name, e.Version)})
+	}
+	return res, nil
+}
+
+func npmLockComponents(fc []byte) ([]sbomComponent, error) {
+	type npmLockEntry struct {
+		Version      string                  `json:"version"`
+		Resolved     string                  `json:"resolved"`
+		Integrity    string                  `json:"integrity"`
+		Link         bool                    `json:"link"`
+		Dependencies map[string]npmLockEntry `json:"dependencies"`
+	}
+	var lock struct {
+		// Packages is the lockfile v2 and v3 format, keyed by the path in node_modules
+		Packages map[string]npmLockEntry `json:"packages"`
+		// Dependencies is the lockfile v1 format, keyed by the package name
+		Dependencies map[string]npmLockEntry `json:"dependencies"`
+	}
+	err := json.Unmarshal(fc, &lock)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []sbomComponent
+	add := func(name string, e npmLockEntry) {
+		if e.Link || e.Version == "" || strings.HasPrefix(e.Resolved, "file:") || strings.HasPrefix(e.Version, "file:") {
+			return
+		}
+		res = append(res, sbomComponent{Name: name, Version: e.Version, PURL: npmPURL(name, e.Version), Checksum: integrityChecksum(e.Integrity)})
+	}
+	if len(lock.Packages) > 0 {
+		for path, e := range lock.Packages {
+			i := strings.LastIndex(path, "node_modules/")
+			if i < 0 {
+				continue
+			}
+			add(path[i+len("node_modules/"):], e)
+		}
+		return res, nil
+	}
+	var walk func(deps map[string]npmLockEntry)
+	walk = func(deps map[string]npmLockEntry) {
+		for name, e := range deps {
+			add(name, e)
+			walk(e.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return res, nil
+}
+
+// nodePackageName returns the package name of a lockfile entry like @scope/name@^1.0.0 or name@npm:1.0.0
+func nodePackageName(spec string) string {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 {
+		return spec
+	}
+	return spec[:i]
+}
+
+func npmPURL(name, version string) string {
+	return fmt.Sprintf("pkg:npm/%s@%s", strings.Replace(name, "@", "%40", 1), version)
+}
+
+// integrityChecksum converts a subresource integrity value like sha512-<base64> into an SPDX checksum
+func integrityChecksum(integrity string) *spdxChecksum {
+	// an integrity value may list several hashes, of which we use the first
+	fields := strings.Fields(integrity)
+	if len(fields) == 0 {
+		return nil
+	}
+	segs := strings.SplitN(fields[0], "-", 2)
+	if len(segs) != 2 {
+		return nil
+	}
+	var algorithm string
+	switch segs[0] {
+	case "sha1":
+		algorithm = "SHA1"
+	case "sha256":
+		algorithm = "SHA256"
+	case "sha512":
+		algorithm = "SHA512"
+	default:
+		return nil
+	}
+	sum, err := base64.StdEncoding.DecodeString(segs[1])
+	if err != nil {
+		return nil
+	}
+	return &spdxChecksum{Algorithm: algorithm, ChecksumValue: hex.EncodeToString(sum)}
+}
@@ -0,0 +1,243 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSBOMCommands(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Source      string
+		Images      []string
+		Signing     ImageSigning
+		Expectation [][]string
+	}{
+		{
+			Name:   "export",
+			Source: "docker-archive:/cache/img.tar",
+			Expectation: [][]string{
+				{"syft", "docker-archive:/cache/img.tar", "-o", "spdx-json=" + sbomFilename},
+			},
+		},
+		{
+			Name:   "unsigned",
+			Source: "registry:registry/app:v1",
+			Images: []string{"registry/app:v1"},
+			Expectation: [][]string{
+				{"syft", "registry:registry/app:v1", "-o", "spdx-json=" + sbomFilename},
+				{"oras", "attach", "--artifact-type", "application/spdx+json", "registry/app:v1", sbomFilename + ":application/spdx+json"},
+			},
+		},
+		{
+			Name:    "signed",
+			Source:  "registry:registry/app:v1",
+			Images:  []string{"registry/app:v1"},
+			Signing: ImageSigning{Enabled: true},
+			Expectation: [][]string{
+				{"syft", "registry:registry/app:v1", "-o", "spdx-json=" + sbomFilename},
+				{"cosign", "attest", "--yes", "--type", "spdxjson", "--predicate", sbomFilename, "registry/app:v1"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := sbomCommands(test.Source, test.Images, test.Signing)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("sbomCommands() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSBOMComponents(t *testing.T) {
+	const integrity = "sha512-AAEC"
+	tests := []struct {
+		Name        string
+		File        string
+		Content     string
+		Expectation []sbomComponent
+	}{
+		{
+			Name: "go.mod",
+			File: "go.mod",
+			Content: `module example.com/app
+
+go 1.17
+
+require (
+	example.com/lib v1.0.0
+	example.com/linked v0.0.0
+	example.com/old v1.2.0 // indirect
+)
+
+replace example.com/linked => ./_deps/linked // gorpa
+replace example.com/old => example.com/new v1.3.0
+`,
+			Expectation: []sbomComponent{
+				{Name: "example.com/lib", Version: "v1.0.0", PURL: "pkg:golang/example.com/lib@v1.0.0"},
+				{Name: "example.com/new", Version: "v1.3.0", PURL: "pkg:golang/example.com/new@v1.3.0"},
+			},
+		},
+		{
+			Name: "yarn classic",
+			File: "yarn.lock",
+			Content: `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@scope/lib@^1.0.0", "@scope/lib@^1.1.0":
+  version "1.2.0"
+  resolved "https://registry.yarnpkg.com/@scope/lib/-/lib-1.2.0.tgz#abc"
+  integrity ` + integrity + `
+  dependencies:
+    version "^2.0.0"
+
+linked@0.0.0:
+  version "0.0.0"
+  resolved "file:///build/linked.tar.gz"
+
+version@^2.0.0:
+  version "2.1.0"
+`,
+			Expectation: []sbomComponent{
+				{Name: "@scope/lib", Version: "1.2.0", PURL: "pkg:npm/%40scope/lib@1.2.0", Checksum: &spdxChecksum{Algorithm: "SHA512", ChecksumValue: "000102"}},
+				{Name: "version", Version: "2.1.0", PURL: "pkg:npm/version@2.1.0"},
+			},
+		},
+		{
+			Name: "yarn berry",
+			File: "yarn.lock",
+			Content: `# This file is generated by running "yarn install" inside your project.
+
+__metadata:
+  version: 6
+  cacheKey: 8
+
+"@scope/lib@npm:^1.0.0":
+  version: 1.2.0
+  resolution: "@scope/lib@npm:1.2.0"
+  checksum: abc
+  languageName: node
+  linkType: hard
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "app@workspace:."
+  languageName: unknown
+  linkType: soft
+`,
+			Expectation: []sbomComponent{
+				{Name: "@scope/lib", Version: "1.2.0", PURL: "pkg:npm/%40scope/lib@1.2.0"},
+			},
+		},
+		{
+			Name: "npm",
+			File: "package-lock.json",
+			Content: `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "version": "1.0.0"},
+    "node_modules/lib": {"version": "1.0.0", "integrity": "` + integrity + `"},
+    "node_modules/lib/node_modules/nested": {"version": "2.0.0"},
+    "node_modules/linked": {"resolved": "../linked", "link": true}
+  }
+}`,
+			Expectation: []sbomComponent{
+				{Name: "lib", Version: "1.0.0", PURL: "pkg:npm/lib@1.0.0", Checksum: &spdxChecksum{Algorithm: "SHA512", ChecksumValue: "000102"}},
+				{Name: "nested", Version: "2.0.0", PURL: "pkg:npm/nested@2.0.0"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), test.File)
+			err := ioutil.WriteFile(fn, []byte(test.Content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var act []sbomComponent
+			if test.File == "go.mod" {
+				act, err = goModComponents(fn)
+			} else {
+				act, err = nodeLockfileComponents(fn)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("components mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSBOM(t *testing.T) {
+	wd := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(wd, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n\nrequire example.com/lib v1.0.0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := testPackage(&Application{Origin: wd}, "pkg", GoPackage)
+	pkg.C.Origin = wd
+	pkg.Config = GoPkgConfig{}
+	err = pkg.writeSBOM(wd, wd, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbom, err := ioutil.ReadFile(filepath.Join(wd, sbomFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact := filepath.Join(t.TempDir(), "artifact.tar.gz")
+	writeTestArtifact(t, artifact, map[string]string{"./bin": "binary", "./" + sbomFilename: string(sbom)})
+	var doc spdxDocument
+	err = AccessSBOMInCachedArchive(artifact, func(sbom io.Reader) error {
+		return json.NewDecoder(sbom).Decode(&doc)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "comp:pkg" || doc.CreationInfo.Created != "2021-01-01T00:00:00Z" {
+		t.Errorf("unexpected document %s created %s", doc.Name, doc.CreationInfo.Created)
+	}
+	if len(doc.Packages) != 2 || doc.Packages[1].ExternalRefs[0].ReferenceLocator != "pkg:golang/example.com/lib@v1.0.0" {
+		t.Errorf("unexpected packages %+v", doc.Packages)
+	}
+	if len(doc.Relationships) != 2 || doc.Relationships[1].RelationshipType != "DEPENDS_ON" {
+		t.Errorf("unexpected relationships %+v", doc.Relationships)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.tar.gz")
+	writeTestArtifact(t, empty, map[string]string{"./bin": "binary"})
+	if err := AccessSBOMInCachedArchive(empty, func(io.Reader) error { return nil }); err != ErrNoSBOM {
+		t.Errorf("expected ErrNoSBOM, got %v", err)
+	}
+}
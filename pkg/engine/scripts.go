@@ -58,15 +58,27 @@ const (
 type Script struct {
 	C *Component
 
-	Name          string        `yaml:"name"`
-	Description   string        `yaml:"description"`
-	Dependencies  []string      `yaml:"deps"`
-	Environment   []string      `yaml:"env"`
-	WorkdirLayout WorkdirLayout `yaml:"workdir"`
-	Type          ScriptType    `yaml:"type"`
-	Script        string        `yaml:"script"`
+	Name          string            `yaml:"name"`
+	Description   string            `yaml:"description"`
+	Dependencies  []string          `yaml:"deps"`
+	Environment   []string          `yaml:"env"`
+	WorkdirLayout WorkdirLayout     `yaml:"workdir"`
+	Layout        map[string]string `yaml:"layout"`
+	Type          ScriptType        `yaml:"type"`
+	Script        string            `yaml:"script"`
+
+	// Sources are the input files of a script that has outputs. Together with its dependencies they determine when
+	// the script needs to run again.
+	Sources []string `yaml:"srcs"`
+	// Outputs are the files and directories (relative to the working dir) a script produces. Scripts which declare outputs
+	// can be depended upon by packages.
+	Outputs []string `yaml:"outputs"`
+	// Container is the image the script runs in, using the configured container CLI. The working dir, the dependencies
+	// and the application are mounted at their original paths, s.t. the script sees the same layout as on the host.
+	Container string `yaml:"container"`
 
 	dependencies []*Package
+	layout       map[*Package]string
 }
 
 // FullName returns the packages fully qualified name (component:package)
@@ -77,16 +89,50 @@ func (p *Script) FullName() string {
 // link connects resolves the references to the dependencies
 func (p *Script) link(idx map[string]*Package) error {
 	p.dependencies = make([]*Package, len(p.Dependencies))
+	p.layout = make(map[*Package]string, len(p.Dependencies))
 	for i, dep := range p.Dependencies {
-		var ok bool
-		p.dependencies[i], ok = idx[dep]
+		deppkg, ok := idx[dep]
 		if !ok {
 			return PackageNotFoundErr{dep}
 		}
+		p.dependencies[i] = deppkg
+
+		loc, ok := p.Layout[dep]
+		if !ok {
+			p.layout[deppkg] = deppkg.FilesystemSafeName()
+			continue
+		}
+		loc = filepath.Clean(loc)
+		if filepath.IsAbs(loc) || loc == "." || loc == ".." || strings.HasPrefix(loc, "../") {
+			return xerrors.Errorf("layout of %s must be a relative path within the workdir, not %s", dep, p.Layout[dep])
+		}
+		p.layout[deppkg] = loc
+	}
+	for dep := range p.Layout {
+		var isDep bool
+		for _, d := range p.Dependencies {
+			if d == dep {
+				isDep = true
+				break
+			}
+		}
+		if !isDep {
+			return xerrors.Errorf("layout references %s which is not a dependency", dep)
+		}
 	}
 	return nil
 }
 
+// LayoutLocation returns the path relative to the packages workdir a dependency is placed at
+func (p *Script) LayoutLocation(dependency *Package) string {
+	loc, ok := p.layout[dependency]
+	if ok {
+		return loc
+	}
+
+	return dependency.FilesystemSafeName()
+}
+
 // GetDependencies returns the linked package dependencies or nil if not linked yet
 func (p *Script) GetDependencies() []*Package {
 	return p.dependencies
@@ -163,6 +209,8 @@ func (p *Script) Run(opts ...BuildOption) error {
 		wd = p.C.Origin
 	}
 
+	// unlike build commands, scripts run with the environment of the user: they are the user's tools, e.g. to
+	// deploy or to start a development setup, and there is no hermetic environment for them
 	var (
 		env = append(os.Environ(), p.Environment...)
 		pa  bool
@@ -189,6 +237,20 @@ func (p *Script) Run(opts ...BuildOption) error {
 	// execute script
 	switch p.Type {
 	case BashScript:
+		if p.Container != "" {
+			// the container has its own PATH and environment, hence we pass only what the script adds to it
+			var script strings.Builder
+			if len(paths) > 0 {
+				fmt.Fprintf(&script, "export PATH=\"$PATH:%s\"\n", strings.Join(paths, ":"))
+			}
+			script.WriteString(p.Script)
+
+			cenv := append([]string{}, p.Environment...)
+			for n, pth := range deplocs {
+				cenv = append(cenv, fmt.Sprintf("%s=%s", strings.ToUpper(strings.ReplaceAll(n, "-", "_")), pth))
+			}
+			return executeContainerScript(buildCtx.ContainerCLI, p.Container, script.String(), wd, []string{p.C.W.Origin, tdir}, cenv)
+		}
 		return executeBashScript(p.Script, wd, env)
 	}
 
@@ -224,7 +286,7 @@ func (p *Script) synthesizePackagesWorkdir(buildCtx *buildContext) (path string,
 			return
 		}
 
-		loc := filepath.Join(path, dep.FilesystemSafeName())
+		loc := filepath.Join(path, p.LayoutLocation(dep))
 		err = os.MkdirAll(loc, 0755)
 		if err != nil {
 			return
@@ -245,33 +307,154 @@ func (p *Script) synthesizePackagesWorkdir(buildCtx *buildContext) (path string,
 	return
 }
 
-func executeBashScript(script string, wd string, env []string) error {
-	f, err := ioutil.TempFile("", "*.sh")
+// newOutputPackage produces the package which builds the outputs of this script
+func (p *Script) newOutputPackage(definition []byte) (*Package, error) {
+	for _, out := range p.Outputs {
+		loc := filepath.Clean(out)
+		if filepath.IsAbs(loc) || loc == "." || loc == ".." || strings.HasPrefix(loc, "../") {
+			return nil, xerrors.Errorf("%s: outputs must be relative paths within the workdir, not %s", p.Name, out)
+		}
+	}
+
+	srcs, err := resolveSources(p.C.W, p.C.Origin, p.Sources, false)
 	if err != nil {
-		return err
+		return nil, xerrors.Errorf("%s: %w", p.Name, err)
 	}
-	defer os.Remove(f.Name())
 
-	_, err = f.WriteString("#!/bin/bash\n")
+	return &Package{
+		C: p.C,
+		packageInternal: packageInternal{
+			Name:         p.Name,
+			Type:         GenericPackage,
+			Sources:      srcs,
+			Dependencies: p.Dependencies,
+			Layout:       p.Layout,
+			Environment:  p.Environment,
+		},
+		Config:          GenericPkgConfig{},
+		Definition:      definition,
+		originalSources: p.Sources,
+		script:          p,
+	}, nil
+}
+
+// buildScript implements the build process for packages produced by scripts with outputs.
+// The script runs in the package's build directory which contains the script's sources and dependencies.
+func (p *Package) buildScript(buildctx *buildContext, wd, result string) (res *packageBuild, err error) {
+	unresolvedArgs, err := findUnresolvedArgumentsInScript(p.script)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(unresolvedArgs) != 0 {
+		return nil, xerrors.Errorf("cannot build script with unresolved arguments: %s", strings.Join(unresolvedArgs, ", "))
+	}
+	if p.script.Type != BashScript {
+		return nil, xerrors.Errorf("unknown script type: %s", p.script.Type)
 	}
-	_, err = f.WriteString(script)
+
+	var (
+		commands [][]string
+		script   strings.Builder
+		paths    []string
+	)
+	for _, dep := range p.GetDependencies() {
+		fn, exists := buildctx.LocalCache.Location(dep)
+		if !exists {
+			return nil, PkgNotBuiltErr{dep}
+		}
+
+		tgt := p.BuildLayoutLocation(dep)
+		commands = append(commands, [][]string{
+			{"mkdir", "-p", tgt},
+			{"tar", "xfz", fn, "-C", tgt},
+		}...)
+
+		loc := filepath.Join(wd, tgt)
+		paths = append(paths, loc)
+		fmt.Fprintf(&script, "export %s=%q\n", strings.ToUpper(strings.ReplaceAll(dep.FilesystemSafeName(), "-", "_")), loc)
+	}
+	if len(paths) > 0 {
+		fmt.Fprintf(&script, "export PATH=\"$PATH:%s\"\n", strings.Join(paths, ":"))
+	}
+	script.WriteString(p.script.Script)
+	if p.script.Container != "" {
+		cmd := containerRunCommand(buildctx.ContainerCLI, p.script.Container, wd, []string{wd}, p.script.Environment, false)
+		commands = append(commands, append(cmd, "-c", script.String()))
+	} else {
+		commands = append(commands, []string{"bash", "-c", script.String()})
+	}
+
+	archiveCmd := []string{"tar", "cfz", result, "./" + buildInfoFilename}
+	if p.C.W.Provenance.Enabled {
+		archiveCmd = append(archiveCmd, "./"+provenanceBundleFilename)
+	}
+	for _, out := range p.script.Outputs {
+		archiveCmd = append(archiveCmd, "./"+filepath.Clean(out))
+	}
+
+	return &packageBuild{
+		BuildCommands:   commands,
+		PackageCommands: [][]string{archiveCmd},
+	}, nil
+}
+
+func executeBashScript(script string, wd string, env []string) error {
+	fn, err := writeBashScript(script)
 	if err != nil {
 		return err
 	}
-	f.Close()
+	defer os.Remove(fn)
 
 	log.WithField("env", env).WithField("wd", wd).Debug("running bash script")
 
-	cmd := exec.Command("bash", f.Name())
+	cmd := exec.Command("bash", fn)
 	cmd.Env = env
 	cmd.Dir = wd
+	return runScriptCommand(cmd)
+}
+
+// executeContainerScript runs a bash script in a container. The script sees mounts at their host paths
+// and only the environment passed in env.
+func executeContainerScript(cli ContainerCLI, image, script, wd string, mounts, env []string) error {
+	fn, err := writeBashScript(script)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fn)
+
+	run := containerRunCommand(cli, image, wd, append(mounts, fn), env, true)
+	run = append(run, fn)
+	log.WithField("env", env).WithField("wd", wd).WithField("container", image).Debug("running bash script in container")
+
+	cmd := exec.Command(run[0], run[1:]...)
+	cmd.Dir = wd
+	return runScriptCommand(cmd)
+}
+
+func writeBashScript(script string) (fn string, err error) {
+	f, err := ioutil.TempFile("", "*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("#!/bin/bash\n")
+	if err == nil {
+		_, err = f.WriteString(script)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func runScriptCommand(cmd *exec.Cmd) error {
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 
-	err = cmd.Run()
+	err := cmd.Run()
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 			os.Exit(status.ExitStatus())
@@ -88,6 +88,17 @@ func TestWorkingDirLayout(t *testing.T) {
 			StdoutSub: `.
 ./fixtures-pkgs-generic--something`,
 		},
+		{
+			Name:                "packages with layout",
+			T:                   t,
+			Args:                []string{"run", "fixtures/scripts:pwd-packages-layout"},
+			ExitCode:            0,
+			NoNestedApplication: true,
+			StdoutSub: `.
+./tools
+./tools/something`,
+			NoStdoutSub: "fixtures-pkgs-generic--something",
+		},
 		// 		{
 		// 			Name:              "origin nested",
 		// 			T:                 t,
@@ -113,6 +124,28 @@ func TestWorkingDirLayout(t *testing.T) {
 	}
 }
 
+func TestScriptOutputs(t *testing.T) {
+	runDUT()
+	if _, err := exec.LookPath("yarn"); err != nil {
+		t.Skip("yarn is not installed")
+	}
+
+	tests := []*CommandFixtureTest{
+		{
+			Name:                "package depends on script outputs",
+			T:                   t,
+			Args:                []string{"build", "--cache", "none", "fixtures/scripts:generated-consumer"},
+			ExitCode:            0,
+			NoNestedApplication: true,
+			StdoutSub:           "generated by script",
+		},
+	}
+
+	for _, test := range tests {
+		test.Run()
+	}
+}
+
 type CommandFixtureTest struct {
 	Name                string
 	T                   *testing.T
@@ -0,0 +1,195 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SearchResultKind describes what a search result refers to
+type SearchResultKind string
+
+const (
+	// SearchResultPackage is a package search result
+	SearchResultPackage SearchResultKind = "package"
+	// SearchResultScript is a script search result
+	SearchResultScript SearchResultKind = "script"
+)
+
+// SearchResult is a package or script matching a search term
+type SearchResult struct {
+	Kind        SearchResultKind `json:"kind" yaml:"kind"`
+	Name        string           `json:"name" yaml:"name"`
+	Component   string           `json:"component" yaml:"component"`
+	Type        string           `json:"type" yaml:"type"`
+	Description string           `json:"description,omitempty" yaml:"description,omitempty"`
+	// Score ranks the results - the higher the better the match
+	Score int `json:"score" yaml:"score"`
+}
+
+// searchField is a text a search term can match, weighted by its relevance
+type searchField struct {
+	Text   string
+	Weight int
+}
+
+// Search fuzzy-searches the names, descriptions, types and component constants of all packages
+// and scripts in the application. Every whitespace-separated word of the term has to match
+// at least one of those fields. Results are ranked by how well and where the words matched.
+func (ba *Application) Search(term string) []SearchResult {
+	words := strings.Fields(strings.ToLower(term))
+	if len(words) == 0 {
+		return nil
+	}
+
+	var res []SearchResult
+	for _, pkg := range ba.Packages {
+		fields := append([]searchField{
+			{Text: pkg.FullName(), Weight: 3},
+			{Text: string(pkg.Type), Weight: 1},
+		}, constantFields(pkg.C)...)
+		score := searchScore(words, fields)
+		if score == 0 {
+			continue
+		}
+		res = append(res, SearchResult{
+			Kind:      SearchResultPackage,
+			Name:      pkg.FullName(),
+			Component: pkg.C.Name,
+			Type:      string(pkg.Type),
+			Score:     score,
+		})
+	}
+	for _, scr := range ba.Scripts {
+		fields := append([]searchField{
+			{Text: scr.FullName(), Weight: 3},
+			{Text: scr.Description, Weight: 2},
+			{Text: string(scr.Type), Weight: 1},
+		}, constantFields(scr.C)...)
+		score := searchScore(words, fields)
+		if score == 0 {
+			continue
+		}
+		res = append(res, SearchResult{
+			Kind:        SearchResultScript,
+			Name:        scr.FullName(),
+			Component:   scr.C.Name,
+			Type:        string(scr.Type),
+			Description: scr.Description,
+			Score:       score,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Kind < res[j].Kind
+	})
+	return res
+}
+
+func constantFields(comp *Component) []searchField {
+	if comp == nil {
+		return nil
+	}
+	res := make([]searchField, 0, len(comp.Constants))
+	for k, v := range comp.Constants {
+		res = append(res, searchField{Text: fmt.Sprintf("%s=%s", k, v), Weight: 1})
+	}
+	return res
+}
+
+// searchScore returns the score of the best matching field for each word, summed up.
+// If any word matches none of the fields, the score is zero.
+func searchScore(words []string, fields []searchField) (score int) {
+	for _, word := range words {
+		var best int
+		for _, f := range fields {
+			s := f.Weight * matchScore(word, strings.ToLower(f.Text))
+			if s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+	return score
+}
+
+// matchScore rates how well a lower-case word matches a lower-case text: exact matches rate best,
+// followed by matches at the beginning of a name segment, substrings and finally subsequences,
+// which rate lower the more spread out they are.
+func matchScore(word, text string) int {
+	if word == "" || text == "" {
+		return 0
+	}
+	if word == text {
+		return 100
+	}
+	if idx := strings.Index(text, word); idx >= 0 {
+		for i := idx; i >= 0; i = indexFrom(text, word, i+1) {
+			if i == 0 || strings.ContainsRune(":/-_.= ", rune(text[i-1])) {
+				return 80
+			}
+		}
+		return 60
+	}
+
+	// subsequence match, e.g. "bldapi" matches "build/api"
+	var (
+		pos  = -1
+		gaps int
+	)
+	for _, c := range word {
+		next := strings.IndexRune(text[pos+1:], c)
+		if next < 0 {
+			return 0
+		}
+		if pos >= 0 {
+			gaps += next
+		}
+		pos += 1 + next
+	}
+	score := 40 - gaps
+	if score < 1 {
+		score = 1
+	}
+	return score
+}
+
+func indexFrom(s, substr string, from int) int {
+	if from >= len(s) {
+		return -1
+	}
+	idx := strings.Index(s[from:], substr)
+	if idx < 0 {
+		return -1
+	}
+	return from + idx
+}
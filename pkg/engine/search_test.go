@@ -0,0 +1,83 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		Word, Text string
+		Expected   int
+	}{
+		{"api", "api", 100},
+		{"api", "components/api:lib", 80},
+		{"api", "components/rapid:lib", 60},
+		{"cmpapi", "components/api:lib", 32},
+		{"xyz", "components/api:lib", 0},
+		{"api", "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.Word+"/"+test.Text, func(t *testing.T) {
+			act := matchScore(test.Word, test.Text)
+			if act != test.Expected {
+				t.Errorf("expected %d, got %d", test.Expected, act)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	var (
+		api     = NewTestPackage("api")
+		rapid   = NewTestPackage("rapid-server")
+		unknown = NewTestPackage("other")
+		ba      = api.C.W
+	)
+	rapid.C, unknown.C = api.C, api.C
+	for _, p := range []*Package{api, rapid, unknown} {
+		ba.Packages[p.FullName()] = p
+	}
+	ba.Scripts = map[string]*Script{
+		"testcomp:gen": {C: api.C, Name: "gen", Description: "regenerates the API clients", Type: BashScript},
+	}
+
+	res := ba.Search("api")
+	var names []string
+	for _, r := range res {
+		names = append(names, string(r.Kind)+" "+r.Name)
+	}
+	expected := []string{"package testcomp:api", "package testcomp:rapid-server", "script testcomp:gen"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, names)
+			break
+		}
+	}
+
+	if res := ba.Search("api generic nope"); len(res) != 0 {
+		t.Errorf("expected no results if a word does not match, got %v", res)
+	}
+}
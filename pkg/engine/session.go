@@ -0,0 +1,299 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// BuildSession persists the state of a build, s.t. a build which was interrupted, e.g. by Ctrl-C or a CI timeout,
+// can resume without computing the versions of unchanged packages or checking the remote caches again.
+type BuildSession struct {
+	fn string
+
+	mu           sync.Mutex
+	state        buildSessionState
+	fingerprints map[*Package]string
+}
+
+type buildSessionState struct {
+	Target string `json:"target"`
+	// Versions maps package names to their version and the fingerprint of the sources the version was computed from
+	Versions map[string]buildSessionVersion `json:"versions"`
+	// Downloaded lists the versions which were requested from the remote caches already
+	Downloaded []string `json:"downloaded,omitempty"`
+	// Built lists the versions which were built but possibly not uploaded to the remote cache yet
+	Built []string `json:"built,omitempty"`
+}
+
+type buildSessionVersion struct {
+	Version     string `json:"version"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// OpenBuildSession opens the build session of target stored in fn. Unless resume is true, or if there is no session
+// of the same target to resume, the build starts a new session.
+func OpenBuildSession(fn string, target *Package, resume bool) (*BuildSession, error) {
+	res := &BuildSession{
+		fn:           fn,
+		state:        buildSessionState{Target: target.FullName(), Versions: make(map[string]buildSessionVersion)},
+		fingerprints: make(map[*Package]string),
+	}
+	if !resume {
+		return res, nil
+	}
+
+	fc, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		log.WithField("target", target.FullName()).Info("no interrupted build to resume - starting a new build")
+		return res, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read build session: %w", err)
+	}
+	var state buildSessionState
+	err = json.Unmarshal(fc, &state)
+	if err != nil {
+		log.WithError(err).WithField("session", fn).Warn("cannot parse build session - starting a new build")
+		return res, nil
+	}
+	if state.Target != target.FullName() {
+		log.WithField("session", state.Target).WithField("target", target.FullName()).Info("interrupted build was of another package - starting a new build")
+		return res, nil
+	}
+	if state.Versions == nil {
+		state.Versions = make(map[string]buildSessionVersion)
+	}
+	res.state = state
+	return res, nil
+}
+
+// restoreVersions sets the versions of all packages whose sources, definition, environment and dependencies have
+// not changed since the session recorded them. It returns the number of restored versions.
+func (s *BuildSession) restoreVersions(pkgs []*Package) (restored int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var restore func(p *Package) error
+	restore = func(p *Package) error {
+		if _, done := s.fingerprints[p]; done {
+			return nil
+		}
+		// the fingerprint contains the versions of the dependencies
+		for _, dep := range p.GetDependencies() {
+			err := restore(dep)
+			if err != nil {
+				return err
+			}
+		}
+
+		fp, err := sessionFingerprint(p)
+		if err != nil {
+			return err
+		}
+		s.fingerprints[p] = fp
+
+		rec, ok := s.state.Versions[p.FullName()]
+		if ok && rec.Fingerprint == fp && p.versionCache == "" {
+			p.versionCache = rec.Version
+			restored++
+		}
+		return nil
+	}
+	for _, p := range pkgs {
+		err = restore(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return restored, nil
+}
+
+// recordVersions records the versions of all packages and saves the session
+func (s *BuildSession) recordVersions(pkgs []*Package) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range pkgs {
+		fp, ok := s.fingerprints[p]
+		if !ok {
+			continue
+		}
+		version, err := p.Version()
+		if err != nil {
+			return err
+		}
+		s.state.Versions[p.FullName()] = buildSessionVersion{Version: version, Fingerprint: fp}
+	}
+	return s.save()
+}
+
+// pendingDownloads returns the packages the session has not requested from the remote caches yet
+func (s *BuildSession) pendingDownloads(pkgs []*Package) []*Package {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := make(map[string]struct{}, len(s.state.Downloaded))
+	for _, v := range s.state.Downloaded {
+		idx[v] = struct{}{}
+	}
+	res := make([]*Package, 0, len(pkgs))
+	for _, p := range pkgs {
+		version, err := p.Version()
+		if err != nil {
+			res = append(res, p)
+			continue
+		}
+		if _, ok := idx[version]; !ok {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// recordDownloads records that the packages were requested from the remote caches and saves the session
+func (s *BuildSession) recordDownloads(pkgs []*Package) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range pkgs {
+		version, err := p.Version()
+		if err != nil {
+			continue
+		}
+		s.state.Downloaded = append(s.state.Downloaded, version)
+	}
+	sort.Strings(s.state.Downloaded)
+	return s.save()
+}
+
+// recordBuilt records that a package was built and saves the session
+func (s *BuildSession) recordBuilt(p *Package) error {
+	version, err := p.Version()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.state.Built {
+		if v == version {
+			return nil
+		}
+	}
+	s.state.Built = append(s.state.Built, version)
+	return s.save()
+}
+
+// builtPackages returns the packages the session built and which are in the local cache
+func (s *BuildSession) builtPackages(pkgs []*Package, local Cache) []*Package {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := make(map[string]struct{}, len(s.state.Built))
+	for _, v := range s.state.Built {
+		idx[v] = struct{}{}
+	}
+	var res []*Package
+	for _, p := range pkgs {
+		version, err := p.Version()
+		if err != nil {
+			continue
+		}
+		if _, ok := idx[version]; !ok {
+			continue
+		}
+		if _, exists := local.Location(p); exists {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// Done removes the session once the build succeeded
+func (s *BuildSession) Done() error {
+	err := os.Remove(s.fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *BuildSession) save() error {
+	fc, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.fn), 0755)
+	if err != nil {
+		return err
+	}
+	// an interrupted write must not leave a broken session behind
+	tmp := s.fn + ".tmp"
+	err = ioutil.WriteFile(tmp, fc, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.fn)
+}
+
+// sessionFingerprint hashes the version manifest of a package, but lists the size and modification time of its
+// sources instead of their content hashes
+func sessionFingerprint(p *Package) (string, error) {
+	h := sha256.New()
+	err := p.writeVersionManifest(h, func() ([]string, error) {
+		res := make([]string, len(p.Sources))
+		for i, src := range p.Sources {
+			stat, err := os.Stat(src)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimPrefix(src, p.C.W.Origin+"/")
+			res[i] = fmt.Sprintf("%s:%d:%d:%o", name, stat.Size(), stat.ModTime().UnixNano(), stat.Mode())
+		}
+		sort.Strings(res)
+		return res, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WithBuildSession records the state of the build in a session, s.t. it can resume if it is interrupted
+func WithBuildSession(session *BuildSession) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.Session = session
+		return nil
+	}
+}
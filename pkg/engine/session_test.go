@@ -0,0 +1,108 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildSession(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		fn     = filepath.Join(t.TempDir(), "session.json")
+		depSrc = filepath.Join(dir, "dep.txt")
+		appSrc = filepath.Join(dir, "app.txt")
+	)
+	for _, src := range []string{depSrc, appSrc} {
+		err := ioutil.WriteFile(src, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() (dep, app *Package) {
+		w := &Application{Origin: dir}
+		dep = testPackage(w, "dep", GenericPackage)
+		dep.Sources = []string{depSrc}
+		app = testPackage(w, "app", GenericPackage, dep)
+		app.Sources = []string{appSrc}
+		return dep, app
+	}
+	open := func(app *Package, resume bool) *BuildSession {
+		session, err := OpenBuildSession(fn, app, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	restore := func(session *BuildSession, pkgs ...*Package) int {
+		restored, err := session.restoreVersions(pkgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = session.recordVersions(pkgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return restored
+	}
+
+	dep, app := load()
+	session := open(app, true)
+	if restored := restore(session, dep, app); restored != 0 {
+		t.Fatalf("expected no versions to be restored without a session, got %d", restored)
+	}
+	err := session.recordDownloads([]*Package{dep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := app.Version()
+
+	dep, app = load()
+	session = open(app, true)
+	if restored := restore(session, dep, app); restored != 2 {
+		t.Errorf("expected the versions of both unchanged packages to be restored, got %d", restored)
+	}
+	if v, _ := app.Version(); v != version {
+		t.Errorf("restored version %s does not match computed version %s", v, version)
+	}
+	if pending := session.pendingDownloads([]*Package{dep, app}); len(pending) != 1 || pending[0] != app {
+		t.Errorf("expected only the app to be downloaded, got %v", pending)
+	}
+
+	dep, app = load()
+	if restored := restore(open(app, false), dep, app); restored != 0 {
+		t.Errorf("expected no versions to be restored unless resuming, got %d", restored)
+	}
+
+	err = ioutil.WriteFile(depSrc, []byte("changed"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, app = load()
+	if restored := restore(open(app, true), dep, app); restored != 0 {
+		t.Errorf("expected no versions to be restored after a dependency changed, got %d", restored)
+	}
+	if v, _ := app.Version(); v == version {
+		t.Errorf("expected the version to change with the dependency")
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// shellResultFilename is the name of the build artifact the build commands of a shell environment produce in its directory
+const shellResultFilename = ".gorpa-shell-result.tar.gz"
+
+// ShellEnvironment is a prepared build directory of a package which the user can explore interactively
+type ShellEnvironment struct {
+	// Dir is the temporary build directory of the package
+	Dir string
+	// Env is the environment the build commands of the package run in, in addition to the environment of this process
+	Env []string
+	// Commands are the commands which would build the package in Dir
+	Commands [][]string
+}
+
+// PrepareShell builds the dependencies of a package and prepares a temporary build directory like a build would:
+// the sources are copied, the dependencies extracted and the preparation commands run. The build commands themselves
+// are not executed, but returned as part of the shell environment. The caller is responsible for removing the directory.
+func PrepareShell(pkg *Package, opts ...BuildOption) (env *ShellEnvironment, err error) {
+	options, err := applyBuildOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	buildctx, err := newBuildContext(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pkg.GetDependencies()) > 0 {
+		err = Build(&Package{
+			C:            pkg.C,
+			dependencies: pkg.dependencies,
+			packageInternal: packageInternal{
+				Name:        fmt.Sprintf("%s-shell-deps", pkg.Name),
+				Environment: pkg.Environment,
+				Hermetic:    pkg.Hermetic,
+				Ephemeral:   true,
+				Type:        GenericPackage,
+			},
+			Config: GenericPkgConfig{},
+		}, append(opts, withBuildContext(buildctx))...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wd, err := ioutil.TempDir("", "gorpa-shell-"+pkg.FilesystemSafeName())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(wd)
+		}
+	}()
+
+	err = pkg.copySources(buildctx.Reporter, wd)
+	if err != nil {
+		return nil, err
+	}
+	err = writeBuildInfo(pkg, wd, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// commands exploring the build must not touch the local cache, hence the artifact goes into the build directory
+	result := filepath.Join(wd, shellResultFilename)
+	bld, err := pkg.planBuild(buildctx, wd, result)
+	if err != nil {
+		return nil, err
+	}
+	if bld.SetupSteps > len(bld.BuildCommands) {
+		return nil, xerrors.Errorf("invalid build plan for %s: more setup steps than build commands", pkg.FullName())
+	}
+
+	err = executeCommandsForPackage(buildctx, pkg, wd, bld.BuildCommands[:bld.SetupSteps], bld.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ShellEnvironment{
+		Dir:      wd,
+		Env:      append(append([]string{}, pkg.Environment...), bld.Environment...),
+		Commands: bld.BuildCommands[bld.SetupSteps:],
+	}, nil
+}
+
+// WriteScript writes the build commands as shell script to the build directory and returns its path
+func (env *ShellEnvironment) WriteScript(name string) (string, error) {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\nset -ex\n")
+	for _, cmd := range env.Commands {
+		script.WriteString(shellJoin(cmd...))
+		script.WriteString("\n")
+	}
+
+	fn := filepath.Join(env.Dir, name)
+	err := ioutil.WriteFile(fn, []byte(script.String()), 0755)
+	if err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) == -1 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// shellJoin quotes each argument and joins them to a shell command
+func shellJoin(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,126 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		Arg         string
+		Expectation string
+	}{
+		{"go", "go"},
+		{"-ldflags=-X main.version=1", "'-ldflags=-X main.version=1'"},
+		{"./cmd/...", "./cmd/..."},
+		{"", "''"},
+		{"it's", `'it'"'"'s'`},
+		{"$HOME", "'$HOME'"},
+		{"a;b", "'a;b'"},
+	}
+	for _, test := range tests {
+		if act := shellQuote(test.Arg); act != test.Expectation {
+			t.Errorf("shellQuote(%q): expected %s, got %s", test.Arg, test.Expectation, act)
+		}
+	}
+}
+
+func TestShellEnvironmentWriteScript(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		out = filepath.Join(dir, "args")
+		env = &ShellEnvironment{
+			Dir: dir,
+			Commands: [][]string{
+				{"sh", "-c", `for a in "$@"; do echo "$a"; done > ` + out, "sh", "it's", "", "$HOME", "a b;c", "`id`"},
+			},
+		}
+	)
+	fn, err := env.WriteScript("build.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn != filepath.Join(dir, "build.sh") {
+		t.Errorf("unexpected script location %s", fn)
+	}
+
+	res, err := exec.Command(fn).CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed: %v: %s", err, res)
+	}
+	fc, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"it's", "", "$HOME", "a b;c", "`id`"}, strings.Split(strings.TrimSuffix(string(fc), "\n"), "\n")); diff != "" {
+		t.Errorf("script did not pass the arguments verbatim (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrepareShell(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	origin := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(origin, "Dockerfile"), []byte("FROM alpine\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := testPackage(&Application{Origin: origin}, "pkg", DockerPackage)
+	pkg.C.Origin = origin
+	pkg.Config = DockerPkgConfig{Dockerfile: "Dockerfile"}
+
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := PrepareShell(pkg, WithLocalCache(cache), WithReporter(NewMetricsReporter(cache)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(env.Dir)
+
+	location, _ := cache.Location(pkg)
+	var saved bool
+	for _, cmd := range env.Commands {
+		for _, arg := range cmd {
+			if strings.Contains(arg, filepath.Dir(location)) {
+				t.Errorf("command %v refers to the local cache", cmd)
+			}
+		}
+		if len(cmd) > 2 && cmd[1] == "save" {
+			saved = true
+			if diff := cmp.Diff(filepath.Join(env.Dir, strings.TrimSuffix(shellResultFilename, ".gz")), cmd[3]); diff != "" {
+				t.Errorf("unexpected image export location (-want +got):\n%s", diff)
+			}
+		}
+	}
+	if !saved {
+		t.Errorf("expected the image to be exported, got %v", env.Commands)
+	}
+}
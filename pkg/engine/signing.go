@@ -0,0 +1,103 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/bom/pkg/provenance"
+)
+
+// provenancePredicateFilename is the SLSA predicate of a Docker package which we attest to its signed images.
+// The file lives in the build directory only and is not part of the build artifact.
+const provenancePredicateFilename = "provenance-predicate.json"
+
+// ImageSigning configures the signing of pushed Docker images using cosign
+type ImageSigning struct {
+	// Enabled signs every image gorpa pushes
+	Enabled bool
+	// Key is the cosign key reference, i.e. a key file or a KMS URI. If empty, images are signed keyless.
+	Key string
+}
+
+// Keyless returns true if images are signed using cosign's keyless mode
+func (s ImageSigning) Keyless() bool {
+	return s.Key == ""
+}
+
+// WithImageSigning signs the pushed Docker images using cosign
+func WithImageSigning(s ImageSigning) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.ImageSigning = s
+		return nil
+	}
+}
+
+// signCommands produces the cosign invocations which sign the images right after they were pushed.
+// If predicate is not empty, the SLSA provenance predicate in that file is attached as attestation as well.
+func (s ImageSigning) signCommands(images []string, predicate string) [][]string {
+	if !s.Enabled {
+		return nil
+	}
+
+	var res [][]string
+	for _, img := range images {
+		res = append(res, s.cosign("sign", img))
+		if predicate != "" {
+			res = append(res, s.cosign("attest", "--type", in_toto.PredicateSLSAProvenanceV01, "--predicate", predicate, img))
+		}
+	}
+	return res
+}
+
+func (s ImageSigning) cosign(cmd string, args ...string) []string {
+	// --yes skips the confirmation prompts, e.g. for uploading to the transparency log
+	res := []string{"cosign", cmd, "--yes"}
+	if !s.Keyless() {
+		res = append(res, "--key", s.Key)
+	}
+	return append(res, args...)
+}
+
+// writeProvenancePredicate extracts the predicate of a SLSA provenance envelope, so that cosign can attest it
+func writeProvenancePredicate(dir string, env *provenance.Envelope) error {
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return xerrors.Errorf("cannot decode provenance payload: %w", err)
+	}
+	var stmt struct {
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	err = json.Unmarshal(payload, &stmt)
+	if err != nil {
+		return xerrors.Errorf("cannot unmarshal provenance statement: %w", err)
+	}
+	if len(stmt.Predicate) == 0 {
+		return xerrors.Errorf("provenance statement has no predicate")
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, provenancePredicateFilename), stmt.Predicate, 0644)
+}
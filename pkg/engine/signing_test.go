@@ -0,0 +1,65 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImageSigningCommands(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Signing     ImageSigning
+		Predicate   string
+		Expectation [][]string
+	}{
+		{
+			Name:    "disabled",
+			Signing: ImageSigning{Key: "/cosign.key"},
+		},
+		{
+			Name:    "keyless",
+			Signing: ImageSigning{Enabled: true},
+			Expectation: [][]string{
+				{"cosign", "sign", "--yes", "registry/app:v1"},
+			},
+		},
+		{
+			Name:      "key with attestation",
+			Signing:   ImageSigning{Enabled: true, Key: "/cosign.key"},
+			Predicate: provenancePredicateFilename,
+			Expectation: [][]string{
+				{"cosign", "sign", "--yes", "--key", "/cosign.key", "registry/app:v1"},
+				{"cosign", "attest", "--yes", "--key", "/cosign.key", "--type", "https://slsa.dev/provenance/v0.1", "--predicate", provenancePredicateFilename, "registry/app:v1"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Signing.signCommands([]string{"registry/app:v1"}, test.Predicate)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("signCommands() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SkipFilter prunes packages from a build
+type SkipFilter struct {
+	// Packages are the full names of the packages which are not built
+	Packages []string
+	// OnlyTypes restricts the build to packages of these types. All types are built if empty.
+	OnlyTypes []PackageType
+}
+
+// IsEmpty returns true if the filter does not skip anything
+func (f SkipFilter) IsEmpty() bool {
+	return len(f.Packages) == 0 && len(f.OnlyTypes) == 0
+}
+
+// WithSkipFilter skips packages during the build. Packages which depend on a skipped package
+// whose build artifact is not cached are skipped as well.
+func WithSkipFilter(filter SkipFilter) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.Skip = filter
+		return nil
+	}
+}
+
+// skippedPackages determines which of the packages are skipped and why. Packages which are cached are not
+// skipped because of their dependencies, as they don't need to be built.
+func (f SkipFilter) skippedPackages(pkgs []*Package, cached func(*Package) bool) map[*Package]string {
+	res := make(map[*Package]string)
+	if f.IsEmpty() {
+		return res
+	}
+
+	var (
+		names = make(map[string]struct{}, len(f.Packages))
+		types = make(map[PackageType]struct{}, len(f.OnlyTypes))
+	)
+	for _, n := range f.Packages {
+		names[n] = struct{}{}
+	}
+	for _, t := range f.OnlyTypes {
+		types[t] = struct{}{}
+	}
+
+	var (
+		visited = make(map[*Package]bool)
+		visit   func(p *Package) bool
+	)
+	visit = func(p *Package) (skipped bool) {
+		if s, ok := visited[p]; ok {
+			return s
+		}
+		defer func() { visited[p] = skipped }()
+
+		if _, ok := names[p.FullName()]; ok {
+			res[p] = "skipped using --skip"
+			return true
+		}
+		if _, ok := types[p.Type]; len(types) > 0 && !ok {
+			res[p] = fmt.Sprintf("%s packages are not part of --only-types", p.Type)
+			return true
+		}
+
+		// visit all dependencies, so that the reasons are complete
+		var blocker string
+		deps := append([]*Package(nil), p.GetDependencies()...)
+		sort.Slice(deps, func(i, j int) bool { return deps[i].FullName() < deps[j].FullName() })
+		for _, dep := range deps {
+			if visit(dep) && !cached(dep) && blocker == "" {
+				blocker = dep.FullName()
+			}
+		}
+		if blocker == "" || cached(p) {
+			return false
+		}
+		res[p] = fmt.Sprintf("depends on skipped package %s", blocker)
+		return true
+	}
+	for _, p := range pkgs {
+		visit(p)
+	}
+	return res
+}
@@ -0,0 +1,98 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSkippedPackages(t *testing.T) {
+	newPkg := func(name string, tpe PackageType, deps ...*Package) *Package {
+		return &Package{
+			packageInternal:  packageInternal{Name: name, Type: tpe},
+			fullNameOverride: "comp:" + name,
+			dependencies:     deps,
+		}
+	}
+	var (
+		image  = newPkg("image", DockerPackage)
+		lib    = newPkg("lib", GoPackage)
+		app    = newPkg("app", GoPackage, lib, image)
+		cached = newPkg("cached", GoPackage, image)
+		all    = newPkg("all", GenericPackage, app, cached)
+		pkgs   = []*Package{image, lib, app, cached, all}
+	)
+
+	tests := []struct {
+		Name        string
+		Filter      SkipFilter
+		Cached      []*Package
+		Expectation map[string]string
+	}{
+		{Name: "no filter", Expectation: map[string]string{}},
+		{
+			Name:   "skip",
+			Filter: SkipFilter{Packages: []string{"comp:lib"}},
+			Expectation: map[string]string{
+				"comp:lib": "skipped using --skip",
+				"comp:app": "depends on skipped package comp:lib",
+				"comp:all": "depends on skipped package comp:app",
+			},
+		},
+		{
+			Name:   "only types",
+			Filter: SkipFilter{OnlyTypes: []PackageType{GoPackage, GenericPackage}},
+			Cached: []*Package{cached},
+			Expectation: map[string]string{
+				"comp:image": "docker packages are not part of --only-types",
+				"comp:app":   "depends on skipped package comp:image",
+				"comp:all":   "depends on skipped package comp:app",
+			},
+		},
+		{
+			Name:   "skipped but cached",
+			Filter: SkipFilter{Packages: []string{"comp:image"}},
+			Cached: []*Package{image},
+			Expectation: map[string]string{
+				"comp:image": "skipped using --skip",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cached := make(map[*Package]bool)
+			for _, p := range test.Cached {
+				cached[p] = true
+			}
+			skipped := test.Filter.skippedPackages(pkgs, func(p *Package) bool { return cached[p] })
+
+			act := make(map[string]string, len(skipped))
+			for p, reason := range skipped {
+				act[p.FullName()] = reason
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("skippedPackages() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
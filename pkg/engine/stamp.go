@@ -0,0 +1,250 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// buildStamp is what gets stamped into build results if provenance.stamp is enabled in the APPLICATION.yaml.
+// The values are those of the build info of the package build.
+type buildStamp struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// GoStampConfig names the variables the package version, Git commit and build time are stamped into
+type GoStampConfig struct {
+	Version string `yaml:"version,omitempty"`
+	Commit  string `yaml:"commit,omitempty"`
+	Date    string `yaml:"date,omitempty"`
+}
+
+const (
+	defaultGoStampVersion = "main.version"
+	defaultGoStampCommit  = "main.commit"
+	defaultGoStampDate    = "main.date"
+)
+
+// readBuildStamp returns the stamp of the package build in wd, or nil if stamping is disabled.
+// The build info must have been written to wd already.
+func (p *Package) readBuildStamp(wd string) (*buildStamp, error) {
+	if !p.C.W.Provenance.Stamp {
+		return nil, nil
+	}
+
+	fc, err := ioutil.ReadFile(filepath.Join(wd, buildInfoFilename))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot stamp build: %w", err)
+	}
+	var nfo BuildInfo
+	err = json.Unmarshal(fc, &nfo)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot stamp build: %w", err)
+	}
+	res := &buildStamp{
+		Version: nfo.Version,
+		Commit:  nfo.GitCommit,
+	}
+	if nfo.BuildTime != nil {
+		res.Date = nfo.BuildTime.UTC().Format(time.RFC3339)
+	}
+	return res, nil
+}
+
+// stampLdflags adds -X flags setting the stamp variables to the -ldflags of buildFlags. go build uses
+// the last -ldflags only, hence we extend existing ones rather than adding another.
+func (cfg GoStampConfig) stampLdflags(buildFlags []string, stamp *buildStamp) []string {
+	name := func(n, def string) string {
+		if n == "" {
+			return def
+		}
+		return n
+	}
+	var xs []string
+	for _, v := range []struct{ Name, Value string }{
+		{name(cfg.Version, defaultGoStampVersion), stamp.Version},
+		{name(cfg.Commit, defaultGoStampCommit), stamp.Commit},
+		{name(cfg.Date, defaultGoStampDate), stamp.Date},
+	} {
+		if v.Value == "" {
+			continue
+		}
+		xs = append(xs, "-X", v.Name+"="+v.Value)
+	}
+	if len(xs) == 0 {
+		return buildFlags
+	}
+	ldflags := strings.Join(xs, " ")
+
+	res := append([]string(nil), buildFlags...)
+	for i := len(res) - 1; i >= 0; i-- {
+		flag := res[i]
+		switch {
+		case (flag == "-ldflags" || flag == "--ldflags") && i+1 < len(res):
+			res[i+1] = strings.TrimSpace(res[i+1] + " " + ldflags)
+			return res
+		case strings.HasPrefix(flag, "-ldflags=") || strings.HasPrefix(flag, "--ldflags="):
+			res[i] = flag + " " + ldflags
+			return res
+		}
+	}
+	return append(res, "-ldflags="+ldflags)
+}
+
+// stampLabels adds the OCI annotations of the stamp to the image labels
+func (stamp *buildStamp) stampLabels(labels map[string]string) map[string]string {
+	res := make(map[string]string, len(labels)+3)
+	for k, v := range labels {
+		res[k] = v
+	}
+	res["org.opencontainers.image.version"] = stamp.Version
+	res["org.opencontainers.image.created"] = stamp.Date
+	if stamp.Commit != "" {
+		res["org.opencontainers.image.revision"] = stamp.Commit
+	}
+	return res
+}
+
+// stampPackageJSON adds the stamp to the package.json in wd as "gorpa" entry
+func (p *Package) stampPackageJSON(wd string) error {
+	stamp, err := p.readBuildStamp(wd)
+	if err != nil || stamp == nil {
+		return err
+	}
+
+	fn := filepath.Join(wd, "package.json")
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return xerrors.Errorf("cannot stamp package.json: %w", err)
+	}
+	entry := map[string]string{
+		"version": stamp.Version,
+		"date":    stamp.Date,
+	}
+	if stamp.Commit != "" {
+		entry["commit"] = stamp.Commit
+	}
+	fc, err = setJSONField(fc, "gorpa", entry)
+	if err != nil {
+		return xerrors.Errorf("cannot stamp package.json: %w", err)
+	}
+
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, fc, stat.Mode())
+}
+
+// setJSONField sets a field of a JSON object and indents the object by two spaces. All other fields keep
+// their order and values, e.g. "&&" in scripts isn't escaped to "\u0026\u0026".
+func setJSONField(fc []byte, key string, value interface{}) ([]byte, error) {
+	type field struct {
+		Key   string
+		Value json.RawMessage
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(fc))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, xerrors.Errorf("not a JSON object")
+	}
+	var fields []field
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := tok.(string)
+		if !ok {
+			return nil, xerrors.Errorf("invalid JSON object key %v", tok)
+		}
+		var v json.RawMessage
+		err = dec.Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field{Key: k, Value: v})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	encode := func(v interface{}) (json.RawMessage, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSpace(buf.Bytes()), nil
+	}
+	v, err := encode(value)
+	if err != nil {
+		return nil, err
+	}
+	var found bool
+	for i := range fields {
+		if fields[i].Key == key {
+			fields[i].Value = v
+			found = true
+		}
+	}
+	if !found {
+		fields = append(fields, field{Key: key, Value: v})
+	}
+
+	var res bytes.Buffer
+	res.WriteString("{")
+	for i, f := range fields {
+		if i > 0 {
+			res.WriteString(",")
+		}
+		k, err := encode(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		res.WriteString("\n  ")
+		res.Write(k)
+		res.WriteString(": ")
+		err = json.Indent(&res, f.Value, "  ", "  ")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > 0 {
+		res.WriteString("\n")
+	}
+	res.WriteString("}\n")
+	return res.Bytes(), nil
+}
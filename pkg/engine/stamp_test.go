@@ -0,0 +1,124 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStampLdflags(t *testing.T) {
+	stamp := &buildStamp{Version: "abc", Commit: "def", Date: "2021-01-01T00:00:00Z"}
+	const x = "-X main.version=abc -X main.commit=def -X main.date=2021-01-01T00:00:00Z"
+
+	tests := []struct {
+		Name        string
+		Config      GoStampConfig
+		Stamp       *buildStamp
+		BuildFlags  []string
+		Expectation []string
+	}{
+		{
+			Name:        "no ldflags",
+			Stamp:       stamp,
+			BuildFlags:  []string{"-trimpath"},
+			Expectation: []string{"-trimpath", "-ldflags=" + x},
+		},
+		{
+			Name:        "separate ldflags",
+			Stamp:       stamp,
+			BuildFlags:  []string{"-ldflags", "-s -w", "-trimpath"},
+			Expectation: []string{"-ldflags", "-s -w " + x, "-trimpath"},
+		},
+		{
+			Name:        "ldflags with equals",
+			Stamp:       stamp,
+			BuildFlags:  []string{"--ldflags=-s -w"},
+			Expectation: []string{"--ldflags=-s -w " + x},
+		},
+		{
+			Name:        "last ldflags wins",
+			Stamp:       stamp,
+			BuildFlags:  []string{"-ldflags=-s", "-ldflags=-w"},
+			Expectation: []string{"-ldflags=-s", "-ldflags=-w " + x},
+		},
+		{
+			Name:        "custom variables",
+			Config:      GoStampConfig{Version: "example.com/app/version.Version"},
+			Stamp:       &buildStamp{Version: "abc", Date: "2021-01-01T00:00:00Z"},
+			Expectation: []string{"-ldflags=-X example.com/app/version.Version=abc -X main.date=2021-01-01T00:00:00Z"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := test.Config.stampLdflags(test.BuildFlags, test.Stamp)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("stampLdflags() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetJSONField(t *testing.T) {
+	entry := map[string]string{"version": "abc", "date": "2021-01-01T00:00:00Z"}
+	tests := []struct {
+		Name        string
+		Input       string
+		Expectation string
+		Invalid     bool
+	}{
+		{
+			Name:        "keeps order and encoding",
+			Input:       `{"name":"app","version":"1.0.0","scripts":{"build":"tsc && webpack","lint":"eslint '<src>'"},"dependencies":{}}`,
+			Expectation: "{\n  \"name\": \"app\",\n  \"version\": \"1.0.0\",\n  \"scripts\": {\n    \"build\": \"tsc && webpack\",\n    \"lint\": \"eslint '<src>'\"\n  },\n  \"dependencies\": {},\n  \"gorpa\": {\n    \"date\": \"2021-01-01T00:00:00Z\",\n    \"version\": \"abc\"\n  }\n}\n",
+		},
+		{
+			Name:        "replaces existing field",
+			Input:       "{\n  \"gorpa\": {\"version\": \"old\"},\n  \"name\": \"app\"\n}\n",
+			Expectation: "{\n  \"gorpa\": {\n    \"date\": \"2021-01-01T00:00:00Z\",\n    \"version\": \"abc\"\n  },\n  \"name\": \"app\"\n}\n",
+		},
+		{
+			Name:        "empty object",
+			Input:       "{}",
+			Expectation: "{\n  \"gorpa\": {\n    \"date\": \"2021-01-01T00:00:00Z\",\n    \"version\": \"abc\"\n  }\n}\n",
+		},
+		{Name: "no object", Input: `["a"]`, Invalid: true},
+		{Name: "invalid", Input: `{"name": }`, Invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := setJSONField([]byte(test.Input), "gorpa", entry)
+			if test.Invalid {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, string(act)); diff != "" {
+				t.Errorf("setJSONField() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
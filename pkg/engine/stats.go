@@ -0,0 +1,220 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// DuplicateFile is a file which is stored identically in more than one cached artifact
+type DuplicateFile struct {
+	Hash        string                `json:"hash" yaml:"hash"`
+	Size        int64                 `json:"size" yaml:"size"`
+	Occurrences []DuplicateOccurrence `json:"occurrences" yaml:"occurrences"`
+	// WastedBytes is the space taken by all but the first copy of this file
+	WastedBytes int64 `json:"wastedBytes" yaml:"wastedBytes"`
+}
+
+// DuplicateOccurrence names a single copy of a duplicate file
+type DuplicateOccurrence struct {
+	Package string `json:"package" yaml:"package"`
+	Path    string `json:"path" yaml:"path"`
+}
+
+// EmbeddedDependency reports files a package artifact shares with the artifact of one of its
+// transitive dependencies. A large share usually means the package embeds the dependency.
+type EmbeddedDependency struct {
+	Package    string `json:"package" yaml:"package"`
+	Dependency string `json:"dependency" yaml:"dependency"`
+	Files      int    `json:"files" yaml:"files"`
+	Bytes      int64  `json:"bytes" yaml:"bytes"`
+}
+
+// DuplicatesReport summarises how much content is stored more than once in the cached artifacts of a set of packages
+type DuplicatesReport struct {
+	Artifacts   int   `json:"artifacts" yaml:"artifacts"`
+	Files       int   `json:"files" yaml:"files"`
+	TotalBytes  int64 `json:"totalBytes" yaml:"totalBytes"`
+	UniqueBytes int64 `json:"uniqueBytes" yaml:"uniqueBytes"`
+	// SavableBytes is the uncompressed size a content-addressed store would save over the current artifacts
+	SavableBytes int64                `json:"savableBytes" yaml:"savableBytes"`
+	Duplicates   []DuplicateFile      `json:"duplicates,omitempty" yaml:"duplicates,omitempty"`
+	Embedded     []EmbeddedDependency `json:"embedded,omitempty" yaml:"embedded,omitempty"`
+}
+
+type artifactFile struct {
+	Path string
+	Hash string
+	Size int64
+}
+
+// FindDuplicateFiles hashes the content of all cached artifacts of pkgs and reports the files
+// stored in more than one of them. Packages without a cached artifact are skipped, as are empty
+// files and the build metadata (build info and provenance) every artifact carries.
+// Duplicates and embedded dependencies are sorted by the number of bytes involved, largest first.
+func FindDuplicateFiles(cache Cache, pkgs []*Package) (*DuplicatesReport, error) {
+	var (
+		res      DuplicatesReport
+		contents = make(map[string][]artifactFile)
+		byHash   = make(map[string]*DuplicateFile)
+	)
+	for _, p := range pkgs {
+		fn, exists := cache.Location(p)
+		if !exists {
+			continue
+		}
+		files, err := hashArtifactFiles(fn)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read artifact of %s: %w", p.FullName(), err)
+		}
+		contents[p.FullName()] = files
+		res.Artifacts++
+
+		for _, f := range files {
+			res.Files++
+			res.TotalBytes += f.Size
+
+			d, ok := byHash[f.Hash]
+			if !ok {
+				d = &DuplicateFile{Hash: f.Hash, Size: f.Size}
+				byHash[f.Hash] = d
+				res.UniqueBytes += f.Size
+			} else {
+				d.WastedBytes += f.Size
+			}
+			d.Occurrences = append(d.Occurrences, DuplicateOccurrence{Package: p.FullName(), Path: f.Path})
+		}
+	}
+	res.SavableBytes = res.TotalBytes - res.UniqueBytes
+
+	for _, d := range byHash {
+		if len(d.Occurrences) < 2 {
+			continue
+		}
+		sort.Slice(d.Occurrences, func(i, j int) bool {
+			if d.Occurrences[i].Package != d.Occurrences[j].Package {
+				return d.Occurrences[i].Package < d.Occurrences[j].Package
+			}
+			return d.Occurrences[i].Path < d.Occurrences[j].Path
+		})
+		res.Duplicates = append(res.Duplicates, *d)
+	}
+	sort.Slice(res.Duplicates, func(i, j int) bool {
+		if res.Duplicates[i].WastedBytes != res.Duplicates[j].WastedBytes {
+			return res.Duplicates[i].WastedBytes > res.Duplicates[j].WastedBytes
+		}
+		return res.Duplicates[i].Hash < res.Duplicates[j].Hash
+	})
+
+	for _, p := range pkgs {
+		files, ok := contents[p.FullName()]
+		if !ok {
+			continue
+		}
+		for _, dep := range p.GetTransitiveDependencies() {
+			depFiles, ok := contents[dep.FullName()]
+			if !ok {
+				continue
+			}
+			depHashes := make(map[string]struct{}, len(depFiles))
+			for _, f := range depFiles {
+				depHashes[f.Hash] = struct{}{}
+			}
+
+			e := EmbeddedDependency{Package: p.FullName(), Dependency: dep.FullName()}
+			for _, f := range files {
+				if _, ok := depHashes[f.Hash]; ok {
+					e.Files++
+					e.Bytes += f.Size
+				}
+			}
+			if e.Files > 0 {
+				res.Embedded = append(res.Embedded, e)
+			}
+		}
+	}
+	sort.Slice(res.Embedded, func(i, j int) bool {
+		if res.Embedded[i].Bytes != res.Embedded[j].Bytes {
+			return res.Embedded[i].Bytes > res.Embedded[j].Bytes
+		}
+		if res.Embedded[i].Package != res.Embedded[j].Package {
+			return res.Embedded[i].Package < res.Embedded[j].Package
+		}
+		return res.Embedded[i].Dependency < res.Embedded[j].Dependency
+	})
+
+	return &res, nil
+}
+
+// hashArtifactFiles lists the non-empty regular files of a build artifact with their sha256 hash
+func hashArtifactFiles(fn string) ([]artifactFile, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+
+	var res []artifactFile
+	a := tar.NewReader(g)
+	for {
+		hdr, err := a.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 {
+			continue
+		}
+
+		name := normaliseArtifactPath(hdr.Name)
+		if name == buildInfoFilename || name == provenanceBundleFilename {
+			continue
+		}
+
+		hash := sha256.New()
+		n, err := io.Copy(hash, a)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, artifactFile{
+			Path: name,
+			Hash: hex.EncodeToString(hash.Sum(nil)),
+			Size: n,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,103 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testArtifactCache map[string]string
+
+func (c testArtifactCache) Location(pkg *Package) (path string, exists bool) {
+	path, exists = c[pkg.FullName()]
+	return
+}
+
+func writeTestArtifact(t *testing.T, fn string, files map[string]string) {
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g := gzip.NewWriter(f)
+	a := tar.NewWriter(g)
+	for name, content := range files {
+		err = a.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = a.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDuplicateFiles(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		lib   = NewTestPackage("lib")
+		app   = NewTestPackage("app")
+		other = NewTestPackage("other")
+		cache = make(testArtifactCache)
+	)
+	app.dependencies = []*Package{lib}
+	artifacts := map[*Package]map[string]string{
+		lib:   {"./lib.so": "library", "./.gorpa-buildinfo.json": "{}", "./empty": ""},
+		app:   {"./app": "application", "./_deps/lib/lib.so": "library", "./.gorpa-buildinfo.json": "{}"},
+		other: {"./README.md": "application"},
+	}
+	for p, files := range artifacts {
+		fn := filepath.Join(dir, p.Name+".tar.gz")
+		writeTestArtifact(t, fn, files)
+		cache[p.FullName()] = fn
+	}
+
+	act, err := FindDuplicateFiles(cache, []*Package{lib, app, other, NewTestPackage("not-built")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Artifacts != 3 || act.Files != 4 || act.TotalBytes != 36 || act.UniqueBytes != 18 || act.SavableBytes != 18 {
+		t.Errorf("unexpected totals: %+v", act)
+	}
+	if len(act.Duplicates) != 2 {
+		t.Fatalf("expected two duplicates, got %+v", act.Duplicates)
+	}
+	if act.Duplicates[0].Size != 11 || len(act.Duplicates[0].Occurrences) != 2 {
+		t.Errorf("expected the application duplicate first, got %+v", act.Duplicates[0])
+	}
+	expEmbedded := []EmbeddedDependency{{Package: app.FullName(), Dependency: lib.FullName(), Files: 1, Bytes: 7}}
+	if diff := cmp.Diff(expEmbedded, act.Embedded); diff != "" {
+		t.Errorf("Embedded mismatch (-want +got):\n%s", diff)
+	}
+}
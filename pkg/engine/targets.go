@@ -0,0 +1,175 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// SelectPackages returns the packages matching any of the target patterns, sorted by name. A pattern is either
+// a package name (comp:pkg, optionally written //comp:pkg), or a component path ending in "/..." which matches
+// all packages of the component and of the components below it, e.g. //components/... or //... for all
+// packages of the application. Such a path followed by a package name, e.g. //components/...:app, matches only
+// the packages of that name. The package name "all" matches all packages of a component (comp:all), unless
+// the component has a package which is actually called "all".
+// Any pattern can end in a list of package types which filters its matches, e.g. //...[go,yarn].
+// It's an error if a pattern matches no package.
+func (ba *Application) SelectPackages(patterns []string) ([]*Package, error) {
+	idx := make(map[*Package]struct{})
+	for _, pattern := range patterns {
+		matches, err := ba.selectPackages(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range matches {
+			idx[p] = struct{}{}
+		}
+	}
+
+	res := make([]*Package, 0, len(idx))
+	for p := range idx {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].FullName() < res[j].FullName() })
+	return res, nil
+}
+
+func (ba *Application) selectPackages(pattern string) ([]*Package, error) {
+	target, types, err := parseTypeFilter(strings.TrimPrefix(pattern, "//"))
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", pattern, err)
+	}
+	comp, name := target, ""
+	if i := strings.LastIndex(target, ":"); i >= 0 {
+		comp, name = target[:i], target[i+1:]
+	}
+
+	var (
+		res     []*Package
+		matches = func(pkg *Package) bool {
+			if len(types) == 0 {
+				return true
+			}
+			_, ok := types[pkg.Type]
+			return ok
+		}
+	)
+	if comp != "..." && !strings.HasSuffix(comp, "/...") {
+		if name == "" {
+			return nil, xerrors.Errorf("%s is not a package: use %s:<package> or %s/... to select its packages", pattern, target, target)
+		}
+		if pkg, exists := ba.Packages[target]; exists {
+			if matches(pkg) {
+				res = append(res, pkg)
+			}
+		} else if name == "all" {
+			for _, pkg := range ba.Packages {
+				if pkg.C.Name == comp && matches(pkg) {
+					res = append(res, pkg)
+				}
+			}
+		} else {
+			return nil, xerrors.Errorf("package \"%s\" does not exist", target)
+		}
+	} else {
+		prefix := strings.TrimSuffix(strings.TrimSuffix(comp, "..."), "/")
+		for _, pkg := range ba.Packages {
+			if prefix != "" && pkg.C.Name != prefix && !strings.HasPrefix(pkg.C.Name, prefix+"/") {
+				continue
+			}
+			if name != "" && name != "all" && pkg.Name != name {
+				continue
+			}
+			if !matches(pkg) {
+				continue
+			}
+			res = append(res, pkg)
+		}
+	}
+	if len(res) == 0 {
+		return nil, xerrors.Errorf("%s matches no package", pattern)
+	}
+	return res, nil
+}
+
+// parseTypeFilter splits a trailing type filter, e.g. [go,yarn], off a target pattern
+func parseTypeFilter(pattern string) (target string, types map[PackageType]struct{}, err error) {
+	if !strings.HasSuffix(pattern, "]") {
+		return pattern, nil, nil
+	}
+	i := strings.LastIndex(pattern, "[")
+	if i < 0 {
+		return "", nil, xerrors.Errorf("type filter lacks an opening [")
+	}
+
+	types = make(map[PackageType]struct{})
+	for _, t := range strings.Split(pattern[i+1:len(pattern)-1], ",") {
+		tpe, err := parsePackageType(strings.TrimSpace(t))
+		if err != nil {
+			return "", nil, err
+		}
+		types[tpe] = struct{}{}
+	}
+	return pattern[:i], types, nil
+}
+
+// parsePackageType returns the package type of this name, where typescript is an alias of yarn
+func parsePackageType(name string) (PackageType, error) {
+	tpe := PackageType(name)
+	if tpe == DeprecatedTypescriptPackage {
+		tpe = YarnPackage
+	}
+	switch tpe {
+	case DockerPackage, GenericPackage, GoPackage, YarnPackage, ProtoPackage, PluginPackage, MetaPackage:
+		return tpe, nil
+	default:
+		return "", xerrors.Errorf("unknown package type \"%s\"", name)
+	}
+}
+
+// GroupTargets returns a package which builds all packages in one build, i.e. the union of their dependency
+// graphs in one scheduler run. The group itself is never built, cached or reported as part of the build.
+// If there is only one package, that package is returned.
+func GroupTargets(pkgs []*Package) (*Package, error) {
+	if len(pkgs) == 0 {
+		return nil, xerrors.Errorf("no packages to build")
+	}
+	if len(pkgs) == 1 {
+		return pkgs[0], nil
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for _, p := range pkgs {
+		names = append(names, p.FullName())
+	}
+	app := pkgs[0].C.W
+	return &Package{
+		C:                &Component{W: app, Origin: app.Origin},
+		packageInternal:  packageInternal{Name: "targets", Type: MetaPackage, Ephemeral: true},
+		Definition:       []byte(strings.Join(names, "\n")),
+		dependencies:     append([]*Package{}, pkgs...),
+		fullNameOverride: strings.Join(names, " "),
+		targetGroup:      true,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelectPackages(t *testing.T) {
+	app := &Application{Packages: make(map[string]*Package)}
+	for _, name := range []string{"components/server:app", "components/server:lib", "components/web:app", "tools:app"} {
+		comp, pkg := name[:len(name)-4], name[len(name)-3:]
+		tpe := GenericPackage
+		if pkg == "lib" {
+			tpe = GoPackage
+		}
+		p := testPackage(app, pkg, tpe)
+		p.C.Name = comp
+		p.Definition = []byte(name)
+		app.Packages[name] = p
+	}
+
+	tests := []struct {
+		Patterns    []string
+		Expectation []string
+		Error       bool
+	}{
+		{Patterns: []string{"tools:app"}, Expectation: []string{"tools:app"}},
+		{Patterns: []string{"//components/...:app", "//tools:app"}, Expectation: []string{"components/server:app", "components/web:app", "tools:app"}},
+		{Patterns: []string{"//components/server/...", "components/server:app"}, Expectation: []string{"components/server:app", "components/server:lib"}},
+		{Patterns: []string{"//..."}, Expectation: []string{"components/server:app", "components/server:lib", "components/web:app", "tools:app"}},
+		{Patterns: []string{"components/server:all"}, Expectation: []string{"components/server:app", "components/server:lib"}},
+		{Patterns: []string{"//components/...:all"}, Expectation: []string{"components/server:app", "components/server:lib", "components/web:app"}},
+		{Patterns: []string{"//...[go]"}, Expectation: []string{"components/server:lib"}},
+		{Patterns: []string{"//components/server:all[generic,go]"}, Expectation: []string{"components/server:app", "components/server:lib"}},
+		{Patterns: []string{"//tools:app[go]"}, Error: true},
+		{Patterns: []string{"//...[rust]"}, Error: true},
+		{Patterns: []string{"//comp/..."}, Error: true},
+		{Patterns: []string{"tools"}, Error: true},
+		{Patterns: []string{"tools:missing"}, Error: true},
+	}
+	for _, test := range tests {
+		pkgs, err := app.SelectPackages(test.Patterns)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.Patterns)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.Patterns, err)
+			continue
+		}
+		var act []string
+		for _, p := range pkgs {
+			act = append(act, p.FullName())
+		}
+		if diff := cmp.Diff(test.Expectation, act); diff != "" {
+			t.Errorf("%v: SelectPackages() mismatch (-want +got):\n%s", test.Patterns, diff)
+		}
+	}
+}
+
+func TestBuildTargetGroup(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	app := &Application{}
+	pkg := func(name string) *Package {
+		p := testPackage(app, name, GenericPackage)
+		p.Config = GenericPkgConfig{Commands: [][]string{{"true"}}}
+		return p
+	}
+	targets := []*Package{pkg("a"), pkg("b")}
+	group, err := GroupTargets(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Build(group, WithLocalCache(cache), WithReporter(NewMetricsReporter(cache)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range targets {
+		if _, built := cache.Location(p); !built {
+			t.Errorf("expected %s to be built", p.FullName())
+		}
+	}
+	if _, built := cache.Location(group); built {
+		t.Errorf("expected the target group not to be built")
+	}
+}
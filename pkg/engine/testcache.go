@@ -0,0 +1,133 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Test results are cached apart from the artifacts: <version>.test records that the tests of a package version passed,
+// <version>.untested that the package version was built without running its tests.
+const (
+	testPassedSuffix   = ".test"
+	testUntestedSuffix = ".untested"
+)
+
+func (c *buildContext) testCache() markerCache {
+	return markerCache{Dir: c.TestCacheDir, Name: "test cache"}
+}
+
+// testsPassed returns true if the tests of the package version passed before
+func (c *buildContext) testsPassed(p *Package) bool {
+	return c.testCache().has(p, testPassedSuffix)
+}
+
+// recordTests records whether the tests of the package version passed or were not run. Nothing is recorded if only
+// some of the tests ran, as the test filter selected them.
+func (c *buildContext) recordTests(p *Package, passed bool) error {
+	cache := c.testCache()
+	if !cache.enabled() || c.TestFilter != "" {
+		return nil
+	}
+	if !passed {
+		return cache.mark(p, testUntestedSuffix, nil)
+	}
+	err := cache.mark(p, testPassedSuffix, []byte(time.Now().UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+	return cache.unmark(p, testUntestedSuffix)
+}
+
+// untestedPackages returns the cached packages which were built without running their tests, and have not been
+// tested since. Builds which test run their tests without building them again.
+func (c *buildContext) untestedPackages(pkgs []*Package) map[*Package]bool {
+	res := make(map[*Package]bool)
+	if c.TestCacheDir == "" || c.DontTest {
+		return res
+	}
+	for _, p := range pkgs {
+		if _, exists := c.LocalCache.Location(p); !exists || p.Ephemeral {
+			continue
+		}
+		if !c.testCache().has(p, testUntestedSuffix) || c.testsPassed(p) {
+			continue
+		}
+		res[p] = true
+	}
+	return res
+}
+
+// runTests runs the tests of a package build. Tests which passed for the package version before are not run again
+// until its version changes, unless tests are forced. Builds which don't test record the package as untested, and
+// so do quarantined packages whose tests failed.
+func (c *buildContext) runTests(p *Package, wd string, bld *packageBuild) error {
+	if len(bld.TestCommands) == 0 && bld.Test == nil {
+		return nil
+	}
+	if c.DontTest {
+		return c.recordTests(p, false)
+	}
+	if !c.ForceTests && !c.takeTestTarget(p) && c.testsPassed(p) {
+		log.WithField("package", p.FullName()).Debug("tests passed for this version before - not testing again")
+		return nil
+	}
+
+	passed, err := c.runTestsWithRetries(p, wd, bld)
+	if err != nil {
+		return err
+	}
+	return c.recordTests(p, passed)
+}
+
+// needsTesting returns true if the package or one of its dependencies was built without tests and must be tested now
+func (c *buildContext) needsTesting(p *Package) bool {
+	if len(c.untested) == 0 {
+		return false
+	}
+	if c.untested[p] {
+		return true
+	}
+	for _, dep := range p.GetTransitiveDependencies() {
+		if c.untested[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTestCache remembers the package versions whose tests passed, or which were built without tests, in this directory
+func WithTestCache(dir string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.TestCacheDir = dir
+		return nil
+	}
+}
+
+// WithForceTests runs tests even if they passed for the package version before
+func WithForceTests(force bool) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.ForceTests = force
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTestCache(t *testing.T) {
+	pkg := testPackage(&Application{}, "pkg", GenericPackage)
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &buildContext{buildOptions: buildOptions{
+		LocalCache:   cache,
+		Reporter:     &shardReporter{},
+		TestCacheDir: filepath.Join(t.TempDir(), "tests"),
+		DontTest:     true,
+	}}
+	var (
+		wd      = t.TempDir()
+		failing = &packageBuild{TestCommands: [][]string{{"false"}}}
+		passing = &packageBuild{TestCommands: [][]string{{"true"}}}
+	)
+
+	err = ctx.runTests(pkg, wd, failing)
+	if err != nil {
+		t.Fatalf("tests ran despite tests being disabled: %v", err)
+	}
+	if untested := ctx.untestedPackages([]*Package{pkg}); len(untested) != 0 {
+		t.Errorf("packages which are not cached must not be tested, got %v", untested)
+	}
+
+	fn, _ := cache.Location(pkg)
+	err = ioutil.WriteFile(fn, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.DontTest = false
+	if untested := ctx.untestedPackages([]*Package{pkg}); !untested[pkg] {
+		t.Fatalf("expected the package built without tests to be untested")
+	}
+
+	err = ctx.runTests(pkg, wd, passing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ctx.testsPassed(pkg) {
+		t.Fatalf("expected the tests to have passed")
+	}
+	if untested := ctx.untestedPackages([]*Package{pkg}); len(untested) != 0 {
+		t.Errorf("expected no untested packages once the tests passed, got %v", untested)
+	}
+
+	err = ctx.runTests(pkg, wd, failing)
+	if err != nil {
+		t.Errorf("tests which passed for the version before ran again: %v", err)
+	}
+	ctx.ForceTests = true
+	err = ctx.runTests(pkg, wd, failing)
+	if err == nil {
+		t.Errorf("expected forced tests to run")
+	}
+}
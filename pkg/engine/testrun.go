@@ -0,0 +1,154 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// EnvvarTestFilter passes the test filter (see WithTestFilter) to the test commands of packages other than Go packages
+const EnvvarTestFilter = "GORPA_TEST_FILTER"
+
+// Test runs the tests of packages without building them. Their dependencies come from the caches, or are built
+// if they aren't cached, but the packages themselves only run the build commands their tests need. Their tests
+// run even if they passed for the package version before. Packages are tested in the given order, and testing
+// stops at the first package whose tests fail.
+func Test(pkgs []*Package, opts ...BuildOption) (err error) {
+	if len(pkgs) == 0 {
+		return xerrors.Errorf("no packages to test")
+	}
+	options, err := applyBuildOpts(opts)
+	if err != nil {
+		return err
+	}
+	if options.DontTest {
+		return xerrors.Errorf("cannot test packages with tests disabled")
+	}
+	ctx, err := newBuildContext(options)
+	if err != nil {
+		return err
+	}
+
+	target := pkgs[0]
+	removeRegistries, err := ctx.configureRegistries(target.C.W)
+	if err != nil {
+		return err
+	}
+	defer removeRegistries()
+
+	var (
+		requirements []*Package
+		idx          = make(map[*Package]struct{})
+	)
+	for _, p := range pkgs {
+		idx[p] = struct{}{}
+	}
+	for _, p := range pkgs {
+		for _, dep := range p.GetTransitiveDependencies() {
+			if _, exists := idx[dep]; exists {
+				continue
+			}
+			idx[dep] = struct{}{}
+			requirements = append(requirements, dep)
+		}
+	}
+	err = checkVersions(append(requirements, pkgs...))
+	if err != nil {
+		return err
+	}
+	_, err = ctx.downloadRequirements(options, target, requirements)
+	if err != nil {
+		return err
+	}
+
+	pkgstatus := make(map[*Package]PackageBuildStatus, len(requirements)+len(pkgs))
+	for _, p := range requirements {
+		if _, exists := ctx.LocalCache.Location(p); exists && !p.Ephemeral {
+			pkgstatus[p] = PackageBuilt
+		} else {
+			pkgstatus[p] = PackageNotBuiltYet
+		}
+	}
+	ctx.untested = make(map[*Package]bool, len(pkgs))
+	ctx.testTargets = make(map[*Package]bool, len(pkgs))
+	for _, p := range pkgs {
+		pkgstatus[p] = PackageNotBuiltYet
+		ctx.untested[p] = true
+		ctx.testTargets[p] = true
+	}
+
+	options.Reporter.BuildStarted(target, pkgstatus)
+	defer func(err *error) {
+		options.Reporter.BuildFinished(target, *err)
+	}(&err)
+
+	var testErr error
+	for _, p := range pkgs {
+		testErr = p.testCached(ctx)
+		if testErr != nil {
+			break
+		}
+	}
+	cacheErr := options.RemoteCache.Upload(ctx.LocalCache, ctx.GetNewPackagesForCache())
+	ctx.uploadPackageLogs(ctx.GetNewPackagesForCache())
+
+	if testErr != nil {
+		// the error has been reported using the reporter already
+		return xerrors.Errorf("tests failed")
+	}
+	return cacheErr
+}
+
+// testEnvironment returns the environment of the test commands of a package build
+func (c *buildContext) testEnvironment(bld *packageBuild) []string {
+	if c.TestFilter == "" {
+		return bld.Environment
+	}
+	env := bld.Environment
+	return append(env[:len(env):len(env)], EnvvarTestFilter+"="+c.TestFilter)
+}
+
+// isTestTarget returns true if the package is tested by Test() and its tests have not run yet
+func (c *buildContext) isTestTarget(p *Package) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.testTargets[p]
+}
+
+// takeTestTarget returns true if the package is tested by Test() and its tests have not run yet. Its tests run only once.
+func (c *buildContext) takeTestTarget(p *Package) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.testTargets[p] {
+		return false
+	}
+	delete(c.testTargets, p)
+	return true
+}
+
+// WithTestFilter runs only the tests whose names match the filter. Go packages pass it to `go test -run`,
+// the test commands of all other packages find it in the GORPA_TEST_FILTER environment variable.
+func WithTestFilter(filter string) BuildOption {
+	return func(opts *buildOptions) error {
+		opts.TestFilter = filter
+		return nil
+	}
+}
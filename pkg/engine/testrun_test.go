@@ -0,0 +1,74 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTestPackage(t *testing.T) {
+	t.Setenv(EnvvarBuildDir, t.TempDir())
+
+	var (
+		log = filepath.Join(t.TempDir(), "test.log")
+		pkg = testPackage(&Application{}, "pkg", GenericPackage)
+	)
+	pkg.Config = GenericPkgConfig{Commands: [][]string{{"sh", "-c", "echo \"filter=$" + EnvvarTestFilter + "\" >> " + log}}, Test: [][]string{{"true"}}}
+	cache, err := NewFilesystemCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache := t.TempDir()
+	opts := []BuildOption{
+		WithLocalCache(cache),
+		WithTestCache(testCache),
+		WithReporter(NewMetricsReporter(cache)),
+		WithTestFilter("TestA"),
+	}
+	for i := 0; i < 2; i++ {
+		err = Test([]*Package{pkg}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fc, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := strings.TrimSpace(string(fc)); act != "filter=TestA\nfilter=TestA" {
+		t.Errorf("expected the package to be tested twice with the test filter, got %q", act)
+	}
+	if _, exists := cache.Location(pkg); exists {
+		t.Errorf("testing a package must not build it")
+	}
+	if markers, _ := ioutil.ReadDir(testCache); len(markers) > 0 {
+		t.Errorf("filtered tests must not be recorded in the test cache, found %s", markers[0].Name())
+	}
+
+	err = Test([]*Package{pkg}, append(opts, WithDontTest(true))...)
+	if err == nil {
+		t.Errorf("expected an error when testing with tests disabled")
+	}
+}
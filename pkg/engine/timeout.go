@@ -0,0 +1,135 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Timeouts limit how long the commands of a package build may run, so that hung compilers or tests fail the
+// build instead of stalling it indefinitely. A zero timeout does not limit the commands.
+type Timeouts struct {
+	// Build limits the build commands of a package altogether, e.g. 30m
+	Build time.Duration `yaml:"build,omitempty"`
+	// Test limits each attempt to run the tests of a package, e.g. 10m
+	Test time.Duration `yaml:"test,omitempty"`
+}
+
+// Validate returns an error if a timeout is negative
+func (t Timeouts) Validate() error {
+	if t.Build < 0 {
+		return xerrors.Errorf("invalid build timeout: %s", t.Build)
+	}
+	if t.Test < 0 {
+		return xerrors.Errorf("invalid test timeout: %s", t.Test)
+	}
+	return nil
+}
+
+// TimeoutErr is returned when the commands of a package build phase did not finish within their timeout
+type TimeoutErr struct {
+	Package *Package
+	Phase   BuildPhase
+	Timeout time.Duration
+	Err     error
+}
+
+func (e TimeoutErr) Error() string {
+	return fmt.Sprintf("%s of %s timed out after %s", e.Phase, e.Package.FullName(), e.Timeout)
+}
+
+func (e TimeoutErr) Unwrap() error {
+	return e.Err
+}
+
+// phaseDeadline is the time by which the commands of a package build phase must have finished
+type phaseDeadline struct {
+	Phase   BuildPhase
+	Timeout time.Duration
+	At      time.Time
+}
+
+// phaseDeadlines keeps the deadlines of the package build phases which are running
+type phaseDeadlines struct {
+	mu        sync.Mutex
+	deadlines map[*Package]*phaseDeadline
+}
+
+// Get returns the deadline of the running build phase of a package, or nil if the phase has no timeout
+func (d *phaseDeadlines) Get(p *Package) *phaseDeadline {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deadlines[p]
+}
+
+func (d *phaseDeadlines) set(p *Package, dl *phaseDeadline) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dl == nil {
+		delete(d.deadlines, p)
+		return
+	}
+	if d.deadlines == nil {
+		d.deadlines = make(map[*Package]*phaseDeadline)
+	}
+	d.deadlines[p] = dl
+}
+
+// timeout returns the timeout of a package build phase. The package's own timeouts take precedence over
+// those of the build.
+func (c *buildContext) timeout(p *Package, phase BuildPhase) time.Duration {
+	own, def := p.Timeout.Build, c.Timeout.Build
+	if phase == BuildPhaseTest {
+		own, def = p.Timeout.Test, c.Timeout.Test
+	}
+	if own > 0 {
+		return own
+	}
+	return def
+}
+
+// startTimeout starts the timeout of a package build phase. Commands the package runs before stop is called
+// are killed once the timeout expired.
+func (c *buildContext) startTimeout(p *Package, phase BuildPhase) (stop func()) {
+	timeout := c.timeout(p, phase)
+	if timeout == 0 {
+		return func() {}
+	}
+	c.deadlines.set(p, &phaseDeadline{Phase: phase, Timeout: timeout, At: time.Now().Add(timeout)})
+	return func() { c.deadlines.set(p, nil) }
+}
+
+// WithTimeouts limits how long the build and test commands of all packages may run, unless a package
+// configures its own timeout
+func WithTimeouts(timeouts Timeouts) BuildOption {
+	return func(opts *buildOptions) error {
+		err := timeouts.Validate()
+		if err != nil {
+			return err
+		}
+		opts.Timeout = timeouts
+		return nil
+	}
+}
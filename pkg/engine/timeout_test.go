@@ -0,0 +1,67 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	var (
+		pkg      = &Package{C: &Component{Name: "comp", W: &Application{}}, packageInternal: packageInternal{Name: "pkg", Type: GenericPackage, Timeout: Timeouts{Build: 500 * time.Millisecond}}}
+		buildctx = &buildContext{buildOptions: buildOptions{Timeout: Timeouts{Build: time.Minute, Test: time.Minute}}}
+		rep      = &shardReporter{}
+	)
+	if act := buildctx.timeout(pkg, BuildPhaseTest); act != time.Minute {
+		t.Errorf("expected the test timeout of the build, got %s", act)
+	}
+
+	stop := buildctx.startTimeout(pkg, BuildPhaseBuild)
+	err := executeCommandsWithReporter(buildctx, rep, pkg, t.TempDir(), [][]string{{"true"}}, nil)
+	if err != nil {
+		t.Fatalf("build command failed: %v", err)
+	}
+
+	// the background sleep keeps the output of the command open unless it's killed, too
+	start := time.Now()
+	err = executeCommandsWithReporter(buildctx, rep, pkg, t.TempDir(), [][]string{{"sh", "-c", "sleep 30 & sleep 30"}}, nil)
+	stop()
+	var timeoutErr TimeoutErr
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if timeoutErr.Phase != BuildPhaseBuild || timeoutErr.Timeout != 500*time.Millisecond {
+		t.Errorf("unexpected timeout error: %v", timeoutErr)
+	}
+	if took := time.Since(start); took > 10*time.Second {
+		t.Errorf("timed out build command took %s", took)
+	}
+	if buildctx.deadlines.Get(pkg) != nil {
+		t.Errorf("expected the deadline to be gone once the timeout stopped")
+	}
+
+	err = Timeouts{Test: -time.Second}.Validate()
+	if err == nil {
+		t.Errorf("expected negative timeouts to be invalid")
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !windows
+// +build !windows
+
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processGroups are the process groups of the running commands. Commands in their own process group are not in the
+// foreground process group of the terminal anymore, hence they don't receive its interrupts unless we forward them.
+var processGroups struct {
+	sync.Mutex
+	pgids   map[int]struct{}
+	signals chan os.Signal
+}
+
+// raiseSignal sends a signal to this process
+var raiseSignal = func(sig syscall.Signal) {
+	_ = syscall.Kill(os.Getpid(), sig)
+}
+
+// trackProcessGroup forwards SIGINT and SIGTERM to the process group of a started command until untrack is called
+func trackProcessGroup(cmd *exec.Cmd) (untrack func()) {
+	pgid := cmd.Process.Pid
+
+	processGroups.Lock()
+	defer processGroups.Unlock()
+	if processGroups.pgids == nil {
+		processGroups.pgids = make(map[int]struct{})
+	}
+	processGroups.pgids[pgid] = struct{}{}
+	if processGroups.signals == nil {
+		processGroups.signals = make(chan os.Signal, 1)
+		signal.Notify(processGroups.signals, syscall.SIGINT, syscall.SIGTERM)
+		go forwardSignal(processGroups.signals)
+	}
+
+	return func() {
+		processGroups.Lock()
+		defer processGroups.Unlock()
+		delete(processGroups.pgids, pgid)
+	}
+}
+
+// forwardSignal forwards the first signal it receives to all process groups. It then stops listening and raises the
+// signal again, s.t. it affects us as if we never listened for it.
+func forwardSignal(signals chan os.Signal) {
+	sig := (<-signals).(syscall.Signal)
+
+	processGroups.Lock()
+	signal.Stop(signals)
+	processGroups.signals = nil
+	for pgid := range processGroups.pgids {
+		_ = syscall.Kill(-pgid, sig)
+	}
+	processGroups.Unlock()
+
+	raiseSignal(sig)
+}
+
+// killProcessGroup kills the command and all processes it started, which would otherwise keep its output open
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,83 @@
+//go:build !windows
+// +build !windows
+
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestForwardSignalToProcessGroup(t *testing.T) {
+	raised := make(chan syscall.Signal, 1)
+	defer func(orig func(syscall.Signal)) { raiseSignal = orig }(raiseSignal)
+	raiseSignal = func(sig syscall.Signal) { raised <- sig }
+
+	var (
+		dir      = t.TempDir()
+		started  = filepath.Join(dir, "started")
+		received = filepath.Join(dir, "received")
+		pkg      = testPackage(&Application{}, "pkg", GenericPackage)
+		deadline = &phaseDeadline{Phase: BuildPhaseBuild, Timeout: time.Minute, At: time.Now().Add(time.Minute)}
+		script   = "trap 'echo interrupted > " + received + "; exit 3' INT; touch " + started + "; while :; do sleep 0.1; done"
+	)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- run(&shardReporter{}, pkg, deadline, nil, dir, "sh", "-c", script)
+	}()
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if i > 100 {
+			t.Fatal("command did not start")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	err := syscall.Kill(os.Getpid(), syscall.SIGINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("command did not receive the interrupt")
+	}
+	if err == nil {
+		t.Errorf("expected the interrupted command to fail")
+	}
+	fc, _ := ioutil.ReadFile(received)
+	if strings.TrimSpace(string(fc)) != "interrupted" {
+		t.Errorf("the command's process group did not receive the interrupt")
+	}
+	if sig := <-raised; sig != syscall.SIGINT {
+		t.Errorf("expected SIGINT to be raised again, got %v", sig)
+	}
+}
@@ -0,0 +1,248 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// VersionReport breaks the version of a package down into the inputs of its version manifest
+// (see WriteVersionManifest), s.t. one can tell which input changed a version.
+type VersionReport struct {
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	// Settings are the build process version, the content hash algorithm, provenance and Go flags
+	Settings     map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+	Environment  map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Definition   string            `json:"definition" yaml:"definition"`
+	Arguments    map[string]string `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+	BaseImages   map[string]string `json:"baseImages,omitempty" yaml:"baseImages,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	Sources      map[string]string `json:"sources,omitempty" yaml:"sources,omitempty"`
+
+	// DependencyReports explains the versions of all transitive dependencies of the package
+	DependencyReports map[string]*VersionReport `json:"dependencyReports,omitempty" yaml:"dependencyReports,omitempty"`
+}
+
+// ExplainVersion produces the version report of the package and of all its transitive dependencies
+func (p *Package) ExplainVersion() (*VersionReport, error) {
+	res, err := p.explainVersion()
+	if err != nil {
+		return nil, err
+	}
+	deps := p.GetTransitiveDependencies()
+	if len(deps) == 0 {
+		return res, nil
+	}
+	res.DependencyReports = make(map[string]*VersionReport, len(deps))
+	for _, dep := range deps {
+		res.DependencyReports[dep.FullName()], err = dep.explainVersion()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (p *Package) explainVersion() (*VersionReport, error) {
+	version, err := p.Version()
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", p.FullName(), err)
+	}
+	var manifest bytes.Buffer
+	err = p.WriteVersionManifest(&manifest)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", p.FullName(), err)
+	}
+	sources, err := p.ContentManifest()
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", p.FullName(), err)
+	}
+
+	res := &VersionReport{
+		Package:      p.FullName(),
+		Version:      version,
+		Settings:     make(map[string]string),
+		Environment:  make(map[string]string),
+		Arguments:    make(map[string]string),
+		BaseImages:   make(map[string]string),
+		Dependencies: make(map[string]string),
+		Sources:      make(map[string]string, len(sources)),
+	}
+	// the manifest only contains the hash of the environment manifest, but the entries tell what changed
+	for _, e := range p.environmentManifest().Without(p.environmentManifestExclusions()) {
+		res.Environment[e.Name] = e.Value
+	}
+
+	srcIdx := make(map[string]struct{}, len(sources))
+	for _, src := range sources {
+		srcIdx[src] = struct{}{}
+	}
+	depIdx := make(map[string]*Package, len(p.GetDependencies()))
+	for _, dep := range p.GetDependencies() {
+		depver, err := dep.Version()
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", dep.FullName(), err)
+		}
+		depIdx[fmt.Sprintf("%s.%s", dep.FullName(), depver)] = dep
+	}
+
+	scanner := bufio.NewScanner(&manifest)
+	scanner.Buffer(make([]byte, 64*1024), len(manifest.Bytes())+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if _, ok := srcIdx[line]; ok {
+			i := strings.LastIndex(line, ":")
+			res.Sources[line[:i]] = line[i+1:]
+			continue
+		}
+		if dep, ok := depIdx[line]; ok {
+			res.Dependencies[dep.FullName()] = strings.TrimPrefix(line, dep.FullName()+".")
+			continue
+		}
+		if arg := strings.TrimPrefix(line, "arg "); arg != line {
+			segs := strings.SplitN(arg, ": ", 2)
+			if len(segs) == 1 {
+				segs = append(segs, "")
+			}
+			res.Arguments[segs[0]] = segs[1]
+			continue
+		}
+		if img := strings.TrimPrefix(line, "baseImage "); img != line {
+			i := strings.LastIndex(img, "@")
+			if i < 0 {
+				res.BaseImages[img] = ""
+			} else {
+				res.BaseImages[img[:i]] = img[i+1:]
+			}
+			continue
+		}
+
+		segs := strings.SplitN(line, ": ", 2)
+		if len(segs) == 1 {
+			segs = append(segs, "")
+		}
+		switch segs[0] {
+		case "environment":
+		case "definition":
+			res.Definition = segs[1]
+		default:
+			res.Settings[segs[0]] = segs[1]
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// VersionChange is an input of a package version which differs between two version reports
+type VersionChange struct {
+	Package string `json:"package" yaml:"package"`
+	// Input is the kind of input: setting, environment, definition, argument, baseImage, dependency or source
+	Input string `json:"input" yaml:"input"`
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Old is empty if the input was added, New if it was removed
+	Old string `json:"old,omitempty" yaml:"old,omitempty"`
+	New string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// Changes lists the inputs which differ between this report and an earlier one. If a dependency changed and both
+// reports explain its version, the changes which led to its new version are listed as well.
+func (r *VersionReport) Changes(prev *VersionReport) []VersionChange {
+	var (
+		res      []VersionChange
+		prevDeps = prev.DependencyReports
+		seen     = make(map[string]struct{})
+		visit    func(cur, prev *VersionReport)
+	)
+	visit = func(cur, prev *VersionReport) {
+		if _, ok := seen[cur.Package]; ok {
+			return
+		}
+		seen[cur.Package] = struct{}{}
+		if cur.Version == prev.Version {
+			return
+		}
+
+		changes := cur.inputChanges(prev)
+		res = append(res, changes...)
+		for _, c := range changes {
+			if c.Input != "dependency" || c.Old == "" || c.New == "" {
+				continue
+			}
+			cdep, pdep := r.DependencyReports[c.Name], prevDeps[c.Name]
+			if cdep != nil && pdep != nil {
+				visit(cdep, pdep)
+			}
+		}
+	}
+	visit(r, prev)
+	return res
+}
+
+// inputChanges lists the inputs of the package which differ from those in prev
+func (r *VersionReport) inputChanges(prev *VersionReport) []VersionChange {
+	var res []VersionChange
+	diff := func(input string, cur, prev map[string]string) {
+		names := make(map[string]struct{}, len(cur))
+		for k := range cur {
+			names[k] = struct{}{}
+		}
+		for k := range prev {
+			names[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(names))
+		for k := range names {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			c, inCur := cur[k]
+			p, inPrev := prev[k]
+			if inCur == inPrev && c == p {
+				continue
+			}
+			res = append(res, VersionChange{Package: r.Package, Input: input, Name: k, Old: p, New: c})
+		}
+	}
+
+	diff("setting", r.Settings, prev.Settings)
+	diff("environment", r.Environment, prev.Environment)
+	if r.Definition != prev.Definition {
+		res = append(res, VersionChange{Package: r.Package, Input: "definition", Old: prev.Definition, New: r.Definition})
+	}
+	diff("argument", r.Arguments, prev.Arguments)
+	diff("baseImage", r.BaseImages, prev.BaseImages)
+	diff("dependency", r.Dependencies, prev.Dependencies)
+	diff("source", r.Sources, prev.Sources)
+	return res
+}
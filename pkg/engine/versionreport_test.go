@@ -0,0 +1,82 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionReportChanges(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		lib = filepath.Join(dir, "lib.txt")
+		app = filepath.Join(dir, "app.txt")
+	)
+	explain := func(libContent string, args ...string) *VersionReport {
+		for fn, content := range map[string]string{lib: libContent, app: "app"} {
+			err := ioutil.WriteFile(fn, []byte(content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ba := &Application{Origin: dir}
+		libPkg := testPackage(ba, "lib", GenericPackage)
+		libPkg.Sources = []string{lib}
+		appPkg := testPackage(ba, "app", GenericPackage, libPkg)
+		appPkg.Sources = []string{app}
+		appPkg.ArgumentDependencies = args
+		report, err := appPkg.ExplainVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	prev := explain("v1", "flavour: plain")
+	if prev.Sources["app.txt"] == "" || prev.Dependencies["comp:lib"] != prev.DependencyReports["comp:lib"].Version || prev.Arguments["flavour"] != "plain" {
+		t.Fatalf("report does not explain the version: %+v", prev)
+	}
+	if changes := explain("v1", "flavour: plain").Changes(prev); len(changes) != 0 {
+		t.Errorf("unchanged package has changes: %v", changes)
+	}
+
+	changes := explain("v2").Changes(prev)
+	var act []string
+	for _, c := range changes {
+		act = append(act, c.Package+" "+c.Input+" "+c.Name)
+	}
+	exp := []string{
+		"comp:app argument flavour",
+		"comp:app dependency comp:lib",
+		"comp:lib source lib.txt",
+	}
+	if diff := cmp.Diff(exp, act); diff != "" {
+		t.Errorf("Changes() mismatch (-want +got):\n%s", diff)
+	}
+	if len(changes) > 0 && (changes[0].Old != "plain" || changes[0].New != "") {
+		t.Errorf("removed argument should have its old value only: %+v", changes[0])
+	}
+}
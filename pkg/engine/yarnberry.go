@@ -0,0 +1,284 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// yarnRCFilename is the configuration file of Yarn Berry
+	yarnRCFilename = ".yarnrc.yml"
+
+	// yarnBerryPnPLinker is the default nodeLinker of Yarn Berry
+	yarnBerryPnPLinker = "pnp"
+)
+
+// patchYarnRC reads the .yarnrc.yml in wd (if any), applies the settings and writes it back.
+// It returns the nodeLinker the project is installed with.
+func patchYarnRC(wd string, settings map[string]interface{}) (nodeLinker string, err error) {
+	fn := filepath.Join(wd, yarnRCFilename)
+	rc := make(map[string]interface{})
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if len(fc) > 0 {
+		err = yaml.Unmarshal(fc, &rc)
+		if err != nil {
+			return "", xerrors.Errorf("cannot parse %s: %w", yarnRCFilename, err)
+		}
+	}
+
+	for k, v := range settings {
+		rc[k] = v
+	}
+	fc, err = yaml.Marshal(rc)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(fn, fc, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	nodeLinker, _ = rc["nodeLinker"].(string)
+	if nodeLinker == "" {
+		nodeLinker = yarnBerryPnPLinker
+	}
+	return nodeLinker, nil
+}
+
+// readPackageJSONName returns the name in the package.json of a directory
+func readPackageJSONName(dir string) (string, error) {
+	fc, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return "", err
+	}
+	var pkgjson struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(fc, &pkgjson)
+	if err != nil {
+		return "", err
+	}
+	if pkgjson.Name == "" {
+		return "", xerrors.Errorf("%s: package.json has no name", dir)
+	}
+	return pkgjson.Name, nil
+}
+
+// buildYarnBerry implements the build process for yarn packages which use Yarn Berry (v2 and later).
+// Library dependencies are installed from their packed tarballs through resolutions in the package.json,
+// all other dependencies are extracted just like for yarn packages. The install honours the nodeLinker
+// of the .yarnrc.yml, i.e. with Plug'n'Play (the default) the result contains .pnp.cjs and .yarn/cache
+// rather than node_modules.
+// If you change anything in this process that's not backwards compatible, make sure you increment buildProcessVersions accordingly.
+func (p *Package) buildYarnBerry(buildctx *buildContext, wd, result string) (bld *packageBuild, err error) {
+	cfg, ok := p.Config.(YarnPkgConfig)
+	if !ok {
+		return nil, xerrors.Errorf("package should have yarn config")
+	}
+
+	var (
+		fn           = filepath.Join(p.C.Origin, "package.json")
+		pkgjsonFound bool
+	)
+	for _, src := range p.Sources {
+		if src == fn {
+			pkgjsonFound = true
+			break
+		}
+	}
+	if !pkgjsonFound {
+		return nil, xerrors.Errorf("%s: yarn packages must have a package.json", p.FullName())
+	}
+	err = p.stampPackageJSON(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands [][]string
+	if cfg.YarnLock != "" {
+		commands = append(commands, []string{"cp", filepath.Join(p.C.Origin, cfg.YarnLock), "."})
+	}
+	if cfg.TSConfig != "" {
+		commands = append(commands, []string{"cp", filepath.Join(p.C.Origin, cfg.TSConfig), "."})
+	}
+
+	for _, deppkg := range p.GetDependencies() {
+		_, ok := buildctx.LocalCache.Location(deppkg)
+		if deppkg.Ephemeral && !ok {
+			return nil, PkgNotBuiltErr{deppkg}
+		}
+	}
+
+	resolutions := make(map[string]interface{})
+	for _, deppkg := range p.GetTransitiveDependencies() {
+		if deppkg.Ephemeral {
+			continue
+		}
+
+		builtpkg, ok := buildctx.LocalCache.Location(deppkg)
+		if !ok {
+			return nil, PkgNotBuiltErr{deppkg}
+		}
+
+		var isLibrary bool
+		if deppkg.Type == YarnPackage {
+			cfg, ok := deppkg.Config.(YarnPkgConfig)
+			isLibrary = ok && cfg.Packaging == YarnLibrary
+		}
+		if isLibrary {
+			name, err := readPackageJSONName(deppkg.C.Origin)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot resolve library %s: %w", deppkg.FullName(), err)
+			}
+			resolutions[name] = "file:" + builtpkg
+			continue
+		}
+
+		tgt := p.BuildLayoutLocation(deppkg)
+		commands = append(commands, [][]string{
+			{"mkdir", tgt},
+			{"tar", "xfz", builtpkg, "-C", tgt},
+		}...)
+	}
+
+	pkgJSONFilename := filepath.Join(wd, "package.json")
+	var packageJSON map[string]interface{}
+	fc, err := ioutil.ReadFile(pkgJSONFilename)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+	err = json.Unmarshal(fc, &packageJSON)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+	if len(resolutions) > 0 {
+		if res, ok := packageJSON["resolutions"]; ok {
+			existing, ok := res.(map[string]interface{})
+			if !ok {
+				return nil, xerrors.Errorf("invalid package.json: resolutions are not a map")
+			}
+			for k, v := range resolutions {
+				existing[k] = v
+			}
+			resolutions = existing
+		}
+		packageJSON["resolutions"] = resolutions
+	}
+	if rfs, ok := packageJSON["files"]; ok && cfg.Packaging == YarnLibrary {
+		// without a files section yarn pack includes everything, with one we have to add the build info
+		fs, ok := rfs.([]interface{})
+		if !ok {
+			return nil, xerrors.Errorf("invalid package.json: files section is not a list of strings")
+		}
+		fs = append(fs, buildInfoFilename)
+		if p.C.W.Provenance.Enabled {
+			fs = append(fs, provenanceBundleFilename)
+		}
+		if p.generatesSBOM() {
+			fs = append(fs, sbomFilename)
+		}
+		packageJSON["files"] = fs
+	}
+	fc, err = json.MarshalIndent(packageJSON, "", "  ")
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+	err = ioutil.WriteFile(pkgJSONFilename, fc, 0644)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot patch package.json of yarn package: %w", err)
+	}
+
+	// The cache has to be part of the project, so that Plug'n'Play installs remain usable once packaged.
+	// Library tarballs change the lockfile, hence such installs cannot be immutable.
+	settings := map[string]interface{}{
+		"enableGlobalCache": false,
+		"enableTelemetry":   false,
+	}
+	if len(resolutions) > 0 {
+		settings["enableImmutableInstalls"] = false
+		settings["checksumBehavior"] = "update"
+	}
+	nodeLinker, err := patchYarnRC(wd, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	commands = append(commands, p.PreparationCommands...)
+	setupSteps := len(commands)
+
+	if len(cfg.Commands.Install) == 0 {
+		commands = append(commands, []string{"yarn", "install"})
+	} else {
+		commands = append(commands, cfg.Commands.Install)
+	}
+	testSetupSteps := len(commands)
+	if len(cfg.Commands.Build) == 0 {
+		commands = append(commands, []string{"yarn", "build"})
+	} else {
+		commands = append(commands, cfg.Commands.Build)
+	}
+	var testCommands [][]string
+	if !cfg.DontTest {
+		testCmd := []string{"yarn", "test"}
+		if len(cfg.Commands.Test) > 0 {
+			testCmd = cfg.Commands.Test
+		}
+		testCommands = [][]string{testCmd}
+	}
+
+	res := &packageBuild{
+		BuildCommands:  commands,
+		SetupSteps:     setupSteps,
+		TestCommands:   testCommands,
+		TestSetupSteps: testSetupSteps,
+	}
+
+	var pkgCommands [][]string
+	switch cfg.Packaging {
+	case YarnLibrary:
+		pkgCommands = append(pkgCommands, []string{"yarn", "pack", "--out", result})
+	case YarnApp, YarnArchive:
+		if cfg.Packaging == YarnApp || cfg.Prune.Enabled {
+			// focus drops the devDependencies from the install, no matter which linker is used
+			pkgCommands = append(pkgCommands, []string{"yarn", "workspaces", "focus", "--production"})
+		}
+		if cfg.Prune.Enabled && nodeLinker != yarnBerryPnPLinker {
+			pkgCommands = append(pkgCommands, yarnPruneCommand("node_modules", cfg.Prune))
+		}
+		pkgCommands = append(pkgCommands, []string{"tar", "cfz", result, "."})
+	default:
+		return nil, xerrors.Errorf("%s packaging is not supported with the %s package manager", cfg.Packaging, YarnBerryPackageManager)
+	}
+	res.PackageCommands = pkgCommands
+	res.PostBuild = nodePostBuild(wd, "")
+
+	return res, nil
+}
@@ -0,0 +1,95 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPatchYarnRC(t *testing.T) {
+	tests := []struct {
+		Name        string
+		YarnRC      string
+		Settings    map[string]interface{}
+		Expectation map[string]interface{}
+		NodeLinker  string
+	}{
+		{
+			Name:        "no yarnrc",
+			Settings:    map[string]interface{}{"enableGlobalCache": false},
+			Expectation: map[string]interface{}{"enableGlobalCache": false},
+			NodeLinker:  "pnp",
+		},
+		{
+			Name:     "existing yarnrc",
+			YarnRC:   "nodeLinker: node-modules\nyarnPath: .yarn/releases/yarn-3.2.0.cjs\nenableGlobalCache: true\n",
+			Settings: map[string]interface{}{"enableGlobalCache": false},
+			Expectation: map[string]interface{}{
+				"nodeLinker":        "node-modules",
+				"yarnPath":          ".yarn/releases/yarn-3.2.0.cjs",
+				"enableGlobalCache": false,
+			},
+			NodeLinker: "node-modules",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			wd, err := ioutil.TempDir("", "yarnrc-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(wd)
+			if test.YarnRC != "" {
+				err = ioutil.WriteFile(filepath.Join(wd, yarnRCFilename), []byte(test.YarnRC), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			nodeLinker, err := patchYarnRC(wd, test.Settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodeLinker != test.NodeLinker {
+				t.Errorf("unexpected nodeLinker: want %s, got %s", test.NodeLinker, nodeLinker)
+			}
+
+			fc, err := ioutil.ReadFile(filepath.Join(wd, yarnRCFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var act map[string]interface{}
+			err = yaml.Unmarshal(fc, &act)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("patchYarnRC() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
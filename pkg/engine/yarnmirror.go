@@ -0,0 +1,226 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// yarnMirrorObjectPrefix is prepended to the file name of a tarball in the offline mirror to name it in the remote cache
+const yarnMirrorObjectPrefix = "yarn-mirror-"
+
+// YarnMirrorOptions configures the offline mirror yarn packages are installed from
+type YarnMirrorOptions struct {
+	// Dir is the offline mirror directory. If empty, yarn packages are installed without an offline mirror.
+	Dir string
+	// Remote is the remote cache the tarballs of the mirror are kept in. If nil, the mirror is local only.
+	Remote RemoteCache
+	// RemoteLevel determines whether tarballs are downloaded from and/or uploaded to Remote
+	RemoteLevel CacheLevel
+	// Offline installs yarn packages exclusively from the mirror, i.e. never contacts the registry
+	Offline bool
+}
+
+// WithYarnMirror installs yarn packages using an offline mirror
+func WithYarnMirror(mirror YarnMirrorOptions) BuildOption {
+	return func(opts *buildOptions) error {
+		if mirror.Remote != nil {
+			if _, ok := mirror.Remote.(objectStore); !ok {
+				return xerrors.Errorf("the remote cache cannot store the yarn offline mirror")
+			}
+		}
+		if mirror.Offline && mirror.Dir == "" {
+			return xerrors.Errorf("offline yarn installs require an offline mirror")
+		}
+		opts.YarnMirror = mirror
+		return nil
+	}
+}
+
+// usesYarnMirror returns true if the package is installed using the offline mirror. Yarn Berry and npm
+// have caches of their own, and offline mirror packages are a mirror themselves.
+func (buildctx *buildContext) usesYarnMirror(cfg YarnPkgConfig) bool {
+	return buildctx.YarnMirror.Dir != "" && !cfg.IsNpm() && !cfg.IsYarnBerry() && cfg.Packaging != YarnOfflineMirror
+}
+
+var yarnLockResolvedExpr = regexp.MustCompile(`^\s+resolved\s+"?([^"\s]+)"?`)
+
+// yarnRegistryTarballExpr matches registry tarball URLs, e.g. https://registry.yarnpkg.com/@babel/core/-/core-7.0.0.tgz
+var yarnRegistryTarballExpr = regexp.MustCompile(`(?:(@[^/]+)(?:/|%2f))?[^/]+/(?:-|_attachments)/(?:@[^/]+/)?([^/]+)$`)
+
+// parseYarnLockMirrorNames returns the file names yarn gives the tarballs of a yarn.lock in the offline mirror.
+// Dependencies which are not downloaded, e.g. those resolved from file:// URLs, are not part of the mirror.
+func parseYarnLockMirrorNames(fc []byte) []string {
+	idx := make(map[string]struct{})
+	for _, line := range strings.Split(string(fc), "\n") {
+		m := yarnLockResolvedExpr.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		u, err := url.Parse(m[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		var name string
+		if m := yarnRegistryTarballExpr.FindStringSubmatch(u.Path); m != nil {
+			name = m[2]
+			if m[1] != "" {
+				name = m[1] + "-" + name
+			}
+		} else {
+			name = path.Base(u.Path)
+		}
+		if name == "" || name == "/" || name == "." {
+			continue
+		}
+		idx[name] = struct{}{}
+	}
+
+	res := make([]string, 0, len(idx))
+	for n := range idx {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// prepareYarnMirror points yarn to the offline mirror by means of the .yarnrc in wd and downloads the
+// tarballs of the yarn.lock missing in the mirror from the remote cache. It returns the tarballs which
+// were in the mirror before the build.
+func (p *Package) prepareYarnMirror(buildctx *buildContext, wd string, cfg YarnPkgConfig) (map[string]struct{}, error) {
+	mirror := buildctx.YarnMirror
+	err := os.MkdirAll(mirror.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.YarnLock != "" {
+		fc, err := ioutil.ReadFile(filepath.Join(p.C.Origin, cfg.YarnLock))
+		if err != nil {
+			return nil, err
+		}
+		p.downloadYarnMirror(buildctx, parseYarnLockMirrorNames(fc))
+	}
+
+	fd, err := os.OpenFile(filepath.Join(wd, ".yarnrc"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(fd, "\nyarn-offline-mirror %q\nyarn-offline-mirror-pruning false\n", mirror.Dir)
+	fd.Close()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot configure yarn offline mirror: %w", err)
+	}
+
+	return listYarnMirror(mirror.Dir)
+}
+
+// downloadYarnMirror downloads tarballs which are missing in the offline mirror from the remote cache.
+// Like all remote cache transfers this is best effort: yarn downloads tarballs which are still missing.
+func (p *Package) downloadYarnMirror(buildctx *buildContext, names []string) {
+	mirror := buildctx.YarnMirror
+	store, _ := mirror.Remote.(objectStore)
+	if store == nil || mirror.RemoteLevel == CacheRemotePush {
+		return
+	}
+
+	objs := make(map[string]string)
+	for _, n := range names {
+		fn := filepath.Join(mirror.Dir, n)
+		if _, err := os.Stat(fn); err == nil {
+			continue
+		}
+		objs[yarnMirrorObjectPrefix+n] = fn + ".download"
+	}
+	if len(objs) == 0 {
+		return
+	}
+	store.getObjects(objs)
+
+	var downloaded int
+	for _, fn := range objs {
+		if _, err := os.Stat(fn); err != nil {
+			continue
+		}
+		err := os.Rename(fn, strings.TrimSuffix(fn, ".download"))
+		if err != nil {
+			log.WithError(err).WithField("package", p.FullName()).Warn("cannot add tarball to yarn offline mirror")
+			continue
+		}
+		downloaded++
+	}
+	log.WithField("package", p.FullName()).WithField("missing", len(objs)).WithField("downloaded", downloaded).Debug("downloaded yarn offline mirror")
+}
+
+// uploadYarnMirror uploads the tarballs yarn added to the offline mirror during the build to the remote cache.
+// Failing to upload them does not fail the build.
+func (p *Package) uploadYarnMirror(buildctx *buildContext, before map[string]struct{}) {
+	mirror := buildctx.YarnMirror
+	store, _ := mirror.Remote.(objectStore)
+	if store == nil || mirror.RemoteLevel == CacheRemotePull {
+		return
+	}
+
+	after, err := listYarnMirror(mirror.Dir)
+	if err != nil {
+		log.WithError(err).WithField("package", p.FullName()).Warn("cannot upload yarn offline mirror")
+		return
+	}
+	objs := make(map[string]string)
+	for n := range after {
+		if _, ok := before[n]; ok {
+			continue
+		}
+		objs[yarnMirrorObjectPrefix+n] = filepath.Join(mirror.Dir, n)
+	}
+	if len(objs) == 0 {
+		return
+	}
+	store.putObjects(objs)
+	log.WithField("package", p.FullName()).WithField("tarballs", len(objs)).Debug("uploaded yarn offline mirror")
+}
+
+func listYarnMirror(dir string) (map[string]struct{}, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".download") {
+			continue
+		}
+		res[f.Name()] = struct{}{}
+	}
+	return res, nil
+}
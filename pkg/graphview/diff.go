@@ -0,0 +1,137 @@
+package graphview
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sort"
+)
+
+// DiffStatus describes how a node or link changed compared to a baseline graph
+type DiffStatus string
+
+const (
+	// DiffUnchanged marks nodes and links present in both graphs
+	DiffUnchanged DiffStatus = ""
+	// DiffAdded marks nodes and links which are not part of the baseline
+	DiffAdded DiffStatus = "added"
+	// DiffRemoved marks nodes and links which are part of the baseline only
+	DiffRemoved DiffStatus = "removed"
+	// DiffChanged marks nodes whose package version differs from the baseline
+	DiffChanged DiffStatus = "changed"
+)
+
+type linkKey struct {
+	Source, Target string
+}
+
+// Diff merges two graphs into one whose nodes and links carry their status compared to the baseline.
+// Nodes are identified by their name, hence packages which appear several times in a graph are merged
+// into a single node.
+func Diff(baseline, current *Graph) *Graph {
+	var (
+		res     Graph
+		nodeidx = make(map[string]int)
+		baseidx = make(map[string]Node, len(baseline.Nodes))
+	)
+	for _, n := range baseline.Nodes {
+		if _, exists := baseidx[n.Name]; !exists {
+			baseidx[n.Name] = n
+		}
+	}
+
+	addNode := func(n Node, status DiffStatus) {
+		if _, exists := nodeidx[n.Name]; exists {
+			return
+		}
+		n.Status = status
+		nodeidx[n.Name] = len(res.Nodes)
+		res.Nodes = append(res.Nodes, n)
+	}
+	for _, n := range current.Nodes {
+		status := DiffUnchanged
+		if b, ok := baseidx[n.Name]; !ok {
+			status = DiffAdded
+		} else if b.Version != "" && n.Version != "" && b.Version != n.Version {
+			status = DiffChanged
+		}
+		addNode(n, status)
+	}
+	for _, n := range baseline.Nodes {
+		addNode(n, DiffRemoved)
+	}
+
+	// the type IDs of the individual graphs are not comparable, hence we assign them anew
+	typeidx := make(map[string]int)
+	for _, n := range res.Nodes {
+		typeidx[n.Type] = 0
+	}
+	types := make([]string, 0, len(typeidx))
+	for k := range typeidx {
+		types = append(types, k)
+	}
+	sort.Strings(types)
+	for i, k := range types {
+		typeidx[k] = i
+	}
+	for i := range res.Nodes {
+		res.Nodes[i].TypeID = typeidx[res.Nodes[i].Type]
+	}
+
+	keysOf := func(g *Graph) map[linkKey]struct{} {
+		res := make(map[linkKey]struct{}, len(g.Links))
+		for _, l := range g.Links {
+			res[linkKey{g.Nodes[l.Source].Name, g.Nodes[l.Target].Name}] = struct{}{}
+		}
+		return res
+	}
+	var (
+		baseLinks = keysOf(baseline)
+		curLinks  = keysOf(current)
+		seen      = make(map[linkKey]struct{})
+	)
+	addLinks := func(g *Graph, other map[linkKey]struct{}, status DiffStatus) {
+		for _, l := range g.Links {
+			key := linkKey{g.Nodes[l.Source].Name, g.Nodes[l.Target].Name}
+			if _, exists := seen[key]; exists {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			path := make([]int, len(l.Path))
+			for i, p := range l.Path {
+				path[i] = nodeidx[g.Nodes[p].Name]
+			}
+			lnk := Link{
+				Source: nodeidx[key.Source],
+				Target: nodeidx[key.Target],
+				Path:   path,
+			}
+			if _, ok := other[key]; !ok {
+				lnk.Status = status
+			}
+			res.Links = append(res.Links, lnk)
+		}
+	}
+	addLinks(current, baseLinks, DiffAdded)
+	addLinks(baseline, curLinks, DiffRemoved)
+
+	return &res
+}
@@ -0,0 +1,71 @@
+package graphview
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	baseline := &Graph{
+		Nodes: []Node{
+			{Name: "app:main", Version: "v1", Type: "go-app"},
+			{Name: "lib:old", Version: "v1", Type: "go-library"},
+			{Name: "lib:common", Version: "v1", Type: "go-library"},
+		},
+		Links: []Link{
+			{Source: 0, Target: 1, Path: []int{0}},
+			{Source: 0, Target: 2, Path: []int{0}},
+		},
+	}
+	current := &Graph{
+		Nodes: []Node{
+			{Name: "app:main", Version: "v2", Type: "go-app"},
+			{Name: "lib:common", Version: "v1", Type: "go-library"},
+			{Name: "lib:new", Version: "v1", Type: "yarn-library"},
+		},
+		Links: []Link{
+			{Source: 0, Target: 1, Path: []int{0}},
+			{Source: 0, Target: 2, Path: []int{0}},
+		},
+	}
+
+	expectation := &Graph{
+		Nodes: []Node{
+			{Name: "app:main", Version: "v2", Type: "go-app", TypeID: 0, Status: DiffChanged},
+			{Name: "lib:common", Version: "v1", Type: "go-library", TypeID: 1},
+			{Name: "lib:new", Version: "v1", Type: "yarn-library", TypeID: 2, Status: DiffAdded},
+			{Name: "lib:old", Version: "v1", Type: "go-library", TypeID: 1, Status: DiffRemoved},
+		},
+		Links: []Link{
+			{Source: 0, Target: 1, Path: []int{0}},
+			{Source: 0, Target: 2, Path: []int{0}, Status: DiffAdded},
+			{Source: 0, Target: 3, Path: []int{0}, Status: DiffRemoved},
+		},
+	}
+
+	act := Diff(baseline, current)
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("Diff() mismatch (-want +got):\n%s", diff)
+	}
+}
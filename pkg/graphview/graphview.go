@@ -25,6 +25,7 @@ package graphview
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"sort"
 
@@ -35,60 +36,131 @@ import (
 
 // Serve serves the dependency graph view for a package
 func Serve(addr string, pkgs ...*gorpa.Package) error {
-	http.HandleFunc("/graph.json", serveDepGraphJSON(pkgs))
+	g, err := NewGraph(pkgs...)
+	if err != nil {
+		return err
+	}
+	return serveGraph(addr, g)
+}
+
+// ServeDiff serves the dependency graph view highlighting the differences between a baseline snapshot and the packages
+func ServeDiff(addr string, baseline *Graph, pkgs ...*gorpa.Package) error {
+	g, err := NewGraph(pkgs...)
+	if err != nil {
+		return err
+	}
+	return serveGraph(addr, Diff(baseline, g))
+}
+
+// ServeTrust serves the dependency graph view showing where the cached artifacts of the packages came from
+func ServeTrust(addr string, cache gorpa.Cache, pkgs ...*gorpa.Package) error {
+	g, err := NewGraph(pkgs...)
+	if err != nil {
+		return err
+	}
+	err = g.AddTrust(cache, pkgs...)
+	if err != nil {
+		return err
+	}
+	return serveGraph(addr, g)
+}
+
+func serveGraph(addr string, g *Graph) error {
+	js, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	http.HandleFunc("/graph.json", func(w http.ResponseWriter, r *http.Request) {
+		//nolint:errcheck
+		w.Write(js)
+	})
 	http.Handle("/", http.FileServer(rice.MustFindBox("web/dist").HTTPBox()))
 	return http.ListenAndServe(addr, nil)
 }
 
-type graph struct {
-	Nodes []node `json:"nodes"`
-	Links []link `json:"links"`
+// Graph is the dependency graph shown by the graph view. Its JSON serialisation is
+// what the graph view loads, and what is stored as snapshot.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Links []Link `json:"links"`
 }
 
-type node struct {
+// Node is a package in the dependency graph
+type Node struct {
 	Name      string `json:"name"`
 	Component string `json:"comp"`
+	Version   string `json:"version,omitempty"`
 
 	Type   string `json:"type"`
 	TypeID int    `json:"typeid"`
+
+	// Status is set on graphs produced by Diff
+	Status DiffStatus `json:"status,omitempty"`
+	// Trust is set on graphs annotated using AddTrust
+	Trust *Trust `json:"trust,omitempty"`
 }
 
-type link struct {
+// Link is a dependency between two nodes of the graph, identified by their index
+type Link struct {
 	Source int   `json:"source"`
 	Target int   `json:"target"`
 	Path   []int `json:"path"`
+
+	// Status is set on graphs produced by Diff
+	Status DiffStatus `json:"status,omitempty"`
 }
 
-func serveDepGraphJSON(pkgs []*gorpa.Package) http.HandlerFunc {
+// NewGraph computes the dependency graph of the packages
+func NewGraph(pkgs ...*gorpa.Package) (*Graph, error) {
 	var (
-		nodes []node
-		links []link
+		nodes []Node
+		links []Link
 	)
 	for _, p := range pkgs {
-		n, l := computeDependencyGraph(p, len(nodes))
+		n, l, err := computeDependencyGraph(p, len(nodes))
+		if err != nil {
+			return nil, err
+		}
 		nodes = append(nodes, n...)
 		links = append(links, l...)
 	}
+	return &Graph{Nodes: nodes, Links: links}, nil
+}
 
-	js, _ := json.Marshal(graph{Nodes: nodes, Links: links})
-	return func(w http.ResponseWriter, r *http.Request) {
-		//nolint:errcheck
-		w.Write(js)
+// WriteSnapshot writes the graph as JSON, in the same format the graph view loads
+func (g *Graph) WriteSnapshot(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// ReadSnapshot reads a graph previously written using WriteSnapshot
+func ReadSnapshot(in io.Reader) (*Graph, error) {
+	var g Graph
+	err := json.NewDecoder(in).Decode(&g)
+	if err != nil {
+		return nil, err
 	}
+	return &g, nil
 }
 
-func computeDependencyGraph(pkg *gorpa.Package, offset int) ([]node, []link) {
+func computeDependencyGraph(pkg *gorpa.Package, offset int) ([]Node, []Link, error) {
 	var (
 		tdeps   = append(pkg.GetTransitiveDependencies(), pkg)
-		nodes   = make([]node, len(tdeps))
+		nodes   = make([]Node, len(tdeps))
 		nodeidx = make(map[string]int)
 		typeidx = make(map[string]int)
-		links   []link
+		links   []Link
 		walk    func(pkg *gorpa.Package, path []int)
 	)
 
 	for i, p := range tdeps {
-		nodes[i] = node{Name: p.FullName(), Component: p.C.Name, Type: getPackageType(p)}
+		version, err := p.Version()
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes[i] = Node{Name: p.FullName(), Component: p.C.Name, Version: version, Type: getPackageType(p)}
 		nodeidx[nodes[i].Name] = offset + i
 		typeidx[nodes[i].Type] = 0
 	}
@@ -108,7 +180,7 @@ func computeDependencyGraph(pkg *gorpa.Package, offset int) ([]node, []link) {
 	walk = func(p *gorpa.Package, path []int) {
 		src := nodeidx[p.FullName()]
 		for _, dep := range p.GetDependencies() {
-			links = append(links, link{
+			links = append(links, Link{
 				Source: src,
 				Target: nodeidx[dep.FullName()],
 				Path:   append(path, src),
@@ -118,7 +190,7 @@ func computeDependencyGraph(pkg *gorpa.Package, offset int) ([]node, []link) {
 	}
 	walk(pkg, nil)
 
-	return nodes, links
+	return nodes, links, nil
 }
 
 func getPackageType(pkg *gorpa.Package) (typen string) {
@@ -127,6 +199,12 @@ func getPackageType(pkg *gorpa.Package) (typen string) {
 		typen = "docker"
 	case gorpa.GenericPkgConfig:
 		typen = "generic"
+	case gorpa.ProtoPkgConfig:
+		typen = "proto-" + string(c.Generator)
+	case gorpa.PluginPkgConfig:
+		typen = "plugin-" + c.Plugin
+	case gorpa.MetaPkgConfig:
+		typen = "meta"
 	case gorpa.GoPkgConfig:
 		typen = "go-" + string(c.Packaging)
 	case gorpa.YarnPkgConfig:
@@ -0,0 +1,109 @@
+package graphview
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"sigs.k8s.io/bom/pkg/provenance"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+	"github.com/bhojpur/gorpa/pkg/provutil"
+)
+
+// Trust describes where the cached artifact of a package came from and who built it
+type Trust struct {
+	// Origin is empty if the artifact is not in the local cache
+	Origin      gorpa.ArtifactSource `json:"origin,omitempty"`
+	RemoteCache string               `json:"remoteCache,omitempty"`
+	// Builder is the builder ID the provenance of the artifact names, if the artifact contains provenance
+	Builder string `json:"builder,omitempty"`
+	// Signed is true if the provenance of the artifact is signed
+	Signed bool `json:"signed,omitempty"`
+}
+
+// ReadTrust determines the trust information of the package artifact in the local cache
+func ReadTrust(cache gorpa.Cache, pkg *gorpa.Package) (*Trust, error) {
+	fn, exists := cache.Location(pkg)
+	if !exists {
+		return &Trust{}, nil
+	}
+
+	origin, err := gorpa.ReadArtifactOrigin(fn)
+	if err != nil {
+		return nil, err
+	}
+	res := &Trust{Origin: origin.Source, RemoteCache: origin.RemoteCache}
+
+	err = gorpa.AccessAttestationBundleInCachedArchive(fn, func(bundle io.Reader) error {
+		return provutil.DecodeBundle(bundle, func(env *provenance.Envelope) error {
+			raw, err := base64.StdEncoding.DecodeString(env.Payload)
+			if err != nil {
+				return err
+			}
+			var stmt provenance.Statement
+			err = json.Unmarshal(raw, &stmt)
+			if err != nil {
+				return err
+			}
+			// the bundle contains the provenance of all dependencies, too
+			if stmt.Predicate.Recipe.EntryPoint != pkg.FullName() {
+				return nil
+			}
+			res.Builder = stmt.Predicate.Builder.ID
+			res.Signed = len(env.Signatures) > 0
+			return nil
+		})
+	})
+	if errors.Is(err, gorpa.ErrNoAttestationBundle) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AddTrust annotates the nodes of the graph with the trust information of their artifacts in the local cache
+func (g *Graph) AddTrust(cache gorpa.Cache, pkgs ...*gorpa.Package) error {
+	idx := make(map[string]*gorpa.Package)
+	for _, pkg := range pkgs {
+		for _, p := range append(pkg.GetTransitiveDependencies(), pkg) {
+			idx[p.FullName()] = p
+		}
+	}
+
+	for i, n := range g.Nodes {
+		p, ok := idx[n.Name]
+		if !ok {
+			continue
+		}
+		trust, err := ReadTrust(cache, p)
+		if err != nil {
+			return err
+		}
+		g.Nodes[i].Trust = trust
+	}
+	return nil
+}
@@ -48,7 +48,51 @@ var root = svg.append("g");
 
 var layouter = klay.d3adapter();
 
+function statusClass(prefix, d) {
+  return prefix + (d.status ? " " + prefix + "-" + d.status : "");
+}
+
+// trust mode, see gorpa describe dependencies --provenance
+var originColor = {
+  "built": "#1f77b4",
+  "remote": "#9467bd",
+  "unknown": "#7f7f7f",
+  "": "#e0e0e0"
+};
+
+function nodeLabel(d) {
+  var label = d.status ? d.name + " (" + d.status + ")" : d.name;
+  if (!d.trust) {
+    return label;
+  }
+  if (!d.trust.origin) {
+    return label + "<br>not in the local cache";
+  }
+  label += "<br>" + (d.trust.origin == "remote" ? "from " + d.trust.remoteCache : d.trust.origin);
+  if (d.trust.builder) {
+    label += "<br>built by " + d.trust.builder + (d.trust.signed ? " (signed)" : " (unsigned)");
+  }
+  return label;
+}
+
 d3.json("graph.json", function(error, graph) {
+  var isDiff = graph.nodes.some((n) => n.status) || graph.links.some((l) => l.status);
+  if (isDiff) {
+    d3.select("body").append("div")
+      .attr("class", "legend")
+      .html('<span style="border-color: #2ca02c">added</span>' +
+            '<span style="border-color: #d62728">removed</span>' +
+            '<span style="border-color: #ff7f0e">changed version</span>');
+  }
+  var isTrust = graph.nodes.some((n) => n.trust);
+  if (isTrust) {
+    d3.select("body").append("div")
+      .attr("class", "legend")
+      .html('<span style="border-color: ' + originColor["built"] + '">built locally</span>' +
+            '<span style="border-color: ' + originColor["remote"] + '">remote cache</span>' +
+            '<span style="border-color: ' + originColor["unknown"] + '">unknown origin</span>' +
+            '<span style="border-color: ' + originColor[""] + '">not cached</span>');
+  }
 
   layouter
       .nodes(graph.nodes)
@@ -64,7 +108,7 @@ d3.json("graph.json", function(error, graph) {
       .data(graph.links)
       .enter()
       .append("path")
-      .attr("class", "link")
+      .attr("class", (d) => statusClass("link", d))
       .attr("d", "M0 0")
       .attr("marker-end", "url(#arrowhead)")
       .style("stroke-width", function(d) { return Math.sqrt(d.value); });
@@ -73,17 +117,17 @@ d3.json("graph.json", function(error, graph) {
       .data(graph.nodes)
       .enter()
       .append("rect")
-      .attr("class", "node")
+      .attr("class", (d) => statusClass("node", d))
       .attr("width", 10)
       .attr("height", 10)
       .attr("x", 0)
       .attr("y", 0)
-      .style("fill", function(d) { return color(d.typeid); })
+      .style("fill", function(d) { return isTrust ? originColor[(d.trust || {}).origin || ""] : color(d.typeid); })
       .on("mouseover", function(d, di) {
         div.transition()
           .duration(100)
           .style("opacity", .9);
-        div.html(d.name)
+        div.html(nodeLabel(d))
           .style("left", (d3.event.pageX) + "px")
           .style("top", (d3.event.pageY - 28) + "px");
         d3.selectAll(".link").classed("link-hover", (l) => {
@@ -165,6 +165,8 @@ func addReplace(gomod *modfile.File, old, new module.Version, direct bool, sourc
 
 type goModule struct {
 	Name          string
+	GoModFn       string
+	GoVersion     string
 	OriginPath    string
 	OriginPackage string
 	Replacements  []*modfile.Replace
@@ -209,8 +211,14 @@ func collectReplacements(application *gorpa.Application) (mods map[string]goModu
 			}
 		}
 
+		var goVersion string
+		if gomod.Go != nil {
+			goVersion = gomod.Go.Version
+		}
 		mods[n] = goModule{
 			Name:          gomod.Module.Mod.Path,
+			GoModFn:       goModFn,
+			GoVersion:     goVersion,
 			OriginPath:    filepath.Dir(goModFn),
 			OriginPackage: n,
 			Replacements:  replace,
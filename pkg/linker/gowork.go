@@ -0,0 +1,183 @@
+package linker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// minGoWorkVersion is the first Go version which understands go.work files
+const minGoWorkVersion = "1.18"
+
+// LinkGoWorkspace generates or updates a go.work file in the application root which uses all Go
+// packages of the application. Unlike LinkGoModules this leaves the go.mod files alone, and removes
+// the replace directives a previous LinkGoModules run added to them.
+func LinkGoWorkspace(application *gorpa.Application) error {
+	mods, err := collectReplacements(application)
+	if err != nil {
+		return err
+	}
+
+	goWorkFn := filepath.Join(application.Origin, "go.work")
+	var gowork *modfile.WorkFile
+	if fc, err := ioutil.ReadFile(goWorkFn); err == nil {
+		gowork, err = modfile.ParseWork(goWorkFn, fc, nil)
+		if err != nil {
+			return err
+		}
+	} else if os.IsNotExist(err) {
+		gowork = &modfile.WorkFile{Syntax: &modfile.FileSyntax{}}
+	} else {
+		return err
+	}
+
+	goVersion := minGoWorkVersion
+	if gowork.Go != nil && semver.Compare("v"+gowork.Go.Version, "v"+goVersion) > 0 {
+		goVersion = gowork.Go.Version
+	}
+
+	names := make([]string, 0, len(mods))
+	for n := range mods {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	use := make(map[string]struct{})
+	for _, n := range names {
+		mod := mods[n]
+		relpath, err := filepath.Rel(application.Origin, mod.OriginPath)
+		if err != nil {
+			return err
+		}
+		relpath = "./" + filepath.ToSlash(relpath)
+		if relpath == "./." {
+			relpath = "."
+		}
+		use[relpath] = struct{}{}
+		if semver.Compare("v"+mod.GoVersion, "v"+goVersion) > 0 {
+			goVersion = mod.GoVersion
+		}
+
+		err = gowork.AddUse(relpath, mod.Name)
+		if err != nil {
+			return err
+		}
+		log.WithField("pkg", n).WithField("use", relpath).Debug("added Go module to workspace")
+	}
+	for _, u := range gowork.Use {
+		if u.Path == "" || !isGorpaUse(u) {
+			continue
+		}
+		if _, ok := use[u.Path]; !ok {
+			log.WithField("use", u.Path).Debug("removing Go module which is no longer part of the application from workspace")
+			err = gowork.DropUse(u.Path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, u := range gowork.Use {
+		if _, ok := use[u.Path]; ok {
+			u.Syntax.Comments.Suffix = []modfile.Comment{{Token: "// gorpa", Suffix: true}}
+		}
+	}
+
+	err = gowork.AddGoStmt(goVersion)
+	if err != nil {
+		return err
+	}
+	gowork.Cleanup()
+	gowork.SortBlocks()
+
+	err = ioutil.WriteFile(goWorkFn, modfile.Format(gowork.Syntax), 0644)
+	if err != nil {
+		return err
+	}
+	log.WithField("modules", len(use)).WithField("fn", goWorkFn).Info("linked Go modules using a workspace")
+
+	for _, n := range names {
+		err = unlinkGoModule(mods[n].GoModFn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unlinkGoModule removes the replace directives LinkGoModules added to a go.mod file.
+// Replacements marked as "gorpa ignore" are left alone.
+func unlinkGoModule(goModFn string) error {
+	fc, err := ioutil.ReadFile(goModFn)
+	if err != nil {
+		return err
+	}
+	gomod, err := modfile.Parse(goModFn, fc, nil)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	for _, rep := range gomod.Replace {
+		if ok, tpe := isGorpaReplace(rep); !ok || tpe == gorpaReplaceIgnore {
+			continue
+		}
+		err = gomod.DropReplace(rep.Old.Path, rep.Old.Version)
+		if err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	gomod.Cleanup()
+	fc, err = gomod.Format()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(goModFn, fc, 0644)
+	if err != nil {
+		return err
+	}
+	log.WithField("fn", goModFn).Info("removed replace directives added by an earlier gorpa link")
+	return nil
+}
+
+func isGorpaUse(u *modfile.Use) bool {
+	for _, c := range u.Syntax.Comments.Suffix {
+		if strings.Contains(c.Token, "gorpa") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package linker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/mod/modfile"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func writeTestApplication(t *testing.T, files map[string]string) gorpa.Application {
+	root := t.TempDir()
+	files["APPLICATION.yaml"] = ""
+	writeTestFiles(t, root, files)
+	application, err := gorpa.FindApplication(root, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return application
+}
+
+const goPackageBuildYAML = "packages:\n- name: lib\n  type: go\n  srcs:\n  - go.mod\n  config:\n    packaging: library\n"
+
+func TestLinkGoWorkspace(t *testing.T) {
+	tests := []struct {
+		Name      string
+		GoWork    string
+		GoVersion string
+		Use       []string
+	}{
+		{
+			Name:      "new workspace",
+			GoVersion: "1.18",
+			Use:       []string{"./a", "./b"},
+		},
+		{
+			Name:      "existing workspace",
+			GoWork:    "go 1.19\n\nuse (\n\t./manual\n\t./old // gorpa\n)\n",
+			GoVersion: "1.19",
+			Use:       []string{"./a", "./b", "./manual"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			files := map[string]string{
+				"a/BUILD.yaml": goPackageBuildYAML,
+				"a/go.mod":     "module example.com/a\n\ngo 1.17\n",
+				"b/BUILD.yaml": goPackageBuildYAML,
+				"b/go.mod":     "module example.com/b\n\ngo 1.17\n\nreplace (\n\texample.com/a => ../a // gorpa\n\texample.com/c => ../c\n)\n",
+			}
+			if test.GoWork != "" {
+				files["go.work"] = test.GoWork
+			}
+			application := writeTestApplication(t, files)
+
+			err := LinkGoWorkspace(&application)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fn := filepath.Join(application.Origin, "go.work")
+			fc, err := ioutil.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gowork, err := modfile.ParseWork(fn, fc, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gowork.Go == nil || gowork.Go.Version != test.GoVersion {
+				t.Errorf("expected go %s, got %v", test.GoVersion, gowork.Go)
+			}
+			var use []string
+			for _, u := range gowork.Use {
+				use = append(use, u.Path)
+				if exp, act := u.Path != "./manual", isGorpaUse(u); act != exp {
+					t.Errorf("use %s: expected gorpa marker %v, got %v", u.Path, exp, act)
+				}
+			}
+			if diff := cmp.Diff(test.Use, use); diff != "" {
+				t.Errorf("LinkGoWorkspace() use mismatch (-want +got):\n%s", diff)
+			}
+
+			gomod, err := ioutil.ReadFile(filepath.Join(application.Origin, "b", "go.mod"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(gomod), "example.com/a") {
+				t.Errorf("replace directive added by gorpa link was not removed:\n%s", gomod)
+			}
+			if !strings.Contains(string(gomod), "example.com/c => ../c") {
+				t.Errorf("replace directive not added by gorpa link was removed:\n%s", gomod)
+			}
+		})
+	}
+}
+
+func TestLinkGoWorkspaceGoVersion(t *testing.T) {
+	application := writeTestApplication(t, map[string]string{
+		"a/BUILD.yaml": goPackageBuildYAML,
+		"a/go.mod":     "module example.com/a\n\ngo 1.20\n",
+	})
+
+	err := LinkGoWorkspace(&application)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := ioutil.ReadFile(filepath.Join(application.Origin, "go.work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(fc), "go 1.20\n") {
+		t.Errorf("go.work does not require the Go version of its newest module:\n%s", fc)
+	}
+}
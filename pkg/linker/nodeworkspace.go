@@ -0,0 +1,284 @@
+package linker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+// NodeWorkspaceManager is the package manager whose workspaces link the yarn packages of an application
+type NodeWorkspaceManager string
+
+const (
+	// NodeWorkspaceNpm lists the packages in the workspaces field of the package.json in the application root
+	NodeWorkspaceNpm NodeWorkspaceManager = "npm"
+	// NodeWorkspacePnpm lists the packages in the pnpm-workspace.yaml in the application root
+	NodeWorkspacePnpm NodeWorkspaceManager = "pnpm"
+)
+
+// LinkNodeWorkspaces adds all yarn packages of the application to an npm or pnpm workspace in the application
+// root and installs it, s.t. the packages use each other rather than the versions in the registry. Workspace
+// entries which were not added by the Bhojpur GoRPA are kept, unless they point to a directory without package.json.
+func LinkNodeWorkspaces(application *gorpa.Application, manager NodeWorkspaceManager) error {
+	dirs, err := collectNodeWorkspaces(application)
+	if err != nil {
+		return err
+	}
+
+	switch manager {
+	case NodeWorkspaceNpm:
+		err = linkNpmWorkspace(application.Origin, dirs)
+	case NodeWorkspacePnpm:
+		err = linkPnpmWorkspace(application.Origin, dirs)
+	default:
+		return xerrors.Errorf("unknown workspace manager %s: must be %s or %s", manager, NodeWorkspaceNpm, NodeWorkspacePnpm)
+	}
+	if err != nil {
+		return err
+	}
+	log.WithField("packages", len(dirs)).WithField("manager", manager).Info("linked yarn packages using a workspace")
+
+	cmd := exec.Command(string(manager), "install")
+	log.WithField("cwd", application.Origin).WithField("cmd", manager).Debug("installing workspace")
+	cmd.Dir = application.Origin
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return xerrors.Errorf("%s install failed: %w", manager, err)
+	}
+	return nil
+}
+
+// collectNodeWorkspaces returns the sorted directories of all yarn packages relative to the application root
+func collectNodeWorkspaces(application *gorpa.Application) ([]string, error) {
+	idx := make(map[string]struct{})
+	for n, p := range application.Packages {
+		if p.Type != gorpa.YarnPackage {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(p.C.Origin, "package.json")); err != nil {
+			log.WithField("pkg", n).Warn("no package.json found - skipping")
+			continue
+		}
+		rel, err := filepath.Rel(application.Origin, p.C.Origin)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			log.WithField("pkg", n).Warn("packages in the application root cannot be part of a workspace - skipping")
+			continue
+		}
+		idx[filepath.ToSlash(rel)] = struct{}{}
+	}
+
+	res := make([]string, 0, len(idx))
+	for dir := range idx {
+		res = append(res, dir)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// mergeWorkspaces adds the package directories to the existing workspace entries. Globs and entries
+// which still point to a package are kept, all others are dropped.
+func mergeWorkspaces(root string, existing []string, dirs []string) []string {
+	var (
+		res  []string
+		seen = make(map[string]struct{})
+	)
+	for _, e := range existing {
+		dir := strings.TrimPrefix(e, "./")
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		if !strings.ContainsAny(dir, "*?[{!") {
+			if _, err := os.Stat(filepath.Join(root, dir, "package.json")); err != nil {
+				log.WithField("workspace", e).Debug("removing workspace which is no longer a package")
+				continue
+			}
+		}
+		seen[dir] = struct{}{}
+		res = append(res, e)
+	}
+	for _, dir := range dirs {
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		res = append(res, dir)
+	}
+	return res
+}
+
+func linkNpmWorkspace(root string, dirs []string) error {
+	fn := filepath.Join(root, "package.json")
+	pkgjson := make(map[string]interface{})
+	fc, err := ioutil.ReadFile(fn)
+	if err == nil {
+		err = json.Unmarshal(fc, &pkgjson)
+		if err != nil {
+			return xerrors.Errorf("cannot parse %s: %w", fn, err)
+		}
+	} else if os.IsNotExist(err) {
+		pkgjson["name"] = filepath.Base(root)
+		pkgjson["private"] = true
+	} else {
+		return err
+	}
+
+	var existing []string
+	switch ws := pkgjson["workspaces"].(type) {
+	case nil:
+	case []interface{}:
+		for _, e := range ws {
+			s, ok := e.(string)
+			if !ok {
+				return xerrors.Errorf("%s: workspaces must be a list of strings", fn)
+			}
+			existing = append(existing, s)
+		}
+	default:
+		return xerrors.Errorf("%s: workspaces must be a list of strings", fn)
+	}
+	pkgjson["workspaces"] = mergeWorkspaces(root, existing, dirs)
+
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(pkgjson)
+	f.Close()
+	return err
+}
+
+func linkPnpmWorkspace(root string, dirs []string) error {
+	fn := filepath.Join(root, "pnpm-workspace.yaml")
+	var ws yaml.Node
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(fc) > 0 {
+		err = yaml.Unmarshal(fc, &ws)
+		if err != nil {
+			return xerrors.Errorf("cannot parse %s: %w", fn, err)
+		}
+	}
+	if len(ws.Content) == 0 {
+		ws = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	doc := ws.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return xerrors.Errorf("%s: expected a map", fn)
+	}
+
+	// we edit the YAML nodes rather than a map to keep the other settings and comments of the file
+	var packages *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "packages" {
+			packages = doc.Content[i+1]
+			break
+		}
+	}
+	if packages == nil {
+		packages = &yaml.Node{Kind: yaml.SequenceNode}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "packages"}, packages)
+	}
+	if packages.Kind != yaml.SequenceNode {
+		return xerrors.Errorf("%s: packages must be a list", fn)
+	}
+	var (
+		existing []string
+		nodes    = make(map[string]*yaml.Node, len(packages.Content))
+	)
+	for _, e := range packages.Content {
+		existing = append(existing, e.Value)
+		nodes[e.Value] = e
+	}
+	packages.Content = nil
+	for _, e := range mergeWorkspaces(root, existing, dirs) {
+		node, ok := nodes[e]
+		if !ok {
+			node = &yaml.Node{Kind: yaml.ScalarNode, Value: e}
+		}
+		packages.Content = append(packages.Content, node)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	err = enc.Encode(&ws)
+	if err != nil {
+		return err
+	}
+	enc.Close()
+	err = ioutil.WriteFile(fn, out.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return enablePnpmWorkspaceLinking(root)
+}
+
+// pnpmLinkWorkspacePackages makes pnpm link workspace packages whose version satisfies a dependency
+// range, just like npm does. Otherwise pnpm links only dependencies with a workspace: range.
+const pnpmLinkWorkspacePackages = "link-workspace-packages"
+
+// enablePnpmWorkspaceLinking enables link-workspace-packages in the .npmrc in the application root,
+// unless the .npmrc configures it already.
+func enablePnpmWorkspaceLinking(root string) error {
+	fn := filepath.Join(root, ".npmrc")
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(fc), "\n") {
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if key == pnpmLinkWorkspacePackages {
+			log.WithField("fn", fn).Debug(pnpmLinkWorkspacePackages + " is configured already")
+			return nil
+		}
+	}
+
+	if len(fc) > 0 && !bytes.HasSuffix(fc, []byte("\n")) {
+		fc = append(fc, '\n')
+	}
+	fc = append(fc, []byte(pnpmLinkWorkspacePackages+"=true\n")...)
+	return ioutil.WriteFile(fn, fc, 0644)
+}
@@ -0,0 +1,137 @@
+package linker
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for fn, content := range files {
+		fn = filepath.Join(root, fn)
+		err := os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMergeWorkspaces(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a/package.json":         "{}",
+		"b/package.json":         "{}",
+		"manual/package.json":    "{}",
+		"removed/BUILD.yaml":     "",
+		"tools/foo/package.json": "{}",
+	})
+
+	tests := []struct {
+		Name        string
+		Existing    []string
+		Dirs        []string
+		Expectation []string
+	}{
+		{Name: "empty", Dirs: []string{"a", "b"}, Expectation: []string{"a", "b"}},
+		{Name: "keeps existing entries", Existing: []string{"manual", "./a"}, Dirs: []string{"a", "b"}, Expectation: []string{"manual", "./a", "b"}},
+		{Name: "keeps globs", Existing: []string{"tools/*", "!tools/bar"}, Dirs: []string{"a"}, Expectation: []string{"tools/*", "!tools/bar", "a"}},
+		{Name: "drops entries without package", Existing: []string{"removed", "missing", "a"}, Dirs: []string{"a"}, Expectation: []string{"a"}},
+		{Name: "drops duplicates", Existing: []string{"a", "./a"}, Dirs: []string{"a"}, Expectation: []string{"a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act := mergeWorkspaces(root, test.Existing, test.Dirs)
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("mergeWorkspaces() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLinkPnpmWorkspace(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Files         map[string]string
+		ExpectedYAML  string
+		ExpectedNpmrc string
+	}{
+		{
+			Name:          "new workspace",
+			ExpectedYAML:  "packages:\n  - a\n  - b\n",
+			ExpectedNpmrc: "link-workspace-packages=true\n",
+		},
+		{
+			Name: "existing workspace",
+			Files: map[string]string{
+				"pnpm-workspace.yaml": "# managed by hand\npackages:\n  - manual # keep me\n  - removed\n  - tools/*\nsharedWorkspaceLockfile: false\n",
+				"manual/package.json": "{}",
+				".npmrc":              "registry=https://registry.example.com",
+			},
+			ExpectedYAML:  "# managed by hand\npackages:\n  - manual # keep me\n  - tools/*\n  - a\n  - b\nsharedWorkspaceLockfile: false\n",
+			ExpectedNpmrc: "registry=https://registry.example.com\nlink-workspace-packages=true\n",
+		},
+		{
+			Name: "linking configured",
+			Files: map[string]string{
+				".npmrc": "link-workspace-packages = false\n",
+			},
+			ExpectedYAML:  "packages:\n  - a\n  - b\n",
+			ExpectedNpmrc: "link-workspace-packages = false\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			root := t.TempDir()
+			files := map[string]string{
+				"a/package.json": "{}",
+				"b/package.json": "{}",
+			}
+			for fn, content := range test.Files {
+				files[fn] = content
+			}
+			writeTestFiles(t, root, files)
+
+			err := linkPnpmWorkspace(root, []string{"a", "b"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for fn, exp := range map[string]string{"pnpm-workspace.yaml": test.ExpectedYAML, ".npmrc": test.ExpectedNpmrc} {
+				act, err := ioutil.ReadFile(filepath.Join(root, fn))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(exp, string(act)); diff != "" {
+					t.Errorf("%s mismatch (-want +got):\n%s", fn, diff)
+				}
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -41,7 +42,7 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 		pkgJSONIdx = make(map[string]string)
 	)
 	for n, p := range application.Packages {
-		if p.Type != gorpa.YarnPackage {
+		if !isYarnManaged(p) {
 			continue
 		}
 
@@ -73,7 +74,7 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 	}
 
 	for n, p := range application.Packages {
-		if p.Type != gorpa.YarnPackage {
+		if !isYarnManaged(p) {
 			continue
 		}
 		pkgjsonFn := pkgJSONIdx[n]
@@ -98,7 +99,7 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 			resolutions = make(map[string]interface{})
 		}
 		for _, dep := range p.GetTransitiveDependencies() {
-			if dep.Type != gorpa.YarnPackage {
+			if !isYarnManaged(dep) {
 				continue
 			}
 
@@ -107,7 +108,16 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 				log.WithField("dep", dep.FullName()).WithField("pkg", n).Warn("did not find yarn package name - linking might be broken")
 				continue
 			}
-			resolutions[yarnPkg] = fmt.Sprintf("portal://%s", dep.C.Origin)
+			// relative portals keep the package.json independent of where the application is checked out
+			rel, err := filepath.Rel(p.C.Origin, dep.C.Origin)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if !strings.HasPrefix(rel, "../") {
+				rel = "./" + rel
+			}
+			resolutions[yarnPkg] = fmt.Sprintf("portal:%s", rel)
 		}
 		if len(resolutions) > 0 {
 			pkgjson["resolutions"] = resolutions
@@ -131,13 +141,15 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 
 	var lerr error
 	for n, p := range application.Packages {
-		if p.Type != gorpa.YarnPackage {
+		if !isYarnManaged(p) {
 			continue
 		}
 
 		cmd := exec.Command("yarn")
 		log.WithField("pkg", n).WithField("cwd", p.C.Origin).WithField("cmd", "yarn").Debug("running yarn")
 		cmd.Dir = p.C.Origin
+		// the resolutions change the lockfile, which Yarn Berry refuses to do on CI by default
+		cmd.Env = append(os.Environ(), "YARN_ENABLE_IMMUTABLE_INSTALLS=false")
 		cmd.Stdout = os.Stdout
 		cmd.Stdin = os.Stdin
 		cmd.Stderr = os.Stderr
@@ -150,3 +162,13 @@ func LinkYarnPackagesWithYarn2(application *gorpa.Application) error {
 
 	return lerr
 }
+
+// isYarnManaged returns true for yarn packages which are not built using npm. Yarn's portal
+// resolutions cannot link those, hence the linker leaves them alone.
+func isYarnManaged(p *gorpa.Package) bool {
+	if p.Type != gorpa.YarnPackage {
+		return false
+	}
+	cfg, ok := p.Config.(gorpa.YarnPkgConfig)
+	return !ok || !cfg.IsNpm()
+}
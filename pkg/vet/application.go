@@ -0,0 +1,108 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func init() {
+	register(ApplicationCheck("unregistered-components", "finds directories with a go.mod, package.json or Dockerfile which are not part of any package", checkUnregisteredComponents))
+}
+
+// componentMarkers are the files which indicate that a directory contains something to build, in the order
+// in which we suggest package types for them
+var componentMarkers = []struct {
+	File string
+	Type gorpa.PackageType
+}{
+	{"go.mod", gorpa.GoPackage},
+	{"package.json", gorpa.YarnPackage},
+	{"Dockerfile", gorpa.DockerPackage},
+}
+
+func checkUnregisteredComponents(ba gorpa.Application) ([]Finding, error) {
+	covered := make(map[string]struct{})
+	for _, p := range ba.Packages {
+		for _, src := range p.Sources {
+			covered[src] = struct{}{}
+		}
+		if cfg, ok := p.Config.(gorpa.DockerPkgConfig); ok && cfg.Dockerfile != "" {
+			covered[filepath.Join(p.C.Origin, cfg.Dockerfile)] = struct{}{}
+		}
+	}
+
+	var res []Finding
+	err := filepath.WalkDir(ba.Origin, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != ba.Origin && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor" || ba.ShouldIgnoreSource(path)) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "BUILD.yaml")); err == nil {
+			return nil
+		}
+
+		var (
+			markers []string
+			tpe     gorpa.PackageType
+		)
+		for _, m := range componentMarkers {
+			fn := filepath.Join(path, m.File)
+			if _, err := os.Stat(fn); err != nil {
+				continue
+			}
+			if _, ok := covered[fn]; ok {
+				continue
+			}
+			markers = append(markers, m.File)
+			if tpe == "" {
+				tpe = m.Type
+			}
+		}
+		if len(markers) == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ba.Origin, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, Finding{
+			Description: fmt.Sprintf("%s contains %s but is not part of any package - run \"gorpa init --type %s <name>\" in it or add it to .gorpaignore", rel, strings.Join(markers, ", "), tpe),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func TestCheckUnregisteredComponents(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gorpa-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := map[string]string{
+		"APPLICATION.yaml":             "",
+		".gorpaignore":                 "experiments",
+		"lib/BUILD.yaml":               "packages:\n- name: lib\n  type: go\n  srcs: [\"go.mod\"]\n",
+		"lib/go.mod":                   "module example.com/lib\n",
+		"app/BUILD.yaml":               "packages:\n- name: img\n  type: docker\n  config:\n    dockerfile: docker/Dockerfile\n",
+		"app/docker/Dockerfile":        "FROM scratch\n",
+		"tools/migrate/go.mod":         "module example.com/migrate\n",
+		"tools/migrate/Dockerfile":     "FROM scratch\n",
+		"web/package.json":             "{}",
+		"web/node_modules/x/go.mod":    "module example.com/x\n",
+		"experiments/foo/go.mod":       "module example.com/foo\n",
+		".github/actions/package.json": "{}",
+	}
+	for fn, content := range files {
+		fn = filepath.Join(tmpdir, fn)
+		err = os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ba, err := gorpa.FindApplication(tmpdir, gorpa.Arguments{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, errs := Run(ba, WithChecks([]string{"application:unregistered-components"}))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var act []string
+	for _, f := range findings {
+		// application findings refer to neither a component nor a package
+		_, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		act = append(act, f.Description)
+	}
+	expectation := []string{
+		`tools/migrate contains go.mod, Dockerfile but is not part of any package - run "gorpa init --type go <name>" in it or add it to .gorpaignore`,
+		`web contains package.json but is not part of any package - run "gorpa init --type yarn <name>" in it or add it to .gorpaignore`,
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("application:unregistered-components mismatch (-want +got):\n%s", diff)
+	}
+}
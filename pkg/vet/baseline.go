@@ -0,0 +1,141 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// BaselineVersion is the version of the baseline file format
+const BaselineVersion = 1
+
+// Baseline records a set of known findings. Findings contained in a baseline are considered
+// accepted and not reported again, which lets an application enable vet before all legacy
+// issues are fixed.
+type Baseline struct {
+	Version  int             `json:"version"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry identifies a single finding in a baseline
+type BaselineEntry struct {
+	Check       string `json:"check"`
+	Component   string `json:"component,omitempty"`
+	Package     string `json:"package,omitempty"`
+	Description string `json:"description"`
+}
+
+func newBaselineEntry(f Finding) BaselineEntry {
+	res := BaselineEntry{
+		Check:       f.Check,
+		Description: f.Description,
+	}
+	if f.Component != nil {
+		res.Component = f.Component.Name
+	}
+	if f.Package != nil {
+		res.Package = f.Package.FullName()
+	}
+	return res
+}
+
+// NewBaseline produces a baseline accepting all findings
+func NewBaseline(findings []Finding) *Baseline {
+	res := &Baseline{
+		Version:  BaselineVersion,
+		Findings: make([]BaselineEntry, 0, len(findings)),
+	}
+	for _, f := range findings {
+		res.Findings = append(res.Findings, newBaselineEntry(f))
+	}
+	sort.Slice(res.Findings, func(i, j int) bool {
+		a, b := res.Findings[i], res.Findings[j]
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		if a.Component != b.Component {
+			return a.Component < b.Component
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Description < b.Description
+	})
+	return res
+}
+
+// LoadBaseline reads a baseline file
+func LoadBaseline(fn string) (*Baseline, error) {
+	fc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Baseline
+	err = json.Unmarshal(fc, &res)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot unmarshal baseline %s: %w", fn, err)
+	}
+	if res.Version != BaselineVersion {
+		return nil, xerrors.Errorf("baseline %s has unsupported version %d (expected %d)", fn, res.Version, BaselineVersion)
+	}
+	return &res, nil
+}
+
+// Save writes the baseline to a file
+func (b *Baseline) Save(fn string) error {
+	fc, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, append(fc, '\n'), 0644)
+}
+
+// Filter removes all findings contained in the baseline. Each baseline entry suppresses a single
+// finding, i.e. if a check reports the same problem more often than recorded, the surplus is reported.
+// Filter also returns the baseline entries which no longer match any finding.
+func (b *Baseline) Filter(findings []Finding) (newFindings []Finding, fixed []BaselineEntry) {
+	known := make(map[BaselineEntry]int, len(b.Findings))
+	for _, e := range b.Findings {
+		known[e]++
+	}
+
+	for _, f := range findings {
+		e := newBaselineEntry(f)
+		if known[e] > 0 {
+			known[e]--
+			continue
+		}
+		newFindings = append(newFindings, f)
+	}
+
+	for _, e := range b.Findings {
+		if known[e] > 0 {
+			known[e]--
+			fixed = append(fixed, e)
+		}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func TestBaselineFilter(t *testing.T) {
+	comp := &gorpa.Component{Name: "comp"}
+	finding := func(chk, desc string) Finding {
+		return Finding{Check: chk, Component: comp, Description: desc}
+	}
+
+	bl := NewBaseline([]Finding{
+		finding("component:a", "legacy"),
+		finding("component:a", "legacy"),
+		finding("component:b", "fixed since"),
+	})
+	fn := filepath.Join(t.TempDir(), "baseline.json")
+	err := bl.Save(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl, err = LoadBaseline(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFindings, fixed := bl.Filter([]Finding{
+		finding("component:a", "legacy"),
+		finding("component:a", "legacy"),
+		finding("component:a", "legacy"),
+		finding("component:c", "new"),
+	})
+
+	var act []string
+	for _, f := range newFindings {
+		act = append(act, f.Check+": "+f.Description)
+	}
+	if diff := cmp.Diff([]string{"component:a: legacy", "component:c: new"}, act); diff != "" {
+		t.Errorf("Filter() new findings mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]BaselineEntry{{Check: "component:b", Component: "comp", Description: "fixed since"}}, fixed); diff != "" {
+		t.Errorf("Filter() fixed entries mismatch (-want +got):\n%s", diff)
+	}
+}
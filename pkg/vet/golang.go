@@ -30,6 +30,28 @@ import (
 func init() {
 	register(PackageCheck("has-gomod", "ensures all Go packages have a go.mod file in their source list", gorpa.GoPackage, checkGolangHasGomod))
 	register(PackageCheck("has-buildflags", "checks for use of deprecated buildFlags config", gorpa.GoPackage, checkGolangHasBuildFlags))
+	register(PackageCheck("vendor", "ensures the vendor directory of Go packages built in vendor mode matches go.mod", gorpa.GoPackage, checkGolangVendor))
+}
+
+func checkGolangVendor(pkg *gorpa.Package) ([]Finding, error) {
+	goCfg, ok := pkg.Config.(gorpa.GoPkgConfig)
+	if !ok {
+		return nil, fmt.Errorf("Go package does not have Go package config")
+	}
+	if !goCfg.Vendor {
+		return nil, nil
+	}
+
+	err := gorpa.CheckGoVendor(pkg.C.Origin)
+	if err != nil {
+		return []Finding{{
+			Component:   pkg.C,
+			Description: err.Error(),
+			Error:       true,
+			Package:     pkg,
+		}}, nil
+	}
+	return nil, nil
 }
 
 func checkGolangHasGomod(pkg *gorpa.Package) ([]Finding, error) {
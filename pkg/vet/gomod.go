@@ -0,0 +1,257 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/xerrors"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func init() {
+	register(&checkGoModuleDrift{})
+	register(&checkGoReplaceHygiene{})
+}
+
+// readGoMod parses the go.mod in the sources of a Go package. It returns nil if there is none.
+func readGoMod(pkg *gorpa.Package) (*modfile.File, error) {
+	for _, src := range pkg.Sources {
+		if !strings.HasSuffix(src, "/go.mod") {
+			continue
+		}
+		fc, err := ioutil.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		return modfile.Parse(src, fc, nil)
+	}
+	return nil, nil
+}
+
+// applicationModules maps the module paths of all Go packages in the application to their packages
+func applicationModules(ba gorpa.Application) (map[string]*gorpa.Package, error) {
+	res := make(map[string]*gorpa.Package)
+	for _, p := range ba.Packages {
+		if p.Type != gorpa.GoPackage {
+			continue
+		}
+		gomod, err := readGoMod(p)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", p.FullName(), err)
+		}
+		if gomod == nil || gomod.Module == nil {
+			continue
+		}
+		res[gomod.Module.Mod.Path] = p
+	}
+	return res, nil
+}
+
+// checkGoModuleDrift reports modules which the Go packages of the application require in different major versions
+type checkGoModuleDrift struct {
+	findings map[*gorpa.Package][]Finding
+}
+
+func (c *checkGoModuleDrift) Info() CheckInfo {
+	tpe := gorpa.GoPackage
+	return CheckInfo{
+		Name:          "go:module-drift",
+		Description:   "checks if Go packages require different major versions of the same module",
+		AppliesToType: &tpe,
+		PackageCheck:  true,
+	}
+}
+
+type goModuleUsage struct {
+	Package *gorpa.Package
+	Version string
+	Major   string
+}
+
+func (c *checkGoModuleDrift) Init(ba gorpa.Application) error {
+	local, err := applicationModules(ba)
+	if err != nil {
+		return err
+	}
+
+	usages := make(map[string][]goModuleUsage)
+	for _, p := range ba.Packages {
+		if p.Type != gorpa.GoPackage {
+			continue
+		}
+		gomod, err := readGoMod(p)
+		if err != nil {
+			return xerrors.Errorf("%s: %w", p.FullName(), err)
+		}
+		if gomod == nil {
+			continue
+		}
+		for _, req := range gomod.Require {
+			if _, ok := local[req.Mod.Path]; ok {
+				// modules of the application are linked rather than required in a version
+				continue
+			}
+			prefix, _, ok := module.SplitPathVersion(req.Mod.Path)
+			if !ok {
+				prefix = req.Mod.Path
+			}
+			usages[prefix] = append(usages[prefix], goModuleUsage{
+				Package: p,
+				Version: req.Mod.Version,
+				Major:   semver.Major(req.Mod.Version),
+			})
+		}
+	}
+
+	c.findings = make(map[*gorpa.Package][]Finding)
+	for mod, use := range usages {
+		sort.Slice(use, func(i, j int) bool {
+			if d := semver.Compare(use[i].Version, use[j].Version); d != 0 {
+				return d < 0
+			}
+			return use[i].Package.FullName() < use[j].Package.FullName()
+		})
+
+		var (
+			majors int
+			lines  []string
+		)
+		for i, u := range use {
+			if i == 0 || use[i-1].Major != u.Major {
+				majors++
+			}
+			if i == 0 || use[i-1].Version != u.Version {
+				lines = append(lines, u.Version+" ("+u.Package.FullName())
+			} else {
+				lines[len(lines)-1] += ", " + u.Package.FullName()
+			}
+		}
+		if majors < 2 {
+			continue
+		}
+
+		// we report the drift once per module, on the first package which requires the oldest version
+		p := use[0].Package
+		c.findings[p] = append(c.findings[p], Finding{
+			Component:   p.C,
+			Package:     p,
+			Description: fmt.Sprintf("%s drifted across %d major versions: %s)", mod, majors, strings.Join(lines, "), ")),
+			Error:       true,
+		})
+	}
+	for _, f := range c.findings {
+		sort.Slice(f, func(i, j int) bool { return f[i].Description < f[j].Description })
+	}
+	return nil
+}
+
+func (c *checkGoModuleDrift) RunCmp(pkg *gorpa.Component) ([]Finding, error) {
+	return nil, fmt.Errorf("not a component check")
+}
+
+func (c *checkGoModuleDrift) RunPkg(pkg *gorpa.Package) ([]Finding, error) {
+	return c.findings[pkg], nil
+}
+
+// checkGoReplaceHygiene reports replace directives which were not added by the linker and break builds or linking
+type checkGoReplaceHygiene struct {
+	origin  string
+	modules map[string]*gorpa.Package
+}
+
+func (c *checkGoReplaceHygiene) Info() CheckInfo {
+	tpe := gorpa.GoPackage
+	return CheckInfo{
+		Name:          "go:replace-hygiene",
+		Description:   "checks for replace directives which point outside the application or would conflict with gorpa link",
+		AppliesToType: &tpe,
+		PackageCheck:  true,
+	}
+}
+
+func (c *checkGoReplaceHygiene) Init(ba gorpa.Application) (err error) {
+	c.origin = ba.Origin
+	c.modules, err = applicationModules(ba)
+	return err
+}
+
+func (c *checkGoReplaceHygiene) RunCmp(pkg *gorpa.Component) ([]Finding, error) {
+	return nil, fmt.Errorf("not a component check")
+}
+
+func (c *checkGoReplaceHygiene) RunPkg(pkg *gorpa.Package) ([]Finding, error) {
+	gomod, err := readGoMod(pkg)
+	if err != nil || gomod == nil {
+		return nil, err
+	}
+
+	var res []Finding
+	for _, rep := range gomod.Replace {
+		if isLinkerReplace(rep) {
+			continue
+		}
+
+		var desc string
+		if dep, ok := c.modules[rep.Old.Path]; ok {
+			desc = fmt.Sprintf("replace of %s was not added by gorpa link, which links it to %s - remove the replace", rep.Old.Path, dep.FullName())
+		} else if rep.New.Version == "" {
+			dir := rep.New.Path
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(filepath.Dir(gomod.Syntax.Name), dir)
+			}
+			if rel, err := filepath.Rel(c.origin, dir); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				desc = fmt.Sprintf("replace of %s points outside the application: %s", rep.Old.Path, rep.New.Path)
+			} else if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+				desc = fmt.Sprintf("replace of %s points to %s which contains no go.mod", rep.Old.Path, rep.New.Path)
+			}
+		}
+		if desc == "" {
+			continue
+		}
+		res = append(res, Finding{
+			Component:   pkg.C,
+			Package:     pkg,
+			Description: desc,
+			Error:       true,
+		})
+	}
+	return res, nil
+}
+
+// isLinkerReplace returns true if gorpa link added the replace directive
+func isLinkerReplace(rep *modfile.Replace) bool {
+	for _, c := range rep.Syntax.Suffix {
+		if strings.Contains(c.Token, "gorpa") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func TestGoModChecks(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gorpa-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := map[string]string{
+		"APPLICATION.yaml": "",
+		"a/BUILD.yaml":     "packages:\n- name: lib\n  type: go\n  srcs: [\"go.mod\"]\n",
+		"a/go.mod": `module example.com/a
+
+require (
+	github.com/foo/bar v1.2.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+replace example.com/vendored => ../../vendored
+`,
+		"b/BUILD.yaml": "packages:\n- name: app\n  type: go\n  srcs: [\"go.mod\"]\n",
+		"b/go.mod": `module example.com/b
+
+require (
+	example.com/a v0.0.0
+	github.com/foo/bar/v2 v2.0.1
+	gopkg.in/yaml.v3 v3.0.0
+)
+
+replace (
+	example.com/a => ../a // gorpa
+	example.com/missing => ./missing
+)
+`,
+		"c/BUILD.yaml": "packages:\n- name: app\n  type: go\n  srcs: [\"go.mod\"]\n",
+		"c/go.mod": `module example.com/c
+
+require (
+	example.com/a v0.0.0
+	github.com/foo/bar/v2 v2.0.1
+)
+
+replace example.com/a => ../a
+`,
+	}
+	for fn, content := range files {
+		fn = filepath.Join(tmpdir, fn)
+		err = os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ba, err := gorpa.FindApplication(tmpdir, gorpa.Arguments{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name        string
+		Check       Check
+		Expectation []string
+	}{
+		{
+			Name:  "module drift",
+			Check: &checkGoModuleDrift{},
+			Expectation: []string{
+				"a:lib: github.com/foo/bar drifted across 2 major versions: v1.2.0 (a:lib), v2.0.1 (b:app, c:app)",
+				"a:lib: gopkg.in/yaml drifted across 2 major versions: v2.4.0 (a:lib), v3.0.0 (b:app)",
+			},
+		},
+		{
+			Name:  "replace hygiene",
+			Check: &checkGoReplaceHygiene{},
+			Expectation: []string{
+				"a:lib: replace of example.com/vendored points outside the application: ../../vendored",
+				"b:app: replace of example.com/missing points to ./missing which contains no go.mod",
+				"c:app: replace of example.com/a was not added by gorpa link, which links it to a:lib - remove the replace",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Check.Init(ba)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var act []string
+			for _, name := range []string{"a:lib", "b:app", "c:app"} {
+				findings, err := test.Check.RunPkg(ba.Packages[name])
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range findings {
+					act = append(act, f.Package.FullName()+": "+f.Description)
+				}
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("%s mismatch (-want +got):\n%s", test.Check.Info().Name, diff)
+			}
+		})
+	}
+}
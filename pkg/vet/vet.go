@@ -23,7 +23,10 @@ package vet
 import (
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/xerrors"
@@ -36,6 +39,7 @@ type checkFunc struct {
 
 	runPkg func(pkg *gorpa.Package) ([]Finding, error)
 	runCmp func(pkg *gorpa.Component) ([]Finding, error)
+	runApp func(ba gorpa.Application) ([]Finding, error)
 }
 
 func (cf *checkFunc) Info() CheckInfo {
@@ -60,6 +64,13 @@ func (cf *checkFunc) RunCmp(pkg *gorpa.Component) ([]Finding, error) {
 	return cf.runCmp(pkg)
 }
 
+func (cf *checkFunc) RunApp(ba gorpa.Application) ([]Finding, error) {
+	if cf.runApp == nil {
+		return nil, xerrors.Errorf("not an application check")
+	}
+	return cf.runApp(ba)
+}
+
 // PackageCheck produces a new check for a Bhojpur GoRPA package
 func PackageCheck(name, desc string, tpe gorpa.PackageType, chk func(pkg *gorpa.Package) ([]Finding, error)) Check {
 	return &checkFunc{
@@ -85,6 +96,24 @@ func ComponentCheck(name, desc string, chk func(pkg *gorpa.Component) ([]Finding
 	}
 }
 
+// ApplicationCheck produces a new check for a Bhojpur GoRPA application as a whole. Its findings
+// may refer to neither a component nor a package.
+func ApplicationCheck(name, desc string, chk func(ba gorpa.Application) ([]Finding, error)) Check {
+	return &checkFunc{
+		info: CheckInfo{
+			Name:             fmt.Sprintf("application:%s", name),
+			Description:      desc,
+			ApplicationCheck: true,
+		},
+		runApp: chk,
+	}
+}
+
+// applicationCheck is implemented by checks with ApplicationCheck set in their info
+type applicationCheck interface {
+	RunApp(ba gorpa.Application) ([]Finding, error)
+}
+
 // Check implements a vet check
 type Check interface {
 	Info() CheckInfo
@@ -100,9 +129,12 @@ type CheckInfo struct {
 	Description   string
 	PackageCheck  bool
 	AppliesToType *gorpa.PackageType
+	// ApplicationCheck checks run once per application rather than per component or package
+	ApplicationCheck bool
 }
 
-// Finding describes a check finding. If the package is nil, the finding applies to the component
+// Finding describes a check finding. If the package is nil, the finding applies to the component.
+// If the component is nil as well, the finding applies to the application.
 type Finding struct {
 	Check       string
 	Component   *gorpa.Component
@@ -115,13 +147,15 @@ type Finding struct {
 func (f Finding) MarshalJSON() ([]byte, error) {
 	var p struct {
 		Check       string `json:"check"`
-		Component   string `json:"component"`
+		Component   string `json:"component,omitempty"`
 		Package     string `json:"package,omitempty"`
 		Description string `json:"description,omitempty"`
 		Error       bool   `json:"error"`
 	}
 	p.Check = f.Check
-	p.Component = f.Component.Name
+	if f.Component != nil {
+		p.Component = f.Component.Name
+	}
 	if f.Package != nil {
 		p.Package = f.Package.FullName()
 	}
@@ -217,23 +251,46 @@ func Run(application gorpa.Application, options ...RunOpt) ([]Finding, []error)
 	var (
 		findings []Finding
 		errs     []error
-
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, runtime.NumCPU())
+
+		// run runs a check concurrently to all others. Checks only read the state they
+		// collected in Init, hence they're safe to run in parallel.
+		run = func(name string, chk func() ([]Finding, error)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				f, err := chk()
+				for i := range f {
+					f[i].Check = name
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+				findings = append(findings, f...)
+			}()
+		}
 		runCompCheck = func(c Check, comp *gorpa.Component) {
 			info := c.Info()
-			if info.PackageCheck {
+			if info.PackageCheck || info.ApplicationCheck {
 				return
 			}
 
-			log.WithField("check", info.Name).WithField("cmp", comp.Name).Debug("running component check")
-			f, err := c.RunCmp(comp)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("%s: %w", comp.Name, err))
-				return
-			}
-			for i := range f {
-				f[i].Check = info.Name
-			}
-			findings = append(findings, f...)
+			run(info.Name, func() ([]Finding, error) {
+				log.WithField("check", info.Name).WithField("cmp", comp.Name).Debug("running component check")
+				f, err := c.RunCmp(comp)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", comp.Name, err)
+				}
+				return f, nil
+			})
 		}
 		runPkgCheck = func(c Check, pkg *gorpa.Package) {
 			info := c.Info()
@@ -245,20 +302,18 @@ func Run(application gorpa.Application, options ...RunOpt) ([]Finding, []error)
 				return
 			}
 
-			log.WithField("check", info.Name).WithField("pkg", pkg.FullName()).Debug("running package check")
-			f, err := c.RunPkg(pkg)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("%s: %w", pkg.FullName(), err))
-				return
-			}
-			for i := range f {
-				f[i].Check = info.Name
-			}
-			findings = append(findings, f...)
+			run(info.Name, func() ([]Finding, error) {
+				log.WithField("check", info.Name).WithField("pkg", pkg.FullName()).Debug("running package check")
+				f, err := c.RunPkg(pkg)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", pkg.FullName(), err)
+				}
+				return f, nil
+			})
 		}
 	)
 
-	if len(opts.Components) > 0 {
+	if len(opts.Components) > 0 || len(opts.Packages) > 0 {
 		for n, comp := range application.Components {
 			if _, ok := opts.Components[n]; !ok {
 				continue
@@ -268,7 +323,6 @@ func Run(application gorpa.Application, options ...RunOpt) ([]Finding, []error)
 				runCompCheck(check, comp)
 			}
 		}
-	} else if len(opts.Packages) > 0 {
 		for n, pkg := range application.Packages {
 			if _, ok := opts.Packages[n]; !ok {
 				continue
@@ -280,6 +334,15 @@ func Run(application gorpa.Application, options ...RunOpt) ([]Finding, []error)
 		}
 	} else {
 		for _, check := range checks {
+			if ac, ok := check.(applicationCheck); ok && check.Info().ApplicationCheck {
+				name := check.Info().Name
+				run(name, func() ([]Finding, error) {
+					log.WithField("check", name).Debug("running application check")
+					return ac.RunApp(application)
+				})
+				continue
+			}
+
 			for _, comp := range application.Components {
 				runCompCheck(check, comp)
 			}
@@ -289,6 +352,22 @@ func Run(application gorpa.Application, options ...RunOpt) ([]Finding, []error)
 			}
 		}
 	}
+	wg.Wait()
+
+	sort.SliceStable(findings, func(i, j int) bool { return findingKey(findings[i]) < findingKey(findings[j]) })
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
 
 	return findings, errs
 }
+
+// findingKey orders findings of parallel checks s.t. vet produces the same output on each run
+func findingKey(f Finding) string {
+	var cmp, pkg string
+	if f.Component != nil {
+		cmp = f.Component.Name
+	}
+	if f.Package != nil {
+		pkg = f.Package.FullName()
+	}
+	return strings.Join([]string{f.Check, cmp, pkg, f.Description}, "\x00")
+}
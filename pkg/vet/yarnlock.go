@@ -0,0 +1,284 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func init() {
+	register(&checkYarnLockDrift{})
+}
+
+// checkYarnLockDrift compares the versions the yarn.lock files of the application resolve the
+// dependencies of their package.json to.
+type checkYarnLockDrift struct {
+	// findings are the drift findings indexed by the package they're reported on
+	findings map[*gorpa.Package][]Finding
+}
+
+func (c *checkYarnLockDrift) Info() CheckInfo {
+	tpe := gorpa.YarnPackage
+	return CheckInfo{
+		Name:          "yarn:lockfile-drift",
+		Description:   "checks if packages resolve the same npm dependency to versions which differ beyond the policy in the APPLICATION.yaml",
+		AppliesToType: &tpe,
+		PackageCheck:  true,
+	}
+}
+
+type yarnDependencyUsage struct {
+	Package *gorpa.Package
+	Version string
+}
+
+func (c *checkYarnLockDrift) Init(ba gorpa.Application) error {
+	policy := ba.Vet.YarnLockDrift
+	if policy.Level == "" {
+		policy.Level = "major"
+	}
+	if policy.Level != "major" && policy.Level != "minor" && policy.Level != "patch" {
+		return xerrors.Errorf("invalid yarnLockDrift level %s: must be major, minor or patch", policy.Level)
+	}
+	var (
+		only   = make(map[string]struct{}, len(policy.Dependencies))
+		ignore = make(map[string]struct{}, len(policy.Ignore))
+	)
+	for _, d := range policy.Dependencies {
+		only[d] = struct{}{}
+	}
+	for _, d := range policy.Ignore {
+		ignore[d] = struct{}{}
+	}
+
+	usages := make(map[string][]yarnDependencyUsage)
+	for _, p := range ba.Packages {
+		if p.Type != gorpa.YarnPackage {
+			continue
+		}
+		resolved, err := resolveYarnDependencies(p)
+		if err != nil {
+			return xerrors.Errorf("%s: %w", p.FullName(), err)
+		}
+		for dep, version := range resolved {
+			if _, ok := ignore[dep]; ok {
+				continue
+			}
+			if _, ok := only[dep]; len(only) > 0 && !ok {
+				continue
+			}
+			usages[dep] = append(usages[dep], yarnDependencyUsage{Package: p, Version: version})
+		}
+	}
+
+	c.findings = make(map[*gorpa.Package][]Finding)
+	for dep, use := range usages {
+		sort.Slice(use, func(i, j int) bool {
+			if d := compareSemver(use[i].Version, use[j].Version); d != 0 {
+				return d < 0
+			}
+			return use[i].Package.FullName() < use[j].Package.FullName()
+		})
+
+		var (
+			groups []string
+			lines  []string
+		)
+		for i, u := range use {
+			group := semverPrefix(u.Version, policy.Level)
+			if i == 0 || semverPrefix(use[i-1].Version, policy.Level) != group {
+				groups = append(groups, group)
+			}
+			if i == 0 || use[i-1].Version != u.Version {
+				lines = append(lines, u.Version+" ("+u.Package.FullName())
+			} else {
+				lines[len(lines)-1] += ", " + u.Package.FullName()
+			}
+		}
+		if len(groups) < 2 {
+			continue
+		}
+
+		// we report the drift once per dependency, on the first package which uses the oldest version
+		p := use[0].Package
+		c.findings[p] = append(c.findings[p], Finding{
+			Component:   p.C,
+			Package:     p,
+			Description: fmt.Sprintf("%s drifted across %d %s versions: %s)", dep, len(groups), policy.Level, strings.Join(lines, "), ")),
+			Error:       true,
+		})
+	}
+	for _, f := range c.findings {
+		sort.Slice(f, func(i, j int) bool { return f[i].Description < f[j].Description })
+	}
+
+	return nil
+}
+
+func (c *checkYarnLockDrift) RunCmp(pkg *gorpa.Component) ([]Finding, error) {
+	return nil, fmt.Errorf("not a component check")
+}
+
+func (c *checkYarnLockDrift) RunPkg(pkg *gorpa.Package) ([]Finding, error) {
+	return c.findings[pkg], nil
+}
+
+// resolveYarnDependencies returns the versions the yarn.lock of a package resolves its direct dependencies to
+func resolveYarnDependencies(p *gorpa.Package) (map[string]string, error) {
+	cfg, ok := p.Config.(gorpa.YarnPkgConfig)
+	if !ok || cfg.IsNpm() {
+		return nil, nil
+	}
+	lockFN := filepath.Join(p.C.Origin, "yarn.lock")
+	if cfg.YarnLock != "" {
+		lockFN = filepath.Join(p.C.Origin, cfg.YarnLock)
+	}
+	f, err := os.Open(lockFN)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lock, err := parseYarnLock(f)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot parse %s: %w", lockFN, err)
+	}
+
+	fc, err := ioutil.ReadFile(filepath.Join(p.C.Origin, "package.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pkgjson struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	err = json.Unmarshal(fc, &pkgjson)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string)
+	for _, deps := range []map[string]string{pkgjson.DevDependencies, pkgjson.Dependencies} {
+		for name, rng := range deps {
+			version, ok := lock[name+"@"+rng]
+			if !ok {
+				// Yarn 2+ prefixes the ranges of registry dependencies with the protocol
+				version, ok = lock[name+"@npm:"+rng]
+			}
+			if ok {
+				res[name] = version
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseYarnLock maps the dependency specs (name@range) of a yarn.lock to the version they resolve to.
+// Both the Yarn 1 format and the YAML-based format of Yarn 2+ are supported.
+func parseYarnLock(r io.Reader) (map[string]string, error) {
+	var (
+		res   = make(map[string]string)
+		specs []string
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":") {
+			specs = specs[:0]
+			for _, spec := range strings.Split(strings.TrimSuffix(line, ":"), ",") {
+				specs = append(specs, strings.Trim(strings.TrimSpace(spec), `"`))
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimSuffix(fields[0], ":") != "version" || strings.HasPrefix(line, "    ") {
+			continue
+		}
+		version := strings.Trim(fields[1], `"`)
+		for _, spec := range specs {
+			res[spec] = version
+		}
+	}
+	return res, scanner.Err()
+}
+
+// semverPrefix returns the part of a version which must match at the given level. As with caret ranges,
+// a change of the left-most non-zero component counts as major change.
+func semverPrefix(version, level string) string {
+	segs := semverSegments(version)
+	n := 1
+	switch level {
+	case "minor":
+		n = 2
+	case "patch":
+		n = 3
+	}
+	for i := 0; i < len(segs)-1 && segs[i] == 0 && n < 3; i++ {
+		n++
+	}
+	res := make([]string, n)
+	for i := range res {
+		res[i] = strconv.Itoa(segs[i])
+	}
+	return strings.Join(res, ".")
+}
+
+func semverSegments(version string) [3]int {
+	var res [3]int
+	version = strings.SplitN(version, "-", 2)[0]
+	for i, seg := range strings.SplitN(version, ".", 3) {
+		res[i], _ = strconv.Atoi(seg)
+	}
+	return res
+}
+
+func compareSemver(a, b string) int {
+	sa, sb := semverSegments(a), semverSegments(b)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return sa[i] - sb[i]
+		}
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,155 @@
+package vet
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	gorpa "github.com/bhojpur/gorpa/pkg/engine"
+)
+
+func TestParseYarnLock(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Lockfile    string
+		Expectation map[string]string
+	}{
+		{
+			Name: "yarn v1",
+			Lockfile: `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@babel/core@^7.0.0", "@babel/core@^7.1.0":
+  version "7.16.0"
+  resolved "https://registry.yarnpkg.com/@babel/core/-/core-7.16.0.tgz"
+  dependencies:
+    debug "^4.1.0"
+
+react@^17.0.0:
+  version "17.0.2"
+`,
+			Expectation: map[string]string{
+				"@babel/core@^7.0.0": "7.16.0",
+				"@babel/core@^7.1.0": "7.16.0",
+				"react@^17.0.0":      "17.0.2",
+			},
+		},
+		{
+			Name: "yarn berry",
+			Lockfile: `__metadata:
+  version: 6
+
+"react@npm:^16.8.0, react@npm:^16.14.0":
+  version: 16.14.0
+  resolution: "react@npm:16.14.0"
+  dependencies:
+    loose-envify: ^1.1.0
+`,
+			Expectation: map[string]string{
+				"__metadata":         "6",
+				"react@npm:^16.8.0":  "16.14.0",
+				"react@npm:^16.14.0": "16.14.0",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			act, err := parseYarnLock(strings.NewReader(test.Lockfile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.Expectation, act); diff != "" {
+				t.Errorf("parseYarnLock() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckYarnLockDrift(t *testing.T) {
+	if _, err := exec.LookPath("yarn"); err != nil {
+		t.Skip("yarn is not installed")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gorpa-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	files := map[string]string{
+		"APPLICATION.yaml": "vet:\n  yarnLockDrift:\n    ignore: [lodash]\n",
+		"a/BUILD.yaml":     "packages:\n- name: lib\n  type: yarn\n  srcs: [\"package.json\"]\n",
+		"a/package.json":   `{"dependencies": {"react": "^16.8.0", "lodash": "^3.0.0"}}`,
+		"a/yarn.lock":      "react@^16.8.0:\n  version \"16.14.0\"\n\nlodash@^3.0.0:\n  version \"3.10.1\"\n",
+		"b/BUILD.yaml":     "packages:\n- name: app\n  type: yarn\n  srcs: [\"package.json\"]\n",
+		"b/package.json":   `{"dependencies": {"react": "^17.0.0", "lodash": "^4.0.0"}}`,
+		"b/yarn.lock":      "react@^17.0.0:\n  version \"17.0.2\"\n\nlodash@^4.0.0:\n  version \"4.17.21\"\n",
+		"c/BUILD.yaml":     "packages:\n- name: app\n  type: yarn\n  srcs: [\"package.json\"]\n",
+		"c/package.json":   `{"devDependencies": {"react": "^17.0.1"}}`,
+		"c/yarn.lock":      "react@^17.0.1:\n  version \"17.0.2\"\n",
+	}
+	for fn, content := range files {
+		fn = filepath.Join(tmpdir, fn)
+		err = os.MkdirAll(filepath.Dir(fn), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fn, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ba, err := gorpa.FindApplication(tmpdir, gorpa.Arguments{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chk checkYarnLockDrift
+	err = chk.Init(ba)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var act []string
+	for _, name := range []string{"a:lib", "b:app", "c:app"} {
+		findings, err := chk.RunPkg(ba.Packages[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range findings {
+			act = append(act, f.Package.FullName()+": "+f.Description)
+		}
+	}
+	expectation := []string{
+		"a:lib: react drifted across 2 major versions: 16.14.0 (a:lib), 17.0.2 (b:app, c:app)",
+	}
+	if diff := cmp.Diff(expectation, act); diff != "" {
+		t.Errorf("yarn:lockfile-drift mismatch (-want +got):\n%s", diff)
+	}
+}